@@ -0,0 +1,213 @@
+// Package cmd provides the adopt command for DevDrop.
+//
+// The adopt command rescues a hand-tuned container from another machine:
+// - Connects to the remote Docker daemon over SSH
+// - Commits the remote container to an image
+// - Transfers the image by streaming it directly or through the registry
+// - Registers the image locally as a DevDrop environment
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt ssh://[user@]host[:port]#container",
+	Short: "Adopt a container from another machine as an environment",
+	Long: `Turn a container running on another machine into a DevDrop environment,
+for example to rescue a hand-tuned setup from an old workstation.
+
+DevDrop connects to the remote Docker daemon over SSH (using your ssh
+config and agent; the remote user must be able to run docker), commits
+the container and transfers the resulting image to this machine:
+
+  --via stream    Stream the image directly over SSH (default)
+  --via registry  Push from the remote machine to your registry and pull
+                  it here; faster when both sides have good bandwidth to
+                  the registry. Requires 'devdrop login'.
+
+The environment is named after the container unless --name is given. The
+remote container is left untouched.
+
+Examples:
+  devdrop adopt ssh://me@old-box#devbox
+  devdrop adopt ssh://old-box:2222#3f2a1b --name rescued
+  devdrop adopt ssh://old-box#devbox --via registry`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAdopt,
+}
+
+var (
+	adoptName string
+	adoptVia  string
+)
+
+func init() {
+	rootCmd.AddCommand(adoptCmd)
+	adoptCmd.Flags().StringVar(&adoptName, "name", "", "Environment name (default: the container name)")
+	adoptCmd.Flags().StringVar(&adoptVia, "via", "stream", "How to transfer the image: stream or registry")
+}
+
+func runAdopt(cmd *cobra.Command, args []string) error {
+	target, containerRef, found := strings.Cut(args[0], "#")
+	if !found || containerRef == "" || !strings.HasPrefix(target, "ssh://") {
+		return fmt.Errorf("invalid source '%s': expected ssh://[user@]host#container", args[0])
+	}
+	if adoptVia != "stream" && adoptVia != "registry" {
+		return fmt.Errorf("invalid --via '%s': must be stream or registry", adoptVia)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	fmt.Printf("Connecting to Docker on %s...\n", target)
+	remote, err := docker.NewSSHClient(target)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	if quiet {
+		remote.SetProgressOutput(nil)
+	}
+	remote.SetPlainProgress(output.Plain)
+	remote.SetTransferAttempts(cfg.TransferAttempts)
+
+	containerName, baseImage, err := remote.ContainerImage(containerRef)
+	if err != nil {
+		return err
+	}
+
+	name := adoptName
+	if name == "" {
+		name = strings.ToLower(containerName)
+	}
+	targetEnv := config.EnsureDevDropPrefix(name)
+	if _, exists := cfg.Environments[targetEnv]; exists {
+		return fmt.Errorf("environment '%s' already exists. Use --name to adopt under another name", targetEnv)
+	}
+
+	local, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer local.Close()
+
+	// The image travels under a tag of its own, so tags the remote machine
+	// already has, such as its own copy of the environment, are left alone
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	suffix, err := randomSuffix()
+	if err != nil {
+		return err
+	}
+	transferImage := cfg.GetEnvironmentImageRef(targetEnv, "adopt-"+suffix)
+	fmt.Printf("Committing remote container %s as %s...\n", containerName, imageName)
+	if err := remote.CommitContainer(containerRef, transferImage, commitOptions(cfg, nil)); err != nil {
+		return fmt.Errorf("failed to commit remote container: %w", err)
+	}
+	// Only the tag is removed; the remote container and its layers stay as they were
+	defer remote.RemoveImageTag(transferImage)
+
+	if adoptVia == "registry" {
+		err = adoptViaRegistry(remote, local, cfg, targetEnv, transferImage)
+	} else {
+		err = adoptViaStream(remote, local, transferImage)
+	}
+	if err != nil {
+		return err
+	}
+	if err := local.TagImage(transferImage, imageName); err != nil {
+		return err
+	}
+	if err := local.RemoveImageTag(transferImage); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	env := config.Environment{
+		Image:       imageName,
+		BaseImage:   baseImage,
+		Created:     time.Now(),
+		LastUpdated: time.Now(),
+		Registry:    cfg.Registry,
+		Description: fmt.Sprintf("Adopted from %s#%s", target, containerName),
+	}
+	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+		return fmt.Errorf("failed to save environment to config: %w", err)
+	}
+	recordInStore(local, cfg, targetEnv, "latest")
+
+	fmt.Println()
+	output.Successf("Adopted %s#%s as environment '%s'", target, containerName, targetEnv)
+	fmt.Printf("Run 'devdrop run %s' to use it, and 'devdrop commit %s' after a session to push it to your registry.\n", targetEnv, targetEnv)
+
+	return nil
+}
+
+// adoptViaStream pipes docker save on the remote machine into docker load here
+func adoptViaStream(remote, local *docker.Client, imageName string) error {
+	fmt.Println("Streaming image over SSH...")
+	archive, err := remote.SaveImage(imageName)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	return local.LoadImage(archive)
+}
+
+// adoptViaRegistry pushes from the remote machine and pulls the image here.
+// The pushed tag is deleted from the registry again where it supports that.
+func adoptViaRegistry(remote, local *docker.Client, cfg *config.Config, targetEnv, imageName string) error {
+	authToken := environmentAuthToken(cfg, targetEnv)
+	if authToken == "" {
+		return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+	}
+
+	fmt.Printf("Pushing %s from the remote machine...\n", imageName)
+	if err := remote.PushImage(imageName, authToken); err != nil {
+		return fmt.Errorf("failed to push image from remote: %w", err)
+	}
+
+	fmt.Printf("Pulling %s...\n", imageName)
+	if err := local.PullImage(imageName, authToken); err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+
+	_, tag := splitImageTag(imageName)
+	if err := deleteRemoteTag(cfg, targetEnv, tag); err != nil {
+		fmt.Printf("Warning: the temporary tag %s is still in the registry: %v\n", tag, err)
+	}
+	return nil
+}
+
+// deleteRemoteTag deletes a tag of an environment from its registry
+func deleteRemoteTag(cfg *config.Config, targetEnv, tag string) error {
+	host := cfg.GetEnvironmentRegistry(targetEnv)
+	login := cfg.GetRegistryLogin(host)
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil {
+		return err
+	}
+	backend, err := registry.New(host, login.Type, creds)
+	if err != nil {
+		return err
+	}
+	manager, ok := backend.(registry.TagManager)
+	if !ok {
+		return fmt.Errorf("deleting tags isn't supported for %s", host)
+	}
+	return manager.DeleteTag(login.Username, targetEnv, tag)
+}
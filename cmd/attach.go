@@ -0,0 +1,165 @@
+// Package cmd provides the attach command for DevDrop.
+//
+// The attach command reconnects to a running environment session:
+// - Finds running containers labelled with the environment
+// - Re-attaches the terminal to the session's shell
+// - Records the container for commit when the session ends
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/spf13/cobra"
+)
+
+var attachCmd = &cobra.Command{
+	Use:   "attach [environment-name]",
+	Short: "Reconnect to a running environment session",
+	Long: `Reconnect your terminal to a running session of an environment, for
+example after the terminal that ran 'devdrop run' or 'devdrop init' was
+closed. The shell and everything running in it are exactly as you left them.
+
+Sessions are found by the devdrop.environment label DevDrop puts on its
+containers. If several sessions are running you are asked which one to use.
+When the session ends, the container is recorded for 'devdrop commit' just
+like after 'devdrop run'.
+
+Press Enter after attaching if the shell prompt isn't shown right away.
+
+Examples:
+  devdrop attach          # Reconnect to the current environment
+  devdrop attach myenv    # Reconnect to devdrop-myenv`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runAttach,
+}
+
+func init() {
+	rootCmd.AddCommand(attachCmd)
+}
+
+func runAttach(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var targetEnv string
+	if len(args) == 0 {
+		if targetEnv, err = defaultEnvironment(cfg); err != nil {
+			return err
+		}
+	} else {
+		targetEnv = config.EnsureDevDropPrefix(args[0])
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	session, err := findRunningSession(dockerClient, cfg, targetEnv)
+	if err != nil {
+		return err
+	}
+	return attachSession(dockerClient, cfg, targetEnv, session)
+}
+
+// attachSession attaches the terminal to a running session container and
+// records it for commit once the session ends
+func attachSession(dockerClient *docker.Client, cfg *config.Config, targetEnv string, session docker.ContainerInfo) error {
+	fmt.Printf("Attaching to %s (container %s)...\n", targetEnv, shortID(session.ID))
+	fmt.Println("Press Enter if the prompt doesn't appear.")
+	output.Emit(output.Event{Event: output.EventSessionStarted, Environment: targetEnv, Image: session.Image, Container: session.ID})
+	if err := dockerClient.AttachInteractiveContainer(session.ID); err != nil {
+		return err
+	}
+	output.Emit(output.Event{Event: output.EventSessionEnded, Environment: targetEnv, Container: session.ID})
+
+	fmt.Println()
+	fmt.Println("Development session ended.")
+	if session.Ephemeral {
+		// Sessions that sync changes back aren't removed by the daemon
+		dockerClient.RemoveContainer(session.ID)
+		fmt.Println("Ephemeral session; the container is removed and there is nothing to commit.")
+		return nil
+	}
+
+	env, exists := cfg.Environments[targetEnv]
+	switch {
+	case !exists:
+		// The session was started by a 'devdrop init' that never finished
+		env = config.Environment{
+			BaseImage:     session.Image,
+			Created:       time.Now(),
+			LastUpdated:   time.Now(),
+			LastContainer: session.ID,
+			LastUsed:      time.Now(),
+			Registry:      cfg.Registry,
+			Description:   fmt.Sprintf("Environment based on %s", session.Image),
+		}
+		if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+			return fmt.Errorf("failed to save environment to config: %w", err)
+		}
+	case isPlatformContainer(env, session.ID):
+		// Already recorded by 'devdrop run --platform'
+	default:
+		if err := cfg.SetEnvironmentContainer(targetEnv, session.ID); err != nil {
+			return fmt.Errorf("failed to save container ID to config: %w", err)
+		}
+	}
+
+	output.Successf("Container saved for potential commit. Run 'devdrop commit %s' to save your changes.", targetEnv)
+	return nil
+}
+
+// findRunningSession picks the running session container of an environment,
+// asking when there are several. Containers from before sessions were
+// labelled are found through the environment's last container.
+func findRunningSession(dockerClient *docker.Client, cfg *config.Config, targetEnv string) (docker.ContainerInfo, error) {
+	sessions, err := dockerClient.FindContainers(targetEnv, true)
+	if err != nil {
+		return docker.ContainerInfo{}, err
+	}
+
+	if len(sessions) == 0 {
+		env := cfg.Environments[targetEnv]
+		if env.LastContainer != "" {
+			if state, err := dockerClient.ContainerState(env.LastContainer); err == nil && state == "running" {
+				_, image, _ := dockerClient.ContainerImage(env.LastContainer)
+				return docker.ContainerInfo{ID: env.LastContainer, Image: image, State: state}, nil
+			}
+		}
+		return docker.ContainerInfo{}, fmt.Errorf("no running session for environment '%s'. Run 'devdrop run %s' to start one", targetEnv, targetEnv)
+	}
+
+	if len(sessions) == 1 {
+		return sessions[0], nil
+	}
+
+	fmt.Printf("Running sessions of %s:\n", targetEnv)
+	labels := make([]string, len(sessions))
+	for i, session := range sessions {
+		labels[i] = fmt.Sprintf("%s (%s, started %s)", shortID(session.ID), session.Name, output.RelativeTime(session.Created))
+	}
+	choice, err := prompt.Select("Select session to attach to", labels, 0)
+	if err != nil {
+		return docker.ContainerInfo{}, withPromptHint(err, "stop the sessions you don't need with 'docker stop'")
+	}
+	return sessions[choice], nil
+}
+
+// isPlatformContainer reports whether a container was run with --platform
+func isPlatformContainer(env config.Environment, containerID string) bool {
+	for _, id := range env.PlatformContainers {
+		if id == containerID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Package cmd provides the bootstrap-script command for DevDrop.
+//
+// The bootstrap-script command records what an environment has installed:
+// - Lists the apt or apk packages, pip packages and global npm packages in its image
+// - Leaves out what the base image already has
+// - Emits a shell script that installs them again, with the apt history as comments
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/bootstrap"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var bootstrapScriptCmd = &cobra.Command{
+	Use:   "bootstrap-script [environment-name]",
+	Short: "Generate a shell script that installs an environment's packages",
+	Long: `Generate a shell script that installs the packages of an environment, to
+recreate it declaratively or to audit what it has in it.
+
+The script covers the OS packages installed on purpose (apt's manually
+installed packages, or apk's world on Alpine), the packages pip freeze
+reports and the global npm packages, pinned to the installed versions
+unless --unpinned is given. The apt history is included as comments.
+
+Packages the base image already has are left out, so the script is meant
+to run as root on top of the base image, e.g. as a RUN step of a
+Dockerfile. The base image is pulled if it isn't present; with --all, or
+when it can't be pulled, every package in the image is listed.
+
+Files added by hand, tools installed outside these package managers and
+configuration changes aren't captured; see 'devdrop export-dockerfile' for
+the image history.
+
+Examples:
+  devdrop bootstrap-script                      # Current environment to stdout
+  devdrop bootstrap-script myenv -o bootstrap.sh
+  devdrop bootstrap-script myenv --unpinned     # Install the latest versions`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runBootstrapScript,
+}
+
+var (
+	bootstrapScriptOutput   string
+	bootstrapScriptUnpinned bool
+	bootstrapScriptAll      bool
+)
+
+func init() {
+	rootCmd.AddCommand(bootstrapScriptCmd)
+	bootstrapScriptCmd.Flags().StringVarP(&bootstrapScriptOutput, "output", "o", "", "Write the script to a file instead of stdout")
+	bootstrapScriptCmd.Flags().BoolVar(&bootstrapScriptUnpinned, "unpinned", false, "Install the latest versions instead of the installed ones")
+	bootstrapScriptCmd.Flags().BoolVar(&bootstrapScriptAll, "all", false, "Include the packages of the base image")
+}
+
+func runBootstrapScript(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Keep stdout clean for the script
+	if !quiet {
+		dockerClient.SetProgressOutput(os.Stderr)
+	}
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if useImage == env.BaseImage {
+		fmt.Fprintf(os.Stderr, "Environment '%s' has not been committed yet.\n", targetEnv)
+	}
+
+	fmt.Fprintf(os.Stderr, "Listing the packages in %s...\n", useImage)
+	inventory, err := dockerClient.CaptureInventory(useImage)
+	if err != nil {
+		return err
+	}
+
+	opts := bootstrap.ScriptOptions{
+		Environment: targetEnv,
+		Image:       useImage,
+		Unpinned:    bootstrapScriptUnpinned,
+		Created:     time.Now(),
+	}
+	if !bootstrapScriptAll && env.BaseImage != "" && useImage != env.BaseImage {
+		if base, err := baseImageInventory(dockerClient, env.BaseImage); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: listing every package, as the base image can't be compared: %v\n", err)
+		} else {
+			inventory = inventory.Without(base)
+			opts.BaseImage = env.BaseImage
+		}
+	}
+
+	script := bootstrap.Script(inventory, opts)
+	if bootstrapScriptOutput == "" {
+		fmt.Print(script)
+		return nil
+	}
+
+	if err := os.WriteFile(bootstrapScriptOutput, []byte(script), 0755); err != nil {
+		return fmt.Errorf("failed to write bootstrap script: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Bootstrap script written to %s\n", bootstrapScriptOutput)
+
+	return nil
+}
+
+// baseImageInventory lists the packages of a base image, pulling it first
+// when it isn't present
+func baseImageInventory(dockerClient *docker.Client, baseImage string) (bootstrap.Inventory, error) {
+	if !dockerClient.ImageExists(baseImage) {
+		if err := dockerClient.PullImage(baseImage, ""); err != nil {
+			return bootstrap.Inventory{}, err
+		}
+	}
+	return dockerClient.CaptureInventory(baseImage)
+}
@@ -0,0 +1,232 @@
+// Package cmd provides the build command for DevDrop.
+//
+// The build command creates environments from a devdrop.yaml spec:
+// - Generates a Dockerfile from the spec's base image, packages, env and run commands
+// - Builds one environment per variant, sharing cached layers between them
+// - Tags each build as a new version and records it in the configuration
+// - Optionally pushes the results to the registry
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/spec"
+	"github.com/spf13/cobra"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Build environments from a devdrop.yaml spec",
+	Long: `Build development environments from a declarative devdrop.yaml spec,
+as a reproducible alternative to the interactive init/commit workflow.
+
+A spec names the environment, its base image, the packages, environment
+variables and commands that set it up, and the ports, mounts and cache
+volumes to use whenever it runs. Variants turn one spec into a build matrix: each variant becomes
+its own environment named <name>-<variant>, with its own build arguments
+or platform. All variants are built from the same generated Dockerfile,
+so steps that don't depend on a variant's arguments are cached and shared.
+
+Example devdrop.yaml:
+  name: go
+  base_image: golang:${GO_VERSION}
+  packages: [ripgrep, make]
+  env:
+    CGO_ENABLED: "0"
+  run:
+    - go install golang.org/x/tools/gopls@latest
+  ports: ["8080:8080"]
+  mounts: ["~/.config/gh:/root/.config/gh:ro"]
+  volumes: ["gocache:/root/go/pkg/mod"]
+  variants:
+    - name: go1.22
+      args: {GO_VERSION: "1.22"}
+    - name: go1.23
+      args: {GO_VERSION: "1.23"}
+
+Each build is tagged as the environment's next version and as latest.
+Use --push to publish the results to your registry.
+
+Examples:
+  devdrop build                    # Build every variant in ./devdrop.yaml
+  devdrop build --variant go1.23   # Build a single variant
+  devdrop build -f envs/go.yaml --push`,
+	Args: cobra.NoArgs,
+	RunE: runBuild,
+}
+
+var (
+	buildFile     string
+	buildVariants []string
+	buildPush     bool
+)
+
+func init() {
+	rootCmd.AddCommand(buildCmd)
+	buildCmd.Flags().StringVarP(&buildFile, "file", "f", spec.FileName, "Path to the environment spec")
+	buildCmd.Flags().StringSliceVar(&buildVariants, "variant", nil, "Only build the named variants (repeatable)")
+	buildCmd.Flags().BoolVar(&buildPush, "push", false, "Push the built environments to the registry")
+}
+
+func runBuild(cmd *cobra.Command, args []string) error {
+	envSpec, err := spec.Load(buildFile)
+	if err != nil {
+		return err
+	}
+
+	targets, err := selectBuildTargets(envSpec.Targets(), buildVariants)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	if err := docker.ValidatePorts(envSpec.Ports); err != nil {
+		return err
+	}
+	if err := validateServices(envSpec.Services); err != nil {
+		return err
+	}
+
+	dockerfile := envSpec.Dockerfile()
+	specDir, _ := filepath.Abs(filepath.Dir(buildFile))
+	mounts := specMounts(envSpec.Mounts, specDir)
+
+	var built []string
+	for _, target := range targets {
+		targetEnv := config.EnsureDevDropPrefix(target.Environment)
+		env, exists := cfg.Environments[targetEnv]
+		if !exists {
+			env = config.Environment{
+				Created:     time.Now(),
+				Description: fmt.Sprintf("Built from %s", filepath.Join(specDir, filepath.Base(buildFile))),
+			}
+		}
+
+		imageName := cfg.GetEnvironmentImageName(targetEnv)
+		versionTag := env.NextVersionTag()
+		versionImage := cfg.GetEnvironmentImageRef(targetEnv, versionTag)
+
+		fmt.Printf("Building environment: %s (version %s)\n", targetEnv, versionTag)
+		if target.Platform != "" {
+			fmt.Printf("Platform: %s\n", target.Platform)
+		}
+
+		err := dockerClient.BuildImage(docker.BuildOptions{
+			Dockerfile: dockerfile,
+			Tags:       []string{imageName, versionImage},
+			BuildArgs:  target.BuildArgs,
+			Platform:   target.Platform,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", targetEnv, err)
+		}
+
+		if lock, err := dockerClient.CaptureTools(imageName); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			env.Tools = lock
+		}
+
+		if buildPush {
+			if env.LocalOnly {
+				return errLocalOnly(targetEnv, "pushed")
+			}
+			authToken := environmentAuthToken(cfg, targetEnv)
+			if authToken == "" {
+				return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+			}
+
+			fmt.Printf("Pushing image %s to %s...\n", imageName, registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+			if err := dockerClient.PushImage(versionImage, authToken); err != nil {
+				return fmt.Errorf("failed to push image: %w", err)
+			}
+			if err := dockerClient.PushImage(imageName, authToken); err != nil {
+				return fmt.Errorf("failed to push image: %w", err)
+			}
+		}
+
+		env.Image = imageName
+		env.BaseImage = envSpec.ResolveBaseImage(target)
+		env.LastUpdated = time.Now()
+		env.Versions = append(env.Versions, config.Version{Tag: versionTag, Created: env.LastUpdated})
+		env.LatestVersion = versionTag
+		env.Ports = envSpec.Ports
+		env.Mounts = mounts
+		env.Volumes = envSpec.Volumes
+		env.Hooks = envSpec.Hooks.WithDir(specDir)
+		env.Services = envSpec.Services
+		if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+			return fmt.Errorf("failed to update configuration: %w", err)
+		}
+		recordInStore(dockerClient, cfg, targetEnv, "latest", versionTag)
+
+		built = append(built, targetEnv)
+		fmt.Println()
+	}
+
+	for _, name := range built {
+		output.Successf("Environment '%s' built", name)
+	}
+	if !buildPush {
+		fmt.Println("Run 'devdrop build --push' to publish the environments to your registry.")
+	}
+
+	return nil
+}
+
+// specMounts resolves relative mount sources against the spec directory so
+// they keep working when the environment runs elsewhere. ~ is kept and
+// expanded at run time.
+func specMounts(mounts []string, specDir string) []string {
+	resolved := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		src, _, _, _ := spec.ParseMount(mount)
+		if src != "~" && !strings.HasPrefix(src, "~/") && !filepath.IsAbs(src) {
+			mount = filepath.Join(specDir, src) + strings.TrimPrefix(mount, src)
+		}
+		resolved = append(resolved, mount)
+	}
+	return resolved
+}
+
+// selectBuildTargets filters targets down to the requested variants
+func selectBuildTargets(targets []spec.Target, variants []string) ([]spec.Target, error) {
+	if len(variants) == 0 {
+		return targets, nil
+	}
+
+	byVariant := make(map[string]spec.Target, len(targets))
+	for _, target := range targets {
+		byVariant[target.Variant] = target
+	}
+
+	selected := make([]spec.Target, 0, len(variants))
+	for _, name := range variants {
+		target, exists := byVariant[name]
+		if !exists || name == "" {
+			return nil, fmt.Errorf("variant '%s' not found in %s", name, buildFile)
+		}
+		selected = append(selected, target)
+	}
+	return selected, nil
+}
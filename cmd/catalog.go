@@ -0,0 +1,170 @@
+// Package cmd provides the catalog command for DevDrop.
+//
+// The catalog command manages the system catalog of approved environments:
+// - Lists the environments every user of the machine can start from
+// - Lets administrators add and remove entries
+// - Users create their own environment from an entry with 'devdrop init --system'
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "Manage the system catalog of approved environments",
+	Long: `Manage the system catalog: environments approved for everyone on a shared
+machine. The catalog lives in /etc/devdrop/catalog.yaml (override with
+DEVDROP_SYSTEM_CATALOG), is readable by all users and writable only by
+administrators.
+
+Users start their own environment from a catalog entry with
+'devdrop init --system <name>'; their config, containers and images stay
+their own. Pin an entry with --digest to make init refuse any other image
+than the approved one.
+
+Examples:
+  devdrop catalog ls                                        # What's approved?
+  sudo devdrop catalog add go-1.22 acme/go-dev:1.22 -d "Go toolchain with linters"
+  sudo devdrop catalog add go-1.22 acme/go-dev:1.22 --digest sha256:4f1c...
+  sudo devdrop catalog rm go-1.21
+  devdrop init --system go-1.22                             # Start from an entry`,
+}
+
+var catalogLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the approved environments",
+	Args:  cobra.NoArgs,
+	RunE:  runCatalogLs,
+}
+
+var catalogAddCmd = &cobra.Command{
+	Use:   "add <name> <image>",
+	Short: "Add or update an approved environment (administrators only)",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runCatalogAdd,
+}
+
+var catalogRmCmd = &cobra.Command{
+	Use:   "rm <name>",
+	Short: "Remove an approved environment (administrators only)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runCatalogRm,
+}
+
+var (
+	catalogDescription string
+	catalogDigest      string
+	catalogOutput      string
+)
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogLsCmd, catalogAddCmd, catalogRmCmd)
+	catalogLsCmd.Flags().StringVarP(&catalogOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	catalogAddCmd.Flags().StringVarP(&catalogDescription, "description", "d", "", "What the environment is for")
+	catalogAddCmd.Flags().StringVar(&catalogDigest, "digest", "", "Pin the image to a registry digest (sha256:...)")
+}
+
+func runCatalogLs(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(catalogOutput); err != nil {
+		return err
+	}
+	return printCatalog(catalogOutput)
+}
+
+// printCatalog lists the system catalog; also used by 'devdrop ls --system'
+func printCatalog(format string) error {
+	catalog, err := config.LoadCatalog()
+	if err != nil {
+		return err
+	}
+
+	if format != output.FormatText {
+		return output.Render(os.Stdout, format, catalog)
+	}
+
+	if len(catalog.Environments) == 0 {
+		fmt.Printf("The system catalog (%s) is empty.\n", config.GetCatalogPath())
+		return nil
+	}
+
+	fmt.Println("Approved environments:")
+	for _, name := range catalog.Names() {
+		entry := catalog.Environments[name]
+		fmt.Printf("  %-20s %s\n", name, entry.Image)
+		if entry.Description != "" {
+			fmt.Printf("  %-20s %s\n", "", entry.Description)
+		}
+		if entry.Digest != "" {
+			fmt.Printf("  %-20s pinned to %s\n", "", entry.Digest)
+		}
+	}
+	fmt.Println()
+	fmt.Println("Start from one with 'devdrop init --system <name>'.")
+	return nil
+}
+
+func runCatalogAdd(cmd *cobra.Command, args []string) error {
+	name, image := args[0], args[1]
+	if _, err := reference.ParseNormalizedNamed(image); err != nil {
+		return fmt.Errorf("invalid image '%s': %w", image, err)
+	}
+	if catalogDigest != "" {
+		if _, err := digest.Parse(catalogDigest); err != nil {
+			return fmt.Errorf("invalid --digest '%s': %w", catalogDigest, err)
+		}
+	}
+
+	catalog, err := config.LoadCatalog()
+	if err != nil {
+		return err
+	}
+
+	_, updated := catalog.Environments[name]
+	catalog.Environments[name] = config.CatalogEntry{Image: image, Description: catalogDescription, Digest: catalogDigest}
+	if err := saveCatalog(catalog); err != nil {
+		return err
+	}
+
+	if updated {
+		output.Successf("Updated %s in the system catalog", name)
+	} else {
+		output.Successf("Added %s to the system catalog", name)
+	}
+	return nil
+}
+
+func runCatalogRm(cmd *cobra.Command, args []string) error {
+	catalog, err := config.LoadCatalog()
+	if err != nil {
+		return err
+	}
+
+	if _, exists := catalog.Environments[args[0]]; !exists {
+		return fmt.Errorf("'%s' is not in the system catalog. Run 'devdrop catalog ls' to see entries", args[0])
+	}
+	delete(catalog.Environments, args[0])
+	if err := saveCatalog(catalog); err != nil {
+		return err
+	}
+
+	output.Successf("Removed %s from the system catalog", args[0])
+	return nil
+}
+
+func saveCatalog(catalog *config.Catalog) error {
+	err := catalog.Save()
+	if errors.Is(err, config.ErrCatalogReadOnly) {
+		return fmt.Errorf("%w; run the command as an administrator (e.g. with sudo) to change %s", err, config.GetCatalogPath())
+	}
+	return err
+}
@@ -0,0 +1,353 @@
+// Package cmd provides the clean command for DevDrop.
+//
+// The clean command reclaims space used by DevDrop on the host:
+// - Removes stopped session containers found by their devdrop labels
+// - Removes devdrop images no environment references any more
+// - Keeps uncommitted sessions and recent versions unless --all is given
+// - Offers to free space when a command fails because the disk is full
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/spf13/cobra"
+)
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove stopped devdrop containers and unreferenced images",
+	Long: `Remove stopped session containers and devdrop images that are no longer
+needed, and report the space reclaimed.
+
+Removed by default:
+  - stopped containers labelled with a devdrop environment, except the ones
+    recorded for 'devdrop commit' (they hold uncommitted changes)
+  - dangling images left behind by earlier commits and pulls
+  - tags of environments that are no longer configured and of versions no
+    longer in an environment's history
+  - temporary images left by an interrupted 'devdrop commit --dry-run'
+
+With --all, containers recorded for commit are removed too (their changes
+are lost) and local copies of versions other than the latest are dropped;
+they stay in the registry and 'devdrop rollback' pulls them back.
+
+Running containers and other users' containers are never touched. Images
+recorded in the experimental store are left to 'devdrop store gc', and cache
+volumes to 'devdrop volume prune'.
+
+When a pull, commit or build fails because the disk is full, DevDrop shows
+Docker's disk usage and offers to run clean (and to prune dangling images
+and build cache) on the spot.
+
+Examples:
+  devdrop clean --dry-run    # Show what would be removed
+  devdrop clean              # Remove stopped containers and stale images
+  devdrop clean --all        # Also discard uncommitted sessions and old versions`,
+	Args: cobra.NoArgs,
+	RunE: runClean,
+}
+
+var (
+	cleanAll    bool
+	cleanDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(cleanCmd)
+	cleanCmd.Flags().BoolVar(&cleanAll, "all", false, "Also remove containers awaiting commit and local copies of old versions")
+	cleanCmd.Flags().BoolVar(&cleanDryRun, "dry-run", false, "Show what would be removed without removing anything")
+}
+
+// cleanImage is an image with the tags clean would remove from it
+type cleanImage struct {
+	image docker.ImageSummary
+	tags  []string
+	// whole is set when nothing referenced is left, so the image itself goes
+	whole bool
+}
+
+func runClean(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containers, err := staleContainers(dockerClient, cfg)
+	if err != nil {
+		return err
+	}
+	images, err := staleImages(dockerClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	if len(containers) == 0 && len(images) == 0 {
+		fmt.Println("Nothing to clean.")
+		return nil
+	}
+
+	verb := "Removing"
+	if cleanDryRun {
+		verb = "Would remove"
+	}
+
+	removedContainers := 0
+	for _, container := range containers {
+		fmt.Printf("%s container %s (%s, %s, created %s)\n", verb, shortID(container.ID), container.Environment, container.State, output.RelativeTime(container.Created))
+		if cleanDryRun {
+			continue
+		}
+		if err := dockerClient.RemoveContainer(container.ID); err != nil {
+			fmt.Printf("  skipped: %v\n", err)
+			continue
+		}
+		removedContainers++
+	}
+
+	var reclaimed int64
+	removedImages := 0
+	for _, stale := range images {
+		if stale.whole {
+			name := shortID(stale.image.ID)
+			if len(stale.tags) > 0 {
+				name = strings.Join(stale.tags, ", ")
+			}
+			fmt.Printf("%s image %s (%s)\n", verb, name, units.HumanSize(float64(stale.image.Size)))
+			if cleanDryRun {
+				continue
+			}
+			if err := dockerClient.RemoveImage(stale.image.ID); err != nil {
+				fmt.Printf("  skipped: %v\n", err)
+				continue
+			}
+			reclaimed += stale.image.Size
+			removedImages++
+			continue
+		}
+
+		for _, tag := range stale.tags {
+			fmt.Printf("%s tag %s\n", verb, tag)
+			if cleanDryRun {
+				continue
+			}
+			if err := dockerClient.RemoveImageTag(tag); err != nil {
+				fmt.Printf("  skipped: %v\n", err)
+			}
+		}
+	}
+
+	if cleanDryRun {
+		fmt.Println("Dry run: nothing was removed.")
+		return nil
+	}
+
+	output.Successf("Removed %d container(s) and %d image(s), reclaimed %s", removedContainers, removedImages, units.HumanSize(float64(reclaimed)))
+	return nil
+}
+
+// offerDiskCleanup reports Docker's disk usage after a command failed for
+// lack of space and offers to free some, first with 'devdrop clean' and then
+// by pruning dangling images and build cache of any tool
+func offerDiskCleanup() {
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "The Docker host ran out of disk space.")
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return
+	}
+	defer dockerClient.Close()
+
+	if usage, err := dockerClient.DiskUsage(); err == nil {
+		w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TYPE\tTOTAL\tSIZE\tRECLAIMABLE")
+		for _, kind := range usage {
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", kind.Kind, kind.Count, units.HumanSize(float64(kind.Size)), units.HumanSize(float64(kind.Reclaimable)))
+		}
+		w.Flush()
+	}
+	fmt.Fprintln(os.Stderr)
+
+	if clean, err := prompt.Confirm("Remove stopped devdrop containers and unreferenced devdrop images now (devdrop clean)?", false); err == nil && clean {
+		if err := runClean(cleanCmd, nil); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if prune, err := prompt.Confirm("Also remove dangling images and build cache left by any tool (docker image prune, docker builder prune)?", false); err == nil && prune {
+		reclaimed, err := dockerClient.PruneDangling()
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			output.Successf("Reclaimed %s", units.HumanSize(float64(reclaimed)))
+		}
+	}
+
+	fmt.Println("Free up space (e.g. with 'devdrop clean --all' or 'docker system prune') and run the command again.")
+}
+
+// staleContainers returns the stopped devdrop containers to remove. Without
+// --all, containers recorded for commit are kept.
+func staleContainers(dockerClient *docker.Client, cfg *config.Config) ([]docker.ContainerInfo, error) {
+	containers, err := dockerClient.FindContainers("", false)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]bool)
+	if !cleanAll {
+		for _, env := range cfg.Environments {
+			if env.LastContainer != "" {
+				recorded[env.LastContainer] = true
+			}
+			for _, id := range env.PlatformContainers {
+				recorded[id] = true
+			}
+		}
+	}
+
+	var stale []docker.ContainerInfo
+	for _, container := range containers {
+		switch container.State {
+		case "exited", "created", "dead":
+		default:
+			continue
+		}
+		if recorded[container.ID] {
+			continue
+		}
+		stale = append(stale, container)
+	}
+	return stale, nil
+}
+
+// staleImages returns the devdrop images and tags no environment references
+func staleImages(dockerClient *docker.Client, cfg *config.Config) ([]cleanImage, error) {
+	images, err := dockerClient.ListImages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Images in the experimental store are garbage collected by the store
+	stored := make(map[string]bool)
+	if cfg.ExperimentalStore {
+		st, err := openStore()
+		if err != nil {
+			return nil, err
+		}
+		objects, err := st.Objects()
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range objects {
+			stored[obj.Digest] = true
+		}
+	}
+
+	var stale []cleanImage
+	for _, image := range images {
+		if stored[image.ID] {
+			continue
+		}
+
+		if image.Dangling() {
+			if !devdropImage(dockerClient, image) {
+				continue
+			}
+			stale = append(stale, cleanImage{image: image, whole: true})
+			continue
+		}
+
+		var tags []string
+		kept := false
+		for _, ref := range image.RepoTags {
+			repo, tag := splitImageTag(ref)
+			switch {
+			case repo == "devdrop-dry-run":
+				tags = append(tags, ref)
+			case !isDevDropRepository(repo):
+				kept = true
+			case tagReferenced(cfg, repo, tag):
+				kept = true
+			default:
+				tags = append(tags, ref)
+			}
+		}
+		if len(tags) > 0 {
+			stale = append(stale, cleanImage{image: image, tags: tags, whole: !kept})
+		}
+	}
+	return stale, nil
+}
+
+// devdropImage reports whether a dangling image came from a devdrop
+// environment, by the repository it was pulled from or by its commit layer
+func devdropImage(dockerClient *docker.Client, image docker.ImageSummary) bool {
+	for _, digest := range image.RepoDigests {
+		repo, _, _ := strings.Cut(digest, "@")
+		if isDevDropRepository(repo) {
+			return true
+		}
+	}
+	committed, err := dockerClient.CommittedByDevDrop(image.ID)
+	return err == nil && committed
+}
+
+// tagReferenced reports whether a tag of a devdrop repository is still used
+// by a configured environment. With --all only the latest version counts.
+func tagReferenced(cfg *config.Config, repo, tag string) bool {
+	for name, env := range cfg.Environments {
+		if cfg.GetEnvironmentRepository(name) != repo {
+			continue
+		}
+		if tag == "latest" || versionTagMatches(env.LatestVersion, tag) {
+			return true
+		}
+		if cleanAll {
+			return false
+		}
+		for _, version := range env.Versions {
+			if versionTagMatches(version.Tag, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// versionTagMatches reports whether tag is a version or one of its
+// per-platform tags
+func versionTagMatches(version, tag string) bool {
+	return version != "" && (tag == version || strings.HasPrefix(tag, version+"-"))
+}
+
+// isDevDropRepository reports whether an image repository holds a devdrop
+// environment, i.e. its name starts with devdrop-
+func isDevDropRepository(repo string) bool {
+	name := repo[strings.LastIndex(repo, "/")+1:]
+	return strings.HasPrefix(name, "devdrop-") && name != "devdrop-env"
+}
+
+// splitImageTag splits an image reference into repository and tag
+func splitImageTag(ref string) (string, string) {
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return ref, "latest"
+	}
+	return ref[:i], ref[i+1:]
+}
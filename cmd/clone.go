@@ -0,0 +1,158 @@
+// Package cmd provides the clone command for DevDrop.
+//
+// The clone command starts an environment from a colleague's:
+// - Pulls someone else's devdrop image from the registry
+// - Registers it as a new local environment under your own namespace
+// - Leaves pushing it to your registry to the next 'devdrop commit'
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var cloneCmd = &cobra.Command{
+	Use:   "clone <user>/<environment>[:version] [new-name]",
+	Short: "Start an environment from someone else's",
+	Long: `Pull a colleague's environment image and register it as a new environment
+of your own, e.g. to bootstrap from a teammate's setup.
+
+The reference is what 'devdrop share' prints: user/devdrop-name, optionally
+with a registry host, a version tag or a digest. The devdrop- prefix may be
+left out. Without a tag the latest version is cloned.
+
+The environment keeps its name unless you give a new one. It's stored under
+your own namespace: the image is pushed to your registry the first time you
+run 'devdrop commit' for it, and the colleague's environment is never
+changed. Their repository must be public, or readable with your login.
+
+Examples:
+  devdrop clone bob/go                    # bob's devdrop-go as devdrop-go
+  devdrop clone bob/devdrop-go:v3 go-bob  # A specific version, renamed
+  devdrop clone ghcr.io/acme/devdrop-node # From another registry`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runClone,
+}
+
+func init() {
+	rootCmd.AddCommand(cloneCmd)
+}
+
+func runClone(cmd *cobra.Command, args []string) error {
+	source, sourceEnv, err := parseCloneReference(args[0])
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv := sourceEnv
+	if len(args) == 2 {
+		targetEnv = config.EnsureDevDropPrefix(args[1])
+	}
+	if _, exists := cfg.Environments[targetEnv]; exists {
+		return fmt.Errorf("environment '%s' already exists. Give a new name: 'devdrop clone %s <new-name>'", targetEnv, args[0])
+	}
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	if imageName == source {
+		return fmt.Errorf("%s is your own environment. Use 'devdrop pull %s' instead", source, targetEnv)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Public repositories need no login; use ours for the source registry
+	// in case the repository is shared with us privately
+	named, _ := reference.ParseNormalizedNamed(source)
+	authToken := cfg.GetRegistryLogin(reference.Domain(named)).AuthToken
+
+	// With verify_signatures on, pull the digest whose signature checked out
+	verifier, err := registryVerifier(cfg, reference.Domain(named))
+	if err != nil {
+		return err
+	}
+	pullRef := source
+	if verifier != nil {
+		if pullRef, err = verifier.VerifyImage(dockerClient, source, authToken); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Pulling %s...\n", source)
+	if err := dockerClient.PullImage(pullRef, authToken); err != nil {
+		return fmt.Errorf("failed to pull image: %w", err)
+	}
+	if err := dockerClient.TagImage(pullRef, imageName); err != nil {
+		return fmt.Errorf("failed to tag image: %w", err)
+	}
+
+	env := config.Environment{
+		Image:       imageName,
+		BaseImage:   source,
+		Created:     time.Now(),
+		LastUpdated: time.Now(),
+		Registry:    cfg.Registry,
+		Description: "Cloned from " + source,
+	}
+	if lock, err := dockerClient.CaptureTools(imageName); err == nil {
+		env.Tools = lock
+	}
+	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+		return fmt.Errorf("failed to save environment to config: %w", err)
+	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest")
+
+	fmt.Println()
+	output.Successf("Cloned %s as environment '%s'", source, targetEnv)
+	fmt.Printf("Run 'devdrop run %s' to use it, and 'devdrop commit %s' after a session to push it to your registry.\n", targetEnv, targetEnv)
+	return nil
+}
+
+// parseCloneReference normalizes a reference to someone's environment: it
+// adds the devdrop- prefix and the latest tag where they are missing, and
+// returns the reference with the environment name
+func parseCloneReference(ref string) (string, string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid reference '%s': %w", ref, err)
+	}
+
+	repoPath := reference.Path(named)
+	namespace, name := path.Split(repoPath)
+	if namespace == "" || namespace == "library/" {
+		return "", "", fmt.Errorf("invalid reference '%s': expected <user>/<environment>, e.g. bob/devdrop-go", ref)
+	}
+	envName := config.EnsureDevDropPrefix(name)
+
+	normalized := reference.Domain(named) + "/" + namespace + envName
+	switch r := named.(type) {
+	case reference.Canonical:
+		normalized += "@" + r.Digest().String()
+	case reference.Tagged:
+		normalized += ":" + r.Tag()
+	default:
+		normalized += ":latest"
+	}
+
+	// Docker Hub references read better without the host, as elsewhere
+	named, err = reference.ParseNormalizedNamed(normalized)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid reference '%s': %w", ref, err)
+	}
+	return reference.FamiliarString(named), envName, nil
+}
@@ -0,0 +1,251 @@
+// Package cmd provides the code command for DevDrop.
+//
+// The code command opens an environment in VS Code:
+// - Starts a session container in the background, or reuses the running one
+// - Launches VS Code attached to it through the Dev Containers extension
+// - Prints the attach URI instead when VS Code isn't installed or --print is given
+// - Records the container for commit like 'devdrop run' does
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var codeCmd = &cobra.Command{
+	Use:   "code [environment-name]",
+	Short: "Open an environment in VS Code",
+	Long: `Open an environment in VS Code instead of a terminal.
+
+A session container is started in the background with the current
+directory at /workspace (or the environment's workspace_path), the
+environment's ports, mounts, volumes and variables, and your dotfiles, just
+like 'devdrop run'. VS Code is then launched attached to it with the Dev
+Containers extension, opening the workspace. If the environment's last session is still running, VS Code
+attaches to that one instead.
+
+The session keeps running after VS Code is closed. Use 'devdrop attach' for
+a terminal in it and 'devdrop commit' to save changes made there; the
+container keeps running after the commit until you stop it with
+'docker stop'. Hooks and services of 'devdrop run' are not started, and
+the workspace is always bind mounted.
+
+When the code command isn't on PATH, or with --print, the attach URI is
+printed instead, for 'code --folder-uri <uri>' or another editor that
+understands it. Use --editor for e.g. code-insiders.
+
+Examples:
+  devdrop code                      # Open the current environment
+  devdrop code go                   # Open devdrop-go
+  devdrop code -p 3000:3000         # Also publish a port
+  devdrop code --editor code-insiders
+  devdrop code --print              # Only print the attach URI`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runCode,
+}
+
+var (
+	codePorts  []string
+	codeEditor string
+	codePrint  bool
+)
+
+func init() {
+	rootCmd.AddCommand(codeCmd)
+	codeCmd.Flags().StringArrayVarP(&codePorts, "publish", "p", nil, "Publish a container port to the host (e.g. 3000:3000)")
+	codeCmd.Flags().StringVar(&codeEditor, "editor", "code", "VS Code command to launch")
+	codeCmd.Flags().BoolVar(&codePrint, "print", false, "Print the attach URI instead of launching VS Code")
+	codeCmd.Flags().BoolVar(&noDotfiles, "no-dotfiles", false, "Don't install the dotfiles configured with 'devdrop dotfiles'")
+}
+
+func runCode(cmd *cobra.Command, args []string) error {
+	if err := docker.ValidatePorts(codePorts); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	var targetEnv string
+	if len(args) == 0 {
+		if targetEnv, err = defaultEnvironment(cfg); err != nil {
+			return err
+		}
+	} else {
+		targetEnv = config.EnsureDevDropPrefix(args[0])
+	}
+
+	workspace, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containerID := cfg.Environments[targetEnv].LastContainer
+	running := false
+	if containerID != "" {
+		state, err := dockerClient.ContainerState(containerID)
+		running = err == nil && state == "running"
+	}
+	if running {
+		fmt.Printf("Reusing the running session of %s (container %s)\n", targetEnv, shortID(containerID))
+	} else if containerID, err = startCodeSession(dockerClient, cfg, targetEnv, workspace); err != nil {
+		return err
+	}
+
+	if _, exists := cfg.Environments[targetEnv]; exists {
+		if err := cfg.MarkEnvironmentUsed(targetEnv, workspace); err != nil {
+			fmt.Printf("Warning: failed to record environment usage: %v\n", err)
+		}
+	}
+
+	name, _, err := dockerClient.ContainerImage(containerID)
+	if err != nil {
+		return err
+	}
+	folder, err := dockerClient.ContainerWorkspace(containerID)
+	if err != nil {
+		return err
+	}
+	uri := attachedContainerURI(name, folder)
+
+	if dockerClient.IsRemote() {
+		fmt.Printf("Warning: the session runs on %s; VS Code attaches through its own Docker settings, which must point there too.\n", dockerClient.Endpoint())
+	}
+
+	editor, lookErr := exec.LookPath(codeEditor)
+	if codePrint || lookErr != nil {
+		if lookErr != nil && !codePrint {
+			fmt.Printf("'%s' was not found on PATH. Open the session from VS Code with:\n", codeEditor)
+		}
+		fmt.Printf("  code --folder-uri %s\n", uri)
+	} else {
+		fmt.Printf("Launching %s...\n", codeEditor)
+		launch := exec.Command(editor, "--folder-uri", uri)
+		launch.Stdout = os.Stdout
+		launch.Stderr = os.Stderr
+		if err := launch.Run(); err != nil {
+			return fmt.Errorf("failed to launch %s: %w", codeEditor, err)
+		}
+	}
+
+	fmt.Println()
+	output.Successf("Session %s of %s is running for VS Code", shortID(containerID), targetEnv)
+	fmt.Printf("Run 'devdrop attach %s' for a terminal in it and 'devdrop commit %s' to save your changes.\n", targetEnv, targetEnv)
+	return nil
+}
+
+// startCodeSession creates a session container for the workspace like
+// runRun does and starts it in the background
+func startCodeSession(dockerClient *docker.Client, cfg *config.Config, targetEnv, workspace string) (string, error) {
+	env := cfg.Environments[targetEnv]
+
+	var dotenvFiles []string
+	if env.DotEnv {
+		var err error
+		if dotenvFiles, err = workspaceDotenvFiles(); err != nil {
+			return "", err
+		}
+	}
+	vars, err := sessionEnv(env, dotenvFiles, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := validateVolumes(env.Volumes); err != nil {
+		return "", err
+	}
+	if mode, _ := sessionMountMode(env); mode != docker.MountBind {
+		fmt.Printf("Warning: mount mode %s of %s doesn't apply; VS Code sessions bind mount the workspace.\n", mode, targetEnv)
+	}
+	containerWorkspace, _ := sessionWorkspacePath(env)
+	if err := docker.ValidateWorkspacePath(containerWorkspace); err != nil {
+		return "", err
+	}
+	_, ignored, err := workspaceIgnored(workspace)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Using environment: %s\n", targetEnv)
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stdout)
+	if err != nil {
+		return "", err
+	}
+	warnRemoteBinds(dockerClient, workspace, nil, os.Stdout)
+
+	mounts, err := resolveMounts(env.Mounts)
+	if err != nil {
+		return "", err
+	}
+	volumeMounts, err := resolveVolumes(dockerClient, targetEnv, env.Volumes)
+	if err != nil {
+		return "", err
+	}
+	workspaceMounts, err := ignoredMounts(dockerClient, targetEnv, workspace, containerWorkspace, ignored, true)
+	if err != nil {
+		return "", err
+	}
+
+	var envFile string
+	if len(vars) > 0 {
+		if envFile, err = writeSessionEnvFile(vars); err != nil {
+			return "", err
+		}
+		defer os.Remove(envFile)
+	}
+
+	containerID, err := dockerClient.CreateWorkspaceContainer(docker.WorkspaceOptions{
+		ContainerSpec: docker.ContainerSpec{
+			Image:  useImage,
+			Ports:  append(append([]string{}, env.Ports...), codePorts...),
+			Mounts: append(append(mounts, volumeMounts...), workspaceMounts...),
+		},
+		WorkspaceDir:  workspace,
+		WorkspacePath: containerWorkspace,
+		MountMode:     docker.MountBind,
+		Environment:   targetEnv,
+		Version:       sessionVersion(env, useImage),
+		Dotfiles:      sessionDotfiles(cfg),
+		EnvFile:       envFile,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create container: %w", err)
+	}
+	if err := dockerClient.StartContainer(containerID); err != nil {
+		dockerClient.RemoveContainer(containerID)
+		return "", err
+	}
+	fmt.Printf("Started session %s in %s\n", shortID(containerID), workspace)
+
+	if err := cfg.SetEnvironmentContainer(targetEnv, containerID); err != nil {
+		fmt.Printf("Warning: failed to save container ID to config: %v\n", err)
+	}
+	return containerID, nil
+}
+
+// attachedContainerURI returns the VS Code URI opening folder in a running
+// container through the Dev Containers extension
+func attachedContainerURI(containerName, folder string) string {
+	target, _ := json.Marshal(struct {
+		ContainerName string `json:"containerName"`
+	}{"/" + containerName})
+	return "vscode-remote://attached-container+" + hex.EncodeToString(target) + folder
+}
@@ -2,19 +2,31 @@
 //
 // The commit command handles saving container customizations:
 // - Finds the most recent container from devdrop init
+// - Runs the environment's pre_commit hooks, e.g. to strip caches
 // - Commits container changes to a personal Docker image
-// - Pushes the image to DockerHub using stored credentials
+// - Pushes the image to DockerHub using stored credentials, unless --no-push is given or the environment is local-only
 // - Updates configuration with environment metadata
 // - Optionally cleans up the committed container
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
+	"github.com/docker/go-units"
 	"github.com/oysteinje/devdrop/pkg/config"
 	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/oysteinje/devdrop/pkg/scan"
+	"github.com/oysteinje/devdrop/pkg/workflow"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var commitCmd = &cobra.Command{
@@ -27,16 +39,113 @@ This command will:
 1. Use the current environment or the specified environment
 2. Find the most recent container for that environment
 3. Commit all your customizations to a new image
-4. Push the image to DockerHub as username/devdrop-envname:latest
-5. Update your configuration with the new environment
+4. Tag the image with the next version (v1, v2, ...) and as latest
+5. Push both tags to your registry as username/devdrop-envname
+6. Update your configuration with the new version and its tool versions
+
+If the session container was never recorded (for example because its
+terminal was closed) or the recorded one is gone, the newest container
+labelled with the environment is committed instead.
+
+Use --platforms to publish a multi-arch image, so the environment runs
+natively on e.g. both arm64 laptops and amd64 servers. Each platform needs a
+session container: your regular one for the native platform, and one from
+'devdrop run --platform <platform>' for every other. Each variant is pushed
+as <version>-<os>-<arch>, and the version and latest tags become manifest
+lists that pull and run resolve to the right variant automatically.
+
+With signing_key set in the config, every pushed version is signed with
+cosign (multi-arch versions per variant and as a manifest list), so
+teammates with verify_signatures on only run images signed with that key.
+The key is a cosign key file or a KMS URI; cosign must be installed.
+
+Use --scan to scan the new version for known vulnerabilities with Trivy or
+Grype before it is pushed (set scan: true in the commit section of the
+config to always do so). Critical vulnerabilities stop the push: the
+session container is kept, so you can fix them and commit again.
+
+Use --dry-run to see what a commit would publish before doing it: the
+container is committed to a temporary local image, its size, layers and
+labels are reported along with every tag that would be pushed and the
+repository's visibility, along with the containers and registry versions
+a real commit would delete; then the temporary image is removed again.
+Nothing is pushed and the container and configuration are left as they are.
+
+Use -m to say what changed, like a Git commit message: it is stored in
+the image's devdrop.message label and in the environment's history in the
+config, and 'devdrop log' lists the messages of all versions.
+
+Use --author and --comment to record who made a commit and why in the
+image's metadata; the comment defaults to the message. The "commit"
+section of the config sets defaults for them:
+
+  commit:
+    author: Jane Doe <jane@example.com>
+    reproducible: true
+    squash: true
+    pause: false
+    warn_size: 5GB
+
+With --reproducible the image's creation time and history timestamps are
+set to the Unix epoch, so the image metadata doesn't depend on when the
+commit was made. Running containers (e.g. a session still open in another
+terminal) are paused while they are committed so the image is consistent,
+and resumed right after; use --pause=false to keep them running. If
+processes other than shells are still running in them, e.g. a package
+install, you are asked to confirm first. Containers of running sessions are
+kept instead of removed after the commit.
+
+Every session of an environment is its own container, so two terminals
+running 'devdrop run' give two candidates to commit. When there are
+several, you are asked which one to commit, with the session recorded last
+as the default; --container picks one by name or container ID instead.
+'devdrop sessions' lists them, and the others are kept for a later commit.
+
+Before committing, the size of the image is estimated from the base image
+and the changes in the container. Above warn_size in the commit section
+(10GB unless set; 0 turns the check off) you are asked to confirm, with
+hints on clearing caches in a pre_commit hook, so pushing an image of many
+gigabytes doesn't come as a surprise.
+
+Every commit adds a layer on top of the previous version, so files deleted
+in a session still take up space in the layers below. Use --squash to
+flatten the committed image into a single layer, keeping its environment,
+command, labels and ports but not its author. A squashed image no longer
+shares layers with its base image or earlier versions, so pushing it
+uploads it whole; 'devdrop size' shows how much the layers have grown.
+
+Use --no-push to only commit and tag the new version locally, e.g. to
+push it later or while offline. Environments created with 'devdrop init
+--local-only' (or local_only: true in the config) never push at all: their
+images are tagged as devdrop.local/devdrop-<name>, which no registry
+serves, so work images that must not leave the machine stay on it. They
+don't need 'devdrop login'.
+
+The environment's pre_commit hooks run before the container is committed,
+e.g. to strip caches from the image; a failing hook that isn't optional
+stops the commit. Hooks with "in: container" run inside the session
+container, which is started for them if it has stopped. See 'devdrop run
+--help' for how to configure hooks. A dry run lists them without running
+them; --no-hooks skips them.
+
+Previous versions stay available. Use 'devdrop history' to list them and
+'devdrop rollback' to restore one.
 
 Prerequisites:
-- You must have run 'devdrop login' to authenticate
+- You must have run 'devdrop login' to authenticate, unless nothing is pushed
 - You must have a container from 'devdrop init' or 'devdrop run'
 
 Examples:
   devdrop commit              # Commit current environment
   devdrop commit myenv        # Commit devdrop-myenv environment
+  devdrop commit --dry-run    # Show what would be pushed where
+  devdrop commit --no-push    # Commit and tag locally only
+  devdrop commit --container devdrop-myenv-20261016-142530
+  devdrop commit -m "Install rust 1.80"
+  devdrop commit --comment "Add protoc and buf"
+  devdrop commit --reproducible --author "Jane Doe <jane@example.com>"
+  devdrop commit --squash     # Flatten the image, dropping dead layers
+  devdrop commit --platforms linux/arm64,linux/amd64
   devdrop init
   # customize environment, install tools, etc.
   exit
@@ -45,37 +154,59 @@ Examples:
 	RunE: runCommit,
 }
 
+var (
+	commitPlatforms    string
+	commitDryRun       bool
+	commitAuthor       string
+	commitComment      string
+	commitMessage      string
+	commitReproducible bool
+	commitPause        bool
+	commitNoPush       bool
+	commitNoHooks      bool
+	commitSquash       bool
+	commitScan         bool
+	commitContainer    string
+)
+
 func init() {
 	rootCmd.AddCommand(commitCmd)
+	commitCmd.Flags().BoolVar(&commitDryRun, "dry-run", false, "Commit to a temporary image and report what would be pushed, without pushing")
+	commitCmd.Flags().StringVar(&commitPlatforms, "platforms", "", "Commit a multi-arch image from per-platform containers (e.g. linux/amd64,linux/arm64)")
+	commitCmd.Flags().StringVar(&commitAuthor, "author", "", "Author recorded in the image (default from config, or \"DevDrop CLI\")")
+	commitCmd.Flags().StringVarP(&commitMessage, "message", "m", "", "Message describing the changes, shown by 'devdrop log'")
+	commitCmd.Flags().StringVar(&commitComment, "comment", "", "Comment recorded with the commit's layer (default the message)")
+	commitCmd.Flags().BoolVar(&commitReproducible, "reproducible", false, "Zero the timestamps in the image metadata")
+	commitCmd.Flags().BoolVar(&commitPause, "pause", true, "Pause a running container while committing it")
+	commitCmd.Flags().BoolVar(&commitNoPush, "no-push", false, "Commit and tag the new version locally without pushing it")
+	commitCmd.Flags().BoolVar(&commitNoHooks, "no-hooks", false, "Don't run the environment's pre_commit hooks")
+	commitCmd.Flags().BoolVar(&commitSquash, "squash", false, "Flatten the committed image into a single layer")
+	commitCmd.Flags().BoolVar(&commitScan, "scan", false, "Scan the image for vulnerabilities and don't push it with critical ones (default from config)")
+	commitCmd.Flags().StringVar(&commitContainer, "container", "", "Session to commit, by name or container ID, when the environment has several")
 }
 
 func runCommit(cmd *cobra.Command, args []string) error {
+	var platforms []string
+	if commitPlatforms != "" {
+		var err error
+		if platforms, err = docker.ParsePlatforms(commitPlatforms); err != nil {
+			return err
+		}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// Check if user is logged in
-	if cfg.Username == "" {
-		return fmt.Errorf("you must run 'devdrop login' first to authenticate with DockerHub")
-	}
-
-	// Check if we have auth token
-	if cfg.AuthToken == "" {
-		return fmt.Errorf("missing authentication token. Please run 'devdrop login' again")
-	}
-
 	// Determine which environment to commit
 	var targetEnv string
 	if len(args) == 0 {
-		// Use current environment
-		if !cfg.HasEnvironments() {
-			return fmt.Errorf("no environments configured. Run 'devdrop init' to create one")
-		}
-		targetEnv = cfg.GetCurrentEnvironment()
-		if targetEnv == "" {
-			return fmt.Errorf("no current environment set. Run 'devdrop switch' to select one")
+		// Use the environment mapped to this directory, or the current one
+		targetEnv, err = defaultEnvironment(cfg)
+		if err != nil {
+			return err
 		}
 	} else {
 		targetEnv = config.EnsureDevDropPrefix(args[0])
@@ -84,65 +215,636 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	// Check if environment exists
 	env, exists := cfg.Environments[targetEnv]
 	if !exists {
-		return fmt.Errorf("environment '%s' not found. Run 'devdrop ls' to see available environments", targetEnv)
+		return environmentNotFound(targetEnv)
 	}
 
-	// Check if there's a container to commit for this environment
-	containerID := env.LastContainer
-	if containerID == "" {
-		return fmt.Errorf("no container to commit for environment '%s'. Run 'devdrop init' or 'devdrop run' first", targetEnv)
+	push := !commitNoPush && !env.LocalOnly
+	if len(platforms) > 0 && !push {
+		// Manifest lists only exist in a registry
+		return fmt.Errorf("--platforms needs to push a manifest list and can't be used with --no-push or local-only environments")
+	}
+
+	// Check if user is logged in
+	if push && cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	// Check if we have an auth token for the environment's registry
+	authToken := environmentAuthToken(cfg, targetEnv)
+	if authToken == "" && push && !commitDryRun {
+		return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
 	}
 
 	// Create Docker client
-	dockerClient, err := docker.NewClient()
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
 	if err != nil {
 		return fmt.Errorf("failed to connect to Docker: %w", err)
 	}
 	defer dockerClient.Close()
 
-	// Generate environment image name
-	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	// Check if there's a container to commit for this environment
+	containerID, err := sessionContainer(dockerClient, targetEnv, env, commitContainer, "commit")
+	if err != nil {
+		return err
+	}
+	if containerID != "" && containerID != env.LastContainer {
+		fmt.Printf("Using container %s found by its %s label (not recorded in the config)\n", shortID(containerID), docker.LabelEnvironment)
+		env.LastContainer = containerID
+	}
+	if containerID == "" && (len(platforms) == 0 || len(env.PlatformContainers) == 0) {
+		return fmt.Errorf("no container to commit for environment '%s'. Run 'devdrop init' or 'devdrop run' first", targetEnv)
+	}
+
+	opts := commitOptions(cfg, cmd.Flags())
 
+	if commitDryRun {
+		return commitDryRunReport(dockerClient, cfg, targetEnv, env, platforms, authToken, opts)
+	}
+	scanner, err := commitScanner(cfg, cmd.Flags())
+	if err != nil {
+		return err
+	}
+	if len(platforms) > 0 {
+		return commitPlatformVariants(dockerClient, cfg, targetEnv, env, platforms, authToken, opts, scanner)
+	}
+	return commitSession(dockerClient, cfg, targetEnv, env, containerID, authToken, opts, scanner)
+}
+
+// commitSession commits a session container as the environment's next
+// version, pushes it and removes the container unless it is still running
+func commitSession(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment, containerID, authToken string, opts docker.CommitOptions, scanner *scan.Scanner) error {
 	fmt.Printf("Committing environment: %s\n", targetEnv)
 	fmt.Printf("Container: %s\n", containerID[:12])
-	fmt.Printf("Image: %s\n", imageName)
+	if env.LocalOnly {
+		fmt.Println("Registry: none (local-only environment)")
+	} else {
+		fmt.Printf("Registry: %s\n", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+	}
 
-	// Commit container to image
-	if err := dockerClient.CommitContainer(containerID, imageName); err != nil {
-		return fmt.Errorf("failed to commit container: %w", err)
+	running, err := checkRunningSession(dockerClient, containerID, opts)
+	if err != nil {
+		return err
+	}
+	if err := checkCommitSize(dockerClient, cfg, targetEnv, env, containerID); err != nil {
+		return err
+	}
+
+	signer, err := environmentSigner(cfg, targetEnv)
+	if err != nil {
+		return err
+	}
+
+	commit, result := workflow.Commit(workflow.CommitOptions{
+		Client:      dockerClient,
+		Config:      cfg,
+		Environment: targetEnv,
+		Env:         env,
+		ContainerID: containerID,
+		AuthToken:   authToken,
+		Commit:      opts,
+		Running:     running,
+		NoPush:      commitNoPush,
+		Hooks:       commitHooks(dockerClient, targetEnv, containerID),
+		Signer:      signer,
+		Scanner:     scanner,
+	})
+	if err := commit.Run(progressSink()); err != nil {
+		return err
+	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest", result.VersionTag)
+	pushed := "committed and pushed"
+	if env.LocalOnly || commitNoPush {
+		pushed = "committed locally; nothing was pushed"
 	}
+	output.Emit(output.Event{Event: output.EventCommitDone, Environment: targetEnv, Image: result.Image, Container: containerID, Version: result.VersionTag, Message: pushed})
 
-	fmt.Println("Container committed successfully!")
+	fmt.Println()
+	if env.LocalOnly || commitNoPush {
+		output.Successf("Environment '%s' successfully committed locally as %s (%s); nothing was pushed", targetEnv, result.Image, result.VersionTag)
+	} else {
+		output.Successf("Environment '%s' successfully committed and pushed as %s (%s)", targetEnv, result.Image, result.VersionTag)
+	}
+	if !env.LocalOnly && !commitNoPush {
+		autoPruneRemote(cfg, targetEnv)
+	}
+	fmt.Printf("You can now run 'devdrop run %s' to use your customized environment in any project!\n", targetEnv)
+
+	return nil
+}
+
+// commitHooks returns the runner for the pre_commit hooks of a commit, nil
+// when they are skipped with --no-hooks (or 'devdrop run --no-hooks' for
+// commits when the session ends)
+func commitHooks(dockerClient *docker.Client, targetEnv, containerID string) *hooks.Runner {
+	if commitNoHooks || runNoHooks {
+		return nil
+	}
+	return sessionHooks(dockerClient, targetEnv, containerID)
+}
+
+// commitPlatformVariants commits one session container per platform, pushes
+// each as <version>-<os>-<arch> and publishes the version and latest tags as
+// manifest lists of those variants
+func commitPlatformVariants(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment, platforms []string, authToken string, opts docker.CommitOptions, scanner *scan.Scanner) error {
+	containers, err := findPlatformContainers(dockerClient, targetEnv, env, platforms)
+	if err != nil {
+		return err
+	}
+
+	native, err := dockerClient.DaemonPlatform()
+	if err != nil {
+		return err
+	}
+	signer, err := environmentSigner(cfg, targetEnv)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	versionTag := env.NextVersionTag()
+	versionImage := cfg.GetEnvironmentImageRef(targetEnv, versionTag)
+
+	fmt.Printf("Committing environment: %s\n", targetEnv)
+	fmt.Printf("Image: %s (version %s, %s)\n", imageName, versionTag, strings.Join(platforms, ", "))
+
+	localVariant := ""
+	running := make(map[string]bool)
+	for _, platform := range platforms {
+		containerID := containers[platform]
+		variant := cfg.GetEnvironmentImageRef(targetEnv, docker.PlatformTag(versionTag, platform))
+
+		fmt.Printf("Committing %s variant from container %s...\n", platform, shortID(containerID))
+		if running[platform], err = checkRunningSession(dockerClient, containerID, opts); err != nil {
+			return err
+		}
+		if runner := commitHooks(dockerClient, targetEnv, containerID); runner != nil {
+			if err := runner.Run(hooks.PreCommit, env.Hooks.PreCommit); err != nil {
+				return err
+			}
+		}
+		if err := dockerClient.CommitContainer(containerID, variant, opts); err != nil {
+			return fmt.Errorf("failed to commit container: %w", err)
+		}
+
+		if scanner != nil {
+			if err := scanBeforePush(scanner, variant, targetEnv); err != nil {
+				return err
+			}
+		}
+
+		fmt.Printf("Pushing %s...\n", variant)
+		if err := dockerClient.PushImage(variant, authToken); err != nil {
+			return fmt.Errorf("failed to push image: %w", err)
+		}
+		if signer != nil {
+			fmt.Printf("Signing %s...\n", variant)
+			if _, err := signer.SignImage(dockerClient, variant, authToken); err != nil {
+				return err
+			}
+		}
 
-	// Push image to DockerHub
-	fmt.Printf("Pushing image %s to DockerHub...\n", imageName)
-	if err := dockerClient.PushImage(imageName, cfg.AuthToken); err != nil {
-		return fmt.Errorf("failed to push image: %w", err)
+		// Local tags point at the variant this machine runs natively
+		if localVariant == "" || platformMatches(native, platform) {
+			localVariant = variant
+		}
 	}
 
-	fmt.Println("Image pushed successfully!")
+	fmt.Printf("Publishing manifest list for %s and latest...\n", versionTag)
+	if err := pushManifestList(dockerClient, cfg, targetEnv, authToken, versionTag, platforms, versionTag, "latest"); err != nil {
+		return fmt.Errorf("failed to push manifest list: %w", err)
+	}
+	if signer != nil {
+		fmt.Printf("Signing manifest list %s...\n", versionImage)
+		if _, err := signer.SignImage(dockerClient, versionImage, authToken); err != nil {
+			return err
+		}
+	}
+
+	for _, tag := range []string{imageName, versionImage} {
+		if err := dockerClient.TagImage(localVariant, tag); err != nil {
+			return fmt.Errorf("failed to tag version: %w", err)
+		}
+	}
+
+	if lock, err := dockerClient.CaptureTools(localVariant); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		env.Tools = lock
+	}
 
-	// Update environment in configuration
 	env.Image = imageName
 	env.LastUpdated = time.Now()
-	env.LastContainer = "" // Clear since we're cleaning up the container
+	env.Versions = append(env.Versions, config.Version{Tag: versionTag, Created: env.LastUpdated, Platforms: platforms, Message: opts.Message})
+	env.LatestVersion = versionTag
+	lastContainer := env.LastContainer
+	env.LastContainer = ""
+	env.PlatformContainers = nil
+	// Sessions still going on keep their containers for the next commit
+	for _, platform := range platforms {
+		containerID := containers[platform]
+		switch {
+		case !running[platform]:
+		case containerID == lastContainer:
+			env.LastContainer = containerID
+		default:
+			if env.PlatformContainers == nil {
+				env.PlatformContainers = make(map[string]string)
+			}
+			env.PlatformContainers[platform] = containerID
+		}
+	}
 
 	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
 		return fmt.Errorf("failed to update configuration: %w", err)
 	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest", versionTag)
+
+	// Clean up every container that went into the commit
+	for _, platform := range platforms {
+		if running[platform] {
+			fmt.Printf("Container %s keeps running; commit again to save later changes.\n", shortID(containers[platform]))
+			continue
+		}
+		if err := dockerClient.RemoveContainer(containers[platform]); err != nil {
+			fmt.Printf("Warning: failed to remove container: %v\n", err)
+		}
+	}
+
+	output.Emit(output.Event{Event: output.EventCommitDone, Environment: targetEnv, Image: imageName, Version: versionTag, Message: "committed and pushed for " + strings.Join(platforms, ", ")})
+	fmt.Println()
+	output.Successf("Environment '%s' committed and pushed as %s (%s) for %s", targetEnv, imageName, versionTag, strings.Join(platforms, ", "))
+	autoPruneRemote(cfg, targetEnv)
+	return nil
+}
+
+// findPlatformContainers finds the session container for every requested
+// platform among the environment's regular and --platform containers
+func findPlatformContainers(dockerClient *docker.Client, targetEnv string, env config.Environment, platforms []string) (map[string]string, error) {
+	candidates := make(map[string]string)
+	for _, id := range append([]string{env.LastContainer}, platformContainerIDs(env)...) {
+		if id == "" {
+			continue
+		}
+		platform, err := dockerClient.ContainerPlatform(id)
+		if err != nil {
+			fmt.Printf("Warning: skipping container %s: %v\n", shortID(id), err)
+			continue
+		}
+		candidates[id] = platform
+	}
 
-	// Clean up the container
-	fmt.Printf("Cleaning up container %s...\n", containerID[:12])
-	if err := dockerClient.RemoveContainer(containerID); err != nil {
-		// Don't fail the whole operation if cleanup fails
-		fmt.Printf("Warning: failed to remove container: %v\n", err)
+	containers := make(map[string]string)
+	for _, platform := range platforms {
+		for id, containerPlatform := range candidates {
+			if platformMatches(platform, containerPlatform) {
+				containers[platform] = id
+				break
+			}
+		}
+		if containers[platform] == "" {
+			return nil, fmt.Errorf("no container for %s. Run 'devdrop run %s --platform %s', apply the same changes and exit, then commit again", platform, targetEnv, platform)
+		}
+	}
+	return containers, nil
+}
+
+// platformContainerIDs returns the containers run with --platform
+func platformContainerIDs(env config.Environment) []string {
+	var ids []string
+	for _, id := range env.PlatformContainers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// platformMatches reports whether an image platform satisfies a requested
+// one; linux/arm64 matches an image reporting linux/arm64/v8
+func platformMatches(requested, actual string) bool {
+	return actual == requested || strings.HasPrefix(actual, requested+"/")
+}
+
+// dryRunTarget is a container a dry-run commit reports on and the tags
+// its image would get
+type dryRunTarget struct {
+	containerID string
+	platform    string
+	tags        []string
+}
+
+// commitDryRunReport commits the session containers to temporary local
+// images, reports what a real commit would produce and push, and removes
+// the temporary images again
+func commitDryRunReport(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment, platforms []string, authToken string, opts docker.CommitOptions) error {
+	versionTag := env.NextVersionTag()
+	repository := cfg.GetEnvironmentRepository(targetEnv)
+
+	var targets []dryRunTarget
+	if len(platforms) == 0 {
+		targets = append(targets, dryRunTarget{containerID: env.LastContainer, tags: []string{versionTag, "latest"}})
 	} else {
-		fmt.Println("Container cleaned up successfully!")
+		containers, err := findPlatformContainers(dockerClient, targetEnv, env, platforms)
+		if err != nil {
+			return err
+		}
+		for _, platform := range platforms {
+			targets = append(targets, dryRunTarget{
+				containerID: containers[platform],
+				platform:    platform,
+				tags:        []string{docker.PlatformTag(versionTag, platform)},
+			})
+		}
 	}
 
+	fmt.Println("Dry run: nothing will be pushed, and containers and configuration are left unchanged.")
 	fmt.Println()
-	fmt.Printf("✅ Environment '%s' successfully committed and pushed as %s\n", targetEnv, imageName)
-	fmt.Printf("You can now run 'devdrop run %s' to use your customized environment in any project!\n", targetEnv)
+	fmt.Printf("Environment: %s (next version %s)\n", targetEnv, versionTag)
+	if len(env.Hooks.PreCommit) > 0 && !commitNoHooks {
+		fmt.Println("Would run pre_commit hooks first:")
+		for _, hook := range env.Hooks.PreCommit {
+			fmt.Printf("  %s\n", hook)
+		}
+	}
+
+	var pushTags []string
+	for _, target := range targets {
+		fmt.Println()
+		if target.platform != "" {
+			fmt.Printf("Container %s (%s):\n", shortID(target.containerID), target.platform)
+		} else {
+			fmt.Printf("Container %s:\n", shortID(target.containerID))
+		}
+		if err := reportDryRunCommit(dockerClient, target.containerID, opts); err != nil {
+			return err
+		}
+		pushTags = append(pushTags, target.tags...)
+	}
+
+	if env.LocalOnly || commitNoPush {
+		fmt.Println()
+		fmt.Println("Would tag locally, without pushing:")
+		for _, tag := range pushTags {
+			fmt.Printf("  %s:%s\n", repository, tag)
+		}
+		reportDryRunCleanup(dockerClient, cfg, targetEnv, env, targets)
+		return nil
+	}
 
+	host := cfg.GetEnvironmentRegistry(targetEnv)
+	fmt.Println()
+	fmt.Printf("Would push to %s (%s):\n", registryDisplayName(host), repositoryVisibility(cfg, targetEnv))
+	for _, tag := range pushTags {
+		fmt.Printf("  %s:%s\n", repository, tag)
+	}
+	if len(platforms) > 0 {
+		fmt.Printf("Would point %s:%s and %s:latest at a manifest list of %s\n", repository, versionTag, repository, strings.Join(platforms, ", "))
+	}
+	reportDryRunCleanup(dockerClient, cfg, targetEnv, env, targets)
+
+	if authToken == "" {
+		fmt.Println()
+		fmt.Printf("Warning: not logged in to %s; a real commit would fail. Run 'devdrop login' first.\n", registryDisplayName(host))
+	}
 	return nil
 }
+
+// reportDryRunCleanup lists what a commit would delete after committing:
+// the containers of sessions that ended and, with keep_remote_versions,
+// old versions in the registry
+func reportDryRunCleanup(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment, targets []dryRunTarget) {
+	fmt.Println()
+	for _, target := range targets {
+		if state, err := dockerClient.ContainerState(target.containerID); err == nil && (state == "running" || state == "paused") {
+			fmt.Printf("Would keep container %s, its session is still running\n", shortID(target.containerID))
+		} else {
+			fmt.Printf("Would remove container %s\n", shortID(target.containerID))
+		}
+	}
+	if keep := cfg.GetKeepRemoteVersions(targetEnv); keep > 0 && !env.LocalOnly && !commitNoPush {
+		fmt.Printf("Would delete all but the newest %d versions from the registry (keep_remote_versions)\n", keep)
+	}
+}
+
+// checkRunningSession prepares committing a container whose session is
+// still going on, e.g. detached or open in another terminal. Processes other
+// than shells may be halfway through writing files, so they need a
+// confirmation. It reports whether the container is running; running
+// containers must not be removed after the commit.
+func checkRunningSession(dockerClient *docker.Client, containerID string, opts docker.CommitOptions) (bool, error) {
+	state, err := dockerClient.ContainerState(containerID)
+	if err != nil || (state != "running" && state != "paused") {
+		return false, nil
+	}
+
+	fmt.Printf("Container %s is still running.\n", shortID(containerID))
+	busy, err := dockerClient.BusyProcesses(containerID)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	if len(busy) > 0 {
+		fmt.Println("Warning: these processes may be halfway through changing files:")
+		for _, command := range busy {
+			fmt.Printf("  %s\n", command)
+		}
+		ok, err := prompt.Confirm("Commit anyway?", false)
+		if err != nil {
+			return true, err
+		}
+		if !ok {
+			return true, fmt.Errorf("commit cancelled. Let the processes finish or exit the session, then commit again")
+		}
+	}
+
+	if opts.Pause {
+		fmt.Println("Pausing it for the commit; it resumes right after.")
+	} else {
+		fmt.Println("Warning: committing without pausing it; files being written may end up inconsistent in the image.")
+	}
+	return true, nil
+}
+
+// checkCommitSize estimates the size of the image committing a container
+// gives and asks for confirmation when it is above the config's warn_size,
+// so a push of many gigabytes doesn't come as a surprise
+func checkCommitSize(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment, containerID string) error {
+	limit := cfg.GetCommitWarnSize()
+	if limit == 0 {
+		return nil
+	}
+	changes, total, err := dockerClient.ContainerSize(containerID)
+	if err != nil {
+		fmt.Printf("Warning: can't estimate the size of the image: %v\n", err)
+		return nil
+	}
+	if total <= limit {
+		return nil
+	}
+
+	fmt.Printf("Warning: the committed image will be about %s (%s of changes on top of %s), above the warn_size of %s.\n",
+		units.HumanSize(float64(total)), units.HumanSize(float64(changes)), units.HumanSize(float64(total-changes)), units.HumanSize(float64(limit)))
+	if len(env.Hooks.PreCommit) > 0 && !commitNoHooks {
+		fmt.Println("This is before the environment's pre_commit hooks run.")
+	} else {
+		fmt.Println("Package and build caches often take up much of it. A pre_commit hook in the")
+		fmt.Println("environment's config can clear them before every commit, e.g.:")
+		fmt.Println("  hooks:")
+		fmt.Println("    pre_commit:")
+		fmt.Println("      - run: rm -rf /root/.cache/* /var/lib/apt/lists/* /tmp/*")
+		fmt.Println("        in: container")
+		fmt.Println("        optional: true")
+	}
+	fmt.Printf("Run 'devdrop diff %s --summary' to see what changed in the session.\n", targetEnv)
+
+	ok, err := prompt.Confirm("Commit anyway?", false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("commit cancelled. Clean up the session, or raise warn_size in the commit section of the config, and commit again")
+	}
+	return nil
+}
+
+// commitScanner returns the vulnerability scanner for a commit: --scan if
+// it was given, else the scan setting of the config's commit section. It is
+// nil when scanning is off; commands without the commit flags pass nil.
+func commitScanner(cfg *config.Config, flags *pflag.FlagSet) (*scan.Scanner, error) {
+	enabled := cfg.Commit.Scan
+	if flags != nil && flags.Changed("scan") {
+		enabled = commitScan
+	}
+	if !enabled {
+		return nil, nil
+	}
+	return scan.Find(cfg.Scanner)
+}
+
+// scanBeforePush scans a committed platform variant and refuses to push
+// it with critical vulnerabilities
+func scanBeforePush(scanner *scan.Scanner, image, targetEnv string) error {
+	fmt.Printf("Scanning %s with %s...\n", image, scanner.Name)
+	report, err := scanner.Scan(image)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Found %s\n", report.Summary())
+	if critical := len(report.AtLeast(scan.Critical)); critical > 0 {
+		return fmt.Errorf("%d critical vulnerabilities found in %s, so it wasn't pushed. Run 'devdrop scan %s' for details, or commit with --scan=false", critical, image, targetEnv)
+	}
+	return nil
+}
+
+// commitOptions returns the commit settings: flags given to 'devdrop
+// commit' first, then the config's commit defaults. Commands without the
+// commit flags pass nil.
+func commitOptions(cfg *config.Config, flags *pflag.FlagSet) docker.CommitOptions {
+	opts := docker.CommitOptions{
+		Author:       cfg.Commit.Author,
+		Comment:      cfg.Commit.Comment,
+		Reproducible: cfg.Commit.Reproducible,
+		Squash:       cfg.Commit.Squash,
+		Pause:        cfg.Commit.Pause == nil || *cfg.Commit.Pause,
+	}
+
+	if flags == nil {
+		return opts
+	}
+	if flags.Changed("author") {
+		opts.Author = commitAuthor
+	}
+	if flags.Changed("message") {
+		opts.Message = commitMessage
+		if opts.Comment == "" {
+			opts.Comment = commitMessage
+		}
+	}
+	if flags.Changed("comment") {
+		opts.Comment = commitComment
+	}
+	if flags.Changed("reproducible") {
+		opts.Reproducible = commitReproducible
+	}
+	if flags.Changed("pause") {
+		opts.Pause = commitPause
+	}
+	if flags.Changed("squash") {
+		opts.Squash = commitSquash
+	}
+	return opts
+}
+
+// reportDryRunCommit commits a container to a temporary image and prints
+// its size, layers and labels
+func reportDryRunCommit(dockerClient *docker.Client, containerID string, opts docker.CommitOptions) error {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return fmt.Errorf("failed to generate temporary tag: %w", err)
+	}
+	tempImage := "devdrop-dry-run:" + suffix
+
+	if err := dockerClient.CommitContainer(containerID, tempImage, opts); err != nil {
+		return fmt.Errorf("failed to commit container: %w", err)
+	}
+	defer func() {
+		if err := dockerClient.RemoveImageTag(tempImage); err != nil {
+			fmt.Printf("Warning: failed to remove temporary image %s: %v\n", tempImage, err)
+		}
+	}()
+
+	info, err := dockerClient.InspectImage(tempImage)
+	if err != nil {
+		return err
+	}
+
+	size := units.HumanSize(float64(info.Size))
+	if _, baseImage, err := dockerClient.ContainerImage(containerID); err == nil {
+		if base, err := dockerClient.InspectImage(baseImage); err == nil {
+			size += fmt.Sprintf(" (+%s over %s)", units.HumanSize(float64(info.Size-base.Size)), baseImage)
+		}
+	}
+	fmt.Printf("  Size:   %s\n", size)
+	fmt.Printf("  Layers: %d\n", info.Layers)
+
+	if len(info.Labels) == 0 {
+		fmt.Println("  Labels: (none)")
+		return nil
+	}
+	keys := make([]string, 0, len(info.Labels))
+	for key := range info.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Println("  Labels:")
+	for _, key := range keys {
+		fmt.Printf("    %s=%s\n", key, info.Labels[key])
+	}
+	return nil
+}
+
+// repositoryVisibility describes who can pull an environment's repository,
+// as far as the registry lets us tell
+func repositoryVisibility(cfg *config.Config, targetEnv string) string {
+	host := registry.NormalizeHost(cfg.GetEnvironmentRegistry(targetEnv))
+	login := cfg.GetRegistryLogin(host)
+
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil {
+		return "visibility unknown"
+	}
+	backend, err := registry.New(host, login.Type, creds)
+	if err != nil {
+		return "visibility unknown"
+	}
+	checker, ok := backend.(registry.VisibilityChecker)
+	if !ok {
+		return "visibility unknown for this registry"
+	}
+
+	visibility, err := checker.RepositoryVisibility(login.Username, targetEnv)
+	if errors.Is(err, registry.ErrRepositoryNotFound) {
+		return "new or private repository; new repositories get your account's default visibility, usually public"
+	}
+	if err != nil {
+		return "visibility unknown: " + err.Error()
+	}
+	return visibility + " repository"
+}
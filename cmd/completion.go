@@ -0,0 +1,123 @@
+// Package cmd provides the completion command for DevDrop.
+//
+// The completion command generates shell completion scripts:
+// - Supports bash, zsh, fish and PowerShell through cobra's generators
+// - Completes environment names for run, commit, pull, switch and friends from the config
+// - Offers the current environment and favorites first
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate a shell completion script",
+	Long: `Generate a completion script for your shell. Besides commands and flags,
+it completes the names of your environments for commands such as run,
+commit, pull and switch, read from the DevDrop config as you type.
+
+Bash (needs the bash-completion package):
+  source <(devdrop completion bash)                          # Current shell
+  devdrop completion bash > /etc/bash_completion.d/devdrop   # Every shell
+
+Zsh:
+  devdrop completion zsh > "${fpath[1]}/_devdrop"
+  (run 'autoload -U compinit; compinit' in ~/.zshrc if completion isn't enabled yet)
+
+Fish:
+  devdrop completion fish > ~/.config/fish/completions/devdrop.fish
+
+PowerShell:
+  devdrop completion powershell | Out-String | Invoke-Expression
+
+Examples:
+  source <(devdrop completion bash)
+  devdrop completion zsh > ~/.zsh/completions/_devdrop`,
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	DisableFlagsInUseLine: true,
+	RunE:                  runCompletion,
+}
+
+func init() {
+	rootCmd.AddCommand(completionCmd)
+	// Replace cobra's default completion command with the documented one
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	// Commands whose only argument is an environment name
+	for _, c := range []*cobra.Command{
+		runCmd, commitCmd, pullCmd, switchCmd, attachCmd, diffCmd, envCmd,
+		favoriteCmd, historyCmd, shareCmd, exportCmd, exportDockerfileCmd, bootstrapScriptCmd,
+		freezeCmd, verifyToolsCmd, warmStartCmd, warmStopCmd, volumeLsCmd,
+		storeLsCmd, explainRunCmd, inspectCmd, useCmd, codeCmd,
+		sizeCmd, snapshotCmd, snapshotLsCmd, pruneRemoteCmd, scanCmd, rebaseCmd, sessionsCmd, logCmd,
+	} {
+		c.ValidArgsFunction = completeEnvironmentArg
+	}
+	// Commands whose first argument is an environment name
+	for _, c := range []*cobra.Command{execCmd, rollbackCmd, storeCheckoutCmd, volumeRmCmd, forkCmd} {
+		c.ValidArgsFunction = completeFirstEnvironmentArg
+	}
+}
+
+func runCompletion(cmd *cobra.Command, args []string) error {
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(os.Stdout, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(os.Stdout)
+	case "fish":
+		return rootCmd.GenFishCompletion(os.Stdout, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+	}
+	return fmt.Errorf("unsupported shell '%s'. Available options: bash, zsh, fish, powershell", args[0])
+}
+
+// completeEnvironments completes environment names from the config, the
+// current environment and favorites first. Names are offered without the
+// devdrop- prefix, which every command adds, unless the user typed it.
+func completeEnvironments(toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	keepPrefix := strings.HasPrefix(toComplete, "devdrop-")
+	var names []string
+	for _, name := range cfg.OrderForSelection(cfg.EnvironmentNames()) {
+		env := cfg.Environments[name]
+		if !keepPrefix {
+			name = strings.TrimPrefix(name, "devdrop-")
+		}
+		if env.Description != "" {
+			name += "\t" + env.Description
+		}
+		names = append(names, name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+// completeEnvironmentArg completes the environment argument of commands
+// taking at most one
+func completeEnvironmentArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeEnvironments(toComplete)
+}
+
+// completeFirstEnvironmentArg completes the environment argument of commands
+// taking more arguments after it, leaving the rest to the shell
+func completeFirstEnvironmentArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return completeEnvironments(toComplete)
+}
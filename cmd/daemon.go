@@ -0,0 +1,293 @@
+// Package cmd provides the daemon command for DevDrop.
+//
+// The daemon command keeps frequently used environments ready to run:
+// - Pulls newer pushed images of favorite and recently used environments
+// - Optionally keeps a paused session container ready for 'devdrop run'
+// - Repeats on an interval until interrupted, then removes what it prewarmed
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/envfile"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/syncstate"
+	"github.com/spf13/cobra"
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Keep frequently used environments pulled and ready to run",
+	Long: `Run in the foreground and keep the environments you use most ready to
+start: favorites and those run within --recent. Every --interval, images
+pushed from another machine are pulled, so 'devdrop run' doesn't wait for a
+download.
+
+With --prewarm the daemon also creates a session container for the
+directory each environment was last run in, starts it and pauses it. The
+next 'devdrop run' there with the same options unpauses it instead of
+creating and starting a container, which makes it start in under a second.
+A prewarmed container is replaced when the image or options change, and
+sessions that copy the workspace, use services, tools or pre_run hooks in
+the container are never prewarmed. Prewarmed containers that weren't used
+are removed when the daemon stops.
+
+Local-only environments are never pulled, and environments whose Docker
+daemon is remote are skipped.
+
+Examples:
+  devdrop daemon                       # Keep images pulled, check every 10m
+  devdrop daemon --prewarm             # Also keep a paused session ready
+  devdrop daemon --interval 1h --max 3 # Check hourly, at most 3 environments
+  devdrop daemon --once                # Check once and exit, e.g. from cron`,
+	Args: cobra.NoArgs,
+	RunE: runDaemon,
+}
+
+var (
+	daemonInterval time.Duration
+	daemonRecent   time.Duration
+	daemonMax      int
+	daemonPrewarm  bool
+	daemonOnce     bool
+)
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+	daemonCmd.Flags().DurationVar(&daemonInterval, "interval", 10*time.Minute, "How often to check the environments")
+	daemonCmd.Flags().DurationVar(&daemonRecent, "recent", 7*24*time.Hour, "Keep environments run within this long ready, besides favorites")
+	daemonCmd.Flags().IntVar(&daemonMax, "max", 5, "Keep at most this many environments ready")
+	daemonCmd.Flags().BoolVar(&daemonPrewarm, "prewarm", false, "Keep a paused session container ready for 'devdrop run'")
+	daemonCmd.Flags().BoolVar(&daemonOnce, "once", false, "Check once and exit; prewarmed containers are kept")
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	if daemonInterval < time.Minute {
+		return &usageError{err: fmt.Errorf("--interval must be at least 1m, got %s", daemonInterval)}
+	}
+	if daemonMax < 1 {
+		return &usageError{err: fmt.Errorf("--max must be at least 1, got %d", daemonMax)}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !daemonOnce {
+		daemonLogf("Keeping environments ready every %s; press Ctrl-C to stop", daemonInterval)
+	}
+	prewarmed := make(map[string]bool)
+	for {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.Username == "" {
+			return errLoginRequired
+		}
+
+		envNames := daemonEnvironments(cfg, time.Now())
+		if len(envNames) == 0 {
+			daemonLogf("No favorite or recently used environments")
+		}
+		for _, envName := range envNames {
+			if ctx.Err() != nil {
+				break
+			}
+			if daemonKeepReady(cfg, envName) {
+				prewarmed[envName] = true
+			}
+		}
+
+		if daemonOnce {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			removeDaemonPrewarmed(prewarmed)
+			return nil
+		case <-time.After(daemonInterval):
+		}
+	}
+}
+
+// daemonEnvironments picks the environments the daemon keeps ready:
+// favorites and those used within --recent, most relevant first, at most
+// --max of them
+func daemonEnvironments(cfg *config.Config, now time.Time) []string {
+	var names []string
+	for name, env := range cfg.Environments {
+		if env.Favorite || (!env.LastUsed.IsZero() && now.Sub(env.LastUsed) <= daemonRecent) {
+			names = append(names, name)
+		}
+	}
+	names = cfg.OrderForSelection(names)
+	if len(names) > daemonMax {
+		names = names[:daemonMax]
+	}
+	return names
+}
+
+// daemonKeepReady pulls a newer pushed image of an environment and, with
+// --prewarm, prewarms a session for its last workspace. Failures are logged
+// so one environment doesn't stop the others. It reports whether a
+// prewarmed container is ready.
+func daemonKeepReady(cfg *config.Config, envName string) bool {
+	dockerClient, err := newEnvironmentDockerClient(envName)
+	if err != nil {
+		daemonLogf("%s: failed to connect to Docker: %v", envName, err)
+		return false
+	}
+	defer dockerClient.Close()
+	if dockerClient.IsRemote() {
+		return false
+	}
+	// Pull output would interleave with the log lines
+	dockerClient.SetProgressOutput(nil)
+
+	if !cfg.IsLocalOnly(envName) {
+		status := environmentSyncStatus(dockerClient, cfg, envName)
+		switch status.State {
+		case syncstate.RemoteAhead, syncstate.RemoteOnly:
+			daemonLogf("%s: pulling the newer pushed image", envName)
+			if err := pullEnvironmentImage(dockerClient, cfg, envName, cfg.GetEnvironmentImageName(envName), ""); err != nil {
+				daemonLogf("%s: %v", envName, err)
+			} else {
+				recordInStore(dockerClient, cfg, envName, "latest")
+				daemonLogf("%s: image is up to date", envName)
+			}
+		case syncstate.Unknown:
+			daemonLogf("%s: can't check for a newer image: %s", envName, status.Error)
+		}
+	}
+
+	if !daemonPrewarm {
+		return false
+	}
+	// Services give every session its own network
+	workspace := cfg.Environments[envName].LastWorkspace
+	if workspace == "" || len(cfg.Environments[envName].Services) > 0 {
+		return false
+	}
+	if info, err := os.Stat(workspace); err != nil || !info.IsDir() {
+		return false
+	}
+
+	opts, cleanup, err := prewarmOptions(dockerClient, cfg, envName, workspace)
+	if err != nil {
+		daemonLogf("%s: %v", envName, err)
+		return false
+	}
+	defer cleanup()
+	if !docker.Prewarmable(opts) {
+		return false
+	}
+
+	containerID, created, err := dockerClient.PrewarmSession(opts)
+	if err != nil {
+		daemonLogf("%s: %v", envName, err)
+		return false
+	}
+	if created {
+		daemonLogf("%s: prewarmed container %s for %s", envName, shortID(containerID), workspace)
+	}
+	return true
+}
+
+// prewarmOptions builds the options 'devdrop run' without flags would
+// create a session of an environment in workspace with. Run cleanup once
+// the container is created.
+func prewarmOptions(dockerClient *docker.Client, cfg *config.Config, envName, workspace string) (docker.WorkspaceOptions, func(), error) {
+	cleanup := func() {}
+	env := cfg.Environments[envName]
+
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, envName, io.Discard)
+	if err != nil {
+		return docker.WorkspaceOptions{}, cleanup, err
+	}
+
+	workspacePath, _ := sessionWorkspacePath(env)
+	if err := docker.ValidateWorkspacePath(workspacePath); err != nil {
+		return docker.WorkspaceOptions{}, cleanup, err
+	}
+	_, preRunContainer := hooks.Split(env.Hooks.PreRun)
+	opts := docker.WorkspaceOptions{
+		ContainerSpec: docker.ContainerSpec{Image: useImage, Ports: env.Ports},
+		WorkspaceDir:  workspace,
+		WorkspacePath: workspacePath,
+		MountMode:     env.MountMode,
+		Environment:   envName,
+		Version:       sessionVersion(env, useImage),
+		Dotfiles:      sessionDotfiles(cfg),
+		Setup:         sessionHooks(dockerClient, envName, "").Script(hooks.PreRun, preRunContainer),
+	}
+	if !docker.Prewarmable(opts) {
+		return opts, cleanup, nil
+	}
+
+	var dotenvFiles []string
+	if env.DotEnv {
+		dotenvFiles = dotenvFilesIn(workspace)
+	}
+	layers, err := sessionEnvLayers(env, dotenvFiles, nil, nil)
+	if err != nil {
+		return opts, cleanup, err
+	}
+	vars := make(envfile.Vars)
+	for _, layer := range layers {
+		vars.Merge(layer.vars)
+	}
+	if len(vars) > 0 {
+		if opts.EnvFile, err = writeSessionEnvFile(vars); err != nil {
+			return opts, cleanup, err
+		}
+		cleanup = func() { os.Remove(opts.EnvFile) }
+	}
+
+	_, ignored, err := workspaceIgnored(workspace)
+	if err != nil {
+		return opts, cleanup, err
+	}
+	mounts, err := resolveMounts(env.Mounts)
+	if err != nil {
+		return opts, cleanup, err
+	}
+	volumeMounts, err := resolveVolumes(dockerClient, envName, env.Volumes)
+	if err != nil {
+		return opts, cleanup, err
+	}
+	workspaceMounts, err := ignoredMounts(dockerClient, envName, workspace, workspacePath, ignored, true)
+	if err != nil {
+		return opts, cleanup, err
+	}
+	opts.Mounts = append(append(mounts, volumeMounts...), workspaceMounts...)
+	return opts, cleanup, nil
+}
+
+// removeDaemonPrewarmed removes the prewarmed containers nobody claimed
+func removeDaemonPrewarmed(envNames map[string]bool) {
+	for envName := range envNames {
+		dockerClient, err := newEnvironmentDockerClient(envName)
+		if err != nil {
+			continue
+		}
+		if removed, err := dockerClient.RemovePrewarmed(envName); err != nil {
+			daemonLogf("%s: %v", envName, err)
+		} else if removed > 0 {
+			daemonLogf("%s: removed %d prewarmed container(s)", envName, removed)
+		}
+		dockerClient.Close()
+	}
+}
+
+// daemonLogf prints a timestamped line of the daemon's log
+func daemonLogf(format string, args ...interface{}) {
+	fmt.Printf("%s %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,185 @@
+// Package cmd provides the diff command for DevDrop.
+//
+// The diff command shows what a commit would capture:
+// - Lists the paths added, changed and deleted in the last session container
+// - Groups them by top-level directory with --summary
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [environment-name]",
+	Short: "Show filesystem changes in the last session",
+	Long: `Show the paths added (A), changed (C) and deleted (D) in the container of
+an environment's last session, i.e. what 'devdrop commit' would capture.
+
+Files under /workspace and other mounts live on the host and are never
+part of the diff. Use --summary to count changes per top-level directory
+when the full list is too long to read.
+
+Examples:
+  devdrop diff                 # Changes in the current environment's session
+  devdrop diff go --summary    # Changes per top-level directory
+  devdrop diff -o json         # Machine-readable output`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runDiff,
+}
+
+var (
+	diffSummary bool
+	diffOutput  string
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().BoolVar(&diffSummary, "summary", false, "Count changes per top-level directory")
+	diffCmd.Flags().StringVarP(&diffOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// diffChange is a changed path as listed by 'devdrop diff'
+type diffChange struct {
+	Kind string `json:"kind" yaml:"kind"`
+	Path string `json:"path" yaml:"path"`
+}
+
+// diffDirectory counts the changes under a top-level directory
+type diffDirectory struct {
+	Directory string `json:"directory" yaml:"directory"`
+	Added     int    `json:"added" yaml:"added"`
+	Changed   int    `json:"changed" yaml:"changed"`
+	Deleted   int    `json:"deleted" yaml:"deleted"`
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(diffOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containerID, err := sessionContainer(dockerClient, targetEnv, env, "", "diff")
+	if err != nil {
+		return err
+	}
+	if containerID == "" {
+		return fmt.Errorf("no session container for environment '%s'. Run 'devdrop run' first", targetEnv)
+	}
+
+	changes, err := dockerClient.ContainerChanges(containerID)
+	if err != nil {
+		return err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+
+	if diffSummary {
+		return printDiffSummary(targetEnv, containerID, changes)
+	}
+
+	if diffOutput != output.FormatText {
+		listed := make([]diffChange, 0, len(changes))
+		for _, change := range changes {
+			listed = append(listed, diffChange{Kind: change.Kind, Path: change.Path})
+		}
+		return output.Render(os.Stdout, diffOutput, listed)
+	}
+
+	if len(changes) == 0 {
+		fmt.Printf("No changes in %s (container %s).\n", targetEnv, shortID(containerID))
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Printf("%s %s\n", diffMarker(change.Kind), change.Path)
+	}
+	return nil
+}
+
+// printDiffSummary counts changes per top-level directory
+func printDiffSummary(targetEnv, containerID string, changes []docker.Change) error {
+	byDir := make(map[string]*diffDirectory)
+	var dirs []string
+	for _, change := range changes {
+		dir := topLevelDir(change.Path)
+		counts, ok := byDir[dir]
+		if !ok {
+			counts = &diffDirectory{Directory: dir}
+			byDir[dir] = counts
+			dirs = append(dirs, dir)
+		}
+		switch change.Kind {
+		case docker.ChangeAdded:
+			counts.Added++
+		case docker.ChangeDeleted:
+			counts.Deleted++
+		default:
+			counts.Changed++
+		}
+	}
+	sort.Strings(dirs)
+
+	summary := make([]diffDirectory, 0, len(dirs))
+	for _, dir := range dirs {
+		summary = append(summary, *byDir[dir])
+	}
+
+	if diffOutput != output.FormatText {
+		return output.Render(os.Stdout, diffOutput, summary)
+	}
+
+	if len(summary) == 0 {
+		fmt.Printf("No changes in %s (container %s).\n", targetEnv, shortID(containerID))
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DIRECTORY\tADDED\tCHANGED\tDELETED")
+	for _, dir := range summary {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\n", dir.Directory, dir.Added, dir.Changed, dir.Deleted)
+	}
+	return w.Flush()
+}
+
+// topLevelDir returns the first directory of a path, e.g. /usr for
+// /usr/local/bin/go; top-level files count under themselves
+func topLevelDir(path string) string {
+	trimmed := strings.TrimPrefix(path, "/")
+	if i := strings.Index(trimmed, "/"); i >= 0 {
+		trimmed = trimmed[:i]
+	}
+	return "/" + trimmed
+}
+
+// diffMarker returns the letter docker diff uses for a kind of change
+func diffMarker(kind string) string {
+	switch kind {
+	case docker.ChangeAdded:
+		return "A"
+	case docker.ChangeDeleted:
+		return "D"
+	default:
+		return "C"
+	}
+}
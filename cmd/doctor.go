@@ -0,0 +1,391 @@
+// Package cmd provides the doctor command for DevDrop.
+//
+// The doctor command diagnoses the host setup DevDrop depends on and prints
+// actionable remediation steps for anything that looks wrong:
+// - Container runtime connectivity and inotify limits
+// - Config file syntax, permissions and environment settings
+// - Registry credentials, by logging in with them
+// - Orphaned session containers and the space devdrop images take
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/inotify"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Diagnose common problems with your DevDrop setup",
+	Long: `Check the host for common problems that affect DevDrop environments
+and print remediation steps for anything that needs attention.
+
+Checks:
+- container runtime (Docker or Podman) is reachable
+- inotify file-watch limits (used by dev servers, test runners and editors)
+- config file parses, isn't readable by other users and its environments
+  have valid ports, volumes, mount modes, hooks and services
+- registry credentials are accepted, by logging in with them
+- orphaned containers: stopped sessions nothing will commit, and
+  containers of environments no longer in the config
+- disk space used by devdrop images and how much 'devdrop clean' frees
+
+Use --fix to apply fixes that can be made automatically: raising kernel
+limits (requires root), restricting the config file's permissions and
+removing orphaned containers.
+
+Examples:
+  devdrop doctor          # Run all checks
+  sudo devdrop doctor --fix`,
+	RunE: runDoctor,
+}
+
+var doctorFix bool
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().BoolVar(&doctorFix, "fix", false, "Apply automatic fixes where possible")
+}
+
+// doctorResult is the outcome of a single doctor check
+type doctorResult struct {
+	OK          bool
+	Summary     string
+	Remediation string
+}
+
+// doctorHost is what the checks look at, loaded once. cfg is nil when the
+// config doesn't load and dockerClient when the runtime isn't reachable.
+type doctorHost struct {
+	cfg          *config.Config
+	cfgErr       error
+	dockerClient *docker.Client
+	dockerErr    error
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	host := &doctorHost{}
+	host.cfg, host.cfgErr = config.Load()
+	host.dockerClient, host.dockerErr = newDockerClient()
+	if host.dockerClient != nil {
+		defer host.dockerClient.Close()
+	}
+
+	checks := []struct {
+		name string
+		run  func(*doctorHost) doctorResult
+	}{
+		{"container runtime", checkContainerRuntime},
+		{"inotify limits", checkInotifyLimits},
+		{"config file", checkConfigFile},
+		{"registry credentials", checkCredentials},
+		{"orphaned containers", checkOrphanedContainers},
+		{"disk space", checkImageDiskSpace},
+	}
+
+	problems := 0
+	for _, check := range checks {
+		result := check.run(host)
+		if result.OK {
+			fmt.Printf("%s %s: %s\n", output.SuccessMark(), check.name, result.Summary)
+			continue
+		}
+
+		problems++
+		fmt.Printf("%s %s: %s\n", output.WarningMark(), check.name, result.Summary)
+		if result.Remediation != "" {
+			fmt.Println()
+			fmt.Println(result.Remediation)
+			fmt.Println()
+		}
+	}
+
+	fmt.Println()
+	if problems == 0 {
+		fmt.Println("No problems found.")
+	} else {
+		fmt.Printf("%d problem(s) found.\n", problems)
+	}
+
+	return nil
+}
+
+func checkContainerRuntime(host *doctorHost) doctorResult {
+	if host.dockerErr != nil {
+		return doctorResult{
+			Summary: host.dockerErr.Error(),
+			Remediation: `Start Docker, or for rootless Podman enable its API socket:
+  systemctl --user enable --now podman.socket
+DevDrop picks a runtime automatically; set 'runtime: docker' or
+'runtime: podman' in ~/.config/devdrop/config.yaml (or DEVDROP_RUNTIME) to choose one.`,
+		}
+	}
+	return doctorResult{OK: true, Summary: "connected to " + host.dockerClient.Runtime()}
+}
+
+func checkInotifyLimits(_ *doctorHost) doctorResult {
+	limits, err := inotify.ReadHost()
+	if errors.Is(err, inotify.ErrUnsupported) {
+		return doctorResult{
+			OK:      true,
+			Summary: "not a Linux host; use 'devdrop run --tune-inotify' to raise limits inside the Docker VM if watchers fail",
+		}
+	}
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+
+	current := fmt.Sprintf("max_user_watches=%d, max_user_instances=%d", limits.MaxUserWatches, limits.MaxUserInstances)
+	if limits.Sufficient() {
+		return doctorResult{OK: true, Summary: current}
+	}
+
+	if doctorFix {
+		raised := limits.Raised()
+		if err := inotify.ApplyHost(raised); err != nil {
+			return doctorResult{
+				Summary:     fmt.Sprintf("%s (fix failed: %v)", current, err),
+				Remediation: inotify.Advice(limits),
+			}
+		}
+		return doctorResult{
+			OK:      true,
+			Summary: fmt.Sprintf("raised to max_user_watches=%d, max_user_instances=%d", raised.MaxUserWatches, raised.MaxUserInstances),
+		}
+	}
+
+	return doctorResult{
+		Summary:     current + " (too low for file watchers in large projects)",
+		Remediation: inotify.Advice(limits),
+	}
+}
+
+func checkConfigFile(host *doctorHost) doctorResult {
+	path, err := config.GetConfigPath()
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+	if host.cfgErr != nil {
+		return doctorResult{
+			Summary:     host.cfgErr.Error(),
+			Remediation: fmt.Sprintf("Fix the YAML in %s, or move it away to start over with 'devdrop login'.", path),
+		}
+	}
+
+	var problems []string
+	var remediation []string
+	if info, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		if doctorFix {
+			if err := os.Chmod(path, 0600); err != nil {
+				problems = append(problems, fmt.Sprintf("readable by other users (fix failed: %v)", err))
+			}
+		} else {
+			problems = append(problems, fmt.Sprintf("readable by other users (mode %o)", info.Mode().Perm()))
+			remediation = append(remediation, fmt.Sprintf("  chmod 600 %s   # it may hold registry tokens", path))
+		}
+	}
+
+	cfg := host.cfg
+	if current := cfg.CurrentEnvironment; current != "" {
+		if !hasEnvironment(cfg, current) {
+			problems = append(problems, fmt.Sprintf("current environment %s doesn't exist", current))
+			remediation = append(remediation, "  devdrop switch   # select an existing environment")
+		}
+	}
+	patterns := make([]string, 0, len(cfg.Mappings))
+	for pattern := range cfg.Mappings {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if envName := cfg.Mappings[pattern]; !hasEnvironment(cfg, envName) {
+			problems = append(problems, fmt.Sprintf("mapping %s points to missing environment %s", pattern, envName))
+			remediation = append(remediation, fmt.Sprintf("  devdrop map rm %s", pattern))
+		}
+	}
+	for _, name := range cfg.EnvironmentNames() {
+		if err := validateEnvironmentConfig(cfg.Environments[name]); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+			remediation = append(remediation, fmt.Sprintf("  devdrop explain %s   # then fix the environment in %s", name, path))
+		}
+	}
+
+	if len(problems) > 0 {
+		return doctorResult{
+			Summary:     strings.Join(problems, "; "),
+			Remediation: strings.Join(remediation, "\n"),
+		}
+	}
+	return doctorResult{OK: true, Summary: fmt.Sprintf("%s, %d environment(s)", path, len(cfg.Environments))}
+}
+
+// hasEnvironment reports whether an environment is in the config
+func hasEnvironment(cfg *config.Config, envName string) bool {
+	_, exists := cfg.Environments[envName]
+	return exists
+}
+
+// validateEnvironmentConfig checks the settings of an environment that only
+// fail once a session starts
+func validateEnvironmentConfig(env config.Environment) error {
+	if err := docker.ValidatePorts(env.Ports); err != nil {
+		return err
+	}
+	if err := validateVolumes(env.Volumes); err != nil {
+		return err
+	}
+	if env.MountMode != "" {
+		if err := docker.ValidateMountMode(env.MountMode); err != nil {
+			return err
+		}
+	}
+	if err := docker.ValidateWorkspacePath(env.WorkspacePath); err != nil {
+		return err
+	}
+	if err := env.Hooks.Validate(); err != nil {
+		return err
+	}
+	return env.Services.Validate()
+}
+
+func checkCredentials(host *doctorHost) doctorResult {
+	if host.cfg == nil {
+		return doctorResult{OK: true, Summary: "skipped, the config doesn't load"}
+	}
+	if host.cfg.Username == "" {
+		return doctorResult{
+			OK:      true,
+			Summary: "not logged in; run 'devdrop login' to push and pull environments",
+		}
+	}
+	if host.dockerClient == nil {
+		return doctorResult{OK: true, Summary: "skipped, the container runtime isn't reachable"}
+	}
+
+	regHost := registry.NormalizeHost(host.cfg.Registry)
+	login := host.cfg.GetRegistryLogin(regHost)
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil || creds.Password == "" {
+		return doctorResult{
+			Summary:     fmt.Sprintf("no usable credentials stored for %s", registryDisplayName(regHost)),
+			Remediation: "Log in again:\n  devdrop login",
+		}
+	}
+
+	_, err = host.dockerClient.RegistryLogin(context.Background(), types.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Password,
+		ServerAddress: registry.ServerAddress(regHost),
+	})
+	if err != nil {
+		return doctorResult{
+			Summary: fmt.Sprintf("%s rejected the credentials of %s: %v", registryDisplayName(regHost), creds.Username, err),
+			Remediation: `Log in again; accounts with two-factor authentication need a personal
+access token instead of the password:
+  devdrop login`,
+		}
+	}
+	return doctorResult{OK: true, Summary: fmt.Sprintf("logged in to %s as %s", registryDisplayName(regHost), creds.Username)}
+}
+
+func checkOrphanedContainers(host *doctorHost) doctorResult {
+	if host.dockerClient == nil || host.cfg == nil {
+		return doctorResult{OK: true, Summary: "skipped, the container runtime or config isn't available"}
+	}
+
+	stale, err := staleContainers(host.dockerClient, host.cfg)
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+	orphaned := make(map[string]docker.ContainerInfo)
+	for _, container := range stale {
+		orphaned[container.ID] = container
+	}
+	// Containers of removed environments can't be committed even when they
+	// are still running
+	all, err := host.dockerClient.FindContainers("", false)
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+	for _, container := range all {
+		if !hasEnvironment(host.cfg, container.Environment) {
+			orphaned[container.ID] = container
+		}
+	}
+	if len(orphaned) == 0 {
+		return doctorResult{OK: true, Summary: "none"}
+	}
+
+	if doctorFix {
+		removed := 0
+		for id := range orphaned {
+			if err := host.dockerClient.RemoveContainer(id); err != nil {
+				return doctorResult{Summary: fmt.Sprintf("removed %d of %d (fix failed: %v)", removed, len(orphaned), err)}
+			}
+			removed++
+		}
+		return doctorResult{OK: true, Summary: fmt.Sprintf("removed %d container(s)", removed)}
+	}
+
+	return doctorResult{
+		Summary: fmt.Sprintf("%d container(s) that nothing will commit", len(orphaned)),
+		Remediation: `Remove them with:
+  devdrop clean          # stopped sessions
+  devdrop doctor --fix   # also containers of removed environments`,
+	}
+}
+
+func checkImageDiskSpace(host *doctorHost) doctorResult {
+	if host.dockerClient == nil || host.cfg == nil {
+		return doctorResult{OK: true, Summary: "skipped, the container runtime or config isn't available"}
+	}
+
+	images, err := host.dockerClient.ListImages()
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+	var used int64
+	count := 0
+	for _, image := range images {
+		for _, ref := range image.RepoTags {
+			if repo, _ := splitImageTag(ref); isDevDropRepository(repo) {
+				used += image.Size
+				count++
+				break
+			}
+		}
+	}
+
+	stale, err := staleImages(host.dockerClient, host.cfg)
+	if err != nil {
+		return doctorResult{Summary: err.Error()}
+	}
+	var reclaimable int64
+	for _, image := range stale {
+		if image.whole {
+			reclaimable += image.image.Size
+		}
+	}
+
+	summary := fmt.Sprintf("%d devdrop image(s) use %s", count, units.HumanSize(float64(used)))
+	if reclaimable == 0 {
+		return doctorResult{OK: true, Summary: summary}
+	}
+	return doctorResult{
+		Summary:     fmt.Sprintf("%s; %s is unused", summary, units.HumanSize(float64(reclaimable))),
+		Remediation: "Free it with:\n  devdrop clean        # images no environment references\n  devdrop clean --all  # also older versions",
+	}
+}
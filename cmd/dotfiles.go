@@ -0,0 +1,204 @@
+// Package cmd provides the dotfiles command for DevDrop.
+//
+// The dotfiles command configures dotfiles injected into every session:
+// - Sets a Git repository or local directory as the dotfiles source
+// - Shows the source, install script and revision sessions will get
+// - Removes the configuration
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/dotfiles"
+	"github.com/spf13/cobra"
+)
+
+var dotfilesCmd = &cobra.Command{
+	Use:   "dotfiles",
+	Short: "Install your dotfiles into every session",
+	Long: `Configure dotfiles that 'devdrop run' and 'devdrop init' install into the
+home directory of every session before the shell starts, so your shell,
+editor and git settings follow you into every environment.
+
+The source is a Git repository (cloned on the host and updated on every
+run, so git isn't needed inside the environment) or a local directory. It is
+copied to ~/dotfiles in the container. If it has an install script
+(install.sh, bootstrap.sh, setup.sh, ... or the one given with --install),
+the script is run from there; otherwise the files starting with a dot are
+linked into the home directory.
+
+Dotfiles are only reinstalled when they changed since the container last
+installed them. Use --no-dotfiles on run or init to skip them once.
+
+Dotfiles stay out of committed images: before a commit, ~/dotfiles and the
+links are removed and the files they replaced put back. Changes an install
+script makes elsewhere can't be undone and are committed with the session.
+
+Examples:
+  devdrop dotfiles set https://github.com/me/dotfiles    # Use a repository
+  devdrop dotfiles set ~/dotfiles --install setup/all.sh # Local directory, custom script
+  devdrop dotfiles show                                  # What will sessions get?
+  devdrop dotfiles unset                                 # Stop installing dotfiles`,
+}
+
+var dotfilesSetCmd = &cobra.Command{
+	Use:   "set <repository-or-directory>",
+	Short: "Set the dotfiles repository or directory",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDotfilesSet,
+}
+
+var dotfilesShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the configured dotfiles",
+	Args:  cobra.NoArgs,
+	RunE:  runDotfilesShow,
+}
+
+var dotfilesUnsetCmd = &cobra.Command{
+	Use:   "unset",
+	Short: "Stop installing dotfiles into sessions",
+	Args:  cobra.NoArgs,
+	RunE:  runDotfilesUnset,
+}
+
+var (
+	dotfilesRef     string
+	dotfilesInstall string
+	noDotfiles      bool
+)
+
+func init() {
+	rootCmd.AddCommand(dotfilesCmd)
+	dotfilesCmd.AddCommand(dotfilesSetCmd, dotfilesShowCmd, dotfilesUnsetCmd)
+	dotfilesSetCmd.Flags().StringVar(&dotfilesRef, "ref", "", "Branch or tag of the repository (default: its default branch)")
+	dotfilesSetCmd.Flags().StringVar(&dotfilesInstall, "install", "", "Install script relative to the dotfiles root (default: detect install.sh, bootstrap.sh, ...)")
+}
+
+func runDotfilesSet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	source := args[0]
+	if local, err := expandPath(source); err == nil && dotfiles.IsLocal(local) {
+		source = local
+		if dotfilesRef != "" {
+			return fmt.Errorf("--ref only applies to Git repositories")
+		}
+	}
+
+	cfg.Dotfiles = config.Dotfiles{Source: source, Ref: dotfilesRef, Install: dotfilesInstall}
+
+	// Fetch now so a bad URL or ref is reported here rather than on the next run
+	resolved, err := resolveDotfiles(cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.Update(func(c *config.Config) error {
+		c.Dotfiles = cfg.Dotfiles
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Printf("Dotfiles set to %s\n", source)
+	printDotfilesInstall(resolved)
+	return nil
+}
+
+func runDotfilesShow(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Dotfiles.Source == "" {
+		fmt.Println("No dotfiles configured. Set them with 'devdrop dotfiles set <repository-or-directory>'.")
+		return nil
+	}
+
+	fmt.Printf("Source:   %s\n", cfg.Dotfiles.Source)
+	if cfg.Dotfiles.Ref != "" {
+		fmt.Printf("Ref:      %s\n", cfg.Dotfiles.Ref)
+	}
+
+	resolved, err := resolveDotfiles(cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Revision: %s\n", shortID(resolved.Revision))
+	printDotfilesInstall(resolved)
+	return nil
+}
+
+func runDotfilesUnset(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Dotfiles.Source == "" {
+		fmt.Println("No dotfiles configured.")
+		return nil
+	}
+
+	if err := cfg.Update(func(c *config.Config) error {
+		c.Dotfiles = config.Dotfiles{}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	fmt.Println("Dotfiles will no longer be installed into sessions.")
+	return nil
+}
+
+func printDotfilesInstall(resolved *docker.Dotfiles) {
+	if resolved.Install != "" {
+		fmt.Printf("Install:  ~/dotfiles/%s\n", resolved.Install)
+	} else {
+		fmt.Println("Install:  no install script; dotfiles are linked into the home directory")
+	}
+}
+
+// resolveDotfiles fetches the configured dotfiles on the host and returns
+// them ready to mount into a session
+func resolveDotfiles(cfg *config.Config) (*docker.Dotfiles, error) {
+	cacheDir, err := config.GetDotfilesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := dotfiles.Resolve(cfg.Dotfiles.Source, cfg.Dotfiles.Ref, cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if source.Warning != "" {
+		fmt.Printf("Warning: %s\n", source.Warning)
+	}
+
+	install := cfg.Dotfiles.Install
+	if install == "" {
+		install = dotfiles.FindInstallScript(source.Dir)
+	}
+	return &docker.Dotfiles{Dir: source.Dir, Install: install, Revision: source.Revision}, nil
+}
+
+// sessionDotfiles returns the dotfiles to install into a new session, or nil
+// when none are configured, --no-dotfiles was given or they can't be fetched
+func sessionDotfiles(cfg *config.Config) *docker.Dotfiles {
+	if noDotfiles || cfg.Dotfiles.Source == "" {
+		return nil
+	}
+
+	resolved, err := resolveDotfiles(cfg)
+	if err != nil {
+		fmt.Printf("Warning: skipping dotfiles: %v\n", err)
+		return nil
+	}
+	return resolved
+}
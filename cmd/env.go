@@ -0,0 +1,91 @@
+// Package cmd provides the env command for DevDrop.
+//
+// The env command describes an environment as shell variables:
+// - Prints DEVDROP_ENV, the image reference and the registry for an environment
+// - With --export, prints eval-able export statements for shells and direnv
+// - Suggests an .envrc snippet that binds a directory to the environment
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/shell"
+	"github.com/spf13/cobra"
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env [environment-name]",
+	Short: "Print shell variables for an environment",
+	Long: `Print shell variables describing an environment, using the current
+environment if none is specified.
+
+Variables:
+  DEVDROP_ENV       Environment name (e.g. devdrop-myenv)
+  DEVDROP_IMAGE     Image reference of the latest version
+  DEVDROP_REGISTRY  Registry the environment is stored in
+  DEVDROP_VERSION   Latest committed version, if any
+
+Use --export to print export statements that can be evaluated by a shell.
+The output ends with a commented .envrc snippet, so direnv users can bind a
+directory to an environment and have their prompt and tools pick it up.
+
+Examples:
+  devdrop env                          # Show variables for the current environment
+  eval "$(devdrop env myenv --export)" # Load them into the current shell
+  devdrop env myenv --export >> .envrc # Bind this directory with direnv`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runEnv,
+}
+
+var envExport bool
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.Flags().BoolVar(&envExport, "export", false, "Print export statements for eval and direnv")
+}
+
+func runEnv(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	if imageName == "" {
+		return errLoginRequired
+	}
+
+	vars := [][2]string{
+		{"DEVDROP_ENV", targetEnv},
+		{"DEVDROP_IMAGE", imageName},
+		{"DEVDROP_REGISTRY", cfg.GetEnvironmentRegistry(targetEnv)},
+		{"DEVDROP_VERSION", env.LatestVersion},
+	}
+
+	if !envExport {
+		for _, v := range vars {
+			fmt.Printf("%s=%s\n", v[0], v[1])
+		}
+		return nil
+	}
+
+	for _, v := range vars {
+		fmt.Printf("export %s=%s\n", v[0], shell.Quote(v[1]))
+	}
+
+	// Comments keep the output safe to eval while documenting the direnv setup
+	shortName := strings.TrimPrefix(targetEnv, "devdrop-")
+	fmt.Println()
+	fmt.Println("# To bind a directory to this environment with direnv, add to its .envrc:")
+	fmt.Printf("#   eval \"$(devdrop env %s --export)\"\n", shortName)
+	fmt.Println("# then run 'direnv allow'. 'devdrop run \"$DEVDROP_ENV\"' starts the bound environment.")
+
+	return nil
+}
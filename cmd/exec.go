@@ -0,0 +1,192 @@
+// Package cmd provides the exec command for DevDrop.
+//
+// The exec command runs a one-off command in an environment:
+// - Starts a container from the environment image with the current directory mounted
+// - Runs the command non-interactively and streams stdout/stderr
+// - Exits with the command's exit code, making environments usable in scripts and CI
+// - Reuses a warm container for the workspace when there is one
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/envfile"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec <environment-name> -- <command> [args...]",
+	Short: "Run a one-off command in an environment",
+	Long: `Run a single command non-interactively in a development environment,
+with the current directory mounted as /workspace (or the environment's
+workspace_path).
+
+The command's stdout and stderr are streamed as-is and devdrop exits with
+the command's exit code. DevDrop's own status messages go to stderr, so
+stdout can be piped safely. Piped stdin is forwarded to the command.
+
+The container is removed when the command finishes; nothing is saved for
+'devdrop commit'. Variables under "env" in the environment config are set
+for the command.
+
+Use --fresh for CI steps: every invocation gets a pristine, uniquely named
+container that the Docker daemon removes on exit (even if devdrop is
+killed), and the DevDrop config is never written, so parallel invocations
+don't interfere with each other.
+
+Environments with warm: true in the config (or with a warm container
+started by 'devdrop warm start') run commands in an always-running
+container for the current directory instead, which starts them in tens of
+milliseconds. The warm container is started on first use and replaced when
+the environment's image or mounts change; --fresh never uses it.
+
+Examples:
+  devdrop exec go -- go test ./...
+  devdrop exec node -- npm run build
+  devdrop exec --fresh go -- make test  # Stateless, parallel-safe CI step
+  cat data.json | devdrop exec python -- python3 transform.py > out.json`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runExec,
+}
+
+var execFresh bool
+
+func init() {
+	rootCmd.AddCommand(execCmd)
+	execCmd.Flags().BoolVar(&execFresh, "fresh", false, "Use a uniquely named, auto-removed container and leave the config untouched (for CI)")
+	// Everything after the environment name belongs to the command
+	execCmd.Flags().SetInterspersed(false)
+}
+
+func runExec(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv := config.EnsureDevDropPrefix(args[0])
+	command := args[1:]
+
+	workspace, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Keep stdout reserved for the command
+	if !quiet {
+		dockerClient.SetProgressOutput(os.Stderr)
+	}
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	// Fresh runs never write the config, so concurrent CI steps can't race on it
+	if _, exists := cfg.Environments[targetEnv]; exists && !execFresh {
+		if err := cfg.MarkEnvironmentUsed(targetEnv, workspace); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to record environment usage: %v\n", err)
+		}
+	}
+
+	mounts, err := execMounts(dockerClient, cfg, targetEnv, workspace)
+	if err != nil {
+		return err
+	}
+	warnRemoteBinds(dockerClient, workspace, cfg.Environments[targetEnv].Mounts, os.Stderr)
+
+	containerWorkspace, _ := sessionWorkspacePath(cfg.Environments[targetEnv])
+	opts := docker.ExecOptions{
+		ContainerSpec: docker.ContainerSpec{Image: useImage, Mounts: mounts},
+		WorkspaceDir:  workspace,
+		WorkspacePath: containerWorkspace,
+		Cmd:           command,
+		Env:           envfile.Vars(cfg.Environments[targetEnv].Env).List(),
+		Stdout:        os.Stdout,
+		Stderr:        os.Stderr,
+	}
+	if execFresh {
+		name, err := freshContainerName(targetEnv)
+		if err != nil {
+			return err
+		}
+		opts.Name = name
+		opts.AutoRemove = true
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		opts.Stdin = os.Stdin
+	}
+
+	// A warm container runs the command without creating a container
+	var warmID string
+	if !execFresh {
+		warmID, err = execWarmContainer(dockerClient, cfg, targetEnv, useImage, workspace, mounts)
+		if err != nil {
+			return err
+		}
+	}
+
+	var exitCode int
+	if warmID != "" {
+		exitCode, err = dockerClient.ExecInContainer(warmID, opts)
+	} else {
+		exitCode, err = dockerClient.RunCommand(opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &exitCodeError{code: exitCode}
+	}
+
+	return nil
+}
+
+// freshContainerName returns a container name that is unique per invocation
+func freshContainerName(envName string) (string, error) {
+	suffix, err := randomSuffix()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate container name: %w", err)
+	}
+	return fmt.Sprintf("%s-exec-%s", envName, suffix), nil
+}
+
+// execMounts returns the bind mounts and volumes of an environment's
+// configuration, plus the workspace volumes standing in for the paths of
+// the workspace's .devdropignore, as exec and warm containers use them
+func execMounts(dockerClient *docker.Client, cfg *config.Config, targetEnv, workspace string) ([]string, error) {
+	mounts, err := resolveMounts(cfg.Environments[targetEnv].Mounts)
+	if err != nil {
+		return nil, err
+	}
+	volumeMounts, err := resolveVolumes(dockerClient, targetEnv, cfg.Environments[targetEnv].Volumes)
+	if err != nil {
+		return nil, err
+	}
+	_, ignored, err := workspaceIgnored(workspace)
+	if err != nil {
+		return nil, err
+	}
+	containerWorkspace, _ := sessionWorkspacePath(cfg.Environments[targetEnv])
+	workspaceMounts, err := ignoredMounts(dockerClient, targetEnv, workspace, containerWorkspace, ignored, true)
+	if err != nil {
+		return nil, err
+	}
+	return append(append(mounts, volumeMounts...), workspaceMounts...), nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of devdrop, so scripts and CI can tell failures apart. Commands
+// run in an environment with 'devdrop exec' pass their own exit code through
+// instead.
+const (
+	exitFailure = 1
+	// exitUsage is for invalid flags and arguments
+	exitUsage = 2
+	// exitAuthRequired is for commands that need 'devdrop login' first or
+	// whose credentials the registry rejected
+	exitAuthRequired = 3
+	// exitDockerUnavailable is for a Docker daemon or Podman socket that
+	// couldn't be reached
+	exitDockerUnavailable = 4
+	// exitEnvironmentNotFound is for environments missing from the config
+	exitEnvironmentNotFound = 5
+	// exitPullFailed is for images that couldn't be pulled
+	exitPullFailed = 6
+	// exitInterrupted is for Ctrl-C at a prompt, like a shell reports SIGINT
+	exitInterrupted = 130
+)
+
+// errLoginRequired is returned by commands that need a registry login
+var errLoginRequired = errors.New("you must run 'devdrop login' first to authenticate with DockerHub")
+
+// errUsage marks invalid flags and arguments
+var errUsage = errors.New("invalid usage")
+
+// usageError is an invalid flag or argument; it matches errUsage
+type usageError struct {
+	err error
+}
+
+func (e *usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *usageError) Unwrap() error {
+	return e.err
+}
+
+func (e *usageError) Is(target error) bool {
+	return target == errUsage
+}
+
+// environmentNotFound is the error for an environment missing from the
+// config
+func environmentNotFound(name string) error {
+	return fmt.Errorf("%w. Run 'devdrop ls' to see available environments", &config.EnvironmentNotFoundError{Name: name})
+}
+
+// markUsageErrors makes the argument and flag errors of cmd and its
+// subcommands match errUsage, as cobra reports them as plain errors
+func markUsageErrors(cmd *cobra.Command) {
+	cmd.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &usageError{err: err}
+	})
+	if args := cmd.Args; args != nil {
+		cmd.Args = func(c *cobra.Command, a []string) error {
+			if err := args(c, a); err != nil {
+				return &usageError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
+
+// exitCodeFor returns the exit code for an error a command returned
+func exitCodeFor(err error) int {
+	var exitErr *exitCodeError
+	var transferErr *docker.TransferError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, prompt.ErrInterrupted):
+		return exitInterrupted
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, errLoginRequired), errors.Is(err, docker.ErrUnauthorized):
+		return exitAuthRequired
+	case errors.Is(err, docker.ErrDaemonUnavailable):
+		return exitDockerUnavailable
+	case errors.Is(err, config.ErrEnvironmentNotFound):
+		return exitEnvironmentNotFound
+	case errors.As(err, &transferErr) && transferErr.Op == "pull", errors.Is(err, docker.ErrImageNotFound):
+		return exitPullFailed
+	}
+	return exitFailure
+}
@@ -0,0 +1,459 @@
+// Package cmd provides the explain command for DevDrop.
+//
+// The explain command shows the effective settings of a command:
+// - Resolves a run the way 'devdrop run' would, without starting anything
+// - Shows where each setting comes from: defaults, config, project files or flags
+// - Hides environment variable values unless --show-values is given
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/ignore"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/spec"
+	"github.com/spf13/cobra"
+)
+
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Show the effective settings of a command",
+	Long: `Show the settings a command would use and where each one comes from, to
+debug the layers of defaults, environment config, project files and flags.`,
+}
+
+var explainRunCmd = &cobra.Command{
+	Use:   "run [environment-name] [run flags]",
+	Short: "Show the effective settings of 'devdrop run'",
+	Long: `Show what 'devdrop run' would do in the current directory, without pulling
+or starting anything: the environment and image (with digest, platform and
+user), the workspace and how it is mounted, what .devdropignore keeps out,
+ports, mounts, volumes, tools, services, environment variables,
+dotfiles, what happens when the session ends and the hooks that run.
+
+Each setting is followed by its source, e.g. "environment config", ".env",
+"-e" or "default". Later sources override earlier ones. Takes the same flags
+as 'devdrop run'. Variable values are hidden unless --show-values is given.
+
+Examples:
+  devdrop explain run                        # The current environment
+  devdrop explain run go -p 3000:3000        # With extra flags
+  devdrop explain run --dotenv --show-values # Which .env values win?
+  devdrop explain run -o json                # Machine-readable output`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExplainRun,
+}
+
+var (
+	explainShowValues bool
+	explainOutput     string
+)
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.AddCommand(explainRunCmd)
+	addRunFlags(explainRunCmd.Flags())
+	explainRunCmd.Flags().BoolVar(&explainShowValues, "show-values", false, "Show the values of environment variables")
+	explainRunCmd.Flags().StringVarP(&explainOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// explainSetting is a setting and where it comes from
+type explainSetting struct {
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+}
+
+// explainVariable is a session environment variable and where it comes from
+type explainVariable struct {
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+	// Overrides lists the earlier sources whose value this one replaces
+	Overrides []string `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// explainedRun is the effective configuration of a run
+type explainedRun struct {
+	Environment  explainSetting    `json:"environment" yaml:"environment"`
+	Image        explainSetting    `json:"image" yaml:"image"`
+	Digest       string            `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Platform     explainSetting    `json:"platform" yaml:"platform"`
+	User         string            `json:"user,omitempty" yaml:"user,omitempty"`
+	Docker       explainSetting    `json:"docker" yaml:"docker"`
+	Workspace    string            `json:"workspace" yaml:"workspace"`
+	WorkspaceIn  explainSetting    `json:"workspace_in_container" yaml:"workspace_in_container"`
+	ReadOnly     bool              `json:"read_only_workspace,omitempty" yaml:"read_only_workspace,omitempty"`
+	MountMode    explainSetting    `json:"mount_mode" yaml:"mount_mode"`
+	Ignored      []string          `json:"ignored,omitempty" yaml:"ignored,omitempty"`
+	Network      explainSetting    `json:"network" yaml:"network"`
+	Ports        []explainSetting  `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Mounts       []explainSetting  `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+	Volumes      []explainSetting  `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	Tools        []explainSetting  `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Services     []explainSetting  `json:"services,omitempty" yaml:"services,omitempty"`
+	Env          []explainVariable `json:"env,omitempty" yaml:"env,omitempty"`
+	Dotfiles     explainSetting    `json:"dotfiles" yaml:"dotfiles"`
+	TuneInotify  explainSetting    `json:"tune_inotify" yaml:"tune_inotify"`
+	CommitOnExit explainSetting    `json:"commit_on_exit" yaml:"commit_on_exit"`
+	Hooks        []explainSetting  `json:"hooks,omitempty" yaml:"hooks,omitempty"`
+}
+
+func runExplainRun(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(explainOutput); err != nil {
+		return err
+	}
+	if err := docker.ValidatePorts(runPorts); err != nil {
+		return err
+	}
+	if err := validateToolSpecs(runWith); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	explained, err := explainRun(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	if explainOutput != output.FormatText {
+		return output.Render(os.Stdout, explainOutput, explained)
+	}
+	printExplainedRun(explained)
+	return nil
+}
+
+// explainRun resolves a run like runRun does, without side effects
+func explainRun(cfg *config.Config, args []string) (*explainedRun, error) {
+	workspace, err := currentWorkspace()
+	if err != nil {
+		return nil, err
+	}
+
+	explained := &explainedRun{
+		Workspace: workspace,
+		Network:   explainSetting{Value: "bridge", Source: "Docker default"},
+	}
+
+	targetEnv, source, err := explainEnvironment(cfg, args, workspace)
+	if err != nil {
+		return nil, err
+	}
+	explained.Environment = explainSetting{Value: targetEnv, Source: source}
+	env := cfg.Environments[targetEnv]
+
+	explainImage(cfg, targetEnv, env, explained)
+
+	remote, err := explainDocker(cfg, targetEnv, explained)
+	if err != nil {
+		return nil, err
+	}
+
+	mountMode, source := sessionMountMode(env)
+	if err := docker.ValidateMountMode(mountMode); err != nil {
+		return nil, err
+	}
+	if remote && source == "default" {
+		mountMode, source = docker.MountSync, "remote Docker host"
+	}
+	explained.MountMode = explainSetting{Value: mountMode, Source: source}
+	explained.ReadOnly = runReadOnly
+	workspacePath, source := sessionWorkspacePath(env)
+	if err := docker.ValidateWorkspacePath(workspacePath); err != nil {
+		return nil, err
+	}
+	explained.WorkspaceIn = explainSetting{Value: workspacePath, Source: source}
+	_, ignored, err := workspaceIgnored(workspace)
+	if err != nil {
+		return nil, err
+	}
+	explained.Ignored = ignoredNames(ignored)
+
+	for _, port := range env.Ports {
+		explained.Ports = append(explained.Ports, explainSetting{Value: port, Source: "environment config"})
+	}
+	for _, port := range runPorts {
+		explained.Ports = append(explained.Ports, explainSetting{Value: port, Source: "-p"})
+	}
+
+	if err := validateMountTargets(workspacePath, append(append([]string{}, env.Mounts...), runMounts...), append(append([]string{}, env.Volumes...), runVolumes...)); err != nil {
+		return nil, err
+	}
+	for _, mounts := range []struct {
+		list   []string
+		source string
+	}{{env.Mounts, "environment config"}, {runMounts, "--mount"}} {
+		binds, err := resolveMounts(mounts.list)
+		if err != nil {
+			return nil, err
+		}
+		for _, bind := range binds {
+			explained.Mounts = append(explained.Mounts, explainSetting{Value: bind, Source: mounts.source})
+		}
+	}
+
+	for _, volumes := range []struct {
+		list   []string
+		source string
+	}{{env.Volumes, "environment config"}, {runVolumes, "--volume"}} {
+		for _, volume := range volumes.list {
+			name, dst, readOnly, err := spec.ParseVolume(volume)
+			if err != nil {
+				return nil, err
+			}
+			value := docker.EnvironmentVolume(targetEnv, name) + ":" + dst
+			if readOnly {
+				value += ":ro"
+			}
+			explained.Volumes = append(explained.Volumes, explainSetting{Value: value, Source: volumes.source})
+		}
+	}
+
+	for _, tool := range runWith {
+		explained.Tools = append(explained.Tools, explainSetting{Value: tool, Source: "--with"})
+	}
+
+	if err := validateServices(env.Services); err != nil {
+		return nil, fmt.Errorf("invalid services of %s: %w", targetEnv, err)
+	}
+	source = "environment config"
+	if runKeepServices {
+		source = "environment config, kept with --keep-services"
+	}
+	for _, name := range env.Services.Names() {
+		explained.Services = append(explained.Services, explainSetting{Value: fmt.Sprintf("%s (%s)", name, env.Services[name].Image), Source: source})
+	}
+
+	if explained.Env, err = explainEnv(env); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.Dotfiles.Source == "":
+		explained.Dotfiles = explainSetting{Value: "none", Source: "default"}
+	case noDotfiles:
+		explained.Dotfiles = explainSetting{Value: "skipped", Source: "--no-dotfiles"}
+	default:
+		explained.Dotfiles = explainSetting{Value: cfg.Dotfiles.Source, Source: "devdrop dotfiles"}
+	}
+
+	switch {
+	case tuneInotify:
+		explained.TuneInotify = explainSetting{Value: "yes", Source: "--tune-inotify"}
+	case env.TuneInotify:
+		explained.TuneInotify = explainSetting{Value: "yes", Source: "environment config"}
+	default:
+		explained.TuneInotify = explainSetting{Value: "no", Source: "default"}
+	}
+
+	switch {
+	case runEphemeral:
+		explained.CommitOnExit = explainSetting{Value: "never, container removed", Source: "--ephemeral"}
+	case runAutoCommit:
+		explained.CommitOnExit = explainSetting{Value: config.CommitOnExitAlways, Source: "--commit"}
+	case cfg.Commit.OnExit != "":
+		explained.CommitOnExit = explainSetting{Value: cfg.Commit.OnExit, Source: "config (commit.on_exit)"}
+	default:
+		explained.CommitOnExit = explainSetting{Value: config.CommitOnExitAsk, Source: "default"}
+	}
+
+	if err := env.Hooks.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid hooks of %s: %w", targetEnv, err)
+	}
+	source = "environment config"
+	if runNoHooks {
+		source = "skipped with --no-hooks"
+	}
+	for _, event := range []hooks.Event{hooks.PreRun, hooks.PostRun, hooks.PreCommit} {
+		for _, hook := range env.Hooks.For(event) {
+			explained.Hooks = append(explained.Hooks, explainSetting{Value: fmt.Sprintf("%s: %s", event, hook), Source: source})
+		}
+	}
+
+	return explained, nil
+}
+
+// explainEnvironment picks the environment like runRun and says why
+func explainEnvironment(cfg *config.Config, args []string, workspace string) (string, string, error) {
+	if len(args) > 0 {
+		return config.EnsureDevDropPrefix(args[0]), "argument", nil
+	}
+	if pin, envName, ok, err := config.FindPin(workspace); err != nil {
+		return "", "", err
+	} else if ok {
+		return envName, fmt.Sprintf("pinned by %s", pin), nil
+	}
+	if pattern, envName, ok := cfg.MappingFor(workspace); ok {
+		return envName, fmt.Sprintf("directory mapping %s", pattern), nil
+	}
+	targetEnv, err := defaultEnvironment(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	return targetEnv, "current environment", nil
+}
+
+// explainDocker fills in the daemon a run would use and reports whether it
+// is on another machine
+func explainDocker(cfg *config.Config, targetEnv string, explained *explainedRun) (bool, error) {
+	endpoint, err := dockerEndpoint(cfg, targetEnv)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case endpoint == nil:
+		explained.Docker = explainSetting{Value: "local", Source: "default"}
+	case dockerContext != "":
+		explained.Docker = explainSetting{Value: endpoint.String(), Source: "--context"}
+	case cfg.Environments[targetEnv].DockerHost != "":
+		explained.Docker = explainSetting{Value: endpoint.String(), Source: "environment config (docker_host)"}
+	default:
+		explained.Docker = explainSetting{Value: endpoint.String(), Source: "current docker context"}
+	}
+	return endpoint != nil && endpoint.IsRemote(), nil
+}
+
+// explainImage fills in the image a run would start from. Nothing is
+// pulled; without Docker only the image name is known.
+func explainImage(cfg *config.Config, targetEnv string, env config.Environment, explained *explainedRun) {
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	explained.Platform = explainSetting{Value: "native", Source: "default"}
+	if runPlatform != "" {
+		explained.Platform = explainSetting{Value: runPlatform, Source: "--platform"}
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		explained.Image = explainSetting{Value: imageName, Source: "Docker not reachable"}
+		return
+	}
+	defer dockerClient.Close()
+
+	switch {
+	case dockerClient.ImageExists(imageName):
+		explained.Image = explainSetting{Value: imageName, Source: "committed image"}
+	case env.BaseImage != "":
+		explained.Image = explainSetting{Value: env.BaseImage, Source: "base image, not committed yet"}
+	default:
+		explained.Image = explainSetting{Value: imageName, Source: "pulled from the registry on run"}
+		return
+	}
+
+	info, err := dockerClient.InspectImage(explained.Image.Value)
+	if err != nil {
+		return
+	}
+	explained.Digest = info.RepoDigest(explained.Image.Value)
+	if runPlatform == "" {
+		explained.Platform.Value = info.Platform
+	}
+	explained.User = info.User
+	if explained.User == "" {
+		explained.User = "root"
+	}
+}
+
+// explainEnv lists the session's variables with the source that wins
+func explainEnv(env config.Environment) ([]explainVariable, error) {
+	var dotenvFiles []string
+	if runDotEnv || env.DotEnv {
+		var err error
+		if dotenvFiles, err = workspaceDotenvFiles(); err != nil {
+			return nil, err
+		}
+	}
+
+	layers, err := sessionEnvLayers(env, dotenvFiles, runEnvFiles, runEnvVars)
+	if err != nil {
+		return nil, err
+	}
+
+	index := make(map[string]int)
+	var vars []explainVariable
+	for _, layer := range layers {
+		for _, key := range layer.vars.Keys() {
+			value := layer.vars[key]
+			if !explainShowValues {
+				value = "(hidden)"
+			}
+			if i, exists := index[key]; exists {
+				vars[i].Overrides = append(vars[i].Overrides, vars[i].Source)
+				vars[i].Value = value
+				vars[i].Source = layer.source
+				continue
+			}
+			index[key] = len(vars)
+			vars = append(vars, explainVariable{Name: key, Value: value, Source: layer.source})
+		}
+	}
+	return vars, nil
+}
+
+func printExplainedRun(explained *explainedRun) {
+	printSetting := func(label string, setting explainSetting) {
+		fmt.Printf("%-15s %s (%s)\n", label+":", setting.Value, setting.Source)
+	}
+	printList := func(label string, settings []explainSetting) {
+		if len(settings) == 0 {
+			fmt.Printf("%-15s none\n", label+":")
+			return
+		}
+		fmt.Printf("%s:\n", label)
+		for _, setting := range settings {
+			fmt.Printf("  %s (%s)\n", setting.Value, setting.Source)
+		}
+	}
+
+	printSetting("Environment", explained.Environment)
+	printSetting("Image", explained.Image)
+	if explained.Digest != "" {
+		fmt.Printf("%-15s %s\n", "Digest:", explained.Digest)
+	}
+	printSetting("Platform", explained.Platform)
+	if explained.User != "" {
+		fmt.Printf("%-15s %s (image)\n", "User:", explained.User)
+	}
+	printSetting("Docker", explained.Docker)
+	if explained.ReadOnly {
+		fmt.Printf("%-15s %s -> %s (%s; read-only, --read-only-workspace)\n", "Workspace:", explained.Workspace, explained.WorkspaceIn.Value, explained.WorkspaceIn.Source)
+	} else {
+		fmt.Printf("%-15s %s -> %s (%s)\n", "Workspace:", explained.Workspace, explained.WorkspaceIn.Value, explained.WorkspaceIn.Source)
+	}
+	printSetting("Mount mode", explained.MountMode)
+	if len(explained.Ignored) > 0 {
+		fmt.Printf("%-15s %s (%s)\n", "Ignored:", strings.Join(explained.Ignored, ", "), ignore.FileName)
+	}
+	printSetting("Network", explained.Network)
+	printList("Ports", explained.Ports)
+	printList("Mounts", explained.Mounts)
+	printList("Volumes", explained.Volumes)
+	printList("Tools", explained.Tools)
+	printList("Services", explained.Services)
+
+	if len(explained.Env) == 0 {
+		fmt.Printf("%-15s none\n", "Variables:")
+	} else {
+		fmt.Println("Variables:")
+		for _, v := range explained.Env {
+			source := v.Source
+			if len(v.Overrides) > 0 {
+				source += ", overrides " + strings.Join(v.Overrides, ", ")
+			}
+			fmt.Printf("  %s=%s (%s)\n", v.Name, v.Value, source)
+		}
+	}
+
+	printSetting("Dotfiles", explained.Dotfiles)
+	printSetting("Tune inotify", explained.TuneInotify)
+	printSetting("Commit on exit", explained.CommitOnExit)
+	printList("Hooks", explained.Hooks)
+}
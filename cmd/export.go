@@ -0,0 +1,157 @@
+// Package cmd provides the export command for DevDrop.
+//
+// The export command packs an environment into a single file:
+// - Saves the environment's images with docker save
+// - Bundles them with the environment's config
+// - Lets 'devdrop import' restore it on a machine without registry access
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/internal/version"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/export"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export [environment-name]",
+	Short: "Export an environment to a tarball for offline transfer",
+	Long: `Write an environment to a tarball that 'devdrop import' restores on another
+machine, without a registry in between (e.g. into an air-gapped network).
+
+The archive holds the environment's images in docker save format and its
+config: description, base image, versions, tool locks, ports and mounts.
+Machine-specific state (session containers, usage) and the variables under
+"env", which may hold secrets, are left out.
+
+The latest version is exported by default; --all-versions adds every
+version in the environment's history that is available locally. Archive
+names ending in .gz or .tgz are compressed.
+
+Examples:
+  devdrop export go -o go.tar
+  devdrop export go -o go.tar.gz --all-versions
+  devdrop import go.tar          # On the other machine`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExport,
+}
+
+var (
+	exportOutput      string
+	exportAllVersions bool
+)
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Archive path (default: <environment>.tar)")
+	exportCmd.Flags().BoolVar(&exportAllVersions, "all-versions", false, "Also export older versions available locally")
+}
+
+func runExport(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	path := exportOutput
+	if path == "" {
+		path = targetEnv + ".tar"
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	tags := []string{"latest"}
+	if env.LatestVersion != "" {
+		tags = append(tags, env.LatestVersion)
+	}
+	if exportAllVersions {
+		for _, v := range env.Versions {
+			if v.Tag != env.LatestVersion {
+				tags = append(tags, v.Tag)
+			}
+		}
+	}
+
+	images := make(map[string]string)
+	var refs []string
+	for _, tag := range tags {
+		ref := cfg.GetEnvironmentImageRef(targetEnv, tag)
+		if !dockerClient.ImageExists(ref) {
+			if tag == "latest" {
+				return fmt.Errorf("%s is not available locally. Run 'devdrop pull %s' first", ref, targetEnv)
+			}
+			fmt.Printf("Warning: skipping %s, it is not available locally\n", ref)
+			continue
+		}
+		images[tag] = ref
+		refs = append(refs, ref)
+	}
+
+	fmt.Printf("Saving %s...\n", targetEnv)
+	imagesFile, err := saveImageToTemp(dockerClient, refs...)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(imagesFile)
+
+	// Leave out what only makes sense on this machine, and possible secrets
+	exported := env
+	exported.LastContainer = ""
+	exported.PlatformContainers = nil
+	exported.LastUsed = time.Time{}
+	exported.Favorite = false
+	exported.Registry = ""
+	exported.Env = nil
+
+	metadata := export.Metadata{
+		Environment:    targetEnv,
+		Exported:       time.Now().UTC(),
+		DevDropVersion: version.GetVersion(),
+		Images:         images,
+		Config:         exported,
+	}
+
+	tmp := path + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	if err := export.Write(file, metadata, imagesFile, export.Compressed(path)); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	output.Successf("Exported %s (%d tag(s)) to %s (%s)", targetEnv, len(refs), path, units.HumanSize(float64(size)))
+	fmt.Printf("Run 'devdrop import %s' on the other machine to restore it.\n", path)
+	return nil
+}
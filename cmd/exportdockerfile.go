@@ -0,0 +1,92 @@
+// Package cmd provides the export-dockerfile command for DevDrop.
+//
+// The export-dockerfile command makes committed environments reviewable:
+// - Reads the history of the environment image
+// - Collapses the base image layers into a FROM line
+// - Emits RUN and metadata instructions for the remaining layers
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var exportDockerfileCmd = &cobra.Command{
+	Use:   "export-dockerfile [environment-name]",
+	Short: "Reconstruct a Dockerfile from an environment's image history",
+	Long: `Reconstruct a best-effort Dockerfile for an environment from its image
+history, so you can review it and reproduce it declaratively.
+
+The result starts FROM the environment's base image followed by the
+instructions recorded in the image history. Changes made interactively
+and saved with 'devdrop commit' can't be turned back into instructions;
+they appear as comments marking where each session was committed.
+
+Examples:
+  devdrop export-dockerfile                   # Current environment to stdout
+  devdrop export-dockerfile myenv -o Dockerfile`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runExportDockerfile,
+}
+
+var exportDockerfileOutput string
+
+func init() {
+	rootCmd.AddCommand(exportDockerfileCmd)
+	exportDockerfileCmd.Flags().StringVarP(&exportDockerfileOutput, "output", "o", "", "Write the Dockerfile to a file instead of stdout")
+}
+
+func runExportDockerfile(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Keep stdout clean for the Dockerfile
+	if !quiet {
+		dockerClient.SetProgressOutput(os.Stderr)
+	}
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if useImage == env.BaseImage {
+		fmt.Fprintf(os.Stderr, "Environment '%s' has not been committed yet.\n", targetEnv)
+	}
+
+	dockerfile, err := dockerClient.ReconstructDockerfile(useImage, env.BaseImage)
+	if err != nil {
+		return err
+	}
+
+	if exportDockerfileOutput == "" {
+		fmt.Print(dockerfile)
+		return nil
+	}
+
+	if err := os.WriteFile(exportDockerfileOutput, []byte(dockerfile), 0644); err != nil {
+		return fmt.Errorf("failed to write Dockerfile: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Dockerfile written to %s\n", exportDockerfileOutput)
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Package cmd provides the favorite command for DevDrop.
+//
+// The favorite command marks environments as favorites so they are listed
+// first in interactive prompts and can be filtered with 'devdrop ls --favorites'.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var favoriteCmd = &cobra.Command{
+	Use:   "favorite <environment-name>",
+	Short: "Mark an environment as a favorite",
+	Long: `Mark an environment as a favorite. Favorites are listed first when
+selecting an environment interactively (switch, pull) and can be
+listed on their own with 'devdrop ls --favorites'.
+
+Examples:
+  devdrop favorite myenv             # Favorite devdrop-myenv
+  devdrop favorite myenv --remove    # Remove devdrop-myenv from favorites`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFavorite,
+}
+
+var favoriteRemove bool
+
+func init() {
+	rootCmd.AddCommand(favoriteCmd)
+	favoriteCmd.Flags().BoolVar(&favoriteRemove, "remove", false, "Remove the environment from favorites")
+}
+
+func runFavorite(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv := config.EnsureDevDropPrefix(args[0])
+	if _, exists := cfg.Environments[targetEnv]; !exists {
+		return environmentNotFound(targetEnv)
+	}
+
+	if err := cfg.SetFavorite(targetEnv, !favoriteRemove); err != nil {
+		return fmt.Errorf("failed to update favorites: %w", err)
+	}
+
+	if favoriteRemove {
+		fmt.Printf("Removed %s from favorites\n", targetEnv)
+	} else {
+		fmt.Printf("Added %s to favorites\n", targetEnv)
+	}
+	return nil
+}
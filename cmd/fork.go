@@ -0,0 +1,103 @@
+// Package cmd provides the fork command for DevDrop.
+//
+// The fork command branches an environment into a new one:
+// - Tags the source environment's image under the new name
+// - Copies its settings (ports, mounts, env, hooks, services, ...)
+// - Makes the new environment the current one
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var forkCmd = &cobra.Command{
+	Use:   "fork <source-environment> <new-environment>",
+	Short: "Create a new environment from a copy of an existing one",
+	Long: `Create a new environment from a copy of an existing one, e.g. to branch a
+"base" environment into project-specific variants.
+
+The source's committed image is tagged under the new name, pulling it
+first if it isn't present, and its settings are copied: base image, ports,
+mounts, volumes, variables, hooks, services and so on. The version history
+isn't; the fork gets its own versions from its first 'devdrop commit',
+which also pushes it. Changes of running sessions of the source that
+weren't committed aren't included.
+
+The new environment is stored in the same registry and namespace as the
+source, and becomes the current environment.
+
+Examples:
+  devdrop fork go go-api           # devdrop-go into devdrop-go-api
+  devdrop fork devdrop-base devdrop-web`,
+	Args: cobra.ExactArgs(2),
+	RunE: runFork,
+}
+
+func init() {
+	rootCmd.AddCommand(forkCmd)
+}
+
+func runFork(cmd *cobra.Command, args []string) error {
+	sourceEnv := config.EnsureDevDropPrefix(args[0])
+	targetEnv := config.EnsureDevDropPrefix(args[1])
+	if sourceEnv == targetEnv {
+		return &usageError{err: fmt.Errorf("the new environment needs a name other than '%s'", sourceEnv)}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if _, exists := cfg.Environments[sourceEnv]; !exists {
+		return fmt.Errorf("environment '%s' not found. Run 'devdrop ls' to see available environments", sourceEnv)
+	}
+	if _, exists := cfg.Environments[targetEnv]; exists {
+		return fmt.Errorf("environment '%s' already exists", targetEnv)
+	}
+
+	sourceImage := cfg.GetEnvironmentImageName(sourceEnv)
+	if sourceImage == "" {
+		return errLoginRequired
+	}
+	// The fork shares the registry and namespace of the source, so only
+	// the repository name differs
+	imageName := strings.TrimSuffix(sourceImage, sourceEnv+":latest") + targetEnv + ":latest"
+
+	dockerClient, err := newEnvironmentDockerClient(sourceEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, sourceEnv, os.Stdout)
+	if err != nil {
+		return err
+	}
+	// Environments that were never committed have no image of their own to
+	// tag; the fork starts from the same base image
+	if useImage == sourceImage {
+		if err := dockerClient.TagImage(sourceImage, imageName); err != nil {
+			return fmt.Errorf("failed to tag image: %w", err)
+		}
+	}
+
+	if err := cfg.ForkEnvironment(sourceEnv, targetEnv, imageName); err != nil {
+		return fmt.Errorf("failed to save environment to config: %w", err)
+	}
+	if useImage == sourceImage {
+		recordInStore(dockerClient, cfg, targetEnv, "latest")
+	}
+
+	fmt.Println()
+	output.Successf("Forked %s as '%s'", sourceEnv, targetEnv)
+	fmt.Printf("'%s' is now the current environment.\n", targetEnv)
+	fmt.Printf("Run 'devdrop run' to use it, and 'devdrop commit' after a session to save and push it.\n")
+	return nil
+}
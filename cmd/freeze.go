@@ -0,0 +1,386 @@
+// Package cmd provides the freeze command for DevDrop.
+//
+// The freeze command archives an environment version for the long term:
+// - Bundles the exact image with its SBOM, provenance, changelog and run defaults
+// - Signs the archive's manifest with a local ed25519 key
+// - Verifies archives and optionally loads the image back into Docker
+package cmd
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/internal/version"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/freeze"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var freezeCmd = &cobra.Command{
+	Use:   "freeze [environment-name]",
+	Short: "Archive an environment version with its SBOM and provenance",
+	Long: `Write a signed, self-contained archive of an environment version, so the
+exact build environment can be verified and restored years later, without
+the registry.
+
+The archive holds:
+  image.tar         the image itself, by digest (docker save format)
+  sbom.spdx.json    installed OS packages and tool versions (SPDX 2.3)
+  provenance.json   image ID, registry digests, base image, platform, dates
+  Dockerfile        best-effort reconstruction from the image history
+  CHANGELOG         the environment's versions up to this one
+  run.json          ports, mounts and other defaults 'devdrop run' uses
+
+A manifest with the sha256 of every file is signed with your freeze key
+(~/.config/devdrop/keys/freeze_ed25519, created on first use). Share the public key
+(freeze_ed25519.pub) with whoever needs to verify your archives.
+
+Examples:
+  devdrop freeze                         # Latest version of the current environment
+  devdrop freeze go --version v3 -o go-v3.tar.gz
+  devdrop freeze verify go-v3.tar.gz --key alice.pub   # Check integrity and signer
+  devdrop freeze verify go-v3.tar.gz --load            # ...and load the image`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runFreeze,
+}
+
+var freezeVerifyCmd = &cobra.Command{
+	Use:   "verify <archive>",
+	Short: "Verify a freeze archive and optionally load its image",
+	Long: `Verify that every file in a freeze archive matches its signed manifest.
+Without --key the archive only has to be signed consistently; with --key it
+must be signed by that public key. With --load the verified image is loaded
+into Docker under its original name.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFreezeVerify,
+}
+
+var (
+	freezeVersion string
+	freezeOutput  string
+	freezeKey     string
+	freezeLoad    bool
+)
+
+func init() {
+	rootCmd.AddCommand(freezeCmd)
+	freezeCmd.AddCommand(freezeVerifyCmd)
+	freezeCmd.Flags().StringVar(&freezeVersion, "version", "", "Version to archive (default: the latest version)")
+	freezeCmd.Flags().StringVarP(&freezeOutput, "output", "o", "", "Archive path (default: <environment>-<version>.freeze.tar.gz)")
+	freezeVerifyCmd.Flags().StringVar(&freezeKey, "key", "", "Require the archive to be signed by this public key")
+	freezeVerifyCmd.Flags().BoolVar(&freezeLoad, "load", false, "Load the image into Docker after verifying")
+}
+
+// freezeProvenance is written as provenance.json
+type freezeProvenance struct {
+	Environment    string    `json:"environment"`
+	Version        string    `json:"version"`
+	Image          string    `json:"image"`
+	ImageID        string    `json:"image_id"`
+	RepoDigests    []string  `json:"repo_digests,omitempty"`
+	Platform       string    `json:"platform,omitempty"`
+	Platforms      []string  `json:"platforms,omitempty"`
+	BaseImage      string    `json:"base_image,omitempty"`
+	VersionCreated time.Time `json:"version_created,omitempty"`
+	Layers         int       `json:"layers"`
+	Size           int64     `json:"size"`
+	PackageManager string    `json:"package_manager,omitempty"`
+	FrozenAt       time.Time `json:"frozen_at"`
+	FrozenWith     string    `json:"frozen_with"`
+	Runtime        string    `json:"runtime"`
+}
+
+// freezeRunDefaults is written as run.json
+type freezeRunDefaults struct {
+	Image       string   `json:"image"`
+	Shell       string   `json:"shell"`
+	WorkingDir  string   `json:"working_dir"`
+	Ports       []string `json:"ports,omitempty"`
+	Mounts      []string `json:"mounts,omitempty"`
+	Volumes     []string `json:"volumes,omitempty"`
+	TuneInotify bool     `json:"tune_inotify,omitempty"`
+}
+
+func runFreeze(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	tag := freezeVersion
+	if tag == "" {
+		tag = env.LatestVersion
+	}
+	if tag == "" {
+		return fmt.Errorf("environment '%s' has no committed versions. Run 'devdrop commit %s' first", targetEnv, targetEnv)
+	}
+	versionIndex := -1
+	for i, v := range env.Versions {
+		if v.Tag == tag {
+			versionIndex = i
+		}
+	}
+	if versionIndex < 0 {
+		return fmt.Errorf("version '%s' not found. Run 'devdrop history %s' to see versions", tag, targetEnv)
+	}
+	ver := env.Versions[versionIndex]
+
+	keysDir, err := config.GetKeysDir()
+	if err != nil {
+		return err
+	}
+	key, err := freeze.LoadOrCreateKey(keysDir)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	imageName := cfg.GetEnvironmentImageRef(targetEnv, tag)
+	if !dockerClient.ImageExists(imageName) {
+		if cfg.IsLocalOnly(targetEnv) {
+			return fmt.Errorf("%s is not available on this machine, and local-only environments can't be pulled", imageName)
+		}
+		fmt.Printf("Pulling %s...\n", imageName)
+		if err := pullEnvironmentImage(dockerClient, cfg, targetEnv, imageName, ""); err != nil {
+			return err
+		}
+	}
+
+	info, err := dockerClient.InspectImage(imageName)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	creator := "devdrop-" + version.GetVersion()
+
+	fmt.Println("Collecting installed packages and tools...")
+	manager, packages, err := dockerClient.ListPackages(imageName)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	lock, err := dockerClient.CaptureTools(imageName)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		lock = env.Tools
+	}
+	sbom, err := freeze.SBOM(fmt.Sprintf("%s:%s", targetEnv, tag), info.ID, creator, now, manager, packages, lock)
+	if err != nil {
+		return err
+	}
+
+	dockerfile, err := dockerClient.ReconstructDockerfile(imageName, env.BaseImage)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		dockerfile = "# The image history could not be read\n"
+	}
+
+	platform, _ := dockerClient.ImagePlatform(imageName)
+	provenance, err := json.MarshalIndent(freezeProvenance{
+		Environment:    targetEnv,
+		Version:        tag,
+		Image:          imageName,
+		ImageID:        info.ID,
+		RepoDigests:    info.RepoDigests,
+		Platform:       platform,
+		Platforms:      ver.Platforms,
+		BaseImage:      env.BaseImage,
+		VersionCreated: ver.Created,
+		Layers:         info.Layers,
+		Size:           info.Size,
+		PackageManager: manager,
+		FrozenAt:       now,
+		FrozenWith:     creator,
+		Runtime:        dockerClient.Runtime(),
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode provenance: %w", err)
+	}
+
+	runDefaults, err := json.MarshalIndent(freezeRunDefaults{
+		Image:       imageName,
+		Shell:       "/bin/bash",
+		WorkingDir:  "/workspace",
+		Ports:       env.Ports,
+		Mounts:      env.Mounts,
+		Volumes:     env.Volumes,
+		TuneInotify: env.TuneInotify,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run defaults: %w", err)
+	}
+
+	var changelog strings.Builder
+	fmt.Fprintf(&changelog, "%s\n\n", targetEnv)
+	for i := versionIndex; i >= 0; i-- {
+		v := env.Versions[i]
+		fmt.Fprintf(&changelog, "%s  %s\n", v.Tag, v.Created.UTC().Format(time.RFC3339))
+	}
+
+	// docker save needs to finish before its size is known for the archive
+	fmt.Printf("Saving image %s (%s)...\n", imageName, units.HumanSize(float64(info.Size)))
+	imageFile, err := saveImageToTemp(dockerClient, imageName)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(imageFile)
+
+	outputPath := freezeOutput
+	if outputPath == "" {
+		outputPath = fmt.Sprintf("%s-%s.freeze.tar.gz", targetEnv, tag)
+	}
+	manifest, err := writeFreezeArchive(outputPath, key, freeze.Manifest{
+		Environment: targetEnv,
+		Version:     tag,
+		Image:       imageName,
+		ImageID:     info.ID,
+		RepoDigests: info.RepoDigests,
+		Created:     now,
+	}, imageFile, map[string][]byte{
+		"sbom.spdx.json":  sbom,
+		"provenance.json": provenance,
+		"Dockerfile":      []byte(dockerfile),
+		"CHANGELOG":       []byte(changelog.String()),
+		"run.json":        runDefaults,
+	})
+	if err != nil {
+		return err
+	}
+
+	output.Successf("Froze %s:%s to %s", targetEnv, tag, outputPath)
+	fmt.Printf("Image:  %s\n", manifest.ImageID)
+	fmt.Printf("Signer: %s\n", freeze.Fingerprint(key.Public().(ed25519.PublicKey)))
+	fmt.Printf("Verify with 'devdrop freeze verify %s --key %s'\n", outputPath, filepath.Join(keysDir, "freeze_ed25519.pub"))
+	return nil
+}
+
+// writeFreezeArchive writes the archive next to its final path and renames
+// it into place once it is complete
+func writeFreezeArchive(path string, key ed25519.PrivateKey, manifest freeze.Manifest, imageFile string, documents map[string][]byte) (freeze.Manifest, error) {
+	tmp := path + ".partial"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return freeze.Manifest{}, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(tmp)
+	defer file.Close()
+
+	writer := freeze.NewWriter(file, manifest)
+	if err := writer.AddFile(freeze.ImageName, imageFile); err != nil {
+		return freeze.Manifest{}, err
+	}
+	for _, name := range []string{"sbom.spdx.json", "provenance.json", "Dockerfile", "CHANGELOG", "run.json"} {
+		if err := writer.AddBytes(name, documents[name]); err != nil {
+			return freeze.Manifest{}, err
+		}
+	}
+	written, err := writer.Close(key)
+	if err != nil {
+		return freeze.Manifest{}, err
+	}
+
+	if err := file.Close(); err != nil {
+		return freeze.Manifest{}, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return freeze.Manifest{}, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return written, nil
+}
+
+func runFreezeVerify(cmd *cobra.Command, args []string) error {
+	path := args[0]
+
+	var trusted ed25519.PublicKey
+	if freezeKey != "" {
+		keyPath, err := expandPath(freezeKey)
+		if err != nil {
+			return fmt.Errorf("failed to resolve key path: %w", err)
+		}
+		if trusted, err = freeze.LoadPublicKey(keyPath); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	fmt.Printf("Verifying %s...\n", path)
+	manifest, err := freeze.Verify(file, trusted)
+	if errors.Is(err, freeze.ErrUntrustedSigner) {
+		return fmt.Errorf("%w: signed by %s, not by %s", err, signerFingerprint(manifest), freezeKey)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Environment: %s\n", manifest.Environment)
+	fmt.Printf("Version:     %s\n", manifest.Version)
+	fmt.Printf("Image:       %s (%s)\n", manifest.Image, manifest.ImageID)
+	fmt.Printf("Frozen:      %s\n", output.TimestampWithAge(manifest.Created))
+	fmt.Printf("Signer:      %s\n", signerFingerprint(manifest))
+	if trusted == nil {
+		fmt.Println("Note: the signer was not checked; pass --key to require a trusted key.")
+	}
+	output.Successf("All %d files match the signed manifest", len(manifest.Files))
+
+	if !freezeLoad {
+		return nil
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to reread archive: %w", err)
+	}
+	fmt.Printf("Loading %s...\n", manifest.Image)
+	if err := freeze.ExtractFile(file, freeze.ImageName, dockerClient.LoadImage); err != nil {
+		return err
+	}
+
+	info, err := dockerClient.InspectImage(manifest.Image)
+	if err != nil {
+		return err
+	}
+	if info.ID != manifest.ImageID {
+		return fmt.Errorf("loaded image %s has ID %s, expected %s", manifest.Image, info.ID, manifest.ImageID)
+	}
+	output.Successf("Loaded %s", manifest.Image)
+	return nil
+}
+
+// signerFingerprint returns the fingerprint of the key that signed a manifest
+func signerFingerprint(manifest freeze.Manifest) string {
+	key, err := base64.StdEncoding.DecodeString(manifest.Signer)
+	if err != nil {
+		return "invalid key"
+	}
+	return freeze.Fingerprint(key)
+}
@@ -0,0 +1,193 @@
+// Package cmd provides the grep command for DevDrop.
+//
+// The grep command searches environment images without starting them:
+// - Matches file paths against a regular expression
+// - Optionally searches the contents of small text files
+// - Searches one, several or all local environments
+package cmd
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var grepCmd = &cobra.Command{
+	Use:   "grep [environment-name...] <pattern>",
+	Short: "Search file names and contents in environment images",
+	Long: `Search the filesystem of environment images for paths matching a regular
+expression, without starting a session. Nothing in the image is run.
+
+With --content, the contents of regular text files up to --max-size are
+searched as well and matching lines are printed. Binary files are skipped.
+
+Search several environments by naming them all, or every local environment
+with --all. Use -l to only print the environments that have a match, which
+answers "which environment has that tool or config?" quickly.
+
+Examples:
+  devdrop grep go 'bin/golangci-lint$'      # Is golangci-lint installed?
+  devdrop grep --all -l '\.terraformrc$'    # Which environments have one?
+  devdrop grep node --content -i 'registry\.npmjs'  # Also search file contents
+  devdrop grep go node 'python3'            # Search two environments`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runGrep,
+}
+
+var (
+	grepAll        bool
+	grepContent    bool
+	grepIgnoreCase bool
+	grepListOnly   bool
+	grepMaxSize    string
+)
+
+func init() {
+	rootCmd.AddCommand(grepCmd)
+	grepCmd.Flags().BoolVar(&grepAll, "all", false, "Search all local environments")
+	grepCmd.Flags().BoolVar(&grepContent, "content", false, "Also search the contents of small text files")
+	grepCmd.Flags().BoolVarP(&grepIgnoreCase, "ignore-case", "i", false, "Match case-insensitively")
+	grepCmd.Flags().BoolVarP(&grepListOnly, "list", "l", false, "Only print the names of environments with a match")
+	grepCmd.Flags().StringVar(&grepMaxSize, "max-size", "1MB", "Largest file whose contents are searched with --content")
+}
+
+func runGrep(cmd *cobra.Command, args []string) error {
+	expr := args[len(args)-1]
+	if grepIgnoreCase {
+		expr = "(?i)" + expr
+	}
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	maxSize, err := units.FromHumanSize(grepMaxSize)
+	if err != nil {
+		return fmt.Errorf("invalid --max-size: %w", err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var envNames []string
+	switch {
+	case grepAll:
+		if len(args) > 1 {
+			return fmt.Errorf("--all searches every environment; pass only the pattern")
+		}
+		envNames = cfg.SortedEnvironmentNames(config.SortByName)
+		if len(envNames) == 0 {
+			return fmt.Errorf("no environments configured. Run 'devdrop init' to create one")
+		}
+	case len(args) == 1:
+		targetEnv, err := defaultEnvironment(cfg)
+		if err != nil {
+			return err
+		}
+		envNames = []string{targetEnv}
+	default:
+		for _, name := range args[:len(args)-1] {
+			envNames = append(envNames, config.EnsureDevDropPrefix(name))
+		}
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Keep stdout for matches so results can be piped
+	if !quiet {
+		dockerClient.SetProgressOutput(os.Stderr)
+	}
+
+	found := false
+	for _, envName := range envNames {
+		image, err := resolveEnvironmentImage(dockerClient, cfg, envName, io.Discard)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", envName, err)
+			continue
+		}
+
+		matched, err := grepImage(dockerClient, envName, image, pattern, maxSize)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to search %s: %v\n", envName, err)
+			continue
+		}
+		found = found || matched
+	}
+
+	// Like grep, exit with status 1 when nothing matched
+	if !found {
+		cmd.SilenceErrors = true
+		cmd.SilenceUsage = true
+		return &exitCodeError{code: 1}
+	}
+	return nil
+}
+
+// grepImage prints the matches in one image and reports whether there were any
+func grepImage(dockerClient *docker.Client, envName, image string, pattern *regexp.Regexp, maxSize int64) (bool, error) {
+	matched := false
+	err := dockerClient.WalkImageFiles(image, func(header *tar.Header, content io.Reader) error {
+		if pattern.MatchString(header.Name) {
+			matched = true
+			if grepListOnly {
+				return docker.ErrStopWalk
+			}
+			fmt.Printf("%s: %s\n", envName, header.Name)
+			return nil
+		}
+
+		if !grepContent || header.Typeflag != tar.TypeReg || header.Size > maxSize {
+			return nil
+		}
+
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+		if isBinary(data) {
+			return nil
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), int(maxSize)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if !pattern.Match(scanner.Bytes()) {
+				continue
+			}
+			matched = true
+			if grepListOnly {
+				return docker.ErrStopWalk
+			}
+			fmt.Printf("%s: %s:%d: %s\n", envName, header.Name, line, scanner.Text())
+		}
+		return nil
+	})
+
+	if matched && grepListOnly {
+		fmt.Println(envName)
+	}
+	return matched, err
+}
+
+// isBinary uses the same heuristic as grep: a NUL byte near the start
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
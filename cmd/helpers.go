@@ -0,0 +1,969 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/ignore"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/oysteinje/devdrop/pkg/signing"
+	"github.com/oysteinje/devdrop/pkg/spec"
+	"github.com/oysteinje/devdrop/pkg/store"
+	"github.com/oysteinje/devdrop/pkg/syncstate"
+	"github.com/oysteinje/devdrop/pkg/workflow"
+)
+
+// newDockerClient connects to the configured container runtime (Docker or
+// Podman), or the daemon of --context or the current docker context, and
+// applies the global output flags
+func newDockerClient() (*docker.Client, error) {
+	return newEnvironmentDockerClient("")
+}
+
+// newEnvironmentDockerClient connects like newDockerClient, but to the
+// daemon set as docker_host of an environment unless --context is given
+func newEnvironmentDockerClient(envName string) (*docker.Client, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	endpoint, err := dockerEndpoint(cfg, envName)
+	if err != nil {
+		return nil, err
+	}
+
+	var dockerClient *docker.Client
+	if endpoint != nil {
+		dockerClient, err = docker.NewClientForEndpoint(*endpoint)
+	} else {
+		var runtime docker.Runtime
+		if runtime, err = docker.SelectRuntime(cfg.GetRuntime()); err != nil {
+			return nil, err
+		}
+		dockerClient, err = docker.NewClientForRuntime(runtime)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if quiet {
+		dockerClient.SetProgressOutput(nil)
+	}
+	dockerClient.SetPlainProgress(output.Plain)
+	if output.JSONProgress() {
+		dockerClient.SetProgressEvents(emitTransferEvent)
+	}
+	dockerClient.SetTransferAttempts(cfg.TransferAttempts)
+	return dockerClient, nil
+}
+
+// emitTransferEvent writes the progress of a pull, push or build as a JSON
+// event for --progress json
+func emitTransferEvent(e docker.ProgressEvent) {
+	output.Emit(output.Event{
+		Event: output.EventTransfer,
+		Image: e.Image,
+		Transfer: &output.TransferInfo{
+			Op:      e.Op,
+			Layer:   e.Layer,
+			Status:  e.Status,
+			Current: e.Current,
+			Size:    e.Total,
+		},
+	})
+}
+
+// progressSink renders workflow events for the terminal: a numbered line
+// per step with its details indented below it
+func progressSink() workflow.Sink {
+	if output.JSONProgress() {
+		return workflow.SinkFunc(func(e workflow.Event) {
+			output.Emit(output.Event{
+				Event:    string(e.Kind),
+				Time:     e.Time,
+				Workflow: e.Workflow,
+				Step:     e.Step,
+				Index:    e.Index,
+				Total:    e.Total,
+				Message:  e.Message,
+				Error:    e.Error,
+			})
+		})
+	}
+	return workflow.SinkFunc(func(e workflow.Event) {
+		switch e.Kind {
+		case workflow.StepStarted:
+			fmt.Printf("[%d/%d] %s\n", e.Index, e.Total, e.Step)
+		case workflow.StepSkipped:
+			fmt.Printf("[%d/%d] %s: skipped, %s\n", e.Index, e.Total, e.Step, e.Message)
+		case workflow.Info:
+			fmt.Printf("  %s\n", e.Message)
+		case workflow.Warning:
+			fmt.Printf("  Warning: %s\n", e.Message)
+		}
+	})
+}
+
+// dockerEndpoint returns the daemon to use instead of the runtime's default:
+// the --context one, the environment's docker_host, or the docker context
+// selected with 'docker context use' unless DOCKER_HOST is set or the
+// runtime is Podman. It returns nil when there is none.
+func dockerEndpoint(cfg *config.Config, envName string) (*docker.Endpoint, error) {
+	name := dockerContext
+	if name == "" && envName != "" {
+		if host := cfg.Environments[envName].DockerHost; host != "" {
+			if !strings.Contains(host, "://") {
+				name = host
+			} else {
+				endpoint, err := docker.ParseHost(host)
+				if err != nil {
+					return nil, fmt.Errorf("invalid docker_host of %s: %w", envName, err)
+				}
+				return &endpoint, nil
+			}
+		}
+	}
+	if name == "" && os.Getenv("DOCKER_HOST") == "" && cfg.GetRuntime() != docker.RuntimePodman {
+		name = docker.CurrentContext()
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	endpoint, err := docker.LoadContext(name)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
+
+// listRemoteEnvironments lists the devdrop-* repositories the user owns in
+// the default registry. Listings answered from the cache because of a rate
+// limit come with a *registry.StaleError.
+func listRemoteEnvironments(cfg *config.Config) ([]string, error) {
+	host := registry.NormalizeHost(cfg.Registry)
+	login := cfg.GetRegistryLogin(host)
+
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil {
+		return nil, err
+	}
+
+	backend, err := registry.New(host, login.Type, creds)
+	if err != nil {
+		return nil, err
+	}
+	if caching, ok := backend.(registry.CachingBackend); ok {
+		if dir, err := config.GetRegistryCacheDir(); err == nil {
+			caching.SetCache(registry.NewCache(dir, cfg.GetRegistryCacheTTL()))
+		}
+	}
+
+	return backend.ListDevDropRepositories(login.Username)
+}
+
+// pushManifestList points tags of an environment at a manifest list of the
+// platform variants of version, which must already be pushed as
+// <version>-<os>-<arch>
+func pushManifestList(dockerClient *docker.Client, cfg *config.Config, targetEnv, authToken, version string, platforms []string, tags ...string) error {
+	var entries []registry.ManifestEntry
+	for _, platform := range platforms {
+		ref := cfg.GetEnvironmentImageRef(targetEnv, docker.PlatformTag(version, platform))
+		manifest, err := dockerClient.RemoteManifest(ref, authToken)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, registry.ManifestEntry{
+			MediaType: manifest.MediaType,
+			Digest:    manifest.Digest,
+			Size:      manifest.Size,
+			Platform:  platform,
+		})
+	}
+
+	creds, err := registry.DecodeAuth(authToken)
+	if err != nil {
+		return err
+	}
+
+	host := cfg.GetEnvironmentRegistry(targetEnv)
+	repository := cfg.GetRegistryLogin(host).Username + "/" + targetEnv
+	for _, tag := range tags {
+		if err := registry.PushManifestList(host, creds, repository, tag, entries); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remotePrefetch lists the remote environments in the background, so
+// commands can show local information without waiting for the registry
+type remotePrefetch struct {
+	done  chan struct{}
+	names []string
+	err   error
+}
+
+// prefetchRemoteEnvironments starts listing remote environments
+func prefetchRemoteEnvironments(cfg *config.Config) *remotePrefetch {
+	p := &remotePrefetch{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.names, p.err = listRemoteEnvironments(cfg)
+	}()
+	return p
+}
+
+// Wait blocks until the remote environments are listed, see
+// listRemoteEnvironments
+func (p *remotePrefetch) Wait() ([]string, error) {
+	<-p.done
+	return p.names, p.err
+}
+
+// syncStatus is how the local image of an environment relates to the one
+// pushed to its registry
+type syncStatus struct {
+	State        syncstate.State `json:"state" yaml:"state"`
+	LocalDigest  string          `json:"local_digest,omitempty" yaml:"local_digest,omitempty"`
+	RemoteDigest string          `json:"remote_digest,omitempty" yaml:"remote_digest,omitempty"`
+	// Error explains why the state is unknown
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// environmentSyncStatus compares the local latest image of an environment
+// with the latest tag in its registry. A nil dockerClient means Docker
+// couldn't be reached.
+func environmentSyncStatus(dockerClient *docker.Client, cfg *config.Config, envName string) syncStatus {
+	imageName := cfg.GetEnvironmentImageName(envName)
+	if imageName == "" {
+		return syncStatus{State: syncstate.Unknown, Error: "not logged in to the environment's registry"}
+	}
+	if dockerClient == nil {
+		return syncStatus{State: syncstate.Unknown, Error: "Docker is not reachable"}
+	}
+
+	var status syncStatus
+	var local *syncstate.Image
+	platform := ""
+	if dockerClient.ImageExists(imageName) {
+		info, err := dockerClient.InspectImage(imageName)
+		if err != nil {
+			return syncStatus{State: syncstate.Unknown, Error: err.Error()}
+		}
+		local = &syncstate.Image{Digests: info.DigestsIn(imageName), Layers: info.DiffIDs}
+		status.LocalDigest = info.RepoDigest(imageName)
+		platform = info.Platform
+	} else if platform, _ = dockerClient.DaemonPlatform(); platform == "" {
+		platform = "linux/amd64"
+	}
+
+	// Local-only environments are never pushed, so there is nothing to ask
+	// the registry about
+	if cfg.IsLocalOnly(envName) {
+		status.State = syncstate.Compare(local, nil)
+		return status
+	}
+
+	host := cfg.GetEnvironmentRegistry(envName)
+	login := cfg.GetRegistryLogin(host)
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil {
+		return syncStatus{State: syncstate.Unknown, Error: err.Error()}
+	}
+	var remote *syncstate.Image
+	pushed, err := registry.InspectImage(host, creds, login.Username+"/"+envName, "latest", platform)
+	if err != nil && !errors.Is(err, registry.ErrImageNotFound) {
+		status.State = syncstate.Unknown
+		status.Error = err.Error()
+		return status
+	}
+	if err == nil {
+		remote = &syncstate.Image{Digests: []string{pushed.Digest}, Layers: pushed.DiffIDs}
+		status.RemoteDigest = pushed.Digest
+	}
+
+	status.State = syncstate.Compare(local, remote)
+	return status
+}
+
+// environmentSyncStatuses checks the sync state of several environments
+// concurrently
+func environmentSyncStatuses(dockerClient *docker.Client, cfg *config.Config, envNames []string) map[string]syncStatus {
+	statuses := make(map[string]syncStatus, len(envNames))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, 4)
+	for _, name := range envNames {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			status := environmentSyncStatus(dockerClient, cfg, name)
+			<-limit
+			mu.Lock()
+			statuses[name] = status
+			mu.Unlock()
+		}(name)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// describeSync renders a sync status for text output
+func describeSync(cfg *config.Config, envName string, status syncStatus) string {
+	if status.Error != "" {
+		return fmt.Sprintf("%s (%s)", status.State, status.Error)
+	}
+	if hint := syncHint(cfg, envName, status.State); hint != "" {
+		return fmt.Sprintf("%s, %s", status.State, hint)
+	}
+	return string(status.State)
+}
+
+// syncHint suggests how to bring an environment in sync
+func syncHint(cfg *config.Config, envName string, state syncstate.State) string {
+	switch state {
+	case syncstate.LocalAhead:
+		return fmt.Sprintf("push it with 'docker push %s'", cfg.GetEnvironmentImageName(envName))
+	case syncstate.RemoteAhead, syncstate.RemoteOnly:
+		return fmt.Sprintf("update with 'devdrop pull %s'", envName)
+	case syncstate.Diverged:
+		return fmt.Sprintf("commit to keep the local image ('devdrop commit %s') or pull to take the pushed one ('devdrop pull %s')", envName, envName)
+	case syncstate.NoImage:
+		return fmt.Sprintf("save it with 'devdrop commit %s'", envName)
+	}
+	return ""
+}
+
+// registryDisplayName returns a human friendly name for a registry host
+func registryDisplayName(host string) string {
+	if registry.IsDockerHub(host) {
+		return "DockerHub"
+	}
+	return registry.NormalizeHost(host)
+}
+
+// errLocalOnly is returned when a command would push or pull the images of
+// a local-only environment
+func errLocalOnly(envName, action string) error {
+	return fmt.Errorf("environment '%s' is local-only and can't be %s: its images never leave this machine", envName, action)
+}
+
+// environmentAuthToken returns the auth token for the registry an environment is stored in
+func environmentAuthToken(cfg *config.Config, envName string) string {
+	return cfg.GetRegistryLogin(cfg.GetEnvironmentRegistry(envName)).AuthToken
+}
+
+// resolveEnvironment returns the environment named in args, or the current
+// environment when no name is given, and verifies that it exists
+func resolveEnvironment(cfg *config.Config, args []string) (string, config.Environment, error) {
+	var targetEnv string
+	if len(args) == 0 {
+		var err error
+		if targetEnv, err = defaultEnvironment(cfg); err != nil {
+			return "", config.Environment{}, err
+		}
+	} else {
+		targetEnv = config.EnsureDevDropPrefix(args[0])
+	}
+
+	env, exists := cfg.Environments[targetEnv]
+	if !exists {
+		return "", config.Environment{}, environmentNotFound(targetEnv)
+	}
+
+	return targetEnv, env, nil
+}
+
+// defaultEnvironment returns the environment to use when none is named: the
+// one pinned by a .devdrop file in the current directory or above it
+// ('devdrop use'), the one mapped to the current directory ('devdrop map'),
+// or else the current environment
+func defaultEnvironment(cfg *config.Config) (string, error) {
+	if dir, err := currentWorkspace(); err == nil {
+		pin, envName, ok, err := config.FindPin(dir)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			if _, exists := cfg.Environments[envName]; !exists {
+				return "", fmt.Errorf("%w; it is pinned by %s. Run 'devdrop pull %s' to get it, or 'devdrop use' to pin another", &config.EnvironmentNotFoundError{Name: envName}, pin, envName)
+			}
+			return envName, nil
+		}
+		if _, envName, ok := cfg.MappingFor(dir); ok {
+			return envName, nil
+		}
+	}
+
+	if !cfg.HasEnvironments() {
+		return "", fmt.Errorf("no environments configured. Run 'devdrop init' to create one")
+	}
+	targetEnv := cfg.GetCurrentEnvironment()
+	if targetEnv == "" {
+		return "", fmt.Errorf("no current environment set. Run 'devdrop switch' to select one")
+	}
+	return targetEnv, nil
+}
+
+// sessionContainer returns the container to commit for an environment.
+// A ref, the name or a container ID prefix of a session, picks one
+// explicitly. Otherwise, when several sessions of the environment are
+// around, e.g. from two terminals, the user is asked which one to use,
+// with the one recorded in the config as the default; action says what
+// for. An empty ID means there is no container.
+func sessionContainer(dockerClient *docker.Client, targetEnv string, env config.Environment, ref, action string) (string, error) {
+	candidates, err := sessionCandidates(dockerClient, targetEnv, env)
+	if err != nil {
+		return "", err
+	}
+
+	if ref != "" {
+		var matches []docker.ContainerInfo
+		for _, candidate := range candidates {
+			if candidate.Name == ref {
+				return candidate.ID, nil
+			}
+			if strings.HasPrefix(candidate.ID, ref) {
+				matches = append(matches, candidate)
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return "", fmt.Errorf("no session '%s' of environment '%s'. Run 'devdrop sessions %s' to list them", ref, targetEnv, targetEnv)
+		case 1:
+			return matches[0].ID, nil
+		default:
+			return "", fmt.Errorf("'%s' matches %d sessions of %s; give more of the container ID or the session name", ref, len(matches), targetEnv)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", nil
+	case 1:
+		return candidates[0].ID, nil
+	}
+
+	fmt.Printf("Sessions of %s:\n", targetEnv)
+	labels := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		details := []string{candidate.State, "started " + output.RelativeTime(candidate.Created)}
+		if candidate.Workspace != "" {
+			details = append(details, "in "+candidate.Workspace)
+		}
+		if candidate.ID == env.LastContainer {
+			details = append(details, "recorded for commit")
+		}
+		name := candidate.Name
+		if name == "" {
+			name = shortID(candidate.ID)
+		}
+		labels[i] = fmt.Sprintf("%s (%s)", name, strings.Join(details, ", "))
+	}
+	choice, err := prompt.Select(fmt.Sprintf("Select the session to %s", action), labels, 0)
+	if err != nil {
+		return "", withPromptHint(err, fmt.Sprintf("run 'devdrop sessions %s' to list them", targetEnv))
+	}
+	return candidates[choice].ID, nil
+}
+
+// sessionCandidates lists the session containers of an environment: the
+// one recorded in the config first if it still exists, then the others
+// labelled with the environment, newest first. The labelled ones cover
+// concurrent sessions, sessions whose terminal closed before they were
+// recorded and configs that went stale. Ephemeral sessions and the
+// containers of 'devdrop run --platform' are left out.
+func sessionCandidates(dockerClient *docker.Client, targetEnv string, env config.Environment) ([]docker.ContainerInfo, error) {
+	containers, err := dockerClient.FindContainers(targetEnv, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []docker.ContainerInfo
+	if env.LastContainer != "" {
+		if state, err := dockerClient.ContainerState(env.LastContainer); err != nil || state != "removed" {
+			recorded := docker.ContainerInfo{ID: env.LastContainer, State: state}
+			for _, container := range containers {
+				if container.ID == env.LastContainer {
+					recorded = container
+				}
+			}
+			if recorded.Name == "" {
+				recorded.Name, _, _ = dockerClient.ContainerImage(env.LastContainer)
+			}
+			candidates = append(candidates, recorded)
+		}
+	}
+	for _, container := range containers {
+		if container.ID != env.LastContainer && !isPlatformContainer(env, container.ID) && !container.Ephemeral {
+			candidates = append(candidates, container)
+		}
+	}
+	return candidates, nil
+}
+
+// resolveEnvironmentImage picks the image to start an environment from: the
+// committed image if it exists locally, the base image for environments that
+// were never committed, or a pull from the registry as last resort. Progress
+// messages are written to log.
+func resolveEnvironmentImage(dockerClient *docker.Client, cfg *config.Config, targetEnv string, log io.Writer) (string, error) {
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	fmt.Fprintf(log, "Checking for environment image: %s\n", imageName)
+
+	if dockerClient.ImageExists(imageName) {
+		fmt.Fprintln(log, "Environment image found locally.")
+		return imageName, nil
+	}
+
+	// Check if environment exists in config (might have uncommitted changes)
+	if env, exists := cfg.Environments[targetEnv]; exists && env.BaseImage != "" {
+		fmt.Fprintf(log, "Environment image not found, using base image: %s\n", env.BaseImage)
+		fmt.Fprintln(log, "Note: You'll be running the base environment. Run 'devdrop commit' after your session to save changes.")
+		return env.BaseImage, nil
+	}
+
+	// Try pulling from the registry as last resort
+	if cfg.IsLocalOnly(targetEnv) {
+		return "", fmt.Errorf("environment image %s not found. Local-only environments exist only on the machine they were committed on", imageName)
+	}
+	fmt.Fprintf(log, "Environment image not found locally. Pulling from %s...\n", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+	if err := pullEnvironmentImage(dockerClient, cfg, targetEnv, imageName, ""); err != nil {
+		return "", fmt.Errorf("failed to pull environment image. Make sure the environment exists or run 'devdrop init' first: %w", err)
+	}
+	fmt.Fprintln(log, "Image pulled successfully!")
+	return imageName, nil
+}
+
+// pullEnvironmentImage pulls an image of an environment, for platform
+// when it isn't empty. With verify_signatures on, its signature is checked
+// first and the verified digest is pulled and tagged as imageName.
+func pullEnvironmentImage(dockerClient *docker.Client, cfg *config.Config, targetEnv, imageName, platform string) error {
+	authToken := environmentAuthToken(cfg, targetEnv)
+	pull := func(ref string) error {
+		if platform != "" {
+			return dockerClient.PullImagePlatform(ref, platform, authToken)
+		}
+		return dockerClient.PullImage(ref, authToken)
+	}
+
+	verifier, err := environmentVerifier(cfg, targetEnv)
+	if err != nil {
+		return err
+	}
+	if verifier == nil {
+		return pull(imageName)
+	}
+	ref, err := verifier.VerifyImage(dockerClient, imageName, authToken)
+	if err != nil {
+		return err
+	}
+	if err := pull(ref); err != nil {
+		return err
+	}
+	if err := dockerClient.TagImage(ref, imageName); err != nil {
+		return fmt.Errorf("failed to tag pulled image: %w", err)
+	}
+	return nil
+}
+
+// environmentSigner returns the cosign signer for the pushed versions of an
+// environment, nil when signing_key isn't set or nothing is pushed
+func environmentSigner(cfg *config.Config, targetEnv string) (*signing.Cosign, error) {
+	if cfg.SigningKey == "" || cfg.IsLocalOnly(targetEnv) {
+		return nil, nil
+	}
+	return environmentCosign(cfg, targetEnv, cfg.SigningKey)
+}
+
+// environmentVerifier returns the cosign verifier for the images of an
+// environment, nil when verify_signatures is off or nothing is pulled
+func environmentVerifier(cfg *config.Config, targetEnv string) (*signing.Cosign, error) {
+	if cfg.IsLocalOnly(targetEnv) {
+		return nil, nil
+	}
+	return registryVerifier(cfg, cfg.GetEnvironmentRegistry(targetEnv))
+}
+
+// registryVerifier returns the cosign verifier for images pulled from a
+// registry, nil when verify_signatures is off
+func registryVerifier(cfg *config.Config, host string) (*signing.Cosign, error) {
+	if !cfg.VerifySignatures {
+		return nil, nil
+	}
+	key := cfg.GetVerifyKey()
+	if key == "" {
+		return nil, fmt.Errorf("verify_signatures is on but no key is set; set verify_key (or signing_key) in the config to the team's cosign public key")
+	}
+	return registryCosign(cfg, host, key)
+}
+
+func environmentCosign(cfg *config.Config, targetEnv, key string) (*signing.Cosign, error) {
+	return registryCosign(cfg, cfg.GetEnvironmentRegistry(targetEnv), key)
+}
+
+func registryCosign(cfg *config.Config, host, key string) (*signing.Cosign, error) {
+	if !strings.Contains(key, "://") {
+		var err error
+		if key, err = expandPath(key); err != nil {
+			return nil, err
+		}
+	}
+	creds, err := registry.DecodeAuth(cfg.GetRegistryLogin(host).AuthToken)
+	if err != nil {
+		return nil, err
+	}
+	return &signing.Cosign{Key: key, Host: host, Creds: creds, Output: os.Stderr}, nil
+}
+
+// resolveMounts turns src:dst[:ro] mounts into Docker bind specifications,
+// expanding ~ and making host paths absolute
+func resolveMounts(mounts []string) ([]string, error) {
+	binds := make([]string, 0, len(mounts))
+	for _, mount := range mounts {
+		src, dst, readOnly, err := spec.ParseMount(mount)
+		if err != nil {
+			return nil, err
+		}
+
+		src, err = expandPath(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve mount '%s': %w", mount, err)
+		}
+
+		bind := src + ":" + dst
+		if readOnly {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds, nil
+}
+
+// validateVolumes checks name:dst[:ro] volumes without contacting Docker
+func validateVolumes(volumes []string) error {
+	for _, volume := range volumes {
+		if _, _, _, err := spec.ParseVolume(volume); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateMountTargets checks that bind mounts and volumes parse and that no
+// two of them, or one of them and the workspace, share a container path
+func validateMountTargets(containerWorkspace string, mounts, volumes []string) error {
+	targets := map[string]string{containerWorkspace: "the workspace"}
+	claim := func(dst, what string) error {
+		dst = path.Clean(dst)
+		if other, taken := targets[dst]; taken {
+			return fmt.Errorf("%s and %s are both mounted at %s", what, other, dst)
+		}
+		targets[dst] = what
+		return nil
+	}
+
+	for _, mount := range mounts {
+		_, dst, _, err := spec.ParseMount(mount)
+		if err != nil {
+			return err
+		}
+		if err := claim(dst, "mount '"+mount+"'"); err != nil {
+			return err
+		}
+	}
+	for _, volume := range volumes {
+		_, dst, _, err := spec.ParseVolume(volume)
+		if err != nil {
+			return err
+		}
+		if err := claim(dst, "volume '"+volume+"'"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveVolumes creates the Docker volumes behind an environment's
+// name:dst[:ro] volumes as needed and returns them as bind specifications
+func resolveVolumes(dockerClient *docker.Client, envName string, volumes []string) ([]string, error) {
+	binds := make([]string, 0, len(volumes))
+	for _, volume := range volumes {
+		name, dst, readOnly, err := spec.ParseVolume(volume)
+		if err != nil {
+			return nil, err
+		}
+
+		dockerVolume, err := dockerClient.EnsureVolume(envName, name)
+		if err != nil {
+			return nil, err
+		}
+
+		bind := dockerVolume + ":" + dst
+		if readOnly {
+			bind += ":ro"
+		}
+		binds = append(binds, bind)
+	}
+	return binds, nil
+}
+
+// ignoredPath is a path of a workspace its .devdropignore keeps out of
+// sessions, relative to the workspace
+type ignoredPath struct {
+	rel   string
+	isDir bool
+}
+
+// workspaceIgnored reads the .devdropignore of a workspace and lists the
+// outermost paths it matches; nothing inside an ignored directory is listed
+func workspaceIgnored(workspace string) (*ignore.Rules, []ignoredPath, error) {
+	rules, err := ignore.Load(workspace)
+	if err != nil || rules.Empty() {
+		return rules, nil, err
+	}
+
+	var ignored []ignoredPath
+	err = rules.Walk(workspace, func(rel string, info os.FileInfo, isIgnored bool) error {
+		if isIgnored {
+			ignored = append(ignored, ignoredPath{rel: rel, isDir: info.IsDir()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to apply %s: %w", ignore.FileName, err)
+	}
+	return rules, ignored, nil
+}
+
+// ignoredMounts keeps ignored paths of a workspace out of its sessions,
+// which have it at containerWorkspace: each ignored directory is replaced by
+// a workspace volume of the environment that keeps its contents across
+// sessions and, with maskFiles, each ignored file by an empty read-only file
+func ignoredMounts(dockerClient *docker.Client, envName, workspace, containerWorkspace string, ignored []ignoredPath, maskFiles bool) ([]string, error) {
+	var binds []string
+	for _, path := range ignored {
+		target := containerWorkspace + "/" + path.rel
+		if path.isDir {
+			volume, err := dockerClient.EnsureWorkspaceVolume(envName, workspace, path.rel)
+			if err != nil {
+				return nil, err
+			}
+			binds = append(binds, volume+":"+target)
+			continue
+		}
+		// The empty file only exists on this machine
+		if !maskFiles || dockerClient.IsRemote() {
+			continue
+		}
+		empty, err := emptySessionFile()
+		if err != nil {
+			return nil, err
+		}
+		binds = append(binds, empty+":"+target+":ro")
+	}
+	return binds, nil
+}
+
+// warnRemoteBinds points out that the workspace and mounts of a container
+// on a remote daemon are that machine's directories, not this one's
+func warnRemoteBinds(dockerClient *docker.Client, workspace string, mounts []string, log io.Writer) {
+	if !dockerClient.IsRemote() {
+		return
+	}
+	fmt.Fprintf(log, "Warning: Docker runs on %s; /workspace will be %s on that machine, not this directory.\n", dockerClient.Endpoint(), workspace)
+	if len(mounts) > 0 {
+		fmt.Fprintf(log, "Warning: mounts refer to paths on that machine too: %s\n", strings.Join(mounts, ", "))
+	}
+}
+
+// emptySessionFile returns an empty file that ignored files are masked with
+func emptySessionFile() (string, error) {
+	dir, err := config.GetSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+	if _, err := os.Stat(empty); os.IsNotExist(err) {
+		if err := os.WriteFile(empty, nil, 0444); err != nil {
+			return "", fmt.Errorf("failed to create %s: %w", empty, err)
+		}
+	}
+	return empty, nil
+}
+
+// expandPath expands a leading ~ and makes a host path absolute
+func expandPath(path string) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	return filepath.Abs(path)
+}
+
+// currentWorkspace returns the absolute path of the current directory, which
+// is mounted as /workspace in environment containers
+func currentWorkspace() (string, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	absPath, err := filepath.Abs(currentDir)
+	if err != nil {
+		return "", fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	return absPath, nil
+}
+
+// sessionHooks returns the runner for the hooks of a session of envName in
+// the current directory. Container hooks run in containerID; without one
+// only host hooks can run.
+func sessionHooks(dockerClient *docker.Client, envName, containerID string) *hooks.Runner {
+	workspace, _ := currentWorkspace()
+	runner := &hooks.Runner{
+		Environment: envName,
+		Container:   containerID,
+		Workspace:   workspace,
+	}
+	if containerID != "" {
+		runner.Exec = func(cmd, env []string) (int, error) {
+			return dockerClient.ExecInSession(containerID, docker.ExecOptions{
+				Cmd:    cmd,
+				Env:    env,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			})
+		}
+	}
+	return runner
+}
+
+// recordInStore records the given tags of an environment in the experimental
+// content-addressed store. It does nothing unless experimental_store is
+// enabled, and only warns on failure.
+func recordInStore(dockerClient *docker.Client, cfg *config.Config, envName string, tags ...string) {
+	if !cfg.ExperimentalStore {
+		return
+	}
+	if err := recordTags(dockerClient, cfg, envName, tags); err != nil {
+		fmt.Printf("Warning: failed to update environment store: %v\n", err)
+	}
+}
+
+func recordTags(dockerClient *docker.Client, cfg *config.Config, envName string, tags []string) error {
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		info, err := dockerClient.InspectImage(cfg.GetEnvironmentImageRef(envName, tag))
+		if err != nil {
+			return err
+		}
+
+		obj := store.Object{
+			Digest:      info.ID,
+			Environment: envName,
+			RepoDigests: info.RepoDigests,
+			Size:        info.Size,
+			Recorded:    time.Now(),
+		}
+		if err := st.Put(obj); err != nil {
+			return err
+		}
+		if err := st.SetRef(envName, tag, info.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openStore opens the content-addressed environment store
+func openStore() (*store.Store, error) {
+	dir, err := config.GetStoreDir()
+	if err != nil {
+		return nil, err
+	}
+	return store.Open(dir)
+}
+
+// withPromptHint tells the user how to pass a value up front when a prompt
+// can't be answered in non-interactive mode
+func withPromptHint(err error, hint string) error {
+	if errors.Is(err, prompt.ErrNonInteractive) {
+		return fmt.Errorf("%w (%s)", err, hint)
+	}
+	return err
+}
+
+// optionalTime returns nil for the zero time, so structured output omits
+// timestamps that were never set
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// randomSuffix returns a short random hex string for unique names
+func randomSuffix() (string, error) {
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(suffix), nil
+}
+
+// shortID abbreviates a container ID for display
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// saveImageToTemp writes images in docker save format to a temporary file
+func saveImageToTemp(dockerClient *docker.Client, imageNames ...string) (string, error) {
+	archive, err := dockerClient.SaveImage(imageNames...)
+	if err != nil {
+		return "", err
+	}
+	defer archive.Close()
+
+	file, err := os.CreateTemp("", "devdrop-image-*.tar")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, archive); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to save image %s: %w", strings.Join(imageNames, ", "), err)
+	}
+	return file.Name(), nil
+}
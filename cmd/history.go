@@ -0,0 +1,70 @@
+// Package cmd provides the history command for DevDrop.
+//
+// The history command lists the committed versions of an environment.
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var historyCmd = &cobra.Command{
+	Use:   "history [environment-name]",
+	Short: "List the committed versions of an environment",
+	Long: `List the committed versions of an environment, newest first.
+
+Every 'devdrop commit' creates a new version tag (v1, v2, ...) in addition
+to updating latest. The version latest currently points to is marked with *.
+Use 'devdrop rollback' to restore a previous version.
+
+Examples:
+  devdrop history               # Versions of the current environment
+  devdrop history myenv         # Versions of devdrop-myenv`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runHistory,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+}
+
+func runHistory(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Environment: %s\n", targetEnv)
+	fmt.Printf("Repository: %s\n", cfg.GetEnvironmentRepository(targetEnv))
+	fmt.Println()
+
+	if len(env.Versions) == 0 {
+		fmt.Printf("No versions yet. Run 'devdrop commit %s' to create one.\n", targetEnv)
+		return nil
+	}
+
+	fmt.Println("Versions:")
+	for i := len(env.Versions) - 1; i >= 0; i-- {
+		v := env.Versions[i]
+		marker := " "
+		if v.Tag == env.LatestVersion {
+			marker = "*"
+		}
+		platforms := ""
+		if len(v.Platforms) > 0 {
+			platforms = " [" + strings.Join(v.Platforms, ", ") + "]"
+		}
+		fmt.Printf("  %s %-6s %s%s\n", marker, v.Tag, output.TimestampWithAge(v.Created), platforms)
+	}
+
+	return nil
+}
@@ -0,0 +1,360 @@
+// Package cmd provides the images command for DevDrop.
+//
+// The images command is a low-level view of DevDrop's local images:
+// - Lists every devdrop image with its tags, digest, size and environment
+// - Shows whether each image is a latest version, older version or stale
+// - Removes individual tags or images with 'devdrop images rm'
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var imagesCmd = &cobra.Command{
+	Use:   "images",
+	Short: "List local devdrop images",
+	Long: `List the local images that belong to DevDrop: tags of devdrop-*
+repositories and the untagged (dangling) images earlier commits and pulls
+left behind. Use it to untangle local Docker state when 'devdrop ls' isn't
+detailed enough.
+
+The STATUS column shows how an image is used:
+  latest        the latest version of a configured environment
+  version       an older version still in an environment's history
+  unreferenced  not used by any configured environment
+  dangling      untagged; 'devdrop clean' removes it
+
+Examples:
+  devdrop images                              # All devdrop images
+  devdrop images -o json                      # Machine-readable output
+  devdrop images rm alice/devdrop-go:v3       # Remove one tag
+  devdrop images rm 0123456789ab              # Remove an image by ID`,
+	Args: cobra.NoArgs,
+	RunE: runImages,
+}
+
+var imagesRmCmd = &cobra.Command{
+	Use:   "rm <ref>...",
+	Short: "Remove devdrop image tags or images",
+	Long: `Remove devdrop images by tag, image ID (or its prefix) or digest.
+
+Removing a tag keeps the image while other tags point at it; removing by ID
+removes the image and all its tags. The latest version of an environment and
+versions in its history are only removed with --force, which also removes
+images used by stopped containers. Images that don't belong to DevDrop are
+left to 'docker rmi'. Use --dry-run to see what would be removed first.
+
+Examples:
+  devdrop images rm alice/devdrop-go:v3
+  devdrop images rm --dry-run 0123456789ab
+  devdrop images rm 0123456789ab
+  devdrop images rm --force alice/devdrop-go:latest`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: runImagesRm,
+}
+
+var (
+	imagesOutput   string
+	imagesRmForce  bool
+	imagesRmDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(imagesCmd)
+	imagesCmd.AddCommand(imagesRmCmd)
+	imagesCmd.Flags().StringVarP(&imagesOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	imagesRmCmd.Flags().BoolVarP(&imagesRmForce, "force", "f", false, "Also remove environment versions and images used by stopped containers")
+	imagesRmCmd.Flags().BoolVar(&imagesRmDryRun, "dry-run", false, "Show what would be removed without removing anything")
+}
+
+// Image statuses shown by 'devdrop images'
+const (
+	imageStatusLatest       = "latest"
+	imageStatusVersion      = "version"
+	imageStatusUnreferenced = "unreferenced"
+	imageStatusDangling     = "dangling"
+)
+
+// localImage is a devdrop image as listed by 'devdrop images'
+type localImage struct {
+	ID          string    `json:"id" yaml:"id"`
+	Tags        []string  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Digests     []string  `json:"digests,omitempty" yaml:"digests,omitempty"`
+	Size        int64     `json:"size" yaml:"size"`
+	Created     time.Time `json:"created" yaml:"created"`
+	Environment string    `json:"environment,omitempty" yaml:"environment,omitempty"`
+	Status      string    `json:"status" yaml:"status"`
+}
+
+func runImages(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(imagesOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	images, err := localImages(dockerClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	if imagesOutput != output.FormatText {
+		return output.Render(os.Stdout, imagesOutput, images)
+	}
+
+	if len(images) == 0 {
+		fmt.Println("No devdrop images found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE ID\tTAG\tDIGEST\tENVIRONMENT\tSIZE\tCREATED\tSTATUS")
+	for _, image := range images {
+		tags := image.Tags
+		if len(tags) == 0 {
+			tags = []string{"<none>"}
+		}
+		digest := "<none>"
+		if len(image.Digests) > 0 {
+			_, d, _ := strings.Cut(image.Digests[0], "@")
+			digest = shortDigest(d)
+		}
+		environment := image.Environment
+		if environment == "" {
+			environment = "-"
+		}
+		for _, tag := range tags {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", shortDigest(image.ID), tag, digest, environment,
+				units.HumanSize(float64(image.Size)), output.RelativeTime(image.Created), image.Status)
+		}
+	}
+	return w.Flush()
+}
+
+func runImagesRm(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	images, err := localImages(dockerClient, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Check every ref before removing anything
+	for _, ref := range args {
+		image, tag, err := findLocalImage(images, ref)
+		if err != nil {
+			return err
+		}
+		if image == nil {
+			return fmt.Errorf("'%s' is not a local devdrop image. Run 'devdrop images' to list them (other images are left to 'docker rmi')", ref)
+		}
+		if imagesRmForce {
+			continue
+		}
+		switch {
+		case tag != "" && tagStatus(cfg, tag) != imageStatusUnreferenced:
+			return fmt.Errorf("%s is a version of %s; use --force to remove it anyway ('devdrop rollback' pulls it back from the registry)", tag, image.Environment)
+		case tag == "" && image.Status != imageStatusUnreferenced && image.Status != imageStatusDangling:
+			return fmt.Errorf("image %s holds versions of %s; use --force to remove it anyway ('devdrop rollback' pulls it back from the registry)", shortDigest(image.ID), image.Environment)
+		}
+	}
+
+	if imagesRmDryRun {
+		for _, ref := range args {
+			image, tag, _ := findLocalImage(images, ref)
+			if tag != "" {
+				fmt.Printf("Would remove tag %s\n", tag)
+				continue
+			}
+			name := shortDigest(image.ID)
+			if len(image.Tags) > 0 {
+				name += " (" + strings.Join(image.Tags, ", ") + ")"
+			}
+			fmt.Printf("Would remove image %s, %s\n", name, units.HumanSize(float64(image.Size)))
+		}
+		fmt.Println("Dry run: nothing was removed.")
+		return nil
+	}
+
+	for _, ref := range args {
+		image, tag, _ := findLocalImage(images, ref)
+		target := tag
+		if target == "" {
+			target = image.ID
+		}
+		removed, err := dockerClient.RemoveImageRef(target, imagesRmForce)
+		if err != nil {
+			return err
+		}
+		for _, item := range removed {
+			fmt.Printf("  %s\n", item)
+		}
+		output.Successf("Removed %s", ref)
+	}
+	return nil
+}
+
+// localImages returns the devdrop images, grouped by environment and newest
+// first
+func localImages(dockerClient *docker.Client, cfg *config.Config) ([]localImage, error) {
+	summaries, err := dockerClient.ListImages()
+	if err != nil {
+		return nil, err
+	}
+
+	var images []localImage
+	for _, summary := range summaries {
+		image := localImage{
+			ID:          summary.ID,
+			Digests:     summary.RepoDigests,
+			Size:        summary.Size,
+			Created:     summary.Created,
+			Environment: summary.Labels[docker.LabelEnvironment],
+			Status:      imageStatusUnreferenced,
+		}
+
+		if summary.Dangling() {
+			if !devdropImage(dockerClient, summary) {
+				continue
+			}
+			image.Status = imageStatusDangling
+			images = append(images, image)
+			continue
+		}
+
+		for _, ref := range summary.RepoTags {
+			repo, _ := splitImageTag(ref)
+			if !isDevDropRepository(repo) {
+				continue
+			}
+			image.Tags = append(image.Tags, ref)
+			if name := repositoryEnvironment(cfg, repo); name != "" {
+				image.Environment = name
+			}
+			image.Status = strongerStatus(image.Status, tagStatus(cfg, ref))
+		}
+		if len(image.Tags) == 0 {
+			continue
+		}
+		images = append(images, image)
+	}
+
+	sort.SliceStable(images, func(i, j int) bool {
+		if images[i].Environment != images[j].Environment {
+			return images[i].Environment < images[j].Environment
+		}
+		return images[i].Created.After(images[j].Created)
+	})
+	return images, nil
+}
+
+// repositoryEnvironment returns the configured environment stored in an
+// image repository, if any
+func repositoryEnvironment(cfg *config.Config, repo string) string {
+	for name := range cfg.Environments {
+		if cfg.GetEnvironmentRepository(name) == repo {
+			return name
+		}
+	}
+	return ""
+}
+
+// tagStatus tells whether a tag is an environment's latest version, an
+// older version in its history, or unreferenced
+func tagStatus(cfg *config.Config, ref string) string {
+	repo, tag := splitImageTag(ref)
+	name := repositoryEnvironment(cfg, repo)
+	if name == "" {
+		return imageStatusUnreferenced
+	}
+
+	env := cfg.Environments[name]
+	if tag == "latest" || versionTagMatches(env.LatestVersion, tag) {
+		return imageStatusLatest
+	}
+	for _, version := range env.Versions {
+		if versionTagMatches(version.Tag, tag) {
+			return imageStatusVersion
+		}
+	}
+	return imageStatusUnreferenced
+}
+
+// strongerStatus returns the status that matters more to the user when an
+// image has several tags
+func strongerStatus(a, b string) string {
+	rank := map[string]int{imageStatusUnreferenced: 0, imageStatusVersion: 1, imageStatusLatest: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// findLocalImage finds the image a ref names: a tag (":latest" may be
+// omitted), an image ID or ID prefix, or a repository digest. The tag is
+// returned when the ref named one. A nil image means no image matched; an
+// ID prefix several images share is an error.
+func findLocalImage(images []localImage, ref string) (*localImage, string, error) {
+	tag := ref
+	if repo, t := splitImageTag(ref); t == "latest" && !strings.HasSuffix(ref, ":latest") {
+		tag = repo + ":latest"
+	}
+
+	for i, image := range images {
+		for _, t := range image.Tags {
+			if t == tag {
+				return &images[i], t, nil
+			}
+		}
+	}
+
+	id := strings.TrimPrefix(ref, "sha256:")
+	var matches []int
+	for i, image := range images {
+		for _, digest := range image.Digests {
+			if digest == ref {
+				return &images[i], "", nil
+			}
+		}
+		if len(id) >= 4 && strings.HasPrefix(strings.TrimPrefix(image.ID, "sha256:"), id) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, "", nil
+	case 1:
+		return &images[matches[0]], "", nil
+	default:
+		return nil, "", fmt.Errorf("ambiguous reference '%s': it matches %d images; give more of the image ID", ref, len(matches))
+	}
+}
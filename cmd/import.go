@@ -0,0 +1,127 @@
+// Package cmd provides the import command for DevDrop.
+//
+// The import command restores an environment written by 'devdrop export':
+// - Checks the archive's metadata before loading anything
+// - Loads the images into Docker under your own namespace
+// - Registers the environment with its exported config
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/export"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <archive>",
+	Short: "Import an environment from a tarball written by 'devdrop export'",
+	Long: `Restore an environment from an archive written by 'devdrop export', without
+a registry. The images are loaded into Docker and tagged under your own
+namespace, and the environment is registered with its exported config
+(description, base image, versions, tool locks, ports and mounts).
+
+The environment keeps its name unless --name gives another. An existing
+environment of that name is only replaced with --force. Nothing is pushed;
+'devdrop commit' pushes to your registry when one is reachable.
+
+Examples:
+  devdrop import go.tar
+  devdrop import go.tar.gz --name go-offline
+  devdrop import go.tar --force  # Replace the existing environment`,
+	Args: cobra.ExactArgs(1),
+	RunE: runImport,
+}
+
+var (
+	importName  string
+	importForce bool
+)
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVar(&importName, "name", "", "Environment name (default: the exported name)")
+	importCmd.Flags().BoolVar(&importForce, "force", false, "Replace an existing environment of the same name")
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	var metadata export.Metadata
+	var targetEnv string
+	// The images are loaded under our own repository right away, so tags of
+	// the exporting user's repository on this machine are never touched
+	tags := make(map[string]string)
+	check := func(m export.Metadata) error {
+		metadata = m
+		targetEnv = config.EnsureDevDropPrefix(m.Environment)
+		if importName != "" {
+			targetEnv = config.EnsureDevDropPrefix(importName)
+		}
+		if _, exists := cfg.Environments[targetEnv]; exists && !importForce {
+			return fmt.Errorf("environment '%s' already exists. Use --name to import under another name or --force to replace it", targetEnv)
+		}
+		if _, ok := m.Images["latest"]; !ok {
+			return fmt.Errorf("invalid export archive: it has no latest image")
+		}
+		for tag, source := range m.Images {
+			tags[source] = cfg.GetEnvironmentImageRef(targetEnv, tag)
+		}
+		fmt.Printf("Importing %s (exported %s) as %s...\n", m.Environment, output.TimestampWithAge(m.Exported), targetEnv)
+		return nil
+	}
+	load := func(images io.Reader) error {
+		return dockerClient.LoadImageAs(images, tags)
+	}
+	if err := export.Read(file, check, load); err != nil {
+		return err
+	}
+
+	env := metadata.Config
+	env.Image = cfg.GetEnvironmentImageName(targetEnv)
+	env.Registry = ""
+	if existing, exists := cfg.Environments[targetEnv]; exists {
+		// Keep the local-only settings of the environment being replaced
+		env.Favorite = existing.Favorite
+		env.Env = existing.Env
+		env.Registry = existing.Registry
+	}
+	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+		return fmt.Errorf("failed to save environment to config: %w", err)
+	}
+
+	imported := make([]string, 0, len(metadata.Images))
+	for tag := range metadata.Images {
+		imported = append(imported, tag)
+	}
+	sort.Strings(imported)
+	recordInStore(dockerClient, cfg, targetEnv, imported...)
+
+	fmt.Println()
+	output.Successf("Imported environment '%s'", targetEnv)
+	fmt.Printf("Run 'devdrop run %s' to use it.\n", targetEnv)
+	return nil
+}
@@ -2,21 +2,25 @@
 //
 // The init command handles initial environment setup:
 // - Pulls the base Ubuntu 24.04 image
+// - Starts from a template's image, packages and setup with --template
+// - Shows the base image's digest, platform and size and checks catalog pins
 // - Creates and starts an interactive container
 // - Allows user to customize their development environment
 // - Provides instructions for committing changes after customization
 package cmd
 
 import (
-	"bufio"
 	"fmt"
-	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/oysteinje/devdrop/pkg/config"
-	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/templates"
+	"github.com/oysteinje/devdrop/pkg/workflow"
 	"github.com/spf13/cobra"
 )
 
@@ -31,6 +35,9 @@ var (
 	envName         string
 	starterImage    string
 	customBaseImage string
+	systemEntry     string
+	initTemplate    string
+	initLocalOnly   bool
 )
 
 var initCmd = &cobra.Command{
@@ -40,18 +47,35 @@ var initCmd = &cobra.Command{
 and creating a named environment where you can customize your setup.
 
 This command will:
-1. Let you choose from starter images (ubuntu, go, node, python) or provide a custom image
+1. Let you choose from starter images (ubuntu, go, node, python) or provide a custom image,
+   or use a template (see 'devdrop templates list')
 2. Create a named environment (automatically prefixed with 'devdrop-')
-3. Start an interactive container with bash
-4. Allow you to install tools, configure dotfiles, etc.
-5. After you exit, run 'devdrop commit <env-name>' to save your changes
+3. Pull the base image and show its digest, platform and size. Images pinned
+   by digest (in the reference or in the system catalog) must match the pin.
+   The digest is recorded with the environment.
+4. Start an interactive container with bash
+5. Allow you to install tools, configure dotfiles, etc. (dotfiles set with
+   'devdrop dotfiles' are installed automatically; --no-dotfiles skips them)
+6. After you exit, run 'devdrop commit <env-name>' to save your changes
+
+Templates install their packages and run their setup commands when the
+container starts, and their recommended volumes, mounts and ports are saved
+with the environment.
+
+Use --local-only for work environments whose images must not leave this
+machine: commit only tags them locally and nothing ever pushes or pulls
+them.
 
 Examples:
   devdrop init                           # Interactive prompts for image and name
   devdrop init --name myenv              # Use 'devdrop-myenv' as environment name
   devdrop init --name myenv --image go   # Use Go starter image
-  devdrop init --image custom --base-image myimage:latest  # Use custom image`,
-	RunE: runInit,
+  devdrop init --image custom --base-image myimage:latest  # Use custom image
+  devdrop init --system go-1.22          # Start from an approved environment (see 'devdrop catalog')
+  devdrop init --template rust-wasm      # Start from a template (see 'devdrop templates')
+  devdrop init --name client --local-only  # Never push this environment`,
+	PreRunE: validateInitFlags,
+	RunE:    runInit,
 }
 
 func init() {
@@ -59,11 +83,88 @@ func init() {
 	initCmd.Flags().StringVarP(&envName, "name", "n", "", "Environment name (will be prefixed with 'devdrop-')")
 	initCmd.Flags().StringVarP(&starterImage, "image", "i", "", "Starter image (ubuntu, go, node, python, or 'custom' for --base-image)")
 	initCmd.Flags().StringVar(&customBaseImage, "base-image", "", "Custom base image URL (use with --image=custom)")
+	initCmd.Flags().StringVar(&systemEntry, "system", "", "Start from an environment in the system catalog (see 'devdrop catalog ls')")
+	initCmd.Flags().StringVarP(&initTemplate, "template", "t", "", "Start from a template (see 'devdrop templates list')")
+	initCmd.Flags().BoolVar(&initLocalOnly, "local-only", false, "Keep the environment's images on this machine; commit never pushes them")
+	initCmd.Flags().BoolVar(&noDotfiles, "no-dotfiles", false, "Don't install the dotfiles configured with 'devdrop dotfiles'")
+	initCmd.RegisterFlagCompletionFunc("image", completeStarterImages)
+	initCmd.RegisterFlagCompletionFunc("base-image", completeBaseImages)
+	initCmd.RegisterFlagCompletionFunc("template", completeTemplates)
+}
+
+// validateInitFlags checks the image flags before any Docker work is done, so
+// typos fail immediately instead of during the pull
+func validateInitFlags(cmd *cobra.Command, args []string) error {
+	if systemEntry != "" && (starterImage != "" || customBaseImage != "") {
+		return fmt.Errorf("--system can't be combined with --image or --base-image")
+	}
+	if initTemplate != "" && (systemEntry != "" || starterImage != "" || customBaseImage != "") {
+		return fmt.Errorf("--template can't be combined with --system, --image or --base-image")
+	}
+
+	// --base-image on its own implies a custom starter
+	if customBaseImage != "" && starterImage == "" {
+		starterImage = "custom"
+	}
+
+	if starterImage != "" {
+		if _, err := resolveBaseImage(starterImage, customBaseImage); err != nil {
+			return err
+		}
+	}
+
+	if customBaseImage != "" {
+		if starterImage != "custom" {
+			return fmt.Errorf("--base-image can only be used with --image=custom")
+		}
+		if _, err := reference.ParseNormalizedNamed(customBaseImage); err != nil {
+			return fmt.Errorf("invalid --base-image '%s': %w", customBaseImage, err)
+		}
+	}
+
+	return nil
+}
+
+// completeStarterImages completes --image with the starter catalog
+func completeStarterImages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names := make([]string, 0, len(starterImages)+1)
+	for name, image := range starterImages {
+		names = append(names, fmt.Sprintf("%s\t%s", name, image))
+	}
+	sort.Strings(names)
+	names = append(names, "custom\tprovide your own image with --base-image")
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeBaseImages completes --base-image with recently used and starter images
+func completeBaseImages(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var images []string
+	seen := make(map[string]bool)
+
+	if cfg, err := config.Load(); err == nil {
+		for _, image := range cfg.RecentImages {
+			if !seen[image] {
+				images = append(images, image+"\trecently used")
+				seen[image] = true
+			}
+		}
+	}
+
+	starters := make([]string, 0, len(starterImages))
+	for _, image := range starterImages {
+		if !seen[image] {
+			starters = append(starters, image+"\tstarter image")
+			seen[image] = true
+		}
+	}
+	sort.Strings(starters)
+
+	return append(images, starters...), cobra.ShellCompDirectiveNoFileComp
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
 	// Create Docker client
-	dockerClient, err := docker.NewClient()
+	dockerClient, err := newDockerClient()
 	if err != nil {
 		return fmt.Errorf("failed to connect to Docker: %w", err)
 	}
@@ -77,7 +178,30 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	// Get base image first (we need it for smart defaults)
 	finalBaseImage := ""
-	if starterImage == "" {
+	suggestedName := ""
+	pinnedDigest := ""
+	var template *templates.Template
+	if initTemplate != "" {
+		t, err := findTemplate(cfg, initTemplate)
+		if err != nil {
+			return err
+		}
+		template = &t
+		finalBaseImage = t.Image
+		suggestedName = t.Name
+	} else if systemEntry != "" {
+		catalog, err := config.LoadCatalog()
+		if err != nil {
+			return err
+		}
+		entry, exists := catalog.Environments[systemEntry]
+		if !exists {
+			return fmt.Errorf("'%s' is not in the system catalog. Run 'devdrop catalog ls' to see approved environments", systemEntry)
+		}
+		finalBaseImage = entry.Image
+		suggestedName = systemEntry
+		pinnedDigest = entry.Digest
+	} else if starterImage == "" {
 		finalBaseImage, err = promptForStarterImage()
 		if err != nil {
 			return err
@@ -93,27 +217,29 @@ func runInit(cmd *cobra.Command, args []string) error {
 	finalEnvName := envName
 	if finalEnvName == "" {
 		// Generate smart default based on base image
-		suggestedName := generateSmartDefault(finalBaseImage)
+		if suggestedName == "" {
+			suggestedName = generateSmartDefault(finalBaseImage)
+		}
 
-		// Prompt user with suggestion
+		// Prompt user with suggestion, an empty answer keeps it
 		finalEnvName, err = promptForEnvironmentNameWithDefault(suggestedName)
 		if err != nil {
 			return err
 		}
-
-		// If user didn't provide a name, use the smart default
-		if finalEnvName == "" {
-			finalEnvName = suggestedName
-		}
 	}
 	finalEnvName = config.EnsureDevDropPrefix(finalEnvName)
 
 	fmt.Printf("Initializing environment '%s' with base image: %s\n", finalEnvName, finalBaseImage)
 
-	// Pull base image
-	fmt.Println("Pulling base image...")
-	if err := dockerClient.PullImage(finalBaseImage); err != nil {
-		return fmt.Errorf("failed to pull base image: %w", err)
+	// Pull and check the base image
+	prepare, base := workflow.BaseImage(workflow.BaseImageOptions{
+		Client: dockerClient,
+		Config: cfg,
+		Image:  finalBaseImage,
+		Pin:    pinnedDigest,
+	})
+	if err := prepare.Run(progressSink()); err != nil {
+		return err
 	}
 
 	// Create and start interactive container
@@ -122,22 +248,42 @@ func runInit(cmd *cobra.Command, args []string) error {
 	fmt.Printf("When finished, type 'exit' and then run 'devdrop commit %s' to save your changes.\n", finalEnvName)
 	fmt.Println()
 
-	containerID, err := dockerClient.CreateContainer(finalBaseImage)
+	var setup []string
+	if template != nil {
+		if script := template.SetupScript(); script != "" {
+			setup = append(setup, script)
+		}
+	}
+	containerID, err := dockerClient.CreateContainer(finalBaseImage, finalEnvName, sessionDotfiles(cfg), setup...)
 	if err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
 
+	output.Emit(output.Event{Event: output.EventContainerCreated, Environment: finalEnvName, Image: finalBaseImage, Container: containerID})
+
+	output.Emit(output.Event{Event: output.EventSessionStarted, Environment: finalEnvName, Image: finalBaseImage, Container: containerID})
 	if err := dockerClient.StartInteractiveContainer(containerID); err != nil {
 		return fmt.Errorf("failed to start interactive container: %w", err)
 	}
+	output.Emit(output.Event{Event: output.EventSessionEnded, Environment: finalEnvName, Container: containerID})
 
 	// Create environment entry in config
 	env := config.Environment{
-		BaseImage:     finalBaseImage,
-		Created:       time.Now(),
-		LastUpdated:   time.Now(),
-		LastContainer: containerID,
-		Description:   fmt.Sprintf("Environment based on %s", finalBaseImage),
+		BaseImage:       finalBaseImage,
+		BaseImageDigest: base.Digest,
+		Created:         time.Now(),
+		LastUpdated:     time.Now(),
+		LastContainer:   containerID,
+		LastUsed:        time.Now(),
+		Registry:        cfg.Registry,
+		Description:     fmt.Sprintf("Environment based on %s", finalBaseImage),
+		LocalOnly:       initLocalOnly,
+	}
+	if template != nil {
+		env.Description = template.Description
+		env.Volumes = template.Volumes
+		env.Mounts = template.Mounts
+		env.Ports = template.Ports
 	}
 
 	if err := cfg.AddEnvironment(finalEnvName, env); err != nil {
@@ -154,67 +300,60 @@ func runInit(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Environment: %s\n", finalEnvName)
 	fmt.Printf("Container ID: %s\n", containerID)
 	fmt.Printf("Run 'devdrop commit %s' to save your customizations.\n", finalEnvName)
+	if template != nil {
+		printTemplateRecommendations(*template)
+	}
 
 	return nil
 }
 
-func promptForEnvironmentName() (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Print("Enter environment name (will be prefixed with 'devdrop-'): ")
-	name, err := reader.ReadString('\n')
-	if err != nil {
-		return "", fmt.Errorf("failed to read environment name: %w", err)
+// printTemplateRecommendations lists the volumes, mounts and ports a
+// template saved with the new environment
+func printTemplateRecommendations(t templates.Template) {
+	if len(t.Volumes)+len(t.Mounts)+len(t.Ports) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Printf("Recommended by template %s (saved in the environment config):\n", t.Name)
+	for _, volume := range t.Volumes {
+		fmt.Printf("  volume: %s\n", volume)
+	}
+	for _, m := range t.Mounts {
+		fmt.Printf("  mount:  %s\n", m)
+	}
+	for _, port := range t.Ports {
+		fmt.Printf("  port:   %s\n", port)
 	}
-	name = strings.TrimSpace(name)
-	// Don't provide a default here - let the caller handle it
-	return name, nil
 }
 
 func promptForEnvironmentNameWithDefault(defaultName string) (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-	fmt.Printf("Enter environment name [%s]: ", defaultName)
-	name, err := reader.ReadString('\n')
-	if err != nil {
-		return "", fmt.Errorf("failed to read environment name: %w", err)
-	}
-	name = strings.TrimSpace(name)
-	return name, nil
+	return prompt.Input("Enter environment name", defaultName)
 }
 
 func promptForStarterImage() (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-
 	fmt.Println("Available starter images:")
 	options := []string{"ubuntu", "go", "node", "python", "custom"}
+	labels := make([]string, len(options))
 	for i, option := range options {
 		if option == "custom" {
-			fmt.Printf("%d. %s (provide your own image URL)\n", i+1, option)
+			labels[i] = fmt.Sprintf("%s (provide your own image URL)", option)
 		} else {
-			fmt.Printf("%d. %s (%s)\n", i+1, option, starterImages[option])
+			labels[i] = fmt.Sprintf("%s (%s)", option, starterImages[option])
 		}
 	}
 
-	fmt.Print("Select starter image (1-5): ")
-	input, err := reader.ReadString('\n')
+	choice, err := prompt.Select("Select starter image", labels, -1)
 	if err != nil {
-		return "", fmt.Errorf("failed to read starter image selection: %w", err)
-	}
-
-	input = strings.TrimSpace(input)
-	choice, err := strconv.Atoi(input)
-	if err != nil || choice < 1 || choice > 5 {
-		return "", fmt.Errorf("invalid selection. Please choose 1-5")
+		return "", withPromptHint(err, "use --image")
 	}
 
-	selectedOption := options[choice-1]
+	selectedOption := options[choice]
 
 	if selectedOption == "custom" {
-		fmt.Print("Enter custom image URL: ")
-		customImage, err := reader.ReadString('\n')
+		customImage, err := prompt.Input("Enter custom image URL", "")
 		if err != nil {
-			return "", fmt.Errorf("failed to read custom image URL: %w", err)
+			return "", withPromptHint(err, "use --image=custom --base-image <image>")
 		}
-		customImage = strings.TrimSpace(customImage)
 		if customImage == "" {
 			return "", fmt.Errorf("custom image URL cannot be empty")
 		}
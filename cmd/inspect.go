@@ -0,0 +1,411 @@
+// Package cmd provides the inspect command for DevDrop.
+//
+// The inspect command shows everything known about an environment:
+// - Config metadata: base image, versions, ports, mounts, volumes and tools
+// - The local image: size, layers, creation date, platform, exposed ports and env
+// - The pushed image in the registry and whether the local image matches it
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	units "github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect [environment-name]",
+	Short: "Show detailed information about an environment",
+	Long: `Show detailed information about an environment, combining its DevDrop
+config with the local image and the image pushed to the registry:
+
+- Config: base image and digest, versions, ports, mounts, volumes, tools
+- Local image: ID, size, layers, creation date, platform, user, exposed
+  ports, environment variables and labels
+- Registry: the digest, size and platforms of the pushed latest tag, and
+  whether the local image is the same
+
+Use --no-remote to skip the registry lookup, e.g. when offline, and
+--layers to list every layer with the command that created it.
+
+Examples:
+  devdrop inspect                 # The current environment
+  devdrop inspect go --layers     # Include the layer history
+  devdrop inspect go -o json      # Machine-readable output`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runInspect,
+}
+
+var (
+	inspectOutput   string
+	inspectNoRemote bool
+	inspectLayers   bool
+)
+
+func init() {
+	rootCmd.AddCommand(inspectCmd)
+	inspectCmd.Flags().StringVarP(&inspectOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	inspectCmd.Flags().BoolVar(&inspectNoRemote, "no-remote", false, "Don't look up the image in the registry")
+	inspectCmd.Flags().BoolVar(&inspectLayers, "layers", false, "List the image's layers (always included in json and yaml)")
+}
+
+// inspectedEnvironment is the output of 'devdrop inspect'
+type inspectedEnvironment struct {
+	Name            string            `json:"name" yaml:"name"`
+	Description     string            `json:"description,omitempty" yaml:"description,omitempty"`
+	Current         bool              `json:"current" yaml:"current"`
+	Favorite        bool              `json:"favorite" yaml:"favorite"`
+	Image           string            `json:"image,omitempty" yaml:"image,omitempty"`
+	Registry        string            `json:"registry" yaml:"registry"`
+	LocalOnly       bool              `json:"local_only,omitempty" yaml:"local_only,omitempty"`
+	BaseImage       string            `json:"base_image,omitempty" yaml:"base_image,omitempty"`
+	BaseImageDigest string            `json:"base_image_digest,omitempty" yaml:"base_image_digest,omitempty"`
+	Created         time.Time         `json:"created" yaml:"created"`
+	LastUpdated     time.Time         `json:"last_updated" yaml:"last_updated"`
+	LastUsed        *time.Time        `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+	LatestVersion   string            `json:"latest_version,omitempty" yaml:"latest_version,omitempty"`
+	Versions        []inspectVersion  `json:"versions,omitempty" yaml:"versions,omitempty"`
+	Ports           []string          `json:"ports,omitempty" yaml:"ports,omitempty"`
+	Mounts          []string          `json:"mounts,omitempty" yaml:"mounts,omitempty"`
+	Volumes         []string          `json:"volumes,omitempty" yaml:"volumes,omitempty"`
+	MountMode       string            `json:"mount_mode,omitempty" yaml:"mount_mode,omitempty"`
+	WorkspacePath   string            `json:"workspace_path,omitempty" yaml:"workspace_path,omitempty"`
+	DockerHost      string            `json:"docker_host,omitempty" yaml:"docker_host,omitempty"`
+	Tools           map[string]string `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Local           *inspectImage     `json:"local,omitempty" yaml:"local,omitempty"`
+	Remote          *inspectRemote    `json:"remote,omitempty" yaml:"remote,omitempty"`
+	// RemoteError explains why the registry couldn't be queried
+	RemoteError string `json:"remote_error,omitempty" yaml:"remote_error,omitempty"`
+}
+
+// inspectVersion is a committed version and whether it is available locally
+type inspectVersion struct {
+	Tag       string    `json:"tag" yaml:"tag"`
+	Created   time.Time `json:"created" yaml:"created"`
+	Platforms []string  `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	Local     bool      `json:"local" yaml:"local"`
+}
+
+// inspectImage is the local image of an environment
+type inspectImage struct {
+	Reference    string            `json:"reference" yaml:"reference"`
+	ID           string            `json:"id" yaml:"id"`
+	Digest       string            `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Created      time.Time         `json:"created" yaml:"created"`
+	Size         int64             `json:"size" yaml:"size"`
+	Platform     string            `json:"platform" yaml:"platform"`
+	Author       string            `json:"author,omitempty" yaml:"author,omitempty"`
+	User         string            `json:"user,omitempty" yaml:"user,omitempty"`
+	WorkingDir   string            `json:"working_dir,omitempty" yaml:"working_dir,omitempty"`
+	Cmd          []string          `json:"cmd,omitempty" yaml:"cmd,omitempty"`
+	ExposedPorts []string          `json:"exposed_ports,omitempty" yaml:"exposed_ports,omitempty"`
+	Env          []string          `json:"env,omitempty" yaml:"env,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Layers       []inspectLayer    `json:"layers" yaml:"layers"`
+}
+
+// inspectLayer is a step of an image's history
+type inspectLayer struct {
+	Created   time.Time `json:"created" yaml:"created"`
+	CreatedBy string    `json:"created_by" yaml:"created_by"`
+	Size      int64     `json:"size" yaml:"size"`
+}
+
+// inspectRemote is the pushed latest tag of an environment
+type inspectRemote struct {
+	Reference string   `json:"reference" yaml:"reference"`
+	Digest    string   `json:"digest" yaml:"digest"`
+	MediaType string   `json:"media_type" yaml:"media_type"`
+	Size      int64    `json:"size" yaml:"size"`
+	Platforms []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	// UpToDate reports whether the local image was pulled or pushed with
+	// this digest; nil when there is no local image
+	UpToDate *bool `json:"up_to_date,omitempty" yaml:"up_to_date,omitempty"`
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(inspectOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	inspected, err := inspectEnvironment(dockerClient, cfg, targetEnv, env)
+	if err != nil {
+		return err
+	}
+
+	if inspectOutput != output.FormatText {
+		return output.Render(os.Stdout, inspectOutput, inspected)
+	}
+	printInspectedEnvironment(inspected)
+	return nil
+}
+
+// inspectEnvironment gathers the config, local image and registry
+// information of an environment
+func inspectEnvironment(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment) (*inspectedEnvironment, error) {
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	inspected := &inspectedEnvironment{
+		Name:            targetEnv,
+		Description:     env.Description,
+		Current:         cfg.GetCurrentEnvironment() == targetEnv,
+		Favorite:        env.Favorite,
+		Image:           imageName,
+		Registry:        registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)),
+		LocalOnly:       env.LocalOnly,
+		BaseImage:       env.BaseImage,
+		BaseImageDigest: env.BaseImageDigest,
+		Created:         env.Created,
+		LastUpdated:     env.LastUpdated,
+		LastUsed:        optionalTime(env.LastUsed),
+		LatestVersion:   env.LatestVersion,
+		Ports:           env.Ports,
+		Mounts:          env.Mounts,
+		Volumes:         env.Volumes,
+		MountMode:       env.MountMode,
+		WorkspacePath:   env.WorkspacePath,
+		DockerHost:      env.DockerHost,
+		Tools:           env.Tools,
+	}
+
+	for _, v := range env.Versions {
+		inspected.Versions = append(inspected.Versions, inspectVersion{
+			Tag:       v.Tag,
+			Created:   v.Created,
+			Platforms: v.Platforms,
+			Local:     dockerClient.ImageExists(cfg.GetEnvironmentImageRef(targetEnv, v.Tag)),
+		})
+	}
+
+	if imageName == "" {
+		return inspected, nil
+	}
+
+	var local docker.ImageInfo
+	if dockerClient.ImageExists(imageName) {
+		details, err := dockerClient.InspectImageDetails(imageName)
+		if err != nil {
+			return nil, err
+		}
+		local = docker.ImageInfo{ID: details.ID, RepoDigests: details.RepoDigests}
+		inspected.Local = newInspectImage(imageName, details, local.RepoDigest(imageName))
+	}
+
+	if inspectNoRemote || env.LocalOnly {
+		return inspected, nil
+	}
+	manifest, err := dockerClient.RemoteManifest(imageName, environmentAuthToken(cfg, targetEnv))
+	if err != nil {
+		inspected.RemoteError = err.Error()
+		return inspected, nil
+	}
+	inspected.Remote = &inspectRemote{
+		Reference: imageName,
+		Digest:    manifest.Digest,
+		MediaType: manifest.MediaType,
+		Size:      manifest.Size,
+		Platforms: manifest.Platforms,
+	}
+	if inspected.Local != nil {
+		upToDate := local.HasRepoDigest(imageName, manifest.Digest)
+		inspected.Remote.UpToDate = &upToDate
+	}
+	return inspected, nil
+}
+
+func newInspectImage(reference string, details docker.ImageDetails, digest string) *inspectImage {
+	image := &inspectImage{
+		Reference:    reference,
+		ID:           details.ID,
+		Digest:       digest,
+		Created:      details.Created,
+		Size:         details.Size,
+		Platform:     details.Platform,
+		Author:       details.Author,
+		User:         details.User,
+		WorkingDir:   details.WorkingDir,
+		Cmd:          append(append([]string{}, details.Entrypoint...), details.Cmd...),
+		ExposedPorts: details.ExposedPorts,
+		Env:          details.Env,
+		Labels:       details.Labels,
+	}
+	for _, layer := range details.Layers {
+		image.Layers = append(image.Layers, inspectLayer{Created: layer.Created, CreatedBy: layer.CreatedBy, Size: layer.Size})
+	}
+	return image
+}
+
+func printInspectedEnvironment(e *inspectedEnvironment) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	row := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s:\t%s\n", label, value)
+		}
+	}
+
+	name := e.Name
+	var marks []string
+	if e.Current {
+		marks = append(marks, "current")
+	}
+	if e.Favorite {
+		marks = append(marks, "favorite")
+	}
+	if len(marks) > 0 {
+		name += " (" + strings.Join(marks, ", ") + ")"
+	}
+	row("Environment", name)
+	row("Description", e.Description)
+	row("Image", e.Image)
+	if e.LocalOnly {
+		row("Registry", "none (local-only, never pushed)")
+	} else {
+		row("Registry", e.Registry)
+	}
+	row("Base image", e.BaseImage)
+	row("Base digest", e.BaseImageDigest)
+	row("Created", output.TimestampWithAge(e.Created))
+	row("Last updated", output.TimestampWithAge(e.LastUpdated))
+	if e.LastUsed != nil {
+		row("Last used", output.TimestampWithAge(*e.LastUsed))
+	}
+	row("Ports", strings.Join(e.Ports, ", "))
+	row("Mounts", strings.Join(e.Mounts, ", "))
+	row("Volumes", strings.Join(e.Volumes, ", "))
+	row("Mount mode", e.MountMode)
+	row("Workspace path", e.WorkspacePath)
+	row("Docker host", e.DockerHost)
+	if len(e.Tools) > 0 {
+		tools := make([]string, 0, len(e.Tools))
+		for tool, version := range e.Tools {
+			tools = append(tools, tool+" "+version)
+		}
+		sort.Strings(tools)
+		row("Tools", strings.Join(tools, ", "))
+	}
+	if len(e.Versions) > 0 {
+		versions := make([]string, 0, len(e.Versions))
+		for i := len(e.Versions) - 1; i >= 0; i-- {
+			v := e.Versions[i]
+			tag := v.Tag
+			if v.Tag == e.LatestVersion {
+				tag += "*"
+			}
+			if !v.Local {
+				tag += " (not local)"
+			}
+			versions = append(versions, tag)
+		}
+		row("Versions", strings.Join(versions, ", "))
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Local image:")
+	if e.Local == nil {
+		fmt.Printf("  Not available locally. Run 'devdrop pull %s' to download it.\n", e.Name)
+	} else {
+		l := e.Local
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		row("  ID", shortID(l.ID))
+		row("  Digest", l.Digest)
+		row("  Created", output.TimestampWithAge(l.Created))
+		row("  Size", units.HumanSize(float64(l.Size)))
+		row("  Layers", fmt.Sprintf("%d", len(l.Layers)))
+		row("  Platform", l.Platform)
+		user := l.User
+		if user == "" {
+			user = "root"
+		}
+		row("  User", user)
+		row("  Working dir", l.WorkingDir)
+		row("  Command", strings.Join(l.Cmd, " "))
+		row("  Exposed ports", strings.Join(l.ExposedPorts, ", "))
+		w.Flush()
+		printInspectList("  Env", l.Env)
+		if len(l.Labels) > 0 {
+			labels := make([]string, 0, len(l.Labels))
+			for key, value := range l.Labels {
+				labels = append(labels, key+"="+value)
+			}
+			sort.Strings(labels)
+			printInspectList("  Labels", labels)
+		}
+		if inspectLayers {
+			printInspectLayers(l.Layers)
+		}
+	}
+
+	if inspectNoRemote || e.LocalOnly {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Registry:")
+	switch {
+	case e.Remote != nil:
+		r := e.Remote
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		row("  Digest", r.Digest)
+		row("  Manifest size", units.HumanSize(float64(r.Size)))
+		row("  Platforms", strings.Join(r.Platforms, ", "))
+		if r.UpToDate != nil {
+			status := "up to date"
+			if !*r.UpToDate {
+				status = fmt.Sprintf("differs from the local image (run 'devdrop pull %s' or 'devdrop commit %s')", e.Name, e.Name)
+			}
+			row("  Status", status)
+		}
+		w.Flush()
+	case e.RemoteError != "":
+		fmt.Printf("  Not available: %s\n", e.RemoteError)
+	default:
+		fmt.Println("  No registry login. Run 'devdrop login' to push environments.")
+	}
+}
+
+func printInspectList(label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", label)
+	for _, item := range items {
+		fmt.Printf("    %s\n", item)
+	}
+}
+
+func printInspectLayers(layers []inspectLayer) {
+	fmt.Println("  Layers (oldest first):")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, layer := range layers {
+		createdBy := strings.TrimPrefix(layer.CreatedBy, "/bin/sh -c #(nop) ")
+		createdBy = strings.TrimPrefix(createdBy, "/bin/sh -c ")
+		if len(createdBy) > 60 {
+			createdBy = createdBy[:57] + "..."
+		}
+		fmt.Fprintf(w, "    %s\t%s\t%s\n", units.HumanSize(float64(layer.Size)), output.Timestamp(layer.Created), createdBy)
+	}
+	w.Flush()
+}
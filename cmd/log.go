@@ -0,0 +1,111 @@
+// Package cmd provides the log command for DevDrop.
+//
+// The log command shows the changelog of an environment:
+// - Lists its committed versions, newest first, with their commit messages
+// - Marks the version latest points to
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var logCmd = &cobra.Command{
+	Use:   "log [environment-name]",
+	Short: "Show the commit messages of an environment's versions",
+	Long: `Show the changelog of an environment: its committed versions, newest first,
+with the message each was committed with ('devdrop commit -m'). The version
+latest points to is marked with *.
+
+Messages are kept in the environment's history in the config and in the
+devdrop.message label of each image, so 'docker inspect' shows them too.
+Versions committed without a message, and versions from before messages
+were recorded, show "(no message)".
+
+Examples:
+  devdrop log                # Changelog of the current environment
+  devdrop log myenv -n 5     # The last five versions of devdrop-myenv
+  devdrop log myenv -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runLog,
+}
+
+var (
+	logMaxCount int
+	logOutput   string
+)
+
+func init() {
+	rootCmd.AddCommand(logCmd)
+	logCmd.Flags().IntVarP(&logMaxCount, "max-count", "n", 0, "Show only the newest n versions")
+	logCmd.Flags().StringVarP(&logOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// logEntry is a version as listed by 'devdrop log'
+type logEntry struct {
+	Version string    `json:"version" yaml:"version"`
+	Created time.Time `json:"created" yaml:"created"`
+	Message string    `json:"message" yaml:"message"`
+	Latest  bool      `json:"latest" yaml:"latest"`
+}
+
+func runLog(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(logOutput); err != nil {
+		return err
+	}
+	if logMaxCount < 0 {
+		return &usageError{err: fmt.Errorf("--max-count can't be negative, got %d", logMaxCount)}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	entries := make([]logEntry, 0, len(env.Versions))
+	for i := len(env.Versions) - 1; i >= 0; i-- {
+		if logMaxCount > 0 && len(entries) == logMaxCount {
+			break
+		}
+		v := env.Versions[i]
+		entries = append(entries, logEntry{
+			Version: v.Tag,
+			Created: v.Created,
+			Message: v.Message,
+			Latest:  v.Tag == env.LatestVersion,
+		})
+	}
+
+	if logOutput != output.FormatText {
+		return output.Render(os.Stdout, logOutput, entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Printf("No versions yet. Run 'devdrop commit %s -m \"...\"' to create one.\n", targetEnv)
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, entry := range entries {
+		marker := " "
+		if entry.Latest {
+			marker = "*"
+		}
+		message := entry.Message
+		if message == "" {
+			message = "(no message)"
+		}
+		fmt.Fprintf(w, "%s %s\t%s\t%s\n", marker, entry.Version, output.Timestamp(entry.Created), message)
+	}
+	return w.Flush()
+}
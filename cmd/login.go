@@ -4,24 +4,22 @@
 // - Prompts user for DockerHub username and password
 // - Authenticates with Docker registry using Docker SDK
 // - Stores credentials securely using Docker's credential store
-// - Updates ~/.devdrop/config.yaml with username for image naming
+// - Updates ~/.config/devdrop/config.yaml with username for image naming
 package cmd
 
 import (
-	"bufio"
 	"context"
-	"encoding/base64"
-	"encoding/json"
 	"fmt"
 	"os"
-	"strings"
-	"syscall"
+	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/oysteinje/devdrop/pkg/auth"
 	"github.com/oysteinje/devdrop/pkg/config"
-	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/credentials"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/registry"
 	"github.com/spf13/cobra"
-	"golang.org/x/term"
 )
 
 var loginCmd = &cobra.Command{
@@ -31,43 +29,93 @@ var loginCmd = &cobra.Command{
 pushing and pulling of personal development environment images.
 
 This will prompt for your DockerHub username and password, then store
-the credentials securely using Docker's credential helper.`,
+the credentials in your OS keychain through a Docker credential helper
+(osxkeychain, wincred, secretservice or pass). The helper configured as
+credsStore for the Docker CLI is used when set. Without a helper the
+credentials are stored in ~/.config/devdrop/config.yaml and a warning is shown;
+they are moved to a helper the next time the config is saved after one is
+installed. Set credential_store in the config to "file" or to a helper name
+to override the automatic choice. On DockerHub the credentials also sign in
+to the Hub API, so 'devdrop ls' and 'devdrop pull' list your private
+repositories.
+
+Use --registry to store environments in another OCI registry such as
+GitHub Container Registry, GitLab or a private Harbor instance. The
+registry you log in to last becomes the default for new environments.
+The registry type used to list your environments is detected from the
+host and can be overridden with --registry-type.
+
+Use --web to log in to DockerHub through your browser. You confirm a short
+code on login.docker.com, so your password never touches the terminal and
+SSO-backed accounts work too. The access token is renewed with the refresh
+token of the login shortly before it runs out, so you stay logged in.
+
+Examples:
+  devdrop login                                  # DockerHub
+  devdrop login --web                            # DockerHub via the browser
+  devdrop login --registry ghcr.io               # GitHub (use a personal access token)
+  devdrop login --registry harbor.example.com --registry-type harbor`,
 	RunE: runLogin,
 }
 
+var (
+	loginRegistry     string
+	loginRegistryType string
+	loginWeb          bool
+)
+
 func init() {
 	rootCmd.AddCommand(loginCmd)
+	loginCmd.Flags().StringVar(&loginRegistry, "registry", "", "Registry host to log in to (default DockerHub)")
+	loginCmd.Flags().BoolVar(&loginWeb, "web", false, "Log in to DockerHub through the browser instead of typing a password")
+	loginCmd.Flags().StringVar(&loginRegistryType, "registry-type", "", "Registry type for listing environments (dockerhub, ghcr, gitlab, harbor, oci)")
 }
 
 func runLogin(cmd *cobra.Command, args []string) error {
+	if err := registry.ValidateType(loginRegistryType); err != nil {
+		return err
+	}
+	host := registry.NormalizeHost(loginRegistry)
+
+	if loginWeb {
+		if !registry.IsDockerHub(host) {
+			return fmt.Errorf("--web is only supported for DockerHub")
+		}
+		username, token, err := webLogin()
+		if err != nil {
+			return err
+		}
+		login := config.RegistryLogin{
+			Username:     username,
+			Type:         loginRegistryType,
+			RefreshToken: token.RefreshToken,
+			Expires:      tokenExpiry(token),
+		}
+		return storeLogin(host, login, token.AccessToken)
+	}
+
 	// Create Docker client
-	dockerClient, err := docker.NewClient()
+	dockerClient, err := newDockerClient()
 	if err != nil {
 		return fmt.Errorf("failed to connect to Docker: %w", err)
 	}
 	defer dockerClient.Close()
 
 	// Get username
-	fmt.Print("Username: ")
-	reader := bufio.NewReader(os.Stdin)
-	username, err := reader.ReadString('\n')
+	username, err := prompt.Input("Username", "")
 	if err != nil {
-		return fmt.Errorf("failed to read username: %w", err)
+		return withPromptHint(err, "run 'devdrop login' from a terminal")
 	}
-	username = strings.TrimSpace(username)
 
 	if username == "" {
 		return fmt.Errorf("username cannot be empty")
 	}
 
 	// Get password (hidden input)
-	fmt.Print("Password: ")
-	passwordBytes, err := term.ReadPassword(int(syscall.Stdin))
+	password, err := prompt.Password("Password")
 	if err != nil {
-		return fmt.Errorf("failed to read password: %w", err)
+		return withPromptHint(err, "run 'devdrop login' from a terminal")
 	}
-	fmt.Println() // Add newline after hidden password input
-	password := string(passwordBytes)
 
 	if password == "" {
 		return fmt.Errorf("password cannot be empty")
@@ -76,8 +124,9 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	// Authenticate with Docker registry
 	ctx := context.Background()
 	authConfig := types.AuthConfig{
-		Username: username,
-		Password: password,
+		Username:      username,
+		Password:      password,
+		ServerAddress: registry.ServerAddress(host),
 	}
 
 	response, err := dockerClient.RegistryLogin(ctx, authConfig)
@@ -86,10 +135,21 @@ func runLogin(cmd *cobra.Command, args []string) error {
 	}
 
 	fmt.Printf("Login successful! %s\n", response.Status)
-	fmt.Printf("Logged in as: %s\n", username)
+	fmt.Printf("Logged in to %s as: %s\n", registryDisplayName(host), username)
+
+	return saveLogin(host, username, password)
+}
+
+// saveLogin stores the credentials for host in the DevDrop configuration
+func saveLogin(host, username, password string) error {
+	return storeLogin(host, config.RegistryLogin{Username: username, Type: loginRegistryType}, password)
+}
 
+// storeLogin stores a login for host with its secret in the DevDrop
+// configuration, keeping the secret in a credential helper when possible
+func storeLogin(host string, login config.RegistryLogin, password string) error {
 	// Create auth token for push operations
-	authToken, err := createAuthToken(username, password)
+	authToken, err := registry.EncodeAuth(host, registry.Credentials{Username: login.Username, Password: password})
 	if err != nil {
 		return fmt.Errorf("failed to create auth token: %w", err)
 	}
@@ -100,31 +160,142 @@ func runLogin(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	if err := cfg.SetUsername(username); err != nil {
-		return fmt.Errorf("failed to save username to config: %w", err)
+	// Prefer the OS keychain over plaintext in config.yaml
+	if store := credentials.Default(cfg.CredentialStore); store != nil {
+		if login, err = config.StoreSecrets(store, host, login, password); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
 	}
 
-	if err := cfg.SetAuthToken(authToken); err != nil {
-		return fmt.Errorf("failed to save auth token to config: %w", err)
+	if login.CredentialStore == "" {
+		login.AuthToken = authToken
+	}
+	if err := cfg.SetRegistryLogin(host, login); err != nil {
+		return fmt.Errorf("failed to save credentials to config: %w", err)
 	}
 
-	fmt.Println("Authentication credentials saved to DevDrop configuration.")
+	if login.CredentialStore != "" {
+		fmt.Printf("Authentication credentials saved to docker-credential-%s.\n", login.CredentialStore)
+	} else {
+		configPath, _ := config.GetConfigPath()
+		fmt.Printf("Warning: no credential helper found, credentials are stored unencrypted in %s.\n", configPath)
+		fmt.Println("Install a Docker credential helper (osxkeychain, wincred, secretservice or pass) and they are moved to your keychain the next time devdrop saves its config.")
+	}
 
 	return nil
 }
 
-// createAuthToken creates a base64-encoded auth token for Docker registry operations
-func createAuthToken(username, password string) (string, error) {
-	authConfig := map[string]string{
-		"username":      username,
-		"password":      password,
-		"serveraddress": "https://index.docker.io/v1/",
+// webLogin runs the DockerHub device authorization flow and returns the
+// username and the token whose access token is used as password
+func webLogin() (string, *auth.Token, error) {
+	flow, err := auth.NewDockerHubDeviceFlow()
+	if err != nil {
+		return "", nil, err
+	}
+	code, err := flow.Start()
+	if err != nil {
+		return "", nil, err
+	}
+
+	verificationURL := code.VerificationURIComplete
+	if verificationURL == "" {
+		verificationURL = code.VerificationURI
+	}
+
+	fmt.Printf("Your one-time device confirmation code is: %s\n", code.UserCode)
+	fmt.Printf("Open %s in your browser and confirm the code to log in.\n", verificationURL)
+	if err := auth.OpenBrowser(verificationURL); err != nil {
+		fmt.Println("Could not open a browser automatically, please open the link manually.")
 	}
+	fmt.Println()
+	fmt.Println("Waiting for confirmation...")
 
-	authConfigJSON, err := json.Marshal(authConfig)
+	token, err := flow.Wait(code)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal auth config: %w", err)
+		return "", nil, err
 	}
 
-	return base64.StdEncoding.EncodeToString(authConfigJSON), nil
+	username, err := auth.DockerHubUsername(token.AccessToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	fmt.Println("Login successful!")
+	fmt.Printf("Logged in to DockerHub as: %s\n", username)
+
+	return username, token, nil
+}
+
+// refreshMargin is how long before it runs out the access token of a web
+// login is renewed
+const refreshMargin = 5 * time.Minute
+
+// tokenExpiry returns when an access token runs out, or the zero time when
+// the login service didn't say
+func tokenExpiry(token *auth.Token) time.Time {
+	if token.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+}
+
+// refreshWebLogins renews the access tokens of web logins that run out
+// soon, so the registry doesn't reject them partway through a command.
+// Failures are only warned about; the command goes on with the old token.
+func refreshWebLogins() {
+	cfg, err := config.Load()
+	if err != nil {
+		return
+	}
+
+	// Only logins due for renewal have their secrets looked up, as asking a
+	// credential helper may prompt for the keychain
+	for host, stored := range cfg.Registries {
+		if stored.Expires.IsZero() || time.Until(stored.Expires) > refreshMargin {
+			continue
+		}
+		if stored.RefreshToken == "" && stored.CredentialStore == "" {
+			continue
+		}
+		login := cfg.GetRegistryLogin(host)
+		if err := refreshWebLogin(cfg, host, login); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: failed to renew the login to %s: %v\n", registryDisplayName(host), err)
+		}
+	}
+}
+
+// refreshWebLogin trades the refresh token of a web login for a new access
+// token and stores both where the login keeps its secrets
+func refreshWebLogin(cfg *config.Config, host string, login config.RegistryLogin) error {
+	if login.RefreshToken == "" {
+		return auth.ErrRefreshRejected
+	}
+	flow, err := auth.NewDockerHubDeviceFlow()
+	if err != nil {
+		return err
+	}
+	token, err := flow.Refresh(login.RefreshToken)
+	if err != nil {
+		return err
+	}
+	if token.RefreshToken != "" {
+		login.RefreshToken = token.RefreshToken
+	}
+	login.Expires = tokenExpiry(token)
+
+	if login.CredentialStore != "" {
+		store := credentials.ForName(login.CredentialStore)
+		if store == nil {
+			return fmt.Errorf("docker-credential-%s is not installed", login.CredentialStore)
+		}
+		if login, err = config.StoreSecrets(store, host, login, token.AccessToken); err != nil {
+			return err
+		}
+	} else {
+		login.AuthToken, err = registry.EncodeAuth(host, registry.Credentials{Username: login.Username, Password: token.AccessToken})
+		if err != nil {
+			return fmt.Errorf("failed to create auth token: %w", err)
+		}
+	}
+	return cfg.ReplaceRegistryLogin(host, login)
 }
@@ -3,13 +3,19 @@
 // The ls command lists available environments:
 // - Local environments from config
 // - Remote devdrop-* images from DockerHub registry
+// - Whether each local image is in sync with the one in its registry
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/oysteinje/devdrop/pkg/config"
 	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/registry"
 	"github.com/spf13/cobra"
 )
 
@@ -17,93 +23,282 @@ var lsCmd = &cobra.Command{
 	Use:   "ls",
 	Short: "List available development environments",
 	Long: `List all available development environments, showing both local
-configurations and remote images available on DockerHub.
+configurations and remote images available in your registry.
 
 This command displays:
-- Local environments (configured in ~/.devdrop/config.yaml)
-- Remote devdrop-* images available for pull from DockerHub
+- Local environments (configured in ~/.config/devdrop/config.yaml)
+- Remote devdrop-* images available for pull from your default registry,
+  private ones included (DevDrop signs in to the Docker Hub API with your
+  stored credentials)
 - Current active environment (marked with *)
+- Favorite environments (marked with "favorite")
+- The sync state of each local environment: in sync, local ahead (commits
+  not pushed), remote ahead (newer image pushed from elsewhere), diverged,
+  local only or remote only. It compares the layers of the local image with
+  the latest tag in the registry; --local-only skips the check.
+
+Docker Hub listings are cached for registry_cache_ttl (5m by default) and
+revalidated after that. When Docker Hub's rate limit is reached, the last
+cached listing is shown with a warning.
 
 Examples:
   devdrop ls                    # List all environments
+  devdrop ls --favorites        # Show only favorite environments
+  devdrop ls --sort used        # Most recently used first
   devdrop ls --remote-only      # Show only remote images
-  devdrop ls --local-only       # Show only local environments`,
+  devdrop ls --local-only       # Show only local environments
+  devdrop ls --system           # Approved environments of this machine
+  devdrop ls -o json            # Machine-readable output for scripts`,
 	RunE: runLs,
 }
 
 var (
-	remoteOnly bool
-	localOnly  bool
+	remoteOnly    bool
+	localOnly     bool
+	favoritesOnly bool
+	lsSystem      bool
+	sortBy        string
+	lsOutput      string
 )
 
 func init() {
 	rootCmd.AddCommand(lsCmd)
 	lsCmd.Flags().BoolVar(&remoteOnly, "remote-only", false, "Show only remote images")
 	lsCmd.Flags().BoolVar(&localOnly, "local-only", false, "Show only local environments")
+	lsCmd.Flags().StringVar(&sortBy, "sort", "", "Sort local environments by name, created, updated or used (default from config sort_by, or name)")
+	lsCmd.Flags().BoolVar(&lsSystem, "system", false, "Show the system catalog of approved environments instead")
+	lsCmd.Flags().BoolVar(&favoritesOnly, "favorites", false, "Show only favorite environments (implies --local-only)")
+	lsCmd.Flags().StringVarP(&lsOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// lsResult is the data shown by ls, rendered as text, JSON or YAML
+type lsResult struct {
+	Current        string          `json:"current,omitempty" yaml:"current,omitempty"`
+	Local          []lsEnvironment `json:"local,omitempty" yaml:"local,omitempty"`
+	Remote         []lsRemote      `json:"remote,omitempty" yaml:"remote,omitempty"`
+	RemoteRegistry string          `json:"remote_registry,omitempty" yaml:"remote_registry,omitempty"`
+	RemoteError    string          `json:"remote_error,omitempty" yaml:"remote_error,omitempty"`
+	// RemoteStale explains why Remote was taken from the cache
+	RemoteStale string `json:"remote_stale,omitempty" yaml:"remote_stale,omitempty"`
+
+	showLocal  bool
+	showRemote bool
+}
+
+// lsEnvironment is a locally configured environment
+type lsEnvironment struct {
+	Name          string     `json:"name" yaml:"name"`
+	Current       bool       `json:"current" yaml:"current"`
+	Favorite      bool       `json:"favorite" yaml:"favorite"`
+	Image         string     `json:"image" yaml:"image"`
+	BaseImage     string     `json:"base_image" yaml:"base_image"`
+	Registry      string     `json:"registry" yaml:"registry"`
+	LatestVersion string     `json:"latest_version,omitempty" yaml:"latest_version,omitempty"`
+	Container     string     `json:"container,omitempty" yaml:"container,omitempty"`
+	Created       time.Time  `json:"created" yaml:"created"`
+	LastUpdated   *time.Time `json:"last_updated,omitempty" yaml:"last_updated,omitempty"`
+	LastUsed      *time.Time `json:"last_used,omitempty" yaml:"last_used,omitempty"`
+	// Sync compares the local image with the one in the registry; unset
+	// with --local-only
+	Sync *syncStatus `json:"sync,omitempty" yaml:"sync,omitempty"`
+}
+
+// lsRemote is an environment found in the registry
+type lsRemote struct {
+	Name       string `json:"name" yaml:"name"`
+	Configured bool   `json:"configured" yaml:"configured"`
 }
 
 func runLs(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(lsOutput); err != nil {
+		return err
+	}
+
+	if lsSystem {
+		return printCatalog(lsOutput)
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
 	if cfg.Username == "" {
-		return fmt.Errorf("not logged in. Please run 'devdrop login' first")
+		return errLoginRequired
 	}
 
-	currentEnv := cfg.GetCurrentEnvironment()
+	if sortBy == "" {
+		sortBy = cfg.SortBy
+	}
+	if err := config.ValidateSortKey(sortBy); err != nil {
+		return err
+	}
 
-	// Show local environments
-	if !remoteOnly {
-		fmt.Println("Local Environments:")
-		if len(cfg.Environments) == 0 {
-			fmt.Println("  (none configured)")
-		} else {
-			for name, env := range cfg.Environments {
-				marker := " "
-				if name == currentEnv {
-					marker = "*"
-				}
-				fmt.Printf("  %s %s\n", marker, name)
-				fmt.Printf("    Base: %s\n", env.BaseImage)
-				fmt.Printf("    Created: %s\n", env.Created.Format("2006-01-02 15:04"))
-				if !env.LastUpdated.IsZero() {
-					fmt.Printf("    Updated: %s\n", env.LastUpdated.Format("2006-01-02 15:04"))
-				}
-				fmt.Println()
+	// Favorites are a local concept, remote images can't be marked
+	if favoritesOnly {
+		localOnly = true
+	}
+
+	// Query the registry in the background so local environments can be
+	// shown without waiting on the network
+	var remote *remotePrefetch
+	if !localOnly {
+		remote = prefetchRemoteEnvironments(cfg)
+	}
+
+	result := buildLsResult(cfg)
+	if !localOnly {
+		result.addSync(cfg)
+	}
+	if lsOutput != output.FormatText {
+		result.addRemote(cfg, remote)
+		return output.Render(os.Stdout, lsOutput, result)
+	}
+
+	printLsLocal(cfg, result)
+	result.addRemote(cfg, remote)
+	printLsRemote(result)
+	return nil
+}
+
+// buildLsResult collects the local environments according to the flags;
+// remote environments are added by addRemote
+func buildLsResult(cfg *config.Config) lsResult {
+	result := lsResult{
+		Current:    cfg.GetCurrentEnvironment(),
+		showLocal:  !remoteOnly,
+		showRemote: !localOnly,
+	}
+
+	if result.showLocal {
+		for _, name := range cfg.SortedEnvironmentNames(sortBy) {
+			env := cfg.Environments[name]
+			if favoritesOnly && !env.Favorite {
+				continue
+			}
+
+			local := lsEnvironment{
+				Name:          name,
+				Current:       name == result.Current,
+				Favorite:      env.Favorite,
+				Image:         cfg.GetEnvironmentImageName(name),
+				BaseImage:     env.BaseImage,
+				Registry:      cfg.GetEnvironmentRegistry(name),
+				LatestVersion: env.LatestVersion,
+				Container:     env.LastContainer,
+				Created:       env.Created,
+				LastUpdated:   optionalTime(env.LastUpdated),
+				LastUsed:      optionalTime(env.LastUsed),
 			}
+			result.Local = append(result.Local, local)
 		}
 	}
 
-	// Show remote environments
-	if !localOnly {
-		dockerClient, err := docker.NewClient()
-		if err != nil {
-			return fmt.Errorf("failed to connect to Docker: %w", err)
+	return result
+}
+
+// addRemote waits for the remote environments and merges them into the result
+func (r *lsResult) addRemote(cfg *config.Config, remote *remotePrefetch) {
+	if !r.showRemote {
+		return
+	}
+
+	r.RemoteRegistry = registry.NormalizeHost(cfg.Registry)
+	remoteImages, err := remote.Wait()
+	var stale *registry.StaleError
+	if errors.As(err, &stale) {
+		r.RemoteStale = stale.Error()
+	} else if err != nil {
+		r.RemoteError = err.Error()
+		return
+	}
+
+	for _, image := range remoteImages {
+		_, configured := cfg.Environments[image]
+		r.Remote = append(r.Remote, lsRemote{Name: image, Configured: configured})
+	}
+}
+
+// addSync compares the local environments with their registries
+func (r *lsResult) addSync(cfg *config.Config) {
+	if len(r.Local) == 0 {
+		return
+	}
+
+	// Without Docker the local side is unknown, which the states report
+	var dockerClient *docker.Client
+	if c, err := newDockerClient(); err == nil {
+		dockerClient = c
+		defer c.Close()
+	}
+
+	names := make([]string, len(r.Local))
+	for i, env := range r.Local {
+		names[i] = env.Name
+	}
+	statuses := environmentSyncStatuses(dockerClient, cfg, names)
+	for i := range r.Local {
+		status := statuses[r.Local[i].Name]
+		r.Local[i].Sync = &status
+	}
+}
+
+// printLsLocal renders the local part of the ls result as text
+func printLsLocal(cfg *config.Config, result lsResult) {
+	if result.showLocal {
+		fmt.Println("Local Environments:")
+		if len(result.Local) == 0 {
+			if favoritesOnly {
+				fmt.Println("  (no favorites, mark one with 'devdrop favorite <env>')")
+			} else {
+				fmt.Println("  (none configured)")
+			}
+		}
+		for _, env := range result.Local {
+			marker := " "
+			if env.Current {
+				marker = "*"
+			}
+			favorite := ""
+			if env.Favorite {
+				favorite = " (favorite)"
+			}
+			fmt.Printf("  %s %s%s\n", marker, env.Name, favorite)
+			fmt.Printf("    Base: %s\n", env.BaseImage)
+			fmt.Printf("    Created: %s\n", output.TimestampWithAge(env.Created))
+			if env.LastUpdated != nil {
+				fmt.Printf("    Updated: %s\n", output.TimestampWithAge(*env.LastUpdated))
+			}
+			if env.Sync != nil {
+				fmt.Printf("    Sync: %s\n", describeSync(cfg, env.Name, *env.Sync))
+			}
+			fmt.Println()
 		}
-		defer dockerClient.Close()
+	}
+}
 
-		fmt.Println("Remote Environments (DockerHub):")
-		remoteImages, err := dockerClient.ListDevDropRepositories(cfg.Username)
-		if err != nil {
-			fmt.Printf("  Error fetching remote images: %v\n", err)
-		} else if len(remoteImages) == 0 {
+// printLsRemote renders the remote part of the ls result as text
+func printLsRemote(result lsResult) {
+	if result.showRemote {
+		fmt.Printf("Remote Environments (%s):\n", registryDisplayName(result.RemoteRegistry))
+		if result.RemoteStale != "" {
+			fmt.Printf("  Warning: %s\n", result.RemoteStale)
+		}
+		if result.RemoteError != "" {
+			fmt.Printf("  Error fetching remote images: %s\n", result.RemoteError)
+		} else if len(result.Remote) == 0 {
 			fmt.Println("  (no devdrop- images found)")
-		} else {
-			for _, image := range remoteImages {
-				localStatus := "not pulled"
-				if _, exists := cfg.Environments[image]; exists {
-					localStatus = "configured locally"
-				}
-				fmt.Printf("  %s (%s)\n", image, localStatus)
+		}
+		for _, remote := range result.Remote {
+			localStatus := "not pulled"
+			if remote.Configured {
+				localStatus = "configured locally"
 			}
+			fmt.Printf("  %s (%s)\n", remote.Name, localStatus)
 		}
 	}
 
-	if currentEnv != "" && !remoteOnly {
-		fmt.Printf("\nCurrent environment: %s\n", currentEnv)
+	if result.Current != "" && result.showLocal {
+		fmt.Printf("\nCurrent environment: %s\n", result.Current)
 	}
-
-	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,164 @@
+// Package cmd provides the map command for DevDrop.
+//
+// The map command manages directory to environment mappings:
+// - Binds directories or glob patterns to environments
+// - Lists mappings and shows which one applies to the current directory
+// - Removes mappings
+package cmd
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/spf13/cobra"
+)
+
+var mapCmd = &cobra.Command{
+	Use:   "map",
+	Short: "Map directories to environments",
+	Long: `Map directories to environments, so commands run without an environment
+name (run, commit, history, ...) use the mapped environment instead of the
+current one.
+
+A mapping applies to its directory and everything below it. Mappings can be
+nested: the mapping of the closest ancestor wins, so a monorepo can map its
+root to one environment and individual subtrees to others. Paths may be
+glob patterns (*, ?, [...]) matching single path components.
+
+Examples:
+  devdrop map set node                          # Map the current directory to devdrop-node
+  devdrop map set ~/mono go                     # Map a monorepo to devdrop-go
+  devdrop map set '~/mono/services/web-*' node  # ...except its web services
+  devdrop map ls                                # Show mappings; * marks the active one
+  devdrop map rm ~/mono                         # Remove a mapping`,
+}
+
+var mapLsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List directory mappings",
+	Args:  cobra.NoArgs,
+	RunE:  runMapLs,
+}
+
+var mapSetCmd = &cobra.Command{
+	Use:   "set [path] <environment-name>",
+	Short: "Map a directory or glob pattern to an environment",
+	Long: `Map a directory or glob pattern to an environment. Without a path the
+current directory is mapped. Quote glob patterns so the shell doesn't expand
+them.`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: runMapSet,
+}
+
+var mapRmCmd = &cobra.Command{
+	Use:   "rm [path]",
+	Short: "Remove a directory mapping",
+	Long: `Remove the mapping for a directory or glob pattern, exactly as listed by
+'devdrop map ls'. Without a path the mapping of the current directory is
+removed.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runMapRm,
+}
+
+func init() {
+	rootCmd.AddCommand(mapCmd)
+	mapCmd.AddCommand(mapLsCmd, mapSetCmd, mapRmCmd)
+}
+
+func runMapLs(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if len(cfg.Mappings) == 0 {
+		fmt.Println("No directory mappings. Add one with 'devdrop map set <environment-name>'.")
+		return nil
+	}
+
+	active := ""
+	if dir, err := currentWorkspace(); err == nil {
+		active, _, _ = cfg.MappingFor(dir)
+	}
+
+	patterns := make([]string, 0, len(cfg.Mappings))
+	for pattern := range cfg.Mappings {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	fmt.Println("Directory mappings:")
+	for _, pattern := range patterns {
+		marker := " "
+		if pattern == active {
+			marker = "*"
+		}
+		envName := cfg.Mappings[pattern]
+		missing := ""
+		if _, exists := cfg.Environments[envName]; !exists {
+			missing = " (not configured locally)"
+		}
+		fmt.Printf("  %s %s -> %s%s\n", marker, pattern, envName, missing)
+	}
+
+	return nil
+}
+
+func runMapSet(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	path := "."
+	envArg := args[0]
+	if len(args) == 2 {
+		path, envArg = args[0], args[1]
+	}
+
+	pattern, err := expandPath(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+
+	envName := config.EnsureDevDropPrefix(envArg)
+	if _, exists := cfg.Environments[envName]; !exists {
+		return environmentNotFound(envName)
+	}
+
+	if err := cfg.SetMapping(pattern, envName); err != nil {
+		return fmt.Errorf("failed to save mapping: %w", err)
+	}
+
+	fmt.Printf("Mapped %s -> %s\n", pattern, envName)
+	return nil
+}
+
+func runMapRm(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	path := "."
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	pattern, err := expandPath(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+
+	removed, err := cfg.RemoveMapping(pattern)
+	if err != nil {
+		return fmt.Errorf("failed to remove mapping: %w", err)
+	}
+	if !removed {
+		return fmt.Errorf("no mapping for %s. Run 'devdrop map ls' to see mappings", pattern)
+	}
+
+	fmt.Printf("Removed mapping for %s\n", pattern)
+	return nil
+}
@@ -0,0 +1,239 @@
+// Package cmd provides the prune-remote command for DevDrop.
+//
+// The prune-remote command keeps registries from filling up with versions:
+// - Lists the version tags (v1, v2, ...) of an environment in its registry
+// - Deletes all but the newest --keep versions after confirmation
+// - Applies keep_remote_versions from the config after every commit
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/spf13/cobra"
+)
+
+var pruneRemoteCmd = &cobra.Command{
+	Use:   "prune-remote [environment-name]",
+	Short: "Delete old version tags of an environment from the registry",
+	Long: `Delete the old version tags of an environment from its registry, keeping
+the newest --keep versions. Every 'devdrop commit' pushes a new version tag
+(v1, v2, ...), so without pruning the registry keeps every image ever
+committed.
+
+The tags to delete are listed and confirmed first; with --dry-run they are
+only listed. The version latest points to is always kept, even after a
+rollback to an older version, and the platform variants of multi-arch
+versions go with their version. Pruned versions are dropped from the
+environment's history; local copies are left to 'devdrop clean'.
+
+Set keep_remote_versions in the config, or on an environment to override
+it, to prune automatically after every commit and to change the default of
+--keep:
+
+  keep_remote_versions: 5
+
+Only Docker Hub can delete tags through its API; personal access tokens
+need the Read, Write, Delete scope.
+
+Examples:
+  devdrop prune-remote --keep 5        # Keep the 5 newest versions
+  devdrop prune-remote --keep 5 --dry-run
+  devdrop prune-remote myenv --keep 3 -y`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runPruneRemote,
+}
+
+var (
+	pruneRemoteKeep   int
+	pruneRemoteDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(pruneRemoteCmd)
+	pruneRemoteCmd.Flags().IntVar(&pruneRemoteKeep, "keep", 0, "Number of newest versions to keep (default keep_remote_versions from the config)")
+	pruneRemoteCmd.Flags().BoolVar(&pruneRemoteDryRun, "dry-run", false, "Show which tags would be deleted without deleting them")
+}
+
+// remoteVersionTag matches version tags and the platform variants of
+// multi-arch versions, such as v3 and v3-linux-arm64-v8
+var remoteVersionTag = regexp.MustCompile(`^v(\d+)(-[a-z0-9]+-[a-z0-9]+(-[a-z0-9]+)?)?$`)
+
+// remotePrune is what pruning the registry of an environment deletes
+type remotePrune struct {
+	manager    registry.TagManager
+	namespace  string
+	repository string
+	// versions are the version tags dropped, oldest first
+	versions []string
+	// tags are all tags to delete, platform variants included
+	tags []string
+}
+
+func runPruneRemote(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+	if env.LocalOnly {
+		return fmt.Errorf("environment '%s' is local-only and has no versions in a registry", targetEnv)
+	}
+
+	keep := pruneRemoteKeep
+	if !cmd.Flags().Changed("keep") {
+		keep = cfg.GetKeepRemoteVersions(targetEnv)
+		if keep == 0 {
+			return &usageError{err: fmt.Errorf("say how many versions to keep with --keep, or set keep_remote_versions in the config")}
+		}
+	}
+	if keep < 1 {
+		return &usageError{err: fmt.Errorf("--keep must be at least 1, got %d", keep)}
+	}
+
+	fmt.Printf("Listing the tags of %s...\n", cfg.GetEnvironmentRepository(targetEnv))
+	prune, err := planRemotePrune(cfg, targetEnv, env, keep)
+	if err != nil {
+		return err
+	}
+	if len(prune.tags) == 0 {
+		fmt.Printf("Nothing to prune: %s has no more than %d versions in the registry.\n", targetEnv, keep)
+		return nil
+	}
+
+	fmt.Printf("Versions to delete from %s: %s\n", prune.repository, strings.Join(prune.versions, ", "))
+	if len(prune.tags) > len(prune.versions) {
+		fmt.Printf("Tags, including platform variants: %s\n", strings.Join(prune.tags, ", "))
+	}
+	if pruneRemoteDryRun {
+		fmt.Println("Would delete:")
+		for _, tag := range prune.tags {
+			fmt.Printf("  %s:%s\n", prune.repository, tag)
+		}
+		fmt.Printf("Would drop %s from the history of %s.\n", strings.Join(prune.versions, ", "), targetEnv)
+		fmt.Println("Dry run: nothing was deleted.")
+		return nil
+	}
+	ok, err := prompt.Confirm(fmt.Sprintf("Delete %d tag(s) from the registry? This can't be undone", len(prune.tags)), false)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Nothing was deleted.")
+		return nil
+	}
+
+	if err := applyRemotePrune(cfg, targetEnv, prune); err != nil {
+		return err
+	}
+	output.Successf("Pruned %d version(s) of %s, keeping the newest %d", len(prune.versions), targetEnv, keep)
+	return nil
+}
+
+// planRemotePrune lists the tags of an environment in its registry and
+// picks those of all but the newest keep versions. The version latest
+// points to is always kept.
+func planRemotePrune(cfg *config.Config, targetEnv string, env config.Environment, keep int) (remotePrune, error) {
+	host := cfg.GetEnvironmentRegistry(targetEnv)
+	login := cfg.GetRegistryLogin(host)
+
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil {
+		return remotePrune{}, err
+	}
+	backend, err := registry.New(host, login.Type, creds)
+	if err != nil {
+		return remotePrune{}, err
+	}
+	manager, ok := backend.(registry.TagManager)
+	if !ok {
+		return remotePrune{}, fmt.Errorf("deleting tags isn't supported for %s; remove old versions in the registry's web interface", host)
+	}
+
+	tags, err := manager.ListTags(login.Username, targetEnv)
+	if err != nil {
+		return remotePrune{}, fmt.Errorf("failed to list tags of %s: %w", targetEnv, err)
+	}
+
+	byVersion := make(map[int][]string)
+	for _, tag := range tags {
+		match := remoteVersionTag.FindStringSubmatch(tag.Name)
+		if match == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(match[1])
+		byVersion[n] = append(byVersion[n], tag.Name)
+	}
+	numbers := make([]int, 0, len(byVersion))
+	for n := range byVersion {
+		numbers = append(numbers, n)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(numbers)))
+
+	prune := remotePrune{
+		manager:    manager,
+		namespace:  login.Username,
+		repository: cfg.GetEnvironmentRepository(targetEnv),
+	}
+	for i := len(numbers) - 1; i >= keep; i-- {
+		version := fmt.Sprintf("v%d", numbers[i])
+		if version == env.LatestVersion {
+			continue
+		}
+		prune.versions = append(prune.versions, version)
+		sort.Strings(byVersion[numbers[i]])
+		prune.tags = append(prune.tags, byVersion[numbers[i]]...)
+	}
+	return prune, nil
+}
+
+// applyRemotePrune deletes the planned tags and drops the pruned versions
+// from the environment's history
+func applyRemotePrune(cfg *config.Config, targetEnv string, prune remotePrune) error {
+	for _, tag := range prune.tags {
+		if err := prune.manager.DeleteTag(prune.namespace, targetEnv, tag); err != nil {
+			return fmt.Errorf("failed to delete tag %s: %w", tag, err)
+		}
+		fmt.Printf("Deleted %s:%s\n", prune.repository, tag)
+	}
+	if err := cfg.RemoveVersions(targetEnv, prune.versions); err != nil {
+		return fmt.Errorf("failed to update configuration: %w", err)
+	}
+	return nil
+}
+
+// autoPruneRemote applies keep_remote_versions after a commit pushed a new
+// version. Setting it is the confirmation, so nothing is asked; failures
+// only warn since the commit itself succeeded.
+func autoPruneRemote(cfg *config.Config, targetEnv string) {
+	keep := cfg.GetKeepRemoteVersions(targetEnv)
+	if keep == 0 || cfg.IsLocalOnly(targetEnv) {
+		return
+	}
+	prune, err := planRemotePrune(cfg, targetEnv, cfg.Environments[targetEnv], keep)
+	if err == nil && len(prune.tags) > 0 {
+		err = applyRemotePrune(cfg, targetEnv, prune)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to prune old versions (keep_remote_versions: %d): %v\n", keep, err)
+		return
+	}
+	if len(prune.versions) > 0 {
+		fmt.Printf("Pruned %s from the registry (keep_remote_versions: %d)\n", strings.Join(prune.versions, ", "), keep)
+	}
+}
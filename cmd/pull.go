@@ -2,53 +2,94 @@
 //
 // The pull command handles downloading the latest personal environment:
 // - Checks authentication and personal image configuration
-// - Pulls the latest version of the user's personal image from DockerHub
+// - Pulls the latest version of the user's personal image from its registry
 // - Provides feedback on success/failure and image details
 // - Handles cases where the personal image doesn't exist on the registry
+// - Pulls every environment concurrently with --all
 package cmd
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
-	"os"
-	"strconv"
+	"sort"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/oysteinje/devdrop/pkg/config"
 	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/oysteinje/devdrop/pkg/syncstate"
+	"github.com/oysteinje/devdrop/pkg/workflow"
 	"github.com/spf13/cobra"
 )
 
 var pullCmd = &cobra.Command{
 	Use:   "pull [environment-name]",
 	Short: "Pull the latest version of a development environment",
-	Long: `Pull the latest version of a development environment from DockerHub.
+	Long: `Pull the latest version of a development environment from its registry
+(DockerHub by default).
 
 This command will:
 1. Check your authentication and configuration
 2. Prompt you to select an environment (if not specified)
-3. Pull the latest version of the selected environment from DockerHub
+3. Pull the latest version of the selected environment from its registry
 4. Update your local image cache
 5. Display information about the updated environment
 
+Multi-arch environments (see 'devdrop commit --platforms') are pulled for
+the architecture of this machine automatically.
+
+With verify_signatures: true in the config, the cosign signature of the
+image is checked against verify_key (or the public half of signing_key)
+before anything is pulled, and the verified digest is pulled. 'devdrop run'
+and 'devdrop rollback' check images they pull the same way.
+
+With --all, every configured environment is pulled, --jobs at a time, with
+one line of progress per environment; --remote adds the environments that
+are only in the registry. Local-only environments are skipped, and so are
+environments whose local image has changes that weren't pushed, as with
+'devdrop sync'. The pulls that failed are listed at the end.
+
 Prerequisites:
 - You must have run 'devdrop login' to authenticate
-- The environment must exist on DockerHub
+- The environment must exist in its registry
 
 Examples:
   devdrop pull              # Interactive prompt to select environment
   devdrop pull myenv        # Pull devdrop-myenv environment
-  devdrop pull devdrop-go   # Pull devdrop-go environment`,
+  devdrop pull devdrop-go   # Pull devdrop-go environment
+  devdrop pull --all        # Pull every configured environment
+  devdrop pull --all --remote --jobs 5`,
 	Args: cobra.MaximumNArgs(1),
 	RunE: runPull,
 }
 
+var (
+	pullAll    bool
+	pullRemote bool
+	pullJobs   int
+)
+
 func init() {
 	rootCmd.AddCommand(pullCmd)
+	pullCmd.Flags().BoolVar(&pullAll, "all", false, "Pull every configured environment")
+	pullCmd.Flags().BoolVar(&pullRemote, "remote", false, "With --all, also pull the environments that are only in the registry")
+	pullCmd.Flags().IntVar(&pullJobs, "jobs", 3, "With --all, number of environments to pull at the same time")
 }
 
 func runPull(cmd *cobra.Command, args []string) error {
+	if pullAll && len(args) > 0 {
+		return &usageError{err: fmt.Errorf("--all pulls every environment and takes no environment name")}
+	}
+	if !pullAll && (pullRemote || cmd.Flags().Changed("jobs")) {
+		return &usageError{err: fmt.Errorf("--remote and --jobs can only be used with --all")}
+	}
+	if pullJobs < 1 {
+		return &usageError{err: fmt.Errorf("--jobs must be at least 1, got %d", pullJobs)}
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -57,30 +98,38 @@ func runPull(cmd *cobra.Command, args []string) error {
 
 	// Check if user is logged in
 	if cfg.Username == "" {
-		return fmt.Errorf("you must run 'devdrop login' first to authenticate with DockerHub")
+		return errLoginRequired
+	}
+
+	if pullAll {
+		return pullAllEnvironments(cfg)
 	}
 
 	var targetEnv string
 
 	// Determine which environment to pull
 	if len(args) == 0 {
-		// Interactive selection - check both local and remote
-		targetEnv, err = promptForEnvironmentToPull(cfg)
+		// Interactive selection - check both local and remote, without
+		// holding up the local list on the registry
+		targetEnv, err = promptForEnvironmentToPull(cfg, prefetchRemoteEnvironments(cfg))
 		if err != nil {
 			return err
 		}
 	} else {
 		targetEnv = config.EnsureDevDropPrefix(args[0])
 	}
+	if cfg.IsLocalOnly(targetEnv) {
+		return errLocalOnly(targetEnv, "pulled")
+	}
 
 	// Get image name
 	imageName := cfg.GetEnvironmentImageName(targetEnv)
 	if imageName == "" {
-		return fmt.Errorf("no username configured. Run 'devdrop login' first")
+		return errLoginRequired
 	}
 
 	// Create Docker client
-	dockerClient, err := docker.NewClient()
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
 	if err != nil {
 		return fmt.Errorf("failed to connect to Docker: %w", err)
 	}
@@ -88,39 +137,35 @@ func runPull(cmd *cobra.Command, args []string) error {
 
 	fmt.Printf("Pulling environment '%s': %s\n", targetEnv, imageName)
 
-	// Pull the image
-	if err := dockerClient.PullImage(imageName); err != nil {
-		// Check if this is a "not found" error
-		if isImageNotFoundError(err) {
-			return fmt.Errorf(`environment '%s' not found on DockerHub.
+	verifier, err := environmentVerifier(cfg, targetEnv)
+	if err != nil {
+		return err
+	}
+
+	// Pull the image and record it in the config
+	pull := workflow.Pull(workflow.PullOptions{
+		Client:      dockerClient,
+		Config:      cfg,
+		Environment: targetEnv,
+		AuthToken:   environmentAuthToken(cfg, targetEnv),
+		Verifier:    verifier,
+	})
+	if err := pull.Run(progressSink()); err != nil {
+		if errors.Is(err, docker.ErrImageNotFound) {
+			return fmt.Errorf(`environment '%s' not found on %s.
 
 This usually means:
 1. The environment hasn't been committed yet - run 'devdrop commit %s'
 2. The environment name is incorrect - run 'devdrop ls' to see available environments
 3. You don't have access to this image
 
-Image name: %s`, targetEnv, targetEnv, imageName)
-		}
-		return fmt.Errorf("failed to pull environment image: %w", err)
-	}
-
-	// Update or create environment in config
-	env, exists := cfg.Environments[targetEnv]
-	if !exists {
-		// Create new environment entry for remote-only environments
-		env = config.Environment{
-			BaseImage:   imageName, // We don't know the original base image, so use the pulled image
-			Created:     time.Now(),
-			Description: fmt.Sprintf("Environment pulled from DockerHub (%s)", imageName),
+Image name: %s`, targetEnv, registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)), targetEnv, imageName)
 		}
+		return err
 	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest")
 
-	env.Image = imageName
-	env.LastUpdated = time.Now()
-	cfg.Environments[targetEnv] = env
-	cfg.Save()
-
-	fmt.Println("✅ Environment pulled successfully!")
+	output.Successf("Environment pulled successfully!")
 	fmt.Printf("Environment: %s\n", targetEnv)
 	fmt.Printf("Image: %s\n", imageName)
 	fmt.Println()
@@ -129,169 +174,208 @@ Image name: %s`, targetEnv, targetEnv, imageName)
 	return nil
 }
 
-// isImageNotFoundError checks if the error indicates the image was not found
-func isImageNotFoundError(err error) bool {
-	if err == nil {
-		return false
-	}
-	errStr := err.Error()
-	return contains(errStr, "not found") ||
-		contains(errStr, "404") ||
-		contains(errStr, "does not exist") ||
-		contains(errStr, "pull access denied")
-}
-
-// contains checks if a string contains a substring (case-insensitive)
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) &&
-		(s == substr ||
-			(len(s) > len(substr) &&
-				(s[:len(substr)] == substr ||
-					s[len(s)-len(substr):] == substr ||
-					indexOfSubstring(s, substr) >= 0)))
+// pulledEnvironment is the outcome of pulling one environment with --all
+type pulledEnvironment struct {
+	name      string
+	imageName string
+	client    *docker.Client
+	// skipped explains why the environment wasn't pulled
+	skipped string
+	err     error
 }
 
-// indexOfSubstring finds the index of a substring in a string
-func indexOfSubstring(s, substr string) int {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return i
+// pullAllEnvironments pulls the configured environments, and with --remote
+// those only in the registry, a bounded number at a time. The pulls only
+// read the config; it is updated once they are all done.
+func pullAllEnvironments(cfg *config.Config) error {
+	names := cfg.EnvironmentNames()
+	if pullRemote {
+		fmt.Printf("Fetching environments from %s...\n", registryDisplayName(cfg.Registry))
+		remoteEnvs, err := listRemoteEnvironments(cfg)
+		var stale *registry.StaleError
+		if errors.As(err, &stale) {
+			fmt.Printf("Warning: %v\n", stale)
+		} else if err != nil {
+			return fmt.Errorf("failed to list remote environments: %w", err)
 		}
-	}
-	return -1
-}
-
-func promptForEnvironmentToPull(cfg *config.Config) (string, error) {
-	reader := bufio.NewReader(os.Stdin)
-
-	// Get local environments
-	localEnvs := make([]string, 0, len(cfg.Environments))
-	for name := range cfg.Environments {
-		localEnvs = append(localEnvs, name)
-	}
-
-	// Get remote environments
-	dockerClient, err := docker.NewClient()
-	if err != nil {
-		// Fallback to local only if Docker connection fails
-		fmt.Println("Warning: Could not connect to Docker, showing local environments only")
-		return promptForLocalEnvironmentToPull(cfg, localEnvs)
-	}
-	defer dockerClient.Close()
-
-	remoteEnvs, err := dockerClient.ListDevDropRepositories(cfg.Username)
-	if err != nil {
-		// If we have no local envs and can't get remote, that's a problem
-		if len(localEnvs) == 0 {
-			return "", fmt.Errorf("could not fetch remote environments (%v) and no local environments found. Run 'devdrop login' to authenticate, then try again", err)
+		for _, name := range remoteEnvs {
+			if _, exists := cfg.Environments[name]; !exists {
+				names = append(names, name)
+			}
 		}
-		// Fallback to local only if Docker Hub API fails but we have local envs
-		fmt.Printf("Warning: Could not fetch remote environments (%v), showing local environments only\n", err)
-		return promptForLocalEnvironmentToPull(cfg, localEnvs)
 	}
+	sort.Strings(names)
 
-	// Combine and deduplicate environments
-	allEnvs := make(map[string]bool)
-	var envList []string
-
-	// Add local environments first
-	for _, env := range localEnvs {
-		if !allEnvs[env] {
-			envList = append(envList, env)
-			allEnvs[env] = true
+	var targets []string
+	for _, name := range names {
+		if cfg.IsLocalOnly(name) {
+			fmt.Printf("Skipping %s: local-only\n", name)
+			continue
 		}
+		targets = append(targets, name)
 	}
-
-	// Add remote environments that aren't already local
-	for _, env := range remoteEnvs {
-		if !allEnvs[env] {
-			envList = append(envList, env)
-			allEnvs[env] = true
-		}
+	if len(targets) == 0 {
+		fmt.Println("No environments to pull.")
+		return nil
 	}
 
-	if len(envList) == 0 {
-		return "", fmt.Errorf("no environments found on DockerHub. Run 'devdrop init' to create your first environment")
+	fmt.Printf("Pulling %d environment(s), %d at a time...\n", len(targets), pullJobs)
+	results := make([]pulledEnvironment, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, pullJobs)
+	done := 0
+	for i, name := range targets {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			limit <- struct{}{}
+			result := pullOneEnvironment(cfg, name)
+			<-limit
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i] = result
+			done++
+			switch {
+			case result.err != nil:
+				fmt.Printf("[%d/%d] %s failed: %v\n", done, len(targets), name, result.err)
+			case result.skipped != "":
+				fmt.Printf("[%d/%d] %s skipped, %s\n", done, len(targets), name, result.skipped)
+			default:
+				fmt.Printf("[%d/%d] %s pulled\n", done, len(targets), name)
+			}
+		}(i, name)
 	}
+	wg.Wait()
 
-	fmt.Println("Available environments:")
-	for i, name := range envList {
-		marker := " "
-		status := ""
-
-		if name == cfg.GetCurrentEnvironment() {
-			marker = "*"
+	var failed []string
+	pulled := 0
+	for _, result := range results {
+		if result.client != nil {
+			defer result.client.Close()
 		}
-
-		// Show status: local, remote, or both
-		isLocal := false
-		isRemote := false
-		for _, local := range localEnvs {
-			if local == name {
-				isLocal = true
-				break
-			}
+		if result.err != nil {
+			failed = append(failed, result.name)
+			continue
 		}
-		for _, remote := range remoteEnvs {
-			if remote == name {
-				isRemote = true
-				break
-			}
+		if result.skipped != "" {
+			continue
 		}
-
-		if isLocal && isRemote {
-			status = " (local + remote)"
-		} else if isLocal {
-			status = " (local only)"
-		} else if isRemote {
-			status = " (remote only)"
+		pulled++
+		if _, err := cfg.RecordPull(result.name, result.imageName); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
 		}
+		recordInStore(result.client, cfg, result.name, "latest")
+	}
 
-		fmt.Printf("%d.%s %s%s\n", i+1, marker, name, status)
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to pull %d of %d environments: %s", len(failed), len(targets), strings.Join(failed, ", "))
 	}
+	output.Successf("Pulled %d environment(s)", pulled)
+	return nil
+}
 
-	fmt.Print("Select environment to pull (1-" + fmt.Sprintf("%d", len(envList)) + "): ")
-	input, err := reader.ReadString('\n')
+// pullOneEnvironment pulls the latest image of an environment without
+// printing per-layer progress, which would interleave with the other pulls.
+// Like sync, it leaves local images with unpushed changes alone.
+func pullOneEnvironment(cfg *config.Config, name string) pulledEnvironment {
+	result := pulledEnvironment{name: name, imageName: cfg.GetEnvironmentImageName(name)}
+	client, err := newEnvironmentDockerClient(name)
 	if err != nil {
-		return "", fmt.Errorf("failed to read selection: %w", err)
+		result.err = fmt.Errorf("failed to connect to Docker: %w", err)
+		return result
 	}
-
-	input = strings.TrimSpace(input)
-	choice, err := strconv.Atoi(input)
-	if err != nil || choice < 1 || choice > len(envList) {
-		return "", fmt.Errorf("invalid selection. Please choose 1-%d", len(envList))
+	client.SetProgressOutput(nil)
+	result.client = client
+
+	status := environmentSyncStatus(client, cfg, name)
+	switch status.State {
+	case syncstate.LocalAhead, syncstate.Diverged:
+		result.skipped = describeSync(cfg, name, status)
+		return result
 	}
 
-	return envList[choice-1], nil
+	if err := pullEnvironmentImage(client, cfg, name, result.imageName, ""); err != nil {
+		if errors.Is(err, docker.ErrImageNotFound) {
+			err = fmt.Errorf("not found in the registry; commit it first")
+		}
+		result.err = err
+	}
+	return result
 }
 
-func promptForLocalEnvironmentToPull(cfg *config.Config, envNames []string) (string, error) {
-	reader := bufio.NewReader(os.Stdin)
+func promptForEnvironmentToPull(cfg *config.Config, remote *remotePrefetch) (string, error) {
+	// Local environments are shown right away; remote ones are added to the
+	// prompt as soon as the registry answers
+	localEnvs := cfg.OrderForSelection(cfg.EnvironmentNames())
+	var remoteOnly []string
 
-	if len(envNames) == 0 {
-		return "", fmt.Errorf("no local environments found. Run 'devdrop init' to create one")
+	labels := make([]string, len(localEnvs))
+	for i, name := range localEnvs {
+		labels[i] = pullLabel(cfg, name, "local")
 	}
 
-	fmt.Println("Available local environments:")
-	for i, name := range envNames {
-		marker := " "
-		if name == cfg.GetCurrentEnvironment() {
-			marker = "*"
+	more := make(chan prompt.Batch, 1)
+	go func() {
+		defer close(more)
+		remoteEnvs, err := remote.Wait()
+		var stale *registry.StaleError
+		if err != nil && !errors.As(err, &stale) {
+			more <- prompt.Batch{Warning: fmt.Sprintf("could not fetch remote environments: %v", err)}
+			return
+		}
+
+		isLocal := make(map[string]bool, len(localEnvs))
+		for _, name := range localEnvs {
+			isLocal[name] = true
+		}
+
+		batch := prompt.Batch{}
+		if stale != nil {
+			batch.Warning = stale.Error()
+		}
+		for _, name := range remoteEnvs {
+			if !isLocal[name] {
+				remoteOnly = append(remoteOnly, name)
+				batch.Options = append(batch.Options, pullLabel(cfg, name, "remote only"))
+			}
+		}
+		more <- batch
+	}()
+
+	if len(localEnvs) == 0 {
+		// Nothing to show until the registry answers
+		fmt.Printf("Fetching environments from %s...\n", registryDisplayName(cfg.Registry))
+		remoteEnvs, err := remote.Wait()
+		var stale *registry.StaleError
+		if err != nil && !errors.As(err, &stale) {
+			return "", fmt.Errorf("could not fetch remote environments (%v) and no local environments found. Run 'devdrop login' to authenticate, then try again", err)
+		}
+		if len(remoteEnvs) == 0 {
+			return "", fmt.Errorf("no environments found in %s. Run 'devdrop init' to create your first environment", registryDisplayName(cfg.Registry))
 		}
-		fmt.Printf("%d.%s %s\n", i+1, marker, name)
 	}
 
-	fmt.Print("Select environment to pull (1-" + fmt.Sprintf("%d", len(envNames)) + "): ")
-	input, err := reader.ReadString('\n')
+	fmt.Println("Available environments:")
+	choice, err := prompt.SelectStreaming("Select environment to pull", labels, more)
 	if err != nil {
-		return "", fmt.Errorf("failed to read selection: %w", err)
+		return "", withPromptHint(err, "pass the environment name as an argument")
 	}
 
-	input = strings.TrimSpace(input)
-	choice, err := strconv.Atoi(input)
-	if err != nil || choice < 1 || choice > len(envNames) {
-		return "", fmt.Errorf("invalid selection. Please choose 1-%d", len(envNames))
+	if choice < len(localEnvs) {
+		return localEnvs[choice], nil
 	}
+	// Remote options can only be chosen once their batch was received, so
+	// remoteOnly is complete at this point
+	return remoteOnly[choice-len(localEnvs)], nil
+}
 
-	return envNames[choice-1], nil
+// pullLabel formats an environment for the pull prompt
+func pullLabel(cfg *config.Config, name, status string) string {
+	marker := " "
+	if name == cfg.GetCurrentEnvironment() {
+		marker = "*"
+	}
+	return fmt.Sprintf("%s %s (%s)", marker, name, status)
 }
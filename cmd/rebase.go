@@ -0,0 +1,340 @@
+// Package cmd provides the rebase command for DevDrop.
+//
+// The rebase command moves an environment onto a newer base image:
+// - Pulls the newer base image, or another one given with --base
+// - Replays the packages the environment added on top of its old base
+// - Reports the package and size changes before making it the latest version
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/bootstrap"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/workflow"
+	"github.com/spf13/cobra"
+)
+
+var rebaseCmd = &cobra.Command{
+	Use:   "rebase [environment-name]",
+	Short: "Rebuild an environment on a newer base image",
+	Long: `Rebuild an environment on top of a newer version of its base image, or on
+another base image given with --base, e.g. to pick up the security updates
+of a newer ubuntu:24.04.
+
+The base image is pulled again, and the packages the environment added on
+top of its old base are installed on the new one: the apt or apk packages
+installed on purpose, pip packages and global npm packages, the way
+'devdrop bootstrap-script' lists them. They are installed in their latest
+versions, so they match the new base.
+
+Before anything changes, a report compares the environment with the
+rebased image: the base digests, the image sizes and every package that
+was upgraded, added or dropped. Once confirmed, the rebased image becomes
+the environment's next version and latest; the previous version stays
+available to 'devdrop rollback'. Use --push to publish it right away, or
+--dry-run to list the packages that would be replayed and the images that
+would be built and pushed, without pulling or building anything.
+
+Only packages are replayed: files added or edited by hand, and tools
+installed outside these package managers, aren't carried over. Check the
+rebased environment with 'devdrop run' before pushing it.
+
+Examples:
+  devdrop rebase                          # Current environment, same base
+  devdrop rebase myenv --base ubuntu:26.04
+  devdrop rebase myenv --dry-run
+  devdrop rebase myenv --push -y`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runRebase,
+}
+
+var (
+	rebaseBase   string
+	rebasePush   bool
+	rebaseDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(rebaseCmd)
+	rebaseCmd.Flags().StringVar(&rebaseBase, "base", "", "Base image to rebase onto (default the environment's base image)")
+	rebaseCmd.Flags().BoolVar(&rebasePush, "push", false, "Push the rebased environment to the registry")
+	rebaseCmd.Flags().BoolVar(&rebaseDryRun, "dry-run", false, "List what would be pulled, built and pushed without doing it")
+}
+
+func runRebase(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+	if rebasePush && env.LocalOnly {
+		return errLocalOnly(targetEnv, "pushed")
+	}
+
+	newBase := rebaseBase
+	if newBase == "" {
+		newBase = env.BaseImage
+	}
+	if newBase == "" {
+		return fmt.Errorf("environment '%s' has no base image recorded. Name one with --base", targetEnv)
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stdout)
+	if err != nil {
+		return err
+	}
+	committed := useImage == imageName
+
+	// The old base has to be listed before the new one is pulled, as both
+	// are usually the same tag
+	var before, oldBase bootstrap.Inventory
+	oldBaseListed := false
+	if committed {
+		fmt.Printf("Listing the packages in %s...\n", imageName)
+		if before, err = dockerClient.CaptureInventory(imageName); err != nil {
+			return err
+		}
+		if env.BaseImage != "" && dockerClient.ImageExists(env.BaseImage) {
+			if oldBase, err = dockerClient.CaptureInventory(env.BaseImage); err != nil {
+				return err
+			}
+			oldBaseListed = true
+		} else {
+			fmt.Printf("Warning: the old base image %s isn't present, so every package of the environment is replayed\n", env.BaseImage)
+		}
+	}
+
+	replay := before
+	if oldBaseListed {
+		replay = before.Without(oldBase)
+	}
+	if rebaseDryRun {
+		reportRebaseDryRun(cfg, targetEnv, env, newBase, committed, replay)
+		return nil
+	}
+
+	prepare, base := workflow.BaseImage(workflow.BaseImageOptions{
+		Client: dockerClient,
+		Config: cfg,
+		Image:  newBase,
+	})
+	if err := prepare.Run(progressSink()); err != nil {
+		return err
+	}
+	if newBase == env.BaseImage && base.Digest != "" && base.Digest == env.BaseImageDigest {
+		fmt.Printf("%s is already on the latest %s; nothing to rebase.\n", targetEnv, newBase)
+		return nil
+	}
+
+	// Environments that were never committed only have their base to change
+	if !committed {
+		if err := cfg.Update(func(c *config.Config) error {
+			e := c.Environments[targetEnv]
+			e.BaseImage = newBase
+			e.BaseImageDigest = base.Digest
+			e.LastUpdated = time.Now()
+			c.Environments[targetEnv] = e
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to update configuration: %w", err)
+		}
+		output.Successf("Environment '%s' now starts from %s", targetEnv, newBase)
+		return nil
+	}
+
+	versionTag := env.NextVersionTag()
+	versionImage := cfg.GetEnvironmentImageRef(targetEnv, versionTag)
+
+	fmt.Printf("Rebuilding %s on %s (version %s)...\n", targetEnv, newBase, versionTag)
+	script := bootstrap.Script(replay, bootstrap.ScriptOptions{
+		Environment: targetEnv,
+		Image:       imageName,
+		BaseImage:   newBase,
+		Unpinned:    true,
+		Created:     time.Now(),
+	})
+	err = dockerClient.BuildImage(docker.BuildOptions{
+		Dockerfile: rebaseDockerfile(newBase),
+		Tags:       []string{versionImage},
+		Files:      map[string]string{"devdrop-bootstrap.sh": script},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rebuild %s; the environment is unchanged: %w", targetEnv, err)
+	}
+
+	after, err := dockerClient.CaptureInventory(versionImage)
+	if err != nil {
+		return err
+	}
+	fmt.Println()
+	if err := printRebaseReport(dockerClient, env, base.Digest, imageName, versionImage, newBase, replay, bootstrap.Compare(before, after)); err != nil {
+		return err
+	}
+
+	fmt.Println()
+	ok, err := prompt.Confirm(fmt.Sprintf("Make the rebased image %s of %s?", versionTag, targetEnv), true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := dockerClient.RemoveImageTag(versionImage); err != nil {
+			fmt.Printf("Warning: failed to remove %s: %v\n", versionImage, err)
+		}
+		fmt.Println("The environment is unchanged.")
+		return nil
+	}
+
+	if err := dockerClient.TagImage(versionImage, imageName); err != nil {
+		return fmt.Errorf("failed to tag image: %w", err)
+	}
+	if lock, err := dockerClient.CaptureTools(imageName); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	} else {
+		env.Tools = lock
+	}
+
+	if rebasePush {
+		authToken := environmentAuthToken(cfg, targetEnv)
+		if authToken == "" {
+			return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+		}
+
+		fmt.Printf("Pushing image %s to %s...\n", imageName, registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+		if err := dockerClient.PushImage(versionImage, authToken); err != nil {
+			return fmt.Errorf("failed to push image: %w", err)
+		}
+		if err := dockerClient.PushImage(imageName, authToken); err != nil {
+			return fmt.Errorf("failed to push image: %w", err)
+		}
+	}
+
+	env.Image = imageName
+	env.BaseImage = newBase
+	env.BaseImageDigest = base.Digest
+	env.LastUpdated = time.Now()
+	env.Versions = append(env.Versions, config.Version{Tag: versionTag, Created: env.LastUpdated})
+	env.LatestVersion = versionTag
+	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+		return fmt.Errorf("failed to update configuration: %w", err)
+	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest", versionTag)
+
+	output.Successf("Environment '%s' rebased onto %s as %s", targetEnv, newBase, versionTag)
+	if !rebasePush && !env.LocalOnly {
+		fmt.Printf("Run 'devdrop run %s' to check it; the next 'devdrop commit' pushes it.\n", targetEnv)
+	}
+	return nil
+}
+
+// reportRebaseDryRun lists what rebasing would pull, build, tag and push
+func reportRebaseDryRun(cfg *config.Config, targetEnv string, env config.Environment, newBase string, committed bool, replay bootstrap.Inventory) {
+	fmt.Println("Dry run: nothing is pulled, built, tagged or pushed, and the configuration is left unchanged.")
+	fmt.Println()
+	fmt.Printf("Would pull the base image %s\n", newBase)
+	if newBase == env.BaseImage && env.BaseImageDigest != "" {
+		fmt.Printf("If it is still %s, %s is already on it and nothing else would happen\n", shortDigest(env.BaseImageDigest), targetEnv)
+	}
+	if !committed {
+		fmt.Printf("Would make %s start from %s; it was never committed, so there is nothing to rebuild\n", targetEnv, newBase)
+		return
+	}
+
+	versionTag := env.NextVersionTag()
+	versionImage := cfg.GetEnvironmentImageRef(targetEnv, versionTag)
+	fmt.Printf("Would build %s on %s, installing the latest versions of:\n", versionImage, newBase)
+	for _, kind := range []struct {
+		name     string
+		packages []bootstrap.Package
+	}{{"OS", replay.OS}, {"pip", replay.Pip}, {"npm", replay.Npm}} {
+		if len(kind.packages) == 0 {
+			continue
+		}
+		names := make([]string, len(kind.packages))
+		for i, p := range kind.packages {
+			names[i] = p.Name
+		}
+		fmt.Printf("  %s: %s\n", kind.name, strings.Join(names, ", "))
+	}
+	if len(replay.OS)+len(replay.Pip)+len(replay.Npm) == 0 {
+		fmt.Println("  no packages")
+	}
+	fmt.Printf("Would ask to confirm, then tag it as %s and make %s the latest version\n", cfg.GetEnvironmentImageName(targetEnv), versionTag)
+	if rebasePush {
+		fmt.Printf("Would push %s and latest to %s\n", versionImage, registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+	}
+	fmt.Println("Nothing would be deleted: the previous version stays available to 'devdrop rollback'.")
+}
+
+// rebaseDockerfile installs the replayed packages on the new base image
+func rebaseDockerfile(baseImage string) string {
+	return fmt.Sprintf(`FROM %s
+COPY devdrop-bootstrap.sh /tmp/devdrop-bootstrap.sh
+RUN sh /tmp/devdrop-bootstrap.sh && rm /tmp/devdrop-bootstrap.sh
+`, baseImage)
+}
+
+// printRebaseReport compares the environment's image with the rebased one
+func printRebaseReport(dockerClient *docker.Client, env config.Environment, newDigest, imageName, rebasedImage, newBase string, replay bootstrap.Inventory, changes []bootstrap.Change) error {
+	describeBase := func(image, digest string) string {
+		if digest == "" {
+			return image
+		}
+		return fmt.Sprintf("%s (%s)", image, shortDigest(digest))
+	}
+	fmt.Println("Rebase report")
+	fmt.Printf("Base:     %s -> %s\n", describeBase(env.BaseImage, env.BaseImageDigest), describeBase(newBase, newDigest))
+
+	beforeInfo, err := dockerClient.InspectImage(imageName)
+	if err != nil {
+		return err
+	}
+	afterInfo, err := dockerClient.InspectImage(rebasedImage)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Size:     %s -> %s\n", units.HumanSize(float64(beforeInfo.Size)), units.HumanSize(float64(afterInfo.Size)))
+	fmt.Printf("Replayed: %d OS, %d pip and %d npm package(s)\n", len(replay.OS), len(replay.Pip), len(replay.Npm))
+
+	if len(changes) == 0 {
+		fmt.Println("Packages: no version changes")
+		return nil
+	}
+	fmt.Println()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tPACKAGE\tBEFORE\tAFTER")
+	for _, c := range changes {
+		before, after := c.Before, c.After
+		if before == "" {
+			before = "-"
+		}
+		if after == "" {
+			after = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", c.Kind, c.Name, before, after)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+// Package cmd provides the restore command for DevDrop.
+//
+// The restore command branches a new session from a snapshot:
+// - Looks up a snapshot taken with 'devdrop snapshot'
+// - Starts a session of its environment from it, like 'devdrop run'
+// - Leaves the snapshot in place to restore again
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <snapshot>",
+	Short: "Start a new session from a snapshot",
+	Long: `Start a new session of an environment from a snapshot taken with
+'devdrop snapshot', to go back to a checkpoint or try another direction
+from it. Name the snapshot as <environment>:<name>, or just <name> when
+only one environment has a snapshot of that name.
+
+The session runs in the current directory like 'devdrop run' and takes the
+same flags. The snapshot stays as it is, so it can be restored again; the
+new session becomes the environment's session container, so 'devdrop
+commit' saves it as the next version.
+
+Examples:
+  devdrop snapshot ls                  # Find the snapshot
+  devdrop restore before-upgrade       # Branch a session from it
+  devdrop restore go:20261016-150422 -p 3000:3000`,
+	Args: cobra.ExactArgs(1),
+	RunE: runRestore,
+}
+
+func init() {
+	rootCmd.AddCommand(restoreCmd)
+	addRunFlags(restoreCmd.Flags())
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	if runPlatform != "" {
+		return &usageError{err: fmt.Errorf("--platform can't be used with restore: a snapshot has the platform of the session it was taken from")}
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	snapshots, err := listSnapshots(dockerClient, "")
+	dockerClient.Close()
+	if err != nil {
+		return err
+	}
+	s, err := findSnapshot(snapshots, args[0])
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restoring snapshot '%s' of %s (taken %s)\n", s.Name, s.Environment, output.TimestampWithAge(s.Created))
+	runImage = s.Image
+	return runRun(cmd, []string{s.Environment})
+}
@@ -0,0 +1,119 @@
+// Package cmd provides the rollback command for DevDrop.
+//
+// The rollback command restores a previously committed version:
+// - Pulls the version tag if it is not available locally
+// - Points latest at that version and pushes it to the registry
+// - Records the restored version in the configuration
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback <environment-name> <version>",
+	Short: "Restore a previous version of an environment",
+	Long: `Restore a previously committed version of an environment by pointing
+its latest tag at that version and pushing it to your registry.
+
+The version itself is left untouched, so you can roll forward again at
+any time. Run 'devdrop history' to see available versions. Local-only
+environments are restored locally without contacting a registry.
+
+Examples:
+  devdrop rollback myenv v3     # Make v3 the latest version of devdrop-myenv`,
+	Args: cobra.ExactArgs(2),
+	RunE: runRollback,
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+}
+
+func runRollback(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args[:1])
+	if err != nil {
+		return err
+	}
+
+	if cfg.Username == "" && !env.LocalOnly {
+		return errLoginRequired
+	}
+
+	tag := args[1]
+	version, exists := env.FindVersion(tag)
+	if !exists {
+		return fmt.Errorf("version '%s' not found for environment '%s'. Run 'devdrop history %s' to see available versions", tag, targetEnv, targetEnv)
+	}
+
+	authToken := environmentAuthToken(cfg, targetEnv)
+	if authToken == "" && !env.LocalOnly {
+		return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	versionImage := cfg.GetEnvironmentImageRef(targetEnv, tag)
+	imageName := cfg.GetEnvironmentImageName(targetEnv)
+
+	if !dockerClient.ImageExists(versionImage) {
+		if env.LocalOnly {
+			return fmt.Errorf("version %s of local-only environment '%s' is no longer on this machine", tag, targetEnv)
+		}
+		fmt.Printf("Pulling %s...\n", versionImage)
+		if err := pullEnvironmentImage(dockerClient, cfg, targetEnv, versionImage, ""); err != nil {
+			return fmt.Errorf("failed to pull version %s: %w", tag, err)
+		}
+	}
+
+	fmt.Printf("Restoring %s to %s...\n", targetEnv, tag)
+	if err := dockerClient.TagImage(versionImage, imageName); err != nil {
+		return fmt.Errorf("failed to restore version: %w", err)
+	}
+
+	switch {
+	case env.LocalOnly:
+		// Nothing to publish; the local tag is all there is
+	case len(version.Platforms) > 0:
+		// Pushing the local tag would replace the manifest list with a
+		// single variant
+		fmt.Printf("Publishing manifest list for %s...\n", imageName)
+		if err := pushManifestList(dockerClient, cfg, targetEnv, authToken, tag, version.Platforms, "latest"); err != nil {
+			return fmt.Errorf("failed to push manifest list: %w", err)
+		}
+	default:
+		fmt.Printf("Pushing %s...\n", imageName)
+		if err := dockerClient.PushImage(imageName, authToken); err != nil {
+			return fmt.Errorf("failed to push image: %w", err)
+		}
+	}
+
+	env.LatestVersion = tag
+	env.LastUpdated = time.Now()
+	if err := cfg.AddEnvironment(targetEnv, env); err != nil {
+		return fmt.Errorf("failed to update configuration: %w", err)
+	}
+	recordInStore(dockerClient, cfg, targetEnv, "latest", tag)
+
+	fmt.Println()
+	output.Successf("Environment '%s' rolled back to %s", targetEnv, tag)
+	if env.LastContainer != "" {
+		fmt.Println("Note: your uncommitted session container was based on the previous version. Committing it will create a new version on top of that state.")
+	}
+
+	return nil
+}
@@ -1,10 +1,15 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/oysteinje/devdrop/internal/version"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -17,15 +22,87 @@ and share personal development environments using Docker containers.
 
 Think "dotfiles for entire environments" - portable, version-controlled,
 and instantly available anywhere Docker runs.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := output.ValidateProgress(output.Progress); err != nil {
+			return &usageError{err: err}
+		}
+		refreshWebLogins()
+		return nil
+	},
+}
+
+// exitCodeError ends the process with a specific exit code, e.g. to pass
+// through the exit code of a command run inside an environment
+type exitCodeError struct {
+	code int
+}
+
+func (e *exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
 }
 
 func Execute() {
+	migrateConfigDir()
+	markUsageErrors(rootCmd)
+
 	if err := rootCmd.Execute(); err != nil {
+		code := exitCodeFor(err)
+		// Ctrl-C at a prompt is a deliberate abort, not a failure to report;
+		// exit codes passed through were reported by the command itself
+		var exitErr *exitCodeError
+		if code == exitInterrupted || errors.As(err, &exitErr) {
+			os.Exit(code)
+		}
+		output.Emit(output.Event{Event: output.EventError, Error: err.Error()})
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-		os.Exit(1)
+		if docker.IsNoSpace(err) {
+			offerDiskCleanup()
+		}
+		errorHint(err)
+		os.Exit(code)
+	}
+}
+
+// errorHint tells what to do about kinds of failures the container runtime
+// reported
+func errorHint(err error) {
+	switch {
+	case errors.Is(err, docker.ErrDaemonUnavailable):
+		fmt.Fprintf(os.Stderr, "Is Docker running? Start it, or run 'devdrop doctor' to see what is wrong.\n")
+	case errors.Is(err, docker.ErrUnauthorized):
+		fmt.Fprintf(os.Stderr, "The registry rejected your credentials. Run 'devdrop login' and try again.\n")
+	case errors.Is(err, docker.ErrNetwork):
+		fmt.Fprintf(os.Stderr, "The network looks unreliable. Run the command again when it is better; layers that were already transferred are skipped.\n")
 	}
 }
 
+// migrateConfigDir moves files from ~/.devdrop to the XDG directories once.
+// Messages go to stderr so they don't end up in piped command output.
+func migrateConfigDir() {
+	moved, err := config.Migrate()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to move DevDrop's files to the XDG directories: %v\n", err)
+		return
+	}
+	if moved {
+		configDir, _ := config.GetConfigDir()
+		cacheDir, _ := config.GetCacheDir()
+		fmt.Fprintf(os.Stderr, "Moved DevDrop's files from ~/.devdrop to %s (config) and %s (cache); ~/.devdrop now links to the config directory.\n", configDir, cacheDir)
+	}
+}
+
+// quiet suppresses pull and push progress output
+var quiet bool
+
+// dockerContext is the docker context to connect to instead of the default
+var dockerContext string
+
 func init() {
-	// Global flags can be added here
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Suppress pull and push progress output")
+	rootCmd.PersistentFlags().BoolVar(&output.Plain, "plain", false, "Plain line-by-line output without emoji or progress bars (screen reader friendly)")
+	rootCmd.PersistentFlags().BoolVar(&prompt.NonInteractive, "non-interactive", false, "Never prompt; use defaults and fail if a required value is missing")
+	rootCmd.PersistentFlags().BoolVarP(&prompt.AssumeYes, "yes", "y", false, "Answer yes to confirmations (implies --non-interactive)")
+	rootCmd.PersistentFlags().BoolVar(&output.UseUTC, "utc", false, "Show timestamps in UTC instead of the local timezone")
+	rootCmd.PersistentFlags().StringVar(&output.Progress, "progress", output.ProgressText, "Progress output: text, or json for one JSON event per line on stderr")
+	rootCmd.PersistentFlags().StringVar(&dockerContext, "context", "", "Docker context to use, e.g. one for a remote daemon (see 'docker context ls')")
 }
@@ -3,18 +3,36 @@
 // The run command starts your personal development environment:
 // - Checks if personal image exists locally, pulls from DockerHub if not
 // - Creates and starts container with current directory mounted as /workspace
+// - Keeps paths listed in .devdropignore out of /workspace, or copies it in
+// - Runs the environment's pre_run and post_run hooks around the session
+// - Starts the environment's sidecar services and tears them down on exit
 // - Provides interactive shell in your customized environment
 // - Automatically cleans up container when session ends
+// - Runs ephemeral sessions that are never committed, and read-only workspaces
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/oysteinje/devdrop/pkg/config"
 	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/envfile"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/ignore"
+	"github.com/oysteinje/devdrop/pkg/inotify"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/services"
+	"github.com/oysteinje/devdrop/pkg/shell"
+	"github.com/oysteinje/devdrop/pkg/workflow"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var runCmd = &cobra.Command{
@@ -34,6 +52,134 @@ The current directory will be available as /workspace inside the container,
 and any changes you make to files will persist on your host system.
 Container changes can be committed with 'devdrop commit' after the session.
 
+Some toolchains expect their sources at a specific path. Use
+--workdir-in-container (or workspace_path in the environment config, which
+'devdrop exec', 'devdrop code' and warm containers use too) to mount the
+workspace elsewhere, e.g. /home/dev/src; the shell starts there.
+
+File watchers (webpack, vite, jest, etc.) depend on the inotify limits of the
+Docker host. Use --tune-inotify (or tune_inotify: true in the environment config)
+to raise them through a privileged helper container before the session starts.
+
+Use -p to publish ports so dev servers inside the environment are reachable
+from the host. Ports listed under "ports" in the environment config are
+published on every run, in addition to any given with -p.
+Mounts listed under "mounts" (src:dst[:ro]) are bind mounted as well, and
+--mount adds more for one session, e.g. your cloud credentials and a data
+directory next to the project. No two mounts may share a container path.
+
+Use --platform to run the environment for another architecture under
+emulation (requires QEMU binfmt support on the Docker host, e.g.
+'docker run --privileged --rm tonistiigi/binfmt --install all'). Changes made
+there are committed with 'devdrop commit --platforms'. Without --platform,
+multi-arch environments run natively on every machine.
+
+Use --with to add tools from other images to a single session without
+putting them in the environment, e.g. kubectl for a quick look at a cluster.
+The directory holding the tool image's binaries (its entrypoint's directory,
+or name it as image=/dir) is extracted into a volume once, mounted read-only
+and appended to PATH. Statically linked tools work best. Nothing from --with
+ends up in the image when the session is committed.
+
+Use -e KEY=VALUE (or -e KEY to pass the host's value) and --env-file to set
+environment variables in the session. Variables under "env" in the
+environment config are set on every run; --env-file and then -e override
+them. The variables are exported by the session's shell rather than stored
+on the container, so they never end up in a committed image.
+
+Use --dotenv (or dotenv: true in the environment config) to also load the
+project's .env and .devdrop.env from the current directory, in that order,
+after the "env" config and before --env-file and -e. They are read in
+dotenv format (export prefixes and quoted values are allowed), and the
+names of the variables loaded from each file are printed.
+
+Use --volume name:/path to keep a directory such as a Go module or npm cache
+across sessions in a named volume. Volumes listed under "volumes" in the
+environment config are mounted on every run. Each environment gets its own
+Docker volumes, created on first use and filled from the image; they are not
+part of committed images. List and remove them with 'devdrop volume'.
+
+Heavy directories such as node_modules, .venv or target can be kept out of
+/workspace with a .devdropignore file in the current directory (gitignore
+syntax). Each ignored directory is replaced by a volume of the environment
+for this workspace, so dependencies installed in one session are there in
+the next without crossing the host file share; ignored files are hidden.
+
+Use --mount-mode (or mount_mode in the environment config) to choose how
+the workspace gets into the session:
+  bind  mount it, changes show up on both sides at once (default)
+  copy  copy it in; changes stay in the session and are discarded with it
+  sync  copy it in and copy changed files back when the session ends
+Copy and sync avoid slow bind mounts on Docker Desktop. Sync only copies
+back what changed in the session; files that also changed on the host are
+listed as conflicts and the host's version is kept. Files deleted in a sync
+session are listed but kept on the host, and ignored paths are never copied
+either way.
+
+When a session with changes ends, run offers to commit it right away, and
+to push it unless the environment is local-only. Set commit.on_exit in the
+config to "always" to commit without asking or "never" to skip the
+question, or use --commit to commit this session if its shell exits with
+status 0.
+
+Use --ephemeral for a throwaway session: its container is removed as soon
+as it ends (by Docker, even if devdrop is killed), it is never recorded
+for 'devdrop commit' and nothing is offered for commit. Use
+--read-only-workspace to mount the workspace read-only, so nothing in the
+session can change the project's files; it needs mount mode bind.
+Together they are a safe way to poke at untrusted code.
+
+Dotfiles configured with 'devdrop dotfiles' are installed into the home
+directory before the shell starts; use --no-dotfiles to skip them.
+
+Services under "services" in the environment config (or in devdrop.yaml)
+are sidecar containers, docker-compose style, started before the session
+on a network of their own and removed when it ends:
+
+  services:
+    postgres:
+      image: postgres:16
+      env:
+        POSTGRES_PASSWORD: devdrop
+      volumes:
+        - pgdata:/var/lib/postgresql/data
+    redis:
+      image: redis:7
+      ports:
+        - 6379:6379
+
+The session reaches each service under its name, e.g. postgres:5432.
+Images are pulled when missing; "command" replaces the image's command and
+"ports" publishes ports to the host as well. Named volumes keep data across
+sessions like --volume does; everything else is gone once the services are
+removed. Use --keep-services to keep them running after the session, e.g.
+to keep a seeded database around; the next session reuses them.
+
+Hooks under "hooks" in the environment config (or in devdrop.yaml, copied
+by 'devdrop build') run shell commands around sessions, e.g. to start a
+database sidecar or strip caches before a commit:
+
+  hooks:
+    pre_run:
+      - docker compose up -d db
+      - run: ./scripts/seed.sh
+        in: container
+    post_run:
+      - docker compose stop db
+    pre_commit:
+      - run: rm -rf /root/.cache/*
+        in: container
+        optional: true
+
+pre_run hooks run before the session starts: on the host before its
+container is created, or with "in: container" before its shell starts.
+post_run hooks run on the host after it ended, and pre_commit hooks before
+'devdrop commit' commits it. Host hooks run in the workspace (or their
+"dir") with sh, container hooks in /workspace; both get DEVDROP_HOOK,
+DEVDROP_ENVIRONMENT, DEVDROP_WORKSPACE and, once it exists,
+DEVDROP_CONTAINER. A failing hook stops what it runs before unless it is
+optional; failing post_run hooks only warn. Use --no-hooks to skip them.
+
 Prerequisites:
 - You must have run 'devdrop login' first
 - The environment must exist locally or on DockerHub
@@ -42,6 +188,19 @@ Examples:
   cd ~/my-project
   devdrop run                    # Use current environment
   devdrop run myenv              # Use devdrop-myenv environment
+  devdrop run --tune-inotify     # Raise file-watch limits before starting
+  devdrop run -p 3000:3000 -p 8080:8080  # Reach dev servers on localhost
+  devdrop run --platform linux/amd64     # Customize the amd64 variant
+  devdrop run --with bitnami/kubectl     # kubectl for this session only
+  devdrop run --with alpine/helm=/usr/bin  # Name the binary directory
+  devdrop run --env-file .env -e DEBUG=1   # Project variables for the session
+  devdrop run -e AWS_PROFILE     # Pass a variable through from the host
+  devdrop run --dotenv           # Load ./.env and ./.devdrop.env
+  devdrop run --volume gocache:/root/go/pkg/mod  # Keep the module cache
+  devdrop run --commit           # Commit and push when the session ends
+  devdrop run --mount-mode sync  # Work on a copy, copy changes back on exit
+  devdrop run --keep-services    # Keep postgres and friends for the next session
+  devdrop run --ephemeral --read-only-workspace  # Look at untrusted code
   # Inside container: your tools are available, /workspace contains project files
   # Install additional tools, make changes
   exit
@@ -50,11 +209,75 @@ Examples:
 	RunE: runRun,
 }
 
+var (
+	tuneInotify     bool
+	runPorts        []string
+	runPlatform     string
+	runWith         []string
+	runEnvVars      []string
+	runEnvFiles     []string
+	runVolumes      []string
+	runMounts       []string
+	runDotEnv       bool
+	runAutoCommit   bool
+	runMountMode    string
+	runNoHooks      bool
+	runKeepServices bool
+	runEphemeral    bool
+	runReadOnly     bool
+	runWorkdir      string
+
+	// runImage starts the session from this image instead of the
+	// environment's; 'devdrop restore' sets it to a snapshot
+	runImage string
+)
+
 func init() {
 	rootCmd.AddCommand(runCmd)
+	addRunFlags(runCmd.Flags())
+}
+
+// addRunFlags registers the flags of 'devdrop run', which 'devdrop explain
+// run' accepts as well
+func addRunFlags(flags *pflag.FlagSet) {
+	flags.BoolVar(&tuneInotify, "tune-inotify", false, "Raise inotify watch limits on the Docker host (runs a privileged helper container)")
+	flags.StringArrayVarP(&runPorts, "publish", "p", nil, "Publish a container port to the host (e.g. 3000:3000, 127.0.0.1:8080:80)")
+	flags.StringVar(&runPlatform, "platform", "", "Run the environment for another platform under emulation (e.g. linux/amd64)")
+	flags.BoolVar(&noDotfiles, "no-dotfiles", false, "Don't install the dotfiles configured with 'devdrop dotfiles'")
+	flags.StringArrayVar(&runWith, "with", nil, "Add the binaries of a tool image to PATH for this session (image or image=/bin/dir)")
+	flags.StringArrayVarP(&runEnvVars, "env", "e", nil, "Set an environment variable in the session (KEY=VALUE, or KEY to pass the host's value)")
+	flags.StringArrayVar(&runEnvFiles, "env-file", nil, "Read environment variables from a file of KEY=VALUE lines")
+	flags.BoolVar(&runAutoCommit, "commit", false, "Commit and push the session when its shell exits cleanly")
+	flags.BoolVar(&runDotEnv, "dotenv", false, "Load .env and .devdrop.env from the current directory into the session")
+	flags.StringArrayVar(&runVolumes, "volume", nil, "Mount a named volume kept across sessions (name:/path[:ro])")
+	flags.StringArrayVar(&runMounts, "mount", nil, "Bind mount a host path into the session (src:/path[:ro])")
+	flags.StringVar(&runMountMode, "mount-mode", "", "How the workspace gets into the session: bind, copy or sync (default bind)")
+	flags.BoolVar(&runNoHooks, "no-hooks", false, "Don't run the environment's hooks")
+	flags.BoolVar(&runKeepServices, "keep-services", false, "Keep the environment's services running when the session ends")
+	flags.BoolVar(&runEphemeral, "ephemeral", false, "Remove the container when the session ends and never commit it")
+	flags.BoolVar(&runReadOnly, "read-only-workspace", false, "Mount the workspace read-only")
+	flags.StringVar(&runWorkdir, "workdir-in-container", "", "Where the workspace appears in the container and the shell starts (default /workspace)")
 }
 
 func runRun(cmd *cobra.Command, args []string) error {
+	// Catch typos in -p before pulling anything
+	if err := docker.ValidatePorts(runPorts); err != nil {
+		return err
+	}
+	if err := validateToolSpecs(runWith); err != nil {
+		return err
+	}
+	if runEphemeral && runAutoCommit {
+		return fmt.Errorf("--ephemeral sessions are never committed; drop --commit")
+	}
+	if runPlatform != "" {
+		platform, err := docker.ParsePlatform(runPlatform)
+		if err != nil {
+			return err
+		}
+		runPlatform = platform
+	}
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
@@ -63,19 +286,19 @@ func runRun(cmd *cobra.Command, args []string) error {
 
 	// Check if user is logged in
 	if cfg.Username == "" {
-		return fmt.Errorf("you must run 'devdrop login' first to authenticate with DockerHub")
+		return errLoginRequired
 	}
 
 	// Determine which environment to run
 	var targetEnv string
 	if len(args) == 0 {
-		// Use current environment
-		if !cfg.HasEnvironments() {
-			return fmt.Errorf("no environments configured. Run 'devdrop init' to create one")
+		// Use the environment mapped to this directory, or the current one
+		targetEnv, err = defaultEnvironment(cfg)
+		if err != nil {
+			return err
 		}
-		targetEnv = cfg.GetCurrentEnvironment()
-		if targetEnv == "" {
-			return fmt.Errorf("no current environment set. Run 'devdrop switch' to select one")
+		if cfg.SuggestOnRun {
+			targetEnv = offerSuggestion(cfg, targetEnv)
 		}
 	} else {
 		targetEnv = config.EnsureDevDropPrefix(args[0])
@@ -84,83 +307,825 @@ func runRun(cmd *cobra.Command, args []string) error {
 	// Get environment image name
 	imageName := cfg.GetEnvironmentImageName(targetEnv)
 	if imageName == "" {
-		return fmt.Errorf("no username configured. Run 'devdrop login' first")
+		return errLoginRequired
+	}
+
+	// Catch mistakes in -e and --env-file before pulling anything
+	var dotenvFiles []string
+	if runDotEnv || cfg.Environments[targetEnv].DotEnv {
+		dotenvFiles, err = workspaceDotenvFiles()
+		if err != nil {
+			return err
+		}
+	}
+	vars, err := sessionEnv(cfg.Environments[targetEnv], dotenvFiles, runEnvFiles, runEnvVars)
+	if err != nil {
+		return err
+	}
+	volumes := append(append([]string{}, cfg.Environments[targetEnv].Volumes...), runVolumes...)
+	if err := validateVolumes(volumes); err != nil {
+		return err
+	}
+	mountMode, mountSource := sessionMountMode(cfg.Environments[targetEnv])
+	if err := docker.ValidateMountMode(mountMode); err != nil {
+		return err
+	}
+	containerWorkspace, _ := sessionWorkspacePath(cfg.Environments[targetEnv])
+	if err := docker.ValidateWorkspacePath(containerWorkspace); err != nil {
+		return err
+	}
+	mounts := append(append([]string{}, cfg.Environments[targetEnv].Mounts...), runMounts...)
+	if err := validateMountTargets(containerWorkspace, mounts, volumes); err != nil {
+		return err
+	}
+	if err := cfg.Environments[targetEnv].Hooks.Validate(); err != nil {
+		return fmt.Errorf("invalid hooks of %s: %w", targetEnv, err)
+	}
+	if err := validateServices(cfg.Environments[targetEnv].Services); err != nil {
+		return fmt.Errorf("invalid services of %s: %w", targetEnv, err)
+	}
+
+	// Get current directory to mount as workspace
+	absPath, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+	rules, ignored, err := workspaceIgnored(absPath)
+	if err != nil {
+		return err
 	}
 
 	// Create Docker client
-	dockerClient, err := docker.NewClient()
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
 	if err != nil {
 		return fmt.Errorf("failed to connect to Docker: %w", err)
 	}
 	defer dockerClient.Close()
 
+	// Running the native platform explicitly is the same as not asking
+	if runPlatform != "" {
+		if native, err := dockerClient.DaemonPlatform(); err == nil && native == runPlatform {
+			runPlatform = ""
+		}
+	}
+
 	// Check if committed image exists locally
 	fmt.Printf("Using environment: %s\n", targetEnv)
-	fmt.Printf("Checking for environment image: %s\n", imageName)
-
 	var useImage string
-
-	if dockerClient.ImageExists(imageName) {
-		fmt.Println("Environment image found locally.")
-		useImage = imageName
+	if runImage != "" {
+		useImage = runImage
+	} else if runPlatform != "" {
+		useImage, err = resolvePlatformImage(dockerClient, cfg, targetEnv, runPlatform)
 	} else {
-		// Check if environment exists in config (might have uncommitted changes)
-		if env, exists := cfg.Environments[targetEnv]; exists && env.BaseImage != "" {
-			fmt.Printf("Environment image not found, using base image: %s\n", env.BaseImage)
-			fmt.Println("Note: You'll be running the base environment. Run 'devdrop commit' after your session to save changes.")
-			useImage = env.BaseImage
-		} else {
-			// Try pulling from DockerHub as last resort
-			fmt.Printf("Environment image not found locally. Pulling from DockerHub...\n")
-			if err := dockerClient.PullImage(imageName); err != nil {
-				return fmt.Errorf("failed to pull environment image. Make sure the environment exists or run 'devdrop init' first: %w", err)
-			}
-			fmt.Println("Image pulled successfully!")
-			useImage = imageName
+		useImage, err = resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stdout)
+		if err == nil {
+			warnForeignPlatform(dockerClient, useImage)
 		}
 	}
-
-	// Get current directory to mount as workspace
-	currentDir, err := os.Getwd()
 	if err != nil {
-		return fmt.Errorf("failed to get current directory: %w", err)
+		return err
 	}
 
-	// Get absolute path
-	absPath, err := filepath.Abs(currentDir)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
+	// A remote daemon can't bind mount this machine's directories
+	if dockerClient.IsRemote() {
+		if mountSource == "default" {
+			fmt.Printf("Docker runs on %s; using mount mode sync to bring the workspace over.\n", dockerClient.Endpoint())
+			mountMode = docker.MountSync
+		} else if mountMode == docker.MountBind {
+			warnRemoteBinds(dockerClient, absPath, nil, os.Stdout)
+		}
+		if len(mounts) > 0 {
+			fmt.Printf("Warning: mounts of %s refer to paths on %s: %s\n", targetEnv, dockerClient.Endpoint(), strings.Join(mounts, ", "))
+		}
+	}
+
+	if runReadOnly && mountMode != docker.MountBind {
+		return fmt.Errorf("--read-only-workspace needs mount mode bind, not %s (copy already leaves the host's files alone)", mountMode)
 	}
 
 	fmt.Printf("Starting environment in: %s\n", absPath)
-	fmt.Printf("Current directory will be available as /workspace inside the container.\n")
+	switch {
+	case runReadOnly:
+		fmt.Printf("Current directory will be available read-only as %s inside the container.\n", containerWorkspace)
+	case mountMode == docker.MountCopy:
+		fmt.Printf("Current directory will be copied to %s inside the container; changes stay there.\n", containerWorkspace)
+	case mountMode == docker.MountSync:
+		fmt.Printf("Current directory will be copied to %s inside the container and changes copied back on exit.\n", containerWorkspace)
+	default:
+		fmt.Printf("Current directory will be available as %s inside the container.\n", containerWorkspace)
+	}
+	if len(ignored) > 0 {
+		fmt.Printf("Kept out by %s: %s\n", ignore.FileName, strings.Join(ignoredNames(ignored), ", "))
+	}
+	if runEphemeral {
+		fmt.Println("Ephemeral session: the container is removed when it ends and can't be committed.")
+	}
 	fmt.Println()
 
-	// Create and start container with volume mount
-	containerID, err := dockerClient.CreateWorkspaceContainer(useImage, absPath)
-	if err != nil {
-		return fmt.Errorf("failed to create container: %w", err)
+	// Make sure file watchers inside the environment won't run out of inotify watches
+	env := cfg.Environments[targetEnv]
+	if tuneInotify || env.TuneInotify {
+		fmt.Println("Raising inotify limits on the Docker host...")
+		// Limits set higher than recommended stay as they are
+		limits := inotify.Recommended()
+		if current, err := inotify.ReadHost(); err == nil && !dockerClient.IsRemote() {
+			limits = current.Raised()
+		}
+		if err := dockerClient.RaiseInotifyLimits(useImage, limits); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	} else if limits, err := inotify.ReadHost(); err == nil && !limits.Sufficient() {
+		fmt.Printf("Warning: low inotify limits (max_user_watches=%d, max_user_instances=%d).\n", limits.MaxUserWatches, limits.MaxUserInstances)
+		fmt.Println("File watchers in dev servers may fail. Run 'devdrop doctor' for details or use --tune-inotify.")
+		fmt.Println()
+	}
+
+	// Publish ports from the environment config first, then any given on the command line
+	ports := append(append([]string{}, env.Ports...), runPorts...)
+	if len(ports) > 0 {
+		fmt.Printf("Publishing ports: %s\n", strings.Join(ports, ", "))
+	}
+
+	if len(env.Services) > 0 {
+		var names []string
+		for _, name := range env.Services.Names() {
+			names = append(names, fmt.Sprintf("%s (%s)", name, env.Services[name].Image))
+		}
+		fmt.Printf("Starting services: %s\n", strings.Join(names, ", "))
+	}
+
+	var envFile string
+	if len(vars) > 0 {
+		fmt.Printf("Setting environment variables: %s\n", strings.Join(vars.Keys(), ", "))
+		envFile, err = writeSessionEnvFile(vars)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(envFile)
+	}
+
+	var envHooks hooks.Hooks
+	if !runNoHooks {
+		envHooks = env.Hooks
+	}
+	preRunHost, preRunContainer := hooks.Split(envHooks.PreRun)
+	runner := sessionHooks(dockerClient, targetEnv, "")
+
+	// Prepare and create the session container
+	opts := docker.WorkspaceOptions{
+		ContainerSpec: docker.ContainerSpec{Image: useImage, Ports: ports},
+		WorkspaceDir:  absPath,
+		MountMode:     mountMode,
+		Platform:      runPlatform,
+		Environment:   targetEnv,
+		Version:       sessionVersion(env, useImage),
+		Dotfiles:      sessionDotfiles(cfg),
+		EnvFile:       envFile,
+		Setup:         runner.Script(hooks.PreRun, preRunContainer),
+
+		WorkspacePath:     containerWorkspace,
+		ReadOnlyWorkspace: runReadOnly,
+		Ephemeral:         runEphemeral,
+	}
+	var containerID string
+	var prewarmed bool
+	var baseline docker.WorkspaceBaseline
+	session := workflow.New("run",
+		workflow.Step{
+			Name: "Prepare mounts",
+			Run: func(r *workflow.Reporter) error {
+				binds, err := resolveMounts(mounts)
+				if err != nil {
+					return err
+				}
+				volumeMounts, err := resolveVolumes(dockerClient, targetEnv, volumes)
+				if err != nil {
+					return err
+				}
+				workspaceMounts, err := ignoredMounts(dockerClient, targetEnv, absPath, containerWorkspace, ignored, mountMode == docker.MountBind)
+				if err != nil {
+					return err
+				}
+				opts.Mounts = append(append(binds, volumeMounts...), workspaceMounts...)
+				return nil
+			},
+		},
+		workflow.Step{
+			Name: "Start services",
+			Skip: func() string {
+				if len(env.Services) == 0 {
+					return "no services"
+				}
+				return ""
+			},
+			Run: func(r *workflow.Reporter) error {
+				serviceOpts, err := serviceOptions(dockerClient, targetEnv, env.Services)
+				if err != nil {
+					return err
+				}
+				network, started, err := dockerClient.StartServices(targetEnv, absPath, serviceOpts)
+				if err != nil {
+					return err
+				}
+				if len(started) < len(serviceOpts) {
+					r.Infof("Reusing services that were still running")
+				}
+				opts.Network = network
+				return nil
+			},
+		},
+		workflow.Step{
+			Name: "Prepare tools",
+			Skip: func() string {
+				if len(runWith) == 0 {
+					return "no --with tools"
+				}
+				return ""
+			},
+			Run: func(r *workflow.Reporter) error {
+				var err error
+				opts.Tools, err = prepareTools(r, dockerClient, runWith)
+				return err
+			},
+		},
+		workflow.Step{
+			Name: "Run pre-run hooks",
+			Skip: func() string {
+				if len(preRunHost) == 0 {
+					return "no pre_run hooks on the host"
+				}
+				return ""
+			},
+			Run: func(r *workflow.Reporter) error {
+				return runner.Run(hooks.PreRun, preRunHost)
+			},
+		},
+		workflow.Step{
+			Name: "Create container",
+			Run: func(r *workflow.Reporter) error {
+				// A container 'devdrop daemon --prewarm' made ready for this
+				// workspace skips creating and starting one
+				if id, err := dockerClient.ClaimPrewarmed(opts); err == nil && id != "" {
+					containerID, prewarmed = id, true
+					r.Infof("Using prewarmed container %s", shortID(id))
+					return nil
+				}
+				var err error
+				if containerID, err = dockerClient.CreateWorkspaceContainer(opts); err != nil {
+					return fmt.Errorf("failed to create container: %w", err)
+				}
+				return nil
+			},
+		},
+		workflow.Step{
+			Name: "Copy workspace",
+			Skip: func() string {
+				if mountMode == docker.MountBind {
+					return "workspace is bind mounted"
+				}
+				return ""
+			},
+			Run: func(r *workflow.Reporter) error {
+				var err error
+				if baseline, err = dockerClient.CopyToWorkspace(containerID, absPath, rules.Match); err != nil {
+					dockerClient.RemoveContainer(containerID)
+					return err
+				}
+				return nil
+			},
+		},
+	)
+	if err := session.Run(progressSink()); err != nil {
+		if opts.Network != "" && !runKeepServices {
+			dockerClient.StopServices(targetEnv, absPath)
+		}
+		return err
+	}
+
+	// Record the run so interactive prompts can list recently used environments first
+	if _, exists := cfg.Environments[targetEnv]; exists {
+		if err := cfg.MarkEnvironmentUsed(targetEnv, absPath); err != nil {
+			fmt.Printf("Warning: failed to record environment usage: %v\n", err)
+		}
+	}
+
+	if !prewarmed {
+		output.Emit(output.Event{Event: output.EventContainerCreated, Environment: targetEnv, Image: opts.Image, Container: containerID})
 	}
 
 	// Start interactive container
 	fmt.Println("Starting your development environment...")
-	if err := dockerClient.StartInteractiveContainer(containerID); err != nil {
+	output.Emit(output.Event{Event: output.EventSessionStarted, Environment: targetEnv, Image: opts.Image, Container: containerID})
+	if prewarmed {
+		// The shell printed its prompt when the daemon started it
+		fmt.Println("Press Enter if no prompt shows.")
+		if err := dockerClient.AttachInteractiveContainer(containerID); err != nil {
+			return fmt.Errorf("failed to attach to container: %w", err)
+		}
+	} else if err := dockerClient.StartInteractiveContainer(containerID); err != nil {
+		if len(env.Services) > 0 {
+			stopSessionServices(dockerClient, targetEnv, absPath, containerID)
+		}
 		return fmt.Errorf("failed to start container: %w", err)
 	}
 
+	output.Emit(output.Event{Event: output.EventSessionEnded, Environment: targetEnv, Container: containerID})
+
 	// Save container ID to environment config for potential commit
 	fmt.Println()
 	fmt.Println("Development session ended.")
 	fmt.Printf("Environment: %s\n", targetEnv)
 	fmt.Printf("Container ID: %s\n", containerID)
 
+	synced := true
+	if mountMode == docker.MountSync {
+		synced = syncWorkspace(dockerClient, containerID, absPath, rules, baseline)
+	}
+
+	// The session already happened; failing post_run hooks don't change that
+	if len(envHooks.PostRun) > 0 {
+		runner.Container = containerID
+		if err := runner.Run(hooks.PostRun, envHooks.PostRun); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	if len(env.Services) > 0 {
+		stopSessionServices(dockerClient, targetEnv, absPath, containerID)
+	}
+
+	if runEphemeral {
+		// Docker already removed it unless changes were synced back from
+		// it; one with changes that weren't copied back is kept
+		if mountMode == docker.MountSync {
+			if !synced {
+				fmt.Printf("Ephemeral session; container %s is kept until the changes above are copied out. Remove it with 'docker rm %s'.\n", shortID(containerID), shortID(containerID))
+				return nil
+			}
+			if err := dockerClient.RemoveContainer(containerID); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+		fmt.Println("Ephemeral session; the container is removed and there is nothing to commit.")
+		return nil
+	}
+
+	if runPlatform != "" {
+		if err := cfg.SetEnvironmentPlatformContainer(targetEnv, runPlatform, containerID); err != nil {
+			return fmt.Errorf("failed to save container ID to config: %w", err)
+		}
+		fmt.Printf("Container saved as the %s variant. Run 'devdrop commit %s --platforms <native>,%s' to publish a multi-arch image.\n", runPlatform, targetEnv, runPlatform)
+		return nil
+	}
+
 	if err := cfg.SetEnvironmentContainer(targetEnv, containerID); err != nil {
 		fmt.Printf("Warning: failed to save container ID to config: %v\n", err)
-	} else {
-		fmt.Printf("Container saved for potential commit. Run 'devdrop commit %s' to save your changes.\n", targetEnv)
+		return nil
+	}
+
+	if committed, err := commitOnExit(dockerClient, cfg, targetEnv, containerID); err != nil || committed {
+		return err
 	}
 
+	fmt.Printf("Container saved for potential commit. Run 'devdrop commit %s' to save your changes.\n", targetEnv)
 	fmt.Printf("Note: Container will remain available for commit. Run 'devdrop commit %s' to save changes and clean up.\n", targetEnv)
 
 	return nil
 }
+
+// stopSessionServices removes the services of a session that ended, unless
+// --keep-services keeps them or the session or another one on the services'
+// network is still running
+func stopSessionServices(dockerClient *docker.Client, targetEnv, workspace, containerID string) {
+	if runKeepServices {
+		fmt.Println("Services keep running for the next session (--keep-services); a session without it removes them when it ends.")
+		return
+	}
+	if state, err := dockerClient.ContainerState(containerID); err == nil && state == "running" {
+		fmt.Println("The session is still running, so its services keep running too.")
+		return
+	}
+
+	removed, err := dockerClient.StopServices(targetEnv, workspace)
+	if errors.Is(err, docker.ErrServicesInUse) {
+		fmt.Println("Another session in this workspace still runs, so the services keep running too.")
+		return
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to stop services: %v\n", err)
+		return
+	}
+	if len(removed) > 0 {
+		fmt.Printf("Stopped services: %s\n", strings.Join(removed, ", "))
+	}
+}
+
+// commitOnExit commits a session that just ended when --commit or the
+// commit.on_exit setting asks for it, and reports whether it did. Sessions
+// without changes are never committed; with --commit or on_exit: always,
+// neither are sessions whose shell exited with an error.
+func commitOnExit(dockerClient *docker.Client, cfg *config.Config, targetEnv, containerID string) (bool, error) {
+	mode := cfg.Commit.OnExit
+	if runAutoCommit {
+		mode = config.CommitOnExitAlways
+	}
+	switch mode {
+	case config.CommitOnExitNever:
+		return false, nil
+	case config.CommitOnExitAlways, config.CommitOnExitAsk, "":
+	default:
+		fmt.Printf("Warning: unknown commit.on_exit '%s' in the config; use always, never or ask\n", mode)
+		mode = config.CommitOnExitAsk
+	}
+
+	// Local-only environments and --no-push commits don't need a login
+	env := cfg.Environments[targetEnv]
+	push := !commitNoPush && !env.LocalOnly
+	authToken := environmentAuthToken(cfg, targetEnv)
+	if push && (cfg.Username == "" || authToken == "") {
+		if runAutoCommit {
+			fmt.Printf("Warning: not committing: pushing %s needs a login. Run 'devdrop login', then 'devdrop commit %s'.\n", targetEnv, targetEnv)
+		}
+		return false, nil
+	}
+
+	if changes, err := dockerClient.ContainerChanges(containerID); err == nil && len(changes) == 0 {
+		fmt.Println("No changes to commit.")
+		return false, nil
+	}
+
+	if mode == config.CommitOnExitAlways {
+		code, err := dockerClient.ContainerExitCode(containerID)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			return false, nil
+		}
+		if code != 0 {
+			fmt.Printf("Session exited with status %d; not committing automatically.\n", code)
+			return false, nil
+		}
+	} else {
+		question := fmt.Sprintf("Commit %s now?", targetEnv)
+		if push {
+			question = fmt.Sprintf("Commit and push %s now?", targetEnv)
+		}
+		commit, err := prompt.Confirm(question, false)
+		if err != nil || !commit {
+			return false, nil
+		}
+	}
+
+	scanner, err := commitScanner(cfg, nil)
+	if err != nil {
+		return true, err
+	}
+	fmt.Println()
+	return true, commitSession(dockerClient, cfg, targetEnv, env, containerID, authToken, commitOptions(cfg, nil), scanner)
+}
+
+// sessionMountMode returns how a session gets its workspace and where that
+// setting comes from
+func sessionMountMode(env config.Environment) (string, string) {
+	switch {
+	case runMountMode != "":
+		return runMountMode, "--mount-mode"
+	case env.MountMode != "":
+		return env.MountMode, "environment config"
+	default:
+		return docker.MountBind, "default"
+	}
+}
+
+// sessionWorkspacePath returns where a session has the workspace and where
+// that setting comes from
+func sessionWorkspacePath(env config.Environment) (string, string) {
+	switch {
+	case runWorkdir != "":
+		return runWorkdir, "--workdir-in-container"
+	case env.WorkspacePath != "":
+		return env.WorkspacePath, "environment config"
+	default:
+		return docker.DefaultWorkspacePath, "default"
+	}
+}
+
+// ignoredNames lists ignored paths for display, directories with a
+// trailing slash
+func ignoredNames(ignored []ignoredPath) []string {
+	names := make([]string, 0, len(ignored))
+	for _, path := range ignored {
+		if path.isDir {
+			names = append(names, path.rel+"/")
+		} else {
+			names = append(names, path.rel)
+		}
+	}
+	return names
+}
+
+// syncWorkspace copies the changes of a sync session back to the host and
+// reports them. It reports whether every change was copied back; the
+// container keeps its copy of those that weren't.
+func syncWorkspace(dockerClient *docker.Client, containerID, workspace string, rules *ignore.Rules, baseline docker.WorkspaceBaseline) bool {
+	fmt.Println("Copying changes back to the workspace...")
+	result, err := dockerClient.CopyFromWorkspace(containerID, workspace, rules.Match, baseline)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		fmt.Printf("The session's copy is still in container %s until it is removed.\n", shortID(containerID))
+		return false
+	}
+
+	switch {
+	case len(result.Updated) > 0:
+		fmt.Printf("Copied back %d new or changed file(s) to %s\n", len(result.Updated), workspace)
+	case len(result.Conflicts) == 0 && len(result.Refused) == 0:
+		fmt.Println("No files changed in the session's workspace.")
+	}
+	if len(result.Deleted) > 0 {
+		fmt.Printf("Warning: %d path(s) deleted in the session were kept on the host:\n", len(result.Deleted))
+		printSyncPaths(result.Deleted)
+	}
+	if len(result.Refused) > 0 {
+		fmt.Printf("Warning: %d path(s) leading out of the workspace through a link were not copied back:\n", len(result.Refused))
+		printSyncPaths(result.Refused)
+	}
+	if len(result.Conflicts) > 0 {
+		fmt.Printf("Warning: %d path(s) changed both in the session and on the host were not copied back:\n", len(result.Conflicts))
+		printSyncPaths(result.Conflicts)
+	}
+	if len(result.Refused) > 0 || len(result.Conflicts) > 0 {
+		fmt.Printf("The session's versions are still in container %s; copy them out with 'docker cp'.\n", shortID(containerID))
+		return false
+	}
+	return true
+}
+
+// printSyncPaths lists the first paths of a sync report
+func printSyncPaths(paths []string) {
+	for i, path := range paths {
+		if i == 10 {
+			fmt.Printf("  ... and %d more\n", len(paths)-i)
+			break
+		}
+		fmt.Printf("  %s\n", path)
+	}
+}
+
+// resolvePlatformImage finds the image to run for a non-native platform: the
+// environment's variant for that platform if it has one, otherwise its base
+// image so the variant can be set up from scratch
+func resolvePlatformImage(dockerClient *docker.Client, cfg *config.Config, targetEnv, platform string) (string, error) {
+	env := cfg.Environments[targetEnv]
+
+	for _, p := range env.LatestPlatforms() {
+		if p != platform {
+			continue
+		}
+		variant := cfg.GetEnvironmentImageRef(targetEnv, docker.PlatformTag(env.LatestVersion, platform))
+		if dockerClient.ImageExists(variant) {
+			fmt.Printf("Using %s variant: %s\n", platform, variant)
+			return variant, nil
+		}
+		fmt.Printf("Pulling %s variant: %s\n", platform, variant)
+		if err := pullEnvironmentImage(dockerClient, cfg, targetEnv, variant, platform); err != nil {
+			return "", err
+		}
+		return variant, nil
+	}
+
+	if env.BaseImage == "" {
+		return "", fmt.Errorf("environment '%s' has no %s variant and no base image to start one from", targetEnv, platform)
+	}
+
+	fmt.Printf("Environment has no %s variant yet, starting from base image %s.\n", platform, env.BaseImage)
+	fmt.Println("Note: repeat your customizations in this session, then commit with --platforms.")
+	if err := dockerClient.PullImagePlatform(env.BaseImage, platform, ""); err != nil {
+		return "", err
+	}
+	return env.BaseImage, nil
+}
+
+// warnForeignPlatform points out images that only run under emulation here
+func warnForeignPlatform(dockerClient *docker.Client, imageName string) {
+	native, err := dockerClient.DaemonPlatform()
+	if err != nil {
+		return
+	}
+	imagePlatform, err := dockerClient.ImagePlatform(imageName)
+	if err != nil || platformMatches(native, imagePlatform) {
+		return
+	}
+	fmt.Printf("Warning: %s is a %s image but this machine is %s; it will run under emulation, if at all.\n", imageName, imagePlatform, native)
+	fmt.Println("Commit it with 'devdrop commit --platforms' to publish a variant for each architecture.")
+}
+
+// sessionVersion returns the environment version a session image belongs to,
+// or "" for the base image
+func sessionVersion(env config.Environment, image string) string {
+	if image == env.BaseImage {
+		return ""
+	}
+	return env.LatestVersion
+}
+
+// validateServices checks an environment's services before anything starts
+func validateServices(list services.Services) error {
+	if err := list.Validate(); err != nil {
+		return err
+	}
+	for _, name := range list.Names() {
+		if err := docker.ValidatePorts(list[name].Ports); err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+		if err := validateVolumes(list[name].Volumes); err != nil {
+			return fmt.Errorf("service '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// serviceOptions resolves an environment's services into containers to
+// start, creating their named volumes as needed
+func serviceOptions(dockerClient *docker.Client, envName string, list services.Services) ([]docker.ServiceOptions, error) {
+	opts := make([]docker.ServiceOptions, 0, len(list))
+	for _, name := range list.Names() {
+		service := list[name]
+		binds, err := resolveVolumes(dockerClient, envName, service.Volumes)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, docker.ServiceOptions{
+			ContainerSpec: docker.ContainerSpec{Image: service.Image, Ports: service.Ports, Mounts: binds},
+			Name:          name,
+			Command:       service.Command,
+			Env:           service.EnvList(),
+		})
+	}
+	return opts, nil
+}
+
+// validateToolSpecs checks --with values without pulling anything
+func validateToolSpecs(specs []string) error {
+	for _, spec := range specs {
+		image, dir, _ := strings.Cut(spec, "=")
+		if image == "" || (strings.Contains(spec, "=") && !path.IsAbs(dir)) {
+			return fmt.Errorf("invalid --with '%s': use <image> or <image>=/absolute/bin/dir", spec)
+		}
+	}
+	return nil
+}
+
+// prepareTools pulls the tool images given with --with and extracts the
+// directories holding their binaries into volumes
+func prepareTools(r *workflow.Reporter, dockerClient *docker.Client, specs []string) ([]docker.ToolMount, error) {
+	var toolMounts []docker.ToolMount
+	for _, spec := range specs {
+		image, dir, _ := strings.Cut(spec, "=")
+
+		if !dockerClient.ImageExists(image) {
+			r.Infof("Pulling tool image: %s", image)
+			if err := dockerClient.PullImage(image, ""); err != nil {
+				return nil, fmt.Errorf("failed to pull tool image: %w", err)
+			}
+		}
+
+		if dir == "" {
+			var err error
+			if dir, err = dockerClient.ToolBinDir(image); err != nil {
+				return nil, err
+			}
+		}
+
+		toolMount, err := dockerClient.PrepareToolMount(image, dir)
+		if err != nil {
+			return nil, err
+		}
+		r.Infof("Adding tools from %s (%s) at %s", image, dir, toolMount.Target)
+		toolMounts = append(toolMounts, toolMount)
+	}
+	return toolMounts, nil
+}
+
+// shellVariableName matches the variable names a POSIX shell can export
+var shellVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envLayer is one source of a session's environment variables
+type envLayer struct {
+	// source describes where the variables come from, e.g. ".env" or "-e"
+	source string
+	dotenv bool
+	vars   envfile.Vars
+}
+
+// sessionEnvLayers reads the sources of a session's environment variables
+// in the order they apply: the environment's configured env first, then the
+// project's dotenv files, then env files, then -e assignments
+func sessionEnvLayers(env config.Environment, dotenvFiles, files, assignments []string) ([]envLayer, error) {
+	layers := []envLayer{{source: "environment config", vars: envfile.Vars(env.Env)}}
+
+	for _, file := range dotenvFiles {
+		fileVars, err := envfile.ParseDotenvFile(file)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, envLayer{source: filepath.Base(file), dotenv: true, vars: fileVars})
+	}
+
+	for _, file := range files {
+		path, err := expandPath(file)
+		if err != nil {
+			return nil, err
+		}
+		fileVars, err := envfile.ParseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, envLayer{source: "--env-file " + file, vars: fileVars})
+	}
+
+	flagVars := make(envfile.Vars)
+	for _, assignment := range assignments {
+		if err := flagVars.Set(assignment); err != nil {
+			return nil, err
+		}
+	}
+	layers = append(layers, envLayer{source: "-e", vars: flagVars})
+
+	for _, layer := range layers {
+		for _, key := range layer.vars.Keys() {
+			if !shellVariableName.MatchString(key) {
+				return nil, fmt.Errorf("invalid environment variable name '%s': use letters, digits and underscores", key)
+			}
+		}
+	}
+	return layers, nil
+}
+
+// sessionEnv merges the environment variables of a session, printing the
+// names of those loaded from dotenv files
+func sessionEnv(env config.Environment, dotenvFiles, files, assignments []string) (envfile.Vars, error) {
+	layers, err := sessionEnvLayers(env, dotenvFiles, files, assignments)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := make(envfile.Vars)
+	for _, layer := range layers {
+		if layer.dotenv && len(layer.vars) > 0 {
+			fmt.Printf("Loaded from %s: %s\n", layer.source, strings.Join(layer.vars.Keys(), ", "))
+		}
+		vars.Merge(layer.vars)
+	}
+	return vars, nil
+}
+
+// dotenvFileNames are the project env files --dotenv loads, in order
+var dotenvFileNames = []string{".env", ".devdrop.env"}
+
+// workspaceDotenvFiles returns the project env files in the current
+// directory that exist
+func workspaceDotenvFiles() ([]string, error) {
+	dir, err := currentWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	return dotenvFilesIn(dir), nil
+}
+
+// dotenvFilesIn returns the project env files in dir that exist
+func dotenvFilesIn(dir string) []string {
+	var files []string
+	for _, name := range dotenvFileNames {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// writeSessionEnvFile writes variables to a file only the user can read,
+// for the session's shell to export. It is copied into the session container,
+// so it can be removed once the container is created.
+func writeSessionEnvFile(vars envfile.Vars) (string, error) {
+	dir, err := config.GetSessionsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create sessions directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "*.env")
+	if err != nil {
+		return "", fmt.Errorf("failed to create session env file: %w", err)
+	}
+	for _, key := range vars.Keys() {
+		fmt.Fprintf(f, "%s=%s\n", key, shell.Quote(vars[key]))
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write session env file: %w", err)
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,173 @@
+// Package cmd provides the scan command for DevDrop.
+//
+// The scan command checks environment images for known vulnerabilities:
+// - Runs Trivy or Grype, whichever is installed, on the environment's image
+// - Reports the vulnerabilities found by severity
+// - Fails with --fail-on so CI can gate on the result
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/scan"
+	"github.com/spf13/cobra"
+)
+
+var scanCmd = &cobra.Command{
+	Use:   "scan [environment-name]",
+	Short: "Scan an environment's image for known vulnerabilities",
+	Long: `Scan the image of an environment for known vulnerabilities (CVEs) in its
+OS and language packages, and report them by severity.
+
+The scan is done by Trivy or Grype, whichever is installed; set scanner:
+trivy or scanner: grype in the config, or pass --scanner, to pick one. The
+environment's committed image is scanned, or its base image when it was
+never committed.
+
+Use --severity to list only vulnerabilities of a severity or worse, and
+--fail-on to exit with an error when any of a severity or worse are found,
+e.g. in CI. 'devdrop commit --scan' scans before pushing and doesn't push
+images with critical vulnerabilities.
+
+Examples:
+  devdrop scan                          # Scan the current environment
+  devdrop scan myenv --severity high    # Only list high and critical
+  devdrop scan myenv --fail-on critical # Fail when criticals are found
+  devdrop scan myenv -o json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runScan,
+}
+
+var (
+	scanSeverity string
+	scanFailOn   string
+	scanScanner  string
+	scanOutput   string
+)
+
+func init() {
+	rootCmd.AddCommand(scanCmd)
+	scanCmd.Flags().StringVar(&scanSeverity, "severity", "", "List only vulnerabilities of this severity or worse: critical, high, medium, low or unknown")
+	scanCmd.Flags().StringVar(&scanFailOn, "fail-on", "", "Fail when vulnerabilities of this severity or worse are found")
+	scanCmd.Flags().StringVar(&scanScanner, "scanner", "", "Scanner to use: trivy or grype (default from config, else whichever is installed)")
+	scanCmd.Flags().StringVarP(&scanOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+func runScan(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(scanOutput); err != nil {
+		return err
+	}
+	minimum := scan.Unknown
+	var err error
+	if scanSeverity != "" {
+		if minimum, err = scan.ParseSeverity(scanSeverity); err != nil {
+			return &usageError{err: err}
+		}
+	}
+	failOn := ""
+	if scanFailOn != "" {
+		if failOn, err = scan.ParseSeverity(scanFailOn); err != nil {
+			return &usageError{err: err}
+		}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, _, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	preferred := cfg.Scanner
+	if scanScanner != "" {
+		preferred = scanScanner
+	}
+	scanner, err := scan.Find(preferred)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	// Keep stdout clean for the report
+	if !quiet {
+		dockerClient.SetProgressOutput(os.Stderr)
+	}
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stderr)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Scanning %s with %s...\n", useImage, scanner.Name)
+	report, err := scanner.Scan(useImage)
+	if err != nil {
+		return err
+	}
+
+	listed := report
+	listed.Vulnerabilities = report.AtLeast(minimum)
+	if scanOutput != output.FormatText {
+		if err := output.Render(os.Stdout, scanOutput, listed); err != nil {
+			return err
+		}
+	} else if err := printScanReport(targetEnv, report, listed); err != nil {
+		return err
+	}
+
+	if failOn != "" {
+		if failing := len(report.AtLeast(failOn)); failing > 0 {
+			return fmt.Errorf("%d vulnerabilities of severity %s or worse found in %s", failing, strings.ToLower(failOn), targetEnv)
+		}
+	}
+	return nil
+}
+
+// printScanReport prints the counts by severity and the listed
+// vulnerabilities of a scan
+func printScanReport(targetEnv string, report, listed scan.Report) error {
+	fmt.Printf("Environment: %s\n", targetEnv)
+	fmt.Printf("Image:       %s\n", report.Image)
+	fmt.Printf("Scanner:     %s\n", report.Scanner)
+	fmt.Println()
+
+	if len(report.Vulnerabilities) == 0 {
+		output.Successf("No known vulnerabilities found")
+		return nil
+	}
+
+	counts := report.Counts()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, severity := range scan.Severities {
+		fmt.Fprintf(w, "%s\t%d\n", severity, counts[severity])
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(listed.Vulnerabilities) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEVERITY\tID\tPACKAGE\tINSTALLED\tFIXED IN")
+	for _, v := range listed.Vulnerabilities {
+		fixed := v.FixedIn
+		if fixed == "" {
+			fixed = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", v.Severity, v.ID, v.Package, v.Installed, fixed)
+	}
+	return w.Flush()
+}
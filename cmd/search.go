@@ -0,0 +1,92 @@
+// Package cmd provides the search command for DevDrop.
+//
+// The search command helps users discover environments shared by others:
+// - Queries Docker Hub for public devdrop-* repositories
+// - Matches the built-in starter image catalog
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/spf13/cobra"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <term>",
+	Short: "Search for public devdrop environments",
+	Long: `Search Docker Hub for public devdrop-* environments shared by other users,
+as well as the built-in starter images.
+
+Results show stars, pulls and the repository description. To start from a
+community environment, use it as a custom base image:
+
+  devdrop init --image custom --base-image <repository>
+
+Examples:
+  devdrop search go             # Find Go environments
+  devdrop search rust --limit 5 # Show the top 5 Rust environments`,
+	Args: cobra.ExactArgs(1),
+	RunE: runSearch,
+}
+
+var searchLimit int
+
+func init() {
+	rootCmd.AddCommand(searchCmd)
+	searchCmd.Flags().IntVar(&searchLimit, "limit", 25, "Maximum number of Docker Hub results to show")
+}
+
+func runSearch(cmd *cobra.Command, args []string) error {
+	term := args[0]
+
+	// Match the starter catalog first, it needs no network
+	var starters []string
+	for name, image := range starterImages {
+		if strings.Contains(name, term) || strings.Contains(image, term) {
+			starters = append(starters, name)
+		}
+	}
+	sort.Strings(starters)
+
+	if len(starters) > 0 {
+		fmt.Println("Starter images:")
+		for _, name := range starters {
+			fmt.Printf("  %s (%s) - devdrop init --image %s\n", name, starterImages[name], name)
+		}
+		fmt.Println()
+	}
+
+	results, err := docker.SearchDevDropRepositories(term)
+	if err != nil {
+		return fmt.Errorf("failed to search Docker Hub: %w", err)
+	}
+
+	fmt.Println("Docker Hub environments:")
+	if len(results) == 0 {
+		fmt.Println("  (no devdrop- images found)")
+		return nil
+	}
+
+	// Most popular first
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].StarCount != results[j].StarCount {
+			return results[i].StarCount > results[j].StarCount
+		}
+		return results[i].PullCount > results[j].PullCount
+	})
+	if searchLimit > 0 && len(results) > searchLimit {
+		results = results[:searchLimit]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  NAME\tSTARS\tPULLS\tDESCRIPTION")
+	for _, repo := range results {
+		fmt.Fprintf(w, "  %s\t%d\t%d\t%s\n", repo.RepoName, repo.StarCount, repo.PullCount, repo.ShortDescription)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,339 @@
+// Package cmd provides the sessions command for DevDrop.
+//
+// The sessions command shows the session containers DevDrop started:
+// - Lists running and stopped sessions with their environment and workspace
+// - Tells which sessions hold changes that weren't committed
+// - Attaches to, commits or removes a session picked by name or ID
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var sessionsCmd = &cobra.Command{
+	Use:   "sessions [environment-name]",
+	Short: "List running and stopped session containers",
+	Long: `List the session containers of all environments, or of one, newest first:
+running sessions and stopped ones that were never committed or removed.
+
+For each session the environment, when it was started, the workspace it was
+started in and whether it holds uncommitted changes are shown. Changes are
+counted in the container's filesystem; the workspace itself is mounted and
+never part of them. Ephemeral sessions are never committed.
+
+Sessions are picked by name (e.g. devdrop-go-20261016-142530) or by a
+prefix of their container ID:
+  - 'devdrop sessions attach' reconnects to a session, starting it again
+    if it stopped
+  - 'devdrop sessions commit' commits it as its environment's next version,
+    like 'devdrop commit'
+  - 'devdrop sessions rm' removes it; sessions that are running or hold
+    uncommitted changes need --force, and --dry-run only shows what would
+    be removed
+
+Sessions of environments with their own docker_host are only listed when
+the environment is named.
+
+Examples:
+  devdrop sessions                                    # All sessions
+  devdrop sessions go --running                       # Running sessions of devdrop-go
+  devdrop sessions attach devdrop-go-20261016-142530
+  devdrop sessions commit 3f2a9c
+  devdrop sessions rm devdrop-go-20261016-142530 --force`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSessions,
+}
+
+var sessionsAttachCmd = &cobra.Command{
+	Use:   "attach <session>",
+	Short: "Attach to a session, starting it if it stopped",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSessionsAttach,
+}
+
+var sessionsCommitCmd = &cobra.Command{
+	Use:   "commit <session>",
+	Short: "Commit a session as the next version of its environment",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runSessionsCommit,
+}
+
+var sessionsRmCmd = &cobra.Command{
+	Use:   "rm <session>...",
+	Short: "Remove sessions",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runSessionsRm,
+}
+
+var (
+	sessionsRunning  bool
+	sessionsOutput   string
+	sessionsRmForce  bool
+	sessionsRmDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsAttachCmd, sessionsCommitCmd, sessionsRmCmd)
+	sessionsCmd.Flags().BoolVar(&sessionsRunning, "running", false, "Only list running sessions")
+	sessionsCmd.Flags().StringVarP(&sessionsOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	sessionsRmCmd.Flags().BoolVarP(&sessionsRmForce, "force", "f", false, "Remove running sessions and sessions with uncommitted changes")
+	sessionsRmCmd.Flags().BoolVar(&sessionsRmDryRun, "dry-run", false, "Show which sessions would be removed without removing them")
+}
+
+// sessionInfo is a session container as listed by 'devdrop sessions'
+type sessionInfo struct {
+	Name        string    `json:"name" yaml:"name"`
+	Container   string    `json:"container" yaml:"container"`
+	Environment string    `json:"environment" yaml:"environment"`
+	State       string    `json:"state" yaml:"state"`
+	Started     time.Time `json:"started" yaml:"started"`
+	Workspace   string    `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+	Ephemeral   bool      `json:"ephemeral" yaml:"ephemeral"`
+	// Changes counts the paths changed in the container, -1 when they
+	// couldn't be listed
+	Changes     int  `json:"changes" yaml:"changes"`
+	Uncommitted bool `json:"uncommitted" yaml:"uncommitted"`
+}
+
+func runSessions(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(sessionsOutput); err != nil {
+		return err
+	}
+
+	envName := ""
+	if len(args) > 0 {
+		envName = config.EnsureDevDropPrefix(args[0])
+	}
+
+	var dockerClient *docker.Client
+	var err error
+	if envName != "" {
+		dockerClient, err = newEnvironmentDockerClient(envName)
+	} else {
+		dockerClient, err = newDockerClient()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containers, err := dockerClient.FindContainers(envName, sessionsRunning)
+	if err != nil {
+		return err
+	}
+	sessions := make([]sessionInfo, 0, len(containers))
+	for _, container := range containers {
+		sessions = append(sessions, describeSession(dockerClient, container))
+	}
+
+	if sessionsOutput != output.FormatText {
+		return output.Render(os.Stdout, sessionsOutput, sessions)
+	}
+
+	if len(sessions) == 0 {
+		if envName != "" {
+			fmt.Printf("No sessions of %s.\n", envName)
+		} else {
+			fmt.Println("No sessions.")
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tENVIRONMENT\tSTATE\tSTARTED\tWORKSPACE\tCHANGES")
+	for _, session := range sessions {
+		workspace := session.Workspace
+		if workspace == "" {
+			workspace = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", session.Name, session.Environment, session.State, output.RelativeTime(session.Started), workspace, describeSessionChanges(session))
+	}
+	return w.Flush()
+}
+
+// describeSession looks up the workspace and changes of a session container
+func describeSession(dockerClient *docker.Client, container docker.ContainerInfo) sessionInfo {
+	session := sessionInfo{
+		Name:        container.Name,
+		Container:   shortID(container.ID),
+		Environment: container.Environment,
+		State:       container.State,
+		Started:     container.Created,
+		Workspace:   container.Workspace,
+		Ephemeral:   container.Ephemeral,
+		Changes:     -1,
+	}
+	if session.Workspace == "" {
+		// Sessions from before the workspace was labelled
+		session.Workspace, _ = dockerClient.ContainerWorkspaceDir(container.ID)
+	}
+	if changes, err := dockerClient.ContainerChanges(container.ID); err == nil {
+		session.Changes = len(changes)
+		session.Uncommitted = !container.Ephemeral && len(changes) > 0
+	}
+	return session
+}
+
+// describeSessionChanges summarizes the changes column of a session
+func describeSessionChanges(session sessionInfo) string {
+	switch {
+	case session.Ephemeral:
+		return "ephemeral"
+	case session.Changes < 0:
+		return "unknown"
+	case session.Uncommitted:
+		return fmt.Sprintf("uncommitted (%d paths)", session.Changes)
+	default:
+		return "none"
+	}
+}
+
+// findSession picks a session container by name or container ID prefix
+func findSession(dockerClient *docker.Client, ref string) (docker.ContainerInfo, error) {
+	containers, err := dockerClient.FindContainers("", false)
+	if err != nil {
+		return docker.ContainerInfo{}, err
+	}
+	var matches []docker.ContainerInfo
+	for _, container := range containers {
+		if container.Name == ref {
+			return container, nil
+		}
+		if strings.HasPrefix(container.ID, ref) {
+			matches = append(matches, container)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return docker.ContainerInfo{}, fmt.Errorf("no session '%s'. Run 'devdrop sessions' to list them", ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return docker.ContainerInfo{}, fmt.Errorf("'%s' matches %d sessions; give more of the container ID or the session name", ref, len(matches))
+	}
+}
+
+func runSessionsAttach(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	session, err := findSession(dockerClient, args[0])
+	if err != nil {
+		return err
+	}
+	if session.State != "running" {
+		fmt.Printf("Starting stopped session %s...\n", session.Name)
+		if err := dockerClient.StartContainer(session.ID); err != nil {
+			return err
+		}
+	}
+	return attachSession(dockerClient, cfg, session.Environment, session)
+}
+
+func runSessionsCommit(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	session, err := findSession(dockerClient, args[0])
+	dockerClient.Close()
+	if err != nil {
+		return err
+	}
+	if session.Ephemeral {
+		return fmt.Errorf("session %s is ephemeral and can't be committed", session.Name)
+	}
+	if _, exists := cfg.Environments[session.Environment]; !exists {
+		return environmentNotFound(session.Environment)
+	}
+
+	commitContainer = session.ID
+	return runCommit(commitCmd, []string{session.Environment})
+}
+
+func runSessionsRm(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	var sessions []docker.ContainerInfo
+	for _, ref := range args {
+		session, err := findSession(dockerClient, ref)
+		if err != nil {
+			return err
+		}
+		if !sessionsRmForce {
+			if session.State == "running" {
+				return fmt.Errorf("session %s is running; stop it first or use --force", session.Name)
+			}
+			if info := describeSession(dockerClient, session); info.Uncommitted {
+				return fmt.Errorf("session %s has uncommitted changes; commit it with 'devdrop sessions commit %s' or use --force", session.Name, session.Name)
+			}
+		}
+		sessions = append(sessions, session)
+	}
+
+	if sessionsRmDryRun {
+		for _, session := range sessions {
+			fmt.Printf("Would remove session %s (%s, %s, container %s)\n", session.Name, session.Environment, session.State, shortID(session.ID))
+		}
+		fmt.Println("Dry run: nothing was removed.")
+		return nil
+	}
+
+	for _, session := range sessions {
+		if err := dockerClient.RemoveContainer(session.ID); err != nil {
+			return err
+		}
+		if err := forgetSessionContainer(cfg, session); err != nil {
+			fmt.Printf("Warning: failed to update configuration: %v\n", err)
+		}
+		output.Successf("Removed session %s", session.Name)
+	}
+	return nil
+}
+
+// forgetSessionContainer clears the container recorded for commit when it
+// is a removed session
+func forgetSessionContainer(cfg *config.Config, session docker.ContainerInfo) error {
+	if env, exists := cfg.Environments[session.Environment]; !exists || env.LastContainer != session.ID {
+		return nil
+	}
+	return cfg.Update(func(c *config.Config) error {
+		env, exists := c.Environments[session.Environment]
+		if exists && env.LastContainer == session.ID {
+			env.LastContainer = ""
+			c.Environments[session.Environment] = env
+		}
+		return nil
+	})
+}
@@ -0,0 +1,171 @@
+// Package cmd provides the share command for DevDrop.
+//
+// The share command hands an environment to teammates:
+// - Prints a reference to a pushed version of the environment and its metadata
+// - Optionally pushes the version first
+// - Shows the 'devdrop clone' command colleagues run to start from it
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var shareCmd = &cobra.Command{
+	Use:   "share [environment-name]",
+	Short: "Print a reference colleagues can clone an environment from",
+	Long: `Print a shareable reference to an environment: its image reference pinned
+to a version, the digest in the registry, its base image and tools, and the
+'devdrop clone' command a colleague runs to start their own copy.
+
+The latest committed version is shared unless --version names another.
+Use --push to push that version first, e.g. after 'devdrop commit' failed
+to push. Colleagues need pull access to the repository; the output shows
+its visibility where the registry reports it.
+
+Examples:
+  devdrop share                 # Share the current environment
+  devdrop share go --version v3 # Share a specific version
+  devdrop share go --push       # Push the version, then share it
+  devdrop share -o json         # Machine-readable output`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runShare,
+}
+
+var (
+	shareVersion string
+	sharePush    bool
+	shareOutput  string
+)
+
+func init() {
+	rootCmd.AddCommand(shareCmd)
+	shareCmd.Flags().StringVar(&shareVersion, "version", "", "Version to share (default: the latest)")
+	shareCmd.Flags().BoolVar(&sharePush, "push", false, "Push the version to the registry before sharing it")
+	shareCmd.Flags().StringVarP(&shareOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// shareInfo is what 'devdrop share' prints about an environment
+type shareInfo struct {
+	Environment string   `json:"environment" yaml:"environment"`
+	Reference   string   `json:"reference" yaml:"reference"`
+	Digest      string   `json:"digest,omitempty" yaml:"digest,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	BaseImage   string   `json:"base_image,omitempty" yaml:"base_image,omitempty"`
+	Platforms   []string `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	Tools       []string `json:"tools,omitempty" yaml:"tools,omitempty"`
+	Visibility  string   `json:"visibility" yaml:"visibility"`
+	Clone       string   `json:"clone" yaml:"clone"`
+}
+
+func runShare(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(shareOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.Username == "" {
+		return errLoginRequired
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+	if env.LocalOnly {
+		return errLocalOnly(targetEnv, "shared")
+	}
+
+	tag := shareVersion
+	if tag == "" {
+		tag = env.LatestVersion
+	}
+	if tag == "" {
+		tag = "latest"
+	}
+	version, found := env.FindVersion(tag)
+	if tag != "latest" && !found {
+		return fmt.Errorf("version '%s' of %s not found. Run 'devdrop history %s' to list versions", tag, targetEnv, targetEnv)
+	}
+	ref := cfg.GetEnvironmentImageRef(targetEnv, tag)
+	authToken := environmentAuthToken(cfg, targetEnv)
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	if sharePush {
+		if authToken == "" {
+			return fmt.Errorf("missing authentication token for %s. Please run 'devdrop login' again", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)))
+		}
+		if !dockerClient.ImageExists(ref) {
+			return fmt.Errorf("%s is not available locally to push. Run 'devdrop pull %s' or 'devdrop rollback %s %s' first", ref, targetEnv, targetEnv, tag)
+		}
+		if shareOutput == output.FormatText {
+			fmt.Printf("Pushing %s...\n", ref)
+		} else {
+			dockerClient.SetProgressOutput(os.Stderr)
+		}
+		if err := dockerClient.PushImage(ref, authToken); err != nil {
+			return fmt.Errorf("failed to push image: %w", err)
+		}
+	}
+
+	manifest, err := dockerClient.RemoteManifest(ref, authToken)
+	if err != nil {
+		return fmt.Errorf("%s is not in the registry: %w. Use --push to push it", ref, err)
+	}
+
+	info := shareInfo{
+		Environment: targetEnv,
+		Reference:   ref,
+		Digest:      manifest.Digest,
+		Description: env.Description,
+		BaseImage:   env.BaseImage,
+		Visibility:  repositoryVisibility(cfg, targetEnv),
+		Clone:       "devdrop clone " + ref,
+	}
+	if found {
+		info.Platforms = version.Platforms
+	}
+	if tag == env.LatestVersion || tag == "latest" {
+		for _, name := range env.Tools.Names() {
+			info.Tools = append(info.Tools, name+" "+env.Tools[name])
+		}
+	}
+
+	if shareOutput != output.FormatText {
+		return output.Render(os.Stdout, shareOutput, info)
+	}
+
+	fmt.Printf("Environment %s:\n", targetEnv)
+	fmt.Printf("  Reference:   %s\n", info.Reference)
+	fmt.Printf("  Digest:      %s\n", info.Digest)
+	if info.Description != "" {
+		fmt.Printf("  Description: %s\n", info.Description)
+	}
+	if info.BaseImage != "" {
+		fmt.Printf("  Base image:  %s\n", info.BaseImage)
+	}
+	if len(info.Platforms) > 0 {
+		fmt.Printf("  Platforms:   %s\n", strings.Join(info.Platforms, ", "))
+	}
+	if len(info.Tools) > 0 {
+		fmt.Printf("  Tools:       %s\n", strings.Join(info.Tools, ", "))
+	}
+	fmt.Printf("  Registry:    %s (%s)\n", registryDisplayName(cfg.GetEnvironmentRegistry(targetEnv)), info.Visibility)
+	fmt.Println()
+	fmt.Println("Colleagues can start their own copy with:")
+	fmt.Printf("  %s\n", info.Clone)
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package cmd provides the size command for DevDrop.
+//
+// The size command reports how an environment's image grows:
+// - Lists the size, layer count and growth of every local version
+// - Lists the layers of the newest local version, base image layers grouped
+// - Points to 'devdrop commit --squash' when commits stacked up layers
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var sizeCmd = &cobra.Command{
+	Use:   "size [environment-name]",
+	Short: "Show how an environment's image size grew over its versions",
+	Long: `Show the size of every version of an environment available locally,
+how many layers it has and how much it grew over the previous version (or
+the base image for the first one), followed by the layers of the newest
+version with the base image's layers grouped together.
+
+Every commit adds a layer, and files deleted in a session still take up
+space in the layers below, so repeated commits make images balloon. Use
+'devdrop commit --squash' to flatten the next commit into a single layer.
+
+Versions that were never pulled to this machine are listed as not local.
+
+Examples:
+  devdrop size                 # The current environment
+  devdrop size go              # devdrop-go
+  devdrop size go -o json      # Machine-readable output`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSize,
+}
+
+var sizeOutput string
+
+func init() {
+	rootCmd.AddCommand(sizeCmd)
+	sizeCmd.Flags().StringVarP(&sizeOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// sizeReport is the output of 'devdrop size'
+type sizeReport struct {
+	Environment string `json:"environment" yaml:"environment"`
+	BaseImage   string `json:"base_image,omitempty" yaml:"base_image,omitempty"`
+	// BaseSize is the base image's size, zero when it isn't local
+	BaseSize int64         `json:"base_size,omitempty" yaml:"base_size,omitempty"`
+	Versions []versionSize `json:"versions" yaml:"versions"`
+	// LayersOf is the version whose layers are listed
+	LayersOf string      `json:"layers_of,omitempty" yaml:"layers_of,omitempty"`
+	Layers   []layerSize `json:"layers,omitempty" yaml:"layers,omitempty"`
+}
+
+// versionSize is the size of one version of an environment
+type versionSize struct {
+	Tag     string    `json:"tag" yaml:"tag"`
+	Created time.Time `json:"created" yaml:"created"`
+	Local   bool      `json:"local" yaml:"local"`
+	Size    int64     `json:"size,omitempty" yaml:"size,omitempty"`
+	Layers  int       `json:"layers,omitempty" yaml:"layers,omitempty"`
+	// Growth is the size added over the previous local version, or over
+	// the base image for the first one
+	Growth int64 `json:"growth,omitempty" yaml:"growth,omitempty"`
+}
+
+// layerSize is a layer of an image
+type layerSize struct {
+	Size      int64     `json:"size" yaml:"size"`
+	Created   time.Time `json:"created" yaml:"created"`
+	CreatedBy string    `json:"created_by" yaml:"created_by"`
+	// Base is set for layers of the base image
+	Base bool `json:"base,omitempty" yaml:"base,omitempty"`
+}
+
+func runSize(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(sizeOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	report, err := environmentSizes(dockerClient, cfg, targetEnv, env)
+	if err != nil {
+		return err
+	}
+
+	if sizeOutput != output.FormatText {
+		return output.Render(os.Stdout, sizeOutput, report)
+	}
+	printSizeReport(report)
+	return nil
+}
+
+// environmentSizes collects the sizes of an environment's local versions
+// and the layers of the newest one
+func environmentSizes(dockerClient *docker.Client, cfg *config.Config, targetEnv string, env config.Environment) (*sizeReport, error) {
+	report := &sizeReport{Environment: targetEnv, BaseImage: env.BaseImage, Versions: []versionSize{}}
+
+	var baseLayers []docker.ImageLayer
+	if env.BaseImage != "" && dockerClient.ImageExists(env.BaseImage) {
+		base, err := dockerClient.InspectImageDetails(env.BaseImage)
+		if err != nil {
+			return nil, err
+		}
+		report.BaseSize = base.Size
+		baseLayers = base.Layers
+	}
+
+	previous := report.BaseSize
+	var newest *docker.ImageDetails
+	for _, version := range env.Versions {
+		size := versionSize{Tag: version.Tag, Created: version.Created}
+		ref := cfg.GetEnvironmentImageRef(targetEnv, version.Tag)
+		if dockerClient.ImageExists(ref) {
+			details, err := dockerClient.InspectImageDetails(ref)
+			if err != nil {
+				return nil, err
+			}
+			size.Local = true
+			size.Size = details.Size
+			size.Layers = filesystemLayers(details.Layers)
+			if previous > 0 {
+				size.Growth = details.Size - previous
+			}
+			previous = details.Size
+			newest = &details
+			report.LayersOf = version.Tag
+		}
+		report.Versions = append(report.Versions, size)
+	}
+
+	if newest != nil {
+		// Squashed images don't start with the base image's layers
+		shared := len(baseLayers)
+		if !hasLayerPrefix(newest.Layers, baseLayers) {
+			shared = 0
+		}
+		for i, layer := range newest.Layers {
+			createdBy := layer.Comment
+			if createdBy == "" {
+				createdBy = strings.TrimPrefix(layer.CreatedBy, "/bin/sh -c #(nop) ")
+			}
+			report.Layers = append(report.Layers, layerSize{
+				Size:      layer.Size,
+				Created:   layer.Created,
+				CreatedBy: createdBy,
+				Base:      i < shared,
+			})
+		}
+	}
+	return report, nil
+}
+
+// hasLayerPrefix reports whether an image's history starts with prefix
+func hasLayerPrefix(layers, prefix []docker.ImageLayer) bool {
+	if len(prefix) > len(layers) {
+		return false
+	}
+	for i, layer := range prefix {
+		if layers[i].CreatedBy != layer.CreatedBy || layers[i].Size != layer.Size {
+			return false
+		}
+	}
+	return true
+}
+
+// filesystemLayers counts the history steps that added files
+func filesystemLayers(layers []docker.ImageLayer) int {
+	count := 0
+	for _, layer := range layers {
+		if layer.Size > 0 {
+			count++
+		}
+	}
+	return count
+}
+
+func printSizeReport(report *sizeReport) {
+	fmt.Printf("Environment: %s\n", report.Environment)
+	if report.BaseImage != "" {
+		if report.BaseSize > 0 {
+			fmt.Printf("Base image: %s (%s)\n", report.BaseImage, units.HumanSize(float64(report.BaseSize)))
+		} else {
+			fmt.Printf("Base image: %s (not available locally)\n", report.BaseImage)
+		}
+	}
+	fmt.Println()
+
+	if len(report.Versions) == 0 {
+		fmt.Printf("No versions yet. Run 'devdrop commit %s' to create one.\n", report.Environment)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tSIZE\tLAYERS\tGROWTH")
+	for _, version := range report.Versions {
+		if !version.Local {
+			fmt.Fprintf(w, "%s\t%s\tnot local\t-\t-\n", version.Tag, output.RelativeTime(version.Created))
+			continue
+		}
+		growth := "-"
+		if version.Growth != 0 {
+			growth = signedSize(version.Growth)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", version.Tag, output.RelativeTime(version.Created),
+			units.HumanSize(float64(version.Size)), version.Layers, growth)
+	}
+	w.Flush()
+
+	if report.LayersOf == "" {
+		return
+	}
+
+	fmt.Println()
+	fmt.Printf("Layers of %s, oldest first:\n", report.LayersOf)
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SIZE\tCREATED\tCREATED BY")
+	var baseSize int64
+	baseCount, commitLayers := 0, 0
+	for _, layer := range report.Layers {
+		if layer.Base {
+			baseSize += layer.Size
+			baseCount++
+		}
+	}
+	if baseCount > 0 {
+		fmt.Fprintf(w, "%s\t-\t(%d steps of the base image)\n", units.HumanSize(float64(baseSize)), baseCount)
+	}
+	for _, layer := range report.Layers {
+		if layer.Base || layer.Size == 0 {
+			continue
+		}
+		commitLayers++
+		createdBy := layer.CreatedBy
+		if len(createdBy) > 60 {
+			createdBy = createdBy[:57] + "..."
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", units.HumanSize(float64(layer.Size)), output.RelativeTime(layer.Created), createdBy)
+	}
+	w.Flush()
+
+	if commitLayers > 1 {
+		fmt.Println()
+		fmt.Printf("%d layers were added by builds and commits. Run 'devdrop commit %s --squash' to flatten the next commit into one.\n", commitLayers, report.Environment)
+	}
+}
+
+// signedSize formats a size difference with its sign
+func signedSize(size int64) string {
+	if size < 0 {
+		return "-" + units.HumanSize(float64(-size))
+	}
+	return "+" + units.HumanSize(float64(size))
+}
@@ -0,0 +1,281 @@
+// Package cmd provides the snapshot command for DevDrop.
+//
+// The snapshot command checkpoints session containers locally:
+// - Commits the session container of an environment to a timestamped local image
+// - Never pushes and leaves the environment's versions untouched
+// - Lists and removes snapshots; 'devdrop restore' starts a session from one
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot [environment-name]",
+	Short: "Checkpoint the session container of an environment locally",
+	Long: `Commit the session container of an environment to a local snapshot, a
+checkpoint to come back to while experimenting. Unlike 'devdrop commit', a
+snapshot is never pushed, doesn't become a version of the environment and
+skips the pre_commit hooks.
+
+The session container is the one 'devdrop commit' would commit: a session
+still running in another terminal is paused for a moment while it is
+snapshotted. Snapshots are named after the time they were taken unless
+--name is given, and are kept as devdrop.local/snapshots/<environment>
+images until removed with 'devdrop snapshot rm'.
+
+Start a new session from a snapshot with 'devdrop restore'. That session is
+the environment's session container afterwards, so 'devdrop commit' turns
+an experiment that worked out into the next version.
+
+Examples:
+  devdrop snapshot                      # Checkpoint the current environment
+  devdrop snapshot go --name before-upgrade
+  devdrop snapshot ls                   # Snapshots of all environments
+  devdrop restore before-upgrade        # Branch a new session from it
+  devdrop snapshot rm go:before-upgrade # Remove it`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSnapshot,
+}
+
+var snapshotLsCmd = &cobra.Command{
+	Use:   "ls [environment-name]",
+	Short: "List snapshots",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runSnapshotLs,
+}
+
+var snapshotRmCmd = &cobra.Command{
+	Use:   "rm <snapshot>...",
+	Short: "Remove snapshots",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runSnapshotRm,
+}
+
+var (
+	snapshotName   string
+	snapshotOutput string
+)
+
+func init() {
+	rootCmd.AddCommand(snapshotCmd)
+	snapshotCmd.AddCommand(snapshotLsCmd, snapshotRmCmd)
+	snapshotCmd.Flags().StringVar(&snapshotName, "name", "", "Name the snapshot instead of using the time it was taken")
+	snapshotLsCmd.Flags().StringVarP(&snapshotOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// snapshotRepository is the local repository of an environment's snapshots.
+// Nothing is ever pushed from devdrop.local.
+func snapshotRepository(envName string) string {
+	return config.LocalRepositoryHost + "/snapshots/" + envName
+}
+
+// snapshotTimeFormat names snapshots taken without --name
+const snapshotTimeFormat = "20060102-150405"
+
+// snapshotNamePattern matches what Docker accepts as a tag
+var snapshotNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+// snapshot is a local snapshot of an environment as listed by 'devdrop
+// snapshot ls'
+type snapshot struct {
+	Environment string    `json:"environment" yaml:"environment"`
+	Name        string    `json:"name" yaml:"name"`
+	Image       string    `json:"image" yaml:"image"`
+	Created     time.Time `json:"created" yaml:"created"`
+	Size        int64     `json:"size" yaml:"size"`
+}
+
+func runSnapshot(cmd *cobra.Command, args []string) error {
+	if snapshotName != "" && !snapshotNamePattern.MatchString(snapshotName) {
+		return &usageError{err: fmt.Errorf("invalid snapshot name '%s': use letters, digits, '_', '.' and '-'", snapshotName)}
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containerID, err := sessionContainer(dockerClient, targetEnv, env, "", "snapshot")
+	if err != nil {
+		return err
+	}
+	if containerID == "" {
+		return fmt.Errorf("no session container to snapshot for environment '%s'. Run 'devdrop run' first", targetEnv)
+	}
+
+	name := snapshotName
+	if name == "" {
+		name = time.Now().Format(snapshotTimeFormat)
+	}
+	ref := snapshotRepository(targetEnv) + ":" + name
+	if dockerClient.ImageExists(ref) {
+		return fmt.Errorf("snapshot '%s' of %s already exists; remove it with 'devdrop snapshot rm %s:%s' or pick another --name", name, targetEnv, targetEnv, name)
+	}
+
+	opts := docker.CommitOptions{Comment: "snapshot " + name, Pause: true}
+	if _, err := checkRunningSession(dockerClient, containerID, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("Snapshotting container %s of %s...\n", shortID(containerID), targetEnv)
+	if err := dockerClient.CommitContainer(containerID, ref, opts); err != nil {
+		return fmt.Errorf("failed to snapshot container: %w", err)
+	}
+
+	output.Successf("Saved snapshot '%s' of %s", name, targetEnv)
+	fmt.Printf("Run 'devdrop restore %s:%s' to start a session from it.\n", targetEnv, name)
+	return nil
+}
+
+func runSnapshotLs(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(snapshotOutput); err != nil {
+		return err
+	}
+
+	envName := ""
+	if len(args) > 0 {
+		envName = config.EnsureDevDropPrefix(args[0])
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	snapshots, err := listSnapshots(dockerClient, envName)
+	if err != nil {
+		return err
+	}
+
+	if snapshotOutput != output.FormatText {
+		return output.Render(os.Stdout, snapshotOutput, snapshots)
+	}
+
+	if len(snapshots) == 0 {
+		fmt.Println("No snapshots. Take one with 'devdrop snapshot'.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tSNAPSHOT\tCREATED\tSIZE")
+	for _, s := range snapshots {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Environment, s.Name, output.RelativeTime(s.Created), units.HumanSize(float64(s.Size)))
+	}
+	return w.Flush()
+}
+
+func runSnapshotRm(cmd *cobra.Command, args []string) error {
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	snapshots, err := listSnapshots(dockerClient, "")
+	if err != nil {
+		return err
+	}
+
+	for _, arg := range args {
+		s, err := findSnapshot(snapshots, arg)
+		if err != nil {
+			return err
+		}
+		if err := dockerClient.RemoveImageTag(s.Image); err != nil {
+			return err
+		}
+		output.Successf("Removed snapshot '%s' of %s", s.Name, s.Environment)
+	}
+	return nil
+}
+
+// listSnapshots returns the snapshots of an environment, or of all
+// environments when envName is empty, newest first
+func listSnapshots(dockerClient *docker.Client, envName string) ([]snapshot, error) {
+	images, err := dockerClient.ListImages()
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := config.LocalRepositoryHost + "/snapshots/"
+	snapshots := []snapshot{}
+	for _, image := range images {
+		for _, tag := range image.RepoTags {
+			repo, name, ok := strings.Cut(tag, ":")
+			if !ok || !strings.HasPrefix(repo, prefix) {
+				continue
+			}
+			env := strings.TrimPrefix(repo, prefix)
+			if envName != "" && env != envName {
+				continue
+			}
+			snapshots = append(snapshots, snapshot{
+				Environment: env,
+				Name:        name,
+				Image:       tag,
+				Created:     image.Created,
+				Size:        image.Size,
+			})
+		}
+	}
+	sort.SliceStable(snapshots, func(i, j int) bool {
+		if !snapshots[i].Created.Equal(snapshots[j].Created) {
+			return snapshots[i].Created.After(snapshots[j].Created)
+		}
+		return snapshots[i].Image < snapshots[j].Image
+	})
+	return snapshots, nil
+}
+
+// findSnapshot looks up a snapshot given as <environment>:<name> or just
+// <name> when only one environment has a snapshot of that name
+func findSnapshot(snapshots []snapshot, arg string) (snapshot, error) {
+	envName, name, qualified := strings.Cut(arg, ":")
+	if !qualified {
+		envName, name = "", arg
+	} else {
+		envName = config.EnsureDevDropPrefix(envName)
+	}
+
+	var matches []snapshot
+	for _, s := range snapshots {
+		if s.Name == name && (envName == "" || s.Environment == envName) {
+			matches = append(matches, s)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return snapshot{}, fmt.Errorf("snapshot '%s' not found. Run 'devdrop snapshot ls' to see available snapshots", arg)
+	case 1:
+		return matches[0], nil
+	}
+	var candidates []string
+	for _, s := range matches {
+		candidates = append(candidates, s.Environment+":"+s.Name)
+	}
+	return snapshot{}, fmt.Errorf("several environments have a snapshot '%s'; use one of %s", arg, strings.Join(candidates, ", "))
+}
@@ -5,9 +5,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/oysteinje/devdrop/pkg/config"
-	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/registry"
 	"github.com/spf13/cobra"
 )
 
@@ -20,81 +23,216 @@ var statusCmd = &cobra.Command{
 - Environment configuration details
 - Local vs remote sync status
 
-Example:
-  devdrop status`,
+Examples:
+  devdrop status
+  devdrop status -o json        # Machine-readable output for scripts`,
 	RunE: runStatus,
 }
 
+var statusOutput string
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringVarP(&statusOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// statusResult is the data shown by status, rendered as text, JSON or YAML
+type statusResult struct {
+	LoggedIn     bool               `json:"logged_in" yaml:"logged_in"`
+	User         string             `json:"user,omitempty" yaml:"user,omitempty"`
+	Registry     string             `json:"registry,omitempty" yaml:"registry,omitempty"`
+	Current      *statusEnvironment `json:"current,omitempty" yaml:"current,omitempty"`
+	Environments []string           `json:"environments" yaml:"environments"`
+}
+
+// statusEnvironment describes the current environment
+type statusEnvironment struct {
+	Name          string     `json:"name" yaml:"name"`
+	Image         string     `json:"image" yaml:"image"`
+	BaseImage     string     `json:"base_image" yaml:"base_image"`
+	BaseDigest    string     `json:"base_image_digest,omitempty" yaml:"base_image_digest,omitempty"`
+	Description   string     `json:"description,omitempty" yaml:"description,omitempty"`
+	LatestVersion string     `json:"latest_version,omitempty" yaml:"latest_version,omitempty"`
+	Created       time.Time  `json:"created" yaml:"created"`
+	LastUpdated   *time.Time `json:"last_updated,omitempty" yaml:"last_updated,omitempty"`
+	Container     string     `json:"container,omitempty" yaml:"container,omitempty"`
+	// ContainerState is the Docker state of the container (running, exited,
+	// removed), or empty if Docker couldn't be reached
+	ContainerState string `json:"container_state,omitempty" yaml:"container_state,omitempty"`
+	// ImageLocal reports whether the image exists locally; unset if Docker
+	// couldn't be reached
+	ImageLocal *bool `json:"image_local,omitempty" yaml:"image_local,omitempty"`
+	// Containers are all containers labelled with the environment, found
+	// through Docker regardless of what the config recorded
+	Containers []statusContainer `json:"containers,omitempty" yaml:"containers,omitempty"`
+	// Sync compares the local image with the one in the registry
+	Sync *syncStatus `json:"sync,omitempty" yaml:"sync,omitempty"`
+}
+
+// statusContainer is a container labelled with the current environment
+type statusContainer struct {
+	ID      string    `json:"id" yaml:"id"`
+	State   string    `json:"state" yaml:"state"`
+	Version string    `json:"version,omitempty" yaml:"version,omitempty"`
+	Created time.Time `json:"created" yaml:"created"`
 }
 
 func runStatus(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(statusOutput); err != nil {
+		return err
+	}
+
 	cfg, err := config.Load()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	if cfg.Username == "" {
+	result := buildStatusResult(cfg)
+	if statusOutput != output.FormatText {
+		return output.Render(os.Stdout, statusOutput, result)
+	}
+
+	printStatusResult(cfg, result)
+	return nil
+}
+
+// buildStatusResult collects the status of the current environment,
+// querying Docker for container and image state when needed
+func buildStatusResult(cfg *config.Config) statusResult {
+	result := statusResult{
+		LoggedIn:     cfg.Username != "",
+		Environments: cfg.EnvironmentNames(),
+	}
+	if !result.LoggedIn {
+		return result
+	}
+	result.User = cfg.Username
+	result.Registry = registry.NormalizeHost(cfg.Registry)
+
+	currentEnv := cfg.GetCurrentEnvironment()
+	if currentEnv == "" {
+		return result
+	}
+
+	env := cfg.Environments[currentEnv]
+	current := &statusEnvironment{
+		Name:          currentEnv,
+		Image:         cfg.GetEnvironmentImageName(currentEnv),
+		BaseImage:     env.BaseImage,
+		BaseDigest:    env.BaseImageDigest,
+		Description:   env.Description,
+		LatestVersion: env.LatestVersion,
+		Created:       env.Created,
+		LastUpdated:   optionalTime(env.LastUpdated),
+		Container:     env.LastContainer,
+	}
+	result.Current = current
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		sync := environmentSyncStatus(nil, cfg, currentEnv)
+		current.Sync = &sync
+		return result
+	}
+	defer dockerClient.Close()
+
+	imageLocal := dockerClient.ImageExists(current.Image)
+	current.ImageLocal = &imageLocal
+	if current.Container != "" {
+		if state, err := dockerClient.ContainerState(current.Container); err == nil {
+			current.ContainerState = state
+		}
+	}
+
+	if containers, err := dockerClient.FindContainers(currentEnv, false); err == nil {
+		for _, container := range containers {
+			current.Containers = append(current.Containers, statusContainer{
+				ID:      container.ID,
+				State:   container.State,
+				Version: container.Version,
+				Created: container.Created,
+			})
+		}
+	}
+
+	sync := environmentSyncStatus(dockerClient, cfg, currentEnv)
+	current.Sync = &sync
+	return result
+}
+
+// printStatusResult renders the status result as text
+func printStatusResult(cfg *config.Config, result statusResult) {
+	if !result.LoggedIn {
 		fmt.Println("Status: Not logged in")
 		fmt.Println("Run 'devdrop login' to authenticate with DockerHub")
-		return nil
+		return
 	}
 
-	fmt.Printf("User: %s\n", cfg.Username)
+	fmt.Printf("User: %s\n", result.User)
 
-	if !cfg.HasEnvironments() {
+	if len(result.Environments) == 0 {
 		fmt.Println("Status: No environments configured")
 		fmt.Println("Run 'devdrop init' to create a new environment or 'devdrop pull' to use existing ones")
-		return nil
+		return
 	}
 
-	currentEnv := cfg.GetCurrentEnvironment()
-	if currentEnv == "" {
+	current := result.Current
+	if current == nil {
 		fmt.Println("Status: No active environment")
 		fmt.Println("Run 'devdrop switch' to select an environment")
-		return nil
+		return
 	}
 
-	env := cfg.Environments[currentEnv]
-	fmt.Printf("Current Environment: %s\n", currentEnv)
-	fmt.Printf("Base Image: %s\n", env.BaseImage)
-	fmt.Printf("Created: %s\n", env.Created.Format("2006-01-02 15:04:05"))
-	if !env.LastUpdated.IsZero() {
-		fmt.Printf("Last Updated: %s\n", env.LastUpdated.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Current Environment: %s\n", current.Name)
+	fmt.Printf("Base Image: %s\n", current.BaseImage)
+	if current.BaseDigest != "" {
+		fmt.Printf("Base Digest: %s\n", current.BaseDigest)
+	}
+	fmt.Printf("Created: %s\n", output.TimestampWithAge(current.Created))
+	if current.LastUpdated != nil {
+		fmt.Printf("Last Updated: %s\n", output.TimestampWithAge(*current.LastUpdated))
 	}
 
-	if env.Description != "" {
-		fmt.Printf("Description: %s\n", env.Description)
+	if current.Description != "" {
+		fmt.Printf("Description: %s\n", current.Description)
 	}
 
 	// Show container status
-	if env.LastContainer != "" {
-		dockerClient, err := docker.NewClient()
-		if err != nil {
-			fmt.Printf("Last Container: %s (Docker connection failed)\n", env.LastContainer)
+	if current.Container != "" {
+		if current.ContainerState == "" {
+			fmt.Printf("Last Container: %s (Docker connection failed)\n", current.Container)
 		} else {
-			defer dockerClient.Close()
-			fmt.Printf("Last Container: %s\n", env.LastContainer)
-			// TODO: Add container status check (running, stopped, etc.)
+			fmt.Printf("Last Container: %s (%s)\n", current.Container, current.ContainerState)
+		}
+	}
+
+	// Containers found by label, including ones the config lost track of
+	if len(current.Containers) > 0 {
+		fmt.Println("Containers:")
+		for _, container := range current.Containers {
+			version := container.Version
+			if version == "" {
+				version = "base image"
+			}
+			fmt.Printf("  %s (%s, %s, created %s)\n", shortID(container.ID), container.State, version, output.RelativeTime(container.Created))
 		}
 	}
 
 	// Show image status
-	expectedImage := cfg.GetEnvironmentImageName(currentEnv)
-	fmt.Printf("Expected Image: %s\n", expectedImage)
+	fmt.Printf("Expected Image: %s\n", current.Image)
+	if current.Sync != nil {
+		fmt.Printf("Sync: %s\n", describeSync(cfg, current.Name, *current.Sync))
+	}
 
 	// Show total environments
-	fmt.Printf("\nTotal Environments: %d\n", len(cfg.Environments))
+	fmt.Printf("\nTotal Environments: %d\n", len(result.Environments))
 
-	if len(cfg.Environments) > 1 {
+	if len(result.Environments) > 1 {
 		fmt.Println("Other Environments:")
-		for name := range cfg.Environments {
-			if name != currentEnv {
+		for _, name := range result.Environments {
+			if name != current.Name {
 				fmt.Printf("  %s\n", name)
 			}
 		}
 	}
-
-	return nil
-}
\ No newline at end of file
+}
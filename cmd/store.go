@@ -0,0 +1,327 @@
+// Package cmd provides the store command for DevDrop.
+//
+// The store command manages the experimental content-addressed store:
+// - Lists environment tags and the image digests they resolve to
+// - Switches an environment to a recorded version instantly, without pulling
+// - Garbage collects images no longer referenced by any tag
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Manage the experimental content-addressed environment store",
+	Long: `Manage DevDrop's experimental content-addressed environment store.
+
+When enabled, every commit, build, pull, rollback and adopt records the
+resulting images by digest in ~/.config/devdrop/store, with tags of each
+environment pointing at digests. This makes switching between versions
+instant and lets garbage collection remove exactly the images that are no
+longer referenced.
+
+Enable it by adding this line to ~/.config/devdrop/config.yaml:
+  experimental_store: true
+
+Examples:
+  devdrop store ls                  # Show recorded tags and digests
+  devdrop store checkout myenv v2   # Run v2 of devdrop-myenv from now on
+  devdrop store gc --keep 3         # Keep the last 3 versions, remove the rest`,
+}
+
+var storeLsCmd = &cobra.Command{
+	Use:   "ls [environment-name]",
+	Short: "List recorded environment tags and digests",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runStoreLs,
+}
+
+var storeCheckoutCmd = &cobra.Command{
+	Use:   "checkout <environment-name> <version>",
+	Short: "Point an environment's local latest tag at a recorded version",
+	Long: `Point the local latest tag of an environment at a recorded version, so
+'devdrop run' uses it from now on. Nothing is pulled or pushed; use
+'devdrop rollback' to change the version in your registry as well.`,
+	Args: cobra.ExactArgs(2),
+	RunE: runStoreCheckout,
+}
+
+var storeGCCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Remove images no longer referenced by any environment tag",
+	Long: `Remove recorded images that no tag points at anymore, for example images
+of environments that were removed or versions dropped with --keep.
+
+With --keep N, only the N most recent version tags of each environment
+(plus latest) are kept before collecting. Images still used by a
+container are skipped. Only the tags the dropped refs stand for are
+removed; an image that also has other tags, e.g. one you added, stays.`,
+	Args: cobra.NoArgs,
+	RunE: runStoreGC,
+}
+
+var (
+	storeGCKeep   int
+	storeGCDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(storeLsCmd, storeCheckoutCmd, storeGCCmd)
+	storeGCCmd.Flags().IntVar(&storeGCKeep, "keep", 0, "Keep only the N most recent versions of each environment (0 keeps all)")
+	storeGCCmd.Flags().BoolVar(&storeGCDryRun, "dry-run", false, "Show what would be removed without removing anything")
+}
+
+// loadStoreConfig loads the config and checks that the store is enabled
+func loadStoreConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if !cfg.ExperimentalStore {
+		return nil, fmt.Errorf("the environment store is experimental. Enable it with 'experimental_store: true' in ~/.config/devdrop/config.yaml")
+	}
+	return cfg, nil
+}
+
+func runStoreLs(cmd *cobra.Command, args []string) error {
+	if _, err := loadStoreConfig(); err != nil {
+		return err
+	}
+
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	envs, err := st.Environments()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 {
+		envs = []string{config.EnsureDevDropPrefix(args[0])}
+	}
+
+	if len(envs) == 0 {
+		fmt.Println("The store is empty. Commit, build or pull an environment to record it.")
+		return nil
+	}
+
+	for _, env := range envs {
+		refs, err := st.Refs(env)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%s:\n", env)
+		tags := make([]string, 0, len(refs))
+		for tag := range refs {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+
+		for _, tag := range tags {
+			digest := refs[tag]
+			size := ""
+			if obj, err := st.Get(digest); err == nil && obj.Size > 0 {
+				size = units.HumanSize(float64(obj.Size))
+			}
+			fmt.Printf("  %-10s %s  %s\n", tag, shortDigest(digest), size)
+		}
+	}
+
+	return nil
+}
+
+func runStoreCheckout(cmd *cobra.Command, args []string) error {
+	cfg, err := loadStoreConfig()
+	if err != nil {
+		return err
+	}
+
+	targetEnv := config.EnsureDevDropPrefix(args[0])
+	tag := args[1]
+
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	digest, err := st.Ref(targetEnv, tag)
+	if err != nil {
+		return fmt.Errorf("version '%s' of '%s' is not in the store. Run 'devdrop store ls %s' to see recorded versions", tag, targetEnv, targetEnv)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	if err := dockerClient.TagImage(digest, cfg.GetEnvironmentImageName(targetEnv)); err != nil {
+		return fmt.Errorf("failed to switch version (was the image removed outside devdrop?): %w", err)
+	}
+	if err := st.SetRef(targetEnv, "latest", digest); err != nil {
+		return err
+	}
+
+	output.Successf("%s now runs %s (%s)", targetEnv, tag, shortDigest(digest))
+	return nil
+}
+
+func runStoreGC(cmd *cobra.Command, args []string) error {
+	cfg, err := loadStoreConfig()
+	if err != nil {
+		return err
+	}
+
+	st, err := openStore()
+	if err != nil {
+		return err
+	}
+
+	envs, err := st.Environments()
+	if err != nil {
+		return err
+	}
+
+	// Work out which refs to drop first, so a dry run reports the same
+	// images a real run would remove
+	removedEnvs := make(map[string]bool)
+	droppedTags := make(map[string]bool)
+	for _, env := range envs {
+		// Refs of removed environments no longer protect their images
+		envConfig, exists := cfg.Environments[env]
+		if !exists {
+			fmt.Printf("Dropping tags of removed environment %s\n", env)
+			removedEnvs[env] = true
+			continue
+		}
+
+		for _, tag := range oldVersionTags(envConfig, storeGCKeep) {
+			fmt.Printf("Dropping tag %s:%s\n", env, tag)
+			droppedTags[env+":"+tag] = true
+		}
+	}
+
+	unreferenced, err := st.Unreferenced(func(env, tag string) bool {
+		return removedEnvs[env] || droppedTags[env+":"+tag]
+	})
+	if err != nil {
+		return err
+	}
+
+	// The image tags the dropped refs stand for; other tags of the same
+	// images weren't made by the store and stay
+	imageRefs := make(map[string][]string)
+	for _, env := range envs {
+		refs, err := st.Refs(env)
+		if err != nil {
+			return err
+		}
+		for tag, digest := range refs {
+			if !removedEnvs[env] && !droppedTags[env+":"+tag] {
+				continue
+			}
+			if ref := cfg.GetEnvironmentImageRef(env, tag); ref != "" {
+				imageRefs[digest] = append(imageRefs[digest], ref)
+			}
+		}
+	}
+
+	if storeGCDryRun {
+		for _, obj := range unreferenced {
+			fmt.Printf("Would remove %s (%s, %s)\n", shortDigest(obj.Digest), obj.Environment, units.HumanSize(float64(obj.Size)))
+		}
+		fmt.Println("Dry run: nothing was removed.")
+		return nil
+	}
+
+	for env := range removedEnvs {
+		if err := st.RemoveEnvironment(env); err != nil {
+			return err
+		}
+	}
+	for ref := range droppedTags {
+		env, tag, _ := strings.Cut(ref, ":")
+		if err := st.RemoveRef(env, tag); err != nil {
+			return err
+		}
+	}
+
+	if len(unreferenced) == 0 {
+		fmt.Println("Nothing to collect.")
+		return nil
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	var reclaimed int64
+	removed := 0
+	for _, obj := range unreferenced {
+		fmt.Printf("Removing %s (%s, %s)\n", shortDigest(obj.Digest), obj.Environment, units.HumanSize(float64(obj.Size)))
+		failed := false
+		for _, ref := range imageRefs[obj.Digest] {
+			if !dockerClient.ImageExists(ref) {
+				continue
+			}
+			if err := dockerClient.RemoveImageTag(ref); err != nil {
+				fmt.Printf("  skipped: %v\n", err)
+				failed = true
+				break
+			}
+		}
+		if failed {
+			continue
+		}
+		if err := st.Remove(obj.Digest); err != nil {
+			return err
+		}
+		if dockerClient.ImageExists(obj.Digest) {
+			fmt.Println("  kept the image: it has tags the store didn't record")
+			continue
+		}
+		reclaimed += obj.Size
+		removed++
+	}
+
+	output.Successf("Removed %d image(s), reclaimed %s", removed, units.HumanSize(float64(reclaimed)))
+	return nil
+}
+
+// oldVersionTags returns the version tags beyond the keep most recent ones.
+// The latest version is always kept; keep 0 keeps everything.
+func oldVersionTags(env config.Environment, keep int) []string {
+	if keep <= 0 || len(env.Versions) <= keep {
+		return nil
+	}
+
+	var tags []string
+	for _, version := range env.Versions[:len(env.Versions)-keep] {
+		if version.Tag != env.LatestVersion {
+			tags = append(tags, version.Tag)
+		}
+	}
+	return tags
+}
+
+// shortDigest abbreviates a digest for display
+func shortDigest(digest string) string {
+	hex := digest[strings.Index(digest, ":")+1:]
+	if len(hex) > 12 {
+		return hex[:12]
+	}
+	return hex
+}
@@ -0,0 +1,207 @@
+// Package cmd provides the suggest command for DevDrop.
+//
+// The suggest command helps pick an environment for a checkout:
+// - Detects the project's languages from marker files and its Dockerfile
+// - Ranks existing environments by how well they fit
+// - Recommends a starter image to init when none fits
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/project"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/spf13/cobra"
+)
+
+var suggestCmd = &cobra.Command{
+	Use:   "suggest [path]",
+	Short: "Recommend an environment for a project",
+	Long: `Inspect a project (the current directory by default) and recommend an
+environment for it. Marker files such as go.mod, package.json,
+requirements.txt and Cargo.toml tell which languages the project uses, and a
+Dockerfile tells which base image it builds on.
+
+Existing environments are ranked by the tools locked at their last commit,
+their base image and their name. When none fits, the 'devdrop init' command
+creating a suitable one is printed instead.
+
+With --on-run, 'devdrop run' without an environment name offers the
+recommended environment whenever it is started in a directory that has no
+mapping and the current environment doesn't fit the project.
+
+Examples:
+  devdrop suggest              # What should I use for this checkout?
+  devdrop suggest ~/src/api    # ...or for another one
+  devdrop suggest --on-run     # Offer suggestions on 'devdrop run'
+  devdrop suggest --on-run=false`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runSuggest,
+}
+
+var suggestOnRun bool
+
+func init() {
+	rootCmd.AddCommand(suggestCmd)
+	suggestCmd.Flags().BoolVar(&suggestOnRun, "on-run", false, "Offer suggestions when 'devdrop run' starts in an unmapped directory")
+}
+
+func runSuggest(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if cmd.Flags().Changed("on-run") {
+		if err := cfg.Update(func(c *config.Config) error {
+			c.SuggestOnRun = suggestOnRun
+			return nil
+		}); err != nil {
+			return fmt.Errorf("failed to save config: %w", err)
+		}
+		if suggestOnRun {
+			fmt.Println("'devdrop run' will suggest environments in unmapped directories.")
+		} else {
+			fmt.Println("'devdrop run' will no longer suggest environments.")
+		}
+		return nil
+	}
+
+	path := "."
+	if len(args) == 1 {
+		path = args[0]
+	}
+	dir, err := expandPath(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve path '%s': %w", path, err)
+	}
+
+	proj, matches := suggestEnvironments(cfg, dir)
+	if proj.Empty() {
+		fmt.Printf("Nothing recognizable found in %s (looked for go.mod, package.json, requirements.txt, Cargo.toml, Dockerfile, ...).\n", dir)
+		return nil
+	}
+
+	fmt.Printf("Detected in %s:\n", dir)
+	for _, stack := range proj.Stacks {
+		fmt.Printf("  %s (%s)\n", stack.Name, stack.Marker)
+	}
+	if proj.DockerfileBase != "" {
+		fmt.Printf("  Dockerfile based on %s\n", proj.DockerfileBase)
+	}
+	fmt.Println()
+
+	if len(matches) == 0 {
+		fmt.Println("No existing environment fits. Create one with:")
+		fmt.Printf("  %s\n", initSuggestion(proj))
+		return nil
+	}
+
+	fmt.Println("Matching environments:")
+	for i, match := range matches {
+		marker := " "
+		if i == 0 {
+			marker = "*"
+		}
+		fmt.Printf("  %s %s  %s\n", marker, match.Name, strings.Join(match.Reasons, ", "))
+	}
+
+	best := strings.TrimPrefix(matches[0].Name, "devdrop-")
+	fmt.Println()
+	fmt.Println("Use the best match here:")
+	if cwd, err := currentWorkspace(); err == nil && dir == cwd {
+		fmt.Printf("  devdrop map set %s    # always use it in this directory\n", best)
+	} else {
+		fmt.Printf("  devdrop map set %s %s    # always use it in that directory\n", dir, best)
+	}
+	fmt.Printf("  devdrop run %s\n", best)
+	return nil
+}
+
+// suggestEnvironments detects the project in dir and ranks the configured
+// environments against it
+func suggestEnvironments(cfg *config.Config, dir string) (project.Project, []project.Match) {
+	proj := project.Detect(dir)
+	if proj.Empty() {
+		return proj, nil
+	}
+
+	candidates := make([]project.Candidate, 0, len(cfg.Environments))
+	for name, env := range cfg.Environments {
+		toolNames := make([]string, 0, len(env.Tools))
+		for tool := range env.Tools {
+			toolNames = append(toolNames, tool)
+		}
+		sort.Strings(toolNames)
+		candidates = append(candidates, project.Candidate{Name: name, BaseImage: env.BaseImage, Tools: toolNames})
+	}
+	return proj, proj.Rank(candidates)
+}
+
+// initSuggestion returns the init command creating an environment for a project
+func initSuggestion(proj project.Project) string {
+	name := filepath.Base(proj.Dir)
+	if proj.DockerfileBase != "" {
+		return fmt.Sprintf("devdrop init --name %s --image custom --base-image %s", name, proj.DockerfileBase)
+	}
+	for _, stack := range proj.Stacks {
+		if stack.Starter != "" {
+			return fmt.Sprintf("devdrop init --name %s --image %s", name, stack.Starter)
+		}
+	}
+	return fmt.Sprintf("devdrop init --name %s --image custom --base-image %s", name, proj.Stacks[0].BaseImage)
+}
+
+// offerSuggestion is called by 'devdrop run' without an environment name when
+// suggestions are enabled. In a directory without a mapping or .devdrop pin
+// whose project the chosen environment doesn't fit, it offers the best
+// matching environment and to map the directory to it. It returns the
+// environment to run.
+func offerSuggestion(cfg *config.Config, targetEnv string) string {
+	dir, err := currentWorkspace()
+	if err != nil {
+		return targetEnv
+	}
+	if _, _, mapped := cfg.MappingFor(dir); mapped {
+		return targetEnv
+	}
+	if _, _, pinned, _ := config.FindPin(dir); pinned {
+		return targetEnv
+	}
+
+	proj, matches := suggestEnvironments(cfg, dir)
+	if proj.Empty() {
+		return targetEnv
+	}
+	if len(matches) == 0 {
+		fmt.Printf("No environment fits this project. Create one with '%s'.\n", initSuggestion(proj))
+		return targetEnv
+	}
+
+	// Keep the current environment when it fits as well as the best match
+	best := matches[0]
+	for _, match := range matches {
+		if match.Name == targetEnv && match.Score == best.Score {
+			return targetEnv
+		}
+	}
+
+	use, err := prompt.Confirm(fmt.Sprintf("%s looks like a better fit for this directory (%s). Use it instead of %s?", best.Name, strings.Join(best.Reasons, ", "), targetEnv), true)
+	if err != nil || !use {
+		return targetEnv
+	}
+
+	remember, err := prompt.Confirm(fmt.Sprintf("Always use %s in %s?", best.Name, dir), true)
+	if err == nil && remember {
+		if err := cfg.SetMapping(dir, best.Name); err != nil {
+			fmt.Printf("Warning: failed to save mapping: %v\n", err)
+		} else {
+			fmt.Printf("Mapped %s -> %s (change it with 'devdrop map')\n", dir, best.Name)
+		}
+	}
+	return best.Name
+}
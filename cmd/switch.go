@@ -7,6 +7,7 @@ import (
 	"fmt"
 
 	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/prompt"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +16,8 @@ var switchCmd = &cobra.Command{
 	Short: "Switch to a different development environment",
 	Long: `Switch the current active environment context. This affects which
 environment is used by default for run, commit, and other commands.
+Projects pinned with 'devdrop use' and directories mapped with 'devdrop
+map' keep their own environment.
 
 The environment name will be automatically prefixed with 'devdrop-' if needed.
 
@@ -54,7 +57,7 @@ func runSwitch(cmd *cobra.Command, args []string) error {
 
 	// Verify environment exists
 	if _, exists := cfg.Environments[targetEnv]; !exists {
-		return fmt.Errorf("environment '%s' not found. Run 'devdrop ls' to see available environments", targetEnv)
+		return environmentNotFound(targetEnv)
 	}
 
 	// Switch to the environment
@@ -69,29 +72,21 @@ func runSwitch(cmd *cobra.Command, args []string) error {
 func promptForEnvironmentSelection(cfg *config.Config) (string, error) {
 	fmt.Println("Available environments:")
 
-	envNames := make([]string, 0, len(cfg.Environments))
-	for name := range cfg.Environments {
-		envNames = append(envNames, name)
-	}
+	envNames := cfg.OrderForSelection(cfg.EnvironmentNames())
 
+	labels := make([]string, len(envNames))
 	for i, name := range envNames {
 		marker := " "
 		if name == cfg.GetCurrentEnvironment() {
 			marker = "*"
 		}
-		fmt.Printf("%d.%s %s\n", i+1, marker, name)
+		labels[i] = fmt.Sprintf("%s %s", marker, name)
 	}
 
-	fmt.Print("Select environment (1-" + fmt.Sprintf("%d", len(envNames)) + "): ")
-
-	var choice int
-	if _, err := fmt.Scanf("%d", &choice); err != nil {
-		return "", fmt.Errorf("invalid input: %w", err)
-	}
-
-	if choice < 1 || choice > len(envNames) {
-		return "", fmt.Errorf("invalid selection. Please choose 1-%d", len(envNames))
+	choice, err := prompt.Select("Select environment", labels, -1)
+	if err != nil {
+		return "", withPromptHint(err, "pass the environment name as an argument")
 	}
 
-	return envNames[choice-1], nil
+	return envNames[choice], nil
 }
\ No newline at end of file
@@ -0,0 +1,191 @@
+// Package cmd provides the sync command for DevDrop.
+//
+// The sync command keeps every environment up to date with its registry:
+// - Compares the local image of each environment with the pushed one
+// - Pulls the environments someone else pushed newer versions of
+// - Repeats on an interval with --watch, or runs once from cron
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/syncstate"
+	"github.com/spf13/cobra"
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Pull every environment that has a newer pushed version",
+	Long: `Check every configured environment against its registry and pull those
+that have a newer pushed version, so updates a teammate pushes reach this
+machine without running 'devdrop pull' for each of them.
+
+Environments are compared by digest and layers, like 'devdrop status'
+does. Those whose pushed image is ahead of the local one, or that aren't
+pulled at all, are pulled. Environments with local commits that weren't
+pushed, or that diverged, are never overwritten; they are reported with
+what to do instead. Local-only environments are skipped.
+
+Run it once, e.g. from cron, or keep it running with --watch to check every
+--interval. Once, it exits non-zero when an environment couldn't be
+checked or pulled; with --quiet only changes and problems are printed:
+
+  */30 * * * * devdrop sync --quiet
+
+Examples:
+  devdrop sync                          # Check and pull once
+  devdrop sync --dry-run                # Only report what would be pulled
+  devdrop sync --watch --interval 30m   # Keep checking until interrupted`,
+	Args: cobra.NoArgs,
+	RunE: runSync,
+}
+
+var (
+	syncWatch    bool
+	syncInterval time.Duration
+	syncDryRun   bool
+)
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().BoolVar(&syncWatch, "watch", false, "Keep checking every --interval until interrupted")
+	syncCmd.Flags().DurationVar(&syncInterval, "interval", 15*time.Minute, "How often to check with --watch")
+	syncCmd.Flags().BoolVar(&syncDryRun, "dry-run", false, "Only report which environments would be pulled")
+}
+
+// syncOutcome counts what a sync round did
+type syncOutcome struct {
+	pulled   int
+	upToDate int
+	skipped  int
+	failed   int
+}
+
+func runSync(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("interval") && !syncWatch {
+		return &usageError{err: fmt.Errorf("--interval can only be used with --watch")}
+	}
+	if syncInterval < time.Minute {
+		return &usageError{err: fmt.Errorf("--interval must be at least 1m, got %s", syncInterval)}
+	}
+
+	if !syncWatch {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.Username == "" {
+			return errLoginRequired
+		}
+
+		outcome := syncEnvironments(cfg)
+		if outcome.failed > 0 {
+			return fmt.Errorf("failed to sync %d environment(s)", outcome.failed)
+		}
+		switch {
+		case quiet:
+		case syncDryRun:
+			fmt.Printf("Dry run: %d to pull, %d up to date, %d skipped.\n", outcome.pulled, outcome.upToDate, outcome.skipped)
+		default:
+			output.Successf("%d pulled, %d up to date, %d skipped", outcome.pulled, outcome.upToDate, outcome.skipped)
+		}
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	daemonLogf("Syncing environments every %s; press Ctrl-C to stop", syncInterval)
+	for {
+		// Reload every round to see environments added in the meantime
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if cfg.Username == "" {
+			return errLoginRequired
+		}
+
+		syncEnvironments(cfg)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(syncInterval):
+		}
+	}
+}
+
+// syncEnvironments checks every environment once and pulls the ones that
+// are behind their registry. Failures are logged so one environment
+// doesn't stop the others.
+func syncEnvironments(cfg *config.Config) syncOutcome {
+	var outcome syncOutcome
+	for _, envName := range cfg.EnvironmentNames() {
+		if cfg.IsLocalOnly(envName) {
+			outcome.skipped++
+			continue
+		}
+
+		dockerClient, err := newEnvironmentDockerClient(envName)
+		if err != nil {
+			syncLogf("%s: failed to connect to Docker: %v", envName, err)
+			outcome.failed++
+			continue
+		}
+		// Pull output would interleave with the log lines
+		dockerClient.SetProgressOutput(nil)
+
+		status := environmentSyncStatus(dockerClient, cfg, envName)
+		switch status.State {
+		case syncstate.RemoteAhead, syncstate.RemoteOnly:
+			if syncDryRun {
+				syncLogf("%s: would pull the newer pushed image", envName)
+				outcome.pulled++
+				break
+			}
+			syncLogf("%s: pulling the newer pushed image", envName)
+			imageName := cfg.GetEnvironmentImageName(envName)
+			if err := pullEnvironmentImage(dockerClient, cfg, envName, imageName, ""); err != nil {
+				syncLogf("%s: %v", envName, err)
+				outcome.failed++
+				break
+			}
+			if _, err := cfg.RecordPull(envName, imageName); err != nil {
+				syncLogf("%s: failed to save config: %v", envName, err)
+			}
+			recordInStore(dockerClient, cfg, envName, "latest")
+			syncLogf("%s: pulled", envName)
+			outcome.pulled++
+		case syncstate.InSync:
+			if !quiet {
+				syncLogf("%s: up to date", envName)
+			}
+			outcome.upToDate++
+		case syncstate.Unknown:
+			syncLogf("%s: can't check for a newer image: %s", envName, status.Error)
+			outcome.failed++
+		default:
+			syncLogf("%s: skipped, %s", envName, describeSync(cfg, envName, status))
+			outcome.skipped++
+		}
+		dockerClient.Close()
+	}
+	return outcome
+}
+
+// syncLogf prints a line of sync's log, timestamped with --watch
+func syncLogf(format string, args ...interface{}) {
+	if syncWatch {
+		daemonLogf(format, args...)
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
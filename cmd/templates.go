@@ -0,0 +1,193 @@
+// Package cmd provides the templates command for DevDrop.
+//
+// The templates command shows the starter templates for 'devdrop init --template':
+// - Lists the built-in templates and those of the remote index in the config
+// - Shows a template's image, packages, setup commands and recommended mounts
+// - Falls back to the cached index when the remote index can't be reached
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/templates"
+	"github.com/spf13/cobra"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List starter templates for new environments",
+	Long: `List the starter templates 'devdrop init --template' creates environments
+from. A template is a base image plus the packages and setup commands that
+make it a ready development environment, and the volumes and ports such an
+environment usually wants.
+
+DevDrop ships a built-in catalog. Set templates_index in the config to the
+URL of a YAML index in the same format to offer your team's templates as
+well; they replace built-in templates of the same name. The last index
+fetched is cached and used while the index can't be reached.
+
+Examples:
+  devdrop templates list
+  devdrop templates show rust-wasm
+  devdrop init --template rust-wasm`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List the available templates",
+	Args:    cobra.NoArgs,
+	RunE:    runTemplatesList,
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:               "show <template>",
+	Short:             "Show what a template sets up",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeTemplateArg,
+	RunE:              runTemplatesShow,
+}
+
+var templatesOutput string
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd, templatesShowCmd)
+	templatesListCmd.Flags().StringVarP(&templatesOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	templatesShowCmd.Flags().StringVarP(&templatesOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// loadTemplates returns the built-in templates and those of the configured
+// remote index. A failing index is a warning, not an error.
+func loadTemplates(cfg *config.Config) map[string]templates.Template {
+	builtin := templates.Builtin()
+	if cfg.TemplatesIndex == "" {
+		return builtin
+	}
+
+	cacheFile, err := config.GetTemplatesCachePath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to locate the template cache: %v\n", err)
+		return builtin
+	}
+	remote, err := templates.FetchIndex(cfg.TemplatesIndex, cacheFile)
+	if err != nil {
+		if remote != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v; using the cached template index\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %v; showing built-in templates only\n", err)
+		}
+	}
+	return templates.Merge(builtin, remote)
+}
+
+// findTemplate looks up a template by name
+func findTemplate(cfg *config.Config, name string) (templates.Template, error) {
+	all := loadTemplates(cfg)
+	t, exists := all[name]
+	if !exists {
+		return templates.Template{}, fmt.Errorf("unknown template '%s'. Available templates: %s", name, strings.Join(templates.Names(all), ", "))
+	}
+	return t, nil
+}
+
+// completeTemplates completes template names with their descriptions
+func completeTemplates(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	all := loadTemplates(cfg)
+	var names []string
+	for _, name := range templates.Names(all) {
+		names = append(names, fmt.Sprintf("%s\t%s", name, all[name].Description))
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTemplateArg completes the template argument of 'templates show'
+func completeTemplateArg(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeTemplates(cmd, args, toComplete)
+}
+
+func runTemplatesList(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(templatesOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	all := loadTemplates(cfg)
+	names := templates.Names(all)
+
+	if templatesOutput != output.FormatText {
+		list := make([]templates.Template, 0, len(names))
+		for _, name := range names {
+			list = append(list, all[name])
+		}
+		return output.Render(os.Stdout, templatesOutput, list)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tIMAGE\tSOURCE\tDESCRIPTION")
+	for _, name := range names {
+		t := all[name]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, t.Image, t.Source, t.Description)
+	}
+	w.Flush()
+
+	fmt.Println()
+	fmt.Println("Create an environment from one with 'devdrop init --template <name>'.")
+	return nil
+}
+
+func runTemplatesShow(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(templatesOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	t, err := findTemplate(cfg, args[0])
+	if err != nil {
+		return err
+	}
+
+	if templatesOutput != output.FormatText {
+		return output.Render(os.Stdout, templatesOutput, t)
+	}
+
+	fmt.Printf("Template:    %s (%s)\n", t.Name, t.Source)
+	fmt.Printf("Description: %s\n", t.Description)
+	fmt.Printf("Image:       %s\n", t.Image)
+	printTemplateList("Packages", t.Packages)
+	printTemplateList("Setup", t.Setup)
+	printTemplateList("Volumes", t.Volumes)
+	printTemplateList("Mounts", t.Mounts)
+	printTemplateList("Ports", t.Ports)
+	return nil
+}
+
+func printTemplateList(label string, items []string) {
+	if len(items) == 0 {
+		return
+	}
+	fmt.Printf("%s:\n", label)
+	for _, item := range items {
+		fmt.Printf("  %s\n", item)
+	}
+}
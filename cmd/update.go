@@ -0,0 +1,134 @@
+// Package cmd provides the update command for DevDrop.
+//
+// The update command replaces devdrop with the latest release:
+// - Checks GitHub for the latest release and compares versions
+// - Downloads the binary for this platform and verifies its checksum
+// - Replaces the running executable in place
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/oysteinje/devdrop/internal/version"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/prompt"
+	"github.com/oysteinje/devdrop/pkg/update"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update devdrop to the latest release",
+	Long: `Check GitHub for the latest release of devdrop and install it in place
+of the running binary.
+
+The binary for this platform is downloaded next to the current one and
+verified against the release's checksums.txt before it replaces it; a
+mismatch leaves the current binary untouched. Installing over a binary in a
+system directory such as /usr/local/bin needs sudo.
+
+Development builds don't know their version; use --force to replace one
+with the latest release anyway.
+
+Examples:
+  devdrop update            # Update if a newer release exists
+  devdrop update --check    # Only report whether one exists
+  sudo devdrop update -y    # Update a system-wide install without asking`,
+	Args: cobra.NoArgs,
+	RunE: runUpdate,
+}
+
+var (
+	updateCheck bool
+	updateForce bool
+)
+
+func init() {
+	rootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().BoolVar(&updateCheck, "check", false, "Only check whether a newer release exists")
+	updateCmd.Flags().BoolVar(&updateForce, "force", false, "Install the latest release even if it isn't newer")
+}
+
+func runUpdate(cmd *cobra.Command, args []string) error {
+	current := version.GetVersion()
+
+	release, err := update.Latest()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Current version: %s\n", current)
+	fmt.Printf("Latest release:  %s (%s)\n", release.Tag, output.RelativeTime(release.Published))
+
+	newer := isNewerRelease(release.Tag, current)
+	if !newer && !updateForce {
+		if version.IsDev() {
+			fmt.Println("This is a development build. Run 'devdrop update --force' to replace it with the latest release.")
+		} else {
+			output.Successf("devdrop is up to date")
+		}
+		return nil
+	}
+	if updateCheck {
+		if newer {
+			fmt.Printf("A newer release is available: %s\nRun 'devdrop update' to install it.\n", release.URL)
+		}
+		return nil
+	}
+
+	executable, err := update.Executable()
+	if err != nil {
+		return err
+	}
+	// Leftover of the previous update on Windows
+	os.Remove(executable + ".old")
+
+	ok, err := prompt.Confirm(fmt.Sprintf("Replace %s with %s?", executable, release.Tag), true)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+
+	fmt.Printf("Downloading %s...\n", update.AssetName(runtime.GOOS, runtime.GOARCH))
+	downloaded, err := update.Download(release, filepath.Dir(executable))
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("no permission to write to %s; run 'sudo devdrop update': %w", filepath.Dir(executable), err)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Checksum verified")
+
+	if err := update.Replace(executable, downloaded); err != nil {
+		os.Remove(downloaded)
+		if errors.Is(err, os.ErrPermission) {
+			return fmt.Errorf("%w; run 'sudo devdrop update'", err)
+		}
+		return err
+	}
+
+	output.Successf("Updated devdrop to %s", release.Tag)
+	return nil
+}
+
+// isNewerRelease reports whether the latest release should replace the
+// running version. Releases built from different commits of the same
+// version differ only in their prerelease part, which orders them by commit
+// hash rather than by age, so another such build counts as newer: it is the
+// latest release after all.
+func isNewerRelease(latest, current string) bool {
+	if latest == current {
+		return false
+	}
+	if version.SameRelease(latest, current) && version.Prerelease(latest) != "" && version.Prerelease(current) != "" {
+		return true
+	}
+	c, ok := version.Compare(latest, current)
+	return ok && c > 0
+}
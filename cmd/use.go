@@ -0,0 +1,114 @@
+// Package cmd provides the use command for DevDrop.
+//
+// The use command pins an environment to a project:
+// - Writes a .devdrop file naming the environment into the current directory
+// - Shows which environment is pinned here and by which file
+// - Removes the pin again with --unset
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var useCmd = &cobra.Command{
+	Use:   "use [environment-name]",
+	Short: "Pin an environment to the current project",
+	Long: `Pin an environment to the current directory by writing a .devdrop file
+naming it. Commands run without an environment name (run, commit, attach,
+...) in this directory or below it then use the pinned environment instead
+of the current one, so every repository gets its own toolchain without
+switching. Commit the file to share the pin with your team; the closest
+.devdrop file wins, and it takes precedence over 'devdrop map' mappings.
+
+Without an argument the environment pinned here, if any, is shown.
+
+Examples:
+  devdrop use go          # Pin devdrop-go to this directory
+  devdrop use             # Show the pinned environment
+  devdrop use --unset     # Remove the pin of this directory`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runUse,
+}
+
+var useUnset bool
+
+func init() {
+	rootCmd.AddCommand(useCmd)
+	useCmd.Flags().BoolVar(&useUnset, "unset", false, "Remove the .devdrop file of the current directory")
+}
+
+func runUse(cmd *cobra.Command, args []string) error {
+	dir, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+
+	if useUnset {
+		if len(args) > 0 {
+			return fmt.Errorf("--unset takes no environment name")
+		}
+		return removePin(dir)
+	}
+
+	if len(args) == 0 {
+		return showPin(dir)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	envName := config.EnsureDevDropPrefix(args[0])
+	if _, exists := cfg.Environments[envName]; !exists {
+		return environmentNotFound(envName)
+	}
+
+	path, err := config.WritePin(dir, envName)
+	if err != nil {
+		return err
+	}
+	output.Successf("Pinned %s to %s (%s)", envName, dir, path)
+	return nil
+}
+
+// showPin prints the environment pinned for dir
+func showPin(dir string) error {
+	path, envName, ok, err := config.FindPin(dir)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("No environment pinned here. Pin one with 'devdrop use <environment-name>'.")
+		return nil
+	}
+	fmt.Printf("%s (pinned by %s)\n", envName, path)
+	return nil
+}
+
+// removePin deletes the .devdrop file of dir. Pins of parent directories
+// are left alone; they still apply.
+func removePin(dir string) error {
+	path := filepath.Join(dir, config.PinFile)
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			if parent, envName, ok, err := config.FindPin(dir); err == nil && ok {
+				return fmt.Errorf("no %s file in %s; %s is pinned by %s", config.PinFile, dir, envName, parent)
+			}
+			return fmt.Errorf("no %s file in %s", config.PinFile, dir)
+		}
+		return fmt.Errorf("failed to remove %s: %w", path, err)
+	}
+	fmt.Printf("Removed %s\n", path)
+
+	if parent, envName, ok, err := config.FindPin(dir); err == nil && ok {
+		fmt.Printf("%s still applies here (pinned by %s).\n", envName, parent)
+	}
+	return nil
+}
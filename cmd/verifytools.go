@@ -0,0 +1,101 @@
+// Package cmd provides the verify-tools command for DevDrop.
+//
+// The verify-tools command detects tool drift in an environment:
+// - Reads the tool versions locked at the last commit or build
+// - Captures the versions found in the environment's session container
+// - Reports changed, added and removed tools
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/tools"
+	"github.com/spf13/cobra"
+)
+
+var verifyToolsCmd = &cobra.Command{
+	Use:   "verify-tools [environment-name]",
+	Short: "Check a container against the environment's locked tool versions",
+	Long: `Compare the tool versions in an environment's container with the versions
+locked when the environment was last committed or built.
+
+DevDrop records language runtimes, package managers, common build tools and
+a checksum of the installed OS packages on every commit and build. This
+command checks the environment's session container (or --container) for
+drift, such as tools upgraded or installed ad hoc during a session. A stopped
+container is started briefly for the check.
+
+Exits with an error if any drift is found, so it can be used in scripts.
+
+Examples:
+  devdrop verify-tools                 # Check the current environment's container
+  devdrop verify-tools myenv
+  devdrop verify-tools --container 3f2a1b`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runVerifyTools,
+}
+
+var verifyToolsContainer string
+
+func init() {
+	rootCmd.AddCommand(verifyToolsCmd)
+	verifyToolsCmd.Flags().StringVar(&verifyToolsContainer, "container", "", "Container to check instead of the environment's session container")
+}
+
+func runVerifyTools(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, env, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	if len(env.Tools) == 0 {
+		return fmt.Errorf("no tool lock recorded for '%s'. Run 'devdrop commit %s' or 'devdrop build' to create one", targetEnv, targetEnv)
+	}
+
+	containerID := verifyToolsContainer
+	if containerID == "" {
+		containerID = env.LastContainer
+	}
+	if containerID == "" {
+		return fmt.Errorf("no container to check for environment '%s'. Run 'devdrop run %s' first or pass --container", targetEnv, targetEnv)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	current, err := dockerClient.ContainerTools(containerID)
+	if err != nil {
+		return err
+	}
+
+	drift := tools.Compare(env.Tools, current)
+	if len(drift) == 0 {
+		output.Successf("%d tools in %s match the lock", len(env.Tools), shortID(containerID))
+		return nil
+	}
+
+	fmt.Printf("%s Tool drift in %s (environment %s):\n", output.WarningMark(), shortID(containerID), targetEnv)
+	for _, d := range drift {
+		switch {
+		case d.Locked == "":
+			fmt.Printf("  + %s: %s (not in lock)\n", d.Tool, d.Current)
+		case d.Current == "":
+			fmt.Printf("  - %s: %s (missing)\n", d.Tool, d.Locked)
+		default:
+			fmt.Printf("  ~ %s: %s -> %s\n", d.Tool, d.Locked, d.Current)
+		}
+	}
+	fmt.Printf("\nCommit the container to update the lock, or rebuild the environment to discard the changes.\n")
+
+	return fmt.Errorf("%d tool(s) drifted from the lock", len(drift))
+}
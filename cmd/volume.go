@@ -0,0 +1,322 @@
+// Package cmd provides the volume command for DevDrop.
+//
+// The volume command manages the named volumes sessions keep caches in:
+// - Lists each environment's volumes with their size and whether they are declared
+// - Removes the volumes of one environment
+// - Prunes volumes no configured environment declares any more
+// - Shows the workspace volumes standing in for .devdropignore'd directories
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/oysteinje/devdrop/pkg/spec"
+	"github.com/spf13/cobra"
+)
+
+var volumeCmd = &cobra.Command{
+	Use:   "volume",
+	Short: "Manage the named volumes environments keep caches in",
+	Long: `Manage the named volumes that keep directories such as ~/.cache, the Go
+module cache or the npm cache across sessions.
+
+Volumes are declared per environment under "volumes" in the config (or in
+devdrop.yaml) as name:/path[:ro], or given for one session with
+'devdrop run --volume'. Each environment gets its own Docker volumes, named
+<environment>-<user>-<name> and created on first use. They are never part
+of committed images.
+
+Directories a workspace's .devdropignore keeps out of sessions, such as
+node_modules, are replaced by workspace volumes; they are listed with the
+host directory they stand in for.
+
+The STATUS column shows whether a volume is still wanted:
+  declared    listed under "volumes" of its environment
+  workspace   a workspace volume whose host directory still exists
+  undeclared  only used with --volume, or removed from the config
+  orphaned    its environment or workspace directory is gone
+
+'devdrop volume prune' removes undeclared and orphaned volumes.
+
+Examples:
+  devdrop volume ls                    # All volumes and their sizes
+  devdrop volume ls go                 # Volumes of devdrop-go
+  devdrop volume rm go gocache         # Start the Go module cache afresh
+  devdrop volume prune --dry-run       # What would prune remove?`,
+}
+
+var volumeLsCmd = &cobra.Command{
+	Use:   "ls [environment-name]",
+	Short: "List environment volumes",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runVolumeLs,
+}
+
+var volumeRmCmd = &cobra.Command{
+	Use:   "rm <environment-name> [volume-name]...",
+	Short: "Remove an environment's volumes (all of them unless named)",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runVolumeRm,
+}
+
+var volumePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove volumes no configured environment declares",
+	Args:  cobra.NoArgs,
+	RunE:  runVolumePrune,
+}
+
+var (
+	volumeOutput      string
+	volumePruneDryRun bool
+)
+
+func init() {
+	rootCmd.AddCommand(volumeCmd)
+	volumeCmd.AddCommand(volumeLsCmd, volumeRmCmd, volumePruneCmd)
+	volumeLsCmd.Flags().StringVarP(&volumeOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+	volumePruneCmd.Flags().BoolVar(&volumePruneDryRun, "dry-run", false, "Show what would be removed without removing anything")
+}
+
+// Volume statuses shown by 'devdrop volume ls'
+const (
+	volumeStatusDeclared   = "declared"
+	volumeStatusWorkspace  = "workspace"
+	volumeStatusUndeclared = "undeclared"
+	volumeStatusOrphaned   = "orphaned"
+)
+
+// environmentVolume is a volume as listed by 'devdrop volume ls'
+type environmentVolume struct {
+	Name        string    `json:"name" yaml:"name"`
+	Environment string    `json:"environment" yaml:"environment"`
+	Volume      string    `json:"volume" yaml:"volume"`
+	Workspace   string    `json:"workspace,omitempty" yaml:"workspace,omitempty"`
+	Size        int64     `json:"size" yaml:"size"`
+	Created     time.Time `json:"created" yaml:"created"`
+	Status      string    `json:"status" yaml:"status"`
+}
+
+func runVolumeLs(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(volumeOutput); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	envName := ""
+	if len(args) > 0 {
+		envName = config.EnsureDevDropPrefix(args[0])
+	}
+	volumes, err := environmentVolumes(dockerClient, cfg, envName)
+	if err != nil {
+		return err
+	}
+
+	if volumeOutput != output.FormatText {
+		return output.Render(os.Stdout, volumeOutput, volumes)
+	}
+
+	if len(volumes) == 0 {
+		fmt.Println("No devdrop volumes found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tVOLUME\tDOCKER VOLUME\tSIZE\tCREATED\tSTATUS")
+	for _, volume := range volumes {
+		size := "-"
+		if volume.Size >= 0 {
+			size = units.HumanSize(float64(volume.Size))
+		}
+		created := "-"
+		if !volume.Created.IsZero() {
+			created = output.RelativeTime(volume.Created)
+		}
+		name := volume.Volume
+		if volume.Workspace != "" {
+			name = filepath.Join(volume.Workspace, volume.Volume)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", volume.Environment, name, volume.Name, size, created, volume.Status)
+	}
+	return w.Flush()
+}
+
+func runVolumeRm(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	envName := config.EnsureDevDropPrefix(args[0])
+	volumes, err := environmentVolumes(dockerClient, cfg, envName)
+	if err != nil {
+		return err
+	}
+
+	if names := args[1:]; len(names) > 0 {
+		wanted := make(map[string]bool, len(names))
+		for _, name := range names {
+			wanted[name] = true
+		}
+		var selected []environmentVolume
+		for _, volume := range volumes {
+			if wanted[volume.Volume] {
+				selected = append(selected, volume)
+				delete(wanted, volume.Volume)
+			}
+		}
+		for _, name := range names {
+			if wanted[name] {
+				return fmt.Errorf("%s has no volume '%s'. Run 'devdrop volume ls %s' to see its volumes", envName, name, args[0])
+			}
+		}
+		volumes = selected
+	}
+
+	if len(volumes) == 0 {
+		fmt.Printf("%s has no volumes.\n", envName)
+		return nil
+	}
+
+	removed := removeVolumes(dockerClient, volumes, false)
+	if removed < len(volumes) {
+		return fmt.Errorf("failed to remove %d volume(s); stop the sessions using them and try again", len(volumes)-removed)
+	}
+	output.Successf("Removed %d volume(s) of %s", removed, envName)
+	return nil
+}
+
+func runVolumePrune(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	volumes, err := environmentVolumes(dockerClient, cfg, "")
+	if err != nil {
+		return err
+	}
+
+	var stale []environmentVolume
+	for _, volume := range volumes {
+		if volume.Status == volumeStatusUndeclared || volume.Status == volumeStatusOrphaned {
+			stale = append(stale, volume)
+		}
+	}
+	if len(stale) == 0 {
+		fmt.Println("No volumes to prune.")
+		return nil
+	}
+
+	removed := removeVolumes(dockerClient, stale, volumePruneDryRun)
+	if volumePruneDryRun {
+		fmt.Println("Dry run: nothing was removed.")
+		return nil
+	}
+	output.Successf("Removed %d volume(s)", removed)
+	return nil
+}
+
+// environmentVolumes lists the current user's volumes of one environment,
+// or of all when envName is empty, with their status against the config
+func environmentVolumes(dockerClient *docker.Client, cfg *config.Config, envName string) ([]environmentVolume, error) {
+	infos, err := dockerClient.ListVolumes()
+	if err != nil {
+		return nil, err
+	}
+
+	var volumes []environmentVolume
+	for _, info := range infos {
+		if envName != "" && info.Environment != envName {
+			continue
+		}
+		volumes = append(volumes, environmentVolume{
+			Name:        info.Name,
+			Environment: info.Environment,
+			Volume:      info.Volume,
+			Workspace:   info.Workspace,
+			Size:        info.Size,
+			Created:     info.Created,
+			Status:      volumeStatus(cfg, info),
+		})
+	}
+	return volumes, nil
+}
+
+// volumeStatus reports whether an environment still declares a volume, or
+// whether the directory a workspace volume stands in for still exists
+func volumeStatus(cfg *config.Config, info docker.VolumeInfo) string {
+	env, exists := cfg.Environments[info.Environment]
+	if !exists {
+		return volumeStatusOrphaned
+	}
+	if info.Workspace != "" {
+		if _, err := os.Stat(filepath.Join(info.Workspace, info.Volume)); err != nil {
+			return volumeStatusOrphaned
+		}
+		return volumeStatusWorkspace
+	}
+	for _, volume := range env.Volumes {
+		if declared, _, _, err := spec.ParseVolume(volume); err == nil && declared == info.Volume {
+			return volumeStatusDeclared
+		}
+	}
+	return volumeStatusUndeclared
+}
+
+// removeVolumes removes volumes, reporting each, and returns how many were
+// removed. Volumes in use by a container are skipped.
+func removeVolumes(dockerClient *docker.Client, volumes []environmentVolume, dryRun bool) int {
+	verb := "Removing"
+	if dryRun {
+		verb = "Would remove"
+	}
+
+	removed := 0
+	for _, volume := range volumes {
+		size := ""
+		if volume.Size >= 0 {
+			size = ", " + units.HumanSize(float64(volume.Size))
+		}
+		fmt.Printf("%s volume %s (%s %s%s)\n", verb, volume.Name, volume.Environment, volume.Volume, size)
+		if dryRun {
+			continue
+		}
+		if err := dockerClient.RemoveVolume(volume.Name); err != nil {
+			fmt.Printf("  skipped: %v\n", err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,258 @@
+// Package cmd provides the warm command for DevDrop.
+//
+// The warm command manages warm containers for fast 'devdrop exec':
+// - Starts an always-running container of an environment for the current directory
+// - Stops warm containers of a workspace, an environment or all of them
+// - Shows which warm containers are running
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/output"
+	"github.com/spf13/cobra"
+)
+
+var warmCmd = &cobra.Command{
+	Use:   "warm",
+	Short: "Manage warm containers that make 'devdrop exec' fast",
+	Long: `Manage warm containers: always-running containers of an environment, one
+per workspace, that 'devdrop exec' runs commands in with docker exec instead
+of creating a container for every command.
+
+Set warm: true on an environment in the config to have exec start them on
+first use, or start one by hand with 'devdrop warm start'. A warm container
+mounts the directory it was started in as /workspace (or the environment's
+workspace_path), plus the environment's mounts and volumes, and is replaced
+when the image or mounts change.
+Variables under "env" are passed to every command. Warm containers are
+never committed and are removed when stopped.
+
+Examples:
+  devdrop warm start go        # Warm devdrop-go for this directory
+  devdrop exec go -- go vet ./...  # Runs in the warm container
+  devdrop warm status          # Running warm containers
+  devdrop warm stop go         # Stop the one for this directory
+  devdrop warm stop --all      # Stop all of them`,
+}
+
+var warmStartCmd = &cobra.Command{
+	Use:   "start [environment-name]",
+	Short: "Start a warm container for the current directory",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runWarmStart,
+}
+
+var warmStopCmd = &cobra.Command{
+	Use:   "stop [environment-name]",
+	Short: "Stop the warm container of the current directory",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runWarmStop,
+}
+
+var warmStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "List running warm containers",
+	Args:  cobra.NoArgs,
+	RunE:  runWarmStatus,
+}
+
+var (
+	warmStopAll bool
+	warmOutput  string
+)
+
+func init() {
+	rootCmd.AddCommand(warmCmd)
+	warmCmd.AddCommand(warmStartCmd, warmStopCmd, warmStatusCmd)
+	warmStopCmd.Flags().BoolVar(&warmStopAll, "all", false, "Stop the warm containers of every directory (of the environment, if given)")
+	warmStatusCmd.Flags().StringVarP(&warmOutput, "output", "o", output.FormatText, "Output format: text, json or yaml")
+}
+
+// warmStatus is a warm container as listed by 'devdrop warm status'
+type warmStatus struct {
+	Container   string    `json:"container" yaml:"container"`
+	Environment string    `json:"environment" yaml:"environment"`
+	Workspace   string    `json:"workspace" yaml:"workspace"`
+	Image       string    `json:"image" yaml:"image"`
+	Started     time.Time `json:"started" yaml:"started"`
+}
+
+func runWarmStart(cmd *cobra.Command, args []string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	targetEnv, _, err := resolveEnvironment(cfg, args)
+	if err != nil {
+		return err
+	}
+
+	workspace, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newEnvironmentDockerClient(targetEnv)
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	useImage, err := resolveEnvironmentImage(dockerClient, cfg, targetEnv, os.Stdout)
+	if err != nil {
+		return err
+	}
+	mounts, err := execMounts(dockerClient, cfg, targetEnv, workspace)
+	if err != nil {
+		return err
+	}
+
+	containerID, started, err := startWarmContainer(dockerClient, cfg, targetEnv, useImage, workspace, mounts)
+	if err != nil {
+		return err
+	}
+	if !started {
+		fmt.Printf("%s is already warm for %s (container %s).\n", targetEnv, workspace, shortID(containerID))
+		return nil
+	}
+	output.Successf("Started warm container %s for %s in %s", shortID(containerID), targetEnv, workspace)
+	return nil
+}
+
+func runWarmStop(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 && !warmStopAll {
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		envName, err := defaultEnvironment(cfg)
+		if err != nil {
+			return err
+		}
+		args = []string{envName}
+	}
+
+	workspace, err := currentWorkspace()
+	if err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containers, err := dockerClient.ListWarmContainers()
+	if err != nil {
+		return err
+	}
+
+	stopped := 0
+	for _, warm := range containers {
+		if len(args) > 0 && warm.Environment != config.EnsureDevDropPrefix(args[0]) {
+			continue
+		}
+		if !warmStopAll && warm.Workspace != workspace {
+			continue
+		}
+		fmt.Printf("Stopping warm container %s (%s, %s)\n", shortID(warm.ID), warm.Environment, warm.Workspace)
+		if err := dockerClient.RemoveContainer(warm.ID); err != nil {
+			fmt.Printf("  skipped: %v\n", err)
+			continue
+		}
+		stopped++
+	}
+
+	if stopped == 0 {
+		fmt.Println("No warm containers to stop.")
+		return nil
+	}
+	output.Successf("Stopped %d warm container(s)", stopped)
+	return nil
+}
+
+func runWarmStatus(cmd *cobra.Command, args []string) error {
+	if err := output.ValidateFormat(warmOutput); err != nil {
+		return err
+	}
+
+	dockerClient, err := newDockerClient()
+	if err != nil {
+		return fmt.Errorf("failed to connect to Docker: %w", err)
+	}
+	defer dockerClient.Close()
+
+	containers, err := dockerClient.ListWarmContainers()
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]warmStatus, 0, len(containers))
+	for _, warm := range containers {
+		statuses = append(statuses, warmStatus{
+			Container:   shortID(warm.ID),
+			Environment: warm.Environment,
+			Workspace:   warm.Workspace,
+			Image:       warm.Image,
+			Started:     warm.Started,
+		})
+	}
+
+	if warmOutput != output.FormatText {
+		return output.Render(os.Stdout, warmOutput, statuses)
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No warm containers running.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENVIRONMENT\tWORKSPACE\tCONTAINER\tIMAGE\tSTARTED")
+	for _, status := range statuses {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status.Environment, status.Workspace, status.Container, status.Image, output.RelativeTime(status.Started))
+	}
+	return w.Flush()
+}
+
+// execWarmContainer returns the warm container 'devdrop exec' should run a
+// command in: one started on demand for environments with warm: true, or
+// one started by 'devdrop warm start'. An empty ID means exec creates a
+// container as usual.
+func execWarmContainer(dockerClient *docker.Client, cfg *config.Config, targetEnv, image, workspace string, mounts []string) (string, error) {
+	if !cfg.Environments[targetEnv].Warm {
+		existing, err := dockerClient.FindWarmContainer(targetEnv, workspace)
+		if err != nil || existing == nil {
+			return "", err
+		}
+	}
+
+	containerID, started, err := startWarmContainer(dockerClient, cfg, targetEnv, image, workspace, mounts)
+	if err != nil {
+		return "", err
+	}
+	if started {
+		fmt.Fprintf(os.Stderr, "Started warm container %s for %s; stop it with 'devdrop warm stop'.\n", shortID(containerID), targetEnv)
+	}
+	return containerID, nil
+}
+
+// startWarmContainer starts a warm container of an environment for a
+// workspace unless an up-to-date one is running
+func startWarmContainer(dockerClient *docker.Client, cfg *config.Config, targetEnv, image, workspace string, mounts []string) (string, bool, error) {
+	containerWorkspace, _ := sessionWorkspacePath(cfg.Environments[targetEnv])
+	return dockerClient.EnsureWarmContainer(docker.WarmOptions{
+		ContainerSpec: docker.ContainerSpec{Image: image, Mounts: mounts},
+		WorkspaceDir:  workspace,
+		WorkspacePath: containerWorkspace,
+		Environment:   targetEnv,
+		Version:       sessionVersion(cfg.Environments[targetEnv], image),
+	})
+}
@@ -1,5 +1,10 @@
 package version
 
+import (
+	"strconv"
+	"strings"
+)
+
 // Version is set at build time via ldflags
 var Version = "dev"
 
@@ -10,3 +15,120 @@ func GetVersion() string {
 	}
 	return Version
 }
+
+// IsDev reports whether the binary was built without a release version
+func IsDev() bool {
+	_, ok := parse(GetVersion())
+	return !ok
+}
+
+// semver is a parsed vMAJOR.MINOR.PATCH[-PRERELEASE][+BUILD] version
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+// parse parses a semantic version with an optional v prefix; build
+// metadata is ignored
+func parse(v string) (semver, bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexByte(v, '+'); i >= 0 {
+		v = v[:i]
+	}
+	var parsed semver
+	core, prerelease, hasPrerelease := strings.Cut(v, "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return semver{}, false
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return semver{}, false
+		}
+		parsed.core[i] = n
+	}
+	if hasPrerelease {
+		if prerelease == "" {
+			return semver{}, false
+		}
+		parsed.prerelease = strings.Split(prerelease, ".")
+	}
+	return parsed, true
+}
+
+// Compare compares two semantic versions by semver precedence, returning
+// -1, 0 or 1. It reports ok false when either isn't a valid version.
+func Compare(a, b string) (result int, ok bool) {
+	va, okA := parse(a)
+	vb, okB := parse(b)
+	if !okA || !okB {
+		return 0, false
+	}
+
+	for i := range va.core {
+		if c := compareInts(va.core[i], vb.core[i]); c != 0 {
+			return c, true
+		}
+	}
+
+	// A version without prerelease ranks above its prereleases
+	switch {
+	case len(va.prerelease) == 0 && len(vb.prerelease) == 0:
+		return 0, true
+	case len(va.prerelease) == 0:
+		return 1, true
+	case len(vb.prerelease) == 0:
+		return -1, true
+	}
+	for i := 0; i < len(va.prerelease) && i < len(vb.prerelease); i++ {
+		if c := comparePrerelease(va.prerelease[i], vb.prerelease[i]); c != 0 {
+			return c, true
+		}
+	}
+	return compareInts(len(va.prerelease), len(vb.prerelease)), true
+}
+
+// SameRelease reports whether two versions share MAJOR.MINOR.PATCH, e.g.
+// builds of the same release from different commits
+func SameRelease(a, b string) bool {
+	va, okA := parse(a)
+	vb, okB := parse(b)
+	return okA && okB && va.core == vb.core
+}
+
+// Prerelease returns the prerelease part of a version, e.g. "rc.1" of
+// v1.2.0-rc.1, or "" when it has none or isn't a valid version
+func Prerelease(v string) string {
+	parsed, ok := parse(v)
+	if !ok {
+		return ""
+	}
+	return strings.Join(parsed.prerelease, ".")
+}
+
+// comparePrerelease compares prerelease identifiers: numeric ones by value
+// and below alphanumeric ones, which compare as text
+func comparePrerelease(a, b string) int {
+	na, errA := strconv.Atoi(a)
+	nb, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return compareInts(na, nb)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
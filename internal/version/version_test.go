@@ -0,0 +1,39 @@
+package version
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOK bool
+	}{
+		{"v1.2.3", "v1.2.3", 0, true},
+		{"1.2.3", "v1.2.3", 0, true},
+		{"v1.2.3", "v1.2.4", -1, true},
+		{"v1.10.0", "v1.9.0", 1, true},
+		{"v2.0.0", "v1.99.99", 1, true},
+		{"v1.0.0+build.5", "v1.0.0", 0, true},
+		{"v1.0.0-rc.1", "v1.0.0", -1, true},
+		{"v1.0.0", "v1.0.0-rc.1", 1, true},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1, true},
+		{"v1.0.0-alpha.1", "v1.0.0-alpha.beta", -1, true},
+		{"v1.0.0-beta.2", "v1.0.0-beta.11", -1, true},
+		{"v1.0.0-beta", "v1.0.0-alpha", 1, true},
+		{"v1.0.0-rc.1", "v1.0.0-rc.1", 0, true},
+		{"dev", "v1.0.0", 0, false},
+		{"v1.0", "v1.0.0", 0, false},
+		{"v1.0.0", "v1.0.x", 0, false},
+		{"v1.0.0-", "v1.0.0", 0, false},
+		{"v-1.0.0", "v1.0.0", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+"_"+tt.b, func(t *testing.T) {
+			got, ok := Compare(tt.a, tt.b)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Compare(%q, %q) = %d, %v, want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package auth
+
+import (
+	"os/exec"
+	"runtime"
+)
+
+// OpenBrowser opens url in the user's default browser. Failure is not fatal
+// for callers, who should always print the URL as well.
+func OpenBrowser(url string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", url)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
+	default:
+		cmd = exec.Command("xdg-open", url)
+	}
+	return cmd.Start()
+}
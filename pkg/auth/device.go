@@ -0,0 +1,247 @@
+// Package auth handles registry authentication flows for DevDrop.
+//
+// Besides the classic username/password login (handled by the Docker daemon),
+// this package implements the OAuth 2.0 device authorization grant (RFC 8628)
+// used by Docker Hub's web login. The user confirms a short code in the
+// browser, which also works for SSO-backed accounts, and never types a
+// password into the terminal.
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// dockerHubTenant hosts the Docker Hub OAuth endpoints
+	dockerHubTenant = "https://login.docker.com"
+	// dockerHubAudience is the API the issued tokens are valid for
+	dockerHubAudience = "https://hub.docker.com"
+	// dockerHubClaim holds Docker Hub specific claims in the access token
+	dockerHubClaim = "https://hub.docker.com"
+
+	deviceCodeGrantType   = "urn:ietf:params:oauth:grant-type:device_code"
+	refreshTokenGrantType = "refresh_token"
+)
+
+// ClientID is DevDrop's OAuth client registered with Docker Hub. Release
+// builds set it with -ldflags "-X github.com/oysteinje/devdrop/pkg/auth.ClientID=...".
+var ClientID = ""
+
+var (
+	// ErrAccessDenied is returned when the user rejects the login in the browser
+	ErrAccessDenied = errors.New("login was denied in the browser")
+	// ErrExpired is returned when the user code expires before it is confirmed
+	ErrExpired = errors.New("login code expired before it was confirmed")
+	// ErrNoClientID is returned when the build has no OAuth client for web login
+	ErrNoClientID = errors.New("web login is not available in this build; set DEVDROP_OAUTH_CLIENT_ID or log in with a password or access token")
+	// ErrRefreshRejected is returned when a refresh token was revoked or
+	// expired, and the user has to log in again
+	ErrRefreshRejected = errors.New("the login has expired; run 'devdrop login --web' again")
+)
+
+// DeviceCode is the pending authorization the user has to confirm in a browser
+type DeviceCode struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// Token is the result of a confirmed device authorization
+type Token struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// DeviceFlow performs the device authorization grant against an OAuth tenant
+type DeviceFlow struct {
+	Tenant   string
+	ClientID string
+	Audience string
+	Scopes   []string
+
+	http *http.Client
+}
+
+// NewDockerHubDeviceFlow returns a device flow for Docker Hub accounts. The
+// client ID can be overridden with DEVDROP_OAUTH_CLIENT_ID.
+func NewDockerHubDeviceFlow() (*DeviceFlow, error) {
+	clientID := ClientID
+	if override := os.Getenv("DEVDROP_OAUTH_CLIENT_ID"); override != "" {
+		clientID = override
+	}
+	if clientID == "" {
+		return nil, ErrNoClientID
+	}
+
+	return &DeviceFlow{
+		Tenant:   dockerHubTenant,
+		ClientID: clientID,
+		Audience: dockerHubAudience,
+		Scopes:   []string{"openid", "offline_access"},
+		http:     &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Start requests a new device code for the user to confirm
+func (f *DeviceFlow) Start() (*DeviceCode, error) {
+	form := url.Values{
+		"client_id": {f.ClientID},
+		"audience":  {f.Audience},
+		"scope":     {strings.Join(f.Scopes, " ")},
+	}
+
+	var code DeviceCode
+	if err := f.post("/oauth/device/code", form, &code); err != nil {
+		return nil, fmt.Errorf("failed to start web login: %w", err)
+	}
+
+	if code.Interval <= 0 {
+		code.Interval = 5
+	}
+	return &code, nil
+}
+
+// Wait polls until the user confirms the device code in the browser
+func (f *DeviceFlow) Wait(code *DeviceCode) (*Token, error) {
+	interval := time.Duration(code.Interval) * time.Second
+	deadline := time.Now().Add(time.Duration(code.ExpiresIn) * time.Second)
+
+	form := url.Values{
+		"grant_type":  {deviceCodeGrantType},
+		"device_code": {code.DeviceCode},
+		"client_id":   {f.ClientID},
+	}
+
+	for {
+		if code.ExpiresIn > 0 && time.Now().After(deadline) {
+			return nil, ErrExpired
+		}
+		time.Sleep(interval)
+
+		var token Token
+		err := f.post("/oauth/token", form, &token)
+		if err == nil {
+			return &token, nil
+		}
+
+		var oauthErr *oauthError
+		if !errors.As(err, &oauthErr) {
+			return nil, fmt.Errorf("failed to complete web login: %w", err)
+		}
+
+		switch oauthErr.Code {
+		case "authorization_pending":
+			continue
+		case "slow_down":
+			interval += 5 * time.Second
+		case "access_denied":
+			return nil, ErrAccessDenied
+		case "expired_token":
+			return nil, ErrExpired
+		default:
+			return nil, fmt.Errorf("failed to complete web login: %w", err)
+		}
+	}
+}
+
+// Refresh trades a refresh token for a new access token. The returned token
+// carries a new refresh token only when the tenant rotates them.
+func (f *DeviceFlow) Refresh(refreshToken string) (*Token, error) {
+	form := url.Values{
+		"grant_type":    {refreshTokenGrantType},
+		"refresh_token": {refreshToken},
+		"client_id":     {f.ClientID},
+	}
+
+	var token Token
+	if err := f.post("/oauth/token", form, &token); err != nil {
+		var oauthErr *oauthError
+		if errors.As(err, &oauthErr) && oauthErr.Code == "invalid_grant" {
+			return nil, ErrRefreshRejected
+		}
+		return nil, fmt.Errorf("failed to refresh login: %w", err)
+	}
+	return &token, nil
+}
+
+// DockerHubUsername extracts the Docker Hub username from an access token
+func DockerHubUsername(accessToken string) (string, error) {
+	parts := strings.Split(accessToken, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("access token is not a JWT")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("failed to decode access token: %w", err)
+	}
+
+	var claims map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("failed to parse access token: %w", err)
+	}
+
+	var hub struct {
+		Username string `json:"username"`
+	}
+	if raw, ok := claims[dockerHubClaim]; ok {
+		if err := json.Unmarshal(raw, &hub); err != nil {
+			return "", fmt.Errorf("failed to parse Docker Hub claims: %w", err)
+		}
+	}
+	if hub.Username == "" {
+		return "", fmt.Errorf("access token does not contain a Docker Hub username")
+	}
+
+	return hub.Username, nil
+}
+
+// oauthError is an error response as defined by RFC 6749 section 5.2
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *oauthError) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Code
+}
+
+func (f *DeviceFlow) post(path string, form url.Values, v interface{}) error {
+	resp, err := f.http.PostForm(f.Tenant+path, form)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr oauthError
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Code != "" {
+			return &oauthErr
+		}
+		return fmt.Errorf("login service returned status %d", resp.StatusCode)
+	}
+
+	return json.Unmarshal(body, v)
+}
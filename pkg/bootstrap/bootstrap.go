@@ -0,0 +1,283 @@
+// Package bootstrap captures the packages installed in an environment and
+// turns them into a shell script that installs them again.
+//
+// An inventory holds the OS packages that were installed on purpose (apt's
+// manually installed packages or apk's world), the apt history, the
+// packages pip freeze reports and the global npm packages. The script
+// generated from it recreates an environment declaratively on top of its
+// base image, and doubles as a readable record of what the environment has
+// in it.
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/shell"
+)
+
+// Package is an installed package and its version
+type Package struct {
+	Name    string `json:"name" yaml:"name"`
+	Version string `json:"version" yaml:"version"`
+}
+
+// Inventory lists the packages installed in an image
+type Inventory struct {
+	// Manager is the OS package manager: dpkg, apk or none
+	Manager string
+	// OS holds the packages installed on purpose rather than as dependencies
+	OS []Package
+	// History holds the apt command lines from /var/log/apt/history.log
+	History []string
+	// Pip holds the packages reported by pip freeze
+	Pip []Package
+	// Npm holds the global npm packages
+	Npm []Package
+}
+
+// section markers separate the parts of the capture command's output
+const sectionMarker = "@@devdrop "
+
+// Command returns the command that prints an inventory of an image for
+// ParseInventory. Missing tools are skipped and stderr is discarded, so the
+// output only has what was found.
+func Command() []string {
+	script := `m='` + sectionMarker + `'
+if command -v dpkg-query >/dev/null 2>&1; then
+  echo "${m}manager dpkg"
+  echo "${m}os"
+  if command -v apt-mark >/dev/null 2>&1; then
+    apt-mark showmanual 2>/dev/null | xargs -r dpkg-query -W -f '${Package}\t${Version}\n' 2>/dev/null
+  else
+    dpkg-query -W -f '${Package}\t${Version}\n' 2>/dev/null
+  fi
+  echo "${m}history"
+  for f in $(ls -r /var/log/apt/history.log.*.gz 2>/dev/null); do gzip -dc "$f" 2>/dev/null; done | grep '^Commandline:'
+  [ -f /var/log/apt/history.log ] && grep '^Commandline:' /var/log/apt/history.log
+elif [ -f /etc/apk/world ]; then
+  echo "${m}manager apk"
+  echo "${m}os"
+  awk -F: 'NR==FNR{sub(/[<>=~].*/, ""); world[$0]=1; next} /^P:/{p=$2} /^V:/{if (p in world) print p "\t" $2}' /etc/apk/world /lib/apk/db/installed 2>/dev/null
+else
+  echo "${m}manager none"
+fi
+pip=$(command -v pip3 || command -v pip)
+if [ -n "$pip" ]; then
+  echo "${m}pip"
+  "$pip" freeze --all 2>/dev/null
+fi
+if command -v npm >/dev/null 2>&1; then
+  echo "${m}npm"
+  npm ls -g --depth=0 --json 2>/dev/null
+fi
+exit 0
+`
+	return []string{"/bin/sh", "-c", script}
+}
+
+// npmList is the part of 'npm ls --json' an inventory needs
+type npmList struct {
+	Dependencies map[string]struct {
+		Version string `json:"version"`
+	} `json:"dependencies"`
+}
+
+// ParseInventory reads the output of Command
+func ParseInventory(output string) (Inventory, error) {
+	inv := Inventory{Manager: "none"}
+	var section string
+	var npmJSON strings.Builder
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.HasPrefix(line, sectionMarker) {
+			section = strings.TrimPrefix(line, sectionMarker)
+			if name, value, found := strings.Cut(section, " "); found && name == "manager" {
+				inv.Manager = value
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch section {
+		case "os":
+			name, version, found := strings.Cut(line, "\t")
+			if found && name != "" {
+				inv.OS = append(inv.OS, Package{Name: name, Version: version})
+			}
+		case "history":
+			inv.History = append(inv.History, strings.TrimSpace(strings.TrimPrefix(line, "Commandline:")))
+		case "pip":
+			// Editable and direct URL installs can't be pinned by version
+			name, version, found := strings.Cut(line, "==")
+			if found && !strings.HasPrefix(name, "-") {
+				inv.Pip = append(inv.Pip, Package{Name: name, Version: version})
+			}
+		case "npm":
+			npmJSON.WriteString(line + "\n")
+		}
+	}
+
+	if npmJSON.Len() > 0 {
+		var list npmList
+		if err := json.Unmarshal([]byte(npmJSON.String()), &list); err != nil {
+			return inv, fmt.Errorf("failed to parse npm package list: %w", err)
+		}
+		for name, dep := range list.Dependencies {
+			inv.Npm = append(inv.Npm, Package{Name: name, Version: dep.Version})
+		}
+	}
+
+	for _, packages := range [][]Package{inv.OS, inv.Pip, inv.Npm} {
+		sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	}
+	return inv, nil
+}
+
+// Without removes what base already has: packages installed in base at the
+// same version and the apt history base starts with. What is left is what
+// was installed on top of base.
+func (inv Inventory) Without(base Inventory) Inventory {
+	result := Inventory{
+		Manager: inv.Manager,
+		OS:      withoutPackages(inv.OS, base.OS),
+		Pip:     withoutPackages(inv.Pip, base.Pip),
+		Npm:     withoutPackages(inv.Npm, base.Npm),
+		History: inv.History,
+	}
+	if len(base.History) <= len(inv.History) {
+		result.History = inv.History[len(base.History):]
+	}
+	return result
+}
+
+func withoutPackages(packages, base []Package) []Package {
+	installed := make(map[Package]bool, len(base))
+	for _, p := range base {
+		installed[p] = true
+	}
+	var result []Package
+	for _, p := range packages {
+		if !installed[p] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// Change is a package that was added, removed or changed version between
+// two inventories
+type Change struct {
+	// Kind is os, pip or npm
+	Kind string `json:"kind" yaml:"kind"`
+	Name string `json:"name" yaml:"name"`
+	// Before is empty for added packages, After for removed ones
+	Before string `json:"before,omitempty" yaml:"before,omitempty"`
+	After  string `json:"after,omitempty" yaml:"after,omitempty"`
+}
+
+// Compare lists the packages that differ from before to after, by kind
+// and name
+func Compare(before, after Inventory) []Change {
+	var changes []Change
+	changes = append(changes, comparePackages("os", before.OS, after.OS)...)
+	changes = append(changes, comparePackages("pip", before.Pip, after.Pip)...)
+	changes = append(changes, comparePackages("npm", before.Npm, after.Npm)...)
+	return changes
+}
+
+func comparePackages(kind string, before, after []Package) []Change {
+	versions := make(map[string]string, len(before))
+	for _, p := range before {
+		versions[p.Name] = p.Version
+	}
+	var changes []Change
+	seen := make(map[string]bool, len(after))
+	for _, p := range after {
+		seen[p.Name] = true
+		if version, exists := versions[p.Name]; !exists || version != p.Version {
+			changes = append(changes, Change{Kind: kind, Name: p.Name, Before: version, After: p.Version})
+		}
+	}
+	for _, p := range before {
+		if !seen[p.Name] {
+			changes = append(changes, Change{Kind: kind, Name: p.Name, Before: p.Version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// ScriptOptions describe the script generated from an inventory
+type ScriptOptions struct {
+	// Environment and Image name what the inventory was captured from
+	Environment string
+	Image       string
+	// BaseImage is the image the script is meant to run in; empty when the
+	// inventory holds everything in Image
+	BaseImage string
+	// Unpinned installs the latest versions instead of the captured ones
+	Unpinned bool
+	Created  time.Time
+}
+
+// Script returns a POSIX shell script that installs the packages of an
+// inventory
+func Script(inv Inventory, opts ScriptOptions) string {
+	var b strings.Builder
+	b.WriteString("#!/bin/sh\n")
+	fmt.Fprintf(&b, "# Packages of %s, captured from %s on %s\n", opts.Environment, opts.Image, opts.Created.UTC().Format(time.RFC3339))
+	if opts.BaseImage != "" {
+		fmt.Fprintf(&b, "# Run as root in a container of %s to install what was added on top of it.\n", opts.BaseImage)
+	} else {
+		b.WriteString("# Lists every package in the image, including those of its base image.\n")
+	}
+	b.WriteString("set -e\n")
+
+	if len(inv.History) > 0 {
+		b.WriteString("\n# apt history, for reference\n")
+		for _, line := range inv.History {
+			fmt.Fprintf(&b, "#   %s\n", line)
+		}
+	}
+
+	switch {
+	case len(inv.OS) == 0:
+	case inv.Manager == "dpkg":
+		b.WriteString("\n# Manually installed apt packages\n")
+		b.WriteString("apt-get update\n")
+		writeInstall(&b, "DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends", inv.OS, "=", opts.Unpinned)
+		b.WriteString("rm -rf /var/lib/apt/lists/*\n")
+	case inv.Manager == "apk":
+		b.WriteString("\n# apk packages\n")
+		writeInstall(&b, "apk add --no-cache", inv.OS, "=", opts.Unpinned)
+	}
+
+	if len(inv.Pip) > 0 {
+		b.WriteString("\n# pip packages\n")
+		writeInstall(&b, "pip3 install --no-cache-dir", inv.Pip, "==", opts.Unpinned)
+	}
+	if len(inv.Npm) > 0 {
+		b.WriteString("\n# Global npm packages\n")
+		writeInstall(&b, "npm install -g", inv.Npm, "@", opts.Unpinned)
+	}
+	return b.String()
+}
+
+// writeInstall writes an install command with one package per line
+func writeInstall(b *strings.Builder, command string, packages []Package, separator string, unpinned bool) {
+	b.WriteString(command)
+	for _, p := range packages {
+		arg := p.Name
+		if !unpinned && p.Version != "" {
+			arg += separator + p.Version
+		}
+		fmt.Fprintf(b, " \\\n    %s", shell.Quote(arg))
+	}
+	b.WriteString("\n")
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultCatalogPath is the system catalog shared by all users of a machine
+const defaultCatalogPath = "/etc/devdrop/catalog.yaml"
+
+// ErrCatalogReadOnly is returned when the system catalog can't be written,
+// typically because the user isn't an administrator
+var ErrCatalogReadOnly = errors.New("the system catalog is writable only by administrators")
+
+// Catalog lists org-approved environments users can start from. It lives
+// outside any home directory, is readable by everyone and writable only by
+// administrators.
+type Catalog struct {
+	Environments map[string]CatalogEntry `yaml:"environments" json:"environments"`
+}
+
+// CatalogEntry is an approved environment image
+type CatalogEntry struct {
+	Image       string `yaml:"image" json:"image"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	// Digest pins the image; 'devdrop init --system' refuses any other
+	Digest string `yaml:"digest,omitempty" json:"digest,omitempty"`
+}
+
+// GetCatalogPath returns the path of the system catalog;
+// DEVDROP_SYSTEM_CATALOG overrides the default /etc/devdrop/catalog.yaml
+func GetCatalogPath() string {
+	if path := os.Getenv("DEVDROP_SYSTEM_CATALOG"); path != "" {
+		return path
+	}
+	return defaultCatalogPath
+}
+
+// LoadCatalog reads the system catalog. A missing catalog is empty.
+func LoadCatalog() (*Catalog, error) {
+	catalog := &Catalog{Environments: make(map[string]CatalogEntry)}
+
+	data, err := os.ReadFile(GetCatalogPath())
+	if os.IsNotExist(err) {
+		return catalog, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read system catalog: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("failed to parse system catalog: %w", err)
+	}
+	if catalog.Environments == nil {
+		catalog.Environments = make(map[string]CatalogEntry)
+	}
+	return catalog, nil
+}
+
+// Save writes the system catalog, readable by all users
+func (c *Catalog) Save() error {
+	path := GetCatalogPath()
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal system catalog: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		if os.IsPermission(err) {
+			return ErrCatalogReadOnly
+		}
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		if os.IsPermission(err) {
+			return ErrCatalogReadOnly
+		}
+		return fmt.Errorf("failed to write system catalog: %w", err)
+	}
+	return nil
+}
+
+// Names returns the catalog's environment names, sorted
+func (c *Catalog) Names() []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -1,29 +1,65 @@
 // Package config handles DevDrop configuration management.
 //
-// This package manages the ~/.devdrop/config.yaml file which stores:
+// This package manages the ~/.config/devdrop/config.yaml file which stores:
 // - DockerHub username (from devdrop login)
+// - Registry logins (secrets only when no credential helper is available)
 // - Last container ID (from devdrop init)
 // - Environment history and metadata
 // - User preferences and settings
+//
+// The file records the version of its layout; older layouts are upgraded
+// when loaded (see schema.go) and newer ones are refused.
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/credentials"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/registry"
+	"github.com/oysteinje/devdrop/pkg/services"
+	"github.com/oysteinje/devdrop/pkg/tools"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	Username           string                 `yaml:"username"`
-	BaseImage          string                 `yaml:"base_image"`
-	LastContainer      string                 `yaml:"last_container,omitempty"`
-	AuthToken          string                 `yaml:"auth_token,omitempty"`
-	CurrentEnvironment string                 `yaml:"current_environment,omitempty"`
-	Environments       map[string]Environment `yaml:"environments"`
+	// Version is the layout of the file, see CurrentVersion
+	Version            int                      `yaml:"version"`
+	Username           string                   `yaml:"username"`
+	BaseImage          string                   `yaml:"base_image"`
+	LastContainer      string                   `yaml:"last_container,omitempty"`
+	AuthToken          string                   `yaml:"auth_token,omitempty"`
+	Registry           string                   `yaml:"registry,omitempty"`
+	Registries         map[string]RegistryLogin `yaml:"registries,omitempty"`
+	CurrentEnvironment string                   `yaml:"current_environment,omitempty"`
+	SortBy             string                   `yaml:"sort_by,omitempty"`
+	CredentialStore    string                   `yaml:"credential_store,omitempty"`
+	ExperimentalStore  bool                     `yaml:"experimental_store,omitempty"`
+	Runtime            string                   `yaml:"runtime,omitempty"`
+	RecentImages       []string                 `yaml:"recent_images,omitempty"`
+	Mappings           map[string]string        `yaml:"mappings,omitempty"`
+	SuggestOnRun       bool                     `yaml:"suggest_on_run,omitempty"`
+	Dotfiles           Dotfiles                 `yaml:"dotfiles,omitempty"`
+	Commit             CommitDefaults           `yaml:"commit,omitempty"`
+	TemplatesIndex     string                   `yaml:"templates_index,omitempty"`
+	RegistryCacheTTL   string                   `yaml:"registry_cache_ttl,omitempty"`
+	TransferAttempts   int                      `yaml:"transfer_attempts,omitempty"`
+	KeepRemoteVersions int                      `yaml:"keep_remote_versions,omitempty"`
+	SigningKey         string                   `yaml:"signing_key,omitempty"`
+	VerifyKey          string                   `yaml:"verify_key,omitempty"`
+	VerifySignatures   bool                     `yaml:"verify_signatures,omitempty"`
+	Scanner            string                   `yaml:"scanner,omitempty"`
+	Environments       map[string]Environment   `yaml:"environments"`
+
+	// loadedVersion is the version the file had when it was loaded
+	loadedVersion int
 }
 
 type Environment struct {
@@ -33,35 +69,229 @@ type Environment struct {
 	LastUpdated   time.Time `yaml:"last_updated"`
 	Description   string    `yaml:"description,omitempty"`
 	LastContainer string    `yaml:"last_container,omitempty"`
+	TuneInotify   bool      `yaml:"tune_inotify,omitempty"`
+	Favorite      bool      `yaml:"favorite,omitempty"`
+	LastUsed      time.Time `yaml:"last_used,omitempty"`
+	// LastWorkspace is the directory the environment was last used in,
+	// where 'devdrop daemon --prewarm' keeps a session ready
+	LastWorkspace string    `yaml:"last_workspace,omitempty"`
+	Registry      string    `yaml:"registry,omitempty"`
+	Versions      []Version `yaml:"versions,omitempty"`
+	LatestVersion string    `yaml:"latest_version,omitempty"`
+	Ports         []string  `yaml:"ports,omitempty"`
+	Mounts        []string  `yaml:"mounts,omitempty"`
+	// BaseImageDigest is the registry digest the base image had at init, so
+	// a newer base image can be detected later
+	BaseImageDigest string `yaml:"base_image_digest,omitempty"`
+	// KeepRemoteVersions overrides the config-wide number of versions kept
+	// in the registry when old ones are pruned
+	KeepRemoteVersions int `yaml:"keep_remote_versions,omitempty"`
+	// Volumes are named volumes kept across sessions, as name:dst[:ro]
+	Volumes []string `yaml:"volumes,omitempty"`
+	// Env holds variables set in every session; they aren't committed
+	Env map[string]string `yaml:"env,omitempty"`
+	// DotEnv loads the workspace's .env and .devdrop.env into every session
+	DotEnv bool `yaml:"dotenv,omitempty"`
+	// Warm keeps a container running per workspace for 'devdrop exec'
+	Warm bool `yaml:"warm,omitempty"`
+	// MountMode is how run puts the workspace into sessions: bind, copy or
+	// sync; empty means bind
+	MountMode string `yaml:"mount_mode,omitempty"`
+	// WorkspacePath is where sessions, exec and warm containers have the
+	// workspace and start in; empty means /workspace
+	WorkspacePath string `yaml:"workspace_path,omitempty"`
+	// LocalOnly keeps the environment's images on this machine: they are
+	// tagged under LocalRepositoryHost and never pushed to or pulled from
+	// a registry
+	LocalOnly bool `yaml:"local_only,omitempty"`
+	// DockerHost runs the environment on another Docker daemon: an
+	// ssh://, tcp:// or unix:// address or the name of a docker context
+	DockerHost string `yaml:"docker_host,omitempty"`
+	// Tools locks the tool versions captured at the last commit or build
+	Tools tools.Lock `yaml:"tools,omitempty"`
+	// PlatformContainers holds session containers run with --platform for
+	// other architectures, by platform, until the next multi-arch commit
+	PlatformContainers map[string]string `yaml:"platform_containers,omitempty"`
+	// Hooks run on the host or in the container before and after sessions
+	// and before commits
+	Hooks hooks.Hooks `yaml:"hooks,omitempty"`
+	// Services are sidecar containers, e.g. postgres or redis, started
+	// with every session on a network of their own
+	Services services.Services `yaml:"services,omitempty"`
+}
+
+// Version is a committed, immutable tag of an environment image
+type Version struct {
+	Tag     string    `yaml:"tag"`
+	Created time.Time `yaml:"created"`
+	// Platforms lists the os/arch variants of a multi-arch version, each
+	// pushed as <tag>-<os>-<arch> behind a manifest list
+	Platforms []string `yaml:"platforms,omitempty"`
+	// Message is the message the version was committed with
+	Message string `yaml:"message,omitempty"`
+}
+
+// Dotfiles configures the dotfiles installed into every session
+type Dotfiles struct {
+	// Source is a Git repository URL or a local directory
+	Source string `yaml:"source,omitempty"`
+	// Ref is the branch or tag of a repository; empty uses the default branch
+	Ref string `yaml:"ref,omitempty"`
+	// Install is the install script, relative to the dotfiles root; empty
+	// looks for a well-known one (install.sh, bootstrap.sh, setup.sh, ...)
+	Install string `yaml:"install,omitempty"`
+}
+
+// CommitDefaults are the defaults of 'devdrop commit'; its flags override them
+type CommitDefaults struct {
+	// Author is recorded in committed images instead of "DevDrop CLI"
+	Author string `yaml:"author,omitempty"`
+	// Comment is recorded with every commit
+	Comment string `yaml:"comment,omitempty"`
+	// Reproducible zeroes the timestamps of committed images
+	Reproducible bool `yaml:"reproducible,omitempty"`
+	// Squash flattens committed images into a single layer
+	Squash bool `yaml:"squash,omitempty"`
+	// Pause pauses running containers while they are committed; unset
+	// means true
+	Pause *bool `yaml:"pause,omitempty"`
+	// OnExit says whether 'devdrop run' commits when a session ends:
+	// always, never or ask (the default)
+	OnExit string `yaml:"on_exit,omitempty"`
+	// Scan scans committed images for vulnerabilities before they are
+	// pushed; critical ones stop the push
+	Scan bool `yaml:"scan,omitempty"`
+	// WarnSize is the image size, such as "10GB", above which a commit
+	// asks for confirmation first; "0" never asks
+	WarnSize string `yaml:"warn_size,omitempty"`
 }
 
+// Values of CommitDefaults.OnExit
+const (
+	CommitOnExitAlways = "always"
+	CommitOnExitNever  = "never"
+	CommitOnExitAsk    = "ask"
+)
+
+// RegistryLogin holds the login for a registry other than the default one.
+// Username and AuthToken at the top level of Config always mirror the login
+// of the default registry.
+type RegistryLogin struct {
+	Username  string `yaml:"username"`
+	AuthToken string `yaml:"auth_token,omitempty"`
+	Type      string `yaml:"type,omitempty"`
+	// CredentialStore names the credential helper holding the secret; the
+	// secret is only kept in AuthToken when no helper is available
+	CredentialStore string `yaml:"credential_store,omitempty"`
+	// RefreshToken renews the access token of a web login ('devdrop login
+	// --web'). Like the secret, it is only kept here without a helper.
+	RefreshToken string `yaml:"refresh_token,omitempty"`
+	// Expires is when the access token of a web login runs out
+	Expires time.Time `yaml:"expires,omitempty"`
+}
+
+// Sort keys for listing environments
+const (
+	SortByName    = "name"
+	SortByCreated = "created"
+	SortByUpdated = "updated"
+	SortByUsed    = "used"
+)
+
+// DefaultRegistryCacheTTL is how long registry listings are used without
+// asking the registry again
+const DefaultRegistryCacheTTL = 5 * time.Minute
+
+// LocalRepositoryHost prefixes the images of local-only environments. It
+// looks like a registry host that doesn't resolve, so an accidental push
+// fails instead of publishing the image.
+const LocalRepositoryHost = "devdrop.local"
+
+// ErrEnvironmentNotFound is matched by errors about environments missing
+// from the config
+var ErrEnvironmentNotFound = errors.New("environment not found")
+
+// EnvironmentNotFoundError is returned for an environment missing from the
+// config; it matches ErrEnvironmentNotFound
+type EnvironmentNotFoundError struct {
+	Name string
+}
+
+func (e *EnvironmentNotFoundError) Error() string {
+	return fmt.Sprintf("environment '%s' not found", e.Name)
+}
+
+func (e *EnvironmentNotFoundError) Is(target error) bool {
+	return target == ErrEnvironmentNotFound
+}
+
+// maxRecentImages is the number of recently used base images remembered for completion
+const maxRecentImages = 10
+
 const (
-	configDir        = ".devdrop"
 	configFile       = "config.yaml"
 	defaultBaseImage = "ubuntu:24.04"
 )
 
-// GetConfigPath returns the path to the config file
-func GetConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("failed to get home directory: %w", err)
+// GetRegistryCacheTTL returns how long registry listings are cached:
+// registry_cache_ttl as a duration such as "10m", or DefaultRegistryCacheTTL
+// when it is unset or invalid. "0" revalidates on every use.
+func (c *Config) GetRegistryCacheTTL() time.Duration {
+	if c.RegistryCacheTTL == "" {
+		return DefaultRegistryCacheTTL
+	}
+	ttl, err := time.ParseDuration(c.RegistryCacheTTL)
+	if err != nil || ttl < 0 {
+		return DefaultRegistryCacheTTL
+	}
+	return ttl
+}
+
+// DefaultCommitWarnSize is the image size above which a commit asks for
+// confirmation when warn_size is unset
+const DefaultCommitWarnSize = 10 * units.GB
+
+// GetCommitWarnSize returns the image size above which a commit asks for
+// confirmation: warn_size in the commit section, such as "5GB", or
+// DefaultCommitWarnSize when it is unset or invalid. Zero never asks.
+func (c *Config) GetCommitWarnSize() int64 {
+	if c.Commit.WarnSize == "" {
+		return DefaultCommitWarnSize
+	}
+	size, err := units.FromHumanSize(c.Commit.WarnSize)
+	if err != nil || size < 0 {
+		return DefaultCommitWarnSize
 	}
-	return filepath.Join(homeDir, configDir, configFile), nil
+	return size
 }
 
-// Load reads the configuration from ~/.devdrop/config.yaml
+// GetRuntime returns the configured container runtime (auto, docker or
+// podman); DEVDROP_RUNTIME overrides the config file
+func (c *Config) GetRuntime() string {
+	if runtime := os.Getenv("DEVDROP_RUNTIME"); runtime != "" {
+		return runtime
+	}
+	return c.Runtime
+}
+
+// Load reads the configuration file
 func Load() (*Config, error) {
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return nil, err
 	}
+	return load(configPath)
+}
 
+// load reads the configuration file at configPath
+func load(configPath string) (*Config, error) {
 	// If config doesn't exist, return default config
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		return &Config{
-			BaseImage:    defaultBaseImage,
-			Environments: make(map[string]Environment),
+			Version:       CurrentVersion,
+			BaseImage:     defaultBaseImage,
+			Environments:  make(map[string]Environment),
+			loadedVersion: CurrentVersion,
 		}, nil
 	}
 
@@ -70,10 +300,17 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// Older layouts are upgraded in memory; the file follows on the next save
+	data, version, err := upgrade(configPath, data)
+	if err != nil {
+		return nil, err
+	}
+
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	config.loadedVersion = version
 
 	// Ensure environments map is initialized
 	if config.Environments == nil {
@@ -83,46 +320,173 @@ func Load() (*Config, error) {
 	return &config, nil
 }
 
-// Save writes the configuration to ~/.devdrop/config.yaml
+// Save writes the configuration file as c has it, replacing changes other
+// devdrop processes saved since c was loaded. Use Update to change it.
 func (c *Config) Save() error {
 	configPath, err := GetConfigPath()
 	if err != nil {
 		return err
 	}
+	if err := ensureConfigDir(configPath); err != nil {
+		return err
+	}
 
-	// Create config directory if it doesn't exist
-	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return c.write(configPath)
+}
+
+// Update changes the configuration file: fn is applied to the config as it
+// is on disk, which is saved and becomes c. The file is locked meanwhile, so
+// concurrent sessions (e.g. one recording its container while another
+// commits) keep each other's changes instead of overwriting them.
+func (c *Config) Update(fn func(cfg *Config) error) error {
+	configPath, err := GetConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := ensureConfigDir(configPath); err != nil {
+		return err
+	}
+
+	unlock, err := lockConfig(configPath)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	current, err := load(configPath)
+	if err != nil {
+		return err
+	}
+	if err := fn(current); err != nil {
+		return err
+	}
+	if err := current.write(configPath); err != nil {
+		return err
+	}
+	*c = *current
+	return nil
+}
+
+// ensureConfigDir creates the config directory if it doesn't exist; other
+// users of a shared machine have no business in it
+func ensureConfigDir(configPath string) error {
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
+	return nil
+}
 
+// write replaces the configuration file; the caller holds the lock
+func (c *Config) write(configPath string) error {
+	if c.loadedVersion < CurrentVersion {
+		if err := backupBeforeUpgrade(configPath, c.loadedVersion); err != nil {
+			return err
+		}
+	}
+	c.Version = CurrentVersion
+	c.migrateSecrets()
 	data, err := yaml.Marshal(c)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	// The config may hold auth tokens when no credential helper is available
+	if err := writeFileAtomic(configPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
-
+	c.loadedVersion = CurrentVersion
 	return nil
 }
 
+// migrateSecrets moves auth tokens kept in the config, from before a
+// credential helper was available, into the helper now that there is one.
+// Tokens the helper doesn't take stay in the config.
+func (c *Config) migrateSecrets() {
+	if c.CredentialStore == credentials.FileStore || !c.hasPlaintextSecrets() {
+		return
+	}
+	store := credentials.Default(c.CredentialStore)
+	if store == nil {
+		return
+	}
+
+	// The default login keeps its token outside Registries
+	defaultHost := registry.NormalizeHost(c.Registry)
+	if c.AuthToken != "" {
+		login := c.Registries[defaultHost]
+		login.Username = c.Username
+		login.AuthToken = c.AuthToken
+		if migrated, ok := migrateLogin(store, defaultHost, login); ok {
+			if c.Registries == nil {
+				c.Registries = make(map[string]RegistryLogin)
+			}
+			c.Registries[defaultHost] = migrated
+			c.AuthToken = ""
+		}
+	}
+	for host, login := range c.Registries {
+		if login.AuthToken == "" || login.CredentialStore != "" {
+			continue
+		}
+		if migrated, ok := migrateLogin(store, host, login); ok {
+			c.Registries[host] = migrated
+		}
+	}
+}
+
+// hasPlaintextSecrets reports whether any login keeps its token in the config
+func (c *Config) hasPlaintextSecrets() bool {
+	if c.AuthToken != "" {
+		return true
+	}
+	for _, login := range c.Registries {
+		if login.AuthToken != "" && login.CredentialStore == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateLogin stores the token of a login in a credential helper
+func migrateLogin(store credentials.Store, host string, login RegistryLogin) (RegistryLogin, bool) {
+	creds, err := registry.DecodeAuth(login.AuthToken)
+	if err != nil || creds.Password == "" {
+		return login, false
+	}
+	if login.Username == "" {
+		login.Username = creds.Username
+	}
+	migrated, err := StoreSecrets(store, host, login, creds.Password)
+	return migrated, err == nil
+}
+
 // SetUsername updates the username and saves the config
 func (c *Config) SetUsername(username string) error {
-	c.Username = username
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		cfg.Username = username
+		return nil
+	})
 }
 
 // SetAuthToken updates the auth token and saves the config
 func (c *Config) SetAuthToken(authToken string) error {
-	c.AuthToken = authToken
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		cfg.AuthToken = authToken
+		return nil
+	})
 }
 
 // SetLastContainer updates the last container ID and saves the config
 func (c *Config) SetLastContainer(containerID string) error {
-	c.LastContainer = containerID
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		cfg.LastContainer = containerID
+		return nil
+	})
 }
 
 // GetPersonalImageName returns the user's personal image name
@@ -133,10 +497,43 @@ func (c *Config) GetPersonalImageName() string {
 	return fmt.Sprintf("%s/devdrop-env:latest", c.Username)
 }
 
-// AddEnvironment adds a new environment to the config
+// AddEnvironment adds a new environment to the config, or replaces the
+// entry of an existing one
 func (c *Config) AddEnvironment(name string, env Environment) error {
-	c.Environments[name] = env
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		cfg.Environments[name] = env
+		return nil
+	})
+}
+
+// ForkEnvironment adds target as a copy of the settings of source, with
+// image as its image, and makes it the current environment. The version
+// history, containers and usage of source aren't copied.
+func (c *Config) ForkEnvironment(source, target, image string) error {
+	return c.Update(func(cfg *Config) error {
+		env, exists := cfg.Environments[source]
+		if !exists {
+			return fmt.Errorf("environment '%s' not found", source)
+		}
+		if _, exists := cfg.Environments[target]; exists {
+			return fmt.Errorf("environment '%s' already exists", target)
+		}
+
+		env.Image = image
+		env.Created = time.Now()
+		env.LastUpdated = time.Now()
+		env.Description = "Forked from " + source
+		env.LastContainer = ""
+		env.PlatformContainers = nil
+		env.Favorite = false
+		env.LastUsed = time.Time{}
+		env.LastWorkspace = ""
+		env.Versions = nil
+		env.LatestVersion = ""
+		cfg.Environments[target] = env
+		cfg.CurrentEnvironment = target
+		return nil
+	})
 }
 
 // EnsureDevDropPrefix ensures the environment name has the devdrop- prefix
@@ -153,30 +550,233 @@ func EnsureDevDropPrefix(envName string) string {
 // SetEnvironmentContainer updates the last container ID for a specific environment
 func (c *Config) SetEnvironmentContainer(envName, containerID string) error {
 	envName = EnsureDevDropPrefix(envName)
-	env, exists := c.Environments[envName]
-	if !exists {
-		env = Environment{}
-	}
-	env.LastContainer = containerID
-	env.LastUpdated = time.Now()
-	c.Environments[envName] = env
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		env := cfg.Environments[envName]
+		env.LastContainer = containerID
+		env.LastUpdated = time.Now()
+		cfg.Environments[envName] = env
+		return nil
+	})
+}
+
+// SetEnvironmentPlatformContainer records a session container run for a
+// non-native platform
+func (c *Config) SetEnvironmentPlatformContainer(envName, platform, containerID string) error {
+	envName = EnsureDevDropPrefix(envName)
+	return c.Update(func(cfg *Config) error {
+		env := cfg.Environments[envName]
+		if env.PlatformContainers == nil {
+			env.PlatformContainers = make(map[string]string)
+		}
+		env.PlatformContainers[platform] = containerID
+		env.LastUpdated = time.Now()
+		cfg.Environments[envName] = env
+		return nil
+	})
 }
 
 // GetEnvironmentImageName returns the image name for a specific environment
 func (c *Config) GetEnvironmentImageName(envName string) string {
-	if c.Username == "" {
+	return c.GetEnvironmentImageRef(envName, "latest")
+}
+
+// GetEnvironmentImageRef returns the image reference for a tag of an environment
+func (c *Config) GetEnvironmentImageRef(envName, tag string) string {
+	repo := c.GetEnvironmentRepository(envName)
+	if repo == "" {
 		return ""
 	}
+	return repo + ":" + tag
+}
+
+// GetEnvironmentRepository returns the image repository (without tag) for an
+// environment; local-only environments don't need a registry login
+func (c *Config) GetEnvironmentRepository(envName string) string {
 	envName = EnsureDevDropPrefix(envName)
-	return fmt.Sprintf("%s/%s:latest", c.Username, envName)
+	if c.IsLocalOnly(envName) {
+		return LocalRepositoryHost + "/" + envName
+	}
+	host := c.GetEnvironmentRegistry(envName)
+	login := c.GetRegistryLogin(host)
+	if login.Username == "" {
+		return ""
+	}
+	return registry.Repository(host, login.Username, envName)
+}
+
+// GetKeepRemoteVersions returns how many versions of an environment are
+// kept in its registry: keep_remote_versions of the environment, else of
+// the config. 0 keeps them all.
+func (c *Config) GetKeepRemoteVersions(envName string) int {
+	if keep := c.Environments[EnsureDevDropPrefix(envName)].KeepRemoteVersions; keep > 0 {
+		return keep
+	}
+	if c.KeepRemoteVersions > 0 {
+		return c.KeepRemoteVersions
+	}
+	return 0
+}
+
+// GetVerifyKey returns the cosign key signatures are verified with:
+// verify_key, else the public half of signing_key. A key file foo.key has
+// its public key next to it as foo.pub, the way 'cosign generate-key-pair'
+// writes them; KMS keys verify with the same reference.
+func (c *Config) GetVerifyKey() string {
+	if c.VerifyKey != "" {
+		return c.VerifyKey
+	}
+	if strings.HasSuffix(c.SigningKey, ".key") && !strings.Contains(c.SigningKey, "://") {
+		return strings.TrimSuffix(c.SigningKey, ".key") + ".pub"
+	}
+	return c.SigningKey
+}
+
+// IsLocalOnly reports whether an environment's images never leave this machine
+func (c *Config) IsLocalOnly(envName string) bool {
+	return c.Environments[EnsureDevDropPrefix(envName)].LocalOnly
+}
+
+// GetEnvironmentRegistry returns the registry host an environment is stored in,
+// falling back to the default registry
+func (c *Config) GetEnvironmentRegistry(envName string) string {
+	if env, exists := c.Environments[EnsureDevDropPrefix(envName)]; exists && env.Registry != "" {
+		return registry.NormalizeHost(env.Registry)
+	}
+	return registry.NormalizeHost(c.Registry)
+}
+
+// GetRegistryLogin returns the stored login for a registry host
+func (c *Config) GetRegistryLogin(host string) RegistryLogin {
+	host = registry.NormalizeHost(host)
+	if host == registry.NormalizeHost(c.Registry) {
+		login := RegistryLogin{Username: c.Username, AuthToken: c.AuthToken}
+		if stored, exists := c.Registries[host]; exists {
+			login.Type = stored.Type
+			login.CredentialStore = stored.CredentialStore
+			login.RefreshToken = stored.RefreshToken
+			login.Expires = stored.Expires
+		}
+		return resolveAuthToken(host, login)
+	}
+	return resolveAuthToken(host, c.Registries[host])
+}
+
+// resolveAuthToken fills in the auth token, and the refresh token of a web
+// login, of a login whose secrets are kept in a credential helper. The token
+// is left empty if the helper fails, which callers report as a missing login.
+func resolveAuthToken(host string, login RegistryLogin) RegistryLogin {
+	if login.AuthToken != "" || login.CredentialStore == "" {
+		return login
+	}
+
+	store := credentials.ForName(login.CredentialStore)
+	if store == nil {
+		return login
+	}
+
+	if !login.Expires.IsZero() && login.RefreshToken == "" {
+		if _, refreshToken, err := store.Get(credentials.RefreshTokenKey(host)); err == nil {
+			login.RefreshToken = refreshToken
+		}
+	}
+
+	username, secret, err := store.Get(host)
+	if err != nil {
+		return login
+	}
+
+	authToken, err := registry.EncodeAuth(host, registry.Credentials{Username: username, Password: secret})
+	if err != nil {
+		return login
+	}
+	login.AuthToken = authToken
+	return login
+}
+
+// StoreSecrets moves the secret of a login, and its refresh token, into a
+// credential helper. The login is returned without them, naming the helper
+// instead; on failure it is returned unchanged.
+func StoreSecrets(store credentials.Store, host string, login RegistryLogin, secret string) (RegistryLogin, error) {
+	if err := store.Store(host, login.Username, secret); err != nil {
+		return login, err
+	}
+	if login.RefreshToken != "" {
+		if err := store.Store(credentials.RefreshTokenKey(host), login.Username, login.RefreshToken); err != nil {
+			return login, err
+		}
+	}
+	login.CredentialStore = store.Name()
+	login.AuthToken = ""
+	login.RefreshToken = ""
+	return login, nil
+}
+
+// SetRegistryLogin stores the login for a registry host, makes it the default
+// registry for new environments, and saves the config
+func (c *Config) SetRegistryLogin(host string, login RegistryLogin) error {
+	host = registry.NormalizeHost(host)
+	return c.Update(func(cfg *Config) error {
+		cfg.setRegistryLogin(host, login)
+		return nil
+	})
+}
+
+// ReplaceRegistryLogin updates the stored login for a registry host, e.g.
+// with a refreshed token, without changing the default registry
+func (c *Config) ReplaceRegistryLogin(host string, login RegistryLogin) error {
+	host = registry.NormalizeHost(host)
+	return c.Update(func(cfg *Config) error {
+		if cfg.Registries == nil {
+			cfg.Registries = make(map[string]RegistryLogin)
+		}
+		cfg.Registries[host] = login
+		if host == registry.NormalizeHost(cfg.Registry) {
+			cfg.Username = login.Username
+			cfg.AuthToken = login.AuthToken
+		}
+		return nil
+	})
+}
+
+// setRegistryLogin is SetRegistryLogin on the config loaded for the update
+func (c *Config) setRegistryLogin(host string, login RegistryLogin) {
+	if c.Registries == nil {
+		c.Registries = make(map[string]RegistryLogin)
+	}
+
+	previous := registry.NormalizeHost(c.Registry)
+	if previous != host {
+		// Keep the previous default login reachable and pin environments that
+		// relied on the default, so they don't silently move registries
+		if _, exists := c.Registries[previous]; !exists && c.Username != "" {
+			c.Registries[previous] = RegistryLogin{Username: c.Username, AuthToken: c.AuthToken}
+		}
+		for name, env := range c.Environments {
+			if env.Registry == "" {
+				env.Registry = previous
+				c.Environments[name] = env
+			}
+		}
+	}
+	c.Registries[host] = login
+
+	// Docker Hub stays implicit so existing configs keep their shape
+	if registry.IsDockerHub(host) {
+		c.Registry = ""
+	} else {
+		c.Registry = host
+	}
+	c.Username = login.Username
+	c.AuthToken = login.AuthToken
 }
 
 // SetCurrentEnvironment sets the active environment
 func (c *Config) SetCurrentEnvironment(envName string) error {
 	envName = EnsureDevDropPrefix(envName)
-	c.CurrentEnvironment = envName
-	return c.Save()
+	return c.Update(func(cfg *Config) error {
+		cfg.CurrentEnvironment = envName
+		return nil
+	})
 }
 
 // GetCurrentEnvironment returns the current environment, with fallback logic
@@ -201,7 +801,266 @@ func (c *Config) GetCurrentEnvironment() string {
 	return latestEnv
 }
 
+// SetMapping binds a directory, or every directory matching a glob
+// pattern, to an environment. The pattern must be an absolute path.
+func (c *Config) SetMapping(pattern, envName string) error {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid mapping pattern '%s': %w", pattern, err)
+	}
+	return c.Update(func(cfg *Config) error {
+		if cfg.Mappings == nil {
+			cfg.Mappings = make(map[string]string)
+		}
+		cfg.Mappings[filepath.Clean(pattern)] = EnsureDevDropPrefix(envName)
+		return nil
+	})
+}
+
+// RemoveMapping removes a directory mapping, reporting whether it existed
+func (c *Config) RemoveMapping(pattern string) (bool, error) {
+	pattern = filepath.Clean(pattern)
+	if _, exists := c.Mappings[pattern]; !exists {
+		return false, nil
+	}
+	removed := false
+	err := c.Update(func(cfg *Config) error {
+		_, removed = cfg.Mappings[pattern]
+		delete(cfg.Mappings, pattern)
+		return nil
+	})
+	return removed, err
+}
+
+// MappingFor returns the mapping that applies to dir, an absolute path.
+// Mappings apply to the matched directory and everything below it; when
+// several match, the one matching the closest ancestor wins, and at the same
+// ancestor an exact path beats a glob and a longer glob beats a shorter one.
+func (c *Config) MappingFor(dir string) (pattern, envName string, ok bool) {
+	if len(c.Mappings) == 0 {
+		return "", "", false
+	}
+
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		if envName, exists := c.Mappings[current]; exists {
+			return current, envName, true
+		}
+
+		best := ""
+		for candidate := range c.Mappings {
+			if matched, _ := filepath.Match(candidate, current); !matched {
+				continue
+			}
+			if best == "" || len(candidate) > len(best) || (len(candidate) == len(best) && candidate < best) {
+				best = candidate
+			}
+		}
+		if best != "" {
+			return best, c.Mappings[best], true
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			return "", "", false
+		}
+	}
+}
+
 // HasEnvironments returns true if any environments are configured
 func (c *Config) HasEnvironments() bool {
 	return len(c.Environments) > 0
 }
+
+// SetFavorite marks or unmarks an environment as a favorite
+func (c *Config) SetFavorite(envName string, favorite bool) error {
+	envName = EnsureDevDropPrefix(envName)
+	return c.Update(func(cfg *Config) error {
+		env, exists := cfg.Environments[envName]
+		if !exists {
+			return &EnvironmentNotFoundError{Name: envName}
+		}
+		env.Favorite = favorite
+		cfg.Environments[envName] = env
+		return nil
+	})
+}
+
+// MarkEnvironmentUsed records that an environment was just run, in
+// workspace unless it is empty
+func (c *Config) MarkEnvironmentUsed(envName, workspace string) error {
+	envName = EnsureDevDropPrefix(envName)
+	return c.Update(func(cfg *Config) error {
+		env, exists := cfg.Environments[envName]
+		if !exists {
+			return &EnvironmentNotFoundError{Name: envName}
+		}
+		env.LastUsed = time.Now()
+		if workspace != "" {
+			env.LastWorkspace = workspace
+		}
+		cfg.Environments[envName] = env
+		return nil
+	})
+}
+
+// OrderForSelection orders environment names for interactive prompts: the
+// current environment pinned first, then favorites, then the most recently
+// used. Ties are broken by name so the order is stable between invocations.
+func (c *Config) OrderForSelection(names []string) []string {
+	current := c.GetCurrentEnvironment()
+	ordered := make([]string, len(names))
+	copy(ordered, names)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		ni, nj := ordered[i], ordered[j]
+		if (ni == current) != (nj == current) {
+			return ni == current
+		}
+		ei, ej := c.Environments[ni], c.Environments[nj]
+		if ei.Favorite != ej.Favorite {
+			return ei.Favorite
+		}
+		if !ei.LastUsed.Equal(ej.LastUsed) {
+			return ei.LastUsed.After(ej.LastUsed)
+		}
+		return ni < nj
+	})
+	return ordered
+}
+
+// ValidateSortKey returns an error if key is not a known sort key
+func ValidateSortKey(key string) error {
+	switch key {
+	case "", SortByName, SortByCreated, SortByUpdated, SortByUsed:
+		return nil
+	}
+	return fmt.Errorf("unknown sort key '%s'. Available options: %s, %s, %s, %s", key, SortByName, SortByCreated, SortByUpdated, SortByUsed)
+}
+
+// EnvironmentNames returns all environment names sorted by the configured sort key
+func (c *Config) EnvironmentNames() []string {
+	return c.SortedEnvironmentNames(c.SortBy)
+}
+
+// SortedEnvironmentNames returns all environment names sorted by key. Time-based
+// keys list the newest first; ties and unknown keys fall back to sorting by name.
+func (c *Config) SortedEnvironmentNames(key string) []string {
+	names := make([]string, 0, len(c.Environments))
+	for name := range c.Environments {
+		names = append(names, name)
+	}
+
+	timeOf := func(env Environment) time.Time {
+		switch key {
+		case SortByCreated:
+			return env.Created
+		case SortByUpdated:
+			return env.LastUpdated
+		case SortByUsed:
+			return env.LastUsed
+		}
+		return time.Time{}
+	}
+
+	sort.SliceStable(names, func(i, j int) bool {
+		ti, tj := timeOf(c.Environments[names[i]]), timeOf(c.Environments[names[j]])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// NextVersionTag returns the next incrementing version tag (v1, v2, ...)
+func (e Environment) NextVersionTag() string {
+	highest := 0
+	for _, v := range e.Versions {
+		var n int
+		if _, err := fmt.Sscanf(v.Tag, "v%d", &n); err == nil && n > highest {
+			highest = n
+		}
+	}
+	return fmt.Sprintf("v%d", highest+1)
+}
+
+// LatestPlatforms returns the platforms of the latest version, or nil if it
+// isn't a multi-arch version
+func (e Environment) LatestPlatforms() []string {
+	latest, _ := e.FindVersion(e.LatestVersion)
+	return latest.Platforms
+}
+
+// FindVersion returns the version with the given tag
+func (e Environment) FindVersion(tag string) (Version, bool) {
+	for _, v := range e.Versions {
+		if v.Tag == tag {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+// RecordPull records that the latest image of an environment was pulled,
+// adding environments that so far only existed in the registry. It reports
+// whether the environment was added.
+func (c *Config) RecordPull(envName, imageName string) (bool, error) {
+	added := false
+	err := c.Update(func(cfg *Config) error {
+		env, exists := cfg.Environments[envName]
+		if !exists {
+			// We don't know the original base image, so use the pulled image
+			env = Environment{
+				BaseImage:   imageName,
+				Registry:    cfg.Registry,
+				Created:     time.Now(),
+				Description: fmt.Sprintf("Environment pulled from DockerHub (%s)", imageName),
+			}
+			added = true
+		}
+		env.Image = imageName
+		env.LastUpdated = time.Now()
+		if cfg.Environments == nil {
+			cfg.Environments = make(map[string]Environment)
+		}
+		cfg.Environments[envName] = env
+		return nil
+	})
+	return added, err
+}
+
+// RemoveVersions drops versions of an environment from its history, e.g.
+// after they were pruned from the registry
+func (c *Config) RemoveVersions(envName string, tags []string) error {
+	envName = EnsureDevDropPrefix(envName)
+	removed := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		removed[tag] = true
+	}
+	return c.Update(func(cfg *Config) error {
+		env, exists := cfg.Environments[envName]
+		if !exists {
+			return &EnvironmentNotFoundError{Name: envName}
+		}
+		var versions []Version
+		for _, v := range env.Versions {
+			if !removed[v.Tag] {
+				versions = append(versions, v)
+			}
+		}
+		env.Versions = versions
+		cfg.Environments[envName] = env
+		return nil
+	})
+}
+
+// AddRecentImage records a base image as recently used, most recent first
+func (c *Config) AddRecentImage(image string) error {
+	return c.Update(func(cfg *Config) error {
+		recent := []string{image}
+		for _, existing := range cfg.RecentImages {
+			if existing != image && len(recent) < maxRecentImages {
+				recent = append(recent, existing)
+			}
+		}
+		cfg.RecentImages = recent
+		return nil
+	})
+}
@@ -0,0 +1,163 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// legacyDir is where DevDrop kept all its files before following the XDG
+// base directory layout
+const legacyDir = ".devdrop"
+
+// cacheEntries are the entries of the legacy directory that belong in the
+// cache directory; everything else is config
+var cacheEntries = map[string]bool{
+	"dotfiles":             true,
+	"sessions":             true,
+	"registry":             true,
+	"templates-index.yaml": true,
+}
+
+// unmigratedDir returns ~/.devdrop if it is still a real directory rather
+// than the compatibility link left by Migrate
+func unmigratedDir() (string, bool) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", false
+	}
+	legacy := filepath.Join(homeDir, legacyDir)
+	info, err := os.Lstat(legacy)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	return legacy, true
+}
+
+// Migrate moves the files of the legacy ~/.devdrop directory to the XDG
+// config and cache directories and replaces it with a link to the config
+// directory, so scripts using the old paths keep working. It reports whether
+// anything was moved; once migrated it does nothing. An interrupted
+// migration is completed on the next call. Nothing is moved while
+// DEVDROP_HOME or DEVDROP_CONFIG point elsewhere.
+func Migrate() (bool, error) {
+	if overridden() {
+		return false, nil
+	}
+	legacy, ok := unmigratedDir()
+	if !ok {
+		return false, nil
+	}
+	configDir, err := xdgDir("XDG_CONFIG_HOME", ".config")
+	if err != nil {
+		return false, err
+	}
+	cacheDir, err := xdgDir("XDG_CACHE_HOME", ".cache")
+	if err != nil {
+		return false, err
+	}
+
+	if _, err := os.Stat(filepath.Join(configDir, configFile)); err == nil {
+		return false, fmt.Errorf("both %s and %s hold a DevDrop config; remove one of them to finish moving to %s", legacy, configDir, configDir)
+	}
+
+	entries, err := os.ReadDir(legacy)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", legacy, err)
+	}
+	for _, dir := range []string{configDir, cacheDir} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return false, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+	}
+
+	// The config file goes last: while it's still in the legacy directory,
+	// a failed migration is retried
+	for _, entry := range entries {
+		if entry.Name() == configFile {
+			continue
+		}
+		target := configDir
+		if cacheEntries[entry.Name()] {
+			target = cacheDir
+		}
+		if err := move(filepath.Join(legacy, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return false, err
+		}
+	}
+	if err := move(filepath.Join(legacy, configFile), filepath.Join(configDir, configFile)); err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if err := os.Remove(legacy); err != nil {
+		return true, fmt.Errorf("failed to remove %s: %w", legacy, err)
+	}
+	if err := os.Symlink(configDir, legacy); err != nil {
+		return true, fmt.Errorf("failed to link %s to %s: %w", legacy, configDir, err)
+	}
+	return true, nil
+}
+
+// move renames src to dst, copying when they are on different file systems
+func move(src, dst string) error {
+	if _, err := os.Lstat(src); err != nil {
+		return err
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	if err := copyTree(src, dst); err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", src, dst, err)
+	}
+	if err := os.RemoveAll(src); err != nil {
+		return fmt.Errorf("failed to remove %s after copying it: %w", src, err)
+	}
+	return nil
+}
+
+// copyTree copies a file, symlink or directory tree, keeping permissions
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
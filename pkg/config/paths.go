@@ -0,0 +1,167 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Environment variables that move DevDrop's files, e.g. to give a project
+// or a CI job a config of its own
+const (
+	// HomeEnv puts the config, store, keys and cache in one directory
+	HomeEnv = "DEVDROP_HOME"
+	// ConfigEnv points at the config file alone
+	ConfigEnv = "DEVDROP_CONFIG"
+)
+
+// Paths are where DevDrop keeps its files
+type Paths struct {
+	// ConfigFile is the config file
+	ConfigFile string
+	// ConfigDir holds the store and signing keys, and the config file
+	// unless DEVDROP_CONFIG moves it
+	ConfigDir string
+	// CacheDir holds data DevDrop recreates when it's missing
+	CacheDir string
+}
+
+// ResolvePaths works out where DevDrop's files are. $DEVDROP_HOME holds
+// everything, with the cache in its cache/ subdirectory. Without it, the
+// legacy ~/.devdrop is used until it has been migrated, and then
+// $XDG_CONFIG_HOME/devdrop and $XDG_CACHE_HOME/devdrop (by default
+// ~/.config/devdrop and ~/.cache/devdrop).
+//
+// $DEVDROP_CONFIG then names the config file, which is otherwise
+// config.yaml in the config directory. Relative paths in either variable
+// are taken from the working directory.
+func ResolvePaths() (Paths, error) {
+	var paths Paths
+	if home := os.Getenv(HomeEnv); home != "" {
+		dir, err := filepath.Abs(home)
+		if err != nil {
+			return Paths{}, fmt.Errorf("invalid %s: %w", HomeEnv, err)
+		}
+		paths.ConfigDir = dir
+		paths.CacheDir = filepath.Join(dir, "cache")
+	} else if legacy, ok := unmigratedDir(); ok {
+		paths.ConfigDir = legacy
+		paths.CacheDir = legacy
+	} else {
+		var err error
+		if paths.ConfigDir, err = xdgDir("XDG_CONFIG_HOME", ".config"); err != nil {
+			return Paths{}, err
+		}
+		if paths.CacheDir, err = xdgDir("XDG_CACHE_HOME", ".cache"); err != nil {
+			return Paths{}, err
+		}
+	}
+
+	paths.ConfigFile = filepath.Join(paths.ConfigDir, configFile)
+	if file := os.Getenv(ConfigEnv); file != "" {
+		abs, err := filepath.Abs(file)
+		if err != nil {
+			return Paths{}, fmt.Errorf("invalid %s: %w", ConfigEnv, err)
+		}
+		paths.ConfigFile = abs
+	}
+	return paths, nil
+}
+
+// overridden reports whether DEVDROP_HOME or DEVDROP_CONFIG move the files
+// away from their default locations
+func overridden() bool {
+	return os.Getenv(HomeEnv) != "" || os.Getenv(ConfigEnv) != ""
+}
+
+// xdgDir returns the devdrop directory under an XDG base directory, falling
+// back to the default below the home directory when the variable is unset or
+// not absolute, as the spec requires
+func xdgDir(variable, fallback string) (string, error) {
+	if base := os.Getenv(variable); filepath.IsAbs(base) {
+		return filepath.Join(base, "devdrop"), nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, fallback, "devdrop"), nil
+}
+
+// GetConfigDir returns the directory holding DevDrop's store and keys, see
+// ResolvePaths
+func GetConfigDir() (string, error) {
+	paths, err := ResolvePaths()
+	return paths.ConfigDir, err
+}
+
+// GetCacheDir returns the directory holding data DevDrop can recreate, such
+// as dotfiles clones, see ResolvePaths
+func GetCacheDir() (string, error) {
+	paths, err := ResolvePaths()
+	return paths.CacheDir, err
+}
+
+// GetConfigPath returns the path to the config file, see ResolvePaths
+func GetConfigPath() (string, error) {
+	paths, err := ResolvePaths()
+	return paths.ConfigFile, err
+}
+
+// GetStoreDir returns the directory of the content-addressed environment store
+func GetStoreDir() (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "store"), nil
+}
+
+// GetDotfilesDir returns the directory caching cloned dotfiles repositories
+func GetDotfilesDir() (string, error) {
+	dir, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "dotfiles"), nil
+}
+
+// GetKeysDir returns the directory holding DevDrop's signing keys. It's kept
+// apart from the config file so backups can include or skip secrets.
+func GetKeysDir() (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "keys"), nil
+}
+
+// GetSessionsDir returns the directory holding files of running sessions,
+// such as their environment variables
+func GetSessionsDir() (string, error) {
+	dir, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sessions"), nil
+}
+
+// GetRegistryCacheDir returns the directory caching registry API responses,
+// such as the repositories listed by 'devdrop ls'
+func GetRegistryCacheDir() (string, error) {
+	dir, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "registry"), nil
+}
+
+// GetTemplatesCachePath returns the file caching the last remote template
+// index, used when the index can't be reached
+func GetTemplatesCachePath() (string, error) {
+	dir, err := GetCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "templates-index.yaml"), nil
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PinFile is the project file pinning the environment commands use in its
+// directory and everything below it, written by 'devdrop use'. It holds the
+// environment name; blank lines and lines starting with # are ignored.
+const PinFile = ".devdrop"
+
+// FindPin looks for a PinFile in dir and its ancestors, the closest one
+// winning, and returns its path and the pinned environment
+func FindPin(dir string) (path, envName string, ok bool, err error) {
+	for current := filepath.Clean(dir); ; current = filepath.Dir(current) {
+		candidate := filepath.Join(current, PinFile)
+		if info, statErr := os.Stat(candidate); statErr == nil && !info.IsDir() {
+			envName, err := readPin(candidate)
+			if err != nil {
+				return candidate, "", false, err
+			}
+			return candidate, envName, true, nil
+		}
+
+		if parent := filepath.Dir(current); parent == current {
+			return "", "", false, nil
+		}
+	}
+}
+
+// readPin returns the environment named in a PinFile
+func readPin(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return EnsureDevDropPrefix(line), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return "", fmt.Errorf("%s names no environment", path)
+}
+
+// WritePin pins envName for dir by writing its PinFile
+func WritePin(dir, envName string) (string, error) {
+	path := filepath.Join(dir, PinFile)
+	content := fmt.Sprintf("# Environment for 'devdrop run' in this directory, see 'devdrop use'\n%s\n", EnsureDevDropPrefix(envName))
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// CurrentVersion is the version of the config file layout this devdrop
+// reads and writes. Files without a version predate versioning and count
+// as version 0.
+const CurrentVersion = 1
+
+// ErrUnsupportedVersion is returned for config files written by a newer
+// devdrop, which this one can't read without losing settings
+var ErrUnsupportedVersion = errors.New("unsupported config version")
+
+// migration upgrades a config file from one version to the next. It works
+// on the decoded YAML document, so it can read the old layout that the
+// Config struct no longer matches.
+type migration struct {
+	description string
+	apply       func(doc map[string]interface{}) error
+}
+
+// migrations[i] upgrades version i to i+1. When the layout changes in a
+// way older files don't decode into (a field renamed, moved or changing
+// type), append a migration and bump CurrentVersion.
+var migrations = []migration{
+	{
+		description: "record the config version",
+		apply:       func(doc map[string]interface{}) error { return nil },
+	},
+}
+
+// upgrade migrates the YAML of a config file to CurrentVersion. It returns
+// the version the file had; data is returned as is when it's current.
+func upgrade(configPath string, data []byte) ([]byte, int, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	version := 0
+	if value, exists := doc["version"]; exists {
+		n, ok := value.(int)
+		if !ok || n < 0 {
+			return nil, 0, fmt.Errorf("invalid version '%v' in %s: expected a whole number", value, configPath)
+		}
+		version = n
+	}
+	if version > CurrentVersion {
+		return nil, 0, fmt.Errorf("%w: %s has version %d, but this devdrop only understands up to version %d. Update devdrop to use it", ErrUnsupportedVersion, configPath, version, CurrentVersion)
+	}
+	if version == CurrentVersion {
+		return data, version, nil
+	}
+
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	for v := version; v < CurrentVersion; v++ {
+		if err := migrations[v].apply(doc); err != nil {
+			return nil, 0, fmt.Errorf("failed to upgrade config file to version %d (%s): %w", v+1, migrations[v].description, err)
+		}
+	}
+	doc["version"] = CurrentVersion
+
+	upgraded, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to upgrade config file: %w", err)
+	}
+	return upgraded, version, nil
+}
+
+// backupBeforeUpgrade keeps a copy of a config file as its old version had
+// it, the first time it's saved in the current layout, so going back to an
+// older devdrop doesn't lose settings
+func backupBeforeUpgrade(configPath string, version int) error {
+	backup := fmt.Sprintf("%s.v%d", configPath, version)
+	if _, err := os.Stat(backup); err == nil {
+		return nil
+	}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := writeFileAtomic(backup, data, 0600); err != nil {
+		return fmt.Errorf("failed to back up config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+// Package credentials keeps registry secrets out of the DevDrop config file.
+//
+// Secrets are stored through Docker credential helpers
+// (docker-credential-<name>), which front the OS keychains: macOS Keychain
+// (osxkeychain), Windows Credential Manager (wincred), libsecret
+// (secretservice) and pass. The helper configured as credsStore in the Docker
+// CLI config is preferred, otherwise the platform default is used when it is
+// installed. When no helper is available callers fall back to storing the
+// token in config.yaml and should warn the user about it; the config moves
+// such tokens into a helper once one is installed.
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+)
+
+// FileStore is the store name that keeps tokens in config.yaml
+const FileStore = "file"
+
+// ErrNotFound is returned when a store holds no secret for a registry
+var ErrNotFound = errors.New("credentials not found")
+
+// Store keeps registry secrets outside the config file
+type Store interface {
+	// Name identifies the store in the DevDrop config (e.g. "osxkeychain")
+	Name() string
+	Get(host string) (username, secret string, err error)
+	Store(host, username, secret string) error
+	Erase(host string) error
+}
+
+// Default returns the credential store to use for new logins, or nil if no
+// credential helper is available. preferred overrides the automatic choice:
+// FileStore disables helpers, any other value names a helper.
+func Default(preferred string) Store {
+	switch preferred {
+	case FileStore:
+		return nil
+	case "":
+	default:
+		return ForName(preferred)
+	}
+
+	candidates := []string{dockerCredsStore()}
+	candidates = append(candidates, platformHelpers()...)
+	for _, name := range candidates {
+		if name == "" {
+			continue
+		}
+		if store := ForName(name); store != nil {
+			return store
+		}
+	}
+	return nil
+}
+
+// ForName returns the credential helper store with the given name, or nil
+// if docker-credential-<name> is not installed
+func ForName(name string) Store {
+	path, err := exec.LookPath("docker-credential-" + name)
+	if err != nil {
+		return nil
+	}
+	return &helperStore{name: name, path: path}
+}
+
+// platformHelpers lists the helpers backed by the OS keychain, in order of preference
+func platformHelpers() []string {
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"osxkeychain"}
+	case "windows":
+		return []string{"wincred"}
+	default:
+		return []string{"secretservice", "pass"}
+	}
+}
+
+// dockerCredsStore returns the credsStore configured for the Docker CLI
+func dockerCredsStore() string {
+	dir := os.Getenv("DOCKER_CONFIG")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".docker")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return ""
+	}
+
+	var dockerConfig struct {
+		CredsStore string `json:"credsStore"`
+	}
+	if err := json.Unmarshal(data, &dockerConfig); err != nil {
+		return ""
+	}
+	return dockerConfig.CredsStore
+}
+
+// RefreshTokenKey is the host the refresh token of a web login for host is
+// stored under, next to the login's own secret
+func RefreshTokenKey(host string) string {
+	return host + "/refresh-token"
+}
+
+// serverURL is the key DevDrop secrets are stored under. It is kept apart
+// from the entries the Docker CLI manages for the same registry, so logging
+// in or out of one doesn't affect the other.
+func serverURL(host string) string {
+	return fmt.Sprintf("https://%s/devdrop", host)
+}
@@ -0,0 +1,86 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// helperStore talks to a docker-credential-<name> binary using the
+// credential helper protocol: the action is the only argument, the request
+// is written to stdin and the response read from stdout
+type helperStore struct {
+	name string
+	path string
+}
+
+// helperCredentials is the payload exchanged with credential helpers
+type helperCredentials struct {
+	ServerURL string
+	Username  string
+	Secret    string
+}
+
+func (h *helperStore) Name() string {
+	return h.name
+}
+
+func (h *helperStore) Get(host string) (string, string, error) {
+	out, err := h.run("get", []byte(serverURL(host)))
+	if err != nil {
+		return "", "", err
+	}
+
+	var creds helperCredentials
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return "", "", fmt.Errorf("failed to parse response from docker-credential-%s: %w", h.name, err)
+	}
+	return creds.Username, creds.Secret, nil
+}
+
+func (h *helperStore) Store(host, username, secret string) error {
+	payload, err := json.Marshal(helperCredentials{
+		ServerURL: serverURL(host),
+		Username:  username,
+		Secret:    secret,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode credentials: %w", err)
+	}
+
+	_, err = h.run("store", payload)
+	return err
+}
+
+func (h *helperStore) Erase(host string) error {
+	_, err := h.run("erase", []byte(serverURL(host)))
+	return err
+}
+
+func (h *helperStore) run(action string, input []byte) ([]byte, error) {
+	cmd := exec.Command(h.path, action)
+	cmd.Stdin = bytes.NewReader(input)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// Helpers report errors on stdout; "not found" is part of the protocol
+		message := strings.TrimSpace(stdout.String())
+		if message == "" {
+			message = strings.TrimSpace(stderr.String())
+		}
+		if strings.Contains(strings.ToLower(message), "credentials not found") {
+			return nil, ErrNotFound
+		}
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("docker-credential-%s %s failed: %s", h.name, action, message)
+	}
+
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,213 @@
+package docker
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// zeroTime is the timestamp reproducible commits record
+const zeroTime = `"1970-01-01T00:00:00Z"`
+
+// rewriteImageConfig copies an archive in docker save format, zeroing the
+// timestamps of the image config with the given digest. The config is
+// renamed after its new digest and manifest.json updated to match.
+func rewriteImageConfig(r io.Reader, w io.Writer, configHex string) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+
+	newHex := ""
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive: %w", err)
+		}
+
+		name := path.Clean(hdr.Name)
+		switch name {
+		case configHex + ".json", "blobs/sha256/" + configHex:
+			original, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			// OCI layouts reference the config from other blobs too; keep it
+			if strings.HasPrefix(name, "blobs/") {
+				if err := writeTarFile(tw, hdr, original); err != nil {
+					return err
+				}
+			}
+			data, err := zeroConfigTimestamps(original)
+			if err != nil {
+				return err
+			}
+			sum := sha256.Sum256(data)
+			newHex = hex.EncodeToString(sum[:])
+			renamed := *hdr
+			renamed.Name = strings.Replace(name, configHex, newHex, 1)
+			if err := writeTarFile(tw, &renamed, data); err != nil {
+				return err
+			}
+			continue
+
+		case "manifest.json":
+			if newHex == "" {
+				return fmt.Errorf("unexpected image archive layout: manifest.json precedes the image config")
+			}
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			data, err = replaceManifestConfig(data, configHex, newHex)
+			if err != nil {
+				return err
+			}
+			if err := writeTarFile(tw, hdr, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// zeroConfigTimestamps sets the creation time of an image config and of
+// its history entries to the zero time
+func zeroConfigTimestamps(data []byte) ([]byte, error) {
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse image config: %w", err)
+	}
+	config["created"] = json.RawMessage(zeroTime)
+
+	if raw, ok := config["history"]; ok {
+		var history []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &history); err != nil {
+			return nil, fmt.Errorf("failed to parse image history: %w", err)
+		}
+		for _, entry := range history {
+			if _, ok := entry["created"]; ok {
+				entry["created"] = json.RawMessage(zeroTime)
+			}
+		}
+		rewritten, err := json.Marshal(history)
+		if err != nil {
+			return nil, err
+		}
+		config["history"] = rewritten
+	}
+	return json.Marshal(config)
+}
+
+// replaceManifestConfig points the entries of manifest.json at the renamed
+// image config
+func replaceManifestConfig(data []byte, oldHex, newHex string) ([]byte, error) {
+	var manifest []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+	for _, entry := range manifest {
+		var config string
+		if err := json.Unmarshal(entry["Config"], &config); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+		}
+		rewritten, err := json.Marshal(strings.Replace(config, oldHex, newHex, 1))
+		if err != nil {
+			return nil, err
+		}
+		entry["Config"] = rewritten
+	}
+	return json.Marshal(manifest)
+}
+
+func writeTarFile(tw *tar.Writer, hdr *tar.Header, data []byte) error {
+	hdr.Size = int64(len(data))
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// retagArchive copies an archive in docker save format, replacing the tags
+// in manifest.json, so loading it doesn't move tags of existing images
+func retagArchive(r io.Reader, w io.Writer, tags map[string]string) error {
+	tr := tar.NewReader(r)
+	tw := tar.NewWriter(w)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read image archive: %w", err)
+		}
+
+		if path.Clean(hdr.Name) == "manifest.json" {
+			data, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			data, err = replaceManifestTags(data, tags)
+			if err != nil {
+				return err
+			}
+			if err := writeTarFile(tw, hdr, data); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// replaceManifestTags renames the RepoTags of manifest.json entries; tags
+// not in the map are dropped
+func replaceManifestTags(data []byte, tags map[string]string) ([]byte, error) {
+	var manifest []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+	}
+	for _, entry := range manifest {
+		var repoTags []string
+		if raw, ok := entry["RepoTags"]; ok {
+			if err := json.Unmarshal(raw, &repoTags); err != nil {
+				return nil, fmt.Errorf("failed to parse manifest.json: %w", err)
+			}
+		}
+		renamed := []string{}
+		for _, tag := range repoTags {
+			if target, ok := tags[tag]; ok {
+				renamed = append(renamed, target)
+			}
+		}
+		rewritten, err := json.Marshal(renamed)
+		if err != nil {
+			return nil, err
+		}
+		entry["RepoTags"] = rewritten
+	}
+	return json.Marshal(manifest)
+}
@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// BuildOptions configures an image build from a generated Dockerfile
+type BuildOptions struct {
+	Dockerfile string
+	Tags       []string
+	BuildArgs  map[string]string
+	// Platform selects the target platform (e.g. linux/arm64); empty uses
+	// the daemon's platform
+	Platform string
+	// Files are added to the build context next to the Dockerfile, by name
+	Files map[string]string
+}
+
+// BuildImage builds an image from a Dockerfile without any other files in
+// the build context than opts.Files. Build output is rendered like pull progress.
+func (c *Client) BuildImage(opts BuildOptions) error {
+	ctx := context.Background()
+
+	buildContext, err := dockerfileContext(opts.Dockerfile, opts.Files)
+	if err != nil {
+		return err
+	}
+
+	buildArgs := make(map[string]*string, len(opts.BuildArgs))
+	for name, value := range opts.BuildArgs {
+		value := value
+		buildArgs[name] = &value
+	}
+
+	resp, err := c.cli.ImageBuild(ctx, buildContext, types.ImageBuildOptions{
+		Tags:        opts.Tags,
+		BuildArgs:   buildArgs,
+		Platform:    opts.Platform,
+		Dockerfile:  "Dockerfile",
+		Remove:      true,
+		ForceRemove: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to build image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if err := c.displayProgress(resp.Body); err != nil {
+		return fmt.Errorf("build failed: %w", err)
+	}
+
+	return nil
+}
+
+// dockerfileContext returns a tar archive containing the Dockerfile and the
+// given files
+func dockerfileContext(dockerfile string, files map[string]string) (*bytes.Reader, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	add := func(name, content string) error {
+		header := &tar.Header{
+			Name:    name,
+			Mode:    0644,
+			Size:    int64(len(content)),
+			ModTime: time.Now(),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write([]byte(content))
+		return err
+	}
+	if err := add("Dockerfile", dockerfile); err != nil {
+		return nil, fmt.Errorf("failed to create build context: %w", err)
+	}
+	for _, name := range names {
+		if err := add(name, files[name]); err != nil {
+			return nil, fmt.Errorf("failed to create build context: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to create build context: %w", err)
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
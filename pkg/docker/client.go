@@ -10,39 +10,75 @@ package docker
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
-	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/docker/distribution/reference"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/registry"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
 )
 
 type Client struct {
-	cli *client.Client
+	cli      *client.Client
+	progress io.Writer
+	plain    bool
+	events   func(ProgressEvent)
+	// attempts is how often pulls and pushes are tried, zero for the default
+	attempts int
+	runtime  string
+	// endpoint is set for clients of a docker context or docker_host
+	endpoint *Endpoint
 }
 
 func NewClient() (*Client, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	return NewClientForRuntime(dockerRuntime{})
+}
+
+// NewClientForRuntime connects to the API socket of a container runtime
+func NewClientForRuntime(rt Runtime) (*Client, error) {
+	host, err := rt.Host()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Docker client: %w", err)
+		return nil, err
+	}
+
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s client: %w", rt.Name(), err)
 	}
 
 	// Test the connection
 	ctx := context.Background()
 	_, err = cli.Ping(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect to Docker daemon: %w", err)
+		if rt.Name() == RuntimePodman {
+			return nil, fmt.Errorf("failed to connect to the Podman API socket: %w", daemonUnavailable(err))
+		}
+		return nil, fmt.Errorf("failed to connect to Docker daemon: %w", daemonUnavailable(err))
 	}
 
-	return &Client{cli: cli}, nil
+	return &Client{cli: cli, progress: os.Stdout, runtime: rt.Name()}, nil
+}
+
+// Runtime returns the name of the container runtime the client talks to
+func (c *Client) Runtime() string {
+	return c.runtime
 }
 
 func (c *Client) Close() error {
@@ -56,25 +92,19 @@ func (c *Client) RegistryLogin(ctx context.Context, authConfig types.AuthConfig)
 	return c.cli.RegistryLogin(ctx, authConfig)
 }
 
-func (c *Client) PullImage(imageName string) error {
-	ctx := context.Background()
-	reader, err := c.cli.ImagePull(ctx, imageName, types.ImagePullOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to pull image %s: %w", imageName, err)
-	}
-	defer reader.Close()
-
-	// Read the pull output to completion (required for pull to finish)
-	// In a real implementation, you might want to display progress
-	_, err = io.ReadAll(reader)
-	if err != nil {
-		return fmt.Errorf("failed to read pull output: %w", err)
-	}
-
-	return nil
+// PullImage pulls an image. authToken may be empty for public images.
+func (c *Client) PullImage(imageName, authToken string) error {
+	return c.transfer("pull", imageName, func() (io.ReadCloser, error) {
+		return c.cli.ImagePull(context.Background(), imageName, types.ImagePullOptions{
+			RegistryAuth: authToken,
+		})
+	})
 }
 
-func (c *Client) CreateContainer(imageName string) (string, error) {
+// CreateContainer creates an interactive shell container for setting up a
+// new environment, labelled with envName. Dotfiles may be nil. Setup steps,
+// such as those of a template, run before the dotfiles are installed.
+func (c *Client) CreateContainer(imageName, envName string, dotfiles *Dotfiles, setup ...string) (string, error) {
 	ctx := context.Background()
 
 	config := &container.Config{
@@ -85,38 +115,164 @@ func (c *Client) CreateContainer(imageName string) (string, error) {
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
+		Labels:       containerLabels(envName, ""),
 	}
 
-	resp, err := c.cli.ContainerCreate(ctx, config, nil, nil, nil, "")
+	hostConfig := &container.HostConfig{}
+	if steps := append(append([]string{}, setup...), c.sessionFiles(hostConfig, "", dotfiles)...); len(steps) > 0 {
+		config.Cmd = sessionCommand(steps)
+	}
+
+	resp, err := c.createSession(ctx, envName, config, hostConfig, nil)
 	if err != nil {
 		return "", fmt.Errorf("failed to create container: %w", err)
 	}
+	if err := c.uploadSessionFiles(resp.ID, "", dotfiles); err != nil {
+		c.RemoveContainer(resp.ID)
+		return "", err
+	}
 
 	return resp.ID, nil
 }
 
-func (c *Client) StartInteractiveContainer(containerID string) error {
-	// Use docker exec to run the container interactively
-	// This is simpler and more reliable than trying to handle TTY attachment through the Go API
-	cmd := exec.Command("docker", "start", "-i", containerID)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// StartContainer starts a container in the background. Interactive shell
+// containers keep running with nothing attached until they are stopped.
+func (c *Client) StartContainer(containerID string) error {
+	if err := c.cli.ContainerStart(context.Background(), containerID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start container %s: %w", containerID, err)
+	}
+	return nil
+}
 
-	err := cmd.Run()
+// Labels DevDrop puts on the containers it creates, so they can be found
+// through the Docker API even when the config is out of date
+const (
+	// LabelEnvironment holds the environment a container was started for
+	LabelEnvironment = "devdrop.environment"
+	// LabelVersion holds the environment version the container started
+	// from; empty when it started from the base image
+	LabelVersion = "devdrop.version"
+	// LabelUser holds the host user that created the container, so users
+	// sharing a Docker daemon only see their own sessions
+	LabelUser = "devdrop.user"
+	// LabelEphemeral marks sessions run with 'devdrop run --ephemeral',
+	// which are never committed
+	LabelEphemeral = "devdrop.ephemeral"
+)
+
+// ContainerInfo summarizes a container
+type ContainerInfo struct {
+	ID          string
+	Name        string
+	Image       string
+	State       string
+	Created     time.Time
+	Environment string
+	Version     string
+	// Ephemeral sessions are removed when they end and never committed
+	Ephemeral bool
+	// Workspace is the host directory a session was started in; empty
+	// for setup sessions and containers from before it was labelled
+	Workspace string
+}
+
+// FindContainers returns the current user's containers labelled with an
+// environment, or with any environment when envName is empty, newest first.
+// Stopped containers are included unless runningOnly is set. Containers
+// from before user labels count as the current user's. Warm containers are
+// left out. For an environment, containers that lost their labels, e.g.
+// recreated by hand, are found by their SessionName.
+func (c *Client) FindContainers(envName string, runningOnly bool) ([]ContainerInfo, error) {
+	label := LabelEnvironment
+	if envName != "" {
+		label += "=" + envName
+	}
+
+	ctx := context.Background()
+	containers, err := c.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     !runningOnly,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
 	if err != nil {
-		// Check if it's just a normal exit (exit status 0, 1, or 2 are normal for bash)
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode := exitError.ExitCode()
-			// Exit codes 0, 1, 2 are normal bash exits, don't treat as errors
-			if exitCode >= 0 && exitCode <= 2 {
-				return nil
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	if envName != "" {
+		named, err := c.cli.ContainerList(ctx, types.ContainerListOptions{
+			All:     !runningOnly,
+			Filters: filters.NewArgs(filters.Arg("name", SessionNamePrefix(envName))),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w", err)
+		}
+		for _, summary := range named {
+			if summary.Labels[LabelEnvironment] != "" || len(summary.Names) == 0 {
+				continue
+			}
+			if IsSessionName(strings.TrimPrefix(summary.Names[0], "/"), envName) {
+				labels := map[string]string{LabelEnvironment: envName}
+				for k, v := range summary.Labels {
+					labels[k] = v
+				}
+				summary.Labels = labels
+				containers = append(containers, summary)
 			}
 		}
-		return fmt.Errorf("failed to start interactive container: %w", err)
 	}
 
-	return nil
+	me := HostUser()
+	infos := make([]ContainerInfo, 0, len(containers))
+	for _, summary := range containers {
+		if owner, ok := summary.Labels[LabelUser]; ok && owner != me {
+			continue
+		}
+		// Containers started by hand from a committed image carry its
+		// emptied labels; they aren't sessions
+		if summary.Labels[LabelEnvironment] == "" {
+			continue
+		}
+		// Warm containers serve 'devdrop exec'; they aren't sessions
+		if _, warm := summary.Labels[LabelWarm]; warm {
+			continue
+		}
+		// Prewarmed containers become sessions once a run claims them
+		if _, prewarmed := summary.Labels[LabelPrewarm]; prewarmed && summary.State == "paused" {
+			continue
+		}
+		name := ""
+		if len(summary.Names) > 0 {
+			name = strings.TrimPrefix(summary.Names[0], "/")
+		}
+		infos = append(infos, ContainerInfo{
+			ID:          summary.ID,
+			Name:        name,
+			Image:       summary.Image,
+			State:       summary.State,
+			Created:     time.Unix(summary.Created, 0),
+			Environment: summary.Labels[LabelEnvironment],
+			Version:     summary.Labels[LabelVersion],
+			Ephemeral:   summary.Labels[LabelEphemeral] != "",
+			Workspace:   summary.Labels[LabelWorkspace],
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Created.After(infos[j].Created) })
+	return infos, nil
+}
+
+// HostUser returns the name of the user running devdrop
+func HostUser() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// containerLabels returns the labels for a container of an environment
+func containerLabels(envName, version string) map[string]string {
+	labels := map[string]string{LabelEnvironment: envName, LabelUser: HostUser()}
+	if version != "" {
+		labels[LabelVersion] = version
+	}
+	return labels
 }
 
 func (c *Client) ImageExists(imageName string) bool {
@@ -125,86 +281,438 @@ func (c *Client) ImageExists(imageName string) bool {
 	return err == nil
 }
 
-func (c *Client) CreateWorkspaceContainer(imageName, workspaceDir string) (string, error) {
+// ContainerSpec is what the containers devdrop creates are made of: the
+// image they run and what they get from the host
+type ContainerSpec struct {
+	Image string
+	// Ports are published to the host, in docker run -p format
+	// (e.g. "3000:3000", "127.0.0.1:8080:80", "5353:53/udp")
+	Ports []string
+	// Mounts are volumes and bind mounts in source:target[:ro] format, in
+	// addition to the container's own
+	Mounts []string
+}
+
+// ports parses the ports of a spec into the ports the container exposes
+// and their bindings on the host
+func (s ContainerSpec) ports() (nat.PortSet, nat.PortMap, error) {
+	exposedPorts, portBindings, err := nat.ParsePortSpecs(s.Ports)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid port mapping: %w", err)
+	}
+	return exposedPorts, portBindings, nil
+}
+
+// WorkspaceOptions configures an interactive workspace container
+type WorkspaceOptions struct {
+	ContainerSpec
+	WorkspaceDir string
+	// WorkspacePath is where the workspace appears in the container and
+	// the shell starts; empty means DefaultWorkspacePath
+	WorkspacePath string
+	// MountMode is how WorkspaceDir gets into the container: bind (the
+	// default) mounts it; copy and sync give /workspace an anonymous volume
+	// that CopyToWorkspace fills before the container starts
+	MountMode string
+
+	// Platform runs the image for another os/arch (emulated); empty uses
+	// the daemon's native platform
+	Platform string
+	// Environment and Version label the container so it can be found again
+	Environment string
+	Version     string
+	// Tools are mounted read-only and appended to PATH for this session only
+	Tools []ToolMount
+	// Dotfiles are installed into the home directory before the shell starts
+	Dotfiles *Dotfiles
+	// EnvFile is a host file of shell-quoted KEY='value' lines exported in
+	// the shell. It is copied into the container, so it only needs to
+	// exist until the container is created.
+	EnvFile string
+	// Setup are shell commands run before the shell starts, after the
+	// variables of EnvFile are exported
+	Setup []string
+	// Network is a services network the container joins in addition to
+	// the default one; empty joins none
+	Network string
+	// ReadOnlyWorkspace bind mounts WorkspaceDir read-only
+	ReadOnlyWorkspace bool
+	// Ephemeral labels the container as never to be committed and, unless
+	// changes are synced back from it, has the daemon remove it as soon as
+	// it stops, even if devdrop itself is killed
+	Ephemeral bool
+
+	// prewarm is the options hash of a container created by PrewarmSession
+	prewarm string
+}
+
+// ValidatePorts checks port mappings in docker run -p format without
+// creating anything
+func ValidatePorts(ports []string) error {
+	if _, _, err := nat.ParsePortSpecs(ports); err != nil {
+		return fmt.Errorf("invalid port mapping: %w", err)
+	}
+	return nil
+}
+
+func (c *Client) CreateWorkspaceContainer(opts WorkspaceOptions) (string, error) {
 	ctx := context.Background()
 
+	exposedPorts, portBindings, err := opts.ports()
+	if err != nil {
+		return "", err
+	}
+
 	config := &container.Config{
-		Image:        imageName,
+		Image:        opts.Image,
 		Cmd:          []string{"/bin/bash"},
 		Tty:          true,
 		OpenStdin:    true,
 		AttachStdin:  true,
 		AttachStdout: true,
 		AttachStderr: true,
-		WorkingDir:   "/workspace",
+		WorkingDir:   workspacePath(opts.WorkspacePath),
+		ExposedPorts: exposedPorts,
+	}
+	if opts.Environment != "" {
+		config.Labels = containerLabels(opts.Environment, opts.Version)
+		config.Labels[LabelWorkspace] = opts.WorkspaceDir
 	}
 
+	workspaceBind := fmt.Sprintf("%s:%s", opts.WorkspaceDir, workspacePath(opts.WorkspacePath))
+	if opts.ReadOnlyWorkspace {
+		if opts.MountMode == MountCopy || opts.MountMode == MountSync {
+			return "", fmt.Errorf("a read-only workspace needs mount mode bind, not %s", opts.MountMode)
+		}
+		workspaceBind += ":ro"
+	}
 	hostConfig := &container.HostConfig{
-		Binds: []string{fmt.Sprintf("%s:/workspace", workspaceDir)},
+		Binds:        append([]string{workspaceBind}, opts.Mounts...),
+		PortBindings: portBindings,
+	}
+	if opts.Ephemeral {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[LabelEphemeral] = "true"
+		hostConfig.AutoRemove = opts.MountMode != MountSync
+	}
+	if opts.prewarm != "" {
+		if config.Labels == nil {
+			config.Labels = make(map[string]string)
+		}
+		config.Labels[LabelPrewarm] = opts.prewarm
+		config.Labels[LabelWorkspace] = opts.WorkspaceDir
+	}
+	if opts.MountMode == MountCopy || opts.MountMode == MountSync {
+		// An anonymous volume keeps the copy out of committed images and
+		// goes away with the container
+		hostConfig.Binds = hostConfig.Binds[1:]
+		hostConfig.Mounts = []mount.Mount{{Type: mount.TypeVolume, Target: workspacePath(opts.WorkspacePath)}}
 	}
 
-	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	steps := c.sessionFiles(hostConfig, opts.EnvFile, opts.Dotfiles)
+	if steps = append(steps, opts.Setup...); len(steps) > 0 {
+		config.Cmd = sessionCommand(steps)
+	}
+
+	if len(opts.Tools) > 0 {
+		path, err := c.toolsPath(opts.Image, opts.Tools)
+		if err != nil {
+			return "", err
+		}
+		config.Env = []string{"PATH=" + path}
+		for _, tool := range opts.Tools {
+			hostConfig.Binds = append(hostConfig.Binds, tool.Volume+":"+tool.Target+":ro")
+		}
+	}
+
+	resp, err := c.createSession(ctx, opts.Environment, config, hostConfig, platformSpec(opts.Platform))
 	if err != nil {
 		return "", fmt.Errorf("failed to create workspace container: %w", err)
 	}
+	if err := c.uploadSessionFiles(resp.ID, opts.EnvFile, opts.Dotfiles); err != nil {
+		c.RemoveContainer(resp.ID)
+		return "", err
+	}
+	if opts.Network != "" {
+		if err := c.ConnectNetwork(opts.Network, resp.ID); err != nil {
+			c.RemoveContainer(resp.ID)
+			return "", err
+		}
+	}
 
 	return resp.ID, nil
 }
 
-func (c *Client) CommitContainer(containerID, imageName string) error {
+func (c *Client) CommitContainer(containerID, imageName string, opts CommitOptions) error {
 	ctx := context.Background()
 
 	options := types.ContainerCommitOptions{
 		Reference: imageName,
-		Comment:   "DevDrop environment commit",
-		Author:    "DevDrop CLI",
+		Comment:   commitComment,
+		Author:    opts.Author,
+		Pause:     opts.Pause,
+	}
+	if opts.Comment != "" {
+		options.Comment += ": " + opts.Comment
+	}
+	if options.Author == "" {
+		options.Author = defaultCommitAuthor
+	}
+
+	// Tools added with 'run --with' were for the session only; keep them
+	// out of the image's PATH, and the session setup out of its CMD
+	info, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	for _, env := range info.Config.Env {
+		if path, ok := strings.CutPrefix(env, "PATH="); ok && strings.Contains(path, ToolsDir+"/") {
+			options.Changes = append(options.Changes, "ENV PATH="+withoutToolsPath(path))
+		}
+	}
+	if isSessionCommand(info.Config.Cmd) {
+		options.Changes = append(options.Changes, `CMD ["/bin/bash"]`)
+	}
+	reinstall, err := c.stripDotfiles(info)
+	if err != nil {
+		return err
+	}
+	defer reinstall()
+	// Always set, so a version without a message doesn't inherit the one
+	// of the version below
+	options.Changes = append(options.Changes, fmt.Sprintf("LABEL %s=%s", strconv.Quote(LabelMessage), strconv.Quote(opts.Message)))
+	// The labels describing the session would otherwise end up on the
+	// image and on every container later started from it. Labels can't be
+	// removed in a commit, only emptied.
+	for _, label := range sessionLabels {
+		if _, ok := info.Config.Labels[label]; ok {
+			options.Changes = append(options.Changes, fmt.Sprintf("LABEL %s=\"\"", strconv.Quote(label)))
+		}
 	}
 
-	_, err := c.cli.ContainerCommit(ctx, containerID, options)
+	_, err = c.cli.ContainerCommit(ctx, containerID, options)
 	if err != nil {
 		return fmt.Errorf("failed to commit container %s to %s: %w", containerID, imageName, err)
 	}
 
+	if opts.Squash {
+		if err := c.squashImage(imageName, options.Comment); err != nil {
+			return err
+		}
+	}
+	if opts.Reproducible {
+		if err := c.zeroTimestamps(imageName); err != nil {
+			return fmt.Errorf("failed to zero timestamps of %s: %w", imageName, err)
+		}
+	}
 	return nil
 }
 
 func (c *Client) PushImage(imageName, authToken string) error {
+	return c.transfer("push", imageName, func() (io.ReadCloser, error) {
+		return c.cli.ImagePush(context.Background(), imageName, types.ImagePushOptions{
+			RegistryAuth: authToken,
+		})
+	})
+}
+
+// TagImage adds the target reference to the source image
+func (c *Client) TagImage(source, target string) error {
 	ctx := context.Background()
+	if err := c.cli.ImageTag(ctx, source, target); err != nil {
+		return fmt.Errorf("failed to tag image %s as %s: %w", source, target, err)
+	}
+	return nil
+}
 
-	// Use the stored auth token for authentication
-	reader, err := c.cli.ImagePush(ctx, imageName, types.ImagePushOptions{
-		RegistryAuth: authToken,
-	})
+// SaveImage streams images as a tar archive in docker save format; layers
+// shared by the images are included once
+func (c *Client) SaveImage(imageNames ...string) (io.ReadCloser, error) {
+	reader, err := c.cli.ImageSave(context.Background(), imageNames)
 	if err != nil {
-		return fmt.Errorf("failed to push image %s: %w", imageName, err)
+		return nil, fmt.Errorf("failed to save image %s: %w", strings.Join(imageNames, ", "), err)
 	}
-	defer reader.Close()
+	return reader, nil
+}
 
-	// Read the push output to completion (required for push to finish)
-	buf, err := io.ReadAll(reader)
+// LoadImage loads images from a tar archive in docker save format
+func (c *Client) LoadImage(archive io.Reader) error {
+	resp, err := c.cli.ImageLoad(context.Background(), archive, true)
 	if err != nil {
-		return fmt.Errorf("failed to read push output: %w", err)
+		return fmt.Errorf("failed to load image: %w", err)
 	}
+	defer resp.Body.Close()
 
-	// Parse the output to check for errors
-	output := string(buf)
-	if strings.Contains(output, `"error":"`) {
-		return fmt.Errorf("push failed: %s", output)
+	if err := c.displayProgress(resp.Body); err != nil {
+		return fmt.Errorf("failed to load image: %w", err)
 	}
+	return nil
+}
 
-	// Show push progress to user (optional)
-	if len(output) > 0 {
-		fmt.Print(output)
+// LoadImageAs loads images from a tar archive in docker save format under
+// other tags: tags maps the tags in the archive to the ones to load them as
+func (c *Client) LoadImageAs(archive io.Reader, tags map[string]string) error {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(retagArchive(archive, pw, tags))
+	}()
+	if err := c.LoadImage(pr); err != nil {
+		pr.CloseWithError(err)
+		return err
 	}
+	return nil
+}
 
+// RemoveImageTag removes a tag without deleting layers other tags still use
+func (c *Client) RemoveImageTag(imageName string) error {
+	_, err := c.cli.ImageRemove(context.Background(), imageName, types.ImageRemoveOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to remove image %s: %w", imageName, err)
+	}
 	return nil
 }
 
+// ImageInfo identifies a local image by content
+type ImageInfo struct {
+	// ID is the content-addressed image ID (sha256:...)
+	ID          string
+	RepoDigests []string
+	Size        int64
+	// Layers is the number of filesystem layers
+	Layers int
+	// DiffIDs are the digests of the uncompressed layers, oldest first
+	DiffIDs []string
+	Labels map[string]string
+	// Platform is the os/arch[/variant] the image was built for
+	Platform string
+	// User is the user the image runs as; empty means root
+	User string
+}
+
+// RepoDigest returns the registry digest (sha256:...) the image has in the
+// repository of imageName, or "" when it wasn't pulled from there
+func (i ImageInfo) RepoDigest(imageName string) string {
+	digests := i.DigestsIn(imageName)
+	if len(digests) == 0 {
+		return ""
+	}
+	return digests[0]
+}
+
+// HasRepoDigest reports whether the image has a registry digest in the
+// repository of imageName
+func (i ImageInfo) HasRepoDigest(imageName, digest string) bool {
+	for _, d := range i.DigestsIn(imageName) {
+		if d == digest {
+			return true
+		}
+	}
+	return false
+}
+
+// DigestsIn returns the image's registry digests in the repository of imageName
+func (i ImageInfo) DigestsIn(imageName string) []string {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return nil
+	}
+	var digests []string
+	for _, repoDigest := range i.RepoDigests {
+		canonical, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil || canonical.Name() != named.Name() {
+			continue
+		}
+		if digested, ok := canonical.(reference.Digested); ok {
+			digests = append(digests, digested.Digest().String())
+		}
+	}
+	return digests
+}
+
+// InspectImage returns the digest information of a local image
+func (c *Client) InspectImage(imageName string) (ImageInfo, error) {
+	info, _, err := c.cli.ImageInspectWithRaw(context.Background(), imageName)
+	if err != nil {
+		return ImageInfo{}, fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+	imageInfo := ImageInfo{
+		ID:          info.ID,
+		RepoDigests: info.RepoDigests,
+		Size:        info.Size,
+		Layers:      len(info.RootFS.Layers),
+		DiffIDs:     info.RootFS.Layers,
+		Platform:    formatPlatform(info.Os, info.Architecture, info.Variant),
+	}
+	if info.Config != nil {
+		imageInfo.Labels = info.Config.Labels
+		imageInfo.User = info.Config.User
+	}
+	return imageInfo, nil
+}
+
+// RemoveImage deletes an image by ID by removing all of its tags. Images
+// still used by a container are kept and reported as an error.
+func (c *Client) RemoveImage(imageID string) error {
+	ctx := context.Background()
+
+	info, _, err := c.cli.ImageInspectWithRaw(ctx, imageID)
+	if client.IsErrNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", imageID, classify(err))
+	}
+
+	refs := info.RepoTags
+	if len(refs) == 0 {
+		refs = []string{imageID}
+	}
+	for _, ref := range refs {
+		if _, err := c.cli.ImageRemove(ctx, ref, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+			return fmt.Errorf("failed to remove image %s: %w", ref, err)
+		}
+	}
+	return nil
+}
+
+// ContainerState returns the state of a container, e.g. "running" or "exited"
+func (c *Client) ContainerState(containerID string) (string, error) {
+	info, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if client.IsErrNotFound(err) {
+		return "removed", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return info.State.Status, nil
+}
+
+// ContainerExitCode returns the exit code of a stopped container
+func (c *Client) ContainerExitCode(containerID string) (int, error) {
+	info, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return info.State.ExitCode, nil
+}
+
+// ContainerImage returns the name of a container and the image it was created from
+func (c *Client) ContainerImage(containerID string) (string, string, error) {
+	info, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return strings.TrimPrefix(info.Name, "/"), info.Config.Image, nil
+}
+
 func (c *Client) RemoveContainer(containerID string) error {
 	ctx := context.Background()
 
 	err := c.cli.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
-		Force: true, // Remove even if container is running
+		Force:         true, // Remove even if container is running
+		RemoveVolumes: true, // Anonymous volumes such as a copied workspace
 	})
 	if err != nil {
 		return fmt.Errorf("failed to remove container %s: %w", containerID, err)
@@ -213,61 +721,57 @@ func (c *Client) RemoveContainer(containerID string) error {
 	return nil
 }
 
-// Docker Hub API structs
-type DockerHubRepository struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	IsPrivate   bool   `json:"is_private"`
-	LastUpdated string `json:"last_updated"`
-}
-
-type DockerHubRepositoriesResponse struct {
-	Count    int                   `json:"count"`
-	Next     string                `json:"next"`
-	Previous string                `json:"previous"`
-	Results  []DockerHubRepository `json:"results"`
-}
+// RunHelperContainer runs a short-lived, non-interactive container and returns its
+// combined output. The container is always removed afterwards. Privileged helpers
+// are used for host-level tuning that cannot be done from an unprivileged session.
+func (c *Client) RunHelperContainer(imageName string, cmd []string, privileged bool) (string, error) {
+	ctx := context.Background()
 
-// ListDevDropRepositories lists all devdrop-* repositories for a user on Docker Hub
-func (c *Client) ListDevDropRepositories(username string) ([]string, error) {
-	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/?page_size=100", username)
+	config := &container.Config{
+		Image:      imageName,
+		Entrypoint: []string{},
+		Cmd:        cmd,
+	}
 
-	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
+	hostConfig := &container.HostConfig{
+		Privileged: privileged,
 	}
 
-	resp, err := httpClient.Get(url)
+	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
 	if err != nil {
-		return nil, fmt.Errorf("failed to query Docker Hub API: %w", err)
+		return "", fmt.Errorf("failed to create helper container: %w", err)
 	}
-	defer resp.Body.Close()
+	defer c.RemoveContainer(resp.ID)
 
-	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusNotFound {
-			return nil, fmt.Errorf("user '%s' not found on Docker Hub. Check your username in 'devdrop login'", username)
-		}
-		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-			return nil, fmt.Errorf("access denied. The user '%s' may have no public repositories or they may be private", username)
+	if err := c.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return "", fmt.Errorf("failed to start helper container: %w", err)
+	}
+
+	var exitCode int64
+	statusCh, errCh := c.cli.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return "", fmt.Errorf("failed waiting for helper container: %w", err)
 		}
-		return nil, fmt.Errorf("Docker Hub API returned status %d", resp.StatusCode)
+	case status := <-statusCh:
+		exitCode = status.StatusCode
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	logs, err := c.cli.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true})
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return "", fmt.Errorf("failed to read helper container output: %w", err)
 	}
+	defer logs.Close()
 
-	var hubResp DockerHubRepositoriesResponse
-	if err := json.Unmarshal(body, &hubResp); err != nil {
-		return nil, fmt.Errorf("failed to parse Docker Hub response: %w", err)
+	var output strings.Builder
+	if _, err := stdcopy.StdCopy(&output, &output, logs); err != nil {
+		return "", fmt.Errorf("failed to read helper container output: %w", err)
 	}
 
-	var devdropRepos []string
-	for _, repo := range hubResp.Results {
-		if strings.HasPrefix(repo.Name, "devdrop-") {
-			devdropRepos = append(devdropRepos, repo.Name)
-		}
+	if exitCode != 0 {
+		return output.String(), fmt.Errorf("helper container exited with code %d: %s", exitCode, strings.TrimSpace(output.String()))
 	}
 
-	return devdropRepos, nil
+	return output.String(), nil
 }
@@ -0,0 +1,206 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+)
+
+// defaultCommitAuthor is the author of commits that don't name one
+const defaultCommitAuthor = "DevDrop CLI"
+
+// LabelMessage holds the message of the commit that created an image
+const LabelMessage = "devdrop.message"
+
+// sessionLabels are the labels of session containers that CommitContainer
+// empties on the image
+var sessionLabels = []string{LabelEnvironment, LabelVersion, LabelUser, LabelWorkspace, LabelEphemeral, LabelPrewarm}
+
+// CommitOptions configures CommitContainer
+type CommitOptions struct {
+	// Author is recorded in the image; empty means "DevDrop CLI"
+	Author string
+	// Comment is recorded with the commit's layer
+	Comment string
+	// Message describes what changed; it is stored in the image's
+	// LabelMessage label, empty when there is none
+	Message string
+	// Pause pauses a running container while it's committed, so the image
+	// isn't taken from a file system that's being written to
+	Pause bool
+	// Reproducible zeroes the timestamps in the image config, so committing
+	// the same changes twice gives the same image metadata
+	Reproducible bool
+	// Squash flattens the committed image into a single layer, dropping
+	// files that earlier layers added and later ones deleted
+	Squash bool
+}
+
+// squashImage flattens an image into a single layer: the file system of a
+// container created from it is exported and imported again under the same
+// name, with the image's configuration reapplied. The original image is
+// left dangling for 'devdrop clean' if it can't be removed.
+func (c *Client) squashImage(imageName, comment string) error {
+	ctx := context.Background()
+
+	info, _, err := c.cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+
+	created, err := c.cli.ContainerCreate(ctx, &container.Config{Image: info.ID}, nil, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create container from %s: %w", imageName, err)
+	}
+	defer c.RemoveContainer(created.ID)
+
+	export, err := c.cli.ContainerExport(ctx, created.ID)
+	if err != nil {
+		return fmt.Errorf("failed to export %s: %w", imageName, err)
+	}
+	defer export.Close()
+
+	resp, err := c.cli.ImageImport(ctx, types.ImageImportSource{Source: export, SourceName: "-"}, imageName, types.ImageImportOptions{
+		Message:  comment,
+		Changes:  configChanges(info.Config),
+		Platform: formatPlatform(info.Os, info.Architecture, info.Variant),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to import squashed %s: %w", imageName, err)
+	}
+	defer resp.Close()
+	if err := c.displayProgress(resp); err != nil {
+		return fmt.Errorf("failed to import squashed %s: %w", imageName, err)
+	}
+
+	c.cli.ImageRemove(ctx, info.ID, types.ImageRemoveOptions{})
+	return nil
+}
+
+// configChanges returns the Dockerfile instructions that give an imported
+// image the configuration of cfg
+func configChanges(cfg *container.Config) []string {
+	if cfg == nil {
+		return nil
+	}
+	var changes []string
+	for _, env := range cfg.Env {
+		if key, value, ok := strings.Cut(env, "="); ok {
+			changes = append(changes, fmt.Sprintf("ENV %s=%s", key, strconv.Quote(value)))
+		}
+	}
+	labels := make([]string, 0, len(cfg.Labels))
+	for key := range cfg.Labels {
+		labels = append(labels, key)
+	}
+	sort.Strings(labels)
+	for _, key := range labels {
+		changes = append(changes, fmt.Sprintf("LABEL %s=%s", strconv.Quote(key), strconv.Quote(cfg.Labels[key])))
+	}
+	ports := make([]string, 0, len(cfg.ExposedPorts))
+	for port := range cfg.ExposedPorts {
+		ports = append(ports, string(port))
+	}
+	sort.Strings(ports)
+	for _, port := range ports {
+		changes = append(changes, "EXPOSE "+port)
+	}
+	if cfg.WorkingDir != "" {
+		changes = append(changes, "WORKDIR "+cfg.WorkingDir)
+	}
+	if cfg.User != "" {
+		changes = append(changes, "USER "+cfg.User)
+	}
+	if len(cfg.Entrypoint) > 0 {
+		entrypoint, _ := json.Marshal([]string(cfg.Entrypoint))
+		changes = append(changes, "ENTRYPOINT "+string(entrypoint))
+	}
+	if len(cfg.Cmd) > 0 {
+		cmd, _ := json.Marshal([]string(cfg.Cmd))
+		changes = append(changes, "CMD "+string(cmd))
+	}
+	return changes
+}
+
+// zeroTimestamps rewrites an image so its config and history carry the zero
+// time instead of the time of the commit. The Docker API can't set them, so
+// the image is saved, its config rewritten on the fly and loaded back.
+func (c *Client) zeroTimestamps(imageName string) error {
+	ctx := context.Background()
+
+	info, _, err := c.cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+	configHex := strings.TrimPrefix(info.ID, "sha256:")
+
+	archive, err := c.SaveImage(imageName)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(rewriteImageConfig(archive, pw, configHex))
+	}()
+	if err := c.LoadImage(pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+
+	// The tag now points at the rewritten image; the original is left
+	// dangling if it can't be removed, for 'devdrop clean' to pick up
+	c.cli.ImageRemove(ctx, info.ID, types.ImageRemoveOptions{})
+	return nil
+}
+
+// shells are the processes of an idle session
+var shells = map[string]bool{
+	"sh": true, "bash": true, "dash": true, "ash": true, "zsh": true, "fish": true,
+}
+
+// BusyProcesses returns the commands running in a container besides its
+// shells, e.g. a package install that a commit could catch halfway
+func (c *Client) BusyProcesses(containerID string) ([]string, error) {
+	top, err := c.cli.ContainerTop(context.Background(), containerID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes of container %s: %w", containerID, err)
+	}
+
+	column := -1
+	for i, title := range top.Titles {
+		if title == "CMD" || title == "COMMAND" {
+			column = i
+		}
+	}
+	if column < 0 {
+		return nil, fmt.Errorf("failed to list processes of container %s: no command column", containerID)
+	}
+
+	var busy []string
+	for _, process := range top.Processes {
+		if column >= len(process) {
+			continue
+		}
+		command := process[column]
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			continue
+		}
+		name := strings.TrimPrefix(path.Base(fields[0]), "-")
+		if shells[name] {
+			continue
+		}
+		busy = append(busy, command)
+	}
+	return busy, nil
+}
@@ -0,0 +1,307 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+// Endpoint is the address of a Docker daemon, from a docker context or a
+// docker_host setting
+type Endpoint struct {
+	// Host is the daemon's address: unix://, tcp:// or ssh://
+	Host string
+	// Context is the docker context the endpoint was read from, if any
+	Context string
+	// CACert, Cert and Key are TLS files for tcp:// hosts; empty means
+	// plain TCP
+	CACert string
+	Cert   string
+	Key    string
+	// SkipTLSVerify accepts any server certificate
+	SkipTLSVerify bool
+}
+
+// ParseHost checks a daemon address such as ssh://me@devbox or
+// tcp://devbox:2376. Like the docker CLI, tcp:// hosts use the TLS files in
+// DOCKER_CERT_PATH (default ~/.docker) when DOCKER_TLS_VERIFY is set.
+func ParseHost(host string) (Endpoint, error) {
+	u, err := url.Parse(host)
+	if err != nil || u.Scheme == "" {
+		return Endpoint{}, fmt.Errorf("invalid Docker host '%s': use unix://, tcp:// or ssh://", host)
+	}
+
+	endpoint := Endpoint{Host: host}
+	switch u.Scheme {
+	case "unix", "npipe":
+	case "ssh":
+		if _, err := sshCommandArgs(host); err != nil {
+			return Endpoint{}, err
+		}
+	case "tcp":
+		if u.Hostname() == "" {
+			return Endpoint{}, fmt.Errorf("invalid Docker host '%s': tcp:// needs a host name", host)
+		}
+		if os.Getenv("DOCKER_TLS_VERIFY") != "" {
+			dir := os.Getenv("DOCKER_CERT_PATH")
+			if dir == "" {
+				dir = dockerConfigDir()
+			}
+			endpoint.CACert = filepath.Join(dir, "ca.pem")
+			endpoint.Cert = filepath.Join(dir, "cert.pem")
+			endpoint.Key = filepath.Join(dir, "key.pem")
+		}
+	default:
+		return Endpoint{}, fmt.Errorf("invalid Docker host '%s': use unix://, tcp:// or ssh://", host)
+	}
+	return endpoint, nil
+}
+
+// contextMeta is the part of a docker context's meta.json devdrop reads
+type contextMeta struct {
+	Endpoints map[string]struct {
+		Host          string `json:"Host"`
+		SkipTLSVerify bool   `json:"SkipTLSVerify"`
+	} `json:"Endpoints"`
+}
+
+// LoadContext reads a docker context created with 'docker context create'
+func LoadContext(name string) (Endpoint, error) {
+	sum := sha256.Sum256([]byte(name))
+	id := fmt.Sprintf("%x", sum)
+	contexts := filepath.Join(dockerConfigDir(), "contexts")
+
+	data, err := os.ReadFile(filepath.Join(contexts, "meta", id, "meta.json"))
+	if os.IsNotExist(err) {
+		return Endpoint{}, fmt.Errorf("docker context '%s' not found. Run 'docker context ls' to see your contexts", name)
+	}
+	if err != nil {
+		return Endpoint{}, fmt.Errorf("failed to read docker context '%s': %w", name, err)
+	}
+
+	var meta contextMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return Endpoint{}, fmt.Errorf("failed to parse docker context '%s': %w", name, err)
+	}
+	docker, ok := meta.Endpoints["docker"]
+	if !ok || docker.Host == "" {
+		return Endpoint{}, fmt.Errorf("docker context '%s' has no Docker endpoint", name)
+	}
+
+	endpoint := Endpoint{Host: docker.Host, Context: name, SkipTLSVerify: docker.SkipTLSVerify}
+	tlsDir := filepath.Join(contexts, "tls", id, "docker")
+	for file, field := range map[string]*string{"ca.pem": &endpoint.CACert, "cert.pem": &endpoint.Cert, "key.pem": &endpoint.Key} {
+		if _, err := os.Stat(filepath.Join(tlsDir, file)); err == nil {
+			*field = filepath.Join(tlsDir, file)
+		}
+	}
+	return endpoint, nil
+}
+
+// CurrentContext returns the docker context the docker CLI would use:
+// DOCKER_CONTEXT, or the one selected with 'docker context use'. It returns
+// "" for the default context.
+func CurrentContext() string {
+	name := os.Getenv("DOCKER_CONTEXT")
+	if name == "" {
+		data, err := os.ReadFile(filepath.Join(dockerConfigDir(), "config.json"))
+		if err != nil {
+			return ""
+		}
+		var cfg struct {
+			CurrentContext string `json:"currentContext"`
+		}
+		if json.Unmarshal(data, &cfg) != nil {
+			return ""
+		}
+		name = cfg.CurrentContext
+	}
+	if name == "default" {
+		return ""
+	}
+	return name
+}
+
+// dockerConfigDir returns the docker CLI's configuration directory
+func dockerConfigDir() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".docker")
+}
+
+// IsRemote reports whether the daemon runs on another machine, where the
+// host paths of bind mounts don't exist
+func (e Endpoint) IsRemote() bool {
+	u, err := url.Parse(e.Host)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "ssh":
+		return true
+	case "tcp":
+		host := u.Hostname()
+		if host == "localhost" {
+			return false
+		}
+		ip := net.ParseIP(host)
+		return ip == nil || !ip.IsLoopback()
+	}
+	return false
+}
+
+// String names the endpoint for messages
+func (e Endpoint) String() string {
+	if e.Context != "" {
+		return fmt.Sprintf("%s (context %s)", e.Host, e.Context)
+	}
+	return e.Host
+}
+
+// NewClientForEndpoint connects to the Docker daemon at an endpoint
+func NewClientForEndpoint(e Endpoint) (*Client, error) {
+	var c *Client
+	if strings.HasPrefix(e.Host, "ssh://") {
+		var err error
+		if c, err = NewSSHClient(e.Host); err != nil {
+			return nil, err
+		}
+	} else {
+		opts := []client.Opt{client.WithAPIVersionNegotiation()}
+		if e.CACert != "" || e.Cert != "" || e.SkipTLSVerify {
+			tlsConfig, err := tlsconfig.Client(tlsconfig.Options{
+				CAFile:             e.CACert,
+				CertFile:           e.Cert,
+				KeyFile:            e.Key,
+				InsecureSkipVerify: e.SkipTLSVerify,
+				ExclusiveRootPools: true,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to load TLS files for %s: %w", e, err)
+			}
+			opts = append(opts, client.WithHTTPClient(&http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}))
+		}
+		opts = append(opts, client.WithHost(e.Host))
+
+		cli, err := client.NewClientWithOpts(opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Docker client for %s: %w", e, err)
+		}
+		if _, err := cli.Ping(context.Background()); err != nil {
+			cli.Close()
+			return nil, fmt.Errorf("failed to connect to Docker on %s: %w", e, daemonUnavailable(err))
+		}
+		c = &Client{cli: cli, progress: os.Stdout, runtime: RuntimeDocker}
+	}
+
+	c.endpoint = &e
+	return c, nil
+}
+
+// IsRemote reports whether the client talks to a daemon on another machine
+func (c *Client) IsRemote() bool {
+	return c.endpoint != nil && c.endpoint.IsRemote()
+}
+
+// Endpoint returns the daemon address the client was connected to with
+// NewClientForEndpoint, or "" for the local default
+func (c *Client) Endpoint() string {
+	if c.endpoint == nil {
+		return ""
+	}
+	return c.endpoint.String()
+}
+
+// uploadMount holds the files of a session that are copied in rather than
+// bind mounted: its env file and, on a remote daemon, which can't bind mount
+// this machine's directories, its dotfiles. It is an anonymous volume, so
+// they survive restarts of the session but don't end up in committed images.
+const uploadMount = "/opt/devdrop/upload"
+
+// sessionFiles adds a session's env file and dotfiles to a container
+// config and returns the setup steps that read them. The env file, and the
+// dotfiles of remote daemons, are copied in by uploadSessionFiles; local
+// dotfiles are bind mounted.
+func (c *Client) sessionFiles(hostConfig *container.HostConfig, envFile string, dotfiles *Dotfiles) []string {
+	var steps []string
+	if envFile != "" || (c.IsRemote() && dotfiles != nil) {
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{Type: mount.TypeVolume, Target: uploadMount})
+	}
+	if envFile != "" {
+		steps = append(steps, envFileStep(uploadMount+"/session.env"))
+	}
+	if dotfiles != nil {
+		if c.IsRemote() {
+			steps = append(steps, dotfiles.script(uploadMount+"/dotfiles"))
+		} else {
+			steps = append(steps, dotfiles.script(dotfilesMount))
+			hostConfig.Binds = append(hostConfig.Binds, dotfiles.bind())
+		}
+	}
+	return steps
+}
+
+// uploadSessionFiles copies a session's env file, and on a remote daemon its
+// dotfiles, into a created container
+func (c *Client) uploadSessionFiles(containerID, envFile string, dotfiles *Dotfiles) error {
+	if !c.IsRemote() {
+		dotfiles = nil
+	}
+	if envFile == "" && dotfiles == nil {
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		err := func() error {
+			if envFile != "" {
+				data, err := os.ReadFile(envFile)
+				if err != nil {
+					return err
+				}
+				// Readable by the session's user, whichever that is
+				if err := tw.WriteHeader(&tar.Header{Name: "session.env", Mode: 0644, Size: int64(len(data))}); err != nil {
+					return err
+				}
+				if _, err := tw.Write(data); err != nil {
+					return err
+				}
+			}
+			if dotfiles != nil {
+				if err := tw.WriteHeader(&tar.Header{Name: "dotfiles/", Mode: 0755, Typeflag: tar.TypeDir}); err != nil {
+					return err
+				}
+				if err := writeTarTree(tw, dotfiles.Dir, "dotfiles/", nil, nil); err != nil {
+					return err
+				}
+			}
+			return tw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	err := c.cli.CopyToContainer(context.Background(), containerID, uploadMount, pr, types.CopyToContainerOptions{})
+	pr.Close()
+	if err != nil {
+		return fmt.Errorf("failed to copy session files into container: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+)
+
+// Kinds of filesystem change in a container, as reported by Docker
+const (
+	ChangeModified = "changed"
+	ChangeAdded    = "added"
+	ChangeDeleted  = "deleted"
+)
+
+// Change is a path changed in a container's filesystem since it was created
+// from its image
+type Change struct {
+	Kind string
+	Path string
+}
+
+// ContainerChanges returns the paths added, changed or deleted in a
+// container. Mounted directories such as /workspace are not included.
+func (c *Client) ContainerChanges(containerID string) ([]Change, error) {
+	items, err := c.cli.ContainerDiff(context.Background(), containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff container %s: %w", containerID, err)
+	}
+
+	changes := make([]Change, 0, len(items))
+	for _, item := range items {
+		// Docker reports 0 for modified, 1 for added and 2 for deleted paths
+		kind := ChangeModified
+		switch item.Kind {
+		case 1:
+			kind = ChangeAdded
+		case 2:
+			kind = ChangeDeleted
+		}
+		changes = append(changes, Change{Kind: kind, Path: item.Path})
+	}
+	return changes, nil
+}
@@ -0,0 +1,117 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// DiskUsageKind is the space the container runtime uses for one kind of
+// object
+type DiskUsageKind struct {
+	Kind  string
+	Count int
+	Size  int64
+	// Reclaimable is the part of Size not used by a container (or, for
+	// containers, by running ones)
+	Reclaimable int64
+}
+
+// IsNoSpace reports whether an error means the host or the Docker daemon
+// ran out of disk space
+func IsNoSpace(err error) bool {
+	if err == nil {
+		return false
+	}
+	return errors.Is(err, syscall.ENOSPC) || strings.Contains(strings.ToLower(err.Error()), "no space left on device")
+}
+
+// ContainerSize returns the size of the files written in a container and
+// its total size including the image it was created from, about the size
+// of an image committed from it
+func (c *Client) ContainerSize(containerID string) (changes, total int64, err error) {
+	info, _, err := c.cli.ContainerInspectWithRaw(context.Background(), containerID, true)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	if info.SizeRw != nil {
+		changes = *info.SizeRw
+	}
+	if info.SizeRootFs != nil {
+		total = *info.SizeRootFs
+	}
+	return changes, total, nil
+}
+
+// DiskUsage returns the space used by images, containers, volumes and the
+// build cache, like docker system df
+func (c *Client) DiskUsage() ([]DiskUsageKind, error) {
+	usage, err := c.cli.DiskUsage(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query disk usage: %w", err)
+	}
+
+	images := DiskUsageKind{Kind: "Images", Count: len(usage.Images), Size: usage.LayersSize}
+	for _, image := range usage.Images {
+		if image.Containers == 0 {
+			unique := image.Size
+			if image.SharedSize > 0 {
+				unique -= image.SharedSize
+			}
+			images.Reclaimable += unique
+		}
+	}
+
+	containers := DiskUsageKind{Kind: "Containers", Count: len(usage.Containers)}
+	for _, container := range usage.Containers {
+		containers.Size += container.SizeRw
+		if container.State != "running" {
+			containers.Reclaimable += container.SizeRw
+		}
+	}
+
+	volumes := DiskUsageKind{Kind: "Volumes", Count: len(usage.Volumes)}
+	for _, volume := range usage.Volumes {
+		if volume.UsageData == nil || volume.UsageData.Size < 0 {
+			continue
+		}
+		volumes.Size += volume.UsageData.Size
+		if volume.UsageData.RefCount == 0 {
+			volumes.Reclaimable += volume.UsageData.Size
+		}
+	}
+
+	buildCache := DiskUsageKind{Kind: "Build cache", Count: len(usage.BuildCache)}
+	for _, record := range usage.BuildCache {
+		buildCache.Size += record.Size
+		if !record.InUse {
+			buildCache.Reclaimable += record.Size
+		}
+	}
+
+	return []DiskUsageKind{images, containers, volumes, buildCache}, nil
+}
+
+// PruneDangling removes dangling images and unused build cache of any tool,
+// like docker image prune and docker builder prune, and returns the space
+// reclaimed. Containers and volumes are left alone.
+func (c *Client) PruneDangling() (uint64, error) {
+	ctx := context.Background()
+
+	images, err := c.cli.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true")))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune images: %w", err)
+	}
+	reclaimed := images.SpaceReclaimed
+
+	cache, err := c.cli.BuildCachePrune(ctx, types.BuildCachePruneOptions{})
+	if err != nil {
+		return reclaimed, fmt.Errorf("failed to prune build cache: %w", err)
+	}
+	return reclaimed + cache.SpaceReclaimed, nil
+}
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/go-units"
+)
+
+// commitComment marks layers created by CommitContainer; a comment given
+// for the commit follows it after a colon
+const commitComment = "DevDrop environment commit"
+
+// isCommitComment reports whether a layer comment was set by CommitContainer
+func isCommitComment(comment string) bool {
+	return comment == commitComment || strings.HasPrefix(comment, commitComment+": ")
+}
+
+// buildArgsPrefix matches the "|2 NAME=value NAME=value " prefix the builder
+// adds to commands that ran with build arguments
+var buildArgsPrefix = regexp.MustCompile(`^\|\d+ (\S+=\S* )*`)
+
+// ReconstructDockerfile builds a best-effort Dockerfile from the history of
+// an image. Layers inherited from baseImage are collapsed into its FROM line
+// when the base image is available locally. Layers committed from
+// interactive sessions can't be expressed as instructions and are emitted as
+// comments.
+func (c *Client) ReconstructDockerfile(imageName, baseImage string) (string, error) {
+	ctx := context.Background()
+
+	history, err := c.cli.ImageHistory(ctx, imageName)
+	if err != nil {
+		return "", fmt.Errorf("failed to read history of %s: %w", imageName, err)
+	}
+
+	// History is newest first
+	steps := make([]image.HistoryResponseItem, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		steps = append(steps, history[i])
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Reconstructed by devdrop from the history of %s\n", imageName)
+	b.WriteString("# This is a best-effort reconstruction; review it before relying on it.\n")
+
+	if baseImage != "" {
+		if baseHistory, err := c.cli.ImageHistory(ctx, baseImage); err == nil && len(baseHistory) <= len(steps) {
+			steps = steps[len(baseHistory):]
+		} else {
+			fmt.Fprintf(&b, "# %s is not available locally, so its own layers are included below.\n", baseImage)
+		}
+		fmt.Fprintf(&b, "FROM %s\n", baseImage)
+	} else {
+		b.WriteString("# The base image is unknown; scratch is a placeholder.\n")
+		b.WriteString("FROM scratch\n")
+	}
+
+	for _, step := range steps {
+		b.WriteString(historyInstruction(step))
+	}
+
+	return b.String(), nil
+}
+
+// historyInstruction turns one history entry into Dockerfile lines
+func historyInstruction(step image.HistoryResponseItem) string {
+	if isCommitComment(step.Comment) {
+		created := time.Unix(step.Created, 0).UTC().Format("2006-01-02 15:04 MST")
+		line := fmt.Sprintf("# Interactive session committed %s (%s); changes made in a shell can't be reconstructed\n",
+			created, units.HumanSize(float64(step.Size)))
+		if comment, ok := strings.CutPrefix(step.Comment, commitComment+": "); ok {
+			line += "# " + strings.ReplaceAll(comment, "\n", " ") + "\n"
+		}
+		return line
+	}
+
+	createdBy := strings.TrimSpace(step.CreatedBy)
+	if createdBy == "" {
+		return ""
+	}
+
+	// BuildKit records the instruction itself
+	if strings.HasSuffix(createdBy, "# buildkit") {
+		instruction := strings.TrimSpace(strings.TrimSuffix(createdBy, "# buildkit"))
+		instruction = strings.Replace(instruction, "RUN /bin/sh -c ", "RUN ", 1)
+		return instruction + "\n"
+	}
+
+	createdBy = buildArgsPrefix.ReplaceAllString(createdBy, "")
+	if rest := strings.TrimPrefix(createdBy, "/bin/sh -c #(nop) "); rest != createdBy {
+		return strings.TrimSpace(rest) + "\n"
+	}
+	if rest := strings.TrimPrefix(createdBy, "/bin/sh -c "); rest != createdBy {
+		return "RUN " + rest + "\n"
+	}
+
+	// Anything else (e.g. a layer committed by other tools) is kept for reference
+	return fmt.Sprintf("# %s\n", createdBy)
+}
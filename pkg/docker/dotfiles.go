@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/oysteinje/devdrop/pkg/shell"
+)
+
+// dotfilesMount is where the host's dotfiles are mounted in a session
+const dotfilesMount = "/opt/devdrop/dotfiles"
+
+// Installing and removing dotfiles take dotfilesLock in turn, so a commit
+// removing them can't race a session that just started installing them.
+// dotfilesOff keeps a container from installing them again until it
+// restarts; both live in /dev/shm, which Docker empties on every start and
+// never commits.
+const (
+	dotfilesLock = "/dev/shm/devdrop-dotfiles.lock"
+	dotfilesOff  = "/dev/shm/devdrop-dotfiles.off"
+)
+
+// The first and last lines of the setup step that installs dotfiles, so
+// CommitContainer can find it in a session's command
+const (
+	dotfilesBegin = "# devdrop: install dotfiles"
+	dotfilesEnd   = "# devdrop: dotfiles installed"
+)
+
+// Dotfiles are copied to ~/dotfiles in a session before its shell starts.
+// They are removed again before the session is committed, so they don't
+// end up in the image.
+type Dotfiles struct {
+	// Dir is the host directory holding the dotfiles
+	Dir string
+	// Install is a script in Dir run from ~/dotfiles after copying. Without
+	// one, the files starting with a dot are linked into the home directory.
+	// What a script does outside ~/dotfiles can't be undone before a commit.
+	Install string
+	// Revision identifies the dotfiles; a container only reinstalls them
+	// when it changes
+	Revision string
+}
+
+// bind returns the read-only bind mount of the dotfiles directory
+func (d *Dotfiles) bind() string {
+	return d.Dir + ":" + dotfilesMount + ":ro"
+}
+
+// script returns the setup step that installs the dotfiles, found at dir
+// inside the container, into the user's home. Files the links replace are
+// kept in ~/.devdrop-dotfiles.orig and the links listed in
+// ~/.devdrop-dotfiles.links for removeDotfilesScript.
+func (d *Dotfiles) script(dir string) string {
+	var install string
+	if d.Install != "" {
+		script := shell.Quote("./" + d.Install)
+		install = fmt.Sprintf(`if [ -x %[1]s ]; then %[1]s; else sh %[1]s; fi`, script)
+	} else {
+		install = `for f in .[!.]*; do case "$f" in .git|.gitignore|.gitmodules|.github) continue ;; esac; [ -e "$f" ] || continue; t="$HOME/$f"; [ "$(readlink "$t")" = "$HOME/dotfiles/$f" ] && continue; if [ -e "$t" ] || [ -L "$t" ]; then mkdir -p "$HOME/.devdrop-dotfiles.orig" && mv "$t" "$HOME/.devdrop-dotfiles.orig/"; fi; ln -s "$HOME/dotfiles/$f" "$t" && echo "$f" >> "$HOME/.devdrop-dotfiles.links"; done; true`
+	}
+
+	return strings.Join([]string{
+		dotfilesBegin,
+		lockDotfiles,
+		fmt.Sprintf(`if [ ! -e %s ] && [ "$(cat "$HOME/.devdrop-dotfiles" 2>/dev/null)" != %s ]; then`, dotfilesOff, shell.Quote(d.Revision)),
+		`  echo "Installing dotfiles..."`,
+		fmt.Sprintf(`  if rm -rf "$HOME/dotfiles" && cp -R %s "$HOME/dotfiles" && (cd "$HOME/dotfiles" && %s); then`, dir, install),
+		fmt.Sprintf(`    echo %s > "$HOME/.devdrop-dotfiles"`, shell.Quote(d.Revision)),
+		`  else`,
+		`    echo "Warning: installing dotfiles failed; starting the shell anyway" >&2`,
+		`  fi`,
+		`fi`,
+		unlockDotfiles,
+		dotfilesEnd,
+	}, "\n")
+}
+
+// lockDotfiles and unlockDotfiles take and release dotfilesLock where
+// /dev/shm is available
+var (
+	lockDotfiles   = fmt.Sprintf(`if [ -w /dev/shm ]; then while ! mkdir %s 2>/dev/null; do sleep 1; done; fi`, dotfilesLock)
+	unlockDotfiles = fmt.Sprintf(`rmdir %s 2>/dev/null || true`, dotfilesLock)
+)
+
+// removeDotfilesScript undoes what the dotfiles step installed: it removes
+// the links and ~/dotfiles and puts back the files the links replaced
+var removeDotfilesScript = strings.Join([]string{
+	lockDotfiles,
+	fmt.Sprintf(`[ -w /dev/shm ] && touch %s`, dotfilesOff),
+	`if [ -f "$HOME/.devdrop-dotfiles.links" ]; then`,
+	`  while read -r f; do`,
+	`    [ "$(readlink "$HOME/$f")" = "$HOME/dotfiles/$f" ] && rm -f "$HOME/$f"`,
+	`    if [ -e "$HOME/.devdrop-dotfiles.orig/$f" ] || [ -L "$HOME/.devdrop-dotfiles.orig/$f" ]; then mv "$HOME/.devdrop-dotfiles.orig/$f" "$HOME/$f"; fi`,
+	`  done < "$HOME/.devdrop-dotfiles.links"`,
+	`fi`,
+	`rm -rf "$HOME/dotfiles" "$HOME/.devdrop-dotfiles" "$HOME/.devdrop-dotfiles.links" "$HOME/.devdrop-dotfiles.orig"`,
+	unlockDotfiles,
+}, "\n")
+
+// dotfilesStep returns the dotfiles step of a session container's command,
+// or "" when it installs none
+func dotfilesStep(cmd []string) string {
+	if !isSessionCommand(cmd) {
+		return ""
+	}
+	start := strings.Index(cmd[2], dotfilesBegin)
+	end := strings.Index(cmd[2], dotfilesEnd)
+	if start < 0 || end < start {
+		return ""
+	}
+	return cmd[2][start : end+len(dotfilesEnd)]
+}
+
+// stripDotfiles removes the dotfiles a session container installed before
+// it is committed. A stopped container is started for it and stopped
+// again. For a running one, it returns a function that installs them
+// again once the commit is done.
+func (c *Client) stripDotfiles(info types.ContainerJSON) (func(), error) {
+	step := dotfilesStep(info.Config.Cmd)
+	if step == "" {
+		return func() {}, nil
+	}
+	ctx := context.Background()
+
+	running := info.State.Running
+	if !running {
+		if err := c.cli.ContainerStart(ctx, info.ID, types.ContainerStartOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to start container %s to remove dotfiles: %w", info.ID, err)
+		}
+		timeout := time.Second
+		defer c.cli.ContainerStop(ctx, info.ID, &timeout)
+	}
+
+	run := func(script string) (int, error) {
+		return c.ExecInContainer(info.ID, ExecOptions{
+			Cmd:           []string{"/bin/sh", "-c", script},
+			WorkspacePath: info.Config.WorkingDir,
+			Stdout:        io.Discard,
+			Stderr:        io.Discard,
+		})
+	}
+	if code, err := run(removeDotfilesScript); err != nil || code != 0 {
+		if err == nil {
+			err = fmt.Errorf("exit code %d", code)
+		}
+		return nil, fmt.Errorf("failed to remove dotfiles from container %s: %w", info.ID, err)
+	}
+	if !running {
+		return func() {}, nil
+	}
+	return func() {
+		run("rm -f " + dotfilesOff + "\n" + step)
+	}, nil
+}
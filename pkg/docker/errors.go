@@ -0,0 +1,113 @@
+package docker
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+)
+
+// Kinds of failures of the container runtime, for errors.Is. Errors
+// returned by the client keep their original message and wrap one of these
+// when the failure could be told apart.
+var (
+	// ErrImageNotFound means an image doesn't exist locally or in its
+	// registry, or the registry won't say because access is denied
+	ErrImageNotFound = errors.New("image not found")
+	// ErrUnauthorized means the registry rejected the credentials, or
+	// needs some
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrDaemonUnavailable means the Docker daemon or Podman API socket
+	// couldn't be reached
+	ErrDaemonUnavailable = errors.New("container runtime unavailable")
+	// ErrNetwork means a registry couldn't be reached or the connection
+	// dropped; trying again later may succeed
+	ErrNetwork = errors.New("network error")
+)
+
+// kindError tags an error with one of the kinds above while keeping its
+// message
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// classify tags err with the kind of failure it is, if it can be told. It is
+// only for errors of image and registry operations: a missing container or
+// volume would otherwise pass for a missing image. The API reports most
+// failures with typed errors; failures inside pull and push streams only
+// come as registry messages, which are matched here and nowhere else.
+func classify(err error) error {
+	if kind := errorKind(err); kind != nil && !errors.Is(err, kind) {
+		return &kindError{kind: kind, err: err}
+	}
+	return err
+}
+
+// daemonUnavailable tags an error of connecting to the runtime
+func daemonUnavailable(err error) error {
+	return &kindError{kind: ErrDaemonUnavailable, err: err}
+}
+
+func errorKind(err error) error {
+	switch {
+	case err == nil || IsNoSpace(err):
+		return nil
+	case client.IsErrConnectionFailed(err):
+		return ErrDaemonUnavailable
+	case errdefs.IsUnauthorized(err) || errdefs.IsForbidden(err):
+		return ErrUnauthorized
+	case errdefs.IsNotFound(err):
+		return ErrImageNotFound
+	case errdefs.IsUnavailable(err) || errdefs.IsDeadline(err):
+		return ErrNetwork
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ErrNetwork
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return ErrNetwork
+	}
+
+	message := strings.ToLower(err.Error())
+	for _, pattern := range []string{"pull access denied", "manifest unknown", "name unknown"} {
+		if strings.Contains(message, pattern) {
+			return ErrImageNotFound
+		}
+	}
+	for _, pattern := range []string{"unauthorized", "authentication required", "denied", "forbidden"} {
+		if strings.Contains(message, pattern) {
+			return ErrUnauthorized
+		}
+	}
+	for _, pattern := range []string{
+		"connection reset", "connection refused", "broken pipe", "timeout", "timed out",
+		"unexpected eof", "tls handshake", "no such host", "network is unreachable",
+		"temporary failure", "too many requests", "toomanyrequests", "bad gateway",
+		"service unavailable", "gateway timeout",
+	} {
+		if strings.Contains(message, pattern) {
+			return ErrNetwork
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecOptions configures a non-interactive command run in an environment
+type ExecOptions struct {
+	ContainerSpec
+	WorkspaceDir string
+	Cmd          []string
+	// WorkspacePath is where the workspace is mounted and the command
+	// runs; empty means DefaultWorkspacePath
+	WorkspacePath string
+	// Env holds KEY=VALUE environment variables for the command
+	Env []string
+
+	// Name is the container name; empty lets Docker pick one
+	Name string
+	// AutoRemove has the daemon remove the container as soon as it exits,
+	// even if devdrop itself is killed
+	AutoRemove bool
+
+	// Stdin is forwarded to the command when set (e.g. piped input)
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// RunCommand runs a command in a new container with the workspace mounted at
+// opts.WorkspacePath, streams its output, and returns the command's exit
+// code. The container is removed afterwards.
+func (c *Client) RunCommand(opts ExecOptions) (int, error) {
+	ctx := context.Background()
+
+	exposedPorts, portBindings, err := opts.ports()
+	if err != nil {
+		return -1, err
+	}
+	config := &container.Config{
+		Image:        opts.Image,
+		Cmd:          opts.Cmd,
+		Env:          opts.Env,
+		AttachStdout: true,
+		AttachStderr: true,
+		WorkingDir:   workspacePath(opts.WorkspacePath),
+		ExposedPorts: exposedPorts,
+	}
+	if opts.Stdin != nil {
+		config.AttachStdin = true
+		config.OpenStdin = true
+		config.StdinOnce = true
+	}
+
+	hostConfig := &container.HostConfig{AutoRemove: opts.AutoRemove, PortBindings: portBindings}
+	if opts.WorkspaceDir != "" {
+		hostConfig.Binds = []string{fmt.Sprintf("%s:%s", opts.WorkspaceDir, workspacePath(opts.WorkspacePath))}
+	}
+	hostConfig.Binds = append(hostConfig.Binds, opts.Mounts...)
+
+	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, nil, nil, opts.Name)
+	if err != nil {
+		return -1, fmt.Errorf("failed to create container: %w", err)
+	}
+	defer c.RemoveContainer(resp.ID)
+
+	// Attach before starting so no output is lost
+	attach, err := c.cli.ContainerAttach(ctx, resp.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdin:  opts.Stdin != nil,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer attach.Close()
+
+	outputDone := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(opts.Stdout, opts.Stderr, attach.Reader)
+		outputDone <- err
+	}()
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, opts.Stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	// An auto-removed container is gone right after it exits, so wait for the
+	// removal instead of racing it for the exit status
+	condition := container.WaitConditionNextExit
+	if opts.AutoRemove {
+		condition = container.WaitConditionRemoved
+	}
+	statusCh, errCh := c.cli.ContainerWait(ctx, resp.ID, condition)
+
+	if err := c.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return -1, fmt.Errorf("failed to start container: %w", err)
+	}
+
+	var exitCode int
+	select {
+	case err := <-errCh:
+		if err != nil {
+			return -1, fmt.Errorf("failed waiting for container: %w", err)
+		}
+	case status := <-statusCh:
+		if status.Error != nil {
+			return -1, fmt.Errorf("container exited with error: %s", status.Error.Message)
+		}
+		exitCode = int(status.StatusCode)
+	}
+
+	// Drain the remaining output before returning
+	if err := <-outputDone; err != nil {
+		return exitCode, fmt.Errorf("failed to read command output: %w", err)
+	}
+
+	return exitCode, nil
+}
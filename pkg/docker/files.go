@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+// ErrStopWalk can be returned by a WalkImageFiles callback to stop early
+// without an error
+var ErrStopWalk = errors.New("stop walking image files")
+
+// WalkImageFiles calls fn for every entry of an image's filesystem, with
+// paths starting at "/". The content reader is only valid during the call.
+// The image is read through a container that is created but never started,
+// so nothing in the image runs.
+func (c *Client) WalkImageFiles(imageName string, fn func(header *tar.Header, content io.Reader) error) error {
+	ctx := context.Background()
+
+	// Images without a default command can't be created as-is
+	resp, err := c.cli.ContainerCreate(ctx, &container.Config{Image: imageName, Cmd: []string{"true"}}, nil, nil, nil, "")
+	if err != nil {
+		return fmt.Errorf("failed to create container from %s: %w", imageName, err)
+	}
+	defer c.RemoveContainer(resp.ID)
+
+	export, err := c.cli.ContainerExport(ctx, resp.ID)
+	if err != nil {
+		return fmt.Errorf("failed to export filesystem of %s: %w", imageName, err)
+	}
+	defer export.Close()
+
+	archive := tar.NewReader(export)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read filesystem of %s: %w", imageName, err)
+		}
+
+		header.Name = "/" + header.Name
+		if err := fn(header, archive); err != nil {
+			if errors.Is(err, ErrStopWalk) {
+				return nil
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DockerHubSearchResult is a single repository returned by the Docker Hub search API
+type DockerHubSearchResult struct {
+	RepoName         string `json:"repo_name"`
+	ShortDescription string `json:"short_description"`
+	StarCount        int    `json:"star_count"`
+	PullCount        int64  `json:"pull_count"`
+	IsOfficial       bool   `json:"is_official"`
+}
+
+type dockerHubSearchResponse struct {
+	Count   int                     `json:"count"`
+	Next    string                  `json:"next"`
+	Results []DockerHubSearchResult `json:"results"`
+}
+
+// SearchDevDropRepositories searches public Docker Hub repositories for devdrop-*
+// environments matching term. It only talks to the Hub API and needs no Docker daemon.
+func SearchDevDropRepositories(term string) ([]DockerHubSearchResult, error) {
+	query := term
+	if !strings.HasPrefix(query, "devdrop-") {
+		query = "devdrop-" + query
+	}
+
+	searchURL := fmt.Sprintf("https://hub.docker.com/v2/search/repositories/?query=%s&page_size=100", url.QueryEscape(query))
+
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := httpClient.Get(searchURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query Docker Hub search API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Docker Hub search API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	var searchResp dockerHubSearchResponse
+	if err := json.Unmarshal(body, &searchResp); err != nil {
+		return nil, fmt.Errorf("failed to parse Docker Hub response: %w", err)
+	}
+
+	var results []DockerHubSearchResult
+	for _, repo := range searchResp.Results {
+		name := repo.RepoName[strings.LastIndex(repo.RepoName, "/")+1:]
+		if strings.HasPrefix(name, "devdrop-") {
+			results = append(results, repo)
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,163 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/docker/api/types"
+)
+
+// ImageSummary describes a local image
+type ImageSummary struct {
+	ID          string
+	RepoTags    []string
+	RepoDigests []string
+	Size        int64
+	Created     time.Time
+	Labels      map[string]string
+}
+
+// Dangling reports whether the image has no tags left
+func (s ImageSummary) Dangling() bool {
+	for _, tag := range s.RepoTags {
+		if tag != "<none>:<none>" {
+			return false
+		}
+	}
+	return true
+}
+
+// ListImages returns all local images, including dangling ones
+func (c *Client) ListImages() ([]ImageSummary, error) {
+	images, err := c.cli.ImageList(context.Background(), types.ImageListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	summaries := make([]ImageSummary, 0, len(images))
+	for _, image := range images {
+		summaries = append(summaries, ImageSummary{
+			ID:          image.ID,
+			RepoTags:    image.RepoTags,
+			RepoDigests: image.RepoDigests,
+			Size:        image.Size,
+			Created:     time.Unix(image.Created, 0),
+			Labels:      image.Labels,
+		})
+	}
+	return summaries, nil
+}
+
+// CommittedByDevDrop reports whether an image's top layer was created by
+// CommitContainer
+func (c *Client) CommittedByDevDrop(imageID string) (bool, error) {
+	info, _, err := c.cli.ImageInspectWithRaw(context.Background(), imageID)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect image %s: %w", imageID, classify(err))
+	}
+	return isCommitComment(info.Comment), nil
+}
+
+// RemoveImageRef removes a tag, or an image by ID, like 'docker rmi'. Force
+// also removes images used by stopped containers. It returns what the daemon
+// untagged and deleted.
+func (c *Client) RemoveImageRef(ref string, force bool) ([]string, error) {
+	items, err := c.cli.ImageRemove(context.Background(), ref, types.ImageRemoveOptions{Force: force, PruneChildren: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove image %s: %w", ref, err)
+	}
+
+	var removed []string
+	for _, item := range items {
+		if item.Untagged != "" {
+			removed = append(removed, "untagged "+item.Untagged)
+		}
+		if item.Deleted != "" {
+			removed = append(removed, "deleted "+item.Deleted)
+		}
+	}
+	return removed, nil
+}
+
+// ImageDetails is what 'docker image inspect' and 'docker history' report
+// about a local image
+type ImageDetails struct {
+	ID           string
+	RepoTags     []string
+	RepoDigests  []string
+	Created      time.Time
+	Size         int64
+	Platform     string
+	Author       string
+	Comment      string
+	User         string
+	WorkingDir   string
+	Entrypoint   []string
+	Cmd          []string
+	ExposedPorts []string
+	Env          []string
+	Labels       map[string]string
+	// Layers lists the image's history, oldest first
+	Layers []ImageLayer
+}
+
+// ImageLayer is a step of an image's history
+type ImageLayer struct {
+	Created   time.Time
+	CreatedBy string
+	Size      int64
+	Comment   string
+}
+
+// InspectImageDetails returns the configuration and history of a local image
+func (c *Client) InspectImageDetails(imageName string) (ImageDetails, error) {
+	ctx := context.Background()
+
+	info, _, err := c.cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return ImageDetails{}, fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+
+	details := ImageDetails{
+		ID:          info.ID,
+		RepoTags:    info.RepoTags,
+		RepoDigests: info.RepoDigests,
+		Size:        info.Size,
+		Platform:    formatPlatform(info.Os, info.Architecture, info.Variant),
+		Author:      info.Author,
+		Comment:     info.Comment,
+	}
+	if created, err := time.Parse(time.RFC3339Nano, info.Created); err == nil {
+		details.Created = created
+	}
+	if info.Config != nil {
+		details.User = info.Config.User
+		details.WorkingDir = info.Config.WorkingDir
+		details.Entrypoint = info.Config.Entrypoint
+		details.Cmd = info.Config.Cmd
+		details.Env = info.Config.Env
+		details.Labels = info.Config.Labels
+		for port := range info.Config.ExposedPorts {
+			details.ExposedPorts = append(details.ExposedPorts, string(port))
+		}
+		sort.Strings(details.ExposedPorts)
+	}
+
+	history, err := c.cli.ImageHistory(ctx, info.ID)
+	if err != nil {
+		return ImageDetails{}, fmt.Errorf("failed to read history of image %s: %w", imageName, err)
+	}
+	// The daemon lists the newest step first
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i]
+		details.Layers = append(details.Layers, ImageLayer{
+			Created:   time.Unix(h.Created, 0),
+			CreatedBy: h.CreatedBy,
+			Size:      h.Size,
+			Comment:   h.Comment,
+		})
+	}
+	return details, nil
+}
@@ -0,0 +1,17 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/inotify"
+)
+
+// RaiseInotifyLimits applies the given inotify limits to the kernel behind the
+// Docker daemon using a privileged helper container started from imageName.
+// This is the only way to reach the Docker Desktop VM on macOS and Windows.
+func (c *Client) RaiseInotifyLimits(imageName string, limits inotify.Limits) error {
+	if _, err := c.RunHelperContainer(imageName, inotify.ShellCommand(limits), true); err != nil {
+		return fmt.Errorf("failed to raise inotify limits: %w", err)
+	}
+	return nil
+}
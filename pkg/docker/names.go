@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/errdefs"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// sessionNameTime is the layout of the timestamp in session container names
+const sessionNameTime = "20060102-150405"
+
+// sessionNameSuffix matches what follows the prefix in a session
+// container's name: its creation time and, for containers created in the
+// same second, a counter
+var sessionNameSuffix = regexp.MustCompile(`^\d{8}-\d{6}(-\d+)?$`)
+
+// SessionNamePrefix returns the prefix of the names of an environment's
+// session containers: the environment name starting with devdrop-, e.g.
+// devdrop-go- for both go and devdrop-go
+func SessionNamePrefix(envName string) string {
+	name := strings.Trim(unsafeVolumeChars.ReplaceAllString(envName, "-"), "-.")
+	if name == "" {
+		return "devdrop-"
+	}
+	if !strings.HasPrefix(name, "devdrop-") {
+		name = "devdrop-" + name
+	}
+	return name + "-"
+}
+
+// SessionName names a session container of an environment created at t,
+// e.g. devdrop-go-20261016-142530
+func SessionName(envName string, t time.Time) string {
+	return SessionNamePrefix(envName) + t.Format(sessionNameTime)
+}
+
+// IsSessionName reports whether a container name is one SessionName gave
+// a container of the environment
+func IsSessionName(name, envName string) bool {
+	prefix := SessionNamePrefix(envName)
+	return strings.HasPrefix(name, prefix) && sessionNameSuffix.MatchString(strings.TrimPrefix(name, prefix))
+}
+
+// createSession creates a session container named after its environment
+// and the time. A name already taken, e.g. by a container created in the
+// same second, gets a counter appended.
+func (c *Client) createSession(ctx context.Context, envName string, config *container.Config, hostConfig *container.HostConfig, platform *specs.Platform) (container.ContainerCreateCreatedBody, error) {
+	base := SessionName(envName, time.Now())
+	name := base
+	for attempt := 2; ; attempt++ {
+		resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, nil, platform, name)
+		if err == nil || !errdefs.IsConflict(err) || attempt > 10 {
+			return resp, err
+		}
+		name = fmt.Sprintf("%s-%d", base, attempt)
+	}
+}
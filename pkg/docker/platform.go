@@ -0,0 +1,140 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform validates an os/arch[/variant] platform such as
+// "linux/arm64" or "linux/arm/v7" and returns it in canonical form
+func ParsePlatform(platform string) (string, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(platform)), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("invalid platform '%s': expected os/arch[/variant], e.g. linux/amd64", platform)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return "", fmt.Errorf("invalid platform '%s': expected os/arch[/variant], e.g. linux/amd64", platform)
+		}
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// ParsePlatforms parses a comma-separated platform list, dropping duplicates
+func ParsePlatforms(list string) ([]string, error) {
+	var platforms []string
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		platform, err := ParsePlatform(item)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[platform] {
+			seen[platform] = true
+			platforms = append(platforms, platform)
+		}
+	}
+	if len(platforms) == 0 {
+		return nil, fmt.Errorf("no platforms given")
+	}
+	return platforms, nil
+}
+
+// PlatformTag returns the tag a single-platform image of a multi-arch tag is
+// pushed under, e.g. "v3-linux-arm64" for v3 on linux/arm64
+func PlatformTag(tag, platform string) string {
+	return tag + "-" + strings.ReplaceAll(platform, "/", "-")
+}
+
+// DaemonPlatform returns the native platform of the container runtime
+func (c *Client) DaemonPlatform() (string, error) {
+	version, err := c.cli.ServerVersion(context.Background())
+	if err != nil {
+		return "", fmt.Errorf("failed to query daemon version: %w", err)
+	}
+	return version.Os + "/" + version.Arch, nil
+}
+
+// ImagePlatform returns the platform a local image was built for
+func (c *Client) ImagePlatform(imageName string) (string, error) {
+	inspect, _, err := c.cli.ImageInspectWithRaw(context.Background(), imageName)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+	return formatPlatform(inspect.Os, inspect.Architecture, inspect.Variant), nil
+}
+
+// ContainerPlatform returns the platform of the image a container runs
+func (c *Client) ContainerPlatform(containerID string) (string, error) {
+	inspect, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return c.ImagePlatform(inspect.Image)
+}
+
+// PullImagePlatform pulls the variant of an image for a specific platform.
+// authToken may be empty for public images.
+func (c *Client) PullImagePlatform(imageName, platform, authToken string) error {
+	return c.transfer("pull", imageName+" for "+platform, func() (io.ReadCloser, error) {
+		return c.cli.ImagePull(context.Background(), imageName, types.ImagePullOptions{
+			RegistryAuth: authToken,
+			Platform:     platform,
+		})
+	})
+}
+
+// ManifestDescriptor describes a pushed image manifest in the registry
+type ManifestDescriptor struct {
+	MediaType string
+	Digest    string
+	Size      int64
+	// Platforms lists the os/arch variants of a multi-arch image
+	Platforms []string
+}
+
+// RemoteManifest looks up the manifest of a pushed image through the daemon
+func (c *Client) RemoteManifest(imageName, authToken string) (ManifestDescriptor, error) {
+	inspect, err := c.cli.DistributionInspect(context.Background(), imageName, authToken)
+	if err != nil {
+		return ManifestDescriptor{}, fmt.Errorf("failed to inspect %s in the registry: %w", imageName, classify(err))
+	}
+	descriptor := ManifestDescriptor{
+		MediaType: inspect.Descriptor.MediaType,
+		Digest:    inspect.Descriptor.Digest.String(),
+		Size:      inspect.Descriptor.Size,
+	}
+	for _, p := range inspect.Platforms {
+		descriptor.Platforms = append(descriptor.Platforms, formatPlatform(p.OS, p.Architecture, p.Variant))
+	}
+	return descriptor, nil
+}
+
+// platformSpec converts an os/arch[/variant] string for ContainerCreate;
+// an empty platform leaves the choice to the daemon
+func platformSpec(platform string) *specs.Platform {
+	if platform == "" {
+		return nil
+	}
+	parts := strings.SplitN(platform, "/", 3)
+	spec := &specs.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		spec.Variant = parts[2]
+	}
+	return spec
+}
+
+func formatPlatform(os, arch, variant string) string {
+	if variant != "" {
+		return os + "/" + arch + "/" + variant
+	}
+	return os + "/" + arch
+}
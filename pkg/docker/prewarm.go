@@ -0,0 +1,162 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// LabelPrewarm marks a session container started ahead of time by 'devdrop
+// daemon' and holds a hash of the options it was created with. The
+// container waits paused at its shell prompt until a run with the same
+// options claims it.
+const LabelPrewarm = "devdrop.prewarm"
+
+// Prewarmable reports whether a session with these options can come from a
+// prewarmed container: the workspace must be bind mounted and nothing may
+// need to be prepared per session, such as tools, services or setup steps.
+func Prewarmable(opts WorkspaceOptions) bool {
+	return (opts.MountMode == "" || opts.MountMode == MountBind) &&
+		len(opts.Tools) == 0 && len(opts.Setup) == 0 && opts.Network == "" &&
+		opts.Platform == "" && !opts.Ephemeral
+}
+
+// prewarmHash identifies what a session container is created with, so a
+// run finds a prewarmed container only when it would create the same one
+func (c *Client) prewarmHash(opts WorkspaceOptions) (string, error) {
+	image, _, err := c.cli.ImageInspectWithRaw(context.Background(), opts.Image)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", opts.Image, classify(err))
+	}
+
+	parts := []string{image.ID, opts.WorkspaceDir, workspacePath(opts.WorkspacePath), opts.Version, fmt.Sprint(opts.ReadOnlyWorkspace)}
+	parts = append(parts, opts.Ports...)
+	parts = append(parts, opts.Mounts...)
+	if opts.EnvFile != "" {
+		vars, err := os.ReadFile(opts.EnvFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read session variables: %w", err)
+		}
+		parts = append(parts, string(vars))
+	}
+	if opts.Dotfiles != nil {
+		parts = append(parts, opts.Dotfiles.Dir, opts.Dotfiles.Install, opts.Dotfiles.Revision)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return fmt.Sprintf("%x", sum[:8]), nil
+}
+
+// PrewarmSession makes sure a paused session container with these options
+// is ready for the next run of the environment in opts.WorkspaceDir.
+// Prewarmed containers of the workspace created with other options are
+// removed. It reports whether it created a container.
+func (c *Client) PrewarmSession(opts WorkspaceOptions) (string, bool, error) {
+	if !Prewarmable(opts) {
+		return "", false, fmt.Errorf("sessions of %s can't be prewarmed", opts.Environment)
+	}
+	ctx := context.Background()
+
+	hash, err := c.prewarmHash(opts)
+	if err != nil {
+		return "", false, err
+	}
+
+	existing, err := c.prewarmedContainers(opts.Environment, opts.WorkspaceDir)
+	if err != nil {
+		return "", false, err
+	}
+	ready := ""
+	for _, summary := range existing {
+		if ready == "" && summary.Labels[LabelPrewarm] == hash {
+			ready = summary.ID
+			continue
+		}
+		c.RemoveContainer(summary.ID)
+	}
+	if ready != "" {
+		return ready, false, nil
+	}
+
+	opts.prewarm = hash
+	containerID, err := c.CreateWorkspaceContainer(opts)
+	if err != nil {
+		return "", false, err
+	}
+	if err := c.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+		c.RemoveContainer(containerID)
+		return "", false, fmt.Errorf("failed to start prewarmed session: %w", err)
+	}
+	if err := c.cli.ContainerPause(ctx, containerID); err != nil {
+		c.RemoveContainer(containerID)
+		return "", false, fmt.Errorf("failed to pause prewarmed session: %w", err)
+	}
+	return containerID, true, nil
+}
+
+// ClaimPrewarmed unpauses a prewarmed session container created with these
+// options and returns it, ready to be attached to. It returns "" when there
+// is none, e.g. because another run claimed it first.
+func (c *Client) ClaimPrewarmed(opts WorkspaceOptions) (string, error) {
+	if !Prewarmable(opts) {
+		return "", nil
+	}
+	hash, err := c.prewarmHash(opts)
+	if err != nil {
+		return "", err
+	}
+	existing, err := c.prewarmedContainers(opts.Environment, opts.WorkspaceDir)
+	if err != nil {
+		return "", err
+	}
+	for _, summary := range existing {
+		if summary.Labels[LabelPrewarm] != hash {
+			continue
+		}
+		if err := c.cli.ContainerUnpause(context.Background(), summary.ID); err == nil {
+			return summary.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// RemovePrewarmed removes the paused prewarmed sessions of an environment,
+// or of all environments when envName is empty, and returns how many it
+// removed
+func (c *Client) RemovePrewarmed(envName string) (int, error) {
+	existing, err := c.prewarmedContainers(envName, "")
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, summary := range existing {
+		if err := c.RemoveContainer(summary.ID); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// prewarmedContainers lists the current user's prewarmed containers of an
+// environment and workspace that are still waiting to be claimed; empty
+// arguments match any. A claimed container keeps its labels, so only the
+// paused state tells it apart from a live session.
+func (c *Client) prewarmedContainers(envName, workspace string) ([]types.Container, error) {
+	args := filters.NewArgs(filters.Arg("label", LabelPrewarm), filters.Arg("label", LabelUser+"="+HostUser()), filters.Arg("status", "paused"))
+	if envName != "" {
+		args.Add("label", LabelEnvironment+"="+envName)
+	}
+	if workspace != "" {
+		args.Add("label", LabelWorkspace+"="+workspace)
+	}
+	containers, err := c.cli.ContainerList(context.Background(), types.ContainerListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prewarmed sessions: %w", err)
+	}
+	return containers, nil
+}
@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+	"golang.org/x/term"
+)
+
+// SetProgressOutput sets where pull and push progress is rendered. Pass nil
+// to suppress progress entirely; errors in the stream are still reported.
+func (c *Client) SetProgressOutput(out io.Writer) {
+	c.progress = out
+}
+
+// SetPlainProgress renders progress as one line per layer status change
+// instead of redrawn progress bars, for screen readers and logs
+func (c *Client) SetPlainProgress(plain bool) {
+	c.plain = plain
+}
+
+// ProgressEvent is an update of a pull, push, build or load, passed to the
+// function set with SetProgressEvents
+type ProgressEvent struct {
+	// Op is pull or push, empty for builds and loads
+	Op    string
+	Image string
+	Layer string
+	// Status is the layer's state, e.g. Downloading or Pull complete, or a
+	// line of build output or retry message
+	Status string
+	// Current and Total are bytes of the layer; Total is 0 when unknown
+	Current int64
+	Total   int64
+}
+
+// SetProgressEvents passes progress to fn as events instead of rendering it,
+// for front-ends that show it their own way. Pass nil to render it again.
+func (c *Client) SetProgressEvents(fn func(ProgressEvent)) {
+	c.events = fn
+}
+
+// displayProgress consumes a Docker JSON message stream, rendering per-layer
+// progress bars when the output is a terminal and plain status lines
+// otherwise. It returns the first error reported in the stream.
+func (c *Client) displayProgress(stream io.Reader) error {
+	return c.displayTransferProgress(stream, "", "")
+}
+
+// displayTransferProgress is displayProgress for a pull or push of an
+// image, which events are labelled with
+func (c *Client) displayTransferProgress(stream io.Reader, op, imageName string) error {
+	if c.events != nil {
+		return emitProgress(stream, ProgressEvent{Op: op, Image: imageName}, c.events)
+	}
+
+	out := c.progress
+	if out == nil {
+		out = io.Discard
+	}
+
+	if c.plain {
+		return displayPlainProgress(stream, out)
+	}
+
+	var fd uintptr
+	isTerminal := false
+	if f, ok := out.(*os.File); ok {
+		fd = f.Fd()
+		isTerminal = term.IsTerminal(int(fd))
+	}
+
+	return jsonmessage.DisplayJSONMessagesStream(stream, out, fd, isTerminal, nil)
+}
+
+// displayPlainProgress prints each layer status once, skipping the in-flight
+// byte counters that would otherwise produce hundreds of lines
+func displayPlainProgress(stream io.Reader, out io.Writer) error {
+	dec := json.NewDecoder(stream)
+	lastStatus := make(map[string]string)
+
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+
+		if msg.Error != nil {
+			return msg.Error
+		}
+		// Build output arrives as raw stream chunks
+		if msg.Stream != "" {
+			fmt.Fprint(out, msg.Stream)
+			continue
+		}
+		if msg.Progress != nil && msg.Progress.Current > 0 {
+			continue
+		}
+		if msg.Status == "" || lastStatus[msg.ID] == msg.Status {
+			continue
+		}
+		lastStatus[msg.ID] = msg.Status
+
+		if msg.ID != "" {
+			fmt.Fprintf(out, "%s: %s\n", msg.ID, msg.Status)
+		} else {
+			fmt.Fprintln(out, msg.Status)
+		}
+	}
+}
+
+// emitProgress passes every message of the stream to fn, labelled like base
+func emitProgress(stream io.Reader, base ProgressEvent, fn func(ProgressEvent)) error {
+	dec := json.NewDecoder(stream)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+
+		e := base
+		e.Layer = msg.ID
+		e.Status = msg.Status
+		if msg.Stream != "" {
+			if e.Status = strings.TrimRight(msg.Stream, "\n"); e.Status == "" {
+				continue
+			}
+		}
+		if msg.Progress != nil {
+			e.Current = msg.Progress.Current
+			e.Total = msg.Progress.Total
+		}
+		fn(e)
+	}
+}
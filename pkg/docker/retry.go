@@ -0,0 +1,180 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// DefaultTransferAttempts is how often a pull or push is tried before
+// giving up
+const DefaultTransferAttempts = 4
+
+// Backoff between attempts: the delay doubles after every failed attempt
+const (
+	retryInitialDelay = 2 * time.Second
+	retryMaxDelay     = 30 * time.Second
+)
+
+// TransferError is returned when a pull or push failed, after retrying it
+// if the failure was a network problem. It wraps the kind of failure, e.g.
+// ErrImageNotFound, when it could be told.
+type TransferError struct {
+	// Op is "pull" or "push"
+	Op    string
+	Image string
+	// Attempts is how often the transfer was tried
+	Attempts int
+	// Retryable is set when the last failure was an ErrNetwork, so running
+	// the command again later may succeed
+	Retryable bool
+	Err       error
+}
+
+func (e *TransferError) Error() string {
+	if e.Attempts > 1 {
+		return fmt.Sprintf("failed to %s image %s after %d attempts: %v", e.Op, e.Image, e.Attempts, e.Err)
+	}
+	return fmt.Sprintf("failed to %s image %s: %v", e.Op, e.Image, e.Err)
+}
+
+func (e *TransferError) Unwrap() error {
+	return e.Err
+}
+
+// SetTransferAttempts sets how often pulls and pushes are tried when they
+// fail with a network error; 1 disables retries
+func (c *Client) SetTransferAttempts(attempts int) {
+	c.attempts = attempts
+}
+
+// transferLayers counts the layers of a pull or push by their final status
+type transferLayers struct {
+	// Total is the number of layers the registry or daemon reported
+	Total int
+	// Done layers finished transferring in this attempt
+	Done int
+	// Existing layers were already there: in the registry for a push, in
+	// the local image store for a pull
+	Existing int
+}
+
+// transfer runs a pull or push, retrying with backoff while it fails with
+// network errors. Layers that finished before a failure are skipped by the
+// daemon and registry on the next attempt, which is reported as they are.
+func (c *Client) transfer(op, imageName string, start func() (io.ReadCloser, error)) error {
+	attempts := c.attempts
+	if attempts < 1 {
+		attempts = DefaultTransferAttempts
+	}
+	out := c.progress
+	if out == nil {
+		out = io.Discard
+	}
+	note := func(format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if c.events != nil {
+			c.events(ProgressEvent{Op: op, Image: imageName, Status: msg})
+			return
+		}
+		fmt.Fprintln(out, msg)
+	}
+
+	delay := retryInitialDelay
+	for attempt := 1; ; attempt++ {
+		layers, err := c.transferOnce(op, imageName, start)
+		if err == nil {
+			if attempt > 1 && layers.Existing > 0 {
+				note("Resumed: %d of %d layers were already transferred", layers.Existing, layers.Total)
+			}
+			return nil
+		}
+
+		err = classify(err)
+		retryable := errors.Is(err, ErrNetwork)
+		if !retryable || attempt >= attempts {
+			return &TransferError{Op: op, Image: imageName, Attempts: attempt, Retryable: retryable, Err: err}
+		}
+
+		note("Failed to %s %s: %v", op, imageName, err)
+		if finished := layers.Done + layers.Existing; finished > 0 {
+			note("%d of %d layers finished and won't be transferred again", finished, layers.Total)
+		}
+		note("Retrying in %s (attempt %d of %d)...", delay, attempt+1, attempts)
+		time.Sleep(delay)
+		if delay *= 2; delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+}
+
+// transferOnce starts a pull or push and renders its progress, counting
+// the layers in the stream as it goes
+func (c *Client) transferOnce(op, imageName string, start func() (io.ReadCloser, error)) (transferLayers, error) {
+	reader, err := start()
+	if err != nil {
+		return transferLayers{}, err
+	}
+	defer reader.Close()
+
+	pr, pw := io.Pipe()
+	counted := make(chan transferLayers, 1)
+	go func() {
+		counted <- countLayers(pr)
+	}()
+
+	err = c.displayTransferProgress(io.TeeReader(reader, pw), op, imageName)
+	pw.Close()
+	return <-counted, err
+}
+
+// countLayers reads a Docker JSON message stream to its end and counts the
+// layers by the last status each one reported
+func countLayers(stream io.Reader) transferLayers {
+	defer io.Copy(io.Discard, stream)
+
+	status := make(map[string]string)
+	var order []string
+	dec := json.NewDecoder(stream)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			break
+		}
+		if msg.ID == "" || !isLayerStatus(msg.Status) {
+			continue
+		}
+		if _, seen := status[msg.ID]; !seen {
+			order = append(order, msg.ID)
+		}
+		status[msg.ID] = msg.Status
+	}
+
+	layers := transferLayers{Total: len(order)}
+	for _, id := range order {
+		switch s := status[id]; {
+		case s == "Layer already exists" || s == "Already exists" || strings.HasPrefix(s, "Mounted from"):
+			layers.Existing++
+		case s == "Pushed" || s == "Pull complete":
+			layers.Done++
+		}
+	}
+	return layers
+}
+
+// isLayerStatus reports whether a progress status belongs to a layer, as
+// opposed to the tag or digest lines of a pull or push
+func isLayerStatus(status string) bool {
+	switch status {
+	case "Preparing", "Waiting", "Pushing", "Pushed", "Layer already exists",
+		"Pulling fs layer", "Downloading", "Verifying Checksum", "Download complete",
+		"Extracting", "Pull complete", "Already exists", "Retrying":
+		return true
+	}
+	return strings.HasPrefix(status, "Mounted from") || strings.HasPrefix(status, "Retrying in")
+}
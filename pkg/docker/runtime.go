@@ -0,0 +1,129 @@
+package docker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// RuntimeAuto picks Docker when its daemon is reachable and Podman otherwise
+	RuntimeAuto = "auto"
+	// RuntimeDocker talks to the Docker daemon (DOCKER_HOST or the default socket)
+	RuntimeDocker = "docker"
+	// RuntimePodman talks to Podman through its Docker-compatible API socket
+	RuntimePodman = "podman"
+)
+
+// Runtime is a container engine DevDrop can drive. All engines are used
+// through the Docker Engine API, so a runtime only has to say where its API
+// socket is.
+type Runtime interface {
+	// Name is the runtime's name as used in the config, e.g. "podman"
+	Name() string
+	// Host returns the API address, or "" to use the Docker SDK defaults
+	// (DOCKER_HOST and friends)
+	Host() (string, error)
+}
+
+// ValidateRuntime checks a runtime name from the config or command line
+func ValidateRuntime(name string) error {
+	switch name {
+	case "", RuntimeAuto, RuntimeDocker, RuntimePodman:
+		return nil
+	}
+	return fmt.Errorf("invalid runtime '%s': must be %s, %s or %s", name, RuntimeAuto, RuntimeDocker, RuntimePodman)
+}
+
+// SelectRuntime returns the runtime for name. An empty name or "auto"
+// prefers Docker when DOCKER_HOST is set or its socket accepts connections,
+// then Podman when a Podman socket is found, and falls back to Docker so
+// connection errors mention the more common setup.
+func SelectRuntime(name string) (Runtime, error) {
+	if err := ValidateRuntime(name); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case RuntimeDocker:
+		return dockerRuntime{}, nil
+	case RuntimePodman:
+		return podmanRuntime{}, nil
+	}
+
+	if os.Getenv("DOCKER_HOST") != "" || socketAccepts("/var/run/docker.sock") {
+		return dockerRuntime{}, nil
+	}
+	if _, err := (podmanRuntime{}).Host(); err == nil {
+		return podmanRuntime{}, nil
+	}
+	return dockerRuntime{}, nil
+}
+
+// dockerRuntime is the Docker daemon, located by the SDK's usual rules
+type dockerRuntime struct{}
+
+func (dockerRuntime) Name() string { return RuntimeDocker }
+
+func (dockerRuntime) Host() (string, error) { return "", nil }
+
+// podmanRuntime is Podman's Docker-compatible API service. Rootless Podman
+// listens on a per-user socket that is enabled with
+// "systemctl --user enable --now podman.socket"; on macOS and Windows the
+// socket is provided by the Podman machine.
+type podmanRuntime struct{}
+
+func (podmanRuntime) Name() string { return RuntimePodman }
+
+func (podmanRuntime) Host() (string, error) {
+	// Podman's own override, as used by podman --remote
+	if host := os.Getenv("CONTAINER_HOST"); host != "" {
+		return host, nil
+	}
+
+	for _, socket := range podmanSocketCandidates() {
+		if socketAccepts(socket) {
+			return "unix://" + socket, nil
+		}
+	}
+
+	// Ask podman itself, which knows about Podman machines
+	if path, err := exec.LookPath("podman"); err == nil {
+		out, err := exec.Command(path, "info", "--format", "{{.Host.RemoteSocket.Path}}").Output()
+		if err == nil {
+			socket := strings.TrimPrefix(strings.TrimSpace(string(out)), "unix://")
+			if socket != "" && socketAccepts(socket) {
+				return "unix://" + socket, nil
+			}
+		}
+	}
+
+	return "", daemonUnavailable(fmt.Errorf("no Podman API socket found. Start it with 'systemctl --user enable --now podman.socket' (or 'podman machine start' on macOS/Windows)"))
+}
+
+// podmanSocketCandidates lists the usual rootless and rootful socket paths
+func podmanSocketCandidates() []string {
+	var candidates []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"))
+	}
+	candidates = append(candidates,
+		fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid()),
+		"/run/podman/podman.sock",
+	)
+	return candidates
+}
+
+// socketAccepts reports whether a unix socket exists and accepts connections
+func socketAccepts(path string) bool {
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
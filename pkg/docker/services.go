@@ -0,0 +1,248 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+// Labels of service containers and networks. Service containers aren't
+// labelled with LabelEnvironment, so they never count as sessions.
+const (
+	// LabelService holds the name of the service a container runs
+	LabelService = "devdrop.service"
+	// LabelServiceEnvironment holds the environment a service container or
+	// network belongs to
+	LabelServiceEnvironment = "devdrop.service.environment"
+	// LabelServiceConfig holds a hash of what a service container was
+	// created with, so a changed service gets a new container
+	LabelServiceConfig = "devdrop.service.config"
+)
+
+// ErrServicesInUse is returned by StopServices while a session other than
+// the services runs on their network
+var ErrServicesInUse = errors.New("services are in use by a running session")
+
+// ServiceOptions configures a sidecar service container of a session
+type ServiceOptions struct {
+	ContainerSpec
+	// Name is the service name, the host name sessions reach it under
+	Name    string
+	Command []string
+	// Env holds KEY=VALUE environment variables
+	Env []string
+}
+
+// ServiceNetwork returns the network the services of an environment run on
+// for a workspace, e.g. devdrop-go-alice-1a2b3c4d
+func ServiceNetwork(envName, workspace string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	return fmt.Sprintf("%s-%s-%x", envName, unsafeVolumeChars.ReplaceAllString(HostUser(), "-"), sum[:4])
+}
+
+// serviceContainer returns the name of a service's container on a network
+func serviceContainer(networkName, service string) string {
+	return networkName + "-" + service
+}
+
+// StartServices starts the services of an environment for a workspace on
+// their network, creating the network and pulling images as needed.
+// Services already running with the same configuration, e.g. kept from an
+// earlier session, are reused. It returns the network and the names of the
+// services it started.
+func (c *Client) StartServices(envName, workspace string, services []ServiceOptions) (string, []string, error) {
+	ctx := context.Background()
+	networkName := ServiceNetwork(envName, workspace)
+
+	if err := c.ensureServiceNetwork(networkName, envName, workspace); err != nil {
+		return "", nil, err
+	}
+
+	var started []string
+	for _, service := range services {
+		name := serviceContainer(networkName, service.Name)
+		hash := serviceConfigHash(service)
+
+		info, err := c.cli.ContainerInspect(ctx, name)
+		switch {
+		case err == nil && info.Config.Labels[LabelServiceConfig] == hash:
+			if info.State.Running {
+				continue
+			}
+			if err := c.cli.ContainerStart(ctx, info.ID, types.ContainerStartOptions{}); err != nil {
+				return "", started, fmt.Errorf("failed to start service %s: %w", service.Name, err)
+			}
+			started = append(started, service.Name)
+			continue
+		case err == nil:
+			// The service changed since its container was created
+			if err := c.RemoveContainer(info.ID); err != nil {
+				return "", started, err
+			}
+		case !client.IsErrNotFound(err):
+			return "", started, fmt.Errorf("failed to inspect service %s: %w", service.Name, err)
+		}
+
+		if err := c.createService(networkName, envName, workspace, name, hash, service); err != nil {
+			return "", started, err
+		}
+		started = append(started, service.Name)
+	}
+	return networkName, started, nil
+}
+
+// ensureServiceNetwork creates the network of an environment's services
+// unless it exists
+func (c *Client) ensureServiceNetwork(networkName, envName, workspace string) error {
+	ctx := context.Background()
+
+	existing, err := c.cli.NetworkInspect(ctx, networkName, types.NetworkInspectOptions{})
+	if err == nil {
+		if existing.Labels[LabelServiceEnvironment] != envName {
+			return fmt.Errorf("network %s exists but was not created by devdrop for %s", networkName, envName)
+		}
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to inspect network %s: %w", networkName, err)
+	}
+
+	if _, err := c.cli.NetworkCreate(ctx, networkName, types.NetworkCreate{
+		CheckDuplicate: true,
+		Labels: map[string]string{
+			LabelServiceEnvironment: envName,
+			LabelUser:               HostUser(),
+			LabelWorkspace:          workspace,
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create network %s: %w", networkName, err)
+	}
+	return nil
+}
+
+// createService pulls a service's image if needed, then creates and starts
+// its container
+func (c *Client) createService(networkName, envName, workspace, name, hash string, service ServiceOptions) error {
+	ctx := context.Background()
+
+	if !c.ImageExists(service.Image) {
+		if err := c.PullImage(service.Image, ""); err != nil {
+			return fmt.Errorf("failed to pull image of service %s: %w", service.Name, err)
+		}
+	}
+
+	exposedPorts, portBindings, err := service.ports()
+	if err != nil {
+		return fmt.Errorf("service %s: %w", service.Name, err)
+	}
+
+	config := &container.Config{
+		Image:        service.Image,
+		Cmd:          service.Command,
+		Env:          service.Env,
+		ExposedPorts: exposedPorts,
+		Labels: map[string]string{
+			LabelService:            service.Name,
+			LabelServiceEnvironment: envName,
+			LabelServiceConfig:      hash,
+			LabelUser:               HostUser(),
+			LabelWorkspace:          workspace,
+		},
+	}
+	hostConfig := &container.HostConfig{
+		Binds:        service.Mounts,
+		PortBindings: portBindings,
+		NetworkMode:  container.NetworkMode(networkName),
+	}
+	networking := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{service.Name}},
+		},
+	}
+
+	resp, err := c.cli.ContainerCreate(ctx, config, hostConfig, networking, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create service %s: %w", service.Name, err)
+	}
+	if err := c.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		c.RemoveContainer(resp.ID)
+		return fmt.Errorf("failed to start service %s: %w", service.Name, err)
+	}
+	return nil
+}
+
+// serviceConfigHash identifies what a service container was created with
+func serviceConfigHash(service ServiceOptions) string {
+	parts := []string{service.Image, strings.Join(service.Command, "\x00")}
+	parts = append(parts, service.Env...)
+	parts = append(parts, service.Ports...)
+	parts = append(parts, service.Mounts...)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// ConnectNetwork connects a container to a network, so a session reaches its
+// services by name. The container keeps its default network too.
+func (c *Client) ConnectNetwork(networkName, containerID string) error {
+	if err := c.cli.NetworkConnect(context.Background(), networkName, containerID, nil); err != nil {
+		return fmt.Errorf("failed to connect container to network %s: %w", networkName, err)
+	}
+	return nil
+}
+
+// StopServices removes the service containers of an environment for a
+// workspace and their network. Other containers on the network, such as the
+// ended session, are disconnected first so they can be started again later.
+// While one of them runs, e.g. another session in the same workspace,
+// nothing is removed and ErrServicesInUse is returned. It returns the names
+// of the services it removed.
+func (c *Client) StopServices(envName, workspace string) ([]string, error) {
+	ctx := context.Background()
+	networkName := ServiceNetwork(envName, workspace)
+
+	containers, err := c.cli.ContainerList(ctx, types.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("network", networkName)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers of network %s: %w", networkName, err)
+	}
+	for _, summary := range containers {
+		if _, service := summary.Labels[LabelService]; !service && summary.State == "running" {
+			name := summary.ID
+			if len(summary.Names) > 0 {
+				name = strings.TrimPrefix(summary.Names[0], "/")
+			}
+			return nil, fmt.Errorf("%w: %s", ErrServicesInUse, name)
+		}
+	}
+
+	var removed []string
+	for _, summary := range containers {
+		if name, ok := summary.Labels[LabelService]; ok {
+			if err := c.RemoveContainer(summary.ID); err != nil {
+				return removed, err
+			}
+			removed = append(removed, name)
+			continue
+		}
+		if err := c.cli.NetworkDisconnect(ctx, networkName, summary.ID, true); err != nil {
+			return removed, fmt.Errorf("failed to disconnect container from network %s: %w", networkName, err)
+		}
+	}
+	sort.Strings(removed)
+
+	if err := c.cli.NetworkRemove(ctx, networkName); err != nil && !client.IsErrNotFound(err) {
+		return removed, fmt.Errorf("failed to remove network %s: %w", networkName, err)
+	}
+	return removed, nil
+}
@@ -0,0 +1,29 @@
+package docker
+
+import "strings"
+
+// sessionMarker starts the shell command of sessions that run setup steps
+// before their shell, so commits can restore the plain shell command
+const sessionMarker = "# devdrop session"
+
+// envFileStep exports the variables of the env file at path. They are read
+// from a file rather than set on the container so they don't end up in the
+// image when the session is committed. Sessions created without variables
+// have no file.
+func envFileStep(path string) string {
+	return `if [ -f ` + path + ` ]; then set -a; . ` + path + `; set +a; fi`
+}
+
+// sessionCommand returns the command that runs setup steps and then starts
+// the interactive shell
+func sessionCommand(steps []string) []string {
+	script := append([]string{sessionMarker}, steps...)
+	script = append(script, "exec /bin/bash")
+	return []string{"/bin/sh", "-c", strings.Join(script, "\n")}
+}
+
+// isSessionCommand reports whether a container's command was made by
+// sessionCommand
+func isSessionCommand(cmd []string) bool {
+	return len(cmd) == 3 && strings.HasPrefix(cmd[2], sessionMarker)
+}
@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// NewSSHClient connects to the Docker daemon of a remote machine over SSH,
+// e.g. "ssh://me@workstation" or "ssh://workstation:2222". It relies on the
+// local ssh binary (and therefore the user's ssh config and agent) and on
+// "docker system dial-stdio" being available on the remote host.
+func NewSSHClient(target string) (*Client, error) {
+	sshArgs, err := sshCommandArgs(target)
+	if err != nil {
+		return nil, err
+	}
+
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return newCommandConn("ssh", append(sshArgs, "docker", "system", "dial-stdio")...)
+	}
+
+	cli, err := client.NewClientWithOpts(
+		client.WithHTTPClient(&http.Client{Transport: &http.Transport{DialContext: dial}}),
+		client.WithHost("http://docker.example.com"), // never resolved; all connections go through ssh
+		client.WithDialContext(dial),
+		client.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker client for %s: %w", target, err)
+	}
+
+	if _, err := cli.Ping(context.Background()); err != nil {
+		return nil, fmt.Errorf("failed to connect to Docker on %s: %w", target, daemonUnavailable(err))
+	}
+
+	return &Client{cli: cli, progress: os.Stdout, runtime: RuntimeDocker}, nil
+}
+
+// sshCommandArgs converts an ssh:// URL into ssh command line arguments
+func sshCommandArgs(target string) ([]string, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid ssh target '%s': expected ssh://[user@]host[:port]", target)
+	}
+
+	var args []string
+	if u.User != nil && u.User.Username() != "" {
+		args = append(args, "-l", u.User.Username())
+	}
+	if u.Port() != "" {
+		args = append(args, "-p", u.Port())
+	}
+	return append(args, "--", u.Hostname()), nil
+}
+
+// commandConn is a net.Conn over the stdin and stdout of a command
+type commandConn struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+
+	closeOnce sync.Once
+}
+
+// newCommandConn starts the command for a new connection. The dial context
+// is deliberately not used: it may be cancelled once the request that
+// opened the connection completes, while the connection is reused.
+func newCommandConn(name string, args ...string) (net.Conn, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+
+	return &commandConn{cmd: cmd, stdin: stdin, stdout: stdout}, nil
+}
+
+func (c *commandConn) Read(p []byte) (int, error)  { return c.stdout.Read(p) }
+func (c *commandConn) Write(p []byte) (int, error) { return c.stdin.Write(p) }
+
+// CloseWrite signals EOF to the remote side, as required for hijacked connections
+func (c *commandConn) CloseWrite() error {
+	return c.stdin.Close()
+}
+
+func (c *commandConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.cmd.Wait()
+	})
+	return nil
+}
+
+func (c *commandConn) LocalAddr() net.Addr                { return dummyAddr{} }
+func (c *commandConn) RemoteAddr() net.Addr               { return dummyAddr{} }
+func (c *commandConn) SetDeadline(t time.Time) error      { return nil }
+func (c *commandConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *commandConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type dummyAddr struct{}
+
+func (dummyAddr) Network() string { return "ssh" }
+func (dummyAddr) String() string  { return "ssh" }
@@ -0,0 +1,191 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// ToolsDir is where tool volumes are mounted in a session; each tool gets a
+// subdirectory that is appended to PATH
+const ToolsDir = "/opt/devdrop/tools"
+
+// LabelTool marks volumes holding binaries extracted from a tool image
+const LabelTool = "devdrop.tool"
+
+// ToolMount is a directory of binaries from a tool image, extracted into a
+// volume and mounted read-only into a session
+type ToolMount struct {
+	Image  string
+	Volume string
+	// Target is the directory the volume is mounted at in the session
+	Target string
+}
+
+// systemBinDirs are PATH entries every image has; they don't say where a
+// tool image keeps its own binaries
+var systemBinDirs = map[string]bool{
+	"/usr/local/sbin": true,
+	"/usr/local/bin":  true,
+	"/usr/sbin":       true,
+	"/usr/bin":        true,
+	"/sbin":           true,
+	"/bin":            true,
+}
+
+var unsafeVolumeChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// ToolBinDir guesses the directory holding a tool image's binaries: the
+// directory of its entrypoint, else the first PATH entry that isn't a
+// system directory, else /usr/local/bin
+func (c *Client) ToolBinDir(imageName string) (string, error) {
+	info, _, err := c.cli.ImageInspectWithRaw(context.Background(), imageName)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+
+	var pathDirs []string
+	var entrypoint string
+	if info.Config != nil {
+		for _, env := range info.Config.Env {
+			if value, ok := strings.CutPrefix(env, "PATH="); ok {
+				pathDirs = strings.Split(value, ":")
+			}
+		}
+		if len(info.Config.Entrypoint) > 0 {
+			entrypoint = info.Config.Entrypoint[0]
+		}
+	}
+
+	if path.IsAbs(entrypoint) {
+		return path.Dir(entrypoint), nil
+	}
+
+	// Look the entrypoint up in PATH like the shell would
+	if entrypoint != "" && !strings.Contains(entrypoint, "/") && len(pathDirs) > 0 {
+		candidates := make(map[string]bool, len(pathDirs))
+		for _, dir := range pathDirs {
+			candidates[path.Join(dir, entrypoint)] = true
+		}
+		found := ""
+		err := c.WalkImageFiles(imageName, func(header *tar.Header, content io.Reader) error {
+			if candidates[path.Clean(header.Name)] {
+				found = path.Dir(path.Clean(header.Name))
+				return ErrStopWalk
+			}
+			return nil
+		})
+		if err != nil {
+			return "", err
+		}
+		if found != "" {
+			return found, nil
+		}
+	}
+
+	for _, dir := range pathDirs {
+		if dir != "" && !systemBinDirs[dir] {
+			return dir, nil
+		}
+	}
+	return "/usr/local/bin", nil
+}
+
+// PrepareToolMount extracts a directory of a local tool image into a volume,
+// unless a volume for that image and directory already exists. The image's
+// content is copied into the volume by mounting it over the directory in a
+// container that is created but never started.
+func (c *Client) PrepareToolMount(imageName, dir string) (ToolMount, error) {
+	ctx := context.Background()
+
+	info, _, err := c.cli.ImageInspectWithRaw(ctx, imageName)
+	if err != nil {
+		return ToolMount{}, fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+
+	// Name volumes by image ID so a new version of the tool gets a new volume
+	id := strings.TrimPrefix(info.ID, "sha256:")
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	dirHash := sha256.Sum256([]byte(dir))
+	mount := ToolMount{
+		Image:  imageName,
+		Volume: fmt.Sprintf("devdrop-tool-%s-%x", id, dirHash[:4]),
+		Target: path.Join(ToolsDir, toolMountName(imageName)),
+	}
+
+	if _, err := c.cli.VolumeInspect(ctx, mount.Volume); err == nil {
+		return mount, nil
+	} else if !client.IsErrNotFound(err) {
+		return ToolMount{}, fmt.Errorf("failed to inspect volume %s: %w", mount.Volume, err)
+	}
+
+	if _, err := c.cli.VolumeCreate(ctx, volumetypes.VolumeCreateBody{
+		Name:   mount.Volume,
+		Labels: map[string]string{LabelTool: imageName},
+	}); err != nil {
+		return ToolMount{}, fmt.Errorf("failed to create volume for %s: %w", imageName, err)
+	}
+
+	resp, err := c.cli.ContainerCreate(ctx,
+		&container.Config{Image: imageName, Entrypoint: []string{"true"}, Cmd: nil},
+		&container.HostConfig{Binds: []string{mount.Volume + ":" + dir}},
+		nil, nil, "")
+	if err != nil {
+		c.cli.VolumeRemove(ctx, mount.Volume, true)
+		return ToolMount{}, fmt.Errorf("failed to extract %s from %s: %w", dir, imageName, err)
+	}
+	c.RemoveContainer(resp.ID)
+
+	return mount, nil
+}
+
+// toolMountName turns an image reference into a directory name, e.g.
+// "bitnami/kubectl:1.29" becomes "bitnami-kubectl-1.29"
+func toolMountName(imageName string) string {
+	return strings.Trim(unsafeVolumeChars.ReplaceAllString(imageName, "-"), "-.")
+}
+
+// toolsPath appends the targets of tool mounts to an image's PATH
+func (c *Client) toolsPath(imageName string, tools []ToolMount) (string, error) {
+	info, _, err := c.cli.ImageInspectWithRaw(context.Background(), imageName)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", imageName, classify(err))
+	}
+
+	base := "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+	if info.Config != nil {
+		for _, env := range info.Config.Env {
+			if value, ok := strings.CutPrefix(env, "PATH="); ok {
+				base = value
+			}
+		}
+	}
+
+	dirs := []string{base}
+	for _, tool := range tools {
+		dirs = append(dirs, tool.Target)
+	}
+	return strings.Join(dirs, ":"), nil
+}
+
+// withoutToolsPath removes tool mount directories from a PATH value
+func withoutToolsPath(value string) string {
+	var dirs []string
+	for _, dir := range strings.Split(value, ":") {
+		if !strings.HasPrefix(dir, ToolsDir+"/") {
+			dirs = append(dirs, dir)
+		}
+	}
+	return strings.Join(dirs, ":")
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/oysteinje/devdrop/pkg/bootstrap"
+	"github.com/oysteinje/devdrop/pkg/tools"
+)
+
+// CaptureTools records the tool versions installed in an image using a
+// short-lived helper container
+func (c *Client) CaptureTools(imageName string) (tools.Lock, error) {
+	output, err := c.RunHelperContainer(imageName, tools.ShellCommand(), false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture tool versions: %w", err)
+	}
+	return tools.Parse(output), nil
+}
+
+// ListPackages returns the package manager of an image and its installed
+// OS packages, using a short-lived helper container
+func (c *Client) ListPackages(imageName string) (string, []tools.Package, error) {
+	output, err := c.RunHelperContainer(imageName, tools.PackagesCommand(), false)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	manager, packages := tools.ParsePackages(output)
+	return manager, packages, nil
+}
+
+// CaptureInventory lists the packages installed in an image for a
+// bootstrap script, using a short-lived helper container
+func (c *Client) CaptureInventory(imageName string) (bootstrap.Inventory, error) {
+	output, err := c.RunHelperContainer(imageName, bootstrap.Command(), false)
+	if err != nil {
+		return bootstrap.Inventory{}, fmt.Errorf("failed to list packages: %w", err)
+	}
+	return bootstrap.ParseInventory(output)
+}
+
+// ContainerTools records the tool versions installed in an existing
+// container. A stopped container is started for the check and stopped again.
+func (c *Client) ContainerTools(containerID string) (tools.Lock, error) {
+	ctx := context.Background()
+
+	info, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+
+	if !info.State.Running {
+		if err := c.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+			return nil, fmt.Errorf("failed to start container %s: %w", containerID, err)
+		}
+		defer c.cli.ContainerStop(ctx, containerID, nil)
+	}
+
+	output, err := c.execOutput(containerID, tools.ShellCommand())
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture tool versions: %w", err)
+	}
+	return tools.Parse(output), nil
+}
+
+// execOutput runs a command in a running container and returns its combined output
+func (c *Client) execOutput(containerID string, cmd []string) (string, error) {
+	ctx := context.Background()
+
+	exec, err := c.cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	attach, err := c.cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer attach.Close()
+
+	var output strings.Builder
+	if _, err := stdcopy.StdCopy(&output, &output, attach.Reader); err != nil {
+		return "", fmt.Errorf("failed to read exec output: %w", err)
+	}
+
+	inspect, err := c.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	if inspect.ExitCode != 0 {
+		return output.String(), fmt.Errorf("command exited with code %d: %s", inspect.ExitCode, strings.TrimSpace(output.String()))
+	}
+
+	return output.String(), nil
+}
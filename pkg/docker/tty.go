@@ -0,0 +1,181 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"golang.org/x/term"
+)
+
+// DetachKeys detach the terminal from a session and leave it running, like
+// they do for docker attach
+const DetachKeys = "ctrl-p,ctrl-q"
+
+// StartInteractiveContainer starts a session container and connects the
+// terminal to its shell until the shell exits or the terminal detaches
+func (c *Client) StartInteractiveContainer(containerID string) error {
+	return c.interactiveSession(containerID, true)
+}
+
+// AttachInteractiveContainer re-attaches the terminal to the shell of a
+// running container
+func (c *Client) AttachInteractiveContainer(containerID string) error {
+	return c.interactiveSession(containerID, false)
+}
+
+// interactiveSession connects the terminal to the shell of a container
+// through the API, so no docker CLI is needed. The terminal is put in raw
+// mode while attached, the container's TTY follows the size of the terminal
+// window and signals devdrop gets are relayed to the shell. Exit codes 0, 1
+// and 2 are how interactive shells normally end and aren't errors.
+func (c *Client) interactiveSession(containerID string, start bool) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	info, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	tty := info.Config.Tty
+
+	attach, err := c.cli.ContainerAttach(ctx, containerID, types.ContainerAttachOptions{
+		Stream:     true,
+		Stdin:      true,
+		Stdout:     true,
+		Stderr:     true,
+		DetachKeys: DetachKeys,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach to container: %w", err)
+	}
+	defer attach.Close()
+
+	// Wait before starting so a shell that exits right away isn't missed
+	statusCh, errCh := c.cli.ContainerWait(ctx, containerID, container.WaitConditionNextExit)
+
+	inFd := int(os.Stdin.Fd())
+	if tty && term.IsTerminal(inFd) {
+		state, err := term.MakeRaw(inFd)
+		if err != nil {
+			return fmt.Errorf("failed to put the terminal in raw mode: %w", err)
+		}
+		defer term.Restore(inFd, state)
+	}
+
+	if start {
+		if err := c.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+			return fmt.Errorf("failed to start container %s: %w", containerID, err)
+		}
+	}
+	if tty {
+		c.resizeTTY(ctx, containerID)
+		go func() {
+			for range terminalResizes(ctx) {
+				c.resizeTTY(ctx, containerID)
+			}
+		}()
+	}
+	hangup := c.relaySignals(ctx, containerID)
+
+	outputDone := make(chan error, 1)
+	go func() {
+		var err error
+		if tty {
+			_, err = io.Copy(os.Stdout, attach.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(os.Stdout, os.Stderr, attach.Reader)
+		}
+		outputDone <- err
+	}()
+	go func() {
+		io.Copy(attach.Conn, os.Stdin)
+		attach.CloseWrite()
+	}()
+
+	select {
+	case err := <-outputDone:
+		if err != nil {
+			return fmt.Errorf("failed to read session output: %w", err)
+		}
+	case <-hangup:
+		// The terminal was closed; leave the session running for
+		// 'devdrop attach'
+		return nil
+	}
+
+	// The output also ends when the detach keys are pressed, but then the
+	// shell keeps running and doesn't exit
+	for {
+		select {
+		case err := <-errCh:
+			return fmt.Errorf("failed waiting for container: %w", err)
+		case status := <-statusCh:
+			if status.Error != nil {
+				return fmt.Errorf("session ended with error: %s", status.Error.Message)
+			}
+			if code := status.StatusCode; code > 2 {
+				return fmt.Errorf("session shell exited with status %d", code)
+			}
+			return nil
+		case <-time.After(time.Second):
+			if state, err := c.ContainerState(containerID); err == nil && state == "running" {
+				return nil
+			}
+		}
+	}
+}
+
+// resizeTTY sets the size of a container's TTY to that of the terminal.
+// A shell that was just started may not accept it yet, so it is retried
+// briefly.
+func (c *Client) resizeTTY(ctx context.Context, containerID string) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width == 0 || height == 0 {
+		return
+	}
+	size := types.ResizeOptions{Width: uint(width), Height: uint(height)}
+	for attempt := 0; attempt < 5; attempt++ {
+		if err := c.cli.ContainerResize(ctx, containerID, size); err == nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// relaySignals passes the signals devdrop gets while attached, e.g. from
+// kill or a Ctrl-C when stdin isn't a terminal, on to the session's shell
+// instead of leaving it running without devdrop. A hangup, when the
+// terminal is closed, isn't relayed: the returned channel is closed so the
+// session is detached and can be attached to again.
+func (c *Client) relaySignals(ctx context.Context, containerID string) <-chan struct{} {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, relayedSignals...)
+	hangup := make(chan struct{})
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-signals:
+				if isHangup(sig) {
+					close(hangup)
+					return
+				}
+				if number, ok := sig.(syscall.Signal); ok {
+					c.cli.ContainerKill(ctx, containerID, strconv.Itoa(int(number)))
+				}
+			}
+		}
+	}()
+	return hangup
+}
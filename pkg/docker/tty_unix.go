@@ -0,0 +1,43 @@
+//go:build !windows
+
+package docker
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// relayedSignals are passed on to the shell of an attached session
+var relayedSignals = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+
+// isHangup reports whether a signal means the terminal went away
+func isHangup(sig os.Signal) bool {
+	return sig == syscall.SIGHUP
+}
+
+// terminalResizes delivers a value whenever the terminal window is resized,
+// until ctx is done
+func terminalResizes(ctx context.Context) <-chan struct{} {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	resizes := make(chan struct{})
+	go func() {
+		defer signal.Stop(winch)
+		defer close(resizes)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-winch:
+				select {
+				case resizes <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return resizes
+}
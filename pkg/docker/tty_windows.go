@@ -0,0 +1,51 @@
+//go:build windows
+
+package docker
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// relayedSignals are passed on to the shell of an attached session
+var relayedSignals = []os.Signal{os.Interrupt}
+
+// isHangup reports whether a signal means the terminal went away
+func isHangup(sig os.Signal) bool {
+	return false
+}
+
+// terminalResizes delivers a value whenever the terminal window is resized,
+// until ctx is done. Windows has no resize signal, so the console's size is
+// polled.
+func terminalResizes(ctx context.Context) <-chan struct{} {
+	resizes := make(chan struct{})
+	go func() {
+		defer close(resizes)
+		fd := int(os.Stdout.Fd())
+		width, height, _ := term.GetSize(fd)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			w, h, err := term.GetSize(fd)
+			if err != nil || (w == width && h == height) {
+				continue
+			}
+			width, height = w, h
+			select {
+			case resizes <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resizes
+}
@@ -0,0 +1,145 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+
+	volumetypes "github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+)
+
+// Labels of environment volumes
+const (
+	// LabelVolume holds the name a cache volume has in its environment's
+	// config, or the workspace path a workspace volume stands in for
+	LabelVolume = "devdrop.volume"
+	// LabelWorkspace marks a workspace volume and holds the host workspace
+	// it belongs to
+	LabelWorkspace = "devdrop.workspace"
+)
+
+// VolumeInfo describes a named volume devdrop created for an environment
+type VolumeInfo struct {
+	// Name is the Docker volume
+	Name string
+	// Environment and Volume are the environment and the name it was
+	// declared under
+	Environment string
+	Volume      string
+	// Workspace is set for workspace volumes: the host workspace whose
+	// directory Volume the volume replaces in sessions
+	Workspace string
+	Created   time.Time
+	// Size is the space the volume uses, or -1 when the daemon didn't say
+	Size int64
+}
+
+// EnvironmentVolume returns the Docker volume holding an environment's named
+// volume for the current user, e.g. devdrop-go-alice-gocache
+func EnvironmentVolume(envName, name string) string {
+	return fmt.Sprintf("%s-%s-%s", envName, unsafeVolumeChars.ReplaceAllString(HostUser(), "-"), name)
+}
+
+// EnsureVolume creates the Docker volume for an environment's named volume
+// unless it exists, and returns its name. Docker fills a new volume from the
+// image the first time it is mounted.
+func (c *Client) EnsureVolume(envName, name string) (string, error) {
+	return c.ensureVolume(EnvironmentVolume(envName, name), map[string]string{
+		LabelEnvironment: envName,
+		LabelUser:        HostUser(),
+		LabelVolume:      name,
+	})
+}
+
+// EnsureWorkspaceVolume creates the Docker volume that stands in for a
+// directory of a workspace, such as node_modules, in an environment's
+// sessions unless it exists, and returns its name. rel is the directory's
+// path relative to the workspace.
+func (c *Client) EnsureWorkspaceVolume(envName, workspace, rel string) (string, error) {
+	sum := sha256.Sum256([]byte(workspace + "\x00" + rel))
+	name := fmt.Sprintf("ws-%x", sum[:6])
+	return c.ensureVolume(EnvironmentVolume(envName, name), map[string]string{
+		LabelEnvironment: envName,
+		LabelUser:        HostUser(),
+		LabelVolume:      rel,
+		LabelWorkspace:   workspace,
+	})
+}
+
+// ensureVolume creates a volume with labels unless one with the same
+// labels exists
+func (c *Client) ensureVolume(volume string, labels map[string]string) (string, error) {
+	ctx := context.Background()
+
+	existing, err := c.cli.VolumeInspect(ctx, volume)
+	if err == nil {
+		for key, value := range labels {
+			if existing.Labels[key] != value {
+				return "", fmt.Errorf("volume %s exists but was not created by devdrop for %s", volume, labels[LabelEnvironment])
+			}
+		}
+		return volume, nil
+	}
+	if !client.IsErrNotFound(err) {
+		return "", fmt.Errorf("failed to inspect volume %s: %w", volume, err)
+	}
+
+	if _, err := c.cli.VolumeCreate(ctx, volumetypes.VolumeCreateBody{
+		Name:   volume,
+		Labels: labels,
+	}); err != nil {
+		return "", fmt.Errorf("failed to create volume %s: %w", volume, err)
+	}
+	return volume, nil
+}
+
+// ListVolumes returns the current user's environment volumes, sorted by
+// environment and name
+func (c *Client) ListVolumes() ([]VolumeInfo, error) {
+	usage, err := c.cli.DiskUsage(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	me := HostUser()
+	var volumes []VolumeInfo
+	for _, volume := range usage.Volumes {
+		name, ok := volume.Labels[LabelVolume]
+		if !ok || volume.Labels[LabelUser] != me {
+			continue
+		}
+		info := VolumeInfo{
+			Name:        volume.Name,
+			Environment: volume.Labels[LabelEnvironment],
+			Volume:      name,
+			Workspace:   volume.Labels[LabelWorkspace],
+			Size:        -1,
+		}
+		if created, err := time.Parse(time.RFC3339, volume.CreatedAt); err == nil {
+			info.Created = created
+		}
+		if volume.UsageData != nil {
+			info.Size = volume.UsageData.Size
+		}
+		volumes = append(volumes, info)
+	}
+
+	sort.Slice(volumes, func(i, j int) bool {
+		if volumes[i].Environment != volumes[j].Environment {
+			return volumes[i].Environment < volumes[j].Environment
+		}
+		return volumes[i].Volume < volumes[j].Volume
+	})
+	return volumes, nil
+}
+
+// RemoveVolume removes a volume. It fails while a container uses it.
+func (c *Client) RemoveVolume(name string) error {
+	if err := c.cli.VolumeRemove(context.Background(), name, false); err != nil {
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// Labels of warm containers
+const (
+	// LabelWarm marks a warm container and holds the host workspace it serves
+	LabelWarm = "devdrop.warm"
+	// LabelWarmConfig holds a hash of the image and mounts a warm container
+	// was started with, so a changed environment gets a new one
+	LabelWarmConfig = "devdrop.warm.config"
+)
+
+// warmCommand keeps a warm container alive doing nothing until it is stopped
+var warmCommand = []string{"/bin/sh", "-c", "trap 'exit 0' TERM INT; while :; do sleep 3600 & wait $!; done"}
+
+// WarmOptions configures a warm container: an always-running container of an
+// environment that serves commands for one workspace through docker exec
+type WarmOptions struct {
+	ContainerSpec
+	WorkspaceDir string
+	// WorkspacePath is where the workspace is mounted; empty means
+	// DefaultWorkspacePath
+	WorkspacePath string
+	// Environment and Version label the container so it can be found again
+	Environment string
+	Version     string
+}
+
+// WarmContainer is a running warm container
+type WarmContainer struct {
+	ID          string
+	Environment string
+	Workspace   string
+	Image       string
+	Started     time.Time
+}
+
+// EnsureWarmContainer returns the running warm container of an environment
+// for a workspace, starting one when there is none or the image or mounts
+// changed since it started. It reports whether it started a container.
+func (c *Client) EnsureWarmContainer(opts WarmOptions) (string, bool, error) {
+	ctx := context.Background()
+
+	image, _, err := c.cli.ImageInspectWithRaw(ctx, opts.Image)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to inspect image %s: %w", opts.Image, classify(err))
+	}
+	hash := warmConfigHash(image.ID, opts)
+
+	existing, err := c.FindWarmContainer(opts.Environment, opts.WorkspaceDir)
+	if err != nil {
+		return "", false, err
+	}
+	if existing != nil {
+		info, err := c.cli.ContainerInspect(ctx, existing.ID)
+		if err == nil && info.Config.Labels[LabelWarmConfig] == hash {
+			return existing.ID, false, nil
+		}
+		c.RemoveContainer(existing.ID)
+	}
+
+	labels := containerLabels(opts.Environment, opts.Version)
+	labels[LabelWarm] = opts.WorkspaceDir
+	labels[LabelWarmConfig] = hash
+
+	exposedPorts, portBindings, err := opts.ports()
+	if err != nil {
+		return "", false, err
+	}
+	init := true
+	hostConfig := &container.HostConfig{
+		Binds:        append([]string{fmt.Sprintf("%s:%s", opts.WorkspaceDir, workspacePath(opts.WorkspacePath))}, opts.Mounts...),
+		PortBindings: portBindings,
+		AutoRemove:   true,
+		Init:         &init,
+	}
+
+	resp, err := c.cli.ContainerCreate(ctx, &container.Config{
+		Image:        opts.Image,
+		Entrypoint:   warmCommand,
+		Cmd:          nil,
+		WorkingDir:   workspacePath(opts.WorkspacePath),
+		ExposedPorts: exposedPorts,
+		Labels:       labels,
+	}, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create warm container: %w", err)
+	}
+	if err := c.cli.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		c.RemoveContainer(resp.ID)
+		return "", false, fmt.Errorf("failed to start warm container: %w", err)
+	}
+	return resp.ID, true, nil
+}
+
+// warmConfigHash identifies what a warm container was started with
+func warmConfigHash(imageID string, opts WarmOptions) string {
+	parts := append([]string{imageID, opts.WorkspaceDir, workspacePath(opts.WorkspacePath)}, opts.Mounts...)
+	parts = append(parts, opts.Ports...)
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\n")))
+	return fmt.Sprintf("%x", sum[:8])
+}
+
+// FindWarmContainer returns the running warm container of an environment for
+// a workspace, or nil
+func (c *Client) FindWarmContainer(envName, workspace string) (*WarmContainer, error) {
+	containers, err := c.ListWarmContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, warm := range containers {
+		if warm.Environment == envName && warm.Workspace == workspace {
+			return &warm, nil
+		}
+	}
+	return nil, nil
+}
+
+// ListWarmContainers returns the current user's running warm containers,
+// sorted by environment and workspace
+func (c *Client) ListWarmContainers() ([]WarmContainer, error) {
+	containers, err := c.cli.ContainerList(context.Background(), types.ContainerListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelWarm)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list warm containers: %w", err)
+	}
+
+	me := HostUser()
+	var warm []WarmContainer
+	for _, summary := range containers {
+		if summary.Labels[LabelUser] != me {
+			continue
+		}
+		warm = append(warm, WarmContainer{
+			ID:          summary.ID,
+			Environment: summary.Labels[LabelEnvironment],
+			Workspace:   summary.Labels[LabelWarm],
+			Image:       summary.Image,
+			Started:     time.Unix(summary.Created, 0),
+		})
+	}
+	sort.Slice(warm, func(i, j int) bool {
+		if warm[i].Environment != warm[j].Environment {
+			return warm[i].Environment < warm[j].Environment
+		}
+		return warm[i].Workspace < warm[j].Workspace
+	})
+	return warm, nil
+}
+
+// ExecInContainer runs a command in a running container with docker exec,
+// in opts.WorkspacePath, streams its output and returns its exit code. Image, mounts
+// and name in opts are ignored; the container already has them.
+func (c *Client) ExecInContainer(containerID string, opts ExecOptions) (int, error) {
+	ctx := context.Background()
+
+	exec, err := c.cli.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		AttachStdin:  opts.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          opts.Env,
+		WorkingDir:   workspacePath(opts.WorkspacePath),
+		Cmd:          opts.Cmd,
+	})
+	if err != nil {
+		return -1, fmt.Errorf("failed to create exec: %w", err)
+	}
+
+	attach, err := c.cli.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return -1, fmt.Errorf("failed to attach to exec: %w", err)
+	}
+	defer attach.Close()
+
+	if opts.Stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, opts.Stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	if _, err := stdcopy.StdCopy(opts.Stdout, opts.Stderr, attach.Reader); err != nil {
+		return -1, fmt.Errorf("failed to read command output: %w", err)
+	}
+
+	inspect, err := c.cli.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to inspect exec: %w", err)
+	}
+	return inspect.ExitCode, nil
+}
+
+// ExecInSession runs a command in a session container like
+// ExecInContainer. A stopped container is started for the command and
+// stopped again.
+func (c *Client) ExecInSession(containerID string, opts ExecOptions) (int, error) {
+	ctx := context.Background()
+
+	info, err := c.cli.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return -1, fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+
+	if opts.WorkspacePath == "" {
+		opts.WorkspacePath = info.Config.WorkingDir
+	}
+	if !info.State.Running {
+		if err := c.cli.ContainerStart(ctx, containerID, types.ContainerStartOptions{}); err != nil {
+			return -1, fmt.Errorf("failed to start container %s: %w", containerID, err)
+		}
+		defer c.cli.ContainerStop(ctx, containerID, nil)
+	}
+
+	return c.ExecInContainer(containerID, opts)
+}
@@ -0,0 +1,491 @@
+package docker
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/mount"
+)
+
+// How the workspace gets into a session
+const (
+	// MountBind bind mounts the workspace; changes go both ways at once
+	MountBind = "bind"
+	// MountCopy copies the workspace into the session; changes stay there
+	MountCopy = "copy"
+	// MountSync copies the workspace in and copies changed files back to
+	// the host when the session ends
+	MountSync = "sync"
+)
+
+// ValidateMountMode checks a mount mode; empty means bind
+func ValidateMountMode(mode string) error {
+	switch mode {
+	case "", MountBind, MountCopy, MountSync:
+		return nil
+	}
+	return fmt.Errorf("invalid mount mode '%s': use bind, copy or sync", mode)
+}
+
+// DefaultWorkspacePath is where containers find the workspace unless an
+// environment sets workspace_path
+const DefaultWorkspacePath = "/workspace"
+
+// ValidateWorkspacePath checks where the workspace goes in a container: an
+// absolute, clean path other than /. Empty means DefaultWorkspacePath.
+func ValidateWorkspacePath(p string) error {
+	if p == "" {
+		return nil
+	}
+	if !path.IsAbs(p) || path.Clean(p) != p || p == "/" {
+		return fmt.Errorf("invalid workspace path '%s': use an absolute path such as /home/dev/src", p)
+	}
+	if strings.ContainsAny(p, ":,") {
+		return fmt.Errorf("invalid workspace path '%s': it can't contain ':' or ','", p)
+	}
+	return nil
+}
+
+// workspacePath returns the workspace path in the container for a
+// configured one
+func workspacePath(p string) string {
+	if p == "" {
+		return DefaultWorkspacePath
+	}
+	return p
+}
+
+// ContainerWorkspace returns where a session or exec container has the
+// workspace: its working directory
+func (c *Client) ContainerWorkspace(containerID string) (string, error) {
+	info, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	return workspacePath(info.Config.WorkingDir), nil
+}
+
+// ContainerWorkspaceDir returns the host directory bind mounted as the
+// workspace of a session container, or "" when it has none, e.g. because
+// it was started to set up an environment or works on a copy
+func (c *Client) ContainerWorkspaceDir(containerID string) (string, error) {
+	info, err := c.cli.ContainerInspect(context.Background(), containerID)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+	target := workspacePath(info.Config.WorkingDir)
+	for _, m := range info.Mounts {
+		if m.Type == mount.TypeBind && m.Destination == target {
+			return m.Source, nil
+		}
+	}
+	return "", nil
+}
+
+// SkipFunc reports whether a workspace path, relative and with forward
+// slashes, stays out of a copy. Skipped directories aren't descended into.
+type SkipFunc func(rel string, isDir bool) bool
+
+// SyncResult lists what copying a workspace back to the host did
+type SyncResult struct {
+	// Updated are the files and links created or changed on the host
+	Updated []string
+	// Deleted were removed in the session; they are kept on the host
+	Deleted []string
+	// Conflicts changed both in the session and on the host since the
+	// workspace was copied in; the host's version is kept
+	Conflicts []string
+	// Refused lead out of the workspace through a link and were not
+	// copied back
+	Refused []string
+}
+
+// WorkspaceBaseline records what the workspace held when it was copied into
+// a session, keyed by relative path, so copying back can tell what changed
+// in the session from what changed on the host meanwhile
+type WorkspaceBaseline map[string]string
+
+// Fingerprints of workspace entries: a directory, a link and its target or
+// a file and the SHA-256 of its content
+const (
+	fingerprintDir  = "dir"
+	fingerprintLink = "link:"
+	fingerprintFile = "file:"
+)
+
+// CopyToWorkspace copies a host directory into the workspace of a created
+// container, leaving out what skip matches, and returns what it copied for
+// CopyFromWorkspace
+func (c *Client) CopyToWorkspace(containerID, dir string, skip SkipFunc) (WorkspaceBaseline, error) {
+	target, err := c.ContainerWorkspace(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := make(WorkspaceBaseline)
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(writeWorkspaceTar(pw, dir, skip, baseline))
+	}()
+
+	err = c.cli.CopyToContainer(context.Background(), containerID, target, pr, types.CopyToContainerOptions{})
+	pr.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy workspace into container: %w", err)
+	}
+	return baseline, nil
+}
+
+// writeWorkspaceTar writes the contents of dir as a tar stream and records
+// each entry in baseline
+func writeWorkspaceTar(w io.Writer, dir string, skip SkipFunc, baseline WorkspaceBaseline) error {
+	tw := tar.NewWriter(w)
+	err := writeTarTree(tw, dir, "", skip, func(rel, fingerprint string) {
+		baseline[rel] = fingerprint
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive workspace: %w", err)
+	}
+	return tw.Close()
+}
+
+// writeTarTree adds the contents of dir to a tar stream, with names under
+// prefix (empty or ending in a slash). record, if set, is given the
+// fingerprint of every directory, link and file written.
+func writeTarTree(tw *tar.Writer, dir, prefix string, skip SkipFunc, record func(rel, fingerprint string)) error {
+	return filepath.Walk(dir, func(full string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, full)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if skip != nil && skip(rel, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(full); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = prefix + rel
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			if record != nil {
+				if info.IsDir() {
+					record(rel, fingerprintDir)
+				} else if link != "" {
+					record(rel, fingerprintLink+link)
+				}
+			}
+			return nil
+		}
+
+		f, err := os.Open(full)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+			return err
+		}
+		if record != nil {
+			record(rel, fmt.Sprintf("%s%x", fingerprintFile, h.Sum(nil)))
+		}
+		return nil
+	})
+}
+
+// CopyFromWorkspace copies what changed in the workspace of a container
+// since it was copied in back to a host directory. Paths the session left
+// alone aren't touched, even if they changed on the host meanwhile, and
+// paths that changed on both sides are reported as conflicts instead of
+// overwritten. Files deleted in the container are only reported, and host
+// directories are never removed. Paths skip matches are left out both ways.
+func (c *Client) CopyFromWorkspace(containerID, dir string, skip SkipFunc, baseline WorkspaceBaseline) (SyncResult, error) {
+	var result SyncResult
+
+	source, err := c.ContainerWorkspace(containerID)
+	if err != nil {
+		return result, err
+	}
+	reader, _, err := c.cli.CopyFromContainer(context.Background(), containerID, source)
+	if err != nil {
+		return result, fmt.Errorf("failed to copy workspace from container: %w", err)
+	}
+	defer reader.Close()
+
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return result, fmt.Errorf("failed to resolve workspace: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	// Entries under a link come from the session and are never followed
+	var skipped, links []string
+	tr := tar.NewReader(reader)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read workspace archive: %w", err)
+		}
+
+		// Entries are named <last element of the workspace path>/<path>
+		_, rel, _ := strings.Cut(path.Clean(hdr.Name), "/")
+		if rel == "" || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		if underAny(rel, skipped) || underAny(rel, links) {
+			continue
+		}
+		isDir := hdr.Typeflag == tar.TypeDir
+		if skip != nil && skip(rel, isDir) {
+			if isDir {
+				skipped = append(skipped, rel)
+			}
+			continue
+		}
+		seen[rel] = true
+		if hdr.Typeflag == tar.TypeSymlink {
+			links = append(links, rel)
+		}
+
+		full := filepath.Join(dir, filepath.FromSlash(rel))
+		if !insideDir(realDir, filepath.Dir(full)) {
+			result.Refused = append(result.Refused, rel)
+			if isDir {
+				skipped = append(skipped, rel)
+			}
+			continue
+		}
+		outcome, err := syncEntry(full, hdr, tr, baseline[rel])
+		if err != nil {
+			return result, fmt.Errorf("failed to copy back %s: %w", rel, err)
+		}
+		switch outcome {
+		case syncUpdated:
+			result.Updated = append(result.Updated, rel)
+		case syncConflict:
+			result.Conflicts = append(result.Conflicts, rel)
+			if isDir {
+				// Its contents can't be written where the host has a file
+				skipped = append(skipped, rel)
+			}
+		}
+	}
+
+	rels := make([]string, 0, len(baseline))
+	for rel := range baseline {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+	var deletedDirs []string
+	for _, rel := range rels {
+		if seen[rel] || underAny(rel, skipped) || underAny(rel, deletedDirs) {
+			continue
+		}
+		result.Deleted = append(result.Deleted, rel)
+		if baseline[rel] == fingerprintDir {
+			deletedDirs = append(deletedDirs, rel)
+		}
+	}
+	return result, nil
+}
+
+// insideDir reports whether parent, with the links on its way resolved, is
+// realDir or lies inside it. Parts of parent that don't exist yet are
+// created as plain directories, so the deepest existing one decides. A
+// dangling link counts as outside.
+func insideDir(realDir, parent string) bool {
+	existing := parent
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return false
+		}
+		up := filepath.Dir(existing)
+		if up == existing {
+			return false
+		}
+		existing = up
+	}
+	resolved, err := filepath.EvalSymlinks(existing)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(realDir, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// underAny reports whether rel lies inside one of the directories
+func underAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// What syncEntry did with an archive entry
+const (
+	syncUnchanged = iota
+	syncUpdated
+	syncConflict
+)
+
+// syncEntry writes one archive entry to the host if it changed in the
+// session since base, its fingerprint when copied in, and the host still
+// has what was copied in. Regular files are streamed to a temporary file
+// next to their destination and moved into place.
+func syncEntry(full string, hdr *tar.Header, content io.Reader, base string) (int, error) {
+	var fingerprint, staged string
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		fingerprint = fingerprintDir
+	case tar.TypeSymlink:
+		fingerprint = fingerprintLink + hdr.Linkname
+	case tar.TypeReg:
+		var err error
+		if staged, fingerprint, err = stageFile(full, content); err != nil {
+			return syncUnchanged, err
+		}
+		defer os.Remove(staged)
+	default:
+		// Devices, fifos and hard links aren't copied back
+		return syncUnchanged, nil
+	}
+	// Directories are checked on the host even when the session left them
+	// alone, as their contents can't be copied back if they're gone
+	if fingerprint == base && fingerprint != fingerprintDir {
+		return syncUnchanged, nil
+	}
+	current, err := hostFingerprint(full)
+	if err != nil {
+		return syncUnchanged, err
+	}
+	switch {
+	case current == fingerprint:
+		return syncUnchanged, nil
+	case current != base, current == fingerprintDir:
+		// Changed on the host too, a directory the session replaced or
+		// one the host no longer has
+		return syncConflict, nil
+	}
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		if err = removeFile(full); err == nil {
+			err = os.MkdirAll(full, os.FileMode(hdr.Mode).Perm()|0700)
+		}
+	case tar.TypeSymlink:
+		if err = removeFile(full); err == nil {
+			err = os.Symlink(hdr.Linkname, full)
+		}
+	case tar.TypeReg:
+		if err = os.Chmod(staged, os.FileMode(hdr.Mode).Perm()); err == nil {
+			err = os.Rename(staged, full)
+		}
+	}
+	if err != nil {
+		return syncUnchanged, err
+	}
+	return syncUpdated, nil
+}
+
+// stageFile streams the content of a file being copied back into a
+// temporary file in its destination directory and returns its name and
+// fingerprint
+func stageFile(full string, content io.Reader) (string, string, error) {
+	parent := filepath.Dir(full)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", "", err
+	}
+	f, err := os.CreateTemp(parent, ".devdrop-sync-*")
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, h), content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	return f.Name(), fmt.Sprintf("%s%x", fingerprintFile, h.Sum(nil)), nil
+}
+
+// hostFingerprint returns the fingerprint of what the host has at a path,
+// "" when there is nothing and "other" for anything but a directory, link
+// or regular file
+func hostFingerprint(full string) (string, error) {
+	info, err := os.Lstat(full)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case info.IsDir():
+		return fingerprintDir, nil
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(full)
+		if err != nil {
+			return "", err
+		}
+		return fingerprintLink + target, nil
+	case info.Mode().IsRegular():
+		f, err := os.Open(full)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s%x", fingerprintFile, h.Sum(nil)), nil
+	}
+	return "other", nil
+}
+
+// removeFile removes a file or link, if there is one
+func removeFile(full string) error {
+	if err := os.Remove(full); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+// Package dotfiles fetches a user's dotfiles for injection into sessions.
+//
+// Dotfiles come from a Git repository or a local directory. Repositories are
+// cloned once into a cache and updated on every use, so sessions always get
+// the latest dotfiles and still work offline:
+//
+//	~/.cache/devdrop/dotfiles/<hash of url>/   clone of the repository
+//
+// A revision identifies the content, so a session only reinstalls the
+// dotfiles when they changed since the container last installed them.
+package dotfiles
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// installScripts are the install scripts looked for when none is
+// configured, in order
+var installScripts = []string{
+	"install.sh", "install",
+	"bootstrap.sh", "bootstrap",
+	"script/bootstrap",
+	"setup.sh", "setup",
+	"script/setup",
+}
+
+// Source is a resolved set of dotfiles on the host
+type Source struct {
+	// Dir is the directory holding the dotfiles
+	Dir string
+	// Revision is the commit of a repository or a content hash of a directory
+	Revision string
+	// Warning is set when a repository couldn't be updated and a cached
+	// clone is used instead
+	Warning string
+}
+
+// IsLocal reports whether source names a local directory rather than a
+// Git repository
+func IsLocal(source string) bool {
+	info, err := os.Stat(source)
+	return err == nil && info.IsDir()
+}
+
+// Resolve makes the dotfiles available on the host. Local directories are
+// used in place; repositories are cloned into or updated in cacheDir. An
+// empty ref uses the repository's default branch.
+func Resolve(source, ref, cacheDir string) (Source, error) {
+	if IsLocal(source) {
+		dir, err := filepath.Abs(source)
+		if err != nil {
+			return Source{}, fmt.Errorf("failed to resolve dotfiles directory: %w", err)
+		}
+		revision, err := hashDir(dir)
+		if err != nil {
+			return Source{}, err
+		}
+		return Source{Dir: dir, Revision: revision}, nil
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	dir := filepath.Join(cacheDir, hex.EncodeToString(sum[:])[:12])
+	result := Source{Dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return Source{}, fmt.Errorf("failed to create dotfiles cache: %w", err)
+		}
+		args := []string{"clone", "--depth", "1"}
+		if ref != "" {
+			args = append(args, "--branch", ref)
+		}
+		if err := git("", append(args, source, dir)...); err != nil {
+			os.RemoveAll(dir)
+			return Source{}, fmt.Errorf("failed to clone dotfiles from %s: %w", source, err)
+		}
+	} else {
+		target := "HEAD"
+		if ref != "" {
+			target = ref
+		}
+		err := git(dir, "fetch", "--depth", "1", "origin", target)
+		if err == nil {
+			err = git(dir, "reset", "--hard", "--quiet", "FETCH_HEAD")
+		}
+		if err != nil {
+			result.Warning = fmt.Sprintf("failed to update dotfiles from %s, using the cached copy: %v", source, err)
+		}
+	}
+
+	revision, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return Source{}, fmt.Errorf("failed to read dotfiles revision: %w", err)
+	}
+	result.Revision = strings.TrimSpace(string(revision))
+	return result, nil
+}
+
+// FindInstallScript returns the first well-known install script in dir, or
+// "" when there is none
+func FindInstallScript(dir string) string {
+	for _, script := range installScripts {
+		if info, err := os.Stat(filepath.Join(dir, script)); err == nil && !info.IsDir() {
+			return script
+		}
+	}
+	return ""
+}
+
+// git runs a git command, in dir unless it is empty
+func git(dir string, args ...string) error {
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	// Never hang on a credential prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// hashDir hashes the paths and contents of the files in a directory,
+// skipping .git
+func hashDir(dir string) (string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read dotfiles directory: %w", err)
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, path := range files {
+		rel, _ := filepath.Rel(dir, path)
+		fmt.Fprintf(hash, "%s\x00", filepath.ToSlash(rel))
+		file, err := os.Open(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read dotfiles directory: %w", err)
+		}
+		_, err = io.Copy(hash, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read dotfiles directory: %w", err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
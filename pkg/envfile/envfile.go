@@ -0,0 +1,146 @@
+// Package envfile reads environment variables in the format of Docker's
+// --env-file: KEY=VALUE lines, # comments, and bare KEY lines that take the
+// value from the host. Project .env files are read in the more lenient
+// dotenv format.
+package envfile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Vars maps variable names to values
+type Vars map[string]string
+
+// Set adds KEY=VALUE, or KEY with the host's value. A bare KEY that isn't
+// set on the host is ignored, as Docker does.
+func (v Vars) Set(assignment string) error {
+	key, value, hasValue := strings.Cut(assignment, "=")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return fmt.Errorf("invalid variable '%s': expected KEY=VALUE", assignment)
+	}
+	if strings.ContainsAny(key, " \t") {
+		return fmt.Errorf("invalid variable name '%s': contains whitespace", key)
+	}
+
+	if !hasValue {
+		hostValue, ok := os.LookupEnv(key)
+		if !ok {
+			return nil
+		}
+		value = hostValue
+	}
+	v[key] = value
+	return nil
+}
+
+// Merge copies the variables of other into v, replacing existing ones
+func (v Vars) Merge(other map[string]string) {
+	for key, value := range other {
+		v[key] = value
+	}
+}
+
+// Keys returns the variable names, sorted
+func (v Vars) Keys() []string {
+	keys := make([]string, 0, len(v))
+	for key := range v {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// List returns the variables as sorted KEY=VALUE strings
+func (v Vars) List() []string {
+	list := make([]string, 0, len(v))
+	for _, key := range v.Keys() {
+		list = append(list, key+"="+v[key])
+	}
+	return list
+}
+
+// Parse reads variables from r. Values are taken literally, including any
+// quotes, as with Docker's --env-file.
+func Parse(r io.Reader) (Vars, error) {
+	return parse(r, false)
+}
+
+// ParseDotenv reads variables from r in dotenv format: like Parse, but lines
+// may start with "export", values may be quoted and unquoted values end at
+// a " #" comment.
+func ParseDotenv(r io.Reader) (Vars, error) {
+	return parse(r, true)
+}
+
+func parse(r io.Reader, dotenv bool) (Vars, error) {
+	vars := make(Vars)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if dotenv {
+			line = dotenvLine(line)
+		}
+		if err := vars.Set(line); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// dotenvLine turns a dotenv line into a plain KEY=VALUE assignment
+func dotenvLine(line string) string {
+	if rest, ok := strings.CutPrefix(line, "export "); ok {
+		line = strings.TrimLeft(rest, " \t")
+	}
+	key, value, hasValue := strings.Cut(line, "=")
+	if !hasValue {
+		return strings.TrimSpace(line)
+	}
+
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end >= 0 {
+			return key + "=" + value[1:end+1]
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return key + "=" + value
+}
+
+// ParseFile reads variables from a file
+func ParseFile(path string) (Vars, error) {
+	return parseFile(path, Parse)
+}
+
+// ParseDotenvFile reads variables from a file in dotenv format
+func ParseDotenvFile(path string) (Vars, error) {
+	return parseFile(path, ParseDotenv)
+}
+
+func parseFile(path string, parse func(io.Reader) (Vars, error)) (Vars, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open env file: %w", err)
+	}
+	defer f.Close()
+
+	vars, err := parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file %s: %w", path, err)
+	}
+	return vars, nil
+}
@@ -0,0 +1,150 @@
+package envfile
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	t.Setenv("ENVFILE_TEST_HOST", "from-host")
+
+	tests := []struct {
+		name    string
+		input   string
+		want    Vars
+		wantErr bool
+	}{
+		{
+			name:  "assignments",
+			input: "A=1\nB=two words\n",
+			want:  Vars{"A": "1", "B": "two words"},
+		},
+		{
+			name:  "comments and blank lines",
+			input: "# comment\n\n  # indented comment\nA=1\n",
+			want:  Vars{"A": "1"},
+		},
+		{
+			name:  "quotes are kept",
+			input: `A="quoted"` + "\n" + `B='single'`,
+			want:  Vars{"A": `"quoted"`, "B": `'single'`},
+		},
+		{
+			name:  "value with equals sign",
+			input: "URL=postgres://u:p@host/db?a=b",
+			want:  Vars{"URL": "postgres://u:p@host/db?a=b"},
+		},
+		{
+			name:  "empty value",
+			input: "A=",
+			want:  Vars{"A": ""},
+		},
+		{
+			name:  "bare key takes the host value",
+			input: "ENVFILE_TEST_HOST\nENVFILE_TEST_UNSET\n",
+			want:  Vars{"ENVFILE_TEST_HOST": "from-host"},
+		},
+		{
+			name:  "later assignments win",
+			input: "A=1\nA=2\n",
+			want:  Vars{"A": "2"},
+		},
+		{
+			name:    "export is not special",
+			input:   "export A=1",
+			wantErr: true,
+		},
+		{
+			name:    "missing key",
+			input:   "=1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Vars
+		wantErr bool
+	}{
+		{
+			name:  "export prefix",
+			input: "export A=1\nexport   B=2\n",
+			want:  Vars{"A": "1", "B": "2"},
+		},
+		{
+			name:  "double quotes are removed",
+			input: `A="two words"`,
+			want:  Vars{"A": "two words"},
+		},
+		{
+			name:  "single quotes are removed",
+			input: `A='single quoted'`,
+			want:  Vars{"A": "single quoted"},
+		},
+		{
+			name:  "quoted value keeps a hash",
+			input: `A="x # y" # comment`,
+			want:  Vars{"A": "x # y"},
+		},
+		{
+			name:  "unquoted value ends at a comment",
+			input: "A=1 # comment",
+			want:  Vars{"A": "1"},
+		},
+		{
+			name:  "hash without a space is part of the value",
+			input: "COLOR=#fff",
+			want:  Vars{"COLOR": "#fff"},
+		},
+		{
+			name:  "spaces around the value",
+			input: "A=  1  ",
+			want:  Vars{"A": "1"},
+		},
+		{
+			name:  "unterminated quote is taken literally",
+			input: `A="open`,
+			want:  Vars{"A": `"open`},
+		},
+		{
+			name:    "key with whitespace",
+			input:   "A B=1",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDotenv(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDotenv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseDotenv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrorLine(t *testing.T) {
+	_, err := Parse(strings.NewReader("A=1\n\n=2\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "line 3:") {
+		t.Errorf("Parse() error = %v, want it to name line 3", err)
+	}
+}
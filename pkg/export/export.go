@@ -0,0 +1,156 @@
+// Package export reads and writes environment export archives, which move
+// environments between machines without a registry, e.g. into air-gapped
+// networks.
+//
+// An archive is a tar, gzipped when its name ends in .gz or .tgz, holding:
+//
+//	devdrop-export.yaml   the environment's config and the exported tags
+//	images.tar            the tagged images (docker save format)
+//
+// The metadata comes first so an import can be checked before the images
+// are streamed into Docker.
+package export
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatVersion is the version of the archive layout
+const FormatVersion = 1
+
+// Names of the files in an archive
+const (
+	MetadataName = "devdrop-export.yaml"
+	ImagesName   = "images.tar"
+)
+
+// Metadata describes an exported environment
+type Metadata struct {
+	FormatVersion  int       `yaml:"format_version"`
+	Environment    string    `yaml:"environment"`
+	Exported       time.Time `yaml:"exported"`
+	DevDropVersion string    `yaml:"devdrop_version"`
+	// Images maps each exported tag (latest, v3, ...) to the image
+	// reference it has in images.tar
+	Images map[string]string `yaml:"images"`
+	// Config is the environment's config, without machine-specific state
+	Config config.Environment `yaml:"config"`
+}
+
+// Compressed reports whether an archive path asks for gzip compression
+func Compressed(path string) bool {
+	return strings.HasSuffix(path, ".gz") || strings.HasSuffix(path, ".tgz")
+}
+
+// Write writes an archive of the metadata and the images file
+func Write(w io.Writer, metadata Metadata, imagesFile string, compress bool) error {
+	metadata.FormatVersion = FormatVersion
+	data, err := yaml.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to marshal export metadata: %w", err)
+	}
+
+	images, err := os.Open(imagesFile)
+	if err != nil {
+		return fmt.Errorf("failed to open saved images: %w", err)
+	}
+	defer images.Close()
+	info, err := images.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to open saved images: %w", err)
+	}
+
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(w)
+		w = gz
+	}
+	tw := tar.NewWriter(w)
+
+	if err := writeEntry(tw, MetadataName, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if err := writeEntry(tw, ImagesName, info.Size(), images); err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	return nil
+}
+
+func writeEntry(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Read reads an archive, gzipped or not. check is called with the metadata
+// before load is given the images stream; an error from check stops the
+// import before anything is loaded.
+func Read(r io.Reader, check func(Metadata) error, load func(io.Reader) error) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return fmt.Errorf("not an export archive: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != MetadataName {
+		return fmt.Errorf("not an export archive: %s must come first", MetadataName)
+	}
+	data, err := io.ReadAll(tr)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", MetadataName, err)
+	}
+	var metadata Metadata
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", MetadataName, err)
+	}
+	if metadata.FormatVersion > FormatVersion {
+		return fmt.Errorf("the archive has format version %d; upgrade devdrop to import it", metadata.FormatVersion)
+	}
+	if err := check(metadata); err != nil {
+		return err
+	}
+
+	hdr, err = tr.Next()
+	if err != nil || hdr.Name != ImagesName {
+		return fmt.Errorf("invalid export archive: %s is missing", ImagesName)
+	}
+	return load(tr)
+}
@@ -0,0 +1,363 @@
+// Package freeze writes and verifies signed, self-contained archives of an
+// environment version.
+//
+// An archive is a gzipped tar holding the image itself (docker save format)
+// and the documents needed to understand and rebuild it years later, followed
+// by a manifest and its signature:
+//
+//	image.tar          the image, loadable with docker load
+//	sbom.spdx.json     installed OS packages and tools (SPDX 2.3)
+//	provenance.json    where the image came from and how it was made
+//	Dockerfile         best-effort reconstruction from the image history
+//	CHANGELOG          versions of the environment up to this one
+//	run.json           defaults 'devdrop run' uses for the environment
+//	manifest.json      sha256 and size of every file above
+//	manifest.sig       ed25519 signature of manifest.json
+//
+// The manifest is written last so the image can be streamed into the
+// archive; verification streams the archive once, hashing as it goes.
+package freeze
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FormatVersion is the archive format written by this package
+const FormatVersion = 1
+
+const (
+	manifestName  = "manifest.json"
+	signatureName = "manifest.sig"
+	// ImageName is the file holding the image in an archive
+	ImageName = "image.tar"
+)
+
+// ErrUntrustedSigner is returned by Verify when an archive is validly signed,
+// but not by the expected key
+var ErrUntrustedSigner = errors.New("archive is signed by an untrusted key")
+
+// Manifest describes the contents of an archive
+type Manifest struct {
+	Format      int       `json:"format"`
+	Environment string    `json:"environment"`
+	Version     string    `json:"version"`
+	Image       string    `json:"image"`
+	ImageID     string    `json:"image_id"`
+	RepoDigests []string  `json:"repo_digests,omitempty"`
+	Created     time.Time `json:"created"`
+	// Signer is the base64 ed25519 public key the manifest is signed with
+	Signer string          `json:"signer"`
+	Files  map[string]File `json:"files"`
+}
+
+// File is the digest of a file in an archive
+type File struct {
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
+
+// Writer writes an archive
+type Writer struct {
+	manifest Manifest
+	gz       *gzip.Writer
+	tar      *tar.Writer
+}
+
+// NewWriter starts an archive for the given manifest; its Files are filled
+// in as files are added
+func NewWriter(w io.Writer, manifest Manifest) *Writer {
+	manifest.Format = FormatVersion
+	manifest.Files = make(map[string]File)
+	gz := gzip.NewWriter(w)
+	return &Writer{manifest: manifest, gz: gz, tar: tar.NewWriter(gz)}
+}
+
+// AddBytes adds a file with the given content
+func (w *Writer) AddBytes(name string, data []byte) error {
+	return w.add(name, int64(len(data)), bytes.NewReader(data))
+}
+
+// AddFile adds a copy of a file on disk
+func (w *Writer) AddFile(name, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	return w.add(name, info.Size(), file)
+}
+
+func (w *Writer) add(name string, size int64, r io.Reader) error {
+	if err := w.writeHeader(name, size); err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(w.tar, hash), r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	w.manifest.Files[name] = File{SHA256: hex.EncodeToString(hash.Sum(nil)), Size: size}
+	return nil
+}
+
+func (w *Writer) writeHeader(name string, size int64) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: w.manifest.Created,
+	}
+	if err := w.tar.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Close signs the manifest with key, writes it and finishes the archive. It
+// returns the manifest as written.
+func (w *Writer) Close(key ed25519.PrivateKey) (Manifest, error) {
+	w.manifest.Signer = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	signature := []byte(base64.StdEncoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+
+	for _, file := range []struct {
+		name string
+		data []byte
+	}{{manifestName, data}, {signatureName, signature}} {
+		if err := w.writeHeader(file.name, int64(len(file.data))); err != nil {
+			return Manifest{}, err
+		}
+		if _, err := w.tar.Write(file.data); err != nil {
+			return Manifest{}, fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+
+	if err := w.tar.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	if err := w.gz.Close(); err != nil {
+		return Manifest{}, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return w.manifest, nil
+}
+
+// Verify checks that every file in an archive matches the manifest and that
+// the manifest is signed by its signer. When trusted is set, the signer must
+// be that key. Problems with individual files are returned as one error
+// listing them all.
+func Verify(r io.Reader, trusted ed25519.PublicKey) (Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("not a freeze archive: %w", err)
+	}
+	defer gz.Close()
+
+	found := make(map[string]File)
+	var manifestData, signatureData []byte
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		switch header.Name {
+		case manifestName:
+			manifestData, err = io.ReadAll(archive)
+		case signatureName:
+			signatureData, err = io.ReadAll(archive)
+		default:
+			hash := sha256.New()
+			var size int64
+			size, err = io.Copy(hash, archive)
+			found[header.Name] = File{SHA256: hex.EncodeToString(hash.Sum(nil)), Size: size}
+		}
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read %s: %w", header.Name, err)
+		}
+	}
+
+	if manifestData == nil || signatureData == nil {
+		return Manifest{}, fmt.Errorf("archive has no signed manifest")
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.Format > FormatVersion {
+		return manifest, fmt.Errorf("archive format %d is newer than this devdrop supports (%d)", manifest.Format, FormatVersion)
+	}
+
+	signer, err := base64.StdEncoding.DecodeString(manifest.Signer)
+	if err != nil || len(signer) != ed25519.PublicKeySize {
+		return manifest, fmt.Errorf("manifest has an invalid signer key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(signatureData)))
+	if err != nil || !ed25519.Verify(signer, manifestData, signature) {
+		return manifest, fmt.Errorf("manifest signature is invalid")
+	}
+	if trusted != nil && !trusted.Equal(ed25519.PublicKey(signer)) {
+		return manifest, ErrUntrustedSigner
+	}
+
+	var problems []string
+	for _, name := range sortedNames(manifest.Files) {
+		expected := manifest.Files[name]
+		actual, ok := found[name]
+		switch {
+		case !ok:
+			problems = append(problems, name+": missing")
+		case actual != expected:
+			problems = append(problems, name+": checksum mismatch")
+		}
+	}
+	for _, name := range sortedNames(found) {
+		if _, ok := manifest.Files[name]; !ok {
+			problems = append(problems, name+": not in manifest")
+		}
+	}
+	if len(problems) > 0 {
+		return manifest, fmt.Errorf("archive contents don't match the manifest:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return manifest, nil
+}
+
+// ExtractFile streams one file of an archive to fn
+func ExtractFile(r io.Reader, name string, fn func(io.Reader) error) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("not a freeze archive: %w", err)
+	}
+	defer gz.Close()
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return fmt.Errorf("archive has no %s", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+		if header.Name == name {
+			return fn(archive)
+		}
+	}
+}
+
+// LoadOrCreateKey returns the signing key in dir, creating it on first use.
+// The public key is written next to it as freeze_ed25519.pub.
+func LoadOrCreateKey(dir string) (ed25519.PrivateKey, error) {
+	keyPath := filepath.Join(dir, "freeze_ed25519")
+
+	data, err := os.ReadFile(keyPath)
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid signing key %s", keyPath)
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid signing key %s: %w", keyPath, err)
+		}
+		key, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not an ed25519 key", keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save signing key: %w", err)
+	}
+	if err := os.WriteFile(keyPath+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return nil, fmt.Errorf("failed to save public key: %w", err)
+	}
+	return private, nil
+}
+
+// LoadPublicKey reads a PEM public key as written by LoadOrCreateKey
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key %s", path)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an ed25519 key", path)
+	}
+	return key, nil
+}
+
+// Fingerprint returns a short, printable identifier of a public key
+func Fingerprint(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func sortedNames(files map[string]File) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,81 @@
+package freeze
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/tools"
+)
+
+// spdxDocument is the subset of SPDX 2.3 written for an environment image
+type spdxDocument struct {
+	SPDXVersion       string        `json:"spdxVersion"`
+	DataLicense       string        `json:"dataLicense"`
+	SPDXID            string        `json:"SPDXID"`
+	Name              string        `json:"name"`
+	DocumentNamespace string        `json:"documentNamespace"`
+	CreationInfo      spdxCreation  `json:"creationInfo"`
+	Packages          []spdxPackage `json:"packages"`
+}
+
+type spdxCreation struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string `json:"name"`
+	SPDXID           string `json:"SPDXID"`
+	VersionInfo      string `json:"versionInfo,omitempty"`
+	DownloadLocation string `json:"downloadLocation"`
+	Comment          string `json:"comment,omitempty"`
+}
+
+var unsafeSPDXChars = regexp.MustCompile(`[^a-zA-Z0-9.-]+`)
+
+// SBOM returns an SPDX 2.3 JSON document listing the OS packages installed
+// by manager and the tools of a lock
+func SBOM(name, imageID, creator string, created time.Time, manager string, packages []tools.Package, lock tools.Lock) ([]byte, error) {
+	doc := spdxDocument{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              name,
+		DocumentNamespace: "https://devdrop.invalid/spdx/" + strings.TrimPrefix(imageID, "sha256:"),
+		CreationInfo: spdxCreation{
+			Created:  created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: " + creator},
+		},
+	}
+
+	for i, pkg := range packages {
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             pkg.Name,
+			SPDXID:           fmt.Sprintf("SPDXRef-Package-%s-%d", unsafeSPDXChars.ReplaceAllString(pkg.Name, "-"), i),
+			VersionInfo:      pkg.Version,
+			DownloadLocation: "NOASSERTION",
+			Comment:          "installed by " + manager,
+		})
+	}
+	for _, tool := range lock.Names() {
+		if tool == "packages" {
+			continue
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             tool,
+			SPDXID:           "SPDXRef-Tool-" + unsafeSPDXChars.ReplaceAllString(tool, "-"),
+			VersionInfo:      lock[tool],
+			DownloadLocation: "NOASSERTION",
+			Comment:          "tool version reported by the tool itself",
+		})
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SBOM: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,271 @@
+// Package hooks runs lifecycle hooks of environments.
+//
+// Hooks are shell commands configured per environment, in the config or in
+// the hooks section of devdrop.yaml, that run at points of a session's life:
+// pre_run before the session starts (e.g. to start a database sidecar),
+// post_run after it ended and pre_commit before its container is committed
+// (e.g. to strip caches). They run on the host or inside the session
+// container and learn about the session from DEVDROP_* variables.
+package hooks
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/shell"
+	"gopkg.in/yaml.v3"
+)
+
+// Event is a point in a session's life hooks run at
+type Event string
+
+const (
+	// PreRun hooks run before the session starts; host hooks before its
+	// container is created, container hooks before its shell starts
+	PreRun Event = "pre_run"
+	// PostRun hooks run on the host after the session ended
+	PostRun Event = "post_run"
+	// PreCommit hooks run before a session container is committed
+	PreCommit Event = "pre_commit"
+)
+
+// Where hooks run
+const (
+	InHost      = "host"
+	InContainer = "container"
+)
+
+// Hook is a shell command run at an event
+type Hook struct {
+	Run string `yaml:"run" json:"run"`
+	// In is where the command runs: host (the default) or container
+	In string `yaml:"in,omitempty" json:"in,omitempty"`
+	// Dir is the directory a host hook runs in; empty is the workspace
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	// Optional hooks only warn when they fail instead of stopping the
+	// operation they run for
+	Optional bool `yaml:"optional,omitempty" json:"optional,omitempty"`
+}
+
+// UnmarshalYAML accepts a plain command as shorthand for a host hook
+func (h *Hook) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*h = Hook{Run: value.Value}
+		return nil
+	}
+	type plain Hook
+	return value.Decode((*plain)(h))
+}
+
+// InContainer reports whether the hook runs inside the session container
+func (h Hook) InContainer() bool {
+	return h.In == InContainer
+}
+
+// String describes the hook for messages
+func (h Hook) String() string {
+	if h.InContainer() {
+		return h.Run + " (in container)"
+	}
+	return h.Run
+}
+
+// Hooks are the hooks of an environment, by event
+type Hooks struct {
+	PreRun    []Hook `yaml:"pre_run,omitempty" json:"pre_run,omitempty"`
+	PostRun   []Hook `yaml:"post_run,omitempty" json:"post_run,omitempty"`
+	PreCommit []Hook `yaml:"pre_commit,omitempty" json:"pre_commit,omitempty"`
+}
+
+// For returns the hooks of an event
+func (h Hooks) For(event Event) []Hook {
+	switch event {
+	case PreRun:
+		return h.PreRun
+	case PostRun:
+		return h.PostRun
+	case PreCommit:
+		return h.PreCommit
+	}
+	return nil
+}
+
+// Empty reports whether no hooks are configured
+func (h Hooks) Empty() bool {
+	return len(h.PreRun) == 0 && len(h.PostRun) == 0 && len(h.PreCommit) == 0
+}
+
+// Validate checks that every hook has a command and can run where it asks to
+func (h Hooks) Validate() error {
+	for _, event := range []Event{PreRun, PostRun, PreCommit} {
+		for i, hook := range h.For(event) {
+			if strings.TrimSpace(hook.Run) == "" {
+				return fmt.Errorf("%s hook %d has no command", event, i+1)
+			}
+			switch hook.In {
+			case "", InHost:
+			case InContainer:
+				if event == PostRun {
+					return fmt.Errorf("%s hook '%s' can't run in the container; the session has ended, use pre_commit instead", event, hook.Run)
+				}
+				if hook.Dir != "" {
+					return fmt.Errorf("%s hook '%s' runs in the container, which has no dir; it starts in the workspace", event, hook.Run)
+				}
+			default:
+				return fmt.Errorf("%s hook '%s' has unknown in '%s'; use host or container", event, hook.Run, hook.In)
+			}
+		}
+	}
+	return nil
+}
+
+// WithDir returns the hooks with host hooks that have no dir running in dir,
+// so hooks of a devdrop.yaml can refer to scripts next to it
+func (h Hooks) WithDir(dir string) Hooks {
+	resolve := func(list []Hook) []Hook {
+		if list == nil {
+			return nil
+		}
+		resolved := make([]Hook, len(list))
+		for i, hook := range list {
+			if !hook.InContainer() && hook.Dir == "" {
+				hook.Dir = dir
+			}
+			resolved[i] = hook
+		}
+		return resolved
+	}
+	return Hooks{PreRun: resolve(h.PreRun), PostRun: resolve(h.PostRun), PreCommit: resolve(h.PreCommit)}
+}
+
+// Split separates hooks running on the host from those running in the
+// container, keeping their order
+func Split(list []Hook) (host, container []Hook) {
+	for _, hook := range list {
+		if hook.InContainer() {
+			container = append(container, hook)
+		} else {
+			host = append(host, hook)
+		}
+	}
+	return host, container
+}
+
+// Runner runs the hooks of a session
+type Runner struct {
+	Environment string
+	// Container is the session container, empty before it is created
+	Container string
+	Workspace string
+	// Exec runs a command with extra environment variables in the session
+	// container and returns its exit code; container hooks fail without it
+	Exec   func(cmd, env []string) (int, error)
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run runs hooks for event in order. The first failing hook that isn't
+// optional stops the rest and its error is returned; failing optional hooks
+// are reported on Stderr.
+func (r *Runner) Run(event Event, list []Hook) error {
+	for _, hook := range list {
+		fmt.Fprintf(r.stdout(), "Running %s hook: %s\n", event, hook)
+		err := r.run(event, hook)
+		if err == nil {
+			continue
+		}
+		if hook.Optional {
+			fmt.Fprintf(r.stderr(), "Warning: optional %v\n", err)
+			continue
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *Runner) run(event Event, hook Hook) error {
+	if hook.InContainer() {
+		if r.Exec == nil {
+			return fmt.Errorf("%s hook '%s' needs a session container", event, hook.Run)
+		}
+		code, err := r.Exec([]string{"/bin/sh", "-c", hook.Run}, r.Env(event))
+		if err != nil {
+			return fmt.Errorf("%s hook '%s' failed: %w", event, hook.Run, err)
+		}
+		if code != 0 {
+			return fmt.Errorf("%s hook '%s' failed with exit status %d", event, hook.Run, code)
+		}
+		return nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", hook.Run)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", hook.Run)
+	}
+	cmd.Dir = hook.Dir
+	if cmd.Dir == "" {
+		cmd.Dir = r.Workspace
+	}
+	cmd.Env = append(os.Environ(), r.Env(event)...)
+	cmd.Stdout = r.stdout()
+	cmd.Stderr = r.stderr()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s hook '%s' failed: %w", event, hook.Run, err)
+	}
+	return nil
+}
+
+// Env returns the variables telling hooks about the session
+func (r *Runner) Env(event Event) []string {
+	env := []string{
+		"DEVDROP_HOOK=" + string(event),
+		"DEVDROP_ENVIRONMENT=" + r.Environment,
+		"DEVDROP_WORKSPACE=" + r.Workspace,
+	}
+	if r.Container != "" {
+		env = append(env, "DEVDROP_CONTAINER="+r.Container)
+	}
+	return env
+}
+
+// Script returns shell steps running container hooks for event as part of a
+// session's setup, before its shell starts. A failing hook that isn't
+// optional ends the session right away.
+func (r *Runner) Script(event Event, list []Hook) []string {
+	var vars []string
+	for _, v := range r.Env(event) {
+		vars = append(vars, shell.Quote(v))
+	}
+	steps := make([]string, 0, len(list))
+	for _, hook := range list {
+		run := "env " + strings.Join(vars, " ") + " /bin/sh -c " + shell.Quote(hook.Run)
+		if hook.Optional {
+			message := fmt.Sprintf("Warning: optional %s hook '%s' failed", event, hook.Run)
+			steps = append(steps, run+" || echo "+shell.Quote(message)+" >&2")
+		} else {
+			message := fmt.Sprintf("%s hook '%s' failed; ending the session", event, hook.Run)
+			steps = append(steps, run+" || { echo "+shell.Quote(message)+" >&2; exit 1; }")
+		}
+	}
+	return steps
+}
+
+func (r *Runner) stdout() io.Writer {
+	if r.Stdout == nil {
+		return os.Stdout
+	}
+	return r.Stdout
+}
+
+func (r *Runner) stderr() io.Writer {
+	if r.Stderr == nil {
+		return os.Stderr
+	}
+	return r.Stderr
+}
@@ -0,0 +1,164 @@
+// Package ignore reads .devdropignore files: paths of a workspace that are
+// kept out of sessions, such as dependency directories that are slow to
+// share with the Docker VM or files holding secrets.
+//
+// The format follows .gitignore: one pattern per line, # comments, a
+// leading / anchors a pattern to the workspace root, a trailing / matches
+// directories only and a leading ! re-includes what an earlier pattern
+// excluded. Patterns without a slash match a name at any depth; * and ?
+// never cross a slash, and a leading **/ matches at any depth.
+package ignore
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// FileName is the name of the ignore file in a workspace
+const FileName = ".devdropignore"
+
+// pattern is one line of an ignore file
+type pattern struct {
+	glob     string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// Rules are the patterns of an ignore file, in order
+type Rules struct {
+	patterns []pattern
+}
+
+// Parse reads ignore patterns from r
+func Parse(r io.Reader) (*Rules, error) {
+	rules := &Rules{}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var p pattern
+		if strings.HasPrefix(line, "!") {
+			p.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			p.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if rest := strings.TrimPrefix(line, "**/"); rest != line {
+			line = rest
+		} else if strings.Contains(line, "/") {
+			p.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		if _, err := path.Match(line, ""); err != nil {
+			return nil, fmt.Errorf("line %d: invalid pattern '%s': %w", n, scanner.Text(), err)
+		}
+		p.glob = line
+		rules.patterns = append(rules.patterns, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// Load reads the ignore file of a workspace. A workspace without one has no
+// rules.
+func Load(workspace string) (*Rules, error) {
+	f, err := os.Open(filepath.Join(workspace, FileName))
+	if os.IsNotExist(err) {
+		return &Rules{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", FileName, err)
+	}
+	defer f.Close()
+
+	rules, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", FileName, err)
+	}
+	return rules, nil
+}
+
+// Empty reports whether there are no patterns
+func (r *Rules) Empty() bool {
+	return len(r.patterns) == 0
+}
+
+// Match reports whether a path relative to the workspace, with forward
+// slashes, is ignored. The last matching pattern decides. Callers that walk
+// a tree don't descend into ignored directories, so a path inside one is
+// only matched on its own.
+func (r *Rules) Match(rel string, isDir bool) bool {
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	ignored := false
+	for _, p := range r.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.matches(rel) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matches reports whether a pattern matches the path itself
+func (p pattern) matches(rel string) bool {
+	if p.anchored || strings.Contains(p.glob, "/") {
+		if ok, _ := path.Match(p.glob, rel); ok {
+			return true
+		}
+		// Unanchored patterns with a slash (from **/) match at any depth
+		if !p.anchored {
+			for i := strings.Index(rel, "/"); i >= 0; i = strings.Index(rel, "/") {
+				rel = rel[i+1:]
+				if ok, _ := path.Match(p.glob, rel); ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(p.glob, path.Base(rel))
+	return ok
+}
+
+// Walk calls fn for the entries of a workspace that aren't ignored, with
+// their path relative to the workspace, and for the topmost ignored ones
+// with ignored set. Ignored directories are not descended into.
+func (r *Rules) Walk(workspace string, fn func(rel string, info os.FileInfo, ignored bool) error) error {
+	return filepath.Walk(workspace, func(full string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(workspace, full)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		ignored := r.Match(rel, info.IsDir())
+		if err := fn(rel, info, ignored); err != nil {
+			return err
+		}
+		if ignored && info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{"name at any depth", "node_modules", "web/node_modules", true, true},
+		{"name at the root", "node_modules", "node_modules", true, true},
+		{"glob on the base name", "*.log", "logs/app.log", false, true},
+		{"glob doesn't match other names", "*.log", "app.txt", false, false},
+		{"anchored at the root", "/build", "build", true, true},
+		{"anchored not deeper", "/build", "src/build", true, false},
+		{"pattern with a slash is anchored", "docs/out", "docs/out", true, true},
+		{"pattern with a slash not deeper", "docs/out", "site/docs/out", true, false},
+		{"star doesn't cross a slash", "/src/*.go", "src/pkg/a.go", false, false},
+		{"star within a directory", "/src/*.go", "src/a.go", false, true},
+		{"leading double star at any depth", "**/cache/tmp", "a/b/cache/tmp", true, true},
+		{"leading double star at the root", "**/cache/tmp", "cache/tmp", true, true},
+		{"dir only matches directories", "dist/", "dist", true, true},
+		{"dir only skips files", "dist/", "dist", false, false},
+		{"negation re-includes", "*.env\n!example.env", "example.env", false, false},
+		{"negation of something else", "*.env\n!example.env", "prod.env", false, true},
+		{"last pattern decides", "!keep\nkeep", "keep", false, true},
+		{"comments and blank lines", "# secrets\n\n.env", ".env", false, true},
+		{"path is cleaned", "/build", "./build/", true, true},
+		{"no patterns", "", "anything", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(strings.NewReader(tt.patterns))
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := rules.Match(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		patterns int
+		wantErr  bool
+	}{
+		{"one pattern per line", "a\nb\n/c\n", 3, false},
+		{"comments and blank lines are skipped", "# x\n\n  \na", 1, false},
+		{"empty patterns are skipped", "/\n!\n", 0, false},
+		{"invalid glob", "a\n[z-\n", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := Parse(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.HasPrefix(err.Error(), "line 2:") {
+					t.Errorf("Parse() error = %v, want it to name line 2", err)
+				}
+				return
+			}
+			if len(rules.patterns) != tt.patterns {
+				t.Errorf("Parse() got %d patterns, want %d", len(rules.patterns), tt.patterns)
+			}
+			if rules.Empty() != (tt.patterns == 0) {
+				t.Errorf("Empty() = %v with %d patterns", rules.Empty(), tt.patterns)
+			}
+		})
+	}
+}
@@ -0,0 +1,143 @@
+// Package inotify inspects and tunes the kernel inotify limits that file
+// watchers inside DevDrop environments depend on.
+//
+// JavaScript dev servers, test runners and editors watch every file in the
+// workspace. Those watches are charged against the kernel running the
+// container (the host on Linux, the Docker VM on macOS and Windows), so low
+// defaults surface inside the environment as "System limit for number of
+// file watchers reached" (ENOSPC) errors.
+package inotify
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const (
+	// RecommendedMaxUserWatches is the watch limit most JS tooling documents
+	RecommendedMaxUserWatches = 524288
+	// RecommendedMaxUserInstances is the per-user inotify instance limit
+	RecommendedMaxUserInstances = 512
+
+	procDir           = "/proc/sys/fs/inotify"
+	maxUserWatches    = "max_user_watches"
+	maxUserInstances  = "max_user_instances"
+	sysctlPersistFile = "/etc/sysctl.d/99-devdrop-inotify.conf"
+)
+
+// ErrUnsupported is returned when the host kernel limits cannot be read,
+// e.g. on macOS or Windows where containers run inside a VM
+var ErrUnsupported = errors.New("inotify limits can only be inspected on a Linux host")
+
+// Limits holds the kernel inotify settings relevant to file watchers
+type Limits struct {
+	MaxUserWatches   int
+	MaxUserInstances int
+}
+
+// Recommended returns the limits DevDrop suggests for development workloads
+func Recommended() Limits {
+	return Limits{
+		MaxUserWatches:   RecommendedMaxUserWatches,
+		MaxUserInstances: RecommendedMaxUserInstances,
+	}
+}
+
+// Sufficient reports whether the limits meet the recommended values
+func (l Limits) Sufficient() bool {
+	rec := Recommended()
+	return l.MaxUserWatches >= rec.MaxUserWatches && l.MaxUserInstances >= rec.MaxUserInstances
+}
+
+// Raised returns the limits with each value raised to at least the recommended one
+func (l Limits) Raised() Limits {
+	rec := Recommended()
+	if l.MaxUserWatches < rec.MaxUserWatches {
+		l.MaxUserWatches = rec.MaxUserWatches
+	}
+	if l.MaxUserInstances < rec.MaxUserInstances {
+		l.MaxUserInstances = rec.MaxUserInstances
+	}
+	return l
+}
+
+// ReadHost reads the inotify limits of the local kernel
+func ReadHost() (Limits, error) {
+	if runtime.GOOS != "linux" {
+		return Limits{}, ErrUnsupported
+	}
+
+	watches, err := readProcValue(maxUserWatches)
+	if err != nil {
+		return Limits{}, err
+	}
+	instances, err := readProcValue(maxUserInstances)
+	if err != nil {
+		return Limits{}, err
+	}
+
+	return Limits{MaxUserWatches: watches, MaxUserInstances: instances}, nil
+}
+
+// ApplyHost writes the limits to the local kernel. This requires root.
+func ApplyHost(l Limits) error {
+	if runtime.GOOS != "linux" {
+		return ErrUnsupported
+	}
+
+	if err := writeProcValue(maxUserWatches, l.MaxUserWatches); err != nil {
+		return err
+	}
+	return writeProcValue(maxUserInstances, l.MaxUserInstances)
+}
+
+// ShellCommand returns a command that applies the limits from inside a
+// privileged container, leaving values that are already higher alone.
+// fs.inotify is not namespaced, so this changes the kernel shared by every
+// container on the Docker host.
+func ShellCommand(l Limits) []string {
+	raise := "raise() { [ \"$(cat $1)\" -ge $2 ] 2>/dev/null || echo $2 > $1; }"
+	script := fmt.Sprintf("%s; raise %s/%s %d && raise %s/%s %d", raise,
+		procDir, maxUserWatches, l.MaxUserWatches,
+		procDir, maxUserInstances, l.MaxUserInstances)
+	return []string{"sh", "-c", script}
+}
+
+// Advice returns remediation steps for raising the limits on the host
+func Advice(l Limits) string {
+	rec := l.Raised()
+	var b strings.Builder
+	fmt.Fprintln(&b, "Raise the limits for the current boot with:")
+	fmt.Fprintf(&b, "  sudo sysctl -w fs.inotify.%s=%d\n", maxUserWatches, rec.MaxUserWatches)
+	fmt.Fprintf(&b, "  sudo sysctl -w fs.inotify.%s=%d\n", maxUserInstances, rec.MaxUserInstances)
+	fmt.Fprintln(&b, "Persist them across reboots with:")
+	fmt.Fprintf(&b, "  printf 'fs.inotify.%s=%d\\nfs.inotify.%s=%d\\n' | sudo tee %s\n",
+		maxUserWatches, rec.MaxUserWatches, maxUserInstances, rec.MaxUserInstances, sysctlPersistFile)
+	fmt.Fprint(&b, "Or let DevDrop apply them through Docker with 'devdrop run --tune-inotify' (runs a privileged helper container).")
+	return b.String()
+}
+
+func readProcValue(name string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(procDir, name))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read fs.inotify.%s: %w", name, err)
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse fs.inotify.%s: %w", name, err)
+	}
+	return value, nil
+}
+
+func writeProcValue(name string, value int) error {
+	path := filepath.Join(procDir, name)
+	if err := os.WriteFile(path, []byte(strconv.Itoa(value)), 0644); err != nil {
+		return fmt.Errorf("failed to set fs.inotify.%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Progress formats selected with --progress
+const (
+	ProgressText = "text"
+	ProgressJSON = "json"
+)
+
+// Progress is how progress is reported: as text for people, or as JSON
+// events for programs wrapping devdrop, such as GUIs and editor plugins
+var Progress = ProgressText
+
+// ValidateProgress checks a --progress value
+func ValidateProgress(format string) error {
+	switch format {
+	case ProgressText, ProgressJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid progress format '%s': must be text or json", format)
+}
+
+// JSONProgress reports whether progress is written as JSON events
+func JSONProgress() bool {
+	return Progress == ProgressJSON
+}
+
+// Event names
+const (
+	// EventTransfer reports the progress of a layer being pulled, pushed,
+	// built or loaded
+	EventTransfer = "transfer"
+	// EventContainerCreated is emitted when a session container is created
+	EventContainerCreated = "container_created"
+	// EventSessionStarted and EventSessionEnded surround interactive sessions
+	EventSessionStarted = "session_started"
+	EventSessionEnded   = "session_ended"
+	// EventCommitDone is emitted when a commit is saved, and pushed unless
+	// nothing is pushed
+	EventCommitDone = "commit_done"
+	// EventError is emitted when a command fails
+	EventError = "error"
+)
+
+// Event is a progress event written as one line of JSON with --progress
+// json. Workflow steps are reported with their kind (step_started, info,
+// warning, step_done, step_skipped, step_failed) as Event.
+type Event struct {
+	Event       string    `json:"event"`
+	Time        time.Time `json:"time"`
+	Environment string    `json:"environment,omitempty"`
+	Image       string    `json:"image,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	Version     string    `json:"version,omitempty"`
+	Workflow    string    `json:"workflow,omitempty"`
+	Step        string    `json:"step,omitempty"`
+	// Index is the 1-based position of Step among Total steps
+	Index    int           `json:"index,omitempty"`
+	Total    int           `json:"total,omitempty"`
+	Message  string        `json:"message,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Transfer *TransferInfo `json:"transfer,omitempty"`
+}
+
+// TransferInfo is the state of one layer of a transfer
+type TransferInfo struct {
+	// Op is pull or push, empty for builds and loads
+	Op     string `json:"op,omitempty"`
+	Layer  string `json:"layer,omitempty"`
+	Status string `json:"status,omitempty"`
+	// Current and Size are in bytes; Size is 0 when unknown
+	Current int64 `json:"current,omitempty"`
+	Size    int64 `json:"size,omitempty"`
+}
+
+// EventOutput receives JSON events; stderr keeps them apart from command
+// output such as -o json
+var EventOutput io.Writer = os.Stderr
+
+var eventMu sync.Mutex
+
+// Emit writes an event as a line of JSON when progress is JSON, and does
+// nothing otherwise. It is safe to call from several goroutines.
+func Emit(e Event) {
+	if !JSONProgress() {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	EventOutput.Write(append(data, '\n'))
+}
@@ -0,0 +1,101 @@
+// Package output provides shared formatting helpers for DevDrop command output.
+//
+// Commands render timestamps, status markers and similar values through this
+// package so that formatting options set by global flags (such as --utc and
+// --plain) are applied consistently across ls, status and the other commands.
+package output
+
+import (
+	"fmt"
+	"time"
+)
+
+const timestampLayout = "2006-01-02 15:04 MST"
+
+// UseUTC renders timestamps in UTC instead of the local timezone
+var UseUTC bool
+
+// Plain disables emoji, progress bars and cursor movement so output reads
+// line by line, for screen readers and log files
+var Plain bool
+
+// SuccessMark returns the marker printed before successful outcomes
+func SuccessMark() string {
+	if Plain {
+		return "OK:"
+	}
+	return "✅"
+}
+
+// WarningMark returns the marker printed before problems that need attention
+func WarningMark() string {
+	if Plain {
+		return "WARNING:"
+	}
+	return "⚠️ "
+}
+
+// Successf prints a success line prefixed with SuccessMark
+func Successf(format string, args ...interface{}) {
+	fmt.Printf("%s %s\n", SuccessMark(), fmt.Sprintf(format, args...))
+}
+
+// Timestamp formats t as an absolute time in the configured timezone
+func Timestamp(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return localize(t).Format(timestampLayout)
+}
+
+// TimestampWithAge formats t as an absolute time followed by its relative age,
+// e.g. "2025-01-20 14:45 CET (2 days ago)"
+func TimestampWithAge(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return fmt.Sprintf("%s (%s)", Timestamp(t), RelativeTime(t))
+}
+
+// RelativeTime formats t relative to now, e.g. "5 minutes ago" or "in 2 hours"
+func RelativeTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	d := time.Since(t)
+	suffix := "ago"
+	if d < 0 {
+		d = -d
+		suffix = "from now"
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return pluralize(int(d/time.Minute), "minute", suffix)
+	case d < 24*time.Hour:
+		return pluralize(int(d/time.Hour), "hour", suffix)
+	case d < 30*24*time.Hour:
+		return pluralize(int(d/(24*time.Hour)), "day", suffix)
+	case d < 365*24*time.Hour:
+		return pluralize(int(d/(30*24*time.Hour)), "month", suffix)
+	default:
+		return pluralize(int(d/(365*24*time.Hour)), "year", suffix)
+	}
+}
+
+func localize(t time.Time) time.Time {
+	if UseUTC {
+		return t.UTC()
+	}
+	return t.Local()
+}
+
+func pluralize(n int, unit, suffix string) string {
+	if n == 1 {
+		return fmt.Sprintf("1 %s %s", unit, suffix)
+	}
+	return fmt.Sprintf("%d %ss %s", n, unit, suffix)
+}
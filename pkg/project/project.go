@@ -0,0 +1,179 @@
+// Package project detects what kind of project a directory holds and ranks
+// environments by how well they fit it.
+//
+// Detection looks at well-known marker files (go.mod, package.json,
+// requirements.txt, ...) in the project root and at the base image of a
+// Dockerfile, if there is one. Environments are scored by the tools locked at
+// their last commit, their base image and their name.
+package project
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Stack is a language or toolchain a project uses
+type Stack struct {
+	// Name is the stack's short name, e.g. "go"
+	Name string
+	// Marker is the file that gave the stack away
+	Marker string
+	// Tool is the name the stack's main tool has in a tools lock
+	Tool string
+	// Images are image repositories that provide the stack, e.g. "golang"
+	Images []string
+	// Starter is the devdrop init starter image for the stack, if any
+	Starter string
+	// BaseImage is an image to start from when there is no starter
+	BaseImage string
+}
+
+// stacks lists the detectable stacks and their marker files
+var stacks = []struct {
+	markers []string
+	stack   Stack
+}{
+	{[]string{"go.mod"}, Stack{Name: "go", Tool: "go", Images: []string{"golang", "go"}, Starter: "go"}},
+	{[]string{"package.json"}, Stack{Name: "node", Tool: "node", Images: []string{"node"}, Starter: "node"}},
+	{[]string{"requirements.txt", "pyproject.toml", "Pipfile", "setup.py"}, Stack{Name: "python", Tool: "python", Images: []string{"python"}, Starter: "python"}},
+	{[]string{"Cargo.toml"}, Stack{Name: "rust", Tool: "rustc", Images: []string{"rust"}, BaseImage: "rust:latest"}},
+	{[]string{"Gemfile"}, Stack{Name: "ruby", Tool: "ruby", Images: []string{"ruby"}, BaseImage: "ruby:latest"}},
+	{[]string{"pom.xml", "build.gradle", "build.gradle.kts"}, Stack{Name: "java", Tool: "java", Images: []string{"eclipse-temurin", "openjdk", "maven", "gradle"}, BaseImage: "eclipse-temurin:latest"}},
+}
+
+// Project is what was detected in a directory
+type Project struct {
+	Dir    string
+	Stacks []Stack
+	// DockerfileBase is the image of the first FROM line of the Dockerfile
+	DockerfileBase string
+}
+
+// Detect inspects the marker files in dir
+func Detect(dir string) Project {
+	project := Project{Dir: dir}
+	for _, candidate := range stacks {
+		for _, marker := range candidate.markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				stack := candidate.stack
+				stack.Marker = marker
+				project.Stacks = append(project.Stacks, stack)
+				break
+			}
+		}
+	}
+	project.DockerfileBase = dockerfileBase(filepath.Join(dir, "Dockerfile"))
+	return project
+}
+
+// Empty reports whether nothing recognizable was found
+func (p Project) Empty() bool {
+	return len(p.Stacks) == 0 && p.DockerfileBase == ""
+}
+
+// Candidate describes an environment for Rank
+type Candidate struct {
+	Name      string
+	BaseImage string
+	// Tools are the tool names locked at the environment's last commit
+	Tools []string
+}
+
+// Match is a ranked environment with the reasons it fits
+type Match struct {
+	Name    string
+	Score   int
+	Reasons []string
+}
+
+// Rank scores environments against the project, best first. Environments
+// that fit nothing are left out.
+func (p Project) Rank(candidates []Candidate) []Match {
+	var matches []Match
+	for _, candidate := range candidates {
+		match := Match{Name: candidate.Name}
+		baseRepo := imageRepository(candidate.BaseImage)
+
+		for _, stack := range p.Stacks {
+			switch {
+			case contains(candidate.Tools, stack.Tool):
+				match.Score += 3
+				match.Reasons = append(match.Reasons, "has "+stack.Tool+" installed")
+			case contains(stack.Images, baseRepo):
+				match.Score += 2
+				match.Reasons = append(match.Reasons, "based on "+candidate.BaseImage)
+			case strings.Contains(strings.TrimPrefix(candidate.Name, "devdrop-"), stack.Name):
+				match.Score++
+				match.Reasons = append(match.Reasons, "named after "+stack.Name)
+			}
+		}
+
+		if p.DockerfileBase != "" && candidate.BaseImage != "" && imageRepository(p.DockerfileBase) == baseRepo {
+			match.Score += 2
+			match.Reasons = append(match.Reasons, "same base image as the Dockerfile")
+		}
+
+		if match.Score > 0 {
+			matches = append(matches, match)
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	return matches
+}
+
+// dockerfileBase returns the image of the first FROM line, ignoring flags
+// such as --platform
+func dockerfileBase(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		for _, field := range fields[1:] {
+			if !strings.HasPrefix(field, "--") {
+				return field
+			}
+		}
+	}
+	return ""
+}
+
+// imageRepository strips the registry, namespace, tag and digest from an
+// image reference: "docker.io/library/golang:1.22" becomes "golang"
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, "/"); i >= 0 {
+		image = image[i+1:]
+	}
+	if i := strings.Index(image, ":"); i >= 0 {
+		image = image[:i]
+	}
+	return image
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+// Package prompt provides interactive prompts for DevDrop commands.
+//
+// All prompts share a single buffered reader on stdin, so piped input
+// ("printf '2\nmyenv\n' | devdrop init") is consumed line by line instead of
+// being swallowed by the first prompt. Ctrl-C returns ErrInterrupted with the
+// terminal restored.
+//
+// In non-interactive mode (--non-interactive or --yes) prompts never read
+// stdin: they take their default, and return ErrNonInteractive when a value
+// is required. Scripts piping answers into a command get the same behaviour
+// once the piped input runs out, instead of looping or silently accepting an
+// empty answer.
+package prompt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+var (
+	// ErrInterrupted is returned when the user presses Ctrl-C during a prompt
+	ErrInterrupted = errors.New("interrupted")
+	// ErrNoInput is returned when stdin is closed before an answer is given
+	ErrNoInput = errors.New("no input available (stdin closed)")
+	// ErrNonInteractive is returned when a prompt without a default is
+	// reached in non-interactive mode
+	ErrNonInteractive = errors.New("input required but running non-interactively")
+)
+
+var (
+	// NonInteractive makes prompts take their defaults instead of reading stdin
+	NonInteractive bool
+	// AssumeYes answers yes to confirmations; implies NonInteractive
+	AssumeYes bool
+)
+
+var (
+	stdin           = bufio.NewReader(os.Stdin)
+	out   io.Writer = os.Stdout
+)
+
+// Input asks for a line of text. An empty answer returns defaultValue.
+func Input(label, defaultValue string) (string, error) {
+	if isNonInteractive() {
+		return unattendedInput(label, defaultValue)
+	}
+
+	if defaultValue != "" {
+		fmt.Fprintf(out, "%s [%s]: ", label, defaultValue)
+	} else {
+		fmt.Fprintf(out, "%s: ", label)
+	}
+
+	answer, err := readLine()
+	if errors.Is(err, ErrNoInput) {
+		// Piped answers ran out; fall back as if running non-interactively
+		if defaultValue == "" {
+			return "", required(label)
+		}
+		return defaultValue, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if answer == "" {
+		return defaultValue, nil
+	}
+	return answer, nil
+}
+
+// Password asks for a secret without echoing it when stdin is a terminal.
+// Piped input is read as a plain line.
+func Password(label string) (string, error) {
+	if isNonInteractive() {
+		return "", required(label)
+	}
+
+	fmt.Fprintf(out, "%s: ", label)
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := readLine()
+		if errors.Is(err, ErrNoInput) {
+			return "", required(label)
+		}
+		return line, err
+	}
+
+	// ReadPassword disables echo; make sure it comes back on Ctrl-C
+	state, err := term.GetState(fd)
+	if err != nil {
+		return "", fmt.Errorf("failed to read terminal state: %w", err)
+	}
+
+	result := make(chan lineResult, 1)
+	go func() {
+		password, err := term.ReadPassword(fd)
+		result <- lineResult{line: string(password), err: err}
+	}()
+
+	line, err := waitForLine(result, func() { term.Restore(fd, state) }, nil)
+	fmt.Fprintln(out) // Add newline after hidden password input
+	return line, err
+}
+
+// Select prints numbered options and asks for a choice, returning the
+// zero-based index. defaultIndex is used for an empty answer; pass -1 to
+// require an explicit choice.
+func Select(label string, options []string, defaultIndex int) (int, error) {
+	if len(options) == 0 {
+		return -1, fmt.Errorf("nothing to select from")
+	}
+
+	if isNonInteractive() {
+		if defaultIndex < 0 || defaultIndex >= len(options) {
+			return -1, required(label)
+		}
+		fmt.Fprintf(out, "%s: %s\n", label, options[defaultIndex])
+		return defaultIndex, nil
+	}
+
+	for i, option := range options {
+		fmt.Fprintf(out, "%d. %s\n", i+1, option)
+	}
+
+	question := fmt.Sprintf("%s (1-%d)", label, len(options))
+	defaultValue := ""
+	if defaultIndex >= 0 && defaultIndex < len(options) {
+		defaultValue = strconv.Itoa(defaultIndex + 1)
+	}
+
+	answer, err := Input(question, defaultValue)
+	if errors.Is(err, ErrNonInteractive) {
+		return -1, required(label)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	choice, err := strconv.Atoi(answer)
+	if err != nil || choice < 1 || choice > len(options) {
+		return -1, fmt.Errorf("invalid selection. Please choose 1-%d", len(options))
+	}
+
+	return choice - 1, nil
+}
+
+// Batch is a set of options SelectStreaming receives while it waits for an
+// answer. Warning, if set, is shown with them, e.g. when a source could not
+// be listed.
+type Batch struct {
+	Options []string
+	Warning string
+}
+
+// SelectStreaming is like Select without a default, except that options
+// received on more while waiting for an answer are appended to the list and
+// the question is asked again. more is closed when no further options will
+// arrive. This lets slow sources (e.g. a registry) fill in a prompt without
+// holding it up. Piped answers were written for the full list, so when
+// stdin isn't a terminal all options are waited for before asking.
+func SelectStreaming(label string, options []string, more <-chan Batch) (int, error) {
+	if isNonInteractive() {
+		return -1, required(label)
+	}
+
+	waitForAll := !term.IsTerminal(int(os.Stdin.Fd()))
+	for more != nil && (len(options) == 0 || waitForAll) {
+		batch, ok := <-more
+		if !ok {
+			more = nil
+			break
+		}
+		if batch.Warning != "" {
+			fmt.Fprintf(out, "Warning: %s\n", batch.Warning)
+		}
+		options = append(options, batch.Options...)
+	}
+	if len(options) == 0 {
+		return -1, fmt.Errorf("nothing to select from")
+	}
+
+	for i, option := range options {
+		fmt.Fprintf(out, "%d. %s\n", i+1, option)
+	}
+	fmt.Fprintf(out, "%s (1-%d): ", label, len(options))
+
+	updates := &updateStream{
+		ch: more,
+		onUpdate: func(batch Batch) {
+			if len(batch.Options) == 0 && batch.Warning == "" {
+				return
+			}
+			// Move off the pending question before extending the list
+			fmt.Fprintln(out)
+			if batch.Warning != "" {
+				fmt.Fprintf(out, "Warning: %s\n", batch.Warning)
+			}
+			for _, option := range batch.Options {
+				options = append(options, option)
+				fmt.Fprintf(out, "%d. %s\n", len(options), option)
+			}
+			fmt.Fprintf(out, "%s (1-%d): ", label, len(options))
+		},
+	}
+
+	answer, err := waitForLine(startRead(), nil, updates)
+	if errors.Is(err, ErrNoInput) {
+		return -1, required(label)
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	choice, err := strconv.Atoi(answer)
+	if err != nil || choice < 1 || choice > len(options) {
+		return -1, fmt.Errorf("invalid selection. Please choose 1-%d", len(options))
+	}
+
+	return choice - 1, nil
+}
+
+// Confirm asks a yes/no question. An empty answer returns defaultYes.
+func Confirm(label string, defaultYes bool) (bool, error) {
+	hint := "y/N"
+	if defaultYes {
+		hint = "Y/n"
+	}
+	fmt.Fprintf(out, "%s [%s]: ", label, hint)
+
+	if isNonInteractive() {
+		answer := AssumeYes || defaultYes
+		if answer {
+			fmt.Fprintln(out, "yes")
+		} else {
+			fmt.Fprintln(out, "no")
+		}
+		return answer, nil
+	}
+
+	answer, err := readLine()
+	if errors.Is(err, ErrNoInput) {
+		return defaultYes, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "":
+		return defaultYes, nil
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid answer '%s'. Please answer yes or no", answer)
+}
+
+func isNonInteractive() bool {
+	return NonInteractive || AssumeYes
+}
+
+// unattendedInput answers a text prompt without reading stdin
+func unattendedInput(label, defaultValue string) (string, error) {
+	if defaultValue == "" {
+		return "", required(label)
+	}
+	fmt.Fprintf(out, "%s: %s\n", label, defaultValue)
+	return defaultValue, nil
+}
+
+func required(label string) error {
+	return fmt.Errorf("%w: %s", ErrNonInteractive, strings.ToLower(label))
+}
+
+type lineResult struct {
+	line string
+	err  error
+}
+
+// readLine reads one trimmed line from the shared stdin reader
+func readLine() (string, error) {
+	return waitForLine(startRead(), nil, nil)
+}
+
+// startRead reads one line from the shared stdin reader in the background
+func startRead() <-chan lineResult {
+	result := make(chan lineResult, 1)
+	go func() {
+		line, err := stdin.ReadString('\n')
+		// A final line without newline is still a valid answer
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		result <- lineResult{line: line, err: err}
+	}()
+	return result
+}
+
+// updateStream delivers values that arrive while a prompt is waiting for input
+type updateStream struct {
+	ch       <-chan Batch
+	onUpdate func(Batch)
+}
+
+// waitForLine waits for a read to finish or for Ctrl-C, running restore on
+// interrupt before returning. Values received on updates while waiting are
+// passed to its onUpdate; updates may be nil.
+func waitForLine(result <-chan lineResult, restore func(), updates *updateStream) (string, error) {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var updateCh <-chan Batch
+	if updates != nil {
+		updateCh = updates.ch
+	}
+
+	for {
+		select {
+		case batch, ok := <-updateCh:
+			if !ok {
+				updateCh = nil
+				continue
+			}
+			updates.onUpdate(batch)
+		case <-interrupt:
+			if restore != nil {
+				restore()
+			}
+			fmt.Fprintln(out)
+			return "", ErrInterrupted
+		case r := <-result:
+			if errors.Is(r.err, io.EOF) {
+				fmt.Fprintln(out)
+				return "", ErrNoInput
+			}
+			if r.err != nil {
+				return "", fmt.Errorf("failed to read input: %w", r.err)
+			}
+			return strings.TrimSpace(r.line), nil
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Cache keeps registry API responses on disk, so listing environments for
+// every 'devdrop ls' and pull prompt doesn't run into rate limits. Responses
+// younger than the TTL are used without asking the API; older ones are
+// revalidated with a conditional request, and used anyway when the API
+// answers 429 Too Many Requests.
+type Cache struct {
+	dir string
+	ttl time.Duration
+}
+
+// NewCache returns a cache keeping responses in dir
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl}
+}
+
+// CachingBackend is implemented by backends that can answer from a Cache
+type CachingBackend interface {
+	SetCache(cache *Cache)
+}
+
+// StaleError is returned along with results from the cache when the API
+// refused to answer because of its rate limit
+type StaleError struct {
+	API     string
+	Fetched time.Time
+}
+
+func (e *StaleError) Error() string {
+	return fmt.Sprintf("%s API rate limit reached; using results cached %s ago", e.API, time.Since(e.Fetched).Round(time.Second))
+}
+
+// RateLimitError is returned when the API refused to answer because of its
+// rate limit and nothing was cached
+type RateLimitError struct {
+	API string
+	// RetryAfter is how long the API asked to wait, zero if it didn't say
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s API rate limit reached; try again in %s", e.API, e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("%s API rate limit reached; try again later", e.API)
+}
+
+// cacheEntry is a cached response
+type cacheEntry struct {
+	URL          string          `json:"url"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"last_modified,omitempty"`
+	Fetched      time.Time       `json:"fetched"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// getJSON performs req like the package's getJSON, answering from the cache
+// where possible. Responses that depend on who asks are told apart by user;
+// authorize, if not nil, adds credentials to req when it is actually sent.
+// Results from a stale entry come with a *StaleError. A nil cache just
+// performs the request.
+func (c *Cache) getJSON(client *http.Client, api, user string, authorize func(*http.Request) error, req *http.Request, v interface{}) error {
+	if c == nil {
+		if authorize != nil {
+			if err := authorize(req); err != nil {
+				return err
+			}
+		}
+		return getJSON(client, api, req, v)
+	}
+
+	file := c.path(user, req.URL.String())
+	entry, cached := c.load(file)
+	if cached && time.Since(entry.Fetched) < c.ttl {
+		return decodeCached(api, entry, v)
+	}
+	if cached {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+	if authorize != nil {
+		// Logging in counts against the rate limit as well
+		var limited *RateLimitError
+		if err := authorize(req); errors.As(err, &limited) && cached {
+			if err := decodeCached(api, entry, v); err != nil {
+				return err
+			}
+			return &StaleError{API: api, Fetched: entry.Fetched}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s API: %w", api, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		entry.Fetched = time.Now()
+		c.store(file, entry)
+		return decodeCached(api, entry, v)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if !cached {
+			return &RateLimitError{API: api, RetryAfter: retryAfter(resp.Header.Get("Retry-After"))}
+		}
+		if err := decodeCached(api, entry, v); err != nil {
+			return err
+		}
+		return &StaleError{API: api, Fetched: entry.Fetched}
+	case resp.StatusCode != http.StatusOK:
+		return &statusError{api: api, code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", api, err)
+	}
+
+	c.store(file, cacheEntry{
+		URL:          req.URL.String(),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Fetched:      time.Now(),
+		Body:         body,
+	})
+	return nil
+}
+
+// path returns the file caching url as seen by user
+func (c *Cache) path(user, url string) string {
+	sum := sha256.Sum256([]byte(user + "\n" + url))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])[:16]+".json")
+}
+
+// load reads a cache entry; unreadable entries count as missing
+func (c *Cache) load(file string) (cacheEntry, bool) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return cacheEntry{}, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || len(entry.Body) == 0 {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// store writes a cache entry. The cache is only an optimization, so failing
+// to write it is ignored.
+func (c *Cache) store(file string, entry cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// Listings may include private repositories
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(c.dir, ".entry-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+	}
+}
+
+func decodeCached(api string, entry cacheEntry, v interface{}) error {
+	if err := json.Unmarshal(entry.Body, v); err != nil {
+		return fmt.Errorf("failed to parse cached %s response: %w", api, err)
+	}
+	return nil
+}
+
+// retryAfter parses a Retry-After header, given in seconds or as a date
+func retryAfter(header string) time.Duration {
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
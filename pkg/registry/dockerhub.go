@@ -0,0 +1,239 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DockerHubRepository is a repository returned by the Docker Hub API
+type DockerHubRepository struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsPrivate   bool   `json:"is_private"`
+	LastUpdated string `json:"last_updated"`
+}
+
+// DockerHubRepositoriesResponse is a page of repositories from the Docker Hub API
+type DockerHubRepositoriesResponse struct {
+	Count    int                   `json:"count"`
+	Next     string                `json:"next"`
+	Previous string                `json:"previous"`
+	Results  []DockerHubRepository `json:"results"`
+}
+
+// dockerHub lists repositories through the hub.docker.com API, whose rate
+// limits make a Cache worthwhile. With credentials it logs in for a JWT, so
+// private repositories are listed too.
+type dockerHub struct {
+	http  *http.Client
+	creds Credentials
+	cache *Cache
+	token string
+}
+
+func (d *dockerHub) SetCache(cache *Cache) {
+	d.cache = cache
+}
+
+// ListDevDropRepositories lists namespace's devdrop-* repositories. When
+// the rate limit is reached, the cached listing is returned with a
+// *StaleError.
+func (d *dockerHub) ListDevDropRepositories(namespace string) ([]string, error) {
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/?page_size=100", namespace)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Docker Hub request: %w", err)
+	}
+
+	var hubResp DockerHubRepositoriesResponse
+	var stale *StaleError
+	if err := d.cache.getJSON(d.http, "Docker Hub", d.creds.Username, d.authorize, req, &hubResp); err != nil && !errors.As(err, &stale) {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.code {
+			case http.StatusNotFound:
+				return nil, fmt.Errorf("user '%s' not found on Docker Hub. Check your username in 'devdrop login'", namespace)
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return nil, fmt.Errorf("access denied. The user '%s' may have no public repositories or they may be private", namespace)
+			}
+		}
+		return nil, err
+	}
+
+	names := make([]string, 0, len(hubResp.Results))
+	for _, repo := range hubResp.Results {
+		names = append(names, repo.Name)
+	}
+
+	if stale != nil {
+		return filterDevDrop(names), stale
+	}
+	return filterDevDrop(names), nil
+}
+
+func (d *dockerHub) RepositoryVisibility(namespace, name string) (string, error) {
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/%s/", namespace, name)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create Docker Hub request: %w", err)
+	}
+
+	var repo DockerHubRepository
+	var stale *StaleError
+	if err := d.cache.getJSON(d.http, "Docker Hub", d.creds.Username, d.authorize, req, &repo); err != nil && !errors.As(err, &stale) {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+			return "", ErrRepositoryNotFound
+		}
+		return "", err
+	}
+
+	if repo.IsPrivate {
+		return VisibilityPrivate, nil
+	}
+	return VisibilityPublic, nil
+}
+
+// dockerHubTagsResponse is a page of tags from the Docker Hub API
+type dockerHubTagsResponse struct {
+	Next    string `json:"next"`
+	Results []struct {
+		Name        string    `json:"name"`
+		LastUpdated time.Time `json:"last_updated"`
+	} `json:"results"`
+}
+
+// ListTags lists the tags of a repository. Pruning deletes based on the
+// listing, so it always asks the API instead of the cache.
+func (d *dockerHub) ListTags(namespace, name string) ([]Tag, error) {
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/%s/tags/?page_size=100", namespace, name)
+
+	var tags []Tag
+	for url != "" {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Docker Hub request: %w", err)
+		}
+		if err := d.authorize(req); err != nil {
+			return nil, err
+		}
+
+		var page dockerHubTagsResponse
+		if err := getJSON(d.http, "Docker Hub", req, &page); err != nil {
+			var statusErr *statusError
+			if errors.As(err, &statusErr) {
+				switch statusErr.code {
+				case http.StatusNotFound:
+					return nil, ErrRepositoryNotFound
+				case http.StatusTooManyRequests:
+					return nil, &RateLimitError{API: "Docker Hub"}
+				}
+			}
+			return nil, err
+		}
+		for _, result := range page.Results {
+			tags = append(tags, Tag{Name: result.Name, LastUpdated: result.LastUpdated})
+		}
+		url = page.Next
+	}
+	return tags, nil
+}
+
+// DeleteTag deletes a tag of a repository. The images only the tag
+// referenced are garbage collected by Docker Hub.
+func (d *dockerHub) DeleteTag(namespace, name, tag string) error {
+	url := fmt.Sprintf("https://hub.docker.com/v2/repositories/%s/%s/tags/%s/", namespace, name, tag)
+
+	if d.creds.Username == "" || d.creds.Password == "" {
+		return fmt.Errorf("deleting tags on Docker Hub needs credentials. Run 'devdrop login' first")
+	}
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Docker Hub request: %w", err)
+	}
+	if err := d.authorize(req); err != nil {
+		return err
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query Docker Hub API: %w", err)
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("Docker Hub refused to delete %s/%s:%s. Personal access tokens need the Read, Write, Delete scope", namespace, name, tag)
+	case http.StatusTooManyRequests:
+		return &RateLimitError{API: "Docker Hub"}
+	}
+	return &statusError{api: "Docker Hub", code: resp.StatusCode}
+}
+
+// authorize adds the JWT of the stored credentials to a Docker Hub API
+// request, logging in on first use. Without credentials only public
+// repositories are visible.
+func (d *dockerHub) authorize(req *http.Request) error {
+	if d.creds.Username == "" || d.creds.Password == "" {
+		return nil
+	}
+	if d.token == "" && strings.Count(d.creds.Password, ".") == 2 {
+		// 'devdrop login --web' stores the access token, which is a JWT
+		// the API accepts as is
+		d.token = d.creds.Password
+	}
+	if d.token == "" {
+		token, err := d.login()
+		if err != nil {
+			return err
+		}
+		d.token = token
+	}
+	req.Header.Set("Authorization", "Bearer "+d.token)
+	return nil
+}
+
+// login exchanges the stored credentials for a Docker Hub JWT
+func (d *dockerHub) login() (string, error) {
+	body, err := json.Marshal(map[string]string{
+		"username": d.creds.Username,
+		"password": d.creds.Password,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create Docker Hub login request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, "https://hub.docker.com/v2/users/login", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Docker Hub login request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var loginResp struct {
+		Token string `json:"token"`
+	}
+	if err := getJSON(d.http, "Docker Hub login", req, &loginResp); err != nil {
+		var statusErr *statusError
+		if errors.As(err, &statusErr) {
+			switch statusErr.code {
+			case http.StatusUnauthorized:
+				return "", fmt.Errorf("Docker Hub rejected the stored credentials for '%s'. Run 'devdrop login' again; accounts with two-factor authentication need a personal access token", d.creds.Username)
+			case http.StatusTooManyRequests:
+				return "", &RateLimitError{API: "Docker Hub"}
+			}
+		}
+		return "", err
+	}
+	if loginResp.Token == "" {
+		return "", fmt.Errorf("Docker Hub login returned no token")
+	}
+	return loginResp.Token, nil
+}
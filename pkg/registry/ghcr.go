@@ -0,0 +1,56 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ghcr lists container packages through the GitHub REST API. The password
+// stored at login must be a personal access token with read:packages.
+type ghcr struct {
+	http  *http.Client
+	creds Credentials
+}
+
+type githubPackage struct {
+	Name string `json:"name"`
+}
+
+func (g *ghcr) ListDevDropRepositories(namespace string) ([]string, error) {
+	if g.creds.Password == "" {
+		return nil, fmt.Errorf("listing GitHub packages requires a token. Run 'devdrop login --registry ghcr.io' with a personal access token")
+	}
+
+	// The namespace may be a user or an organization
+	packages, err := g.list(fmt.Sprintf("https://api.github.com/users/%s/packages?package_type=container&per_page=100", namespace))
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+		packages, err = g.list(fmt.Sprintf("https://api.github.com/orgs/%s/packages?package_type=container&per_page=100", namespace))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(packages))
+	for _, pkg := range packages {
+		names = append(names, pkg.Name)
+	}
+
+	return filterDevDrop(names), nil
+}
+
+func (g *ghcr) list(url string) ([]githubPackage, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GitHub request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+g.creds.Password)
+
+	var packages []githubPackage
+	if err := getJSON(g.http, "GitHub", req, &packages); err != nil {
+		return nil, err
+	}
+	return packages, nil
+}
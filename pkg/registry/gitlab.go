@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// gitLab lists container repositories of a group through the GitLab API.
+// Personal namespaces aren't groups; their repositories are looked up in
+// the user's projects instead. The API lives on the instance host, e.g.
+// registry.gitlab.com -> gitlab.com.
+type gitLab struct {
+	http  *http.Client
+	host  string
+	creds Credentials
+}
+
+type gitLabRepository struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+type gitLabProject struct {
+	ID   int    `json:"id"`
+	Path string `json:"path"`
+}
+
+func (g *gitLab) ListDevDropRepositories(namespace string) ([]string, error) {
+	var repos []gitLabRepository
+	err := g.get(fmt.Sprintf("/groups/%s/registry/repositories?per_page=100", url.PathEscape(namespace)), &repos)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound {
+		repos, err = g.listUserRepositories(namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		paths = append(paths, repo.Path)
+	}
+
+	return filterDevDrop(paths), nil
+}
+
+// listUserRepositories lists the repositories of the projects of a user
+// that are named like environments, e.g. alice/devdrop-go
+func (g *gitLab) listUserRepositories(username string) ([]gitLabRepository, error) {
+	var projects []gitLabProject
+	if err := g.get(fmt.Sprintf("/users/%s/projects?search=devdrop-&per_page=100", url.PathEscape(username)), &projects); err != nil {
+		return nil, err
+	}
+
+	var repos []gitLabRepository
+	for _, project := range projects {
+		if !strings.HasPrefix(project.Path, "devdrop-") {
+			continue
+		}
+		var projectRepos []gitLabRepository
+		if err := g.get(fmt.Sprintf("/projects/%d/registry/repositories?per_page=100", project.ID), &projectRepos); err != nil {
+			return nil, err
+		}
+		repos = append(repos, projectRepos...)
+	}
+	return repos, nil
+}
+
+// get requests a path of the GitLab API
+func (g *gitLab) get(path string, v interface{}) error {
+	apiHost := strings.TrimPrefix(g.host, "registry.")
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("https://%s/api/v4%s", apiHost, path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create GitLab request: %w", err)
+	}
+	if g.creds.Password != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.creds.Password)
+	}
+	return getJSON(g.http, "GitLab", req, v)
+}
@@ -0,0 +1,43 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// harbor lists repositories of a project through the Harbor v2 API
+type harbor struct {
+	http  *http.Client
+	host  string
+	creds Credentials
+}
+
+type harborRepository struct {
+	Name string `json:"name"`
+}
+
+func (h *harbor) ListDevDropRepositories(namespace string) ([]string, error) {
+	endpoint := fmt.Sprintf("https://%s/api/v2.0/projects/%s/repositories?page_size=100",
+		h.host, url.PathEscape(namespace))
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Harbor request: %w", err)
+	}
+	if h.creds.Username != "" {
+		req.SetBasicAuth(h.creds.Username, h.creds.Password)
+	}
+
+	var repos []harborRepository
+	if err := getJSON(h.http, "Harbor", req, &repos); err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		paths = append(paths, repo.Name)
+	}
+
+	return filterDevDrop(paths), nil
+}
@@ -0,0 +1,177 @@
+package registry
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrImageNotFound is returned for tags that don't exist in a repository or
+// aren't visible with the available credentials
+var ErrImageNotFound = errors.New("image not found in the registry")
+
+// Manifest media types InspectImage understands
+const (
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	ociIndexMediaType       = "application/vnd.oci.image.index.v1+json"
+)
+
+// RemoteImage is a pushed image, identified by the layers it is made of
+type RemoteImage struct {
+	// Digest is the digest of the tag's manifest (or manifest list), as
+	// recorded in the RepoDigests of images pulled or pushed with it
+	Digest string
+	// DiffIDs are the digests of the uncompressed layers, oldest first,
+	// the same as the RootFS layers of the image in the daemon
+	DiffIDs []string
+}
+
+type imageManifest struct {
+	MediaType string `json:"mediaType"`
+	Config    struct {
+		Digest string `json:"digest"`
+	} `json:"config"`
+	Manifests []manifestListEntry `json:"manifests"`
+}
+
+type imageConfig struct {
+	RootFS struct {
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+}
+
+// InspectImage reads the layers of repository:tag (e.g. "alice/devdrop-go"
+// and "latest") from the registry's distribution API without pulling it. For
+// multi-arch tags the image for platform (os/arch[/variant]) is read.
+func InspectImage(host string, creds Credentials, repository, tag, platform string) (RemoteImage, error) {
+	r := &distribution{
+		http:       &http.Client{Timeout: 30 * time.Second},
+		host:       NormalizeHost(host),
+		repository: repository,
+		creds:      creds,
+	}
+
+	var manifest imageManifest
+	digest, err := r.getJSON("manifests/"+tag, &manifest)
+	if err != nil {
+		return RemoteImage{}, err
+	}
+	image := RemoteImage{Digest: digest}
+
+	if len(manifest.Manifests) > 0 {
+		entry, ok := matchPlatform(manifest.Manifests, platform)
+		if !ok {
+			return RemoteImage{}, fmt.Errorf("%s:%s has no image for %s", repository, tag, platform)
+		}
+		manifest = imageManifest{}
+		if _, err := r.getJSON("manifests/"+entry.Digest, &manifest); err != nil {
+			return RemoteImage{}, err
+		}
+	}
+	if manifest.Config.Digest == "" {
+		return RemoteImage{}, fmt.Errorf("%s:%s has an unsupported manifest format", repository, tag)
+	}
+
+	var config imageConfig
+	if _, err := r.getJSON("blobs/"+manifest.Config.Digest, &config); err != nil {
+		return RemoteImage{}, err
+	}
+	image.DiffIDs = config.RootFS.DiffIDs
+	return image, nil
+}
+
+// matchPlatform picks the entry of a manifest list for platform
+func matchPlatform(entries []manifestListEntry, platform string) (manifestListEntry, bool) {
+	parts := strings.SplitN(platform, "/", 3)
+	for _, entry := range entries {
+		if len(parts) < 2 || entry.Platform.OS != parts[0] || entry.Platform.Architecture != parts[1] {
+			continue
+		}
+		if len(parts) == 3 && entry.Platform.Variant != "" && entry.Platform.Variant != parts[2] {
+			continue
+		}
+		return entry, true
+	}
+	return manifestListEntry{}, false
+}
+
+// distribution reads from a repository through the distribution API,
+// answering the registry's Bearer challenge on first use
+type distribution struct {
+	http       *http.Client
+	host       string
+	repository string
+	creds      Credentials
+	token      string
+}
+
+// getJSON fetches path under the repository into v and returns the digest
+// of the response
+func (r *distribution) getJSON(path string, v interface{}) (string, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/%s/%s", apiHost(r.host), r.repository, path)
+
+	resp, err := r.get(endpoint)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && r.token == "" {
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(challenge, "Bearer ") {
+			return "", fmt.Errorf("registry %s denied access to %s", r.host, r.repository)
+		}
+		if r.token, err = bearerToken(r.http, r.host, challenge, fmt.Sprintf("repository:%s:pull", r.repository), r.creds); err != nil {
+			return "", err
+		}
+		if resp, err = r.get(endpoint); err != nil {
+			return "", err
+		}
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusUnauthorized:
+		// Docker Hub denies access to repositories that don't exist
+		return "", ErrImageNotFound
+	default:
+		return "", &statusError{api: "registry", code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %w", err)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return "", fmt.Errorf("failed to parse registry response: %w", err)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(body)), nil
+}
+
+func (r *distribution) get(endpoint string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry request: %w", err)
+	}
+	req.Header.Set("Accept", strings.Join([]string{dockerManifestMediaType, manifestListMediaType, ociManifestMediaType, ociIndexMediaType}, ", "))
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	} else if r.creds.Username != "" {
+		req.SetBasicAuth(r.creds.Username, r.creds.Password)
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query registry %s: %w", r.host, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// manifestListMediaType is the Docker manifest list format, understood by
+// every registry and daemon that supports multi-arch images
+const manifestListMediaType = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+// ManifestEntry is one platform-specific image in a manifest list
+type ManifestEntry struct {
+	MediaType string
+	Digest    string
+	Size      int64
+	// Platform is os/arch[/variant], e.g. linux/arm64
+	Platform string
+}
+
+type manifestList struct {
+	SchemaVersion int                 `json:"schemaVersion"`
+	MediaType     string              `json:"mediaType"`
+	Manifests     []manifestListEntry `json:"manifests"`
+}
+
+type manifestListEntry struct {
+	MediaType string           `json:"mediaType"`
+	Digest    string           `json:"digest"`
+	Size      int64            `json:"size"`
+	Platform  manifestPlatform `json:"platform"`
+}
+
+type manifestPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// PushManifestList creates or replaces tag in the repository path (e.g.
+// "alice/devdrop-go") with a manifest list of the given platform images.
+// Pulling the tag then gives every machine the image for its own platform.
+// The daemon can't create manifest lists, so this talks to the registry's
+// distribution API directly.
+func PushManifestList(host string, creds Credentials, repository, tag string, entries []ManifestEntry) error {
+	list := manifestList{SchemaVersion: 2, MediaType: manifestListMediaType}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry.Platform, "/", 3)
+		if len(parts) < 2 {
+			return fmt.Errorf("invalid platform '%s'", entry.Platform)
+		}
+		platform := manifestPlatform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		list.Manifests = append(list.Manifests, manifestListEntry{
+			MediaType: entry.MediaType,
+			Digest:    entry.Digest,
+			Size:      entry.Size,
+			Platform:  platform,
+		})
+	}
+
+	body, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest list: %w", err)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	host = NormalizeHost(host)
+	endpoint := fmt.Sprintf("https://%s/v2/%s/manifests/%s", apiHost(host), repository, tag)
+
+	resp, err := putManifest(client, endpoint, body, "", creds)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		// Token-based registries answer with a Bearer challenge first
+		challenge := resp.Header.Get("Www-Authenticate")
+		resp.Body.Close()
+		if !strings.HasPrefix(challenge, "Bearer ") {
+			return fmt.Errorf("registry %s denied access to %s", host, repository)
+		}
+
+		token, err := bearerToken(client, host, challenge, fmt.Sprintf("repository:%s:pull,push", repository), creds)
+		if err != nil {
+			return err
+		}
+		if resp, err = putManifest(client, endpoint, body, token, creds); err != nil {
+			return err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to push manifest list %s:%s: registry returned status %d: %s", repository, tag, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+
+	return nil
+}
+
+func putManifest(client *http.Client, endpoint string, body []byte, token string, creds Credentials) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry request: %w", err)
+	}
+	req.Header.Set("Content-Type", manifestListMediaType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to push manifest list: %w", err)
+	}
+	return resp, nil
+}
+
+// apiHost returns the host serving the distribution API for a registry
+func apiHost(host string) string {
+	if IsDockerHub(host) {
+		return "registry-1.docker.io"
+	}
+	return host
+}
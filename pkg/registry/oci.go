@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// oci lists repositories through the OCI distribution catalog endpoint. Not
+// every registry enables it, and some only allow it for administrators.
+type oci struct {
+	http  *http.Client
+	host  string
+	creds Credentials
+}
+
+type catalogResponse struct {
+	Repositories []string `json:"repositories"`
+}
+
+func (o *oci) ListDevDropRepositories(namespace string) ([]string, error) {
+	endpoint := fmt.Sprintf("https://%s/v2/_catalog?n=1000", o.host)
+
+	catalog, err := o.catalog(endpoint, "")
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.code == http.StatusUnauthorized {
+		// Token-based registries answer with a Bearer challenge first
+		token, tokenErr := o.token(endpoint)
+		if tokenErr != nil {
+			return nil, tokenErr
+		}
+		catalog, err = o.catalog(endpoint, token)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, repo := range catalog.Repositories {
+		if strings.HasPrefix(repo, namespace+"/") {
+			paths = append(paths, repo)
+		}
+	}
+
+	return filterDevDrop(paths), nil
+}
+
+func (o *oci) catalog(endpoint, token string) (catalogResponse, error) {
+	var catalog catalogResponse
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return catalog, fmt.Errorf("failed to create registry request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if o.creds.Username != "" {
+		req.SetBasicAuth(o.creds.Username, o.creds.Password)
+	}
+
+	err = getJSON(o.http, "registry catalog", req, &catalog)
+	return catalog, err
+}
+
+// token answers the registry's Bearer challenge for catalog access
+func (o *oci) token(endpoint string) (string, error) {
+	resp, err := o.http.Get(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to query registry: %w", err)
+	}
+	resp.Body.Close()
+
+	challenge := resp.Header.Get("Www-Authenticate")
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return "", fmt.Errorf("registry %s denied catalog access", o.host)
+	}
+
+	return bearerToken(o.http, o.host, challenge, "registry:catalog:*", o.creds)
+}
+
+// bearerToken requests a token for scope from the realm named in a Bearer
+// WWW-Authenticate challenge
+func bearerToken(client *http.Client, host, challenge, scope string, creds Credentials) (string, error) {
+	params := parseChallenge(strings.TrimPrefix(challenge, "Bearer "))
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("registry %s returned an invalid auth challenge", host)
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create token request: %w", err)
+	}
+	if creds.Username != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := getJSON(client, "registry token", req, &tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+// parseChallenge parses the key="value" pairs of a WWW-Authenticate header
+func parseChallenge(challenge string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(challenge, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return params
+}
@@ -0,0 +1,269 @@
+// Package registry abstracts the container registries DevDrop stores
+// environment images in.
+//
+// Pushing and pulling go through the Docker daemon and work with any
+// registry. Listing the devdrop-* repositories a user owns has no standard
+// API, so each registry type provides its own Backend:
+// - Docker Hub (hub.docker.com API)
+// - GitHub Container Registry (GitHub packages API)
+// - GitLab (group registry repositories API)
+// - Harbor (project repositories API)
+// - Generic OCI registries (/v2/_catalog)
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DockerHub is the canonical host name used for Docker Hub
+const DockerHub = "docker.io"
+
+// dockerHubServerAddress is the server address Docker uses for Hub credentials
+const dockerHubServerAddress = "https://index.docker.io/v1/"
+
+// Registry types with a dedicated listing backend
+const (
+	TypeDockerHub = "dockerhub"
+	TypeGHCR      = "ghcr"
+	TypeGitLab    = "gitlab"
+	TypeHarbor    = "harbor"
+	TypeOCI       = "oci"
+)
+
+// Credentials holds the username and password (or token) for a registry
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Backend lists the devdrop-* repositories stored in a registry
+type Backend interface {
+	// ListDevDropRepositories returns the names of devdrop-* repositories
+	// under namespace (usually the username), sorted by name
+	ListDevDropRepositories(namespace string) ([]string, error)
+}
+
+// Repository visibilities reported by VisibilityChecker
+const (
+	VisibilityPublic  = "public"
+	VisibilityPrivate = "private"
+)
+
+// ErrRepositoryNotFound is returned for repositories that don't exist or
+// aren't visible with the available credentials
+var ErrRepositoryNotFound = errors.New("repository not found")
+
+// VisibilityChecker is implemented by backends that can tell whether a
+// repository is public or private
+type VisibilityChecker interface {
+	// RepositoryVisibility returns VisibilityPublic or VisibilityPrivate for
+	// namespace/name, or ErrRepositoryNotFound
+	RepositoryVisibility(namespace, name string) (string, error)
+}
+
+// Tag is a tag of a repository as listed by a TagManager
+type Tag struct {
+	Name        string
+	LastUpdated time.Time
+}
+
+// TagManager is implemented by backends that can list and delete the tags
+// of a repository, which pruning old versions needs
+type TagManager interface {
+	// ListTags returns all tags of namespace/name, or ErrRepositoryNotFound
+	ListTags(namespace, name string) ([]Tag, error)
+	// DeleteTag deletes a tag of namespace/name; deleting a tag that is
+	// already gone isn't an error
+	DeleteTag(namespace, name, tag string) error
+}
+
+// NormalizeHost returns the canonical host for a registry address. The empty
+// string and all Docker Hub aliases map to DockerHub.
+func NormalizeHost(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	host = strings.TrimSuffix(host, "/")
+	if i := strings.Index(host, "/"); i >= 0 {
+		host = host[:i]
+	}
+
+	switch host {
+	case "", "docker.io", "index.docker.io", "registry-1.docker.io", "hub.docker.com":
+		return DockerHub
+	}
+	return strings.ToLower(host)
+}
+
+// IsDockerHub reports whether host refers to Docker Hub
+func IsDockerHub(host string) bool {
+	return NormalizeHost(host) == DockerHub
+}
+
+// ServerAddress returns the address Docker expects in auth configs for host
+func ServerAddress(host string) string {
+	if IsDockerHub(host) {
+		return dockerHubServerAddress
+	}
+	return NormalizeHost(host)
+}
+
+// Repository returns the image repository for name under namespace in host.
+// Docker Hub repositories are written without the host for readability.
+func Repository(host, namespace, name string) string {
+	if IsDockerHub(host) {
+		return fmt.Sprintf("%s/%s", namespace, name)
+	}
+	return fmt.Sprintf("%s/%s/%s", NormalizeHost(host), namespace, name)
+}
+
+// DetectType guesses the registry type from its host
+func DetectType(host string) string {
+	host = NormalizeHost(host)
+	switch {
+	case host == DockerHub:
+		return TypeDockerHub
+	case host == "ghcr.io":
+		return TypeGHCR
+	case host == "registry.gitlab.com" || strings.HasPrefix(host, "gitlab."):
+		return TypeGitLab
+	case strings.Contains(host, "harbor"):
+		return TypeHarbor
+	}
+	return TypeOCI
+}
+
+// ValidateType returns an error if typ is not a known registry type
+func ValidateType(typ string) error {
+	switch typ {
+	case "", TypeDockerHub, TypeGHCR, TypeGitLab, TypeHarbor, TypeOCI:
+		return nil
+	}
+	return fmt.Errorf("unknown registry type '%s'. Available options: %s, %s, %s, %s, %s",
+		typ, TypeDockerHub, TypeGHCR, TypeGitLab, TypeHarbor, TypeOCI)
+}
+
+// New returns the listing backend for a registry. An empty typ is detected
+// from the host.
+func New(host, typ string, creds Credentials) (Backend, error) {
+	host = NormalizeHost(host)
+	if typ == "" {
+		typ = DetectType(host)
+	}
+
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	switch typ {
+	case TypeDockerHub:
+		return &dockerHub{http: httpClient, creds: creds}, nil
+	case TypeGHCR:
+		return &ghcr{http: httpClient, creds: creds}, nil
+	case TypeGitLab:
+		return &gitLab{http: httpClient, host: host, creds: creds}, nil
+	case TypeHarbor:
+		return &harbor{http: httpClient, host: host, creds: creds}, nil
+	case TypeOCI:
+		return &oci{http: httpClient, host: host, creds: creds}, nil
+	}
+	return nil, ValidateType(typ)
+}
+
+// EncodeAuth creates the base64-encoded auth config Docker expects in
+// X-Registry-Auth headers for push and pull operations
+func EncodeAuth(host string, creds Credentials) (string, error) {
+	authConfig := map[string]string{
+		"username":      creds.Username,
+		"password":      creds.Password,
+		"serveraddress": ServerAddress(host),
+	}
+
+	authConfigJSON, err := json.Marshal(authConfig)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal auth config: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(authConfigJSON), nil
+}
+
+// DecodeAuth extracts the credentials from a token created by EncodeAuth
+func DecodeAuth(token string) (Credentials, error) {
+	if token == "" {
+		return Credentials{}, nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(token)
+	if err != nil {
+		// Docker also accepts URL-safe encoding
+		data, err = base64.URLEncoding.DecodeString(token)
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to decode auth token: %w", err)
+		}
+	}
+
+	var authConfig struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if err := json.Unmarshal(data, &authConfig); err != nil {
+		return Credentials{}, fmt.Errorf("failed to parse auth token: %w", err)
+	}
+
+	return Credentials{Username: authConfig.Username, Password: authConfig.Password}, nil
+}
+
+// filterDevDrop keeps the repositories whose last path component starts with
+// devdrop- and returns those components
+func filterDevDrop(paths []string) []string {
+	var names []string
+	for _, path := range paths {
+		name := path[strings.LastIndex(path, "/")+1:]
+		if strings.HasPrefix(name, "devdrop-") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// statusError describes an unexpected HTTP status from a registry API
+type statusError struct {
+	api  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s API returned status %d", e.api, e.code)
+}
+
+// getJSON performs req and decodes a successful JSON response into v
+func getJSON(client *http.Client, api string, req *http.Request, v interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query %s API: %w", api, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &statusError{api: api, code: resp.StatusCode}
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", api, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,269 @@
+// Package scan finds known vulnerabilities in environment images.
+//
+// The scanning is done by Trivy or Grype, whichever is installed (or the
+// one the config asks for): the image is read from the local Docker
+// daemon and the JSON report of the scanner is turned into a Report that
+// doesn't depend on which one ran.
+package scan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// Supported scanners
+const (
+	Trivy = "trivy"
+	Grype = "grype"
+)
+
+// Severities, most severe first
+const (
+	Critical = "CRITICAL"
+	High     = "HIGH"
+	Medium   = "MEDIUM"
+	Low      = "LOW"
+	Unknown  = "UNKNOWN"
+)
+
+// Severities lists the severities from most to least severe
+var Severities = []string{Critical, High, Medium, Low, Unknown}
+
+// Vulnerability is a known vulnerability of an installed package
+type Vulnerability struct {
+	ID        string `json:"id" yaml:"id"`
+	Severity  string `json:"severity" yaml:"severity"`
+	Package   string `json:"package" yaml:"package"`
+	Installed string `json:"installed" yaml:"installed"`
+	// FixedIn is the version that fixes it, empty when there is no fix yet
+	FixedIn string `json:"fixed_in,omitempty" yaml:"fixed_in,omitempty"`
+	Title   string `json:"title,omitempty" yaml:"title,omitempty"`
+}
+
+// Report is the result of scanning an image
+type Report struct {
+	Image           string          `json:"image" yaml:"image"`
+	Scanner         string          `json:"scanner" yaml:"scanner"`
+	Vulnerabilities []Vulnerability `json:"vulnerabilities" yaml:"vulnerabilities"`
+}
+
+// Counts returns the number of vulnerabilities of each severity
+func (r Report) Counts() map[string]int {
+	counts := make(map[string]int, len(Severities))
+	for _, v := range r.Vulnerabilities {
+		counts[v.Severity]++
+	}
+	return counts
+}
+
+// Summary describes the counts by severity, e.g. "1 critical, 4 high"
+func (r Report) Summary() string {
+	if len(r.Vulnerabilities) == 0 {
+		return "no known vulnerabilities"
+	}
+	counts := r.Counts()
+	var parts []string
+	for _, severity := range Severities {
+		if counts[severity] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[severity], strings.ToLower(severity)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// AtLeast returns the vulnerabilities of severity or worse
+func (r Report) AtLeast(severity string) []Vulnerability {
+	var result []Vulnerability
+	for _, v := range r.Vulnerabilities {
+		if rank(v.Severity) <= rank(severity) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// ParseSeverity validates a severity given in any case
+func ParseSeverity(s string) (string, error) {
+	severity := strings.ToUpper(s)
+	if rank(severity) == len(Severities) {
+		return "", fmt.Errorf("unknown severity '%s'. Available options: critical, high, medium, low, unknown", s)
+	}
+	return severity, nil
+}
+
+// rank orders severities, 0 being the most severe
+func rank(severity string) int {
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return len(Severities)
+}
+
+// Scanner runs an installed vulnerability scanner
+type Scanner struct {
+	// Name is Trivy or Grype
+	Name string
+	path string
+}
+
+// Find looks up the scanner to use: preferred when it isn't empty,
+// otherwise Trivy and then Grype, whichever is installed first
+func Find(preferred string) (*Scanner, error) {
+	candidates := []string{Trivy, Grype}
+	switch preferred {
+	case "":
+	case Trivy, Grype:
+		candidates = []string{preferred}
+	default:
+		return nil, fmt.Errorf("unknown scanner '%s'. Available options: %s, %s", preferred, Trivy, Grype)
+	}
+
+	for _, name := range candidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return &Scanner{Name: name, path: path}, nil
+		}
+	}
+	if preferred != "" {
+		return nil, fmt.Errorf("%s not found in PATH", preferred)
+	}
+	return nil, fmt.Errorf("no vulnerability scanner found; install Trivy (https://trivy.dev) or Grype (https://github.com/anchore/grype)")
+}
+
+// Scan scans an image in the local Docker daemon. Vulnerabilities are
+// sorted by severity, then package and ID.
+func (s *Scanner) Scan(image string) (Report, error) {
+	var args []string
+	switch s.Name {
+	case Trivy:
+		args = []string{"image", "--quiet", "--format", "json", image}
+	case Grype:
+		args = []string{"docker:" + image, "--quiet", "--output", "json"}
+	}
+
+	cmd := exec.Command(s.path, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return Report{}, fmt.Errorf("%s failed to scan %s: %s", s.Name, image, msg)
+		}
+		return Report{}, fmt.Errorf("%s failed to scan %s: %w", s.Name, image, err)
+	}
+
+	var vulnerabilities []Vulnerability
+	var err error
+	switch s.Name {
+	case Trivy:
+		vulnerabilities, err = parseTrivy(stdout.Bytes())
+	case Grype:
+		vulnerabilities, err = parseGrype(stdout.Bytes())
+	}
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to parse %s report: %w", s.Name, err)
+	}
+
+	sort.SliceStable(vulnerabilities, func(i, j int) bool {
+		a, b := vulnerabilities[i], vulnerabilities[j]
+		if rank(a.Severity) != rank(b.Severity) {
+			return rank(a.Severity) < rank(b.Severity)
+		}
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		return a.ID < b.ID
+	})
+	return Report{Image: image, Scanner: s.Name, Vulnerabilities: vulnerabilities}, nil
+}
+
+// trivyReport is the part of Trivy's JSON report a Report needs
+type trivyReport struct {
+	Results []struct {
+		Vulnerabilities []struct {
+			VulnerabilityID  string
+			PkgName          string
+			InstalledVersion string
+			FixedVersion     string
+			Severity         string
+			Title            string
+		}
+	}
+}
+
+func parseTrivy(data []byte) ([]Vulnerability, error) {
+	var report trivyReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var result []Vulnerability
+	for _, r := range report.Results {
+		for _, v := range r.Vulnerabilities {
+			result = append(result, Vulnerability{
+				ID:        v.VulnerabilityID,
+				Severity:  normalizeSeverity(v.Severity),
+				Package:   v.PkgName,
+				Installed: v.InstalledVersion,
+				FixedIn:   v.FixedVersion,
+				Title:     v.Title,
+			})
+		}
+	}
+	return result, nil
+}
+
+// grypeReport is the part of Grype's JSON report a Report needs
+type grypeReport struct {
+	Matches []struct {
+		Vulnerability struct {
+			ID          string `json:"id"`
+			Severity    string `json:"severity"`
+			Description string `json:"description"`
+			Fix         struct {
+				Versions []string `json:"versions"`
+			} `json:"fix"`
+		} `json:"vulnerability"`
+		Artifact struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"artifact"`
+	} `json:"matches"`
+}
+
+func parseGrype(data []byte) ([]Vulnerability, error) {
+	var report grypeReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	var result []Vulnerability
+	for _, m := range report.Matches {
+		title, _, _ := strings.Cut(m.Vulnerability.Description, "\n")
+		result = append(result, Vulnerability{
+			ID:        m.Vulnerability.ID,
+			Severity:  normalizeSeverity(m.Vulnerability.Severity),
+			Package:   m.Artifact.Name,
+			Installed: m.Artifact.Version,
+			FixedIn:   strings.Join(m.Vulnerability.Fix.Versions, ", "),
+			Title:     title,
+		})
+	}
+	return result, nil
+}
+
+// normalizeSeverity maps the severities of both scanners onto Severities;
+// Grype's Negligible counts as low
+func normalizeSeverity(severity string) string {
+	severity = strings.ToUpper(severity)
+	if severity == "NEGLIGIBLE" {
+		return Low
+	}
+	if rank(severity) == len(Severities) {
+		return Unknown
+	}
+	return severity
+}
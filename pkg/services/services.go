@@ -0,0 +1,71 @@
+// Package services describes the sidecar services of environments.
+//
+// Services are containers such as postgres or redis that 'devdrop run'
+// starts next to a session, docker-compose style, on a network of their
+// own. The session reaches each one under its service name, e.g.
+// postgres:5432, and they are torn down again when the session ends.
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Service is a sidecar container started with every session
+type Service struct {
+	Image string `yaml:"image" json:"image"`
+	// Command replaces the image's command when set
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+	// Env holds variables set in the service container
+	Env map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	// Ports of the service reachable from the host, written like the
+	// environment's own ports
+	Ports []string `yaml:"ports,omitempty" json:"ports,omitempty"`
+	// Volumes are named volumes of the environment kept across sessions,
+	// as name:dst[:ro], e.g. for a database's data directory
+	Volumes []string `yaml:"volumes,omitempty" json:"volumes,omitempty"`
+}
+
+// Services are the services of an environment, by name. The name is the
+// host name the session reaches the service under.
+type Services map[string]Service
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// Names returns the service names in sorted order, the order they start in
+func (s Services) Names() []string {
+	names := make([]string, 0, len(s))
+	for name := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that every service has a usable name and an image
+func (s Services) Validate() error {
+	for _, name := range s.Names() {
+		if !namePattern.MatchString(name) {
+			return fmt.Errorf("service name '%s' must be lowercase letters, digits and '-', as it is used as a host name", name)
+		}
+		if s[name].Image == "" {
+			return fmt.Errorf("service '%s' has no image", name)
+		}
+	}
+	return nil
+}
+
+// EnvList returns the service's variables as sorted KEY=VALUE pairs
+func (s Service) EnvList() []string {
+	keys := make([]string, 0, len(s.Env))
+	for key := range s.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	env := make([]string, 0, len(keys))
+	for _, key := range keys {
+		env = append(env, key+"="+s.Env[key])
+	}
+	return env
+}
@@ -0,0 +1,12 @@
+// Package shell builds command lines for the POSIX shells DevDrop runs in
+// containers and prints for the host, such as /bin/sh scripts and export
+// lines.
+package shell
+
+import "strings"
+
+// Quote quotes s as a single word for POSIX shells. Everything is put in
+// single quotes, so nothing in s is expanded.
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,171 @@
+// Package signing signs environment images and verifies their signatures
+// with cosign.
+//
+// Signatures are stored in the registry next to the image, the way cosign
+// stores them, so everyone pulling a shared environment can check it was
+// signed with the team's key before running it. Images are always signed
+// and verified by digest: a pull fetches exactly the manifest whose
+// signature was checked. The cosign binary does the signing and checking;
+// it authenticates to the registry with the credentials DevDrop stores,
+// handed over in a temporary Docker config.
+package signing
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/registry"
+)
+
+// ErrCosignNotFound is returned when signing or verification is configured
+// but the cosign binary isn't installed
+var ErrCosignNotFound = errors.New("cosign not found in PATH; install it from https://docs.sigstore.dev/cosign/system_config/installation/ or turn signing off in the config")
+
+// ErrUnverified is returned when an image has no valid signature for the key
+var ErrUnverified = errors.New("image signature could not be verified")
+
+// Cosign signs and verifies the images of one registry with one key
+type Cosign struct {
+	// Key is a cosign key reference: a key file, or a KMS URI such as
+	// awskms://... or gcpkms://...; a public key is enough to verify
+	Key string
+	// Host and Creds are the registry the images are in and its login
+	Host  string
+	Creds registry.Credentials
+	// Output receives cosign's messages, e.g. its password prompt; nil
+	// discards them
+	Output io.Writer
+}
+
+// SignImage signs the manifest a pushed image points to and returns the
+// image by digest
+func (c *Cosign) SignImage(client *docker.Client, imageName, authToken string) (string, error) {
+	ref, err := digestRef(client, imageName, authToken)
+	if err != nil {
+		return "", err
+	}
+	if _, err := c.run(true, "sign", "--yes", "--key", c.Key, ref); err != nil {
+		return "", fmt.Errorf("failed to sign %s: %w", ref, err)
+	}
+	return ref, nil
+}
+
+// VerifyImage looks up the manifest an image points to in the registry and
+// verifies its signature. It returns the image by digest, to pull exactly
+// what was verified.
+func (c *Cosign) VerifyImage(client *docker.Client, imageName, authToken string) (string, error) {
+	ref, err := digestRef(client, imageName, authToken)
+	if err != nil {
+		return "", err
+	}
+	output, err := c.run(false, "verify", "--key", c.Key, ref)
+	if err != nil {
+		if errors.Is(err, ErrCosignNotFound) {
+			return "", err
+		}
+		return "", fmt.Errorf("%w: %s (%s)", ErrUnverified, imageName, lastLine(output))
+	}
+	return ref, nil
+}
+
+// digestRef returns repository@digest for the manifest imageName points to
+func digestRef(client *docker.Client, imageName, authToken string) (string, error) {
+	manifest, err := client.RemoteManifest(imageName, authToken)
+	if err != nil {
+		return "", err
+	}
+	return Repository(imageName) + "@" + manifest.Digest, nil
+}
+
+// Repository strips the tag or digest from an image reference
+func Repository(imageName string) string {
+	if i := strings.Index(imageName, "@"); i >= 0 {
+		return imageName[:i]
+	}
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName[:i]
+	}
+	return imageName
+}
+
+// run runs cosign with the stored registry login. Interactive runs pass the
+// terminal through for key password prompts; the output of the others is
+// returned.
+func (c *Cosign) run(interactive bool, args ...string) (string, error) {
+	path, err := exec.LookPath("cosign")
+	if err != nil {
+		return "", ErrCosignNotFound
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Env = os.Environ()
+	if c.Creds.Username != "" {
+		dir, err := dockerConfig(c.Host, c.Creds)
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(dir)
+		cmd.Env = append(cmd.Env, "DOCKER_CONFIG="+dir)
+	}
+
+	out := c.Output
+	if out == nil {
+		out = io.Discard
+	}
+	var output bytes.Buffer
+	if interactive {
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = out
+		cmd.Stderr = out
+	} else {
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+	}
+	err = cmd.Run()
+	return output.String(), err
+}
+
+// dockerConfig writes a Docker config holding only the login for host to a
+// private temporary directory, so cosign can reach the registry without the
+// credentials ending up on its command line
+func dockerConfig(host string, creds registry.Credentials) (string, error) {
+	dir, err := os.MkdirTemp("", "devdrop-cosign-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create registry login for cosign: %w", err)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			registry.ServerAddress(host): map[string]string{
+				"auth": base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password)),
+			},
+		},
+	})
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to create registry login for cosign: %w", err)
+	}
+	return dir, nil
+}
+
+// lastLine returns the last non-empty line of cosign's output, which holds
+// the reason a verification failed
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	line := strings.TrimSpace(lines[len(lines)-1])
+	if line == "" {
+		return "cosign gave no reason"
+	}
+	return strings.TrimPrefix(line, "Error: ")
+}
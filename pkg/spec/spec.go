@@ -0,0 +1,307 @@
+// Package spec handles declarative environment specs (devdrop.yaml).
+//
+// A spec describes how to build an environment image from a base image,
+// packages, environment variables and setup commands, and how to run it
+// (published ports, extra mounts, lifecycle hooks and sidecar services), as
+// a reproducible alternative to the interactive init/commit workflow.
+// Variants expand one spec into several environments, e.g. one per tool
+// version or platform, built from the same generated Dockerfile so they
+// share cached layers.
+package spec
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/services"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the spec file looked up in the project directory
+const FileName = "devdrop.yaml"
+
+// Spec is the content of a devdrop.yaml file
+type Spec struct {
+	Name      string `yaml:"name"`
+	BaseImage string `yaml:"base_image"`
+	// Args are build arguments available to base_image and run as ${NAME}
+	Args map[string]string `yaml:"args,omitempty"`
+	// Packages are installed with the base image's package manager
+	// (apt-get, apk, dnf or yum)
+	Packages []string          `yaml:"packages,omitempty"`
+	Env      map[string]string `yaml:"env,omitempty"`
+	Run      []string          `yaml:"run,omitempty"`
+	// Ports are published on every run, in docker run -p format
+	Ports []string `yaml:"ports,omitempty"`
+	// Mounts are bind mounted on every run, as src:dst[:ro]
+	Mounts []string `yaml:"mounts,omitempty"`
+	// Volumes are named volumes kept across runs, as name:dst[:ro]
+	Volumes []string `yaml:"volumes,omitempty"`
+	// Hooks run before and after sessions and before commits; host hooks
+	// run next to the spec unless they set a dir
+	Hooks hooks.Hooks `yaml:"hooks,omitempty"`
+	// Services are sidecar containers started with every run
+	Services services.Services `yaml:"services,omitempty"`
+	Variants []Variant         `yaml:"variants,omitempty"`
+}
+
+// Variant overrides build arguments or the platform for one environment of
+// a build matrix
+type Variant struct {
+	Name     string            `yaml:"name"`
+	Args     map[string]string `yaml:"args,omitempty"`
+	Platform string            `yaml:"platform,omitempty"`
+}
+
+// Target is a single environment to build from a spec
+type Target struct {
+	// Environment is the environment name without the devdrop- prefix
+	Environment string
+	Variant     string
+	BuildArgs   map[string]string
+	Platform    string
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9]+([._-][a-z0-9]+)*$`)
+
+// Load reads and validates a spec file
+func Load(path string) (*Spec, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec file: %w", err)
+	}
+
+	var spec Spec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", filepath.Base(path), err)
+	}
+
+	return &spec, nil
+}
+
+// Validate checks that the spec can be built
+func (s *Spec) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !namePattern.MatchString(strings.TrimPrefix(s.Name, "devdrop-")) {
+		return fmt.Errorf("name '%s' must be lowercase letters, digits, '.', '_' or '-'", s.Name)
+	}
+	if s.BaseImage == "" {
+		return fmt.Errorf("base_image is required")
+	}
+
+	for _, mount := range s.Mounts {
+		if _, _, _, err := ParseMount(mount); err != nil {
+			return err
+		}
+	}
+	for _, volume := range s.Volumes {
+		if _, _, _, err := ParseVolume(volume); err != nil {
+			return err
+		}
+	}
+
+	if err := s.Hooks.Validate(); err != nil {
+		return err
+	}
+	if err := s.Services.Validate(); err != nil {
+		return err
+	}
+	for _, name := range s.Services.Names() {
+		for _, volume := range s.Services[name].Volumes {
+			if _, _, _, err := ParseVolume(volume); err != nil {
+				return fmt.Errorf("service '%s': %w", name, err)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	for i, variant := range s.Variants {
+		if variant.Name == "" {
+			return fmt.Errorf("variant %d has no name", i+1)
+		}
+		if !namePattern.MatchString(variant.Name) {
+			return fmt.Errorf("variant name '%s' must be lowercase letters, digits, '.', '_' or '-'", variant.Name)
+		}
+		if seen[variant.Name] {
+			return fmt.Errorf("duplicate variant '%s'", variant.Name)
+		}
+		seen[variant.Name] = true
+	}
+
+	return nil
+}
+
+// Targets expands the spec into the environments to build: one per variant,
+// named <name>-<variant>, or a single environment without variants
+func (s *Spec) Targets() []Target {
+	name := strings.TrimPrefix(s.Name, "devdrop-")
+	if len(s.Variants) == 0 {
+		return []Target{{Environment: name, BuildArgs: s.Args}}
+	}
+
+	targets := make([]Target, 0, len(s.Variants))
+	for _, variant := range s.Variants {
+		args := make(map[string]string, len(s.Args)+len(variant.Args))
+		for k, v := range s.Args {
+			args[k] = v
+		}
+		for k, v := range variant.Args {
+			args[k] = v
+		}
+		targets = append(targets, Target{
+			Environment: name + "-" + variant.Name,
+			Variant:     variant.Name,
+			BuildArgs:   args,
+			Platform:    variant.Platform,
+		})
+	}
+	return targets
+}
+
+// Dockerfile generates the Dockerfile shared by all targets. Build arguments
+// are declared before FROM so the base image can depend on them, and again
+// after it so run commands can use them.
+func (s *Spec) Dockerfile() string {
+	var b strings.Builder
+
+	args := s.argNames()
+	for _, name := range args {
+		fmt.Fprintf(&b, "ARG %s\n", name)
+	}
+	fmt.Fprintf(&b, "FROM %s\n", s.BaseImage)
+	for _, name := range args {
+		fmt.Fprintf(&b, "ARG %s\n", name)
+	}
+
+	envNames := make([]string, 0, len(s.Env))
+	for name := range s.Env {
+		envNames = append(envNames, name)
+	}
+	sort.Strings(envNames)
+	for _, name := range envNames {
+		fmt.Fprintf(&b, "ENV %s=%s\n", name, strconv.Quote(s.Env[name]))
+	}
+
+	if len(s.Packages) > 0 {
+		fmt.Fprintf(&b, "RUN %s\n", installPackages(s.Packages))
+	}
+
+	for _, command := range s.Run {
+		fmt.Fprintf(&b, "RUN %s\n", dockerfileCommand(command))
+	}
+	for _, port := range s.Ports {
+		fmt.Fprintf(&b, "EXPOSE %s\n", containerPort(port))
+	}
+	b.WriteString("WORKDIR /workspace\n")
+
+	return b.String()
+}
+
+// argNames returns the build argument names used by the spec and its variants
+func (s *Spec) argNames() []string {
+	names := make(map[string]bool)
+	for name := range s.Args {
+		names[name] = true
+	}
+	for _, variant := range s.Variants {
+		for name := range variant.Args {
+			names[name] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ResolveBaseImage returns the base image of a target with its build
+// arguments substituted
+func (s *Spec) ResolveBaseImage(target Target) string {
+	return os.Expand(s.BaseImage, func(name string) string {
+		return target.BuildArgs[name]
+	})
+}
+
+// dockerfileCommand joins a multi-line command into one RUN instruction using
+// line continuations
+func dockerfileCommand(command string) string {
+	lines := strings.Split(strings.TrimSpace(command), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(line), "\\"))
+	}
+	return strings.Join(lines, " \\\n    ")
+}
+
+// installPackages returns a shell command installing packages with whichever
+// package manager the base image provides
+func installPackages(packages []string) string {
+	list := strings.Join(packages, " ")
+	return strings.Join([]string{
+		"if command -v apt-get >/dev/null 2>&1; then",
+		fmt.Sprintf("apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends %s && rm -rf /var/lib/apt/lists/*;", list),
+		fmt.Sprintf("elif command -v apk >/dev/null 2>&1; then apk add --no-cache %s;", list),
+		fmt.Sprintf("elif command -v dnf >/dev/null 2>&1; then dnf install -y %s;", list),
+		fmt.Sprintf("elif command -v yum >/dev/null 2>&1; then yum install -y %s;", list),
+		"else echo 'devdrop: no supported package manager found' >&2; exit 1; fi",
+	}, " \\\n    ")
+}
+
+// containerPort returns the container side of a docker run -p mapping,
+// e.g. "80" for "127.0.0.1:8080:80"
+func containerPort(mapping string) string {
+	parts := strings.Split(mapping, ":")
+	return parts[len(parts)-1]
+}
+
+// ParseMount splits a src:dst[:ro] mount. The destination must be an
+// absolute container path.
+func ParseMount(mount string) (src, dst string, readOnly bool, err error) {
+	parts := strings.Split(mount, ":")
+	switch {
+	case len(parts) == 3 && (parts[2] == "ro" || parts[2] == "rw"):
+		readOnly = parts[2] == "ro"
+	case len(parts) != 2:
+		return "", "", false, fmt.Errorf("invalid mount '%s': expected src:dst[:ro]", mount)
+	}
+
+	src, dst = parts[0], parts[1]
+	if src == "" || !strings.HasPrefix(dst, "/") {
+		return "", "", false, fmt.Errorf("invalid mount '%s': expected src:dst[:ro] with an absolute container path", mount)
+	}
+	return src, dst, readOnly, nil
+}
+
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ParseVolume splits a name:dst[:ro] named volume. Names are letters,
+// digits, '.', '_' and '-', which tells them apart from bind mount sources.
+func ParseVolume(volume string) (name, dst string, readOnly bool, err error) {
+	parts := strings.Split(volume, ":")
+	switch {
+	case len(parts) == 3 && (parts[2] == "ro" || parts[2] == "rw"):
+		readOnly = parts[2] == "ro"
+	case len(parts) != 2:
+		return "", "", false, fmt.Errorf("invalid volume '%s': expected name:dst[:ro]", volume)
+	}
+
+	name, dst = parts[0], parts[1]
+	if !volumeNamePattern.MatchString(name) || !strings.HasPrefix(dst, "/") {
+		return "", "", false, fmt.Errorf("invalid volume '%s': expected name:dst[:ro] with a name of letters, digits, '.', '_' or '-' and an absolute container path", volume)
+	}
+	return name, dst, readOnly, nil
+}
@@ -0,0 +1,263 @@
+// Package store implements DevDrop's experimental content-addressed
+// environment store.
+//
+// Instead of relying on mutable :latest tags, the store records every
+// environment image by its digest (the Docker image ID) and keeps refs that
+// point environment tags at digests, much like git's objects and refs:
+//
+//	~/.config/devdrop/store/objects/sha256/<hex>.yaml   image metadata
+//	~/.config/devdrop/store/refs/<environment>/<tag>     digest of a tag
+//
+// Because refs resolve to immutable digests, switching versions doesn't need
+// a pull or a retag, garbage collection can tell exactly which images are
+// still referenced, and local and remote state can be compared by digest.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNotFound is returned for refs and objects the store doesn't know
+var ErrNotFound = errors.New("not found in store")
+
+// Object is an environment image recorded by digest
+type Object struct {
+	Digest      string    `yaml:"digest"`
+	Environment string    `yaml:"environment"`
+	RepoDigests []string  `yaml:"repo_digests,omitempty"`
+	Size        int64     `yaml:"size,omitempty"`
+	Recorded    time.Time `yaml:"recorded"`
+}
+
+// Store is a content-addressed index rooted at a directory
+type Store struct {
+	root string
+}
+
+// Open returns the store rooted at dir, creating it if needed
+func Open(dir string) (*Store, error) {
+	for _, sub := range []string{"objects", "refs"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create store: %w", err)
+		}
+	}
+	return &Store{root: dir}, nil
+}
+
+// Put records an object under its digest
+func (s *Store) Put(obj Object) error {
+	path, err := s.objectPath(obj.Digest)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("failed to encode object: %w", err)
+	}
+	return writeAtomic(path, data)
+}
+
+// Get returns the object recorded under digest
+func (s *Store) Get(digest string) (Object, error) {
+	path, err := s.objectPath(digest)
+	if err != nil {
+		return Object{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return Object{}, fmt.Errorf("object %s: %w", digest, ErrNotFound)
+	}
+	if err != nil {
+		return Object{}, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	var obj Object
+	if err := yaml.Unmarshal(data, &obj); err != nil {
+		return Object{}, fmt.Errorf("failed to parse object %s: %w", digest, err)
+	}
+	return obj, nil
+}
+
+// Objects returns all recorded objects
+func (s *Store) Objects() ([]Object, error) {
+	paths, err := filepath.Glob(filepath.Join(s.root, "objects", "*", "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+
+	objects := make([]Object, 0, len(paths))
+	for _, path := range paths {
+		algorithm := filepath.Base(filepath.Dir(path))
+		obj, err := s.Get(algorithm + ":" + strings.TrimSuffix(filepath.Base(path), ".yaml"))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// Remove deletes an object. Refs pointing at it are left dangling, so only
+// remove objects returned by Unreferenced.
+func (s *Store) Remove(digest string) error {
+	path, err := s.objectPath(digest)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove object: %w", err)
+	}
+	return nil
+}
+
+// SetRef points a tag of an environment at a digest
+func (s *Store) SetRef(env, tag, digest string) error {
+	if _, err := s.Get(digest); err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.root, "refs", env, tag)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create store: %w", err)
+	}
+	return writeAtomic(path, []byte(digest+"\n"))
+}
+
+// Ref resolves a tag of an environment to a digest
+func (s *Store) Ref(env, tag string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(s.root, "refs", env, tag))
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%s:%s: %w", env, tag, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read ref: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Refs returns the tags of an environment and the digests they point at
+func (s *Store) Refs(env string) (map[string]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "refs", env))
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+
+	refs := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		digest, err := s.Ref(env, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		refs[entry.Name()] = digest
+	}
+	return refs, nil
+}
+
+// Environments returns the environments that have refs, sorted
+func (s *Store) Environments() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "refs"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read refs: %w", err)
+	}
+
+	var envs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			envs = append(envs, entry.Name())
+		}
+	}
+	sort.Strings(envs)
+	return envs, nil
+}
+
+// RemoveRef deletes a tag of an environment
+func (s *Store) RemoveRef(env, tag string) error {
+	if err := os.Remove(filepath.Join(s.root, "refs", env, tag)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove ref: %w", err)
+	}
+	return nil
+}
+
+// RemoveEnvironment deletes all refs of an environment
+func (s *Store) RemoveEnvironment(env string) error {
+	if err := os.RemoveAll(filepath.Join(s.root, "refs", env)); err != nil {
+		return fmt.Errorf("failed to remove refs: %w", err)
+	}
+	return nil
+}
+
+// Unreferenced returns the objects no ref points at, i.e. the images that
+// are safe to garbage collect. Refs for which ignore returns true are
+// treated as already removed; ignore may be nil.
+func (s *Store) Unreferenced(ignore func(env, tag string) bool) ([]Object, error) {
+	referenced := make(map[string]bool)
+	envs, err := s.Environments()
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range envs {
+		refs, err := s.Refs(env)
+		if err != nil {
+			return nil, err
+		}
+		for tag, digest := range refs {
+			if ignore == nil || !ignore(env, tag) {
+				referenced[digest] = true
+			}
+		}
+	}
+
+	objects, err := s.Objects()
+	if err != nil {
+		return nil, err
+	}
+
+	var unreferenced []Object
+	for _, obj := range objects {
+		if !referenced[obj.Digest] {
+			unreferenced = append(unreferenced, obj)
+		}
+	}
+	return unreferenced, nil
+}
+
+// objectPath maps a digest like sha256:<hex> to its object file
+func (s *Store) objectPath(digest string) (string, error) {
+	algorithm, hex, found := strings.Cut(digest, ":")
+	if !found || algorithm == "" || hex == "" || strings.ContainsAny(digest, `/\`) {
+		return "", fmt.Errorf("invalid digest '%s'", digest)
+	}
+	return filepath.Join(s.root, "objects", algorithm, hex+".yaml"), nil
+}
+
+// writeAtomic replaces a file so readers never see partial content
+func writeAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
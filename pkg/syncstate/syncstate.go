@@ -0,0 +1,86 @@
+// Package syncstate tells how the local image of an environment relates to
+// the image pushed to its registry.
+//
+// Images are compared by their layers rather than by timestamps or tags:
+// every commit adds a layer on top of the image it was started from, so an
+// image whose layers begin with all layers of another one was committed
+// from it. That tells apart:
+// - in sync: both are the same image
+// - local ahead: the local image has commits that weren't pushed
+// - remote ahead: another machine pushed commits that weren't pulled
+// - diverged: both sides have commits the other lacks
+package syncstate
+
+// State is how a local image relates to the pushed one
+type State string
+
+// States of an environment
+const (
+	InSync      State = "in sync"
+	LocalAhead  State = "local ahead"
+	RemoteAhead State = "remote ahead"
+	Diverged    State = "diverged"
+	// LocalOnly environments were never pushed
+	LocalOnly State = "local only"
+	// RemoteOnly environments were pushed but aren't pulled
+	RemoteOnly State = "remote only"
+	// NoImage environments haven't been committed anywhere yet
+	NoImage State = "no image"
+	// Unknown means one side couldn't be inspected
+	Unknown State = "unknown"
+)
+
+// Image is a local or pushed image
+type Image struct {
+	// Digests are the registry digests the image is known by: the
+	// RepoDigests of a local image, or the manifest digest of a pushed one
+	Digests []string
+	// Layers are the digests of the uncompressed layers, oldest first
+	Layers []string
+}
+
+// Compare returns the state of a local image against the pushed one; nil
+// means the image doesn't exist
+func Compare(local, remote *Image) State {
+	switch {
+	case local == nil && remote == nil:
+		return NoImage
+	case remote == nil:
+		return LocalOnly
+	case local == nil:
+		return RemoteOnly
+	}
+
+	for _, l := range local.Digests {
+		for _, r := range remote.Digests {
+			if l == r {
+				return InSync
+			}
+		}
+	}
+
+	switch {
+	case len(local.Layers) == 0 || len(remote.Layers) == 0:
+		return Unknown
+	case len(local.Layers) == len(remote.Layers) && hasPrefix(local.Layers, remote.Layers):
+		return InSync
+	case hasPrefix(local.Layers, remote.Layers):
+		return LocalAhead
+	case hasPrefix(remote.Layers, local.Layers):
+		return RemoteAhead
+	}
+	return Diverged
+}
+
+// hasPrefix reports whether layers starts with all of prefix
+func hasPrefix(layers, prefix []string) bool {
+	if len(prefix) > len(layers) {
+		return false
+	}
+	for i := range prefix {
+		if layers[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
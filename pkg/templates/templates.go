@@ -0,0 +1,196 @@
+// Package templates provides the starter templates 'devdrop init --template'
+// creates environments from.
+//
+// A template is a base image plus the packages and setup commands that turn
+// it into a ready development environment, and the volumes and ports such
+// an environment usually wants. DevDrop ships a built-in catalog; teams can
+// publish more in a remote index of the same format.
+package templates
+
+import (
+	_ "embed"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/shell"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed catalog.yaml
+var builtinCatalog []byte
+
+// SourceBuiltin is the Source of templates from the built-in catalog
+const SourceBuiltin = "built-in"
+
+// markerFile records the template a container was set up from, so setup
+// doesn't run again in containers of committed images
+const markerFile = "/etc/devdrop-template"
+
+// Template is a starter environment
+type Template struct {
+	Name        string `yaml:"-" json:"name"`
+	Description string `yaml:"description" json:"description"`
+	Image       string `yaml:"image" json:"image"`
+	// Packages are installed with the image's package manager
+	Packages []string `yaml:"packages,omitempty" json:"packages,omitempty"`
+	// Setup are shell commands run after the packages are installed
+	Setup []string `yaml:"setup,omitempty" json:"setup,omitempty"`
+	// Volumes, Mounts and Ports are recommended for the environment and
+	// saved in its config
+	Volumes []string `yaml:"volumes,omitempty" json:"volumes,omitempty"`
+	Mounts  []string `yaml:"mounts,omitempty" json:"mounts,omitempty"`
+	Ports   []string `yaml:"ports,omitempty" json:"ports,omitempty"`
+	// Source is SourceBuiltin or the URL of the index the template is from
+	Source string `yaml:"-" json:"source"`
+}
+
+// index is the format of the built-in catalog and of remote indexes
+type index struct {
+	Templates map[string]Template `yaml:"templates"`
+}
+
+// parse reads an index, naming its templates and recording their source
+func parse(data []byte, source string) (map[string]Template, error) {
+	var idx index
+	if err := yaml.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("failed to parse template index %s: %w", source, err)
+	}
+
+	templates := make(map[string]Template, len(idx.Templates))
+	for name, t := range idx.Templates {
+		if t.Image == "" {
+			return nil, fmt.Errorf("template '%s' in %s has no image", name, source)
+		}
+		t.Name = name
+		t.Source = source
+		templates[name] = t
+	}
+	return templates, nil
+}
+
+// Builtin returns the templates shipped with DevDrop
+func Builtin() map[string]Template {
+	templates, err := parse(builtinCatalog, SourceBuiltin)
+	if err != nil {
+		panic(err)
+	}
+	return templates
+}
+
+// FetchIndex downloads the remote index at url. The last index fetched is
+// kept in cacheFile and used when the index can't be reached; err is then
+// still returned, so callers can warn that the templates may be stale.
+func FetchIndex(url, cacheFile string) (map[string]Template, error) {
+	data, fetchErr := download(url)
+	if fetchErr == nil {
+		templates, err := parse(data, url)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err == nil {
+			os.WriteFile(cacheFile, data, 0644)
+		}
+		return templates, nil
+	}
+
+	data, err := os.ReadFile(cacheFile)
+	if err != nil {
+		return nil, fetchErr
+	}
+	templates, err := parse(data, url)
+	if err != nil {
+		return nil, fetchErr
+	}
+	return templates, fetchErr
+}
+
+func download(url string) ([]byte, error) {
+	httpClient := &http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template index: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("template index %s returned status %d", url, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template index: %w", err)
+	}
+	return body, nil
+}
+
+// Merge combines template sets; templates of later sets replace those of
+// earlier ones with the same name
+func Merge(sets ...map[string]Template) map[string]Template {
+	merged := make(map[string]Template)
+	for _, set := range sets {
+		for name, t := range set {
+			merged[name] = t
+		}
+	}
+	return merged
+}
+
+// Names returns the sorted names of templates
+func Names(templates map[string]Template) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetupScript returns the shell step that installs the template's packages
+// and runs its setup commands when the container starts. It does nothing in
+// containers that were already set up, including those of committed images.
+// A failing setup is reported but still leaves the user in a shell to fix it.
+func (t Template) SetupScript() string {
+	if len(t.Packages) == 0 && len(t.Setup) == 0 {
+		return ""
+	}
+
+	var commands []string
+	if len(t.Packages) > 0 {
+		pkgs := make([]string, len(t.Packages))
+		for i, pkg := range t.Packages {
+			pkgs[i] = shell.Quote(pkg)
+		}
+		list := strings.Join(pkgs, " ")
+		commands = append(commands, "{ if command -v apt-get >/dev/null 2>&1; then "+
+			"apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y --no-install-recommends "+list+"; "+
+			"elif command -v apk >/dev/null 2>&1; then apk add --no-cache "+list+"; "+
+			"elif command -v dnf >/dev/null 2>&1; then dnf install -y "+list+"; "+
+			"else echo 'No supported package manager found' >&2; false; fi; }")
+	}
+	for _, setup := range t.Setup {
+		commands = append(commands, "{ "+setup+"; }")
+	}
+
+	// set -e has no effect in an if condition, so the commands are chained
+	lines := []string{
+		fmt.Sprintf(`if [ ! -e %s ]; then`, markerFile),
+		fmt.Sprintf(`  echo %s`, shell.Quote("Setting up template "+t.Name+"...")),
+		`  if ` + strings.Join(commands, " &&\n    ") + `; then`,
+	}
+	return strings.Join(append(lines,
+		fmt.Sprintf(`    echo %s > %s`, shell.Quote(t.Name), markerFile),
+		`  else`,
+		`    echo "Warning: template setup failed; fix it in the shell before committing" >&2`,
+		`  fi`,
+		`fi`,
+	), "\n")
+}
@@ -0,0 +1,136 @@
+// Package tools records the versions of key tools inside an environment.
+//
+// A lock maps tool names (language runtimes, package managers, common build
+// tools) to the version they report, plus a checksum of the installed OS
+// packages. Locks are captured when an environment is committed or built and
+// compared against a container later to detect drift from ad-hoc installs
+// made during a session.
+package tools
+
+import (
+	"sort"
+	"strings"
+)
+
+// Lock maps tool names to the version line they report
+type Lock map[string]string
+
+// probes lists the tools recorded in a lock and the command printing their version
+var probes = []struct {
+	name    string
+	command string
+}{
+	{"go", "go version"},
+	{"node", "node --version"},
+	{"npm", "npm --version"},
+	{"yarn", "yarn --version"},
+	{"python", "python3 --version"},
+	{"pip", "pip3 --version"},
+	{"ruby", "ruby --version"},
+	{"rustc", "rustc --version"},
+	{"cargo", "cargo --version"},
+	{"java", "java -version"},
+	{"dotnet", "dotnet --version"},
+	{"gcc", "gcc --version"},
+	{"make", "make --version"},
+	{"git", "git --version"},
+}
+
+// ShellCommand returns the command that prints "name<TAB>version" for every
+// installed tool, plus a "packages" line summarizing the OS packages
+func ShellCommand() []string {
+	var script strings.Builder
+	script.WriteString(`probe() { name=$1; shift; command -v "$1" >/dev/null 2>&1 || return 0; printf '%s\t%s\n' "$name" "$("$@" 2>&1 | head -n 1)"; }` + "\n")
+	for _, probe := range probes {
+		script.WriteString("probe " + probe.name + " " + probe.command + "\n")
+	}
+	script.WriteString(`if command -v dpkg-query >/dev/null 2>&1; then pkgs=$(dpkg-query -W -f '${Package}=${Version}\n' | sort); mgr=dpkg;` +
+		` elif command -v apk >/dev/null 2>&1; then pkgs=$(apk info -v 2>/dev/null | sort); mgr=apk;` +
+		` elif command -v rpm >/dev/null 2>&1; then pkgs=$(rpm -qa | sort); mgr=rpm; fi` + "\n")
+	script.WriteString(`[ -n "$mgr" ] && printf 'packages\t%s: %s packages, checksum %s\n' "$mgr" "$(printf '%s\n' "$pkgs" | wc -l | tr -d ' ')" "$(printf '%s\n' "$pkgs" | cksum | cut -d ' ' -f 1)"` + "\n")
+	script.WriteString("exit 0\n")
+
+	return []string{"/bin/sh", "-c", script.String()}
+}
+
+// Parse reads the output of ShellCommand
+func Parse(output string) Lock {
+	lock := make(Lock)
+	for _, line := range strings.Split(output, "\n") {
+		name, version, found := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if !found || name == "" {
+			continue
+		}
+		lock[name] = strings.TrimSpace(version)
+	}
+	return lock
+}
+
+// Drift is a difference between a lock and the tools found in a container
+type Drift struct {
+	Tool    string
+	Locked  string
+	Current string
+}
+
+// Compare returns the differences between the locked and current tools,
+// sorted by tool name. A tool missing from either side has an empty version.
+func Compare(locked, current Lock) []Drift {
+	var drift []Drift
+	for name, version := range locked {
+		if current[name] != version {
+			drift = append(drift, Drift{Tool: name, Locked: version, Current: current[name]})
+		}
+	}
+	for name, version := range current {
+		if _, exists := locked[name]; !exists {
+			drift = append(drift, Drift{Tool: name, Current: version})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool { return drift[i].Tool < drift[j].Tool })
+	return drift
+}
+
+// Names returns the tool names in a lock, sorted
+func (l Lock) Names() []string {
+	names := make([]string, 0, len(l))
+	for name := range l {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Package is an installed OS package
+type Package struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PackagesCommand returns the command that prints the package manager on
+// the first line and then "name<TAB>version" for every installed OS package
+func PackagesCommand() []string {
+	script := `if command -v dpkg-query >/dev/null 2>&1; then echo dpkg; dpkg-query -W -f '${Package}\t${Version}\n';` +
+		` elif [ -f /lib/apk/db/installed ]; then echo apk; awk -F: '/^P:/{p=$2} /^V:/{print p "\t" $2}' /lib/apk/db/installed;` +
+		` elif command -v rpm >/dev/null 2>&1; then echo rpm; rpm -qa --qf '%{NAME}\t%{VERSION}-%{RELEASE}\n';` +
+		` else echo none; fi`
+	return []string{"/bin/sh", "-c", script}
+}
+
+// ParsePackages reads the output of PackagesCommand, sorted by name
+func ParsePackages(output string) (string, []Package) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	manager := strings.TrimSpace(lines[0])
+
+	var packages []Package
+	for _, line := range lines[1:] {
+		name, version, found := strings.Cut(strings.TrimRight(line, "\r"), "\t")
+		if !found || name == "" {
+			continue
+		}
+		packages = append(packages, Package{Name: name, Version: version})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Name < packages[j].Name })
+	return manager, packages
+}
@@ -0,0 +1,227 @@
+// Package update replaces the devdrop binary with a newer release.
+//
+// Releases are published on GitHub with a binary per platform, named
+// devdrop-<os>-<arch> (.exe on Windows), and a checksums.txt in sha256sum
+// format. A downloaded binary is only installed when its checksum matches.
+package update
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Repository is the GitHub repository releases are published in
+const Repository = "oysteinje/devdrop"
+
+// checksumsAsset is the release asset holding the binaries' checksums
+const checksumsAsset = "checksums.txt"
+
+// Release is a published devdrop release
+type Release struct {
+	Tag       string
+	Published time.Time
+	// URL is the release's page
+	URL    string
+	Assets []Asset
+}
+
+// Asset is a file attached to a release
+type Asset struct {
+	Name string
+	URL  string
+	Size int64
+}
+
+// Asset returns the asset with the given name
+func (r Release) Asset(name string) (Asset, bool) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset, true
+		}
+	}
+	return Asset{}, false
+}
+
+// AssetName returns the name of the binary for a platform, e.g.
+// devdrop-linux-amd64
+func AssetName(goos, goarch string) string {
+	name := fmt.Sprintf("devdrop-%s-%s", goos, goarch)
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Latest returns the newest release
+func Latest() (Release, error) {
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/"+Repository+"/releases/latest", nil)
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to create release request: %w", err)
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return Release{}, fmt.Errorf("failed to check for releases: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return Release{}, fmt.Errorf("GitHub returned status %d for the latest release of %s", resp.StatusCode, Repository)
+	}
+
+	var body struct {
+		TagName     string    `json:"tag_name"`
+		PublishedAt time.Time `json:"published_at"`
+		HTMLURL     string    `json:"html_url"`
+		Assets      []struct {
+			Name               string `json:"name"`
+			BrowserDownloadURL string `json:"browser_download_url"`
+			Size               int64  `json:"size"`
+		} `json:"assets"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return Release{}, fmt.Errorf("failed to parse the latest release: %w", err)
+	}
+
+	release := Release{Tag: body.TagName, Published: body.PublishedAt, URL: body.HTMLURL}
+	for _, asset := range body.Assets {
+		release.Assets = append(release.Assets, Asset{Name: asset.Name, URL: asset.BrowserDownloadURL, Size: asset.Size})
+	}
+	return release, nil
+}
+
+// Download downloads the binary of the running platform from a release
+// into a temporary file in dir and verifies it against the release's
+// checksums. It returns the file's path; the caller removes it when it
+// isn't installed.
+func Download(release Release, dir string) (string, error) {
+	name := AssetName(runtime.GOOS, runtime.GOARCH)
+	binary, ok := release.Asset(name)
+	if !ok {
+		return "", fmt.Errorf("release %s has no binary for %s/%s", release.Tag, runtime.GOOS, runtime.GOARCH)
+	}
+	sums, ok := release.Asset(checksumsAsset)
+	if !ok {
+		return "", fmt.Errorf("release %s has no %s to verify the download with", release.Tag, checksumsAsset)
+	}
+
+	want, err := expectedChecksum(sums.URL, name)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".devdrop-update-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create download file: %w", err)
+	}
+	path := tmp.Name()
+	fail := func(err error) (string, error) {
+		tmp.Close()
+		os.Remove(path)
+		return "", err
+	}
+
+	body, err := get(binary.URL)
+	if err != nil {
+		return fail(err)
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		return fail(fmt.Errorf("failed to download %s: %w", name, err))
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return fail(fmt.Errorf("checksum mismatch for %s: expected %s, got %s", name, want, got))
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		return fail(fmt.Errorf("failed to make %s executable: %w", name, err))
+	}
+	if err := tmp.Close(); err != nil {
+		return fail(fmt.Errorf("failed to write %s: %w", name, err))
+	}
+	return path, nil
+}
+
+// expectedChecksum looks up the sha256 of an asset in a checksums file
+func expectedChecksum(url, name string) (string, error) {
+	body, err := get(url)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		// sha256sum marks binary mode with a * before the file name
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", checksumsAsset, err)
+	}
+	return "", fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// get downloads a URL; downloads get more time than API calls
+func get(url string) (io.ReadCloser, error) {
+	client := &http.Client{Timeout: 10 * time.Minute}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("download of %s returned status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// Executable returns the path of the running binary with symlinks
+// resolved, the file an update replaces
+func Executable() (string, error) {
+	path, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the devdrop binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return path, nil
+}
+
+// Replace installs the binary at newPath in place of executable. Windows
+// can't overwrite a running executable, so it is moved aside to
+// <executable>.old first, which the next update removes.
+func Replace(executable, newPath string) error {
+	if runtime.GOOS == "windows" {
+		old := executable + ".old"
+		os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			return fmt.Errorf("failed to move %s aside: %w", executable, err)
+		}
+		if err := os.Rename(newPath, executable); err != nil {
+			os.Rename(old, executable)
+			return fmt.Errorf("failed to install %s: %w", executable, err)
+		}
+		return nil
+	}
+	if err := os.Rename(newPath, executable); err != nil {
+		return fmt.Errorf("failed to install %s: %w", executable, err)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package workflow
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/hooks"
+	"github.com/oysteinje/devdrop/pkg/scan"
+	"github.com/oysteinje/devdrop/pkg/signing"
+)
+
+// CommitOptions configures the commit workflow
+type CommitOptions struct {
+	Client      *docker.Client
+	Config      *config.Config
+	Environment string
+	// Env is the environment's entry before the commit
+	Env         config.Environment
+	ContainerID string
+	AuthToken   string
+	Commit      docker.CommitOptions
+	// Running keeps the container after the commit, for sessions that are
+	// still going on
+	Running bool
+	// NoPush only tags the new version locally
+	NoPush bool
+	// Hooks runs the environment's pre_commit hooks; nil skips them
+	Hooks *hooks.Runner
+	// Signer signs the pushed version; nil leaves it unsigned
+	Signer *signing.Cosign
+	// Scanner scans the new version for vulnerabilities before it is
+	// pushed; critical ones stop the push. Nil skips the scan.
+	Scanner *scan.Scanner
+}
+
+// CommitResult is what the commit workflow produced
+type CommitResult struct {
+	// Image is the environment's image, tagged latest and VersionTag
+	Image      string
+	VersionTag string
+}
+
+// Commit runs the environment's pre_commit hooks, commits a session
+// container as the next version of an environment, pushes the version and latest tags (unless the environment is
+// local-only or NoPush is set), records the version in the config and
+// removes the container. The result is known before the workflow runs; the
+// image and tag exist once it succeeded.
+func Commit(opts CommitOptions) (*Workflow, *CommitResult) {
+	env := opts.Env
+	result := &CommitResult{
+		Image:      opts.Config.GetEnvironmentImageName(opts.Environment),
+		VersionTag: env.NextVersionTag(),
+	}
+	versionImage := opts.Config.GetEnvironmentImageRef(opts.Environment, result.VersionTag)
+	shortID := opts.ContainerID
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+
+	return New("commit",
+		Step{
+			Name: "Run pre-commit hooks",
+			Skip: func() string {
+				if opts.Hooks == nil || len(env.Hooks.PreCommit) == 0 {
+					return "no pre_commit hooks"
+				}
+				return ""
+			},
+			Run: func(r *Reporter) error {
+				return opts.Hooks.Run(hooks.PreCommit, env.Hooks.PreCommit)
+			},
+		},
+		Step{
+			Name: "Commit container",
+			Run: func(r *Reporter) error {
+				r.Infof("Committing %s to %s (version %s)", shortID, result.Image, result.VersionTag)
+				if err := opts.Client.CommitContainer(opts.ContainerID, result.Image, opts.Commit); err != nil {
+					return fmt.Errorf("failed to commit container: %w", err)
+				}
+				if err := opts.Client.TagImage(result.Image, versionImage); err != nil {
+					return fmt.Errorf("failed to tag version: %w", err)
+				}
+				return nil
+			},
+		},
+		Step{
+			// Lock tool versions so 'devdrop verify-tools' can detect drift later
+			Name:     "Lock tool versions",
+			Optional: true,
+			Run: func(r *Reporter) error {
+				lock, err := opts.Client.CaptureTools(result.Image)
+				if err != nil {
+					return err
+				}
+				env.Tools = lock
+				return nil
+			},
+		},
+		Step{
+			Name: "Scan image",
+			Skip: func() string {
+				if opts.Scanner == nil {
+					return "scanning is off"
+				}
+				return ""
+			},
+			Run: func(r *Reporter) error {
+				r.Infof("Scanning %s with %s", result.Image, opts.Scanner.Name)
+				report, err := opts.Scanner.Scan(result.Image)
+				if err != nil {
+					return err
+				}
+				r.Infof("Found %s", report.Summary())
+				critical := len(report.AtLeast(scan.Critical))
+				if critical == 0 {
+					return nil
+				}
+				if env.LocalOnly || opts.NoPush {
+					r.Warnf("%d critical vulnerabilities; run 'devdrop scan %s' for details", critical, opts.Environment)
+					return nil
+				}
+				return fmt.Errorf("%d critical vulnerabilities found, so nothing was pushed. Run 'devdrop scan %s' for details, fix them in the session and commit again, or commit with --scan=false", critical, opts.Environment)
+			},
+		},
+		Step{
+			Name: "Push image",
+			Skip: func() string {
+				if env.LocalOnly {
+					return "local-only environment; images never leave this machine"
+				}
+				if opts.NoPush {
+					return "--no-push; the new version is only tagged locally"
+				}
+				return ""
+			},
+			Run: func(r *Reporter) error {
+				for _, image := range []string{versionImage, result.Image} {
+					r.Infof("Pushing %s", image)
+					if err := opts.Client.PushImage(image, opts.AuthToken); err != nil {
+						return fmt.Errorf("failed to push image: %w", err)
+					}
+				}
+				return nil
+			},
+		},
+		Step{
+			Name: "Sign image",
+			Skip: func() string {
+				if opts.Signer == nil {
+					return "no signing_key in the config"
+				}
+				if env.LocalOnly || opts.NoPush {
+					return "nothing was pushed"
+				}
+				return ""
+			},
+			Run: func(r *Reporter) error {
+				r.Infof("Signing %s", versionImage)
+				ref, err := opts.Signer.SignImage(opts.Client, versionImage, opts.AuthToken)
+				if err != nil {
+					return err
+				}
+				r.Infof("Signed %s", ref)
+				return nil
+			},
+		},
+		Step{
+			Name: "Update config",
+			Run: func(r *Reporter) error {
+				env.Image = result.Image
+				env.LastUpdated = time.Now()
+				env.Versions = append(env.Versions, config.Version{Tag: result.VersionTag, Created: env.LastUpdated, Message: opts.Commit.Message})
+				env.LatestVersion = result.VersionTag
+				env.LastContainer = "" // Cleared since the container is removed
+				if opts.Running {
+					env.LastContainer = opts.ContainerID
+				}
+				if err := opts.Config.AddEnvironment(opts.Environment, env); err != nil {
+					return fmt.Errorf("failed to update configuration: %w", err)
+				}
+				return nil
+			},
+		},
+		Step{
+			Name: "Remove container",
+			Skip: func() string {
+				if opts.Running {
+					return fmt.Sprintf("container %s keeps running; commit again to save later changes", shortID)
+				}
+				return ""
+			},
+			// Don't fail the whole operation if cleanup fails
+			Optional: true,
+			Run: func(r *Reporter) error {
+				if err := opts.Client.RemoveContainer(opts.ContainerID); err != nil {
+					return fmt.Errorf("failed to remove container: %w", err)
+				}
+				return nil
+			},
+		},
+	), result
+}
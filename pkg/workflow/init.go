@@ -0,0 +1,101 @@
+package workflow
+
+import (
+	"fmt"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/go-units"
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+)
+
+// BaseImageOptions configures the workflow that prepares the base image of
+// a new environment
+type BaseImageOptions struct {
+	Client *docker.Client
+	Config *config.Config
+	Image  string
+	// Pin is the digest the image must have, e.g. from the system
+	// catalog; a digest in Image itself is checked as well
+	Pin string
+}
+
+// BaseImageResult is what the base image workflow found out
+type BaseImageResult struct {
+	// Digest is the image's registry digest, if it came from a registry
+	Digest string
+}
+
+// BaseImage pulls the base image of a new environment, reports its digest,
+// platform and size, checks it against a pinned digest and remembers it as
+// a recently used image. The result is filled in as the workflow runs.
+func BaseImage(opts BaseImageOptions) (*Workflow, *BaseImageResult) {
+	result := &BaseImageResult{}
+	return New("init",
+		Step{
+			Name: "Pull base image",
+			Run: func(r *Reporter) error {
+				r.Infof("Pulling %s", opts.Image)
+				if err := opts.Client.PullImage(opts.Image, ""); err != nil {
+					return fmt.Errorf("failed to pull base image: %w", err)
+				}
+				return nil
+			},
+		},
+		Step{
+			Name: "Verify base image",
+			Run: func(r *Reporter) error {
+				var err error
+				result.Digest, err = verifyBaseImage(r, opts.Client, opts.Image, opts.Pin)
+				return err
+			},
+		},
+		Step{
+			Name:     "Record recent image",
+			Optional: true,
+			Run: func(r *Reporter) error {
+				if err := opts.Config.AddRecentImage(opts.Image); err != nil {
+					return fmt.Errorf("failed to record recent image: %w", err)
+				}
+				return nil
+			},
+		},
+	), result
+}
+
+// verifyBaseImage reports the digest, platform and size of a pulled base
+// image and checks it against a pinned digest, or the digest the reference
+// itself pins. It returns the image's registry digest.
+func verifyBaseImage(r *Reporter, dockerClient *docker.Client, imageName, pin string) (string, error) {
+	info, err := dockerClient.InspectImage(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	if named, err := reference.ParseNormalizedNamed(imageName); err == nil && pin == "" {
+		if digested, ok := named.(reference.Digested); ok {
+			pin = digested.Digest().String()
+		}
+	}
+
+	digest := info.RepoDigest(imageName)
+	if pin != "" && info.HasRepoDigest(imageName, pin) {
+		digest = pin
+	}
+
+	shown := digest
+	if shown == "" {
+		shown = "none (not pulled from a registry)"
+	}
+	r.Infof("Digest:   %s", shown)
+	r.Infof("Platform: %s", info.Platform)
+	r.Infof("Size:     %s", units.HumanSize(float64(info.Size)))
+
+	if pin != "" {
+		if digest != pin {
+			return "", fmt.Errorf("base image %s has digest %s, not the pinned %s", imageName, shown, pin)
+		}
+		r.Infof("Digest matches the pin.")
+	}
+	return digest, nil
+}
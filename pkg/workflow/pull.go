@@ -0,0 +1,79 @@
+package workflow
+
+import (
+	"fmt"
+
+	"github.com/oysteinje/devdrop/pkg/config"
+	"github.com/oysteinje/devdrop/pkg/docker"
+	"github.com/oysteinje/devdrop/pkg/signing"
+)
+
+// PullOptions configures the pull workflow
+type PullOptions struct {
+	Client      *docker.Client
+	Config      *config.Config
+	Environment string
+	AuthToken   string
+	// Verifier checks the signature of the image before it is pulled; nil
+	// pulls without checking
+	Verifier *signing.Cosign
+}
+
+// Pull pulls the latest image of an environment and records it in the
+// config, adding environments that so far only existed in the registry
+func Pull(opts PullOptions) *Workflow {
+	imageName := opts.Config.GetEnvironmentImageName(opts.Environment)
+
+	// A verified image is pulled by digest, so a tag moved after the check
+	// can't swap it
+	pullRef := imageName
+
+	return New("pull",
+		Step{
+			Name: "Verify signature",
+			Skip: func() string {
+				if opts.Verifier == nil {
+					return "verify_signatures is off"
+				}
+				return ""
+			},
+			Run: func(r *Reporter) error {
+				r.Infof("Verifying the signature of %s", imageName)
+				ref, err := opts.Verifier.VerifyImage(opts.Client, imageName, opts.AuthToken)
+				if err != nil {
+					return err
+				}
+				pullRef = ref
+				return nil
+			},
+		},
+		Step{
+			Name: "Pull image",
+			Run: func(r *Reporter) error {
+				r.Infof("Pulling %s", pullRef)
+				if err := opts.Client.PullImage(pullRef, opts.AuthToken); err != nil {
+					return fmt.Errorf("failed to pull environment image: %w", err)
+				}
+				if pullRef != imageName {
+					if err := opts.Client.TagImage(pullRef, imageName); err != nil {
+						return fmt.Errorf("failed to tag pulled image: %w", err)
+					}
+				}
+				return nil
+			},
+		},
+		Step{
+			Name: "Update config",
+			Run: func(r *Reporter) error {
+				added, err := opts.Config.RecordPull(opts.Environment, imageName)
+				if err != nil {
+					return fmt.Errorf("failed to save config: %w", err)
+				}
+				if added {
+					r.Infof("Added %s to the config", opts.Environment)
+				}
+				return nil
+			},
+		},
+	)
+}
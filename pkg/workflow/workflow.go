@@ -0,0 +1,143 @@
+// Package workflow runs the multi-step operations of DevDrop, such as
+// pulling or committing an environment, and reports their progress as
+// structured events.
+//
+// Workflows don't print anything themselves: every front-end (the CLI, and
+// later a TUI or API server) passes a Sink that renders the events its own
+// way, so all of them show the same steps in the same order.
+package workflow
+
+import (
+	"fmt"
+	"time"
+)
+
+// EventKind says what happened in a workflow
+type EventKind string
+
+// Kinds of events, in the order a step emits them
+const (
+	// StepStarted is emitted before a step runs
+	StepStarted EventKind = "step_started"
+	// Info carries a detail a step reports while running
+	Info EventKind = "info"
+	// Warning carries a problem that doesn't stop the workflow
+	Warning EventKind = "warning"
+	// StepDone is emitted when a step succeeds
+	StepDone EventKind = "step_done"
+	// StepSkipped is emitted instead of StepStarted for skipped steps
+	StepSkipped EventKind = "step_skipped"
+	// StepFailed is emitted when a step fails; the workflow stops
+	StepFailed EventKind = "step_failed"
+)
+
+// Event is a progress event of a workflow
+type Event struct {
+	Workflow string    `json:"workflow"`
+	Kind     EventKind `json:"kind"`
+	Step     string    `json:"step,omitempty"`
+	// Index is the 1-based position of the step among Total steps
+	Index   int       `json:"index,omitempty"`
+	Total   int       `json:"total,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+// Sink receives the events of a workflow as they happen
+type Sink interface {
+	Emit(Event)
+}
+
+// SinkFunc adapts a function to a Sink
+type SinkFunc func(Event)
+
+// Emit calls f
+func (f SinkFunc) Emit(e Event) {
+	f(e)
+}
+
+// Discard is a Sink that drops all events
+var Discard Sink = SinkFunc(func(Event) {})
+
+// Step is one step of a workflow
+type Step struct {
+	// Name describes the step, e.g. "Pull image"
+	Name string
+	// Run does the work, reporting details through r
+	Run func(r *Reporter) error
+	// Skip, if set, is asked before the step runs; a non-empty reason skips it
+	Skip func() string
+	// Optional steps that fail emit a warning instead of stopping the workflow
+	Optional bool
+}
+
+// Workflow is a named sequence of steps
+type Workflow struct {
+	Name  string
+	Steps []Step
+}
+
+// New returns a workflow of steps
+func New(name string, steps ...Step) *Workflow {
+	return &Workflow{Name: name, Steps: steps}
+}
+
+// Run runs the steps in order, emitting their events to sink, and returns
+// the error of the first required step that fails
+func (w *Workflow) Run(sink Sink) error {
+	if sink == nil {
+		sink = Discard
+	}
+
+	for i, step := range w.Steps {
+		r := &Reporter{sink: sink, base: Event{Workflow: w.Name, Step: step.Name, Index: i + 1, Total: len(w.Steps)}}
+
+		if step.Skip != nil {
+			if reason := step.Skip(); reason != "" {
+				r.emit(StepSkipped, reason, nil)
+				continue
+			}
+		}
+
+		r.emit(StepStarted, "", nil)
+		if err := step.Run(r); err != nil {
+			if step.Optional {
+				r.emit(Warning, err.Error(), nil)
+				r.emit(StepDone, "", nil)
+				continue
+			}
+			r.emit(StepFailed, "", err)
+			return err
+		}
+		r.emit(StepDone, "", nil)
+	}
+	return nil
+}
+
+// Reporter reports the progress of a running step
+type Reporter struct {
+	sink Sink
+	base Event
+}
+
+// Infof reports a detail of the step
+func (r *Reporter) Infof(format string, args ...interface{}) {
+	r.emit(Info, fmt.Sprintf(format, args...), nil)
+}
+
+// Warnf reports a problem that doesn't stop the step
+func (r *Reporter) Warnf(format string, args ...interface{}) {
+	r.emit(Warning, fmt.Sprintf(format, args...), nil)
+}
+
+func (r *Reporter) emit(kind EventKind, message string, err error) {
+	e := r.base
+	e.Kind = kind
+	e.Message = message
+	if err != nil {
+		e.Error = err.Error()
+	}
+	e.Time = time.Now()
+	r.sink.Emit(e)
+}
@@ -0,0 +1,92 @@
+package workflow
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	ok := func(*Reporter) error { return nil }
+	fail := func(*Reporter) error { return errors.New("boom") }
+	skip := func() string { return "not needed" }
+	noSkip := func() string { return "" }
+
+	tests := []struct {
+		name    string
+		steps   []Step
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "steps run in order",
+			steps: []Step{{Name: "a", Run: ok}, {Name: "b", Run: ok}},
+			want:  []string{"a step_started", "a step_done", "b step_started", "b step_done"},
+		},
+		{
+			name:  "skipped step is not started",
+			steps: []Step{{Name: "a", Run: fail, Skip: skip}, {Name: "b", Run: ok}},
+			want:  []string{"a step_skipped not needed", "b step_started", "b step_done"},
+		},
+		{
+			name:  "empty skip reason runs the step",
+			steps: []Step{{Name: "a", Run: ok, Skip: noSkip}},
+			want:  []string{"a step_started", "a step_done"},
+		},
+		{
+			name:    "failed step stops the workflow",
+			steps:   []Step{{Name: "a", Run: fail}, {Name: "b", Run: ok}},
+			want:    []string{"a step_started", "a step_failed"},
+			wantErr: true,
+		},
+		{
+			name:  "failed optional step warns and goes on",
+			steps: []Step{{Name: "a", Run: fail, Optional: true}, {Name: "b", Run: ok}},
+			want:  []string{"a step_started", "a warning boom", "a step_done", "b step_started", "b step_done"},
+		},
+		{
+			name: "details come between start and done",
+			steps: []Step{{Name: "a", Run: func(r *Reporter) error {
+				r.Infof("pulled %d layers", 3)
+				r.Warnf("slow")
+				return nil
+			}}},
+			want: []string{"a step_started", "a info pulled 3 layers", "a warning slow", "a step_done"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			var indexes []int
+			err := New("test", tt.steps...).Run(SinkFunc(func(e Event) {
+				line := e.Step + " " + string(e.Kind)
+				if e.Message != "" {
+					line += " " + e.Message
+				}
+				got = append(got, line)
+				indexes = append(indexes, e.Index)
+				if e.Workflow != "test" || e.Total != len(tt.steps) {
+					t.Errorf("event %q has workflow %q and total %d", line, e.Workflow, e.Total)
+				}
+			}))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %q, want %q", got, tt.want)
+			}
+			for i := 1; i < len(indexes); i++ {
+				if indexes[i] < indexes[i-1] {
+					t.Errorf("step indexes out of order: %v", indexes)
+				}
+			}
+		})
+	}
+}
+
+func TestRunNilSink(t *testing.T) {
+	if err := New("test", Step{Name: "a", Run: func(*Reporter) error { return nil }}).Run(nil); err != nil {
+		t.Fatalf("Run(nil) error = %v", err)
+	}
+}